@@ -3,18 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App is the main application struct that holds all state and dependencies.
 type App struct {
 	ctx             context.Context
-	cmd             *exec.Cmd
+	singbox         singboxProcess // Running sing-box (direct or via the service)
 	isRunning       bool
 	hasError        bool
 	stoppedManually bool // Manual stop flag
@@ -24,21 +28,94 @@ type App struct {
 	basePath        string // Base path (exe directory)
 	singboxPath     string
 	logPath         string
-	logFile         *os.File
+	logFile         *RotatingLogFile
 	storage         *Storage                  // Unified storage for all settings
 	configBuilder   *ConfigBuilderForStorage  // Config builder for storage
 	trafficStats    *TrafficStats
+	trafficBreakdown *TrafficBreakdown        // Per-outbound and per-domain daily traffic
 	nativeWG        *NativeWireGuardManager   // Native WireGuard tunnel manager
-	logBuffer       []string // Log buffer for UI
-	logBufferMu     sync.RWMutex
+	prober          *ProxyProber              // Connection quality prober (nil when disabled or VPN stopped)
+	latencyHistory  *LatencyHistory           // Delay samples of the current proxy (last session)
+	latencyStop     chan struct{}             // Stops the latency sampler
+	speedMonitor    *SpeedMonitor             // Background speed test (nil when disabled or VPN stopped)
+	speedTestMu     sync.Mutex                // One speed test download at a time
+	procMonitor     *ProcessMonitor           // sing-box resource sampler
+	procMonitorStop chan struct{}             // Stops resource sampler goroutine
+	memoryRestartAt time.Time                 // Last restart over the memory limit
+	restarting      bool                      // VPN restart in progress
+	localAPI        *LocalAPIServer           // Local REST API listener (nil when disabled)
+	actionMu        sync.Mutex                // Serializes connect, disconnect, restart and profile switch of UI, tray, scheduler, watchdog and local API
+	captivePortal   *CaptivePortalResult      // Detected captive portal (nil if none)
+	captiveStop     chan struct{}             // Stops waiting for the portal to clear
+	captiveMu       sync.Mutex
+	effectiveLogLevel LogLevel                // Log level of the running sing-box
+	ignoreVPNConflicts bool                   // User chose to start despite another VPN (until it is gone)
+	schedule        profileScheduleState      // Scheduled profile switching state
+	scheduleKick    chan struct{}             // Triggers immediate schedule evaluation
+	scheduleMu      sync.Mutex
+	timerStop       chan struct{}             // Stops the VPN timer loop
+	timerDone       chan struct{}             // Closed when the VPN timer loop has finished
+	readiness       *ReadinessStatus          // Readiness of the current connection (nil without criteria)
+	readinessStop   chan struct{}             // Stops the readiness loop
+	readinessKick   chan struct{}             // Triggers immediate readiness evaluation
+	readinessMu     sync.Mutex
+	preflight       *PreflightStatus          // Connectivity check of the current connection (nil when stopped)
+	preflightStop   chan struct{}             // Stops the connectivity check
+	preflightMu     sync.Mutex
+	crash           *CrashReporter            // Writes crash files for panics
+	lastCrash       *CrashInfo                // Fatal crash of the previous run (nil if none)
+	dnsTracker      *DNSResolutionTracker     // Resolvers of internal domains this session
+	trayOnly        bool                      // Started without the window (--tray-only)
+	backendOnce     sync.Once                 // Background initialization runs once
+	guiRequested    chan struct{}             // Closed when the window is requested in tray-only mode
+	guiRequestOnce  sync.Once
+	standbyRebuild  sync.Mutex                // Held while a stale profile is rebuilt in the background
+	boundInterface  string                    // Adapter the direct outbound is bound to ("" = not bound)
+	interfaceStop   chan struct{}             // Stops the default interface watcher
+	networkStop     chan struct{}             // Stops the network change watcher
+	udpProbeStop    chan struct{}             // Stops the UDP probe after connect
+	udpProbeMu      sync.Mutex                // One UDP probe at a time
+	logScrubber     atomic.Pointer[LogScrubber] // Masks secrets of the connected profile in logs
+	measureDone     chan struct{}             // Closed when the measurement on connect finished (nil if off)
+	measurePinned   bool                      // Selector was pinned by the measurement on connect
+	powerWatcher    *PowerWatcher             // Suspend/resume notifications (nil if unavailable)
+	killSwitchAddrs []netip.Addr              // Proxy server addresses the kill switch allows this session
+	killSwitchOn    bool                      // Kill switch firewall rules are installed
+	logStore        *LogStore                 // Log entries for UI
+	startedAt       time.Time                 // When sing-box was last started
+	reconnectStop   chan struct{}             // Cancels the pending reconnect (nil if none)
+	reconnectAttempts int                     // Reconnect attempts since sing-box last ran stably
+	reconnectMu     sync.Mutex
+	bypassStop      chan struct{}             // Ends the temporary bypass countdown (nil if none)
+	bypassUntil     time.Time                 // When the temporary bypass reconnects
+	bypassMu        sync.Mutex
+	pauseStop       chan struct{}             // Ends the VPN pause timer (nil if not paused)
+	pauseUntil      time.Time                 // When the VPN pause ends by itself
+	pausedProxy     string                    // Selector member before the pause
+	pauseMu         sync.Mutex
+	fetchCancel     context.CancelFunc        // Cancels the subscription fetch in flight (nil if none)
+	fetchSeq        int                       // Number of the fetch fetchCancel belongs to
+	fetchMu         sync.Mutex
+	notifier        *Notifier                 // Desktop notifications
+	notifiedUpdate  string                    // Version the update notification was shown for
+	updateInfo      *UpdateInfo               // Result of the last update check (nil before the first)
+	updateFile      string                    // Downloaded update exe ("" if none)
+	updateMu        sync.Mutex
+	coreUpdateMu    sync.Mutex                // One sing-box core download at a time
 }
 
 // NewApp creates a new App application struct.
 func NewApp() *App {
-	return &App{
-		logBuffer:     make([]string, 0, MaxLogBufferSize),
+	app := &App{
+		logStore:      NewLogStore(),
 		windowVisible: true,
+		scheduleKick:  make(chan struct{}, 1),
+		readinessKick: make(chan struct{}, 1),
+		guiRequested:  make(chan struct{}),
+		notifier:      NewNotifier(),
 	}
+	app.crash = NewCrashReporter(defaultLogDir(), app.writeLog)
+	return app
 }
 
 // startup is called when the app starts.
@@ -46,28 +123,78 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	
 	// Perform heavy initialization in goroutine to not block UI
+	// (in tray-only mode it already ran before the window was requested)
+	a.startBackend()
+}
+
+// startBackend runs background initialization once
+func (a *App) startBackend() {
+	a.backendOnce.Do(func() {
+		go a.initBackend()
+	})
+}
+
+// initBackend initializes storage, WireGuard and background loops
+func (a *App) initBackend() {
+	defer a.crash.Guard("startup")
+	
+	a.setupLogPath()
+	a.checkLastCrash()
+	a.findPaths()
+	
+	// Initialize unified storage (replaces appConfig, profileManager, configBuilder)
+	a.initStorage()
+	
+	// Rules of a crashed previous run keep blocking traffic until the next connect or disconnect
+	a.detectKillSwitch()
+
+	// Initialize Native WireGuard Manager
+	a.initNativeWireGuard()
+	
+	// Initialize traffic stats
+	a.initTrafficStats()
+	
+	a.mu.Lock()
+	a.initialized = true
+	a.mu.Unlock()
+	
+	// Start local REST API if enabled
+	if err := a.startLocalAPI(); err != nil {
+		a.writeLog(fmt.Sprintf("[LocalAPI] Failed to start: %v", err))
+	}
+	
+	// Pre-build configs of recently used profiles (bound to the current adapter)
+	a.detectDirectInterface()
+	a.refreshWarmStandby()
+	
+	// Re-check tunnels as soon as the system wakes up
+	a.startPowerWatcher()
+	
+	// Apply the profile schedule at startup and on every boundary
+	go a.crash.Supervise("profile-scheduler", a.runProfileScheduler)
+	
+	// Connect and disconnect by the user's timers
+	a.startVPNTimers()
+	
+	// Set initial tray icon to disconnected (grey)
+	UpdateTrayIcon("disconnected")
+	
+	// Connect once the network is up if the user asked to
 	go func() {
-		a.setupLogPath()
-		a.findPaths()
-		
-		// Initialize unified storage (replaces appConfig, profileManager, configBuilder)
-		a.initStorage()
-		
-		// Initialize Native WireGuard Manager
-		a.initNativeWireGuard()
-		
-		// Initialize traffic stats
-		a.initTrafficStats()
-		
-		a.mu.Lock()
-		a.initialized = true
-		a.mu.Unlock()
-		
-		// Set initial tray icon to disconnected (grey)
-		UpdateTrayIcon("disconnected")
+		defer a.crash.Guard("connect-on-launch")
+		a.connectOnLaunch()
 	}()
 }
 
+// emitEvent sends an event to the frontend; a no-op while the window
+// hasn't been created (tray-only mode)
+func (a *App) emitEvent(name string, data ...interface{}) {
+	if a.ctx == nil {
+		return
+	}
+	wailsRuntime.EventsEmit(a.ctx, name, data...)
+}
+
 // waitForInit waits for initialization to complete (max 5 sec)
 func (a *App) waitForInit() bool {
 	for i := 0; i < 50; i++ {
@@ -84,9 +211,18 @@ func (a *App) waitForInit() bool {
 
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
+	// Stop local REST API first so no new commands arrive
+	a.stopLocalAPI()
+	
+	// ...and no timer connects VPN again
+	a.stopVPNTimers()
+	a.cancelBypass("exit")
+	
 	// Stop sing-box
 	a.Stop()
 	
+	a.stopPowerWatcher()
+	
 	// Stop WireGuard health check and all tunnels
 	if a.nativeWG != nil {
 		a.writeLog("Stopping WireGuard health check...")
@@ -102,6 +238,11 @@ func (a *App) shutdown(ctx context.Context) {
 		a.trafficStats.Save()
 	}
 	
+	// Remove pre-built configs if the user doesn't want them left on disk
+	if a.storage != nil && a.storage.GetAppSettings().ClearStandbyOnExit {
+		a.storage.ClearStandbyConfigs()
+	}
+	
 	// Storage auto-saves on every change, no need to save here
 }
 
@@ -112,19 +253,33 @@ func (a *App) initStorage() {
 	}
 	
 	a.storage = NewStorage(a.basePath)
+	
+	// Running from a USB stick: survive the drive being pulled out
+	portable := isRemovableDrive(a.basePath)
+	a.storage.SetPortable(portable)
+	
 	if err := a.storage.Init(); err != nil {
 		a.writeLog(fmt.Sprintf("Failed to init storage: %v", err))
 		return
 	}
 	
+	// Damaged settings.json was replaced from the backup (or by defaults)
+	if recovery := a.storage.Recovery(); recovery != nil {
+		a.writeLog(fmt.Sprintf("Settings recovered from %s: %s", recovery.Source, recovery.Reason))
+		if recovery.Source == RecoveredFromBackup {
+			a.AddToLogBuffer(fmt.Sprintf("Настройки восстановлены из резервной копии от %s",
+				recovery.BackupTime.Format("2006-01-02 15:04:05")))
+		} else {
+			a.AddToLogBuffer("Настройки повреждены и сброшены: резервная копия недоступна")
+		}
+	}
+	
 	// Create config builder for storage
 	a.configBuilder = NewConfigBuilderForStorage(a.storage)
+	a.configBuilder.SetSingboxPath(a.singboxPath)
 	
-	// Set routing mode from settings
 	settings := a.storage.GetAppSettings()
-	if settings.RoutingMode != "" {
-		a.configBuilder.SetRoutingMode(settings.RoutingMode)
-	}
+	setClashAPIEndpoint(defaultClashAPIAddress(), settings.ClashAPISecret)
 	
 	// Check filter freshness
 	a.checkFiltersFreshness()
@@ -135,6 +290,11 @@ func (a *App) initStorage() {
 	}
 	
 	a.writeLog("Storage initialized: " + a.storage.GetResourcesPath())
+	
+	if portable {
+		a.writeLog("Portable mode: resources are on removable media")
+		go a.crash.Supervise("portable-drive-watcher", a.watchPortableDrive)
+	}
 }
 
 // checkFiltersFreshness checks if routing filters are outdated and notifies user
@@ -172,6 +332,10 @@ func (a *App) initNativeWireGuard() {
 	
 	// Create native WireGuard manager - uses bundled binaries
 	a.nativeWG = NewNativeWireGuardManager(a.basePath, a.writeLog)
+	a.nativeWG.SetCrashReporter(a.crash)
+	if a.storage != nil {
+		a.nativeWG.SetMTUProbe(!a.storage.GetAppSettings().DisableMTUProbe)
+	}
 	
 	if err := a.nativeWG.Init(); err != nil {
 		a.writeLog(fmt.Sprintf("Failed to init Native WireGuard: %v", err))
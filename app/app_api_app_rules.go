@@ -0,0 +1,128 @@
+package main
+
+// Per-application routing methods for Kampus VPN
+// This file contains the API for app rules of the active profile
+
+import (
+	"fmt"
+)
+
+// GetAppRules returns app rules of the active profile (API для фронтенда)
+func (a *App) GetAppRules() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	rules := profile.AppRules
+	if rules == nil {
+		rules = []AppRule{}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"rules":   rules,
+	}
+}
+
+// AddAppRule routes an application direct, through the proxy or blocks it
+// in the active profile (API для фронтенда)
+func (a *App) AddAppRule(processName string, action string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	rule, err := normalizeAppRule(processName, action)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if err := a.storage.AddProfileAppRule(a.storage.GetActiveProfileID(), rule); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return a.applyAppRules(fmt.Sprintf("Правило для %s: %s", rule.ProcessName, rule.Action))
+}
+
+// RemoveAppRule removes the rule of an application from the active profile (API для фронтенда)
+func (a *App) RemoveAppRule(processName string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.RemoveProfileAppRule(a.storage.GetActiveProfileID(), processName); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return a.applyAppRules(fmt.Sprintf("Правило для %s удалено", processName))
+}
+
+// applyAppRules rebuilds the active profile and restarts a running VPN
+func (a *App) applyAppRules(message string) map[string]interface{} {
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if profile.SubscriptionURL != "" {
+		if err := a.configBuilder.BuildConfigForProfile(profile.ID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			errResult := a.rebuildErrorResult(err)
+			errResult["rules"] = profile.AppRules
+			return errResult
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("App rules of profile %d: %v", profile.ID, profile.AppRules))
+	a.AddToLogBuffer(message)
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		go a.restartVPN("Изменение правил для приложений")
+	}
+
+	rules := profile.AppRules
+	if rules == nil {
+		rules = []AppRule{}
+	}
+	return map[string]interface{}{
+		"success":    true,
+		"message":    message,
+		"rules":      rules,
+		"restarting": running,
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+// Block detection methods for Kampus VPN
+// This file contains the ISP block check and the always-proxy domain list API
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CheckIfBlocked tells whether a domain is blocked by the ISP or the server is down.
+// While VPN is connected the proxy path is used as the reference (API для фронтенда)
+func (a *App) CheckIfBlocked(domain string) map[string]interface{} {
+	a.waitForInit()
+
+	domain, err := normalizeCheckDomain(domain)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+
+	var proxyURL *url.URL
+	if running {
+		proxyURL = &url.URL{Scheme: "http", Host: "127.0.0.1:2080"}
+	}
+
+	resourcesPath := ""
+	if a.storage != nil {
+		resourcesPath = a.storage.GetResourcesPath()
+	}
+	signatures := LoadBlockSignatures(resourcesPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*BlockCheckTimeout)
+	defer cancel()
+	check := NewBlockDetector(signatures, proxyURL).Check(ctx, domain)
+
+	a.writeLog(fmt.Sprintf("Block check for %s: %s", domain, check.Verdict))
+
+	alreadyProxied := false
+	if a.storage != nil {
+		alreadyProxied = containsDomain(a.storage.GetAppSettings().AlwaysProxyDomains, domain)
+	}
+
+	return map[string]interface{}{
+		"success":            true,
+		"result":             check,
+		"signatures_version": signatures.Version,
+		"can_add_to_proxy":   check.Verdict == BlockVerdictBlockedByISP && !alreadyProxied,
+		"always_proxied":     alreadyProxied,
+	}
+}
+
+// containsDomain reports whether domain is in list
+func containsDomain(list []string, domain string) bool {
+	for _, d := range list {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAlwaysProxyDomains returns domains always routed through the proxy (API для фронтенда)
+func (a *App) GetAlwaysProxyDomains() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	domains := a.storage.GetAppSettings().AlwaysProxyDomains
+	if domains == nil {
+		domains = []string{}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"domains": domains,
+	}
+}
+
+// AddAlwaysProxyDomain routes domain through the proxy and rebuilds the active profile (API для фронтенда)
+func (a *App) AddAlwaysProxyDomain(domain string) map[string]interface{} {
+	a.waitForInit()
+
+	domain, err := normalizeCheckDomain(domain)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return a.updateAlwaysProxyDomains(func(domains []string) []string {
+		if containsDomain(domains, domain) {
+			return domains
+		}
+		return append(domains, domain)
+	}, fmt.Sprintf("Домен %s будет открываться через VPN", domain))
+}
+
+// RemoveAlwaysProxyDomain removes domain from the always-proxy list (API для фронтенда)
+func (a *App) RemoveAlwaysProxyDomain(domain string) map[string]interface{} {
+	a.waitForInit()
+
+	domain = strings.TrimSpace(strings.ToLower(domain))
+	return a.updateAlwaysProxyDomains(func(domains []string) []string {
+		filtered := make([]string, 0, len(domains))
+		for _, d := range domains {
+			if !strings.EqualFold(d, domain) {
+				filtered = append(filtered, d)
+			}
+		}
+		return filtered
+	}, fmt.Sprintf("Домен %s удалён из списка «всегда через VPN»", domain))
+}
+
+// updateAlwaysProxyDomains saves the modified list, rebuilds the active profile
+// and restarts a running VPN to apply it
+func (a *App) updateAlwaysProxyDomains(modify func([]string) []string, message string) map[string]interface{} {
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.AlwaysProxyDomains = modify(append([]string(nil), settings.AlwaysProxyDomains...))
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err == nil && profile.SubscriptionURL != "" {
+		if err := a.configBuilder.BuildConfigForProfile(profile.ID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			errResult := a.rebuildErrorResult(err)
+			errResult["domains"] = settings.AlwaysProxyDomains
+			return errResult
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Always-proxy domains: %v", settings.AlwaysProxyDomains))
+	a.AddToLogBuffer(message)
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		go a.restartVPN("Изменение списка доменов через VPN")
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"message":    message,
+		"domains":    settings.AlwaysProxyDomains,
+		"restarting": running,
+	}
+}
+
+// ExplainRoute tells which route rule of the active profile decides where
+// connections to a domain go, and what each routing mode would do with it
+// (API для фронтенда)
+func (a *App) ExplainRoute(domain string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	domain, err := normalizeExplainDomain(domain)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil || profile == nil || len(profile.SingboxConfig) == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("config_missing"),
+		}
+	}
+
+	target, resolveErr := resolveExplainTarget(domain)
+	if resolveErr != nil {
+		// Domain rules still apply, IP rules can't match
+		a.writeLog(fmt.Sprintf("[Explain] %s not resolved: %v", domain, resolveErr))
+	}
+	ips := make([]string, 0, len(target.IPs))
+	for _, ip := range target.IPs {
+		ips = append(ips, ip.String())
+	}
+
+	matcher := localRuleSetMatcher(a.singboxPath)
+	config := deepCopyJSONMap(profile.SingboxConfig)
+	a.storage.ResolveConfigPaths(config)
+	route, _ := config["route"].(map[string]interface{})
+	result := map[string]interface{}{
+		"success":      true,
+		"domain":       domain,
+		"ips":          ips,
+		"routing_mode": profile.EffectiveRoutingMode(),
+		"match":        explainRoute(route, target, matcher),
+	}
+	if resolveErr != nil {
+		result["resolve_error"] = resolveErr.Error()
+	}
+
+	routes, err := a.configBuilder.RoutingModeRoutes(profile.ID)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Explain] Routing modes not evaluated: %v", err))
+		return result
+	}
+	modes := make(map[RoutingMode]RouteMatch, len(routes))
+	for mode, modeRoute := range routes {
+		modes[mode] = explainRoute(modeRoute, target, matcher)
+	}
+	result["modes"] = modes
+	return result
+}
@@ -0,0 +1,240 @@
+package main
+
+// Config build info methods for Kampus VPN
+// This file contains API for build stamps of generated configs
+
+import (
+	"fmt"
+)
+
+// rebuildErrorResult converts a config build error into API response.
+// Downgrade errors get a confirmation flag so the frontend can ask the user.
+func (a *App) rebuildErrorResult(err error) map[string]interface{} {
+	result := map[string]interface{}{
+		"success": false,
+		"error":   err.Error(),
+	}
+	if downgradeErr, ok := asConfigDowngradeError(err); ok {
+		result["requires_confirmation"] = true
+		result["downgrade"] = map[string]interface{}{
+			"profile_id":         downgradeErr.ProfileID,
+			"config_version":     downgradeErr.AppVersion,
+			"config_revision":    downgradeErr.SchemaRevision,
+			"supported_revision": ConfigSchemaRevision,
+		}
+	}
+	if tlsErr, ok := asSubscriptionTLSError(err); ok {
+		result["tls_error"] = tlsErr.ToMap()
+	}
+	return result
+}
+
+// activeBuildWarnings returns warnings of the last build of the active profile
+func (a *App) activeBuildWarnings() []BuildWarning {
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil || profile.BuildWarnings == nil {
+		return []BuildWarning{}
+	}
+	return profile.BuildWarnings
+}
+
+// GetProfileBuildInfo returns build stamp of the profile's generated config (API для фронтенда)
+func (a *App) GetProfileBuildInfo(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return map[string]interface{}{
+		"success":            true,
+		"profile_id":         profile.ID,
+		"has_config":         len(profile.SingboxConfig) > 0,
+		"build_info":         profile.BuildInfo.ToMap(),
+		"warnings":           profile.BuildWarnings,
+		"warning_count":      len(profile.BuildWarnings),
+		"filtered_proxies":   profile.FilteredProxies,
+		"overlap_exception":  !profile.DisableOverlapException,
+		"supported_revision": ConfigSchemaRevision,
+		"app_version":        Version,
+	}
+}
+
+// ConfirmConfigRebuild rebuilds a profile whose config was produced by a newer
+// app version, after the user confirmed the downgrade (API для фронтенда)
+func (a *App) ConfirmConfigRebuild(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_rebuild"),
+		}
+	}
+	a.mu.Unlock()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.configBuilder.ConfirmDowngrade(profileID)
+	if err := a.configBuilder.BuildConfigForProfile(profileID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+		return a.rebuildErrorResult(err)
+	}
+
+	a.writeLog(fmt.Sprintf("Config of profile %d rebuilt with schema %d (downgrade confirmed)", profileID, ConfigSchemaRevision))
+
+	return map[string]interface{}{
+		"success": true,
+		"message": a.tr("config_rebuilt"),
+	}
+}
+
+// migrateProfileConfig runs the migration chain on the stored config of a
+// profile. Called on connect and profile activation, not on status polls.
+func (a *App) migrateProfileConfig(profileID int) {
+	report, err := a.storage.MigrateProfileConfig(profileID)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Config migration of profile %d failed: %v", profileID, err))
+	} else if report != nil {
+		a.logConfigMigration(profileID, report)
+	}
+}
+
+// logConfigMigration writes the migration chain result to the log
+func (a *App) logConfigMigration(profileID int, report *ConfigMigrationReport) {
+	a.writeLog(fmt.Sprintf("Config of profile %d migrated: schema %d -> %d", profileID, report.FromRevision, report.ToRevision))
+	for _, step := range report.Steps {
+		a.writeLog(fmt.Sprintf("  [%d] %s: %d change(s)", step.Revision, step.Description, len(step.Changes)))
+		for _, change := range step.Changes {
+			a.writeLog("    - " + change)
+		}
+	}
+	if report.Changed() {
+		a.AddToLogBuffer(fmt.Sprintf("Конфиг профиля %d обновлён до схемы %d", profileID, report.ToRevision))
+	}
+}
+
+// PreviewConfigMigration returns changes the migration chain would make
+// to the stored config of a profile, without saving them (API для фронтенда)
+func (a *App) PreviewConfigMigration(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if len(profile.SingboxConfig) == 0 || !NeedsConfigMigration(profile.BuildInfo) {
+		return map[string]interface{}{
+			"success":         true,
+			"needs_migration": false,
+			"from_revision":   configRevision(profile.BuildInfo),
+			"to_revision":     ConfigSchemaRevision,
+			"steps":           []ConfigMigrationStep{},
+		}
+	}
+
+	migrated, report := MigrateConfig(profile.SingboxConfig, configRevision(profile.BuildInfo), profile.WireGuardConfigs)
+	after, err := MarshalCanonicalJSONIndent(migrated, "", "  ")
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("config_marshal_failed", err),
+		}
+	}
+
+	return map[string]interface{}{
+		"success":         true,
+		"needs_migration": true,
+		"changed":         report.Changed(),
+		"from_revision":   report.FromRevision,
+		"to_revision":     report.ToRevision,
+		"steps":           report.Steps,
+		"config":          string(after),
+	}
+}
+
+// SetOverlapException enables or disables the automatic direct route for proxy
+// servers that overlap WireGuard networks, and rebuilds the profile (API для фронтенда)
+func (a *App) SetOverlapException(profileID int, enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_setting"),
+		}
+	}
+	a.mu.Unlock()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.SetProfileOverlapException(profileID, enabled); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if len(profile.SingboxConfig) > 0 {
+		if err := a.configBuilder.BuildConfigForProfile(profileID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			return a.rebuildErrorResult(err)
+		}
+		profile, _ = a.storage.GetProfile(profileID)
+	}
+
+	return map[string]interface{}{
+		"success":  true,
+		"warnings": profile.BuildWarnings,
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+// Connection list for Kampus VPN
+// This file contains the API for viewing and closing live sing-box connections
+
+import (
+	"net/http"
+	"time"
+)
+
+// GetActiveConnections returns the open connections with the rule that routed
+// each of them, and the same connections grouped by destination host (API для фронтенда)
+func (a *App) GetActiveConnections() map[string]interface{} {
+	if !a.isRunning {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	var resp struct {
+		DownloadTotal int64             `json:"downloadTotal"`
+		UploadTotal   int64             `json:"uploadTotal"`
+		Connections   []clashConnection `json:"connections"`
+	}
+	if err := clashGetJSON(client, "/connections", &resp); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("clash_api_connect_failed", err),
+		}
+	}
+
+	connections, byHost := normalizeConnections(resp.Connections, time.Now())
+	return map[string]interface{}{
+		"success":       true,
+		"connections":   connections,
+		"byHost":        byHost,
+		"count":         len(connections),
+		"uploadTotal":   resp.UploadTotal,
+		"downloadTotal": resp.DownloadTotal,
+	}
+}
+
+// CloseConnection closes one connection by its ID (API для фронтенда)
+func (a *App) CloseConnection(id string) map[string]interface{} {
+	if !a.isRunning {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+	if id == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("connection_id_required"),
+		}
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if err := clashCloseConnection(client, id); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"success": true,
+	}
+}
+
+// CloseAllConnections closes every open connection; apps reconnect through
+// the current routing (API для фронтенда)
+func (a *App) CloseAllConnections() map[string]interface{} {
+	if !a.isRunning {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if err := clashCloseConnections(client); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	a.writeLog("All connections closed by user")
+	return map[string]interface{}{
+		"success": true,
+	}
+}
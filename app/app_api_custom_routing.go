@@ -0,0 +1,118 @@
+package main
+
+// Custom routing methods for Kampus VPN
+// This file contains the API for the user's own sing-box route rules of the custom routing mode
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GetCustomRouting returns the custom route rules of the active profile as
+// JSON text for the editor (API для фронтенда)
+func (a *App) GetCustomRouting() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	result := map[string]interface{}{
+		"success":    true,
+		"active":     profile.EffectiveRoutingMode() == RoutingModeCustom,
+		"configured": profile.CustomRouting != nil,
+		"rules":      "[]",
+		"rule_set":   "[]",
+		"final":      "proxy",
+	}
+	if custom := profile.CustomRouting; custom != nil {
+		if data, err := json.MarshalIndent(custom.Rules, "", "  "); err == nil {
+			result["rules"] = string(data)
+		}
+		if len(custom.RuleSets) > 0 {
+			if data, err := json.MarshalIndent(custom.RuleSets, "", "  "); err == nil {
+				result["rule_set"] = string(data)
+			}
+		}
+		result["final"] = custom.EffectiveFinal()
+	}
+	return result
+}
+
+// SetCustomRouting stores the user's route rules (JSON array), optional
+// rule_set entries (JSON array) and the final outbound of the active profile.
+// When the profile is in the custom mode it is rebuilt, and rules that fail
+// the build are not kept (API для фронтенда)
+func (a *App) SetCustomRouting(rulesJSON, ruleSetsJSON, final string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	custom, err := ParseCustomRouting(rulesJSON, ruleSetsJSON, final)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	previous := profile.CustomRouting
+
+	if err := a.storage.SetProfileCustomRouting(profile.ID, custom); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	active := profile.EffectiveRoutingMode() == RoutingModeCustom
+	if active && profile.SubscriptionURL != "" {
+		if err := a.configBuilder.BuildConfigForProfile(profile.ID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			if restoreErr := a.storage.SetProfileCustomRouting(profile.ID, previous); restoreErr != nil {
+				a.writeLog(fmt.Sprintf("Failed to restore custom routing of profile %d: %v", profile.ID, restoreErr))
+			}
+			return a.rebuildErrorResult(err)
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Custom routing of profile %d: %d rules, %d rule sets, final=%s",
+		profile.ID, len(custom.Rules), len(custom.RuleSets), custom.EffectiveFinal()))
+	a.AddToLogBuffer(fmt.Sprintf("Свои правила маршрутизации сохранены (%d)", len(custom.Rules)))
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	restarting := running && active
+	if restarting {
+		go a.restartVPN("Изменение правил маршрутизации")
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"active":     active,
+		"restarting": restarting,
+	}
+}
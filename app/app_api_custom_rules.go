@@ -0,0 +1,143 @@
+package main
+
+// Custom domain rule methods for Kampus VPN
+// This file contains the API for always-proxy, always-direct and block lists of the active profile
+
+import (
+	"fmt"
+)
+
+// GetCustomRules returns custom domain lists of the active profile (API для фронтенда)
+func (a *App) GetCustomRules() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"rules":   customRulesResult(profile.CustomRules),
+	}
+}
+
+// AddCustomRule adds a domain to a list ("proxy", "direct" or "block") of the
+// active profile. "full:example.com" matches only the domain itself (API для фронтенда)
+func (a *App) AddCustomRule(list string, domain string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	normalized, err := normalizeCustomDomain(domain)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if err := a.storage.AddProfileCustomDomain(a.storage.GetActiveProfileID(), list, normalized); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return a.applyCustomRules(fmt.Sprintf("Домен %s добавлен в список %s", normalized, list))
+}
+
+// RemoveCustomRule removes a domain from a list of the active profile (API для фронтенда)
+func (a *App) RemoveCustomRule(list string, domain string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	normalized, err := normalizeCustomDomain(domain)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if err := a.storage.RemoveProfileCustomDomain(a.storage.GetActiveProfileID(), list, normalized); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return a.applyCustomRules(fmt.Sprintf("Домен %s удалён из списка %s", normalized, list))
+}
+
+// applyCustomRules rebuilds the active profile and restarts a running VPN
+func (a *App) applyCustomRules(message string) map[string]interface{} {
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if profile.SubscriptionURL != "" {
+		if err := a.configBuilder.BuildConfigForProfile(profile.ID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			errResult := a.rebuildErrorResult(err)
+			errResult["rules"] = customRulesResult(profile.CustomRules)
+			return errResult
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Custom domain rules of profile %d: %+v", profile.ID, customRulesResult(profile.CustomRules)))
+	a.AddToLogBuffer(message)
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		go a.restartVPN("Изменение пользовательских правил")
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"message":    message,
+		"rules":      customRulesResult(profile.CustomRules),
+		"restarting": running,
+	}
+}
+
+// customRulesResult returns the lists for the frontend (empty lists instead of null)
+func customRulesResult(rules *CustomDomainRules) map[string][]string {
+	result := map[string][]string{
+		CustomRuleProxy:  {},
+		CustomRuleDirect: {},
+		CustomRuleBlock:  {},
+	}
+	if rules != nil {
+		result[CustomRuleProxy] = append(result[CustomRuleProxy], rules.ProxyDomains...)
+		result[CustomRuleDirect] = append(result[CustomRuleDirect], rules.DirectDomains...)
+		result[CustomRuleBlock] = append(result[CustomRuleBlock], rules.BlockDomains...)
+	}
+	return result
+}
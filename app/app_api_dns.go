@@ -0,0 +1,133 @@
+package main
+
+// DNS methods for Kampus VPN
+// This file contains the active DNS server list and the preferred resolver override
+
+import (
+	"fmt"
+)
+
+// GetDNSServers returns dns.servers of the active config and the preferred resolver (API для фронтенда)
+func (a *App) GetDNSServers() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	servers := []map[string]interface{}{}
+	finalTag := ""
+	if dns, ok := profile.SingboxConfig["dns"].(map[string]interface{}); ok {
+		finalTag = finalDNSTag(dns)
+		wgTags := wireGuardDNSTags(profile.WireGuardConfigs)
+		list, _ := dns["servers"].([]interface{})
+		for _, s := range list {
+			server, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tag, _ := server["tag"].(string)
+			serverType, _ := server["type"].(string)
+			detour, _ := server["detour"].(string)
+			servers = append(servers, map[string]interface{}{
+				"tag":       tag,
+				"type":      serverType,
+				"address":   describeDNSServer(server),
+				"detour":    detour,
+				"final":     tag == finalTag,
+				"wireguard": wgTags[tag],
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"success":   true,
+		"servers":   servers,
+		"final":     finalTag,
+		"preferred": a.storage.GetAppSettings().PreferredDNS,
+		"presets":   DNSPresets,
+	}
+}
+
+// SetPreferredDNS sets the final resolver to a preset ID or a custom IP/DoH URL,
+// "" restores the template resolver. Configs of all profiles are updated in place;
+// a running VPN is restarted to apply the change (API для фронтенда)
+func (a *App) SetPreferredDNS(value string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	address, err := ResolvePreferredDNS(value)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.PreferredDNS = value
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	// Patch stored configs instead of refetching subscriptions. Configs of a
+	// newer app version are left alone; their build stamps stay as they are.
+	for _, profile := range a.storage.GetAllProfiles() {
+		if len(profile.SingboxConfig) == 0 || profile.BuildInfo.IsNewer() {
+			continue
+		}
+		config := deepCopyJSONMap(profile.SingboxConfig)
+		if err := a.configBuilder.applyPreferredDNS(config, profile.WireGuardConfigs); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("dns_apply_failed", err),
+			}
+		}
+		if err := a.storage.PatchProfileConfig(profile.ID, config); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+	}
+
+	if address == "" {
+		a.writeLog("Preferred DNS reset to template default")
+	} else {
+		a.writeLog(fmt.Sprintf("Preferred DNS set to %s", address))
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		go a.restartVPN("Смена DNS-сервера")
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"preferred":  value,
+		"address":    address,
+		"restarting": running,
+	}
+}
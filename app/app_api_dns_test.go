@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testDNSConfig returns a stored config whose final resolver is "local"
+func testDNSConfig() map[string]interface{} {
+	config := testRuntimeConfig()
+	config["dns"].(map[string]interface{})["final"] = "local"
+	return config
+}
+
+// finalDNSServer returns the dns.servers entry that dns.final points to
+func finalDNSServer(config map[string]interface{}) map[string]interface{} {
+	dns, _ := config["dns"].(map[string]interface{})
+	servers, _ := dns["servers"].([]interface{})
+	for _, s := range servers {
+		if server, ok := s.(map[string]interface{}); ok && server["tag"] == finalDNSTag(dns) {
+			return server
+		}
+	}
+	return nil
+}
+
+func TestSetPreferredDNSKeepsNewerConfigs(t *testing.T) {
+	a, current := testActivationApp(t)
+	a.configBuilder = NewConfigBuilderForStorage(a.storage)
+
+	if err := a.storage.UpdateProfileConfig(current.ID, testDNSConfig()); err != nil {
+		t.Fatal(err)
+	}
+	stamp := *mustStoredProfile(t, a.storage, current.ID).BuildInfo
+
+	newer, err := a.storage.CreateProfile("Newer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.storage.UpdateProfileConfig(newer.ID, testDNSConfig()); err != nil {
+		t.Fatal(err)
+	}
+	setTestBuildInfo(t, a.storage, newer.ID, &ConfigBuildInfo{AppVersion: "9.0.0", SchemaRevision: ConfigSchemaRevision + 1})
+	before, _ := json.Marshal(mustStoredProfile(t, a.storage, newer.ID).SingboxConfig)
+	a.configBuilder.ConfirmDowngrade(newer.ID)
+
+	result := a.SetPreferredDNS("quad9")
+	if result["success"] != true {
+		t.Fatalf("SetPreferredDNS = %v", result)
+	}
+
+	// The current config is patched and keeps its stamp
+	patched := mustStoredProfile(t, a.storage, current.ID)
+	if server := finalDNSServer(patched.SingboxConfig); server == nil || server["server"] != "9.9.9.9" {
+		t.Errorf("final resolver = %v, want quad9", server)
+	}
+	if *patched.BuildInfo != stamp {
+		t.Errorf("BuildInfo = %+v, want %+v", patched.BuildInfo, stamp)
+	}
+
+	// The newer config is untouched and the pending confirmation survives
+	if after, _ := json.Marshal(mustStoredProfile(t, a.storage, newer.ID).SingboxConfig); string(after) != string(before) {
+		t.Errorf("newer config patched:\n got %s\nwant %s", after, before)
+	}
+	if err := a.configBuilder.checkDowngrade(newer.ID); err != nil {
+		t.Errorf("checkDowngrade = %v, want the confirmation kept", err)
+	}
+}
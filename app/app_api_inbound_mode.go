@@ -0,0 +1,88 @@
+package main
+
+// Inbound mode methods for Kampus VPN
+// This file contains switching between TUN and the local proxy mode
+
+import (
+	"fmt"
+)
+
+// getInboundStatus returns the inbound mode and local proxy port for GetStatus
+func (a *App) getInboundStatus() map[string]interface{} {
+	settings := GlobalAppSettings{}
+	if a.storage != nil {
+		settings = a.storage.GetAppSettings()
+	}
+	return map[string]interface{}{
+		"mode": settings.EffectiveInboundMode(),
+		"port": settings.EffectiveProxyInboundPort(),
+	}
+}
+
+// SetInboundMode switches between TUN and local proxy mode (API для фронтенда).
+// port is the local SOCKS5/HTTP port of proxy mode (0 = DefaultProxyInboundPort).
+func (a *App) SetInboundMode(mode string, port int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := validateInboundMode(mode); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	if port == 0 {
+		port = DefaultProxyInboundPort
+	}
+
+	a.mu.Lock()
+	isRunning := a.isRunning
+	a.mu.Unlock()
+
+	if isRunning {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_mode"),
+		}
+	}
+
+	if mode == InboundModeProxy {
+		if err := checkProxyPortFree(port); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.InboundMode = mode
+	settings.ProxyInboundPort = port
+	if port == DefaultProxyInboundPort {
+		settings.ProxyInboundPort = 0
+	}
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Inbound mode: %s, proxy port %d", mode, port))
+	if mode == InboundModeProxy {
+		a.AddToLogBuffer(fmt.Sprintf("Режим прокси: укажите в браузере прокси 127.0.0.1:%d", port))
+	} else {
+		a.AddToLogBuffer("Режим TUN: весь трафик идёт через VPN")
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"inbound": a.getInboundStatus(),
+	}
+}
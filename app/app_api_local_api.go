@@ -0,0 +1,229 @@
+package main
+
+// Local REST API methods for Kampus VPN
+// This file contains the HTTP routes of the local integration API and its settings
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// localAPIHandler builds routes of the local REST API.
+// Handlers are thin wrappers over the App methods used by the frontend.
+func (a *App) localAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		status := a.GetStatus()
+		status["success"] = true
+		writeLocalAPIJSON(w, http.StatusOK, status)
+	})
+
+	mux.HandleFunc("POST /connect", func(w http.ResponseWriter, r *http.Request) {
+		a.writeLog(fmt.Sprintf("[LocalAPI] POST /connect from %s", r.RemoteAddr))
+		a.localAPIResult(w, a.runLocalAPIAction(a.Start))
+	})
+
+	mux.HandleFunc("POST /disconnect", func(w http.ResponseWriter, r *http.Request) {
+		a.writeLog(fmt.Sprintf("[LocalAPI] POST /disconnect from %s", r.RemoteAddr))
+		a.localAPIResult(w, a.runLocalAPIAction(a.Stop))
+	})
+
+	mux.HandleFunc("POST /profile/{id}/activate", func(w http.ResponseWriter, r *http.Request) {
+		a.writeLog(fmt.Sprintf("[LocalAPI] POST /profile/%s/activate from %s", r.PathValue("id"), r.RemoteAddr))
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeLocalAPIJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   a.tr("profile_id_invalid"),
+			})
+			return
+		}
+		a.localAPIResult(w, a.runLocalAPIAction(func() map[string]interface{} {
+			return a.SetActiveProfile(id)
+		}))
+	})
+
+	mux.HandleFunc("GET /proxies", func(w http.ResponseWriter, r *http.Request) {
+		// ?offset=&limit= page the list; missing values mean the first default page
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		a.localAPIResult(w, a.GetProxiesWithDelay(offset, limit))
+	})
+
+	return mux
+}
+
+// runLocalAPIAction runs a state-changing call and notifies the UI. The App
+// methods wait on a.actionMu, so they never overlap with UI, tray or scheduler actions.
+func (a *App) runLocalAPIAction(action func() map[string]interface{}) map[string]interface{} {
+	result := action()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if a.ctx != nil {
+		a.emitEvent("vpn-status-changed", running)
+	}
+	return result
+}
+
+// localAPIResult writes an App method result, mapping failures to HTTP 409.
+func (a *App) localAPIResult(w http.ResponseWriter, result map[string]interface{}) {
+	status := http.StatusOK
+	if success, ok := result["success"].(bool); ok && !success {
+		status = http.StatusConflict
+	}
+	writeLocalAPIJSON(w, status, result)
+}
+
+// startLocalAPI starts the listener if it is enabled in settings
+func (a *App) startLocalAPI() error {
+	if a.storage == nil {
+		return fmt.Errorf("storage not initialized")
+	}
+	settings := a.storage.GetAppSettings()
+	if !settings.LocalAPIEnabled || settings.LocalAPIToken == "" {
+		return nil
+	}
+
+	port := settings.LocalAPIPort
+	if port == 0 {
+		port = DefaultLocalAPIPort
+	}
+
+	a.stopLocalAPI()
+
+	server := NewLocalAPIServer(port, settings.LocalAPIToken, a.localAPIHandler())
+	if err := server.Start(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.localAPI = server
+	a.mu.Unlock()
+
+	a.writeLog(fmt.Sprintf("[LocalAPI] Listening on %s:%d", LocalAPIHost, port))
+	return nil
+}
+
+// stopLocalAPI stops the listener if it is running
+func (a *App) stopLocalAPI() {
+	a.mu.Lock()
+	server := a.localAPI
+	a.localAPI = nil
+	a.mu.Unlock()
+
+	if server != nil {
+		server.Stop()
+		a.writeLog("[LocalAPI] Stopped")
+	}
+}
+
+// localAPIInfo returns connection info of the local API.
+func (a *App) localAPIInfo(settings GlobalAppSettings) map[string]interface{} {
+	port := settings.LocalAPIPort
+	if port == 0 {
+		port = DefaultLocalAPIPort
+	}
+
+	a.mu.Lock()
+	listening := a.localAPI != nil
+	a.mu.Unlock()
+
+	tokenHint := ""
+	if len(settings.LocalAPIToken) > 4 {
+		tokenHint = "…" + settings.LocalAPIToken[len(settings.LocalAPIToken)-4:]
+	}
+
+	return map[string]interface{}{
+		"success":   true,
+		"enabled":   settings.LocalAPIEnabled,
+		"listening": listening,
+		"port":      port,
+		"url":       fmt.Sprintf("http://%s:%d", LocalAPIHost, port),
+		"tokenHint": tokenHint,
+	}
+}
+
+// GetLocalAPIInfo возвращает состояние локального REST API (API для фронтенда).
+// Полный токен не возвращается - он показывается один раз при включении.
+func (a *App) GetLocalAPIInfo() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	return a.localAPIInfo(a.storage.GetAppSettings())
+}
+
+// SetLocalAPIEnabled включает/выключает локальный REST API без перезапуска (API для фронтенда).
+// При включении генерируется новый токен, который возвращается в ответе один раз.
+func (a *App) SetLocalAPIEnabled(enabled bool, port int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if port == 0 {
+		port = DefaultLocalAPIPort
+	}
+	// The controller may have moved off ClashAPIPort if another program took it
+	controllerPort := clashAPIPort()
+	if port < 1024 || port > 65535 || port == controllerPort {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("port_invalid", controllerPort),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	a.stopLocalAPI()
+
+	token := ""
+	if enabled {
+		var err error
+		token, err = GenerateLocalAPIToken()
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("token_generate_failed", err),
+			}
+		}
+		settings.LocalAPIToken = token
+	}
+	settings.LocalAPIEnabled = enabled
+	settings.LocalAPIPort = port
+
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	if enabled {
+		if err := a.startLocalAPI(); err != nil {
+			a.writeLog(fmt.Sprintf("[LocalAPI] Failed to start: %v", err))
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("local_api_start_failed", port, err),
+			}
+		}
+	}
+
+	result := a.localAPIInfo(settings)
+	if enabled {
+		result["token"] = token
+	}
+	return result
+}
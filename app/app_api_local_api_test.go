@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSingbox is a sing-box process that records Stop calls
+type fakeSingbox struct {
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (p *fakeSingbox) Pid() int    { return 4242 }
+func (p *fakeSingbox) Wait() error { return nil }
+
+func (p *fakeSingbox) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	return nil
+}
+
+// serveLocalAPI sends a request to the App routes and decodes the JSON answer
+func serveLocalAPI(t *testing.T, a *App, method, path string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	a.localAPIHandler().ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: invalid JSON %q: %v", method, path, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+// useClashEndpoint points the Clash API at address for the test
+func useClashEndpoint(t *testing.T, address string) {
+	t.Helper()
+	previous := clashAPIAddress()
+	setClashAPIEndpoint(address, "")
+	t.Cleanup(func() { setClashAPIEndpoint(previous, "") })
+}
+
+func TestLocalAPIStatus(t *testing.T) {
+	a, _ := testActivationApp(t)
+
+	for _, running := range []bool{false, true} {
+		a.isRunning = running
+		code, body := serveLocalAPI(t, a, http.MethodGet, "/status")
+		if code != http.StatusOK {
+			t.Fatalf("running=%v: status = %d, want 200", running, code)
+		}
+		if body["success"] != true || body["running"] != running {
+			t.Errorf("running=%v: body = %v", running, body)
+		}
+	}
+}
+
+func TestLocalAPIConnectWhileRunning(t *testing.T) {
+	a, _ := testActivationApp(t)
+	a.isRunning = true
+
+	code, body := serveLocalAPI(t, a, http.MethodPost, "/connect")
+	if code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", code)
+	}
+	if body["success"] != false || body["error"] != a.tr("vpn_already_running") {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestLocalAPIDisconnect(t *testing.T) {
+	a, _ := testActivationApp(t)
+	process := &fakeSingbox{}
+	a.isRunning = true
+	a.singbox = process
+
+	code, body := serveLocalAPI(t, a, http.MethodPost, "/disconnect")
+	if code != http.StatusOK || body["success"] != true {
+		t.Fatalf("status = %d, body = %v", code, body)
+	}
+	process.mu.Lock()
+	stopped := process.stopped
+	process.mu.Unlock()
+	if !stopped {
+		t.Error("sing-box was not stopped")
+	}
+	if !a.stoppedManually {
+		t.Error("stoppedManually = false, the monitor would treat the exit as a crash")
+	}
+}
+
+func TestLocalAPIActivateProfile(t *testing.T) {
+	a, profile := testActivationApp(t)
+	path := "/profile/" + strconv.Itoa(profile.ID) + "/activate"
+
+	tests := []struct {
+		name     string
+		path     string
+		running  bool
+		want     int
+		activeID int
+	}{
+		{"invalid id", "/profile/abc/activate", false, http.StatusBadRequest, DefaultProfileID},
+		{"unknown profile", "/profile/9999/activate", false, http.StatusConflict, DefaultProfileID},
+		{"vpn running", path, true, http.StatusConflict, DefaultProfileID},
+		{"activated", path, false, http.StatusOK, profile.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.isRunning = tt.running
+			code, body := serveLocalAPI(t, a, http.MethodPost, tt.path)
+			if code != tt.want {
+				t.Errorf("status = %d, want %d (body %v)", code, tt.want, body)
+			}
+			if got := a.storage.GetActiveProfileID(); got != tt.activeID {
+				t.Errorf("active profile = %d, want %d", got, tt.activeID)
+			}
+		})
+	}
+}
+
+func TestLocalAPIProxies(t *testing.T) {
+	clash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/proxies" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"proxies":{
+			"proxy":  {"name":"proxy","type":"Selector"},
+			"DIRECT": {"name":"DIRECT","type":"Direct"},
+			"de-1":   {"name":"de-1","type":"VLESS","history":[{"time":"2026-01-01T00:00:00Z","delay":120}]},
+			"nl-1":   {"name":"nl-1","type":"Trojan"},
+			"us-1":   {"name":"us-1","type":"Shadowsocks"}
+		}}`))
+	}))
+	defer clash.Close()
+	useClashEndpoint(t, strings.TrimPrefix(clash.URL, "http://"))
+
+	a, _ := testActivationApp(t)
+
+	code, body := serveLocalAPI(t, a, http.MethodGet, "/proxies")
+	if code != http.StatusConflict {
+		t.Errorf("stopped: status = %d, want 409", code)
+	}
+
+	a.isRunning = true
+	code, body = serveLocalAPI(t, a, http.MethodGet, "/proxies?offset=1&limit=1")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, body = %v", code, body)
+	}
+	if body["total"] != float64(3) || body["offset"] != float64(1) {
+		t.Errorf("total = %v, offset = %v, want 3 and 1", body["total"], body["offset"])
+	}
+	proxies, _ := body["proxies"].([]interface{})
+	if len(proxies) != 1 {
+		t.Fatalf("proxies = %v, want one", proxies)
+	}
+	if name := proxies[0].(map[string]interface{})["name"]; name != "nl-1" {
+		t.Errorf("page = %v, want nl-1", name)
+	}
+}
+
+func TestSetLocalAPIEnabledRejectsControllerPort(t *testing.T) {
+	useClashEndpoint(t, "127.0.0.1:40123")
+	a, _ := testActivationApp(t)
+
+	result := a.SetLocalAPIEnabled(true, 40123)
+	if result["success"] != false {
+		t.Fatalf("controller port accepted: %v", result)
+	}
+	if want := a.tr("port_invalid", 40123); result["error"] != want {
+		t.Errorf("error = %v, want %q", result["error"], want)
+	}
+	if a.storage.GetAppSettings().LocalAPIEnabled {
+		t.Error("local API enabled on the controller port")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+// Offline proxy ping for Kampus VPN
+// This file contains the API for testing proxy servers without a running VPN
+
+import (
+	"fmt"
+	"time"
+)
+
+// TestProxiesOffline measures TCP connect (and TLS handshake) time to every
+// proxy server. urlOrCurrent is a subscription URL or a single proxy link;
+// "" or "current" tests the outbounds of the active profile. Results are
+// marked "method": "tcp" and are not comparable with TestProxyDelay (API для фронтенда)
+func (a *App) TestProxiesOffline(urlOrCurrent string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	var targets []offlinePingTarget
+	switch {
+	case urlOrCurrent == "" || urlOrCurrent == "current":
+		profile, err := a.storage.GetActiveProfile()
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("profile_not_found_err", err),
+			}
+		}
+		outbounds, _ := profile.SingboxConfig["outbounds"].([]interface{})
+		targets = offlineTargetsFromOutbounds(outbounds)
+
+	case isDirectProxyLink(urlOrCurrent):
+		proxy, err := NewSubscriptionFetcher().ParseSingleLink(urlOrCurrent)
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("link_parse_failed", err),
+			}
+		}
+		targets = offlineTargetsFromProxies([]ProxyConfig{proxy})
+
+	default:
+		var opts SubscriptionRequestOptions
+		if profile, err := a.storage.GetActiveProfile(); err == nil && profile.SubscriptionURL == urlOrCurrent {
+			opts.Headers = profile.SubscriptionHeaders
+			opts.Insecure = profile.SubscriptionInsecureSkipVerify
+		}
+		opts.Bootstrap = a.bootstrapProxy()
+		opts.Limits = a.subscriptionLimits()
+		proxies, _, err := NewSubscriptionFetcher().Fetch(urlOrCurrent, opts)
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+		targets = offlineTargetsFromProxies(proxies)
+	}
+
+	if len(targets) == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("no_servers_to_check"),
+		}
+	}
+
+	started := time.Now()
+	results := PingProxiesOffline(targets)
+	now := time.Now()
+
+	entries := make([]map[string]interface{}, 0, len(results))
+	reachable := 0
+	for _, r := range results {
+		entry := r.Measurement.Fields(now, DefaultDelayFreshnessSec*time.Second)
+		entry["name"] = r.Name
+		entry["type"] = r.Type
+		entry["server"] = r.Server
+		entry["port"] = r.Port
+		if r.TLSDelay > 0 {
+			entry["tls_delay"] = r.TLSDelay
+		}
+		if r.Error != "" {
+			entry["error"] = r.Error
+		}
+		if r.Measurement.Status == DelayStatusOK {
+			reachable++
+		}
+		entries = append(entries, entry)
+	}
+
+	a.writeLog(fmt.Sprintf("[OfflinePing] %d/%d servers reachable in %v", reachable, len(results), time.Since(started).Round(time.Millisecond)))
+	return map[string]interface{}{
+		"success":   true,
+		"method":    DelayMethodTCP,
+		"results":   entries,
+		"total":     len(results),
+		"reachable": reachable,
+	}
+}
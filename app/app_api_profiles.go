@@ -15,12 +15,13 @@ func (a *App) GetProfiles() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
 	profiles := a.storage.GetAllProfiles()
 	activeID := a.storage.GetActiveProfileID()
+	standby := a.storage.StandbyConfigs()
 	
 	var profilesData []map[string]interface{}
 	for _, p := range profiles {
@@ -40,13 +41,19 @@ func (a *App) GetProfiles() map[string]interface{} {
 			"isActive":     p.ID == activeID,
 			"createdAt":    p.CreatedAt.Format(time.RFC3339),
 			"proxyCount":   p.ProxyCount,
+			"warningCount": len(p.BuildWarnings),
+			"routingMode":  string(p.EffectiveRoutingMode()),
 		})
+		if entry, ok := standby[p.ID]; ok {
+			profilesData[len(profilesData)-1]["standby"] = entry.ToMap()
+		}
 	}
 	
 	return map[string]interface{}{
 		"success":       true,
 		"profiles":      profilesData,
 		"activeProfile": activeID,
+		"warmStandby":   a.getWarmStandbyStatus(standby),
 	}
 }
 
@@ -57,7 +64,7 @@ func (a *App) GetActiveProfile() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -70,7 +77,7 @@ func (a *App) GetActiveProfile() map[string]interface{} {
 	if profile == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Профиль не найден",
+			"error":   a.tr("profile_not_found"),
 		}
 	}
 	
@@ -90,12 +97,20 @@ func (a *App) GetActiveProfile() map[string]interface{} {
 			"isActive":     true,
 			"createdAt":    profile.CreatedAt.Format(time.RFC3339),
 			"proxyCount":   profile.ProxyCount,
+			"routingMode":  string(profile.EffectiveRoutingMode()),
 		},
 	}
 }
 
 // SetActiveProfile устанавливает активный профиль (API для фронтенда)
 func (a *App) SetActiveProfile(id int) map[string]interface{} {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+	return a.setActiveProfile(id)
+}
+
+// setActiveProfile activates a profile. Must be called with a.actionMu held.
+func (a *App) setActiveProfile(id int) map[string]interface{} {
 	a.waitForInit()
 	
 	// Check if VPN is running - don't allow profile change while connected
@@ -104,7 +119,7 @@ func (a *App) SetActiveProfile(id int) map[string]interface{} {
 		a.mu.Unlock()
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Отключите VPN перед сменой профиля",
+			"error":   a.tr("vpn_active_profile_switch"),
 		}
 	}
 	a.mu.Unlock()
@@ -112,7 +127,7 @@ func (a *App) SetActiveProfile(id int) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -124,6 +139,8 @@ func (a *App) SetActiveProfile(id int) map[string]interface{} {
 		}
 	}
 	
+	previousID := a.storage.GetActiveProfileID()
+	
 	// Set active profile in storage
 	if err := a.storage.SetActiveProfileID(id); err != nil {
 		return map[string]interface{}{
@@ -132,12 +149,59 @@ func (a *App) SetActiveProfile(id int) map[string]interface{} {
 		}
 	}
 	
+	// urltest history of another server set is harmful for auto-select
+	if previousID != id {
+		if err := a.storage.ClearURLTestCache(); err != nil {
+			a.writeLog(fmt.Sprintf("Warning: %v", err))
+		}
+	}
+	
 	a.writeLog(fmt.Sprintf("Переключён на профиль %d", id))
 	
-	return map[string]interface{}{
+	// Upgrade a config built by an older app version before it is used
+	a.migrateProfileConfig(id)
+	
+	result := map[string]interface{}{
 		"success": true,
-		"message": "Профиль активирован",
+		"message": a.tr("profile_activated"),
+	}
+	
+	if a.configBuilder != nil {
+		if warning := a.rebuildOnActivate(id, a.configBuilder.BuildConfigForProfile); warning != "" {
+			result["warning"] = warning
+		}
+	}
+	
+	a.afterProfileSwitch(id)
+	
+	return result
+}
+
+// rebuildOnActivate rebuilds the config of an activated profile if it was built
+// with another routing mode than the profile has now, or never built
+// (subscription added while another profile was active). A failed build keeps
+// the old config; the returned warning is shown to the user ("" if none).
+func (a *App) rebuildOnActivate(id int, build func(profileID int, subscriptionURL string, wireGuardConfigs []UserWireGuardConfig) error) string {
+	profile, err := a.storage.GetProfile(id)
+	if err != nil {
+		return ""
+	}
+	
+	switch {
+	case configRoutingModeStale(profile):
+		a.writeLog(fmt.Sprintf("Profile %d config was built with routing mode %s, rebuilding with %s",
+			id, profile.BuildInfo.RoutingMode, profile.EffectiveRoutingMode()))
+	case len(profile.SingboxConfig) == 0 && profile.SubscriptionURL != "":
+		a.writeLog(fmt.Sprintf("Profile %d has no config yet, building", id))
+	default:
+		return ""
+	}
+	
+	if err := build(id, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+		a.writeLog(fmt.Sprintf("Profile %d rebuild failed: %v", id, err))
+		return a.tr("profile_rebuild_failed", err)
 	}
+	return ""
 }
 
 // CreateProfile создает новый профиль (API для фронтенда)
@@ -147,7 +211,7 @@ func (a *App) CreateProfile(name string) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -180,7 +244,7 @@ func (a *App) UpdateProfile(id int, name string) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -193,7 +257,7 @@ func (a *App) UpdateProfile(id int, name string) map[string]interface{} {
 	
 	return map[string]interface{}{
 		"success": true,
-		"message": "Профиль обновлен",
+		"message": a.tr("profile_updated"),
 	}
 }
 
@@ -204,7 +268,7 @@ func (a *App) DeleteProfile(id int) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -217,6 +281,6 @@ func (a *App) DeleteProfile(id int) map[string]interface{} {
 	
 	return map[string]interface{}{
 		"success": true,
-		"message": "Профиль удален",
+		"message": a.tr("profile_deleted"),
 	}
 }
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+)
+
+// testActivationApp returns an app on a fresh storage in a temp folder and a new profile
+func testActivationApp(t *testing.T) (*App, *ProfileData) {
+	t.Helper()
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Work")
+	if err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	return &App{storage: storage, logStore: NewLogStore(), initialized: true}, profile
+}
+
+// activationBuild records builds and fails them with err
+type activationBuild struct {
+	calls []int
+	url   string
+	err   error
+}
+
+func (b *activationBuild) build(profileID int, subscriptionURL string, wireGuardConfigs []UserWireGuardConfig) error {
+	b.calls = append(b.calls, profileID)
+	b.url = subscriptionURL
+	return b.err
+}
+
+// storedOutboundTag returns the tag of the first outbound of the stored config
+func storedOutboundTag(t *testing.T, a *App, id int) string {
+	t.Helper()
+	profile, err := a.storage.GetProfile(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbounds, _ := profile.SingboxConfig["outbounds"].([]interface{})
+	if len(outbounds) == 0 {
+		return ""
+	}
+	tag, _ := outbounds[0].(map[string]interface{})["tag"].(string)
+	return tag
+}
+
+// otherRoutingMode returns a routing mode different from mode
+func otherRoutingMode(mode RoutingMode) RoutingMode {
+	if mode == RoutingModeAllTraffic {
+		return RoutingModeBlockedOnly
+	}
+	return RoutingModeAllTraffic
+}
+
+var testActivationConfig = map[string]interface{}{
+	"outbounds": []interface{}{map[string]interface{}{"type": "direct", "tag": "old"}},
+}
+
+func TestRebuildOnActivateStaleRoutingMode(t *testing.T) {
+	a, profile := testActivationApp(t)
+	if err := a.storage.UpdateProfileConfig(profile.ID, testActivationConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.storage.SetProfileRoutingMode(profile.ID, otherRoutingMode(profile.EffectiveRoutingMode())); err != nil {
+		t.Fatal(err)
+	}
+
+	var b activationBuild
+	if warning := a.rebuildOnActivate(profile.ID, b.build); warning != "" {
+		t.Errorf("warning = %q, want none", warning)
+	}
+	if len(b.calls) != 1 || b.calls[0] != profile.ID {
+		t.Errorf("builds = %v, want one of profile %d", b.calls, profile.ID)
+	}
+}
+
+func TestRebuildOnActivateMissingConfig(t *testing.T) {
+	a, profile := testActivationApp(t)
+	url := "https://sub.example.com/s/abc"
+	if err := a.storage.UpdateProfileSubscription(profile.ID, url, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var b activationBuild
+	a.rebuildOnActivate(profile.ID, b.build)
+	if len(b.calls) != 1 {
+		t.Fatalf("builds = %v, want one", b.calls)
+	}
+	if b.url != url {
+		t.Errorf("built with %q, want the profile subscription", b.url)
+	}
+}
+
+func TestRebuildOnActivateSkipsCurrentConfig(t *testing.T) {
+	a, profile := testActivationApp(t)
+	if err := a.storage.UpdateProfileConfig(profile.ID, testActivationConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	var b activationBuild
+	a.rebuildOnActivate(profile.ID, b.build)
+	if len(b.calls) != 0 {
+		t.Errorf("current config rebuilt: %v", b.calls)
+	}
+
+	// A profile without config and subscription has nothing to build from
+	empty, err := a.storage.CreateProfile("Empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.rebuildOnActivate(empty.ID, b.build)
+	if len(b.calls) != 0 {
+		t.Errorf("empty profile built: %v", b.calls)
+	}
+}
+
+func TestRebuildOnActivateFailureKeepsConfig(t *testing.T) {
+	a, profile := testActivationApp(t)
+	if err := a.storage.UpdateProfileConfig(profile.ID, testActivationConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.storage.SetProfileRoutingMode(profile.ID, otherRoutingMode(profile.EffectiveRoutingMode())); err != nil {
+		t.Fatal(err)
+	}
+
+	b := activationBuild{err: errors.New("subscription unreachable")}
+	warning := a.rebuildOnActivate(profile.ID, b.build)
+	if want := a.tr("profile_rebuild_failed", b.err); warning != want {
+		t.Errorf("warning = %q, want %q", warning, want)
+	}
+	if got := storedOutboundTag(t, a, profile.ID); got != "old" {
+		t.Errorf("stored config outbound = %q, want the old config kept", got)
+	}
+}
+
+func TestProfileRebuildFailedTranslated(t *testing.T) {
+	err := errors.New("boom")
+	ru := translate(LangRussian, "profile_rebuild_failed", err)
+	en := translate(LangEnglish, "profile_rebuild_failed", err)
+	if ru == en || ru == "profile_rebuild_failed" {
+		t.Errorf("ru = %q, en = %q; want two translations", ru, en)
+	}
+}
+
+// frontendJSON returns a result as the frontend receives it (marshalled by Wails)
+func frontendJSON(t *testing.T, result map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// jsonKeys returns the sorted keys of a JSON object
+func jsonKeys(object interface{}) []string {
+	m, _ := object.(map[string]interface{})
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// profileByID returns a profile of the GetProfiles list
+func profileByID(t *testing.T, result map[string]interface{}, id int) map[string]interface{} {
+	t.Helper()
+	profiles, _ := result["profiles"].([]interface{})
+	for _, p := range profiles {
+		profile, _ := p.(map[string]interface{})
+		if profile["id"] == float64(id) {
+			return profile
+		}
+	}
+	t.Fatalf("profile %d not in %v", id, result["profiles"])
+	return nil
+}
+
+func TestGetProfilesShape(t *testing.T) {
+	a, profile := testActivationApp(t)
+
+	result := frontendJSON(t, a.GetProfiles())
+	if result["success"] != true {
+		t.Fatalf("GetProfiles = %v", result)
+	}
+	if got, want := jsonKeys(result), []string{"activeProfile", "profiles", "success", "warmStandby"}; !equalStringSlices(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	if result["activeProfile"] != float64(DefaultProfileID) {
+		t.Errorf("activeProfile = %v, want %d", result["activeProfile"], DefaultProfileID)
+	}
+
+	work := profileByID(t, result, profile.ID)
+	wantKeys := []string{"createdAt", "id", "isActive", "name", "proxyCount", "routingMode", "subscription", "warningCount", "wireguardCount", "wireguards"}
+	if got := jsonKeys(work); !equalStringSlices(got, wantKeys) {
+		t.Errorf("profile keys = %v, want %v", got, wantKeys)
+	}
+	if work["name"] != "Work" || work["isActive"] != false || work["wireguardCount"] != float64(0) {
+		t.Errorf("profile = %v", work)
+	}
+	if profileByID(t, result, DefaultProfileID)["isActive"] != true {
+		t.Error("default profile is not marked active")
+	}
+
+	// isActive follows the active profile
+	if err := a.storage.SetActiveProfileID(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+	result = frontendJSON(t, a.GetProfiles())
+	if profileByID(t, result, profile.ID)["isActive"] != true || profileByID(t, result, DefaultProfileID)["isActive"] != false {
+		t.Errorf("isActive not moved to profile %d: %v", profile.ID, result["profiles"])
+	}
+}
+
+func TestCreateProfileShape(t *testing.T) {
+	a, profile := testActivationApp(t)
+
+	result := frontendJSON(t, a.CreateProfile("Home"))
+	if result["success"] != true {
+		t.Fatalf("CreateProfile = %v", result)
+	}
+	created, _ := result["profile"].(map[string]interface{})
+	wantKeys := []string{"createdAt", "id", "isActive", "name", "proxyCount", "subscription", "wireguards"}
+	if got := jsonKeys(created); !equalStringSlices(got, wantKeys) {
+		t.Errorf("profile keys = %v, want %v", got, wantKeys)
+	}
+	if created["id"] != float64(profile.ID+1) || created["name"] != "Home" || created["isActive"] != false {
+		t.Errorf("profile = %v", created)
+	}
+	// An empty list, not null: the frontend iterates it
+	if wireguards, ok := created["wireguards"].([]interface{}); !ok || len(wireguards) != 0 {
+		t.Errorf("wireguards = %#v, want []", created["wireguards"])
+	}
+	if got := mustStoredProfile(t, a.storage, profile.ID+1); got.Name != "Home" {
+		t.Errorf("stored name = %q", got.Name)
+	}
+
+	// Storage limit
+	for len(a.storage.GetAllProfiles()) < MaxProfiles {
+		if _, err := a.storage.CreateProfile("Filler"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result := frontendJSON(t, a.CreateProfile("Extra")); result["success"] != false || result["error"] == "" {
+		t.Errorf("CreateProfile over the limit = %v", result)
+	}
+}
+
+func TestUpdateProfileShape(t *testing.T) {
+	a, profile := testActivationApp(t)
+
+	tests := []struct {
+		name    string
+		id      int
+		success bool
+		keys    []string
+	}{
+		{"renamed", profile.ID, true, []string{"message", "success"}},
+		{"unknown profile", 9999, false, []string{"error", "success"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := frontendJSON(t, a.UpdateProfile(tt.id, "Renamed"))
+			if result["success"] != tt.success {
+				t.Fatalf("UpdateProfile = %v", result)
+			}
+			if got := jsonKeys(result); !equalStringSlices(got, tt.keys) {
+				t.Errorf("keys = %v, want %v", got, tt.keys)
+			}
+		})
+	}
+	if got := mustStoredProfile(t, a.storage, profile.ID); got.Name != "Renamed" {
+		t.Errorf("stored name = %q, want Renamed", got.Name)
+	}
+}
+
+func TestDeleteProfileShape(t *testing.T) {
+	a, profile := testActivationApp(t)
+	if err := a.storage.SetActiveProfileID(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		id      int
+		success bool
+		keys    []string
+	}{
+		{"default profile", DefaultProfileID, false, []string{"error", "success"}},
+		{"active profile", profile.ID, true, []string{"message", "success"}},
+		{"deleted twice", profile.ID, false, []string{"error", "success"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := frontendJSON(t, a.DeleteProfile(tt.id))
+			if result["success"] != tt.success {
+				t.Fatalf("DeleteProfile = %v", result)
+			}
+			if got := jsonKeys(result); !equalStringSlices(got, tt.keys) {
+				t.Errorf("keys = %v, want %v", got, tt.keys)
+			}
+		})
+	}
+	if _, err := a.storage.GetProfile(profile.ID); err == nil {
+		t.Error("profile still stored")
+	}
+	// Deleting the active profile activates the default one
+	if got := a.storage.GetActiveProfileID(); got != DefaultProfileID {
+		t.Errorf("active profile = %d, want %d", got, DefaultProfileID)
+	}
+}
+
+func TestSetActiveProfileShape(t *testing.T) {
+	a, profile := testActivationApp(t)
+
+	tests := []struct {
+		name     string
+		id       int
+		running  bool
+		success  bool
+		keys     []string
+		activeID int
+	}{
+		{"vpn running", profile.ID, true, false, []string{"error", "success"}, DefaultProfileID},
+		{"unknown profile", 9999, false, false, []string{"error", "success"}, DefaultProfileID},
+		{"activated", profile.ID, false, true, []string{"message", "success"}, profile.ID},
+		{"back to default", DefaultProfileID, false, true, []string{"message", "success"}, DefaultProfileID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.isRunning = tt.running
+			result := frontendJSON(t, a.SetActiveProfile(tt.id))
+			if result["success"] != tt.success {
+				t.Fatalf("SetActiveProfile = %v", result)
+			}
+			if got := jsonKeys(result); !equalStringSlices(got, tt.keys) {
+				t.Errorf("keys = %v, want %v", got, tt.keys)
+			}
+			if got := a.storage.GetActiveProfileID(); got != tt.activeID {
+				t.Errorf("active profile = %d, want %d", got, tt.activeID)
+			}
+			if want := a.tr("vpn_active_profile_switch"); tt.running && result["error"] != want {
+				t.Errorf("error = %v, want %q", result["error"], want)
+			}
+		})
+	}
+}
+
+func TestSetActiveProfileClearsURLTestCache(t *testing.T) {
+	a, profile := testActivationApp(t)
+	writeCache := func() {
+		t.Helper()
+		if err := os.WriteFile(a.storage.URLTestCachePath(), []byte("urltest history"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cacheExists := func() bool {
+		_, err := os.Stat(a.storage.URLTestCachePath())
+		return err == nil
+	}
+
+	// Re-activating the active profile keeps its history
+	writeCache()
+	if result := a.SetActiveProfile(DefaultProfileID); result["success"] != true {
+		t.Fatalf("SetActiveProfile = %v", result)
+	}
+	if !cacheExists() {
+		t.Error("cache deleted although the profile didn't change")
+	}
+
+	// History of another server set is dropped on switch
+	if result := a.SetActiveProfile(profile.ID); result["success"] != true {
+		t.Fatalf("SetActiveProfile = %v", result)
+	}
+	if cacheExists() {
+		t.Error("cache kept after a profile switch")
+	}
+
+	// A refused switch leaves it alone
+	writeCache()
+	a.isRunning = true
+	a.SetActiveProfile(DefaultProfileID)
+	if !cacheExists() {
+		t.Error("cache deleted by a refused switch")
+	}
+}
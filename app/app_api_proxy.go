@@ -8,26 +8,28 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"time"
 )
 
-// GetProxiesWithDelay returns list of proxies with delay (ping)
-func (a *App) GetProxiesWithDelay() map[string]interface{} {
+// GetProxiesWithDelay returns a page of proxies with delay (ping), sorted by name.
+// limit <= 0 uses DefaultProxyPageSize; "total" is the number of all proxies.
+func (a *App) GetProxiesWithDelay(offset, limit int) map[string]interface{} {
 	if !a.isRunning {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "VPN не запущен",
+			"error":   a.tr("vpn_not_running"),
 		}
 	}
 
 	client := &http.Client{Timeout: 5 * time.Second}
 
 	// Get list of proxies
-	resp, err := client.Get("http://127.0.0.1:9090/proxies")
+	resp, err := clashGet(client, "/proxies")
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Не удалось подключиться к API: " + err.Error(),
+			"error":   a.tr("clash_api_connect_failed", err),
 		}
 	}
 	defer resp.Body.Close()
@@ -36,51 +38,81 @@ func (a *App) GetProxiesWithDelay() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Ошибка чтения ответа",
+			"error":   a.tr("response_read_failed"),
 		}
 	}
 
 	var proxiesResp struct {
 		Proxies map[string]struct {
-			Name    string `json:"name"`
-			Type    string `json:"type"`
-			History []struct {
-				Delay int `json:"delay"`
-			} `json:"history"`
+			Name    string              `json:"name"`
+			Type    string              `json:"type"`
+			History []clashHistoryEntry `json:"history"`
 		} `json:"proxies"`
 	}
 
 	if err := json.Unmarshal(body, &proxiesResp); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Ошибка парсинга: " + err.Error(),
+			"error":   a.tr("parse_failed", err),
 		}
 	}
 
-	// Form list of proxies with delays
-	proxies := []map[string]interface{}{}
+	// Quality data from the prober (if running)
+	prober := a.getProber()
+	now := time.Now()
+	freshness := a.delayFreshness()
+	udpCaps := a.storage.GetActiveUDPCapabilities()
+
+	// Service proxies are skipped
+	names := []string{}
 	for name, proxy := range proxiesResp.Proxies {
-		// Skip service proxies
 		if name == "DIRECT" || name == "REJECT" || name == "GLOBAL" ||
 			proxy.Type == "Selector" || proxy.Type == "URLTest" || proxy.Type == "Fallback" {
 			continue
 		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	start, end := pageBounds(len(names), offset, limit)
 
-		delay := 0
-		if len(proxy.History) > 0 {
-			delay = proxy.History[len(proxy.History)-1].Delay
+	// Form list of proxies with delays
+	proxies := []map[string]interface{}{}
+	for _, name := range names[start:end] {
+		proxy := proxiesResp.Proxies[name]
+		measurement := measurementFromHistory(proxy.History)
+
+		entry := map[string]interface{}{
+			"name": name,
+			"type": proxy.Type,
+			"udp":  udpStatus(udpCaps, name),
 		}
-
-		proxies = append(proxies, map[string]interface{}{
-			"name":  name,
-			"type":  proxy.Type,
-			"delay": delay,
-		})
+		if prober != nil {
+			if q, ok := prober.GetProxyQuality(name); ok {
+				// The prober result is used when it is newer than the urltest history
+				if probed := q.Measurement(); probed.MeasuredAt.After(measurement.MeasuredAt) {
+					measurement = probed
+				}
+				entry["score"] = q.Score
+				entry["jitter"] = q.Jitter
+				entry["failureRate"] = q.FailureRate
+				entry["avoided"] = q.IsAvoided(now)
+				if q.IsAvoided(now) {
+					entry["avoidedUntil"] = q.AvoidedUntil.Format(time.RFC3339)
+				}
+			}
+		}
+		for key, value := range measurement.Fields(now, freshness) {
+			entry[key] = value
+		}
+		proxies = append(proxies, entry)
 	}
 
 	return map[string]interface{}{
-		"success": true,
-		"proxies": proxies,
+		"success":       true,
+		"proxies":       proxies,
+		"total":         len(names),
+		"offset":        start,
+		"freshness_sec": int(freshness.Seconds()),
 	}
 }
 
@@ -89,20 +121,22 @@ func (a *App) TestProxyDelay(proxyName string) map[string]interface{} {
 	if !a.isRunning {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "VPN не запущен",
+			"error":   a.tr("vpn_not_running"),
 		}
 	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 
 	// Test proxy delay
-	url := fmt.Sprintf("http://127.0.0.1:9090/proxies/%s/delay?timeout=5000&url=http://www.gstatic.com/generate_204", proxyName)
-	resp, err := client.Get(url)
+	path := fmt.Sprintf("/proxies/%s/delay?timeout=5000&url=http://www.gstatic.com/generate_204", proxyName)
+	resp, err := clashGet(client, path)
 	if err != nil {
 		return map[string]interface{}{
-			"success": false,
-			"delay":   0,
-			"error":   err.Error(),
+			"success":     false,
+			"delay":       0,
+			"status":      classifyDelayError(err),
+			"measured_at": time.Now().Format(time.RFC3339),
+			"error":       err.Error(),
 		}
 	}
 	defer resp.Body.Close()
@@ -129,32 +163,37 @@ func (a *App) TestProxyDelay(proxyName string) map[string]interface{} {
 
 	if delayResp.Delay == 0 && delayResp.Message != "" {
 		return map[string]interface{}{
-			"success": false,
-			"delay":   0,
-			"error":   delayResp.Message,
+			"success":     false,
+			"delay":       0,
+			"status":      classifyDelayError(fmt.Errorf("%s", delayResp.Message)),
+			"measured_at": time.Now().Format(time.RFC3339),
+			"error":       delayResp.Message,
 		}
 	}
 
 	return map[string]interface{}{
-		"success": true,
-		"delay":   delayResp.Delay,
-		"name":    proxyName,
+		"success":     true,
+		"delay":       delayResp.Delay,
+		"status":      DelayStatusOK,
+		"method":      DelayMethodHTTP,
+		"measured_at": time.Now().Format(time.RFC3339),
+		"name":        proxyName,
 	}
 }
 
-// TestAllProxiesDelay tests delay of all proxies in parallel
-func (a *App) TestAllProxiesDelay() map[string]interface{} {
+// TestAllProxiesDelay tests delay of a page of proxies in parallel (limit <= 0 uses DefaultProxyPageSize)
+func (a *App) TestAllProxiesDelay(offset, limit int) map[string]interface{} {
 	if !a.isRunning {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "VPN не запущен",
+			"error":   a.tr("vpn_not_running"),
 		}
 	}
 
 	client := &http.Client{Timeout: 5 * time.Second}
 
 	// Get list of proxies from selector proxy
-	resp, err := client.Get("http://127.0.0.1:9090/proxies/proxy")
+	resp, err := clashGet(client, "/proxies/proxy")
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
@@ -167,7 +206,7 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Ошибка чтения",
+			"error":   a.tr("read_failed"),
 		}
 	}
 
@@ -187,7 +226,7 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 	filteredProxies := []string{}
 	for _, name := range selectorInfo.All {
 		// Skip service elements
-		if name == "direct" || name == "block" || name == "dns-out" || name == "auto-select" {
+		if name == "direct" || name == "block" || name == "dns-out" || name == "auto-select" || isRegionGroupTag(name) {
 			continue
 		}
 		filteredProxies = append(filteredProxies, name)
@@ -204,6 +243,13 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 		}
 	}
 
+	// Only the requested page is tested: proxies in selector order, then WireGuard
+	total := len(filteredProxies) + len(wireGuardTags)
+	start, end := pageBounds(total, offset, limit)
+	proxyCount := len(filteredProxies)
+	filteredProxies = filteredProxies[min(start, proxyCount):min(end, proxyCount)]
+	wireGuardTags = wireGuardTags[max(start-proxyCount, 0):max(end-proxyCount, 0)]
+
 	totalCount := len(filteredProxies) + len(wireGuardTags)
 	if totalCount == 0 {
 		return map[string]interface{}{
@@ -211,60 +257,52 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 			"proxies":      []map[string]interface{}{},
 			"currentProxy": selectorInfo.Now,
 			"count":        0,
+			"total":        total,
+			"offset":       start,
 		}
 	}
 
 	// Test delay for each proxy in parallel
 	type proxyResult struct {
-		Name       string
-		Delay      int
-		Type       string
-		IsInternal bool
+		Name        string
+		Measurement DelayMeasurement
+		Type        string
+		IsInternal  bool
 	}
 
+	freshness := a.delayFreshness()
+	udpCaps := a.storage.GetActiveUDPCapabilities()
+
 	results := make(chan proxyResult, totalCount)
 
 	// Test external proxies
 	for _, proxyName := range filteredProxies {
 		go func(name string) {
-			delay := 0
+			measurement := DelayMeasurement{Status: DelayStatusNotTested}
 			proxyType := ""
 
 			// Get proxy info
-			infoResp, err := client.Get(fmt.Sprintf("http://127.0.0.1:9090/proxies/%s", name))
+			infoResp, err := clashGet(client, "/proxies/"+name)
 			if err == nil {
 				defer infoResp.Body.Close()
 				infoBody, _ := io.ReadAll(infoResp.Body)
 				var info struct {
-					Type    string `json:"type"`
-					History []struct {
-						Delay int `json:"delay"`
-					} `json:"history"`
+					Type    string              `json:"type"`
+					History []clashHistoryEntry `json:"history"`
 				}
 				if json.Unmarshal(infoBody, &info) == nil {
 					proxyType = info.Type
-					if len(info.History) > 0 {
-						delay = info.History[len(info.History)-1].Delay
-					}
+					measurement = measurementFromHistory(info.History)
 				}
 			}
 
-			// If no history, test delay
-			if delay == 0 {
-				delayResp, err := client.Get(fmt.Sprintf("http://127.0.0.1:9090/proxies/%s/delay?timeout=3000&url=http://www.gstatic.com/generate_204", name))
-				if err == nil {
-					defer delayResp.Body.Close()
-					delayBody, _ := io.ReadAll(delayResp.Body)
-					var d struct {
-						Delay int `json:"delay"`
-					}
-					if json.Unmarshal(delayBody, &d) == nil {
-						delay = d.Delay
-					}
-				}
+			// If no fresh successful result, test delay
+			if measurement.Status != DelayStatusOK || measurement.IsStale(time.Now(), freshness) {
+				delay, err := clashProxyDelay(client, name, 3*time.Second)
+				measurement = NewDelayMeasurement(delay, err, time.Now())
 			}
 
-			results <- proxyResult{Name: name, Delay: delay, Type: proxyType, IsInternal: false}
+			results <- proxyResult{Name: name, Measurement: measurement, Type: proxyType, IsInternal: false}
 		}(proxyName)
 	}
 
@@ -278,7 +316,7 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 			}
 
 			// Check that WireGuard endpoint is accessible in Clash API
-			infoResp, err := client.Get(fmt.Sprintf("http://127.0.0.1:9090/proxies/%s", tag))
+			infoResp, err := clashGet(client, "/proxies/"+tag)
 			if err == nil {
 				defer infoResp.Body.Close()
 				infoBody, _ := io.ReadAll(infoResp.Body)
@@ -290,7 +328,8 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 				}
 			}
 
-			results <- proxyResult{Name: displayName + " (внутр.)", Delay: delay, Type: "WireGuard", IsInternal: true}
+			measurement := DelayMeasurement{Delay: delay, Status: DelayStatusNotTested}
+			results <- proxyResult{Name: displayName + " (внутр.)", Measurement: measurement, Type: "WireGuard", IsInternal: true}
 		}(wgTag)
 	}
 
@@ -301,12 +340,14 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 	for i := 0; i < totalCount; i++ {
 		select {
 		case result := <-results:
-			proxies = append(proxies, map[string]interface{}{
-				"name":       result.Name,
-				"delay":      result.Delay,
-				"type":       result.Type,
-				"isInternal": result.IsInternal,
-			})
+			entry := result.Measurement.Fields(time.Now(), freshness)
+			entry["name"] = result.Name
+			entry["type"] = result.Type
+			entry["isInternal"] = result.IsInternal
+			if !result.IsInternal {
+				entry["udp"] = udpStatus(udpCaps, result.Name)
+			}
+			proxies = append(proxies, entry)
 		case <-timeout:
 			break
 		}
@@ -317,6 +358,69 @@ func (a *App) TestAllProxiesDelay() map[string]interface{} {
 		"proxies":      proxies,
 		"currentProxy": selectorInfo.Now,
 		"count":        len(proxies),
+		"total":        total,
+		"offset":       start,
+	}
+}
+
+// SelectProxy switches the "proxy" selector to the given proxy and remembers it
+// for the active profile; "auto-select" returns to automatic selection
+func (a *App) SelectProxy(name string) map[string]interface{} {
+	if !a.isRunning {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if err := clashSelectProxy(client, ConnectMeasureSelector, name); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("server_select_failed", err),
+		}
+	}
+
+	// sing-box answers 204 even if it ignored the change, so check "now"
+	_, now, err := clashGroupMembers(client, ConnectMeasureSelector)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("server_select_check_failed", err),
+		}
+	}
+	if now != name {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("server_not_selected", now),
+			"current": now,
+		}
+	}
+
+	// Choosing a server ends a pause
+	if a.endPause("server selected") {
+		UpdateTrayIcon("connected")
+	}
+
+	// The user's choice replaces the server pinned by the measurement on connect
+	a.mu.Lock()
+	a.measurePinned = false
+	a.mu.Unlock()
+
+	remembered := name
+	if name == ConnectMeasureGroup {
+		remembered = ""
+	}
+	if a.storage != nil {
+		if err := a.storage.SetProfileSelectedProxy(a.storage.GetActiveProfileID(), remembered); err != nil {
+			a.writeLog(fmt.Sprintf("Failed to remember selected proxy: %v", err))
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Proxy selected: %s", name))
+	return map[string]interface{}{
+		"success": true,
+		"current": now,
 	}
 }
 
@@ -331,7 +435,7 @@ func (a *App) GetCurrentProxy() map[string]interface{} {
 	client := &http.Client{Timeout: 5 * time.Second}
 
 	// Get info about proxy selector
-	resp, err := client.Get("http://127.0.0.1:9090/proxies/proxy")
+	resp, err := clashGet(client, "/proxies/proxy")
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
@@ -364,25 +468,50 @@ func (a *App) GetCurrentProxy() map[string]interface{} {
 	}
 
 	// Get delay for current proxy
-	delay := 0
+	measurement := DelayMeasurement{Status: DelayStatusNotTested}
 	if currentProxy != "" {
-		delayResp, err := client.Get(fmt.Sprintf("http://127.0.0.1:9090/proxies/%s/delay?timeout=3000&url=http://www.gstatic.com/generate_204", currentProxy))
-		if err == nil {
-			defer delayResp.Body.Close()
-			delayBody, _ := io.ReadAll(delayResp.Body)
-			var delayInfo struct {
-				Delay int `json:"delay"`
-			}
-			if json.Unmarshal(delayBody, &delayInfo) == nil {
-				delay = delayInfo.Delay
-			}
+		delay, err := clashProxyDelay(client, currentProxy, 3*time.Second)
+		measurement = NewDelayMeasurement(delay, err, time.Now())
+	}
+
+	result := measurement.Fields(time.Now(), a.delayFreshness())
+	result["success"] = true
+	result["name"] = currentProxy
+	result["type"] = proxyInfo.Type
+	return result
+}
+
+// ClearURLTestCache deletes persisted urltest results (API для фронтенда)
+func (a *App) ClearURLTestCache() map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_cache"),
+		}
+	}
+	a.mu.Unlock()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.ClearURLTestCache(); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
 		}
 	}
 
+	a.writeLog("URLTest cache cleared")
 	return map[string]interface{}{
 		"success": true,
-		"name":    currentProxy,
-		"type":    proxyInfo.Type,
-		"delay":   delay,
+		"message": a.tr("test_cache_cleared"),
 	}
 }
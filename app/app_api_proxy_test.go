@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestClearURLTestCache(t *testing.T) {
+	a, _ := testActivationApp(t)
+	path := a.storage.URLTestCachePath()
+	if err := os.WriteFile(path, []byte("urltest history"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a.isRunning = true
+	if result := a.ClearURLTestCache(); result["success"] != false || result["error"] != a.tr("vpn_active_cache") {
+		t.Errorf("while running: %v", result)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("cache deleted while running: %v", err)
+	}
+
+	a.isRunning = false
+	for i := 0; i < 2; i++ {
+		// The second call finds no file, which isn't an error
+		if result := a.ClearURLTestCache(); result["success"] != true {
+			t.Fatalf("call %d: %v", i+1, result)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("call %d: cache file still there: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+// Connection quality methods for Kampus VPN
+// This file contains the proxy prober lifecycle and avoidance list API
+
+import (
+	"fmt"
+	"time"
+)
+
+// startProber starts the connection quality prober if enabled in settings.
+// Must be called with a.mu held.
+func (a *App) startProber() {
+	if a.storage == nil {
+		return
+	}
+
+	settings := a.storage.GetAppSettings()
+	if !settings.AdvancedProbing.Enabled {
+		return
+	}
+
+	profileID := a.storage.GetActiveProfileID()
+	var avoided map[string]time.Time
+	if profile, err := a.storage.GetProfile(profileID); err == nil {
+		avoided = profile.AvoidedProxies
+	}
+
+	prober := NewProxyProber(settings.AdvancedProbing, avoided, a.writeLog)
+	prober.SetAvoidChangeCallback(func(avoided map[string]time.Time) {
+		if err := a.storage.SetProfileAvoidedProxies(profileID, avoided); err != nil {
+			a.writeLog(fmt.Sprintf("[Prober] Failed to save avoidance list: %v", err))
+			return
+		}
+		// The runtime config is written from the stored list on the next connect;
+		// reconnecting here would drop every open connection on each change
+		a.writeLog(fmt.Sprintf("[Prober] Avoidance list updated (%d), applies on next connect", len(avoided)))
+	})
+	prober.Start()
+	a.prober = prober
+}
+
+// stopProber stops the connection quality prober if it is running.
+func (a *App) stopProber() {
+	a.mu.Lock()
+	prober := a.prober
+	a.prober = nil
+	a.mu.Unlock()
+
+	if prober != nil {
+		prober.Stop()
+	}
+}
+
+// getProber returns the running prober or nil.
+func (a *App) getProber() *ProxyProber {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.prober
+}
+
+// delayFreshness returns the window after which delay results are marked stale
+func (a *App) delayFreshness() time.Duration {
+	sec := DefaultDelayFreshnessSec
+	if a.storage != nil {
+		sec = a.storage.GetAppSettings().AdvancedProbing.Normalized().FreshnessSec
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// GetProxyQuality returns quality scores and the avoidance list (API для фронтенда)
+func (a *App) GetProxyQuality() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	now := time.Now()
+	freshness := a.delayFreshness()
+
+	proxies := []map[string]interface{}{}
+	avoidedList := []map[string]interface{}{}
+
+	if prober := a.getProber(); prober != nil {
+		for _, q := range prober.GetQuality() {
+			entry := map[string]interface{}{
+				"name":        q.Name,
+				"score":       q.Score,
+				"delay":       q.AvgDelay,
+				"jitter":      q.Jitter,
+				"failureRate": q.FailureRate,
+				"avoided":     q.IsAvoided(now),
+			}
+			if !q.LastProbed.IsZero() {
+				entry["lastProbed"] = q.LastProbed.Format(time.RFC3339)
+			}
+			measurement := q.Measurement()
+			entry["status"] = measurement.Status
+			entry["is_stale"] = measurement.IsStale(now, freshness)
+			if !measurement.MeasuredAt.IsZero() {
+				entry["measured_at"] = measurement.MeasuredAt.Format(time.RFC3339)
+			}
+			proxies = append(proxies, entry)
+		}
+		for name, until := range prober.AvoidedProxies() {
+			avoidedList = append(avoidedList, map[string]interface{}{
+				"name":  name,
+				"until": until.Format(time.RFC3339),
+			})
+		}
+	} else if profile, err := a.storage.GetActiveProfile(); err == nil {
+		for name, until := range profile.AvoidedProxies {
+			if now.Before(until) {
+				avoidedList = append(avoidedList, map[string]interface{}{
+					"name":  name,
+					"until": until.Format(time.RFC3339),
+				})
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"enabled": settings.AdvancedProbing.Enabled,
+		"running": a.getProber() != nil,
+		"proxies": proxies,
+		"avoided": avoidedList,
+	}
+}
+
+// ClearProxyAvoidance returns a proxy to auto-select manually (API для фронтенда)
+func (a *App) ClearProxyAvoidance(name string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if prober := a.getProber(); prober != nil {
+		// Callback persists the updated list
+		prober.ClearAvoidance(name)
+	} else {
+		profile, err := a.storage.GetActiveProfile()
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+		avoided := map[string]time.Time{}
+		for tag, until := range profile.AvoidedProxies {
+			if tag != name {
+				avoided[tag] = until
+			}
+		}
+		if err := a.storage.SetProfileAvoidedProxies(profile.ID, avoided); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Proxy %s removed from avoidance list", name))
+
+	return map[string]interface{}{
+		"success": true,
+		"message": a.tr("server_auto_after_reconnect"),
+	}
+}
+
+// GetAdvancedProbingSettings returns prober thresholds (API для фронтенда)
+func (a *App) GetAdvancedProbingSettings() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	s := a.storage.GetAppSettings().AdvancedProbing
+	n := s.Normalized()
+
+	return map[string]interface{}{
+		"success":          true,
+		"enabled":          s.Enabled,
+		"probesPerCycle":   n.ProbesPerCycle,
+		"cycleIntervalSec": n.CycleIntervalSec,
+		"probeTimeoutMs":   n.ProbeTimeoutMs,
+		"maxFailureRate":   n.MaxFailureRate,
+		"failedCycles":     n.FailedCycles,
+		"cooldownMinutes":  n.CooldownMinutes,
+	}
+}
+
+// SaveAdvancedProbingSettings saves prober thresholds (API для фронтенда)
+// Changes take effect on the next VPN start.
+func (a *App) SaveAdvancedProbingSettings(enabled bool, probesPerCycle, cycleIntervalSec, probeTimeoutMs int, maxFailureRate float64, failedCycles, cooldownMinutes int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if probesPerCycle > 20 || cycleIntervalSec < 0 || (cycleIntervalSec > 0 && cycleIntervalSec < 30) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("probe_params_invalid"),
+		}
+	}
+	if maxFailureRate < 0 || maxFailureRate > 1 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("failure_rate_invalid"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.AdvancedProbing = AdvancedProbingSettings{
+		Enabled:          enabled,
+		ProbesPerCycle:   probesPerCycle,
+		CycleIntervalSec: cycleIntervalSec,
+		ProbeTimeoutMs:   probeTimeoutMs,
+		MaxFailureRate:   maxFailureRate,
+		FailedCycles:     failedCycles,
+		CooldownMinutes:  cooldownMinutes,
+	}.Normalized()
+
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	// Disabling takes effect immediately
+	if !enabled {
+		a.stopProber()
+	}
+
+	return map[string]interface{}{
+		"success": true,
+	}
+}
@@ -4,8 +4,11 @@ package main
 // This file contains app configuration API methods
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 	
 	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
@@ -18,13 +21,13 @@ func (a *App) GetAppConfig() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
 	settings := a.storage.GetAppSettings()
 	
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"success":           true,
 		"autoStart":         settings.AutoStart,
 		"enableLogging":     settings.EnableLogging,
@@ -37,12 +40,104 @@ func (a *App) GetAppConfig() map[string]interface{} {
 		"subUpdateInterval": settings.SubUpdateInterval,
 		"lastSubUpdate":     settings.LastSubUpdate.Format(time.RFC3339),
 		"wireGuardVersion":  settings.WireGuardVersion,
+		"maxSingboxMemoryMB": settings.MaxSingboxMemoryMB,
+		"softSingboxMemoryMB": settings.SoftSingboxMemoryMB,
+		"logMaxSizeMB":      a.logMaxSize() / (1024 * 1024),
+		"multiplex":         settings.Multiplex,
+		"startMinimized":    settings.StartMinimized,
+		"connectOnLaunch":   settings.ConnectOnLaunch,
 		"appVersion":        Version,
 		"appName":           AppName,
 		"singboxVersion":    SingBoxVersion,
 		"buildHash":         BuildHash,
 		"buildTime":         BuildTime,
 	}
+	
+	// The running sing-box may still use another level until reconnect
+	a.mu.Lock()
+	if a.isRunning && a.effectiveLogLevel != "" && a.effectiveLogLevel != settings.LogLevel {
+		result["effectiveLogLevel"] = a.effectiveLogLevel
+	}
+	a.mu.Unlock()
+	
+	return result
+}
+
+// SetLogLevelLive сохраняет уровень логирования и применяет его к запущенному
+// sing-box через Clash API без переподключения (API для фронтенда)
+func (a *App) SetLogLevelLive(level string) map[string]interface{} {
+	a.waitForInit()
+	
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	logLevel := LogLevel(strings.ToLower(strings.TrimSpace(level)))
+	if !IsValidSingboxLogLevel(logLevel) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("log_level_invalid", level),
+		}
+	}
+	
+	settings := a.storage.GetAppSettings()
+	settings.LogLevel = logLevel
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if !running {
+		return map[string]interface{}{
+			"success":  true,
+			"logLevel": logLevel,
+			"applied":  false,
+		}
+	}
+	
+	// sing-box may accept the PATCH without applying the level, so it is read back
+	client := &http.Client{Timeout: 3 * time.Second}
+	err := clashPatchConfigs(client, map[string]interface{}{"log-level": string(logLevel)})
+	if err == nil {
+		var current string
+		if current, err = clashLogLevel(client); err == nil && LogLevel(current) != logLevel {
+			err = fmt.Errorf("running instance reports %q", current)
+		}
+	}
+	
+	a.mu.Lock()
+	if err == nil {
+		a.effectiveLogLevel = logLevel
+	}
+	effective := a.effectiveLogLevel
+	a.mu.Unlock()
+	
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Log level %s saved, live change failed (%v), applies on reconnect", logLevel, err))
+		return map[string]interface{}{
+			"success":           true,
+			"logLevel":          logLevel,
+			"effectiveLogLevel": effective,
+			"applied":           false,
+			"message":           a.tr("log_level_on_reconnect"),
+		}
+	}
+	
+	a.writeLog(fmt.Sprintf("Log level changed to %s without restart", logLevel))
+	return map[string]interface{}{
+		"success":           true,
+		"logLevel":          logLevel,
+		"effectiveLogLevel": effective,
+		"applied":           true,
+	}
 }
 
 // SaveAppConfig сохраняет настройки приложения (API для фронтенда)
@@ -52,7 +147,7 @@ func (a *App) SaveAppConfig(autoStart, enableLogging, checkUpdates, notification
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -77,21 +172,50 @@ func (a *App) SaveAppConfig(autoStart, enableLogging, checkUpdates, notification
 	if err := a.storage.UpdateAppSettings(settings); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка сохранения настроек: %v", err),
+			"error":   a.tr("settings_save_failed", err),
 		}
 	}
 	
 	// Применяем автозапуск
-	if err := SetAutoStart(autoStart); err != nil {
+	if err := SetAutoStart(autoStart, settings.StartMinimized); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка настройки автозапуска: %v", err),
+			"error":   a.tr("autostart_failed", err),
 		}
 	}
 	
 	return map[string]interface{}{
 		"success": true,
-		"message": "Настройки сохранены",
+		"message": a.tr("settings_saved"),
+	}
+}
+
+// GetAvailableLanguages возвращает языки каталога сообщений бэкенда (API для фронтенда)
+func (a *App) GetAvailableLanguages() map[string]interface{} {
+	return map[string]interface{}{
+		"success":   true,
+		"languages": availableLanguages,
+		"current":   a.uiLanguage(),
+	}
+}
+
+// GetSettingsRecovery сообщает, были ли настройки восстановлены при запуске
+// из резервной копии или сброшены (API для фронтенда)
+func (a *App) GetSettingsRecovery() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	recovery := a.storage.Recovery()
+	return map[string]interface{}{
+		"success":   true,
+		"recovered": recovery != nil,
+		"recovery":  recovery,
 	}
 }
 
@@ -114,12 +238,24 @@ func (a *App) GetWireGuardVersion() map[string]interface{} {
 	}
 }
 
-// GetAutoStartStatus проверяет статус автозапуска
+// GetAutoStartStatus проверяет статус автозапуска: флаги берутся из
+// зарегистрированной записи, а не из настроек
 func (a *App) GetAutoStartStatus() map[string]interface{} {
-	return map[string]interface{}{
+	entry := ReadAutoStartEntry()
+	result := map[string]interface{}{
 		"success":   true,
-		"autoStart": IsAutoStartEnabled(),
-	}
+		"autoStart": entry.Enabled,
+		"minimized": entry.Minimized,
+		"entry":     entry,
+	}
+	if a.storage != nil {
+		settings := a.storage.GetAppSettings()
+		result["startMinimized"] = settings.StartMinimized
+		result["connectOnLaunch"] = settings.ConnectOnLaunch
+		// The entry differs from the settings (edited outside the app or written by an older version)
+		result["inSync"] = entry.Enabled == settings.AutoStart && (!entry.Enabled || entry.Minimized == settings.StartMinimized)
+	}
+	return result
 }
 
 // ============================================================================
@@ -127,11 +263,12 @@ func (a *App) GetAutoStartStatus() map[string]interface{} {
 // ============================================================================
 
 // ExportProfilesToFile opens save dialog and exports all profiles to JSON file.
-func (a *App) ExportProfilesToFile() map[string]interface{} {
+// A non-empty passphrase encrypts the file.
+func (a *App) ExportProfilesToFile(passphrase string) map[string]interface{} {
 	a.waitForInit()
 	
 	// Get export data first
-	exportResult := a.ExportAllProfiles()
+	exportResult := a.ExportAllProfiles(passphrase)
 	if !exportResult["success"].(bool) {
 		return exportResult
 	}
@@ -153,7 +290,7 @@ func (a *App) ExportProfilesToFile() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка диалога сохранения: %v", err),
+			"error":   a.tr("save_dialog_failed", err),
 		}
 	}
 	
@@ -161,7 +298,7 @@ func (a *App) ExportProfilesToFile() map[string]interface{} {
 		// User cancelled
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Отменено пользователем",
+			"error":   a.tr("cancelled"),
 		}
 	}
 	
@@ -169,7 +306,7 @@ func (a *App) ExportProfilesToFile() map[string]interface{} {
 	if err := os.WriteFile(filename, []byte(jsonData), 0644); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка записи файла: %v", err),
+			"error":   a.tr("file_write_failed", err),
 		}
 	}
 	
@@ -180,7 +317,7 @@ func (a *App) ExportProfilesToFile() map[string]interface{} {
 	
 	return map[string]interface{}{
 		"success":        true,
-		"message":        fmt.Sprintf("Экспортировано %d профилей", profilesCount),
+		"message":        a.tr("profiles_exported", profilesCount),
 		"filename":       filename,
 		"profiles_count": profilesCount,
 	}
@@ -196,7 +333,7 @@ func (a *App) ImportProfilesFromFile() map[string]interface{} {
 		a.mu.Unlock()
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нельзя импортировать пока VPN активен. Сначала отключите VPN.",
+			"error":   a.tr("vpn_active_import"),
 		}
 	}
 	a.mu.Unlock()
@@ -215,7 +352,7 @@ func (a *App) ImportProfilesFromFile() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка диалога открытия: %v", err),
+			"error":   a.tr("open_dialog_failed", err),
 		}
 	}
 	
@@ -223,7 +360,7 @@ func (a *App) ImportProfilesFromFile() map[string]interface{} {
 		// User cancelled
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Отменено пользователем",
+			"error":   a.tr("cancelled"),
 		}
 	}
 	
@@ -232,12 +369,19 @@ func (a *App) ImportProfilesFromFile() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка чтения файла: %v", err),
+			"error":   a.tr("file_read_failed", err),
 		}
 	}
 	
 	// Validate first
 	validationResult := a.ValidateImportData(string(data))
+	if needsPassword, _ := validationResult["needs_password"].(bool); needsPassword {
+		// Encrypted: the frontend asks for the passphrase and calls ConfirmImportProfiles
+		validationResult["success"] = true
+		validationResult["filename"] = filename
+		validationResult["file_data"] = string(data)
+		return validationResult
+	}
 	if !validationResult["success"].(bool) {
 		return validationResult
 	}
@@ -251,7 +395,20 @@ func (a *App) ImportProfilesFromFile() map[string]interface{} {
 }
 
 // ConfirmImportProfiles confirms and executes import after user approval.
-func (a *App) ConfirmImportProfiles(jsonData string) map[string]interface{} {
+// passphrase decrypts an encrypted export and is ignored for plain JSON.
+func (a *App) ConfirmImportProfiles(jsonData string, passphrase string) map[string]interface{} {
+	if IsEncryptedExport([]byte(jsonData)) {
+		plaintext, err := DecryptExport([]byte(jsonData), passphrase)
+		if err != nil {
+			return map[string]interface{}{
+				"success":        false,
+				"error":          a.tr("decrypt_failed", err),
+				"needs_password": true,
+				"wrong_password": errors.Is(err, ErrWrongPassphrase),
+			}
+		}
+		jsonData = string(plaintext)
+	}
 	return a.ImportAllProfiles(jsonData)
 }
 
@@ -259,64 +416,76 @@ func (a *App) ConfirmImportProfiles(jsonData string) map[string]interface{} {
 // Routing Mode API methods
 // ============================================================================
 
-// GetRoutingMode returns current routing mode
+// GetRoutingMode returns the routing mode of the active profile
 func (a *App) GetRoutingMode() map[string]interface{} {
 	a.waitForInit()
 	
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
-	settings := a.storage.GetAppSettings()
-	mode := settings.RoutingMode
-	
-	// Default to blocked_only if empty
-	if mode == "" {
-		mode = DefaultRoutingMode
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
 	}
+	mode := profile.EffectiveRoutingMode()
 	
 	// Get mode descriptions for UI
 	modeDescriptions := map[string]string{
 		string(RoutingModeBlockedOnly):   "Только заблокированные",
 		string(RoutingModeExceptRussia):  "Всё кроме России",
 		string(RoutingModeAllTraffic):    "Весь трафик",
+		string(RoutingModeCustom):        "Свои правила",
 	}
 	
 	return map[string]interface{}{
 		"success":     true,
 		"mode":        string(mode),
+		"profile_id":  profile.ID,
 		"description": modeDescriptions[string(mode)],
 		"modes": []map[string]string{
 			{"value": string(RoutingModeBlockedOnly), "label": "Только заблокированные", "description": "Через VPN идут только заблокированные сайты (РКН + сервисы, блокирующие РФ). Минимальная нагрузка на VPN."},
 			{"value": string(RoutingModeExceptRussia), "label": "Всё кроме России", "description": "Весь зарубежный трафик через VPN, российские сайты напрямую."},
 			{"value": string(RoutingModeAllTraffic), "label": "Весь трафик", "description": "Весь трафик через VPN. Максимальная приватность, высокая нагрузка."},
+			{"value": string(RoutingModeCustom), "label": "Свои правила", "description": "Маршрутизация по собственным правилам sing-box профиля."},
 		},
+		"custom_configured": profile.CustomRouting != nil,
 	}
 }
 
-// SetRoutingMode sets routing mode and rebuilds config
+// SetRoutingMode sets the routing mode of the active profile and rebuilds its config
 func (a *App) SetRoutingMode(mode string) map[string]interface{} {
 	a.waitForInit()
 	
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Хранилище не инициализировано",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
 	// Validate mode
 	routingMode := RoutingMode(mode)
-	switch routingMode {
-	case RoutingModeBlockedOnly, RoutingModeExceptRussia, RoutingModeAllTraffic:
-		// Valid mode
-	default:
+	if ValidateRoutingMode(routingMode) != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Неизвестный режим маршрутизации: %s", mode),
+			"error":   a.tr("routing_mode_unknown", mode),
+		}
+	}
+	
+	// The custom mode needs the user's rules first
+	if routingMode == RoutingModeCustom {
+		if profile, err := a.storage.GetActiveProfile(); err == nil && profile.CustomRouting == nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("routing_custom_missing"),
+			}
 		}
 	}
 	
@@ -328,39 +497,30 @@ func (a *App) SetRoutingMode(mode string) map[string]interface{} {
 	if isRunning {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нельзя изменить режим пока VPN активен. Сначала отключите VPN.",
+			"error":   a.tr("vpn_active_mode"),
 		}
 	}
 	
-	// Update settings
-	settings := a.storage.GetAppSettings()
-	settings.RoutingMode = routingMode
-	
-	if err := a.storage.UpdateAppSettings(settings); err != nil {
+	// Update the active profile
+	if err := a.storage.SetProfileRoutingMode(a.storage.GetActiveProfileID(), routingMode); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка сохранения настроек: %v", err),
+			"error":   a.tr("settings_save_failed", err),
 		}
 	}
 	
-	// Update config builder
-	if a.configBuilder != nil {
-		a.configBuilder.SetRoutingMode(routingMode)
-	}
-	
 	// Rebuild config for active profile
 	if err := a.RebuildActiveProfileConfig(); err != nil {
-		return map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Ошибка перестройки конфига: %v", err),
-		}
+		result := a.rebuildErrorResult(err)
+		result["error"] = a.tr("config_rebuild_failed", err)
+		return result
 	}
 	
 	a.writeLog(fmt.Sprintf("Routing mode changed to: %s", mode))
 	
 	return map[string]interface{}{
 		"success": true,
-		"message": "Режим маршрутизации изменён",
+		"message": a.tr("routing_mode_changed"),
 		"mode":    mode,
 	}
 }
@@ -375,12 +535,15 @@ func (a *App) GetFiltersInfo() map[string]interface{} {
 	
 	// Create filter manager pointing to bin/filters
 	filterManager := NewFilterManager(a.basePath)
+	if a.storage != nil {
+		filterManager.SetSourceURLs(a.storage.GetAppSettings().FilterSources)
+	}
 	
 	info, err := filterManager.GetInfo()
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка получения информации о фильтрах: %v", err),
+			"error":   a.tr("filters_info_failed", err),
 		}
 	}
 	
@@ -401,47 +564,51 @@ func (a *App) GetFiltersInfo() map[string]interface{} {
 	}
 }
 
-// UpdateFilters downloads latest Re:filter rule-sets
+// UpdateFilters downloads latest filter rule-sets (Re:filter and community lists)
 func (a *App) UpdateFilters() map[string]interface{} {
 	a.waitForInit()
 	
-	// Check if VPN is running
-	a.mu.Lock()
-	isRunning := a.isRunning
-	a.mu.Unlock()
-	
-	if isRunning {
-		return map[string]interface{}{
-			"success": false,
-			"error":   "Нельзя обновить фильтры пока VPN активен. Сначала отключите VPN.",
-		}
-	}
+	// Allowed while VPN is active: downloads then go through the proxy and each
+	// file is swapped in only after validation, sing-box picks it up on reconnect
 	
-	// Create filter manager
+	// Create filter manager; downloads are validated with the bundled sing-box
 	filterManager := NewFilterManager(a.basePath)
+	filterManager.SetSingboxPath(a.singboxPath)
+	if a.storage != nil {
+		filterManager.SetSourceURLs(a.storage.GetAppSettings().FilterSources)
+	}
 	
-	a.writeLog("Updating Re:filter rule-sets...")
+	a.writeLog(fmt.Sprintf("Updating filter rule-sets (%s)...", currentDownloadRoute()))
 	a.AddToLogBuffer("Обновление фильтров...")
 	
-	updated, err := filterManager.UpdateRefilters()
+	results, err := filterManager.UpdateAll()
 	if err != nil {
 		a.AddToLogBuffer(fmt.Sprintf("Ошибка обновления: %v", err))
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка обновления фильтров: %v", err),
+			"error":   a.tr("filters_update_failed", err),
+		}
+	}
+	
+	updated := 0
+	for _, r := range results {
+		if r.Updated {
+			updated++
+		} else {
+			a.writeLog(fmt.Sprintf("Filter %s rejected, previous file kept: %s", r.File, r.Error))
 		}
 	}
 	
 	if updated == 0 {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Не удалось обновить ни один фильтр",
+			"error":   a.tr("filters_none_updated"),
+			"files":   results,
 		}
 	}
 	
-	// Rebuild config if in blocked_only mode
-	settings := a.storage.GetAppSettings()
-	if settings.RoutingMode == RoutingModeBlockedOnly {
+	// Rebuild config if the active profile is in blocked_only mode
+	if profile, err := a.storage.GetActiveProfile(); err == nil && profile.EffectiveRoutingMode() == RoutingModeBlockedOnly {
 		if err := a.RebuildActiveProfileConfig(); err != nil {
 			a.writeLog(fmt.Sprintf("Warning: Failed to rebuild config after filter update: %v", err))
 		}
@@ -455,11 +622,221 @@ func (a *App) UpdateFilters() map[string]interface{} {
 	
 	return map[string]interface{}{
 		"success":      true,
-		"message":      fmt.Sprintf("Обновлено %d файлов фильтров", updated),
+		"message":      a.tr("filters_updated", updated),
 		"updated":      updated,
+		"files":        results,
 		"version":      info.Version,
 		"updated_at":   info.UpdatedAt,
 		"is_outdated":  info.IsOutdated,
+		"route":        currentDownloadRoute(),
+	}
+}
+
+// SetFilterSource sets the update URL of a filter file; an empty URL restores
+// the default source (API для фронтенда)
+func (a *App) SetFilterSource(file string, sourceURL string) map[string]interface{} {
+	a.waitForInit()
+	
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	if _, ok := findFilterFile(file); !ok {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("filter_file_unknown", file),
+		}
+	}
+	
+	sourceURL = strings.TrimSpace(sourceURL)
+	if sourceURL == FilterURLs[file] {
+		sourceURL = ""
+	}
+	if sourceURL != "" {
+		if err := ValidateFilterSourceURL(sourceURL); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("filter_source_invalid", err),
+			}
+		}
+	}
+	
+	settings := a.storage.GetAppSettings()
+	sources := make(map[string]string, len(settings.FilterSources)+1)
+	for name, u := range settings.FilterSources {
+		sources[name] = u
+	}
+	if sourceURL == "" {
+		delete(sources, file)
+	} else {
+		sources[file] = sourceURL
+	}
+	if len(sources) == 0 {
+		sources = nil
+	}
+	settings.FilterSources = sources
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	
+	effective := sourceURL
+	if effective == "" {
+		effective = FilterURLs[file]
+	}
+	a.writeLog(fmt.Sprintf("Filter source of %s set to %s", file, effective))
+	
+	return map[string]interface{}{
+		"success":    true,
+		"file":       file,
+		"source_url": effective,
+		"is_custom":  sourceURL != "",
+	}
+}
+
+// SetBootstrapProxy sets the proxy link used to fetch subscriptions whose
+// server is unreachable directly; an empty link removes it (API для фронтенда)
+func (a *App) SetBootstrapProxy(link string) map[string]interface{} {
+	a.waitForInit()
+	
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	link = strings.TrimSpace(link)
+	var proxy ProxyConfig
+	if link != "" {
+		var err error
+		if proxy, err = ParseBootstrapLink(link); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("bootstrap_proxy_invalid", err),
+			}
+		}
+	}
+	
+	settings := a.storage.GetAppSettings()
+	settings.BootstrapProxy = NewSecret(link)
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	
+	if link == "" {
+		a.writeLog("Bootstrap proxy removed")
+		return map[string]interface{}{"success": true}
+	}
+	a.writeLog(fmt.Sprintf("Bootstrap proxy set: %s %s:%d", proxy.Type, proxy.Server, proxy.ServerPort))
+	return map[string]interface{}{
+		"success": true,
+		"type":    proxy.Type,
+		"server":  proxy.Server,
+		"port":    proxy.ServerPort,
+	}
+}
+
+// bootstrapProxy returns the bootstrap proxy from settings (nil if not set)
+func (a *App) bootstrapProxy() *BootstrapProxy {
+	if a.storage == nil {
+		return nil
+	}
+	link := a.storage.GetAppSettings().BootstrapProxy.Value()
+	if link == "" {
+		return nil
+	}
+	return &BootstrapProxy{Link: link, SingboxPath: a.singboxPath}
+}
+
+// subscriptionLimits returns the subscription response limits from settings
+func (a *App) subscriptionLimits() SubscriptionLimits {
+	if a.storage == nil {
+		return SubscriptionLimits{}
+	}
+	return a.storage.GetAppSettings().SubscriptionLimits()
+}
+
+// SetSubscriptionLimits sets the largest subscription response in MB and the
+// most proxies parsed from it, 0 = defaults (API для фронтенда)
+func (a *App) SetSubscriptionLimits(maxMB, maxProxies int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	limits := SubscriptionLimits{MaxMB: maxMB, MaxProxies: maxProxies}
+	if err := ValidateSubscriptionLimits(limits); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.MaxSubscriptionMB = maxMB
+	settings.MaxSubscriptionProxies = maxProxies
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Subscription limits: %d MB, %d proxies", limits.maxBytes()/(1024*1024), limits.maxProxies()))
+	return map[string]interface{}{
+		"success":    true,
+		"maxMB":      limits.maxBytes() / (1024 * 1024),
+		"maxProxies": limits.maxProxies(),
+	}
+}
+
+// SetEndpointPinningResolver sets the DoH resolver used for endpoint pinning:
+// a preset ID or an https URL, "" for the default (API для фронтенда)
+func (a *App) SetEndpointPinningResolver(value string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	address, err := ValidatePinningResolver(value)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.PinningResolver = value
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	if address == "" {
+		address = DefaultPinningResolver
+	}
+	a.writeLog(fmt.Sprintf("Endpoint pinning resolver: %s", address))
+	return map[string]interface{}{
+		"success":  true,
+		"resolver": address,
 	}
 }
 
@@ -474,12 +851,6 @@ func (a *App) RebuildActiveProfileConfig() error {
 		return fmt.Errorf("no active profile: %v", err)
 	}
 	
-	// Get routing mode from settings
-	settings := a.storage.GetAppSettings()
-	if a.configBuilder != nil {
-		a.configBuilder.SetRoutingMode(settings.RoutingMode)
-	}
-	
-	// Rebuild using config builder
+	// Rebuild using config builder (with the routing mode of the profile)
 	return a.configBuilder.BuildConfig(profile.SubscriptionURL)
 }
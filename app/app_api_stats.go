@@ -4,17 +4,26 @@ package main
 // This file contains traffic monitoring and statistics
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path/filepath"
 	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // initTrafficStats инициализирует статистику трафика
 func (a *App) initTrafficStats() {
 	statsPath := a.getTrafficStatsPath()
 	a.trafficStats = LoadTrafficStats(statsPath)
+	if a.storage != nil {
+		a.trafficStats.History().SetRetentionMonths(a.storage.GetAppSettings().TrafficHistoryMonths)
+	}
+	a.trafficBreakdown = LoadTrafficBreakdown(filepath.Join(filepath.Dir(statsPath), TrafficBreakdownFile))
 }
 
 // getTrafficStatsPath возвращает путь к файлу статистики
@@ -32,42 +41,99 @@ func (a *App) GetTrafficStats() map[string]interface{} {
 	if a.trafficStats == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Статистика не загружена",
+			"error":   a.tr("stats_not_loaded"),
 		}
 	}
 	
 	current := a.trafficStats.GetCurrentSession()
 	last := a.trafficStats.GetLastSession()
 	total := a.trafficStats.GetTotalStats()
+	lang := a.uiLanguage()
+	
+	currentData := map[string]interface{}{
+		"uploaded":       current.Uploaded,
+		"downloaded":     current.Downloaded,
+		"duration":       int64(current.Duration.Seconds()),
+		"uploadedStr":    FormatBytes(current.Uploaded),
+		"downloadedStr":  FormatBytes(current.Downloaded),
+		"durationStr":    FormatDuration(current.Duration),
+	}
+	addLocalizedTraffic(currentData, current, lang)
+	
+	// Average rates of the current session
+	uploadRate, downloadRate := 0.0, 0.0
+	if seconds := current.Duration.Seconds(); seconds > 0 {
+		uploadRate = float64(current.Uploaded) / seconds
+		downloadRate = float64(current.Downloaded) / seconds
+	}
+	currentData["uploadRate"] = uploadRate
+	currentData["downloadRate"] = downloadRate
+	currentData["uploadRateText"] = FormatRateLocalized(uploadRate, lang)
+	currentData["downloadRateText"] = FormatRateLocalized(downloadRate, lang)
+	
+	lastData := map[string]interface{}{
+		"uploaded":       last.Uploaded,
+		"downloaded":     last.Downloaded,
+		"duration":       int64(last.Duration.Seconds()),
+		"uploadedStr":    FormatBytes(last.Uploaded),
+		"downloadedStr":  FormatBytes(last.Downloaded),
+		"durationStr":    FormatDuration(last.Duration),
+	}
+	addLocalizedTraffic(lastData, last, lang)
+	
+	totalData := map[string]interface{}{
+		"uploaded":       total.Uploaded,
+		"downloaded":     total.Downloaded,
+		"duration":       int64(total.Duration.Seconds()),
+		"sessions":       total.Sessions,
+		"uploadedStr":    FormatBytes(total.Uploaded),
+		"downloadedStr":  FormatBytes(total.Downloaded),
+		"durationStr":    FormatDuration(total.Duration),
+	}
+	addLocalizedTraffic(totalData, total, lang)
 	
 	return map[string]interface{}{
-		"success": true,
-		"current": map[string]interface{}{
-			"uploaded":       current.Uploaded,
-			"downloaded":     current.Downloaded,
-			"duration":       int64(current.Duration.Seconds()),
-			"uploadedStr":    FormatBytes(current.Uploaded),
-			"downloadedStr":  FormatBytes(current.Downloaded),
-			"durationStr":    FormatDuration(current.Duration),
-		},
-		"last": map[string]interface{}{
-			"uploaded":       last.Uploaded,
-			"downloaded":     last.Downloaded,
-			"duration":       int64(last.Duration.Seconds()),
-			"uploadedStr":    FormatBytes(last.Uploaded),
-			"downloadedStr":  FormatBytes(last.Downloaded),
-			"durationStr":    FormatDuration(last.Duration),
-		},
-		"total": map[string]interface{}{
-			"uploaded":       total.Uploaded,
-			"downloaded":     total.Downloaded,
-			"duration":       int64(total.Duration.Seconds()),
-			"sessions":       total.Sessions,
-			"uploadedStr":    FormatBytes(total.Uploaded),
-			"downloadedStr":  FormatBytes(total.Downloaded),
-			"durationStr":    FormatDuration(total.Duration),
-		},
+		"success":  true,
+		"language": lang,
+		"current":  currentData,
+		"last":     lastData,
+		"total":    totalData,
+	}
+}
+
+// GetTrafficBreakdown returns traffic per outbound and the top domains for a
+// period: today, week, month or all (API для фронтенда)
+func (a *App) GetTrafficBreakdown(period string) map[string]interface{} {
+	a.waitForInit()
+	
+	if a.trafficBreakdown == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("stats_not_loaded"),
+		}
+	}
+	
+	outbounds, domains, err := a.trafficBreakdown.Breakdown(period, DefaultTrafficTopDomains)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
 	}
+	
+	return map[string]interface{}{
+		"success":   true,
+		"period":    period,
+		"outbounds": outbounds,
+		"domains":   domains,
+	}
+}
+
+// addLocalizedTraffic adds formatted fields in the UI language next to the raw values
+func addLocalizedTraffic(m map[string]interface{}, data TrafficData, lang Language) {
+	m["uploadedText"] = FormatBytesLocalized(data.Uploaded, lang)
+	m["downloadedText"] = FormatBytesLocalized(data.Downloaded, lang)
+	m["durationText"] = FormatDurationLocalized(data.Duration, lang)
 }
 
 // ResetTrafficStats сбрасывает статистику трафика
@@ -77,7 +143,7 @@ func (a *App) ResetTrafficStats() map[string]interface{} {
 	if a.trafficStats == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Статистика не загружена",
+			"error":   a.tr("stats_not_loaded"),
 		}
 	}
 	
@@ -90,7 +156,122 @@ func (a *App) ResetTrafficStats() map[string]interface{} {
 	
 	return map[string]interface{}{
 		"success": true,
-		"message": "Статистика сброшена",
+		"message": a.tr("stats_reset"),
+	}
+}
+
+// GetTrafficHistory returns daily traffic of a profile (0 = all profiles)
+// between fromDate and toDate, YYYY-MM-DD, "" leaves the range open (API для фронтенда)
+func (a *App) GetTrafficHistory(profileID int, fromDate, toDate string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.trafficStats == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("stats_not_loaded"),
+		}
+	}
+	for _, date := range []string{fromDate, toDate} {
+		if err := ValidateTrafficHistoryDate(date); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+	}
+
+	// The running session counts up to now
+	a.trafficStats.CheckpointHistory()
+	days := a.trafficStats.History().Query(profileID, fromDate, toDate)
+
+	var total TrafficData
+	for _, day := range days {
+		total.Uploaded += day.Uploaded
+		total.Downloaded += day.Downloaded
+		total.Duration += day.Duration
+		total.Sessions += day.Sessions
+	}
+	totalData := map[string]interface{}{
+		"uploaded":   total.Uploaded,
+		"downloaded": total.Downloaded,
+		"duration":   int64(total.Duration.Seconds()),
+		"sessions":   total.Sessions,
+	}
+	addLocalizedTraffic(totalData, total, a.uiLanguage())
+
+	return map[string]interface{}{
+		"success":   true,
+		"profileId": profileID,
+		"days":      days,
+		"total":     totalData,
+	}
+}
+
+// ResetTrafficHistory clears daily traffic of a profile (0 = all profiles) (API для фронтенда)
+func (a *App) ResetTrafficHistory(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.trafficStats == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("stats_not_loaded"),
+		}
+	}
+
+	history := a.trafficStats.History()
+	removed := history.Reset(profileID)
+	if err := history.Save(); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("file_write_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Traffic history reset (profile %d, %d days removed)", profileID, removed))
+	return map[string]interface{}{
+		"success": true,
+		"removed": removed,
+		"message": a.tr("stats_reset"),
+	}
+}
+
+// SetTrafficHistoryRetention sets how many months of daily traffic are kept
+// (0 = DefaultTrafficHistoryMonths) (API для фронтенда)
+func (a *App) SetTrafficHistoryRetention(months int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	if err := ValidateTrafficHistoryMonths(months); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.TrafficHistoryMonths = months
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	if a.trafficStats != nil {
+		a.trafficStats.History().SetRetentionMonths(months)
+	}
+
+	if months == 0 {
+		months = DefaultTrafficHistoryMonths
+	}
+	a.writeLog(fmt.Sprintf("Traffic history retention: %d months", months))
+	return map[string]interface{}{
+		"success": true,
+		"months":  months,
 	}
 }
 
@@ -99,7 +280,7 @@ func (a *App) fetchClashTraffic() (upload, download int64) {
 	client := &http.Client{Timeout: 2 * time.Second}
 	
 	// Используем /connections endpoint для получения суммарного трафика
-	resp, err := client.Get("http://127.0.0.1:9090/connections")
+	resp, err := clashGet(client, "/connections")
 	if err != nil {
 		return 0, 0
 	}
@@ -133,9 +314,99 @@ func (a *App) UpdateTrafficFromClash() map[string]interface{} {
 	upload, download := a.fetchClashTraffic()
 	a.trafficStats.UpdateTraffic(upload, download)
 	
+	lang := a.uiLanguage()
 	return map[string]interface{}{
-		"success":  true,
-		"upload":   upload,
-		"download": download,
+		"success":      true,
+		"upload":       upload,
+		"download":     download,
+		"uploadText":   FormatBytesLocalized(upload, lang),
+		"downloadText": FormatBytesLocalized(download, lang),
+	}
+}
+
+// statsExportFilename suggests a file name; only this depends on the UI language
+func statsExportFilename(kind string, lang Language) string {
+	name := map[string]string{StatsExportSessions: "sessions", StatsExportDaily: "daily"}[kind]
+	if lang == LangRussian {
+		name = map[string]string{StatsExportSessions: "подключения", StatsExportDaily: "по-дням"}[kind]
+	}
+	return fmt.Sprintf("kampus-vpn-%s-%s.csv", name, time.Now().Format("2006-01-02"))
+}
+
+// ExportStatisticsCSV saves connection history ("sessions") or per-day totals
+// per profile ("daily") to a CSV file; zero from/to leave the range open (API для фронтенда)
+func (a *App) ExportStatisticsCSV(kind string, from, to time.Time) map[string]interface{} {
+	a.waitForInit()
+
+	if a.trafficStats == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("stats_not_loaded"),
+		}
+	}
+	if err := ValidateStatsExport(kind, from, to); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	filename, err := wailsRuntime.SaveFileDialog(a.ctx, wailsRuntime.SaveDialogOptions{
+		Title:           "Экспорт статистики",
+		DefaultFilename: statsExportFilename(kind, a.uiLanguage()),
+		Filters: []wailsRuntime.FileFilter{
+			{
+				DisplayName: "CSV файлы (*.csv)",
+				Pattern:     "*.csv",
+			},
+		},
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("save_dialog_failed", err),
+		}
+	}
+	if filename == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("cancelled"),
+		}
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("file_write_failed", err),
+		}
+	}
+	out := bufio.NewWriter(f)
+
+	var rows int
+	if kind == StatsExportDaily {
+		rows, err = WriteDailyCSV(out, a.trafficStats.HistoryPath(), from, to)
+	} else {
+		rows, err = WriteSessionsCSV(out, a.trafficStats.HistoryPath(), from, to)
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("file_write_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Statistics exported (%s, %d rows): %s", kind, rows, filename))
+	return map[string]interface{}{
+		"success": true,
+		"path":    filename,
+		"rows":    rows,
 	}
 }
@@ -4,14 +4,26 @@ package main
 // This file contains subscription-related API methods
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
 // TestSubscription tests a subscription URL and returns available proxies
 func (a *App) TestSubscription(url string) map[string]interface{} {
+	var opts SubscriptionRequestOptions
+	if a.storage != nil {
+		if profile, err := a.storage.GetActiveProfile(); err == nil {
+			opts.Headers = profile.SubscriptionHeaders
+		}
+	}
+	opts.Bootstrap = a.bootstrapProxy()
+	opts.Limits = a.subscriptionLimits()
+
 	fetcher := NewSubscriptionFetcher()
-	proxies, err := fetcher.FetchAndParse(url)
+	proxies, userInfo, route, err := fetcher.FetchWithRoute(url, opts)
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
@@ -21,7 +33,8 @@ func (a *App) TestSubscription(url string) map[string]interface{} {
 	}
 
 	// Filter unsupported transports (e.g., xhttp which is Xray-only)
-	filterResult := FilterUnsupportedTransports(proxies)
+	allowUnsupported := a.storage != nil && a.storage.GetAppSettings().AllowUnsupportedTransports
+	filterResult := FilterTransports(proxies, allowUnsupported)
 	filteredProxies := filterResult.Supported
 
 	// Convert proxies to simple format for frontend
@@ -39,33 +52,324 @@ func (a *App) TestSubscription(url string) map[string]interface{} {
 		"success": true,
 		"count":   len(filteredProxies),
 		"proxies": proxyList,
+		"route":   route,
+	}
+	if userInfo != nil {
+		result["user_info"] = userInfo
 	}
 
 	// Add warning if some proxies were filtered out
 	if len(filterResult.Filtered) > 0 {
 		result["warning"] = filterResult.Message
 		result["filteredCount"] = len(filterResult.Filtered)
+		result["filteredProxies"] = filterResult.Entries
 		result["totalOriginal"] = len(proxies)
 
 		// If ALL proxies were filtered, return error
 		if filterResult.AllFiltered {
 			return map[string]interface{}{
-				"success": false,
-				"error":   filterResult.Message,
-				"count":   0,
+				"success":         false,
+				"error":           filterResult.Message,
+				"count":           0,
+				"filteredProxies": filterResult.Entries,
 			}
 		}
 	}
+	if filterResult.Forced {
+		result["warning"] = filterResult.Message
+		result["forcedProxies"] = filterResult.Entries
+	}
 
 	return result
 }
 
+// SetAllowUnsupportedTransports keeps proxies with transports unsupported by the
+// bundled core in generated configs; applies on the next rebuild (API для фронтенда)
+func (a *App) SetAllowUnsupportedTransports(allow bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.AllowUnsupportedTransports = allow
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Allow unsupported transports: %v", allow))
+
+	result := map[string]interface{}{
+		"success": true,
+		"allow":   allow,
+	}
+	if allow {
+		result["warning"] = UnsupportedTransportsWarning
+	}
+	return result
+}
+
+// SetMaxProxiesPerProfile sets how many subscription proxies are written to a
+// profile config (0 = default); applies on the next rebuild (API для фронтенда)
+func (a *App) SetMaxProxiesPerProfile(max int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	if max < 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("server_limit_negative"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.MaxProxiesPerProfile = max
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Max proxies per profile: %d", settings.MaxProxies()))
+	return map[string]interface{}{
+		"success": true,
+		"max":     settings.MaxProxies(),
+	}
+}
+
+// SetMultiplexSettings sets the multiplex default for proxies whose links don't
+// set it; applies on the next rebuild (API для фронтенда)
+func (a *App) SetMultiplexSettings(enabled bool, protocol string, maxStreams int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	if err := ValidateMultiplex(protocol, maxStreams); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.Multiplex = MultiplexSettings{
+		Enabled:    enabled,
+		Protocol:   protocol,
+		MaxStreams: maxStreams,
+	}
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Multiplex default: enabled=%v protocol=%q max_streams=%d", enabled, protocol, maxStreams))
+	return map[string]interface{}{
+		"success":   true,
+		"multiplex": settings.Multiplex,
+	}
+}
+
+// SetGroupProxiesByRegion adds (or removes) a urltest group per country to the
+// proxy selector; applies on the next rebuild (API для фронтенда)
+func (a *App) SetGroupProxiesByRegion(enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.GroupProxiesByRegion = enabled
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Group proxies by region: %v", enabled))
+	return map[string]interface{}{
+		"success": true,
+		"enabled": enabled,
+	}
+}
+
+// SetProfileProxyLimit lets a profile keep every subscription proxy and sets the
+// proxies kept first when the cap applies; applies on the next rebuild (API для фронтенда)
+func (a *App) SetProfileProxyLimit(profileID int, keepAll bool, pinned []string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.SetProfileProxyLimit(profileID, keepAll, pinned); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Proxy limit for profile %d: keep all %v, %d pinned", profileID, keepAll, len(pinned)))
+	return map[string]interface{}{
+		"success": true,
+		"keepAll": keepAll,
+		"pinned":  pinned,
+	}
+}
+
+// SetEndpointPinning makes a profile connect to proxies by the IPs resolved
+// through DoH; applies on the next rebuild (API для фронтенда)
+func (a *App) SetEndpointPinning(profileID int, enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.SetProfileEndpointPinning(profileID, enabled); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Endpoint pinning for profile %d: %v", profileID, enabled))
+	return map[string]interface{}{
+		"success": true,
+		"enabled": enabled,
+	}
+}
+
+// GetPinnedEndpoints returns the IPs the last build pinned for a profile (API для фронтенда)
+func (a *App) GetPinnedEndpoints(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	pinned := profile.PinnedEndpoints
+	if pinned == nil {
+		pinned = map[string][]string{}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"enabled": profile.PinEndpoints,
+		"pinned":  pinned,
+	}
+}
+
+// GetNodePreferences returns the pinned and hidden proxies of a profile (API для фронтенда)
+func (a *App) GetNodePreferences(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	prefs := NodePreferences{}
+	if profile.NodePreferences != nil {
+		prefs = *profile.NodePreferences
+	}
+	return map[string]interface{}{
+		"success": true,
+		"pinned":  prefs.Pinned,
+		"hidden":  prefs.Hidden,
+	}
+}
+
+// SetNodePreferences sets the proxies (by tag) pinned to the top of the
+// selector in the given order and the proxies hidden from the config; tags
+// no longer in the subscription are dropped and returned. Applies on the
+// next rebuild (API для фронтенда)
+func (a *App) SetNodePreferences(profileID int, pinned []string, hidden []string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	saved, unknown, err := a.storage.SetProfileNodePreferences(profileID, NodePreferences{Pinned: pinned, Hidden: hidden})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Node preferences for profile %d: %d pinned, %d hidden, %d unknown dropped",
+		profileID, len(saved.Pinned), len(saved.Hidden), len(unknown)))
+	result := map[string]interface{}{
+		"success": true,
+		"pinned":  saved.Pinned,
+		"hidden":  saved.Hidden,
+	}
+	if len(unknown) > 0 {
+		result["dropped"] = unknown
+	}
+	return result
+}
+
 // GenerateAndSaveConfig generates config from settings and saves it
 func (a *App) GenerateAndSaveConfig() map[string]interface{} {
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
@@ -73,14 +377,14 @@ func (a *App) GenerateAndSaveConfig() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Failed to load settings: %v", err),
+			"error":   a.tr("settings_load_failed", err),
 		}
 	}
 
 	if err := a.configBuilder.BuildConfig(settings.SubscriptionURL); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Failed to generate config: %v", err),
+			"error":   a.tr("config_generate_failed", err),
 		}
 	}
 
@@ -93,10 +397,15 @@ func (a *App) GenerateAndSaveConfig() map[string]interface{} {
 
 // UpdateSubscriptions fetches all subscriptions and regenerates config
 func (a *App) UpdateSubscriptions() map[string]interface{} {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
 	// Stop VPN if running
+	a.mu.Lock()
 	wasRunning := a.isRunning
+	a.mu.Unlock()
 	if wasRunning {
-		a.Stop()
+		a.stopVPN()
 	}
 
 	// Generate new config
@@ -107,7 +416,7 @@ func (a *App) UpdateSubscriptions() map[string]interface{} {
 
 	// Restart VPN if it was running
 	if wasRunning {
-		a.Start()
+		a.startVPN()
 	}
 
 	return map[string]interface{}{
@@ -126,7 +435,7 @@ func (a *App) GetCurrentSubscription() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"hasSubscription": false,
-			"error":           "Storage не инициализирован",
+			"error":           a.tr("storage_not_initialized"),
 		}
 	}
 
@@ -144,12 +453,165 @@ func (a *App) GetCurrentSubscription() map[string]interface{} {
 		}
 	}
 
-	return map[string]interface{}{
-		"hasSubscription": true,
-		"url":             settings.SubscriptionURL,
-		"lastUpdated":     settings.LastUpdated,
-		"proxyCount":      settings.ProxyCount,
+	subscriptionCount := 1
+	if profile, err := a.storage.GetActiveProfile(); err == nil && len(profile.Subscriptions) > 0 {
+		subscriptionCount = len(profile.Subscriptions)
+	}
+
+	result := map[string]interface{}{
+		"hasSubscription":    true,
+		"url":                settings.SubscriptionURL,
+		"subscriptionCount":  subscriptionCount,
+		"lastUpdated":        settings.LastUpdated,
+		"proxyCount":         settings.ProxyCount,
+		"insecureSkipVerify": false,
+	}
+	if profile, err := a.storage.GetActiveProfile(); err == nil && profile.SubscriptionInsecureSkipVerify {
+		result["insecureSkipVerify"] = true
+		result["warning"] = InsecureSubscriptionWarning
+	}
+	return result
+}
+
+// SetSubscriptionInsecureSkipVerify disables (or re-enables) certificate verification
+// for the subscription host of a profile and refetches it (API для фронтенда).
+// Intended only after the user has seen the classified certificate error.
+func (a *App) SetSubscriptionInsecureSkipVerify(profileID int, insecure bool) map[string]interface{} {
+	a.waitForInit()
+	
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_setting"),
+		}
+	}
+	a.mu.Unlock()
+	
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	if err := a.storage.SetProfileSubscriptionInsecure(profileID, insecure); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	
+	host := subscriptionHost(profile.SubscriptionURL)
+	if insecure {
+		a.writeLog(fmt.Sprintf("Certificate verification disabled for subscription host %s (profile %d)", host, profileID))
+	} else {
+		a.writeLog(fmt.Sprintf("Certificate verification re-enabled for subscription host %s (profile %d)", host, profileID))
+	}
+	
+	result := map[string]interface{}{
+		"success":            true,
+		"insecureSkipVerify": insecure,
+		"host":               host,
+	}
+	if insecure {
+		result["warning"] = InsecureSubscriptionWarning
+	}
+	
+	if profile.SubscriptionURL != "" && !isDirectProxyLink(profile.SubscriptionURL) {
+		if err := a.configBuilder.BuildConfigForProfile(profileID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			errResult := a.rebuildErrorResult(err)
+			errResult["insecureSkipVerify"] = insecure
+			return errResult
+		}
+		if updated, err := a.storage.GetProfile(profileID); err == nil {
+			result["proxyCount"] = updated.ProxyCount
+		}
+	}
+	
+	return result
+}
+
+// SetSubscriptionHeaders sets request headers of a profile's subscription
+// (token header, "User-Agent") and refetches it (API для фронтенда).
+// Empty values remove headers; an empty map removes all of them.
+func (a *App) SetSubscriptionHeaders(profileID int, headers map[string]string) map[string]interface{} {
+	a.waitForInit()
+	
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_setting"),
+		}
+	}
+	a.mu.Unlock()
+	
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	normalized, err := normalizeSubscriptionHeaders(headers)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	
+	if err := a.storage.SetProfileSubscriptionHeaders(profileID, normalized); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	
+	// Values are credentials: only names go to the log
+	names := make([]string, 0, len(normalized))
+	for name := range normalized {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	a.writeLog(fmt.Sprintf("Subscription headers of profile %d: %v", profileID, names))
+	
+	result := map[string]interface{}{
+		"success": true,
+		"headers": normalized,
+	}
+	
+	if profile.SubscriptionURL != "" && !isDirectProxyLink(profile.SubscriptionURL) {
+		if err := a.configBuilder.BuildConfigForProfile(profileID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+			errResult := a.rebuildErrorResult(err)
+			errResult["headers"] = normalized
+			return errResult
+		}
+		if updated, err := a.storage.GetProfile(profileID); err == nil {
+			result["proxyCount"] = updated.ProxyCount
+		}
 	}
+	
+	return result
 }
 
 // TestVPNConnection тестирует подписку или прямую ссылку
@@ -160,11 +622,13 @@ func (a *App) TestVPNConnection(url string) map[string]interface{} {
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
-	result, err := a.configBuilder.TestSubscription(url)
+	ctx, done := a.beginSubscriptionFetch()
+	defer done()
+	result, err := a.configBuilder.TestSubscriptionContext(ctx, url)
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
@@ -172,13 +636,34 @@ func (a *App) TestVPNConnection(url string) map[string]interface{} {
 		}
 	}
 
-	return map[string]interface{}{
+	response := map[string]interface{}{
 		"success":      result.Success,
 		"error":        result.Error,
 		"count":        result.Count,
 		"isDirectLink": result.IsDirectLink,
 		"proxies":      result.Proxies,
+		"attempts":     result.Attempts,
+	}
+	if result.FinalURL != "" {
+		response["final_url"] = result.FinalURL
+	}
+	if result.Cancelled {
+		response["cancelled"] = true
+	}
+	if result.TLSError != nil {
+		response["tls_error"] = result.TLSError.ToMap()
+	}
+	if result.Warning != "" {
+		response["warning"] = result.Warning
+	}
+	if len(result.FilteredProxies) > 0 {
+		response["filtered_proxies"] = result.FilteredProxies
+		response["filtered_count"] = result.FilteredCount
+	}
+	if result.UserInfo != nil {
+		response["user_info"] = result.UserInfo
 	}
+	return response
 }
 
 // SetVPNSubscription устанавливает подписку и генерирует конфиг
@@ -189,22 +674,86 @@ func (a *App) SetVPNSubscription(url string) map[string]interface{} {
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
+	return a.rebuildWithSubscription(url)
+}
+
+// beginSubscriptionFetch returns the context of a user-started subscription
+// fetch, cancelled by CancelSubscriptionFetch; done must be called when the
+// fetch ends. A new fetch cancels the previous one.
+func (a *App) beginSubscriptionFetch() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a.fetchMu.Lock()
+	if a.fetchCancel != nil {
+		a.fetchCancel()
+	}
+	a.fetchSeq++
+	seq := a.fetchSeq
+	a.fetchCancel = cancel
+	a.fetchMu.Unlock()
+
+	return ctx, func() {
+		cancel()
+		a.fetchMu.Lock()
+		defer a.fetchMu.Unlock()
+		// A newer fetch may have replaced this one
+		if a.fetchSeq == seq {
+			a.fetchCancel = nil
+		}
+	}
+}
+
+// CancelSubscriptionFetch cancels the subscription check or update in flight,
+// e.g. when the dialog is closed (API для фронтенда)
+func (a *App) CancelSubscriptionFetch() map[string]interface{} {
+	a.fetchMu.Lock()
+	cancel := a.fetchCancel
+	a.fetchCancel = nil
+	a.fetchMu.Unlock()
+
+	if cancel == nil {
+		return map[string]interface{}{
+			"success":   true,
+			"cancelled": false,
+		}
+	}
+	cancel()
+	a.writeLog("Subscription fetch cancelled by user")
+	return map[string]interface{}{
+		"success":   true,
+		"cancelled": true,
+	}
+}
+
+// rebuildWithSubscription regenerates the active profile config with the given
+// primary subscription, restarting the VPN if it was running
+func (a *App) rebuildWithSubscription(url string) map[string]interface{} {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
 	// Останавливаем VPN если запущен
+	a.mu.Lock()
 	wasRunning := a.isRunning
+	a.mu.Unlock()
 	if wasRunning {
-		a.Stop()
+		a.stopVPN()
 	}
 
-	// Генерируем новый конфиг
-	if err := a.configBuilder.BuildConfig(url); err != nil {
-		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
+	// Генерируем новый конфиг (загрузку подписки можно отменить)
+	ctx, done := a.beginSubscriptionFetch()
+	err := a.configBuilder.BuildConfigContext(ctx, url)
+	cancelled := ctx.Err() != nil
+	done()
+	if err != nil {
+		result := a.rebuildErrorResult(err)
+		if cancelled {
+			result["cancelled"] = true
 		}
+		return result
 	}
 
 	// Перезапускаем VPN если был запущен
@@ -222,7 +771,103 @@ func (a *App) SetVPNSubscription(url string) map[string]interface{} {
 	return map[string]interface{}{
 		"success":    true,
 		"proxyCount": settings.ProxyCount,
+		"warnings":   a.activeBuildWarnings(),
+	}
+}
+
+// ListSubscriptions возвращает все подписки активного профиля (API для фронтенда)
+func (a *App) ListSubscriptions() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	migrateProfileSubscriptions(profile)
+
+	subscriptions := profile.Subscriptions
+	if subscriptions == nil {
+		subscriptions = []SubscriptionEntry{}
+	}
+	return map[string]interface{}{
+		"success":       true,
+		"subscriptions": subscriptions,
+		"proxyCount":    profile.ProxyCount,
+	}
+}
+
+// AddSubscription добавляет подписку к активному профилю; прокси всех подписок
+// объединяются в один конфиг (API для фронтенда)
+func (a *App) AddSubscription(url, name string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	url = strings.TrimSpace(url)
+	if !isDirectProxyLink(url) && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("subscription_url_invalid"),
+		}
+	}
+
+	profileID := a.storage.GetActiveProfileID()
+	if err := a.storage.AddProfileSubscription(profileID, url, strings.TrimSpace(name)); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Subscription added to profile %d: %s", profileID, subscriptionHost(url)))
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return a.rebuildWithSubscription(profile.SubscriptionURL)
+}
+
+// RemoveSubscription удаляет подписку из активного профиля; следующая
+// становится основной (API для фронтенда)
+func (a *App) RemoveSubscription(url string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profileID := a.storage.GetActiveProfileID()
+	primary, err := a.storage.RemoveProfileSubscription(profileID, url)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
 	}
+
+	a.writeLog(fmt.Sprintf("Subscription removed from profile %d: %s", profileID, subscriptionHost(url)))
+	return a.rebuildWithSubscription(primary)
 }
 
 // RemoveVPNSubscription удаляет подписку и генерирует конфиг без прокси
@@ -233,22 +878,24 @@ func (a *App) RemoveVPNSubscription() map[string]interface{} {
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
 	// Останавливаем VPN
+	a.mu.Lock()
 	wasRunning := a.isRunning
+	a.mu.Unlock()
 	if wasRunning {
-		a.Stop()
+		a.stopVPN()
 	}
 
 	// Генерируем конфиг без подписки
 	if err := a.configBuilder.BuildConfig(""); err != nil {
-		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		}
+		return a.rebuildErrorResult(err)
 	}
 
 	return map[string]interface{}{
@@ -262,7 +909,7 @@ func (a *App) RefreshVPNSubscription() map[string]interface{} {
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
@@ -270,9 +917,33 @@ func (a *App) RefreshVPNSubscription() map[string]interface{} {
 	if err != nil || settings.SubscriptionURL == "" {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нет сохранённой подписки",
+			"error":   a.tr("subscription_missing"),
 		}
 	}
 
-	return a.SetVPNSubscription(settings.SubscriptionURL)
+	refreshedAt := time.Now()
+	result := a.SetVPNSubscription(settings.SubscriptionURL)
+	if result["success"] == true {
+		a.addSubscriptionDiff(result, refreshedAt)
+	}
+	return result
+}
+
+// addSubscriptionDiff adds what the refresh changed to result and the UI log.
+// No diff is recorded when one of the subscriptions failed to load.
+func (a *App) addSubscriptionDiff(result map[string]interface{}, since time.Time) {
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil || profile.LastSubscriptionDiff == nil || profile.LastSubscriptionDiff.ComparedAt.Before(since) {
+		return
+	}
+	diff := profile.LastSubscriptionDiff
+
+	result["diff"] = diff
+	if diff.SelectedRemoved != "" {
+		result["selectedRemoved"] = diff.SelectedRemoved
+		result["message"] = fmt.Sprintf("Выбранный сервер %s больше не предлагается подпиской, включён автовыбор", diff.SelectedRemoved)
+	}
+	a.writeLog(fmt.Sprintf("Subscription refreshed: +%d -%d renamed %d credentials %d",
+		len(diff.Added), len(diff.Removed), len(diff.Renamed), len(diff.CredentialsChanged)))
+	a.AddToLogBuffer(diff.Summary())
 }
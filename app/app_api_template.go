@@ -6,7 +6,6 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"os"
 )
 
@@ -25,7 +24,7 @@ func (a *App) GetTemplateContent() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 			"content": "",
 		}
 	}
@@ -35,7 +34,7 @@ func (a *App) GetTemplateContent() map[string]interface{} {
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Не удалось прочитать template.json: %v", err),
+			"error":   a.tr("template_read_failed", err),
 			"content": "",
 		}
 	}
@@ -53,7 +52,7 @@ func (a *App) SaveTemplateContent(content string) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -64,7 +63,7 @@ func (a *App) SaveTemplateContent(content string) map[string]interface{} {
 	if err := json.Unmarshal([]byte(content), &jsonTest); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Некорректный JSON: %v", err),
+			"error":   a.tr("json_invalid", err),
 		}
 	}
 	
@@ -73,14 +72,14 @@ func (a *App) SaveTemplateContent(content string) map[string]interface{} {
 	if err := json.Indent(&prettyJSON, []byte(content), "", "  "); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка форматирования JSON: %v", err),
+			"error":   a.tr("json_format_failed", err),
 		}
 	}
 	
 	if err := os.WriteFile(templatePath, prettyJSON.Bytes(), 0644); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Не удалось сохранить template.json: %v", err),
+			"error":   a.tr("template_save_failed", err),
 		}
 	}
 	
@@ -98,7 +97,7 @@ func (a *App) ResetTemplate() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 	
@@ -108,7 +107,7 @@ func (a *App) ResetTemplate() map[string]interface{} {
 	if err := copyEmbeddedTemplate(templatePath); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Не удалось сбросить template.json: %v", err),
+			"error":   a.tr("template_reset_failed", err),
 		}
 	}
 	
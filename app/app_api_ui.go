@@ -4,6 +4,7 @@ package main
 // This file contains window management and UI operations
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -24,12 +25,20 @@ func (a *App) QuitApp() {
 	a.Stop()
 	if a.ctx != nil {
 		wailsRuntime.Quit(a.ctx)
+	} else {
+		// No window yet (tray-only mode): Wails won't call shutdown
+		a.shutdown(context.Background())
 	}
 	os.Exit(0)
 }
 
 // ShowWindow shows the application window
 func (a *App) ShowWindow() {
+	if a.ctx == nil && a.trayOnly {
+		// Tray-only mode: create the window on first request
+		a.requestGUI()
+		return
+	}
 	if a.ctx != nil {
 		wailsRuntime.WindowShow(a.ctx)
 		a.SetWindowVisible(true)
@@ -78,17 +87,7 @@ func (a *App) OpenConfigFolder() {
 
 // OpenLogs opens the logs folder in file explorer
 func (a *App) OpenLogs() {
-	var logDir string
-	switch runtime.GOOS {
-	case "windows":
-		logDir = filepath.Join(os.Getenv("LOCALAPPDATA"), "KampusVPN", "logs")
-	case "darwin":
-		home, _ := os.UserHomeDir()
-		logDir = filepath.Join(home, "Library", "Logs", "KampusVPN")
-	default:
-		home, _ := os.UserHomeDir()
-		logDir = filepath.Join(home, ".local", "share", "kampusvpn", "logs")
-	}
+	logDir := defaultLogDir()
 
 	// Create logs folder if it doesn't exist
 	os.MkdirAll(logDir, 0755)
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"syscall"
 	"time"
 
@@ -21,8 +20,16 @@ func (a *App) CheckForUpdates() map[string]interface{} {
 		return map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
+			"route":   currentDownloadRoute(),
 		}
 	}
+	// DownloadAndInstallUpdate installs the release of this check
+	a.updateMu.Lock()
+	a.updateInfo = updateInfo
+	a.updateMu.Unlock()
+	if updateInfo.Available {
+		a.notifyUpdateAvailable(updateInfo.Version)
+	}
 	
 	return map[string]interface{}{
 		"success":        true,
@@ -34,85 +41,427 @@ func (a *App) CheckForUpdates() map[string]interface{} {
 		"publishedAt":    updateInfo.PublishedAt,
 		"releaseURL":     updateInfo.ReleaseURL,
 		"fileSize":       updateInfo.FileSize,
+		"route":          updateInfo.Route,
 	}
 }
 
-// DownloadAndInstallUpdate загружает и устанавливает обновление
+// DownloadAndInstallUpdate загружает и устанавливает обновление через
+// DownloadUpdateWithProgress и ApplyUpdate, с проверкой SHA256 (API для фронтенда).
+// Only the release found by the last check is installed, not any URL.
 func (a *App) DownloadAndInstallUpdate(downloadURL string) map[string]interface{} {
-	// Остановить VPN если запущен
-	if a.isRunning {
-		a.Stop()
+	a.updateMu.Lock()
+	info := a.updateInfo
+	a.updateMu.Unlock()
+
+	if info == nil || !info.Available || info.DownloadURL != downloadURL {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_not_available"),
+		}
 	}
-	
-	a.AddToLogBuffer("Downloading update...")
-	
-	// Download the update
-	tempFile, err := DownloadUpdate(downloadURL, func(downloaded, total int64) {
-		// Progress callback - can emit events if needed
+
+	if result := a.DownloadUpdateWithProgress(); result["success"] != true {
+		return result
+	}
+	return a.ApplyUpdate()
+}
+
+// updateInfoResult converts update info to API response format
+func updateInfoResult(info *UpdateInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"success":        true,
+		"hasUpdate":      info.Available,
+		"currentVersion": info.CurrentVersion,
+		"latestVersion":  info.Version,
+		"downloadURL":    info.DownloadURL,
+		"releaseNotes":   info.Description,
+		"publishedAt":    info.PublishedAt,
+		"releaseURL":     info.ReleaseURL,
+		"fileSize":       info.FileSize,
+		"hasChecksum":    info.SHA256 != "" || info.ChecksumURL != "",
+	}
+}
+
+// CheckUpdates checks for a new version unless checks are disabled in settings
+// or the last check was less than UpdateCheckInterval ago; then the cached
+// result is returned with "throttled" (API для фронтенда)
+func (a *App) CheckUpdates() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	if !settings.CheckUpdates {
+		return map[string]interface{}{
+			"success":   true,
+			"hasUpdate": false,
+			"disabled":  true,
+		}
+	}
+
+	a.updateMu.Lock()
+	cached := a.updateInfo
+	a.updateMu.Unlock()
+	if last, err := time.Parse(time.RFC3339, settings.LastUpdateCheck); err == nil && time.Since(last) < UpdateCheckInterval {
+		result := map[string]interface{}{
+			"success":   true,
+			"hasUpdate": false,
+		}
+		if cached != nil {
+			result = updateInfoResult(cached)
+		}
+		result["throttled"] = true
+		result["lastCheck"] = settings.LastUpdateCheck
+		return result
+	}
+
+	info, err := CheckForUpdates()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Update] Check failed: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_check_failed", err),
+		}
+	}
+
+	a.updateMu.Lock()
+	a.updateInfo = info
+	a.updateMu.Unlock()
+
+	settings.LastUpdateCheck = time.Now().Format(time.RFC3339)
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		a.writeLog(fmt.Sprintf("[Update] Failed to save last check time: %v", err))
+	}
+
+	if info.Available {
+		a.writeLog(fmt.Sprintf("[Update] Version %s available (current %s)", info.Version, info.CurrentVersion))
+		a.notifyUpdateAvailable(info.Version)
+	}
+	result := updateInfoResult(info)
+	result["lastCheck"] = settings.LastUpdateCheck
+	return result
+}
+
+// DownloadUpdateWithProgress downloads the update found by CheckUpdates and
+// emits "update-download-progress" events. The installation isn't touched
+// until ApplyUpdate (API для фронтенда)
+func (a *App) DownloadUpdateWithProgress() map[string]interface{} {
+	a.updateMu.Lock()
+	info := a.updateInfo
+	a.updateMu.Unlock()
+
+	if info == nil || !info.Available {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_not_available"),
+		}
+	}
+	if info.DownloadURL == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_no_windows_asset"),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("[Update] Downloading %s", info.DownloadURL))
+	lastPercent := -1
+	path, err := DownloadUpdate(info.DownloadURL, func(downloaded, total int64) {
+		if total <= 0 {
+			total = info.FileSize
+		}
+		percent := 0
 		if total > 0 {
-			progress := float64(downloaded) / float64(total) * 100
-			wailsRuntime.EventsEmit(a.ctx, "update-progress", progress)
+			percent = int(downloaded * 100 / total)
 		}
+		// One event per percent: the callback runs for every 32 KB
+		if percent == lastPercent {
+			return
+		}
+		lastPercent = percent
+		a.emitEvent("update-download-progress", map[string]interface{}{
+			"downloaded": downloaded,
+			"total":      total,
+			"percent":    percent,
+		})
 	})
-	
 	if err != nil {
-		a.AddToLogBuffer("Update download failed: " + err.Error())
+		a.writeLog(fmt.Sprintf("[Update] Download failed: %v", err))
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Failed to download update: " + err.Error(),
+			"error":   a.tr("update_download_failed", err),
 		}
 	}
-	
-	a.AddToLogBuffer("Update downloaded to: " + tempFile)
-	
-	// Get current executable path
+
+	// Size is checked right away, so a broken download is reported before the user applies it
+	if err := VerifyUpdateFile(path, info, ""); err != nil {
+		os.Remove(path)
+		a.writeLog(fmt.Sprintf("[Update] Downloaded file rejected: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_file_corrupted", err),
+		}
+	}
+
+	a.updateMu.Lock()
+	a.updateFile = path
+	a.updateMu.Unlock()
+
+	a.writeLog(fmt.Sprintf("[Update] Version %s downloaded to %s", info.Version, path))
+	a.AddToLogBuffer(fmt.Sprintf("Обновление %s загружено", info.Version))
+	return map[string]interface{}{
+		"success": true,
+		"version": info.Version,
+		"path":    path,
+	}
+}
+
+// ApplyUpdate verifies the downloaded update (size and the SHA256 of the
+// release; a release without one is refused), stops the VPN and restarts the
+// app into the new version. The exe is swapped by a script after this process
+// exits (API для фронтенда)
+func (a *App) ApplyUpdate() map[string]interface{} {
+	a.updateMu.Lock()
+	info := a.updateInfo
+	path := a.updateFile
+	a.updateMu.Unlock()
+
+	if info == nil || path == "" || !fileExists(path) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_not_downloaded"),
+		}
+	}
+
+	// An update is never installed unverified
+	expected, err := ExpectedUpdateChecksum(info)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Update] Checksum unavailable: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_checksum_failed", err),
+		}
+	}
+	if err := VerifyUpdateFile(path, info, expected); err != nil {
+		os.Remove(path)
+		a.updateMu.Lock()
+		a.updateFile = ""
+		a.updateMu.Unlock()
+		a.writeLog(fmt.Sprintf("[Update] Verification failed: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("update_verify_failed", err),
+		}
+	}
+
 	execPath, err := os.Executable()
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Failed to get executable path: " + err.Error(),
+			"error":   a.tr("exe_path_failed", err),
 		}
 	}
-	
-	// Create update script that will replace the executable after app closes
-	updateScript := filepath.Join(os.TempDir(), "kampus_update.bat")
-	scriptContent := fmt.Sprintf(`@echo off
-timeout /t 2 /nobreak > nul
-copy /y "%s" "%s"
-del "%s"
-start "" "%s"
-del "%%~f0"
-`, tempFile, execPath, tempFile, execPath)
-	
-	if err := os.WriteFile(updateScript, []byte(scriptContent), 0755); err != nil {
+
+	scriptPath, err := writeUpdateScript(path, execPath, os.Getpid())
+	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Failed to create update script: " + err.Error(),
+			"error":   a.tr("update_script_create_failed", err),
 		}
 	}
-	
-	// Run the update script
-	cmd := exec.Command("cmd", "/C", "start", "/b", updateScript)
+
+	cmd := exec.Command("cmd", "/C", "start", "/b", scriptPath)
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
 	if err := cmd.Start(); err != nil {
+		os.Remove(scriptPath)
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Failed to start update script: " + err.Error(),
+			"error":   a.tr("update_script_start_failed", err),
 		}
 	}
-	
-	a.AddToLogBuffer("Update script started, restarting app...")
-	
-	// Quit the app
+
+	// The script waits for this process to exit before touching the exe
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		a.Stop()
+	}
+	a.writeLog(fmt.Sprintf("[Update] Restarting into version %s (sha256 %s verified)", info.Version, expected))
+	a.AddToLogBuffer("Обновление будет установлено после перезапуска")
+
 	go func() {
 		time.Sleep(500 * time.Millisecond)
 		wailsRuntime.Quit(a.ctx)
 	}()
-	
+
 	return map[string]interface{}{
 		"success": true,
-		"message": "Update downloaded, app will restart",
+		"version": info.Version,
+		"message": a.tr("update_restarting"),
+	}
+}
+
+// GetCoreInfo returns the version of the sing-box binary in use and whether
+// the config generator supports it (API для фронтенда)
+func (a *App) GetCoreInfo() map[string]interface{} {
+	a.waitForInit()
+
+	info, err := ReadCoreInfo(a.singboxPath)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_info_failed", err),
+		}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"core":    info,
+	}
+}
+
+// UpdateCore downloads the latest sing-box for windows-amd64 next to the
+// working binary and swaps it in; while VPN is running the swap waits for
+// the next connect. The previous binary is kept for RollbackCore (API для фронтенда)
+func (a *App) UpdateCore() map[string]interface{} {
+	a.waitForInit()
+
+	if a.singboxPath == "" || !fileExists(a.singboxPath) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("singbox_not_found"),
+		}
+	}
+
+	a.coreUpdateMu.Lock()
+	defer a.coreUpdateMu.Unlock()
+
+	current, err := ReadCoreInfo(a.singboxPath)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_info_failed", err),
+		}
+	}
+
+	release, err := FetchLatestCoreRelease()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Core] Release check failed: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_update_check_failed", err),
+		}
+	}
+	if compareVersions(release.Version, current.Version) <= 0 && current.Compatible {
+		return map[string]interface{}{
+			"success": true,
+			"updated": false,
+			"version": current.Version,
+			"message": a.tr("core_up_to_date", current.Version),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("[Core] Downloading sing-box %s (%s)", release.Version, release.AssetName))
+	version, err := StageCore(release, a.singboxPath)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Core] Update to %s failed, keeping %s: %v", release.Version, current.Version, err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_update_failed", err),
+		}
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	if !running {
+		err = SwapStagedCore(a.singboxPath)
+	}
+	a.mu.Unlock()
+
+	if running {
+		a.writeLog(fmt.Sprintf("[Core] sing-box %s staged, installed on the next connect", version))
+		return map[string]interface{}{
+			"success": true,
+			"updated": false,
+			"staged":  version,
+			"message": a.tr("core_update_staged", version),
+		}
+	}
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Core] Swap to %s failed, keeping %s: %v", version, current.Version, err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_update_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("[Core] sing-box updated %s -> %s", current.Version, version))
+	a.AddToLogBuffer(fmt.Sprintf("Ядро sing-box обновлено: %s → %s", current.Version, version))
+	return map[string]interface{}{
+		"success":  true,
+		"updated":  true,
+		"version":  version,
+		"previous": current.Version,
+	}
+}
+
+// RollbackCore restores the sing-box binary replaced by the last core update
+// (API для фронтенда)
+func (a *App) RollbackCore() map[string]interface{} {
+	a.waitForInit()
+
+	a.coreUpdateMu.Lock()
+	defer a.coreUpdateMu.Unlock()
+
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_rollback_vpn_running"),
+		}
+	}
+	err := RollbackCore(a.singboxPath)
+	a.mu.Unlock()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_rollback_failed", err),
+		}
+	}
+
+	info, err := ReadCoreInfo(a.singboxPath)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("core_info_failed", err),
+		}
+	}
+	a.writeLog(fmt.Sprintf("[Core] sing-box rolled back to %s", info.Version))
+	return map[string]interface{}{
+		"success": true,
+		"core":    info,
+	}
+}
+
+// applyStagedCore installs a core staged while VPN was running. Must be
+// called with a.mu held before sing-box starts.
+func (a *App) applyStagedCore() {
+	staged, _ := coreSidePaths(a.singboxPath)
+	if !fileExists(staged) || !a.coreUpdateMu.TryLock() {
+		return
+	}
+	defer a.coreUpdateMu.Unlock()
+
+	if err := SwapStagedCore(a.singboxPath); err != nil {
+		a.writeLog(fmt.Sprintf("[Core] Staged sing-box not installed, keeping the current one: %v", err))
+		return
 	}
+	a.writeLog("[Core] Staged sing-box installed")
 }
 
 // GetAppVersion возвращает текущую версию приложения
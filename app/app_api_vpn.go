@@ -9,12 +9,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"runtime"
 	"strings"
-	"syscall"
-
-	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+	"time"
 )
 
 // getActiveConfigPath writes active config to file and returns the path.
@@ -23,6 +19,12 @@ func (a *App) getActiveConfigPath() (string, error) {
 	if a.storage == nil {
 		return "", fmt.Errorf("storage not initialized")
 	}
+	
+	// A warm standby config that still matches the profile is used as is
+	if path, ok := a.storage.ActiveStandbyConfigPath(); ok {
+		return path, nil
+	}
+	
 	return a.storage.WriteActiveConfigToFile()
 }
 
@@ -38,28 +40,68 @@ func (a *App) GetStatus() map[string]interface{} {
 	hasConfig := configPath != "" && fileExists(configPath)
 	
 	return map[string]interface{}{
-		"running":       a.isRunning,
-		"hasError":      a.hasError,
-		"configPath":    configPath,
-		"singboxPath":   a.singboxPath,
-		"configExists":  hasConfig,
-		"singboxExists": a.singboxPath != "" && fileExists(a.singboxPath),
-		"logPath":       a.logPath,
+		"running":         a.isRunning,
+		"hasError":        a.hasError,
+		"configPath":      configPath,
+		"singboxPath":     a.singboxPath,
+		"configExists":    hasConfig,
+		"singboxExists":   a.singboxPath != "" && fileExists(a.singboxPath),
+		"logPath":         a.logPath,
+		"resources":       a.getResourceUsage(),
+		"captivePortal":   a.getCaptivePortalStatus(),
+		"schedule":        a.getProfileScheduleStatus(),
+		"storage":         a.getStorageStatus(),
+		"readiness":       a.getReadinessStatus(),
+		"verified":        a.isConnectionVerified(),
+		"preflight":       a.getPreflightStatus(),
+		"lastCrash":       a.getLastCrashStatus(),
+		"trayOnly":        a.getTrayOnlyStatus(),
+		"directInterface": a.getDirectInterfaceStatus(),
+		"killSwitch":      a.getKillSwitchStatus(),
+		"inbound":         a.getInboundStatus(),
+		"clashAPI":        clashAPIAddress(),
+		"reconnect":       a.getReconnectStatus(),
+		"bypass":          a.getBypassStatus(),
+		"paused":          a.getPauseStatus(),
 	}
 }
 
 // Start starts VPN
 func (a *App) Start() map[string]interface{} {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+	return a.startVPN()
+}
+
+// startVPN starts VPN. Must be called with a.actionMu held.
+func (a *App) startVPN() map[string]interface{} {
 	// Wait for initialization
 	a.waitForInit()
 
+	// Connecting by hand ends a temporary bypass
+	a.cancelBypass("connected")
+
+	// Don't connect into a captive portal black hole (probe runs without holding the lock)
+	if portalResult := a.checkCaptivePortal(); portalResult != nil {
+		return portalResult
+	}
+
+	// Another VPN taking the default route leaves the TUN half-working
+	if conflictResult := a.checkConflictingVPNs(); conflictResult != nil {
+		return conflictResult
+	}
+
+	// Reconnecting lifts the kill switch; a new sing-box is about to take over.
+	// netsh runs before taking a.mu, a.actionMu keeps other actions out.
+	a.releaseKillSwitch()
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	if a.isRunning {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "VPN уже запущен",
+			"error":   a.tr("vpn_already_running"),
 		}
 	}
 
@@ -68,20 +110,57 @@ func (a *App) Start() map[string]interface{} {
 		UpdateTrayIcon("error")
 		return map[string]interface{}{
 			"success": false,
-			"error":   "sing-box не найден. Установите sing-box.",
+			"error":   a.tr("singbox_not_found"),
+		}
+	}
+
+	// A core downloaded while VPN was running is installed now
+	a.applyStagedCore()
+
+	// Pick the adapter for direct traffic before the config is written
+	a.bindDirectInterface()
+
+	// In proxy mode sing-box must be able to listen on the local proxy port
+	if a.storage != nil {
+		if settings := a.storage.GetAppSettings(); settings.EffectiveInboundMode() == InboundModeProxy {
+			if err := checkProxyPortFree(settings.EffectiveProxyInboundPort()); err != nil {
+				a.hasError = true
+				UpdateTrayIcon("error")
+				return map[string]interface{}{
+					"success": false,
+					"error":   a.tr("local_proxy_start_failed", err),
+				}
+			}
 		}
 	}
 
+	// Move the Clash API off 9090 if another program listens there
+	a.selectClashController()
+	a.selectSpeedTestPort()
+	a.selectDownloadPort()
+	a.selectUDPProbePort()
+
+	// Upgrade configs built by older app versions before use
+	if a.storage != nil {
+		a.migrateProfileConfig(a.storage.GetActiveProfileID())
+	}
+
 	configPath, err := a.getActiveConfigPath()
 	if err != nil || configPath == "" {
 		a.hasError = true
 		UpdateTrayIcon("error")
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Конфиг не найден. Добавьте подписку для текущего профиля.",
+			"error":   a.tr("config_missing"),
 		}
 	}
 
+	// Mask credentials of this profile in sing-box output
+	a.updateLogScrubber()
+
+	// Resolve proxy servers for the kill switch while DNS still works
+	a.prepareKillSwitch()
+
 	// Open log file
 	if err := a.openLogFile(); err != nil {
 		a.writeLog(fmt.Sprintf("Warning: could not open log file: %v", err))
@@ -104,73 +183,107 @@ func (a *App) Start() map[string]interface{} {
 	a.writeLog(fmt.Sprintf("Starting sing-box: %s", a.singboxPath))
 	a.writeLog(fmt.Sprintf("Config: %s", configPath))
 	a.writeLog(fmt.Sprintf("Log level: %s", logLevel))
+	a.effectiveLogLevel = LogLevel(logLevel)
 
-	// Start sing-box with config for current profile
-	a.cmd = exec.Command(a.singboxPath, "run", "-c", configPath)
-
+	// Start sing-box with config for current profile (through the service if installed)
 	// WireGuard is now handled by Native WireGuard Manager, not sing-box
-	// No need for ENABLE_DEPRECATED_WIREGUARD_OUTBOUND
-
-	// Get stdout and stderr for logging
-	stdout, _ := a.cmd.StdoutPipe()
-	stderr, _ := a.cmd.StderrPipe()
-
-	// Hide console window on Windows
-	if runtime.GOOS == "windows" {
-		a.cmd.SysProcAttr = &syscall.SysProcAttr{
-			HideWindow:    true,
-			CreationFlags: 0x08000000, // CREATE_NO_WINDOW
-		}
-	}
-
-	// Set working directory to resources folder
-	if a.storage != nil {
-		a.cmd.Dir = a.storage.GetResourcesPath()
-	} else {
-		a.cmd.Dir = a.basePath
-	}
-
-	if err := a.cmd.Start(); err != nil {
+	launchedAt := time.Now()
+	proc, stdout, stderr, err := a.launchSingbox(configPath)
+	if err != nil {
 		a.hasError = true
 		UpdateTrayIcon("error")
 		a.writeLog(fmt.Sprintf("ERROR: Failed to start: %v", err))
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка запуска: %v", err),
+			"error":   a.tr("start_failed", err),
 		}
 	}
+	a.singbox = proc
 
 	a.isRunning = true
 	a.hasError = false
-	UpdateTrayIcon("connected")
+	a.startedAt = time.Now()
 	a.writeLog("VPN started successfully")
+	a.enableDownloadRoute()
 	a.AddToLogBuffer("VPN запущен")
 
+	// "Connected" only after a request through the proxy succeeds
+	a.startPreflight()
+
 	// Start Native WireGuard tunnels (internal/corporate VPNs)
 	if a.nativeWG != nil && a.nativeWG.IsInstalled() {
 		a.startNativeWireGuardTunnels()
 	}
-
+	
 	// Start tracking traffic statistics
 	if a.trafficStats != nil {
-		a.trafficStats.StartSession()
+		if profile, err := a.storage.GetActiveProfile(); err == nil {
+			a.trafficStats.StartSession(profile.ID, profile.Name)
+		} else {
+			a.trafficStats.StartSession(0, "")
+		}
 	}
 
+	// Pick the fastest server before the connection is reported as ready
+	a.startConnectMeasurement()
+
+	// Profile readiness criteria hold the "connected" state until they pass
+	a.startReadinessCheck()
+	
+	// Count which resolver answers WireGuard internal domains
+	a.startDNSResolutionTracking()
+
+	// Start connection quality prober if enabled
+	a.startProber()
+
+	// Delay history of the current proxy while the window is open
+	a.startLatencySampler()
+
+	// Test the current server's throughput if enabled
+	a.startSpeedMonitor()
+
+	// Count traffic per outbound and domain
+	if a.trafficBreakdown != nil {
+		a.trafficBreakdown.StartPolling()
+	}
+
+	// Sample sing-box memory/CPU usage
+	a.startResourceMonitor(proc.Pid(), launchedAt)
+
+	// Reconnect when the bound adapter goes away
+	a.startInterfaceWatch()
+
+	// Drop connections and re-handshake tunnels after the network changed
+	a.startNetworkWatch()
+
+	// Find proxies that don't relay UDP
+	a.startUDPProbe()
+
 	// Log output in goroutines
-	go a.logOutput(stdout, "OUT")
-	go a.logOutput(stderr, "ERR")
+	go a.logOutput(stdout, LogSourceOut)
+	go a.logOutput(stderr, LogSourceErr)
 
 	// Monitor process in goroutine
 	go func() {
-		err := a.cmd.Wait()
+		defer a.crash.Guard("vpn-monitor")
+		
+		err := proc.Wait()
 		a.mu.Lock()
 		wasStoppedManually := a.stoppedManually
 		a.isRunning = false
 		a.stoppedManually = false
+		a.noteSessionEnded()
+		reconnect := !wasStoppedManually && err != nil && a.autoReconnectEnabled()
 
 		// End traffic session
 		if a.trafficStats != nil {
-			a.trafficStats.EndSession()
+			reason := DisconnectReasonExit
+			if wasStoppedManually {
+				reason = DisconnectReasonUser
+			} else if err != nil {
+				reason = DisconnectReasonError
+			}
+			a.trafficStats.EndSession(reason)
 			a.trafficStats.Save()
 		}
 
@@ -178,6 +291,18 @@ func (a *App) Start() map[string]interface{} {
 		// This prevents orphaned tunnels that block user's native WireGuard
 		a.mu.Unlock() // Unlock before calling stopNativeWireGuardTunnels to avoid deadlock
 		a.stopNativeWireGuardTunnels()
+		a.stopProber()
+		a.stopLatencySampler()
+		a.endPause("stopped")
+		a.stopSpeedMonitor()
+		a.disableDownloadRoute()
+		a.stopTrafficBreakdown()
+		a.stopResourceMonitor()
+		a.stopReadinessCheck()
+		a.stopPreflight()
+		a.stopInterfaceWatch()
+		a.stopNetworkWatch()
+		a.stopUDPProbe()
 		a.mu.Lock()
 
 		if wasStoppedManually {
@@ -185,33 +310,53 @@ func (a *App) Start() map[string]interface{} {
 			a.writeLog("VPN stopped by user")
 			a.AddToLogBuffer("VPN остановлен пользователем")
 			UpdateTrayIcon("disconnected")
+			a.notify("Kampus VPN", "VPN отключён")
 		} else if err != nil {
 			a.hasError = true
 			a.writeLog(fmt.Sprintf("VPN process exited with error: %v", err))
-			a.AddToLogBuffer(fmt.Sprintf("VPN завершился с ошибкой: %v", err))
+			a.addLogEntry(LogSourceApp, LogLevelError, fmt.Sprintf("VPN завершился с ошибкой: %v", err))
 			UpdateTrayIcon("error")
+			a.notify("VPN неожиданно отключился", fmt.Sprintf("sing-box завершился с ошибкой: %v", err))
 		} else {
 			a.writeLog("VPN process exited normally")
 			a.AddToLogBuffer("VPN завершил работу")
 			UpdateTrayIcon("disconnected")
+			a.notify("Kampus VPN", "VPN отключён")
 		}
 		a.closeLogFile()
 		a.mu.Unlock()
+
+		if !wasStoppedManually {
+			// The user didn't disconnect: don't let traffic fall back to the raw connection
+			a.engageKillSwitch()
+		}
 		// Notify frontend about status change
-		wailsRuntime.EventsEmit(a.ctx, "vpn-status-changed", false)
+		a.emitEvent("vpn-status-changed", false)
+
+		if reconnect {
+			a.scheduleReconnect(err)
+		}
 	}()
 
 	return map[string]interface{}{
-		"success": true,
+		"success":    true,
+		"killSwitch": a.getKillSwitchStatus(),
 	}
 }
 
 // logOutput reads and logs process output
 func (a *App) logOutput(reader io.Reader, prefix string) {
+	defer a.crash.Guard("log-reader-" + prefix)
+	
 	a.writeLog(fmt.Sprintf("[%s] Log reader started", prefix))
+	a.mu.Lock()
+	dnsTracker := a.dnsTracker
+	a.mu.Unlock()
+	
 	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		line := scanner.Text()
+		dnsTracker.Observe(line)
 
 		// Check logging setting from storage
 		loggingEnabled := true
@@ -225,29 +370,28 @@ func (a *App) logOutput(reader io.Reader, prefix string) {
 		}
 
 		// Add to log buffer for UI (always)
-		a.AddToLogBuffer(fmt.Sprintf("[%s] %s", prefix, line))
+		level, message := parseSingboxLogLine(line)
+		a.addLogEntry(prefix, level, message)
 
-		// Check for critical errors only (not normal network errors)
+		// Only error level and worse can be critical; rule-set failures aren't
+		// (sing-box continues without them)
 		lineLower := strings.ToLower(line)
-		
-		// Определяем действительно критические ошибки
-		isCriticalError := strings.Contains(lineLower, "fatal") &&
-			// Но не ошибки rule-set (можно продолжить без них)
-			!strings.Contains(lineLower, "rule-set")
+		isCriticalError := (level == LogLevelFatal || level == LogLevelPanic ||
+			level == LogLevelError) && !strings.Contains(lineLower, "rule-set")
 		
 		// Игнорируем обычные сетевые ошибки (не критичны):
 		// - IPv6 unreachable (нет IPv6 - норма)
 		// - DNS resolution failures
 		// - Connection refused/timeout
 		// - Network unreachable для отдельных соединений
-		isIgnorableError := strings.Contains(lineLower, "unreachable network") ||
+		isIgnorableError := level == LogLevelError && (strings.Contains(lineLower, "unreachable network") ||
 			strings.Contains(lineLower, "dns: exchange failed") ||
 			strings.Contains(lineLower, "context deadline exceeded") ||
 			strings.Contains(lineLower, "connection refused") ||
 			strings.Contains(lineLower, "i/o timeout") ||
 			strings.Contains(lineLower, "network is unreachable") ||
 			strings.Contains(lineLower, "no route to host") ||
-			strings.Contains(lineLower, "connectex:")
+			strings.Contains(lineLower, "connectex:"))
 		
 		if isCriticalError && !isIgnorableError {
 			a.mu.Lock()
@@ -265,18 +409,47 @@ func (a *App) logOutput(reader io.Reader, prefix string) {
 
 // Stop stops VPN
 func (a *App) Stop() map[string]interface{} {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+	return a.stopVPN()
+}
+
+// stopVPN stops VPN. Must be called with a.actionMu held.
+func (a *App) stopVPN() map[string]interface{} {
+	// Disconnect also cancels auto-connect after captive portal login
+	a.clearCaptivePortal()
+	// ...and a pending reconnect after a crash
+	a.cancelReconnect()
+	// ...and reconnecting after a temporary bypass
+	a.cancelBypass("disconnected")
+
+	a.terminateSingbox()
+
+	// sing-box may have died already: disconnecting always lifts the kill switch.
+	// netsh runs without a.mu, a.actionMu keeps other actions out.
+	a.releaseKillSwitch()
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	return map[string]interface{}{
+		"success":    true,
+		"killSwitch": a.getKillSwitchStatus(),
+	}
+}
 
-	if !a.isRunning || a.cmd == nil || a.cmd.Process == nil {
+// terminateSingbox stops sing-box and the tunnels of the session.
+// Must be called with a.actionMu held.
+func (a *App) terminateSingbox() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isRunning || a.singbox == nil {
 		a.isRunning = false
 		a.stoppedManually = false
 		// Also stop Native WireGuard tunnels
 		a.stopNativeWireGuardTunnels()
 		UpdateTrayIcon("disconnected")
-		return map[string]interface{}{
-			"success": true,
-		}
+		return
 	}
 
 	a.writeLog("Stopping VPN...")
@@ -284,36 +457,41 @@ func (a *App) Stop() map[string]interface{} {
 	// Stop Native WireGuard tunnels first
 	a.stopNativeWireGuardTunnels()
 
+	// Return auto-select to the selector so the pin isn't saved in cache.db
+	a.unpinMeasuredServer()
+
+	// Last poll before the Clash API goes away
+	a.stopTrafficBreakdown()
+
+	// A pending check must not turn the tray green again
+	a.stopPreflight()
+
 	// Set manual stop flag BEFORE terminating process
 	a.stoppedManually = true
+	a.killSwitchAddrs = nil
 
 	// Terminate process
-	if runtime.GOOS == "windows" {
-		// On Windows use taskkill for proper termination
-		// Hide console window
-		killCmd := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", a.cmd.Process.Pid))
-		killCmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-		killCmd.Run()
-	} else {
-		// On Unix send SIGTERM
-		a.cmd.Process.Signal(syscall.SIGTERM)
+	if err := a.singbox.Stop(); err != nil {
+		a.writeLog(fmt.Sprintf("Warning: could not stop sing-box: %v", err))
 	}
 
 	a.hasError = false
 	// DO NOT set isRunning = false here, goroutine will do it
 	// DO NOT call UpdateTrayIcon here, goroutine will do it
-
-	return map[string]interface{}{
-		"success": true,
-	}
 }
 
 // Toggle toggles VPN state
 func (a *App) Toggle() map[string]interface{} {
-	if a.isRunning {
-		return a.Stop()
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		return a.stopVPN()
 	}
-	return a.Start()
+	return a.startVPN()
 }
 
 // CanModifyVPN checks if VPN settings can be modified
@@ -323,7 +501,7 @@ func (a *App) CanModifyVPN() map[string]interface{} {
 
 	return map[string]interface{}{
 		"canModify": !a.isRunning,
-		"message":   "Сначала отключите VPN для изменения настроек",
+		"message":   a.tr("vpn_active_settings"),
 	}
 }
 
@@ -352,7 +530,7 @@ func (a *App) updateConfigLogLevel(configPath, logLevel string) error {
 	}
 
 	// Write back
-	newData, err := json.MarshalIndent(config, "", "  ")
+	newData, err := MarshalCanonicalJSONIndent(config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -393,41 +571,100 @@ func (a *App) startNativeWireGuardTunnels() {
 	
 	a.writeLog(fmt.Sprintf("Starting %d Native WireGuard tunnel(s)...", len(settings.WireGuardConfigs)))
 	
-	// Set up restart callback for health check
-	a.nativeWG.SetTunnelRestartCallback(func(configID int) {
-		a.writeLog(fmt.Sprintf("[WireGuard] Tunnel %d was restarted by health check", configID))
-		a.AddToLogBuffer(fmt.Sprintf("WireGuard туннель %d: переподключен", configID))
-		// Emit event to frontend
-		wailsRuntime.EventsEmit(a.ctx, "wireguard-tunnel-restarted", configID)
-	})
+	// Conflicting configs are skipped so the rest of the profile still connects
+	conflicts := FindWireGuardConflicts(settings.WireGuardConfigs)
 	
 	started := 0
 	for i, wg := range settings.WireGuardConfigs {
 		a.writeLog(fmt.Sprintf("[WireGuard] Processing config %d: tag=%s, name=%s, endpoint=%s, allowedIPs=%v", 
 			i, wg.Tag, wg.Name, wg.Endpoint, wg.AllowedIPs))
 		
+		if conflict := conflicts[i]; conflict != nil {
+			a.reportSkippedTunnel(conflict)
+			continue
+		}
+		
 		nativeConfig := wg.ToWireGuardConfig()
 		a.writeLog(fmt.Sprintf("[WireGuard] Native config: Address=%v, DNS=%s, Peers=%d", 
 			nativeConfig.Address, nativeConfig.DNS, len(nativeConfig.Peers)))
 		
 		if err := a.nativeWG.StartTunnel(i, nativeConfig); err != nil {
+			if conflict, ok := classifyTunnelStartError(wg.Tag, err).(*WireGuardConflictError); ok {
+				a.reportSkippedTunnel(conflict)
+				continue
+			}
 			a.writeLog(fmt.Sprintf("[WireGuard] Failed to start %s: %v", wg.Tag, err))
 			a.AddToLogBuffer(fmt.Sprintf("WireGuard %s: ошибка запуска", wg.Name))
 		} else {
 			started++
 			a.AddToLogBuffer(fmt.Sprintf("WireGuard %s: подключен", wg.Name))
+			
+			// PostUp scripts run only with explicit user consent
+			if scripts := wg.ConsentedPostUp(); len(scripts) > 0 {
+				RunWireGuardScripts(runHiddenCommand, scripts, fmt.Sprintf("%s%d", TunnelPrefix, i), a.writeLog)
+			}
 		}
 	}
 	
 	if started > 0 {
 		a.writeLog(fmt.Sprintf("[WireGuard] Started %d/%d tunnels", started, len(settings.WireGuardConfigs)))
 		
-		// Start health check monitoring
-		a.nativeWG.StartHealthCheck()
-		a.writeLog("[WireGuard] Health check monitoring started")
+		a.startWireGuardHealthCheck()
 	}
 }
 
+// startWireGuardHealthCheck starts monitoring of running tunnels; a no-op if already running
+func (a *App) startWireGuardHealthCheck() {
+	// Set up restart callback for health check
+	a.nativeWG.SetTunnelRestartCallback(func(configID int) {
+		a.writeLog(fmt.Sprintf("[WireGuard] Tunnel %d was restarted by health check", configID))
+		a.AddToLogBuffer(fmt.Sprintf("WireGuard туннель %d: переподключен", configID))
+		// Emit event to frontend
+		a.emitEvent("wireguard-tunnel-restarted", configID)
+		a.kickReadiness()
+	})
+	a.nativeWG.SetHealthChangeCallback(a.onWireGuardHealthChange)
+	
+	// Start health check monitoring
+	a.nativeWG.StartHealthCheck()
+	a.writeLog("[WireGuard] Health check monitoring started")
+}
+
+// onWireGuardHealthChange reports a tunnel becoming unhealthy or recovering to the frontend
+func (a *App) onWireGuardHealthChange(configID int, healthy bool, lastHandshake time.Time) {
+	handshake := "never"
+	if !lastHandshake.IsZero() {
+		handshake = lastHandshake.Format(time.RFC3339)
+	}
+	a.writeLog(fmt.Sprintf("[WireGuard] Tunnel %d healthy=%v (last handshake: %s)", configID, healthy, handshake))
+	if healthy {
+		a.AddToLogBuffer(fmt.Sprintf("WireGuard туннель %d: соединение восстановлено", configID))
+	} else {
+		a.addLogEntry(LogSourceWireGuard, LogLevelWarn, fmt.Sprintf("WireGuard туннель %d: нет рукопожатия", configID))
+		a.notify("WireGuard туннель не отвечает", fmt.Sprintf("Туннель %d: нет рукопожатия с сервером", configID))
+	}
+	a.emitEvent("wireguard-health-changed", map[string]interface{}{
+		"config_id":      configID,
+		"healthy":        healthy,
+		"last_handshake": handshake,
+	})
+	a.kickReadiness()
+}
+
+// stopTrafficBreakdown stops polling connections and saves the daily rollups
+func (a *App) stopTrafficBreakdown() {
+	if a.trafficBreakdown != nil {
+		a.trafficBreakdown.StopPolling()
+	}
+}
+
+// reportSkippedTunnel logs a tunnel skipped because of a conflict and notifies the frontend
+func (a *App) reportSkippedTunnel(conflict *WireGuardConflictError) {
+	a.writeLog(fmt.Sprintf("[WireGuard] Skipped %s: %s", conflict.Tag, conflict.Error()))
+	a.AddToLogBuffer(fmt.Sprintf("WireGuard %s пропущен: %s", conflict.Tag, conflict.Error()))
+	a.emitEvent("wireguard-tunnel-skipped", conflict.ToMap())
+}
+
 // stopNativeWireGuardTunnels stops all Native WireGuard tunnels
 func (a *App) stopNativeWireGuardTunnels() {
 	if a.nativeWG == nil {
@@ -437,6 +674,17 @@ func (a *App) stopNativeWireGuardTunnels() {
 	// Stop health check first
 	a.nativeWG.StopHealthCheck()
 	
+	// Run PostDown scripts (only consented ones) before tunnels go down
+	if a.storage != nil {
+		if settings, err := a.storage.GetUserSettings(); err == nil {
+			for i, wg := range settings.WireGuardConfigs {
+				if scripts := wg.ConsentedPostDown(); len(scripts) > 0 && a.nativeWG.IsTunnelActive(i) {
+					RunWireGuardScripts(runHiddenCommand, scripts, fmt.Sprintf("%s%d", TunnelPrefix, i), a.writeLog)
+				}
+			}
+		}
+	}
+	
 	a.writeLog("Stopping Native WireGuard tunnels...")
 	a.nativeWG.StopAllTunnels()
 	a.writeLog("Native WireGuard tunnels stopped")
@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // GetWireGuardList возвращает список WireGuard конфигов
@@ -16,7 +17,7 @@ func (a *App) GetWireGuardList() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 			"configs": []WireGuardInfo{},
 		}
 	}
@@ -35,11 +36,15 @@ func (a *App) GetWireGuardList() map[string]interface{} {
 		configs = append(configs, wg.ToInfo())
 	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"success": true,
 		"configs": configs,
 		"count":   len(configs),
 	}
+	if errs := wireGuardSecretErrors(settings.WireGuardConfigs); len(errs) > 0 {
+		result["secret_errors"] = errs
+	}
+	return result
 }
 
 // GetWireGuardHealth возвращает статус здоровья WireGuard туннелей
@@ -49,7 +54,7 @@ func (a *App) GetWireGuardHealth() map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard не инициализирован",
+			"error":   a.tr("wireguard_not_initialized"),
 			"tunnels": []map[string]interface{}{},
 		}
 	}
@@ -57,6 +62,25 @@ func (a *App) GetWireGuardHealth() map[string]interface{} {
 	tunnels := a.nativeWG.GetTunnelHealthStatus()
 	status := a.nativeWG.GetStatus()
 	
+	// Formatted uptime and transfer in the UI language (raw values are kept)
+	lang := a.uiLanguage()
+	for _, tunnel := range tunnels {
+		if seconds, ok := tunnel["uptime_seconds"].(int64); ok {
+			tunnel["uptime_text"] = FormatDurationLocalized(time.Duration(seconds)*time.Second, lang)
+		}
+		configID, _ := tunnel["config_id"].(int)
+		if stats, err := a.nativeWG.GetTunnelStats(configID); err == nil {
+			if received, ok := stats["received_bytes"].(int64); ok {
+				tunnel["received_bytes"] = received
+				tunnel["received_text"] = FormatBytesLocalized(received, lang)
+			}
+			if sent, ok := stats["sent_bytes"].(int64); ok {
+				tunnel["sent_bytes"] = sent
+				tunnel["sent_text"] = FormatBytesLocalized(sent, lang)
+			}
+		}
+	}
+	
 	return map[string]interface{}{
 		"success":        true,
 		"tunnels":        tunnels,
@@ -66,6 +90,34 @@ func (a *App) GetWireGuardHealth() map[string]interface{} {
 	}
 }
 
+// GetWireGuardStats returns numeric transfer of all active tunnels with the
+// deltas since the previous call, for the throughput chart (API для фронтенда)
+func (a *App) GetWireGuardStats() map[string]interface{} {
+	a.waitForInit()
+
+	if a.nativeWG == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("wireguard_not_initialized"),
+			"tunnels": []WireGuardTunnelStats{},
+		}
+	}
+
+	tunnels := a.nativeWG.CollectTunnelStats()
+	var rxRate, txRate int64
+	for _, tunnel := range tunnels {
+		rxRate += tunnel.RxRate
+		txRate += tunnel.TxRate
+	}
+	return map[string]interface{}{
+		"success":   true,
+		"tunnels":   tunnels,
+		"rx_rate":   rxRate,
+		"tx_rate":   txRate,
+		"timestamp": time.Now().Unix(),
+	}
+}
+
 // ParseWireGuardConfigAPI парсит WireGuard конфиг и возвращает результат
 func (a *App) ParseWireGuardConfigAPI(configText string) map[string]interface{} {
 	wg, err := ParseWireGuardConfig(configText)
@@ -76,37 +128,80 @@ func (a *App) ParseWireGuardConfigAPI(configText string) map[string]interface{}
 		}
 	}
 
-	endpoint := wg.Endpoint
-	if wg.EndpointPort > 0 {
-		endpoint = fmt.Sprintf("%s:%d", wg.Endpoint, wg.EndpointPort)
-	}
+	endpoint := wg.EndpointAddress()
 
 	return map[string]interface{}{
 		"success":              true,
-		"private_key":          wg.PrivateKey,
+		"private_key":          wg.PrivateKey.Value(),
 		"local_address":        wg.LocalAddress,
 		"dns":                  wg.DNS,
 		"mtu":                  wg.MTU,
 		"public_key":           wg.PublicKey,
-		"preshared_key":        wg.PresharedKey,
+		"preshared_key":        wg.PresharedKey.Value(),
 		"allowed_ips":          wg.AllowedIPs,
 		"endpoint":             endpoint,
 		"endpoint_port":        wg.EndpointPort,
 		"persistent_keepalive": wg.PersistentKeepalive,
+		"post_up":              wg.PostUp,
+		"post_down":            wg.PostDown,
+		"has_scripts":          wg.HasScripts(),
 	}
 }
 
 // AddWireGuard добавляет новый WireGuard конфиг
 func (a *App) AddWireGuard(tag string, name string, configText string) map[string]interface{} {
 	a.waitForInit()
-	
+
+	// Парсим конфиг
+	wg, err := ParseWireGuardConfig(configText)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("config_parse_failed", err),
+		}
+	}
+	return a.addWireGuard(tag, name, wg)
+}
+
+// AddWireGuardFromFields добавляет WireGuard конфиг, введённый по полям, а не текстом .conf
+func (a *App) AddWireGuardFromFields(tag string, name string, fields WireGuardFields) map[string]interface{} {
+	a.waitForInit()
+
+	wg, err := NewWireGuardConfigFromFields(fields)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return a.addWireGuard(tag, name, wg)
+}
+
+// GenerateWireGuardKeys генерирует пару ключей для нового пира (API для фронтенда)
+func (a *App) GenerateWireGuardKeys() map[string]interface{} {
+	keys, err := GenerateWireGuardKeyPair()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"success":     true,
+		"private_key": keys.PrivateKey,
+		"public_key":  keys.PublicKey,
+	}
+}
+
+// addWireGuard проверяет и добавляет конфиг в активный профиль
+func (a *App) addWireGuard(tag string, name string, wg *UserWireGuardConfig) map[string]interface{} {
 	// Проверяем что VPN выключен
 	a.mu.Lock()
 	if a.isRunning {
 		a.mu.Unlock()
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нельзя добавлять VPN пока соединение активно. Сначала отключите VPN.",
+			"error":   a.tr("vpn_active_add"),
 		}
 	}
 	a.mu.Unlock()
@@ -114,24 +209,53 @@ func (a *App) AddWireGuard(tag string, name string, configText string) map[strin
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
-	// Валидируем тег
-	if err := ValidateTag(tag); err != nil {
+	// Загружаем текущие настройки
+	settings, err := a.storage.GetUserSettings()
+	if err != nil {
 		return map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
 		}
 	}
 
-	// Парсим конфиг
-	wg, err := ParseWireGuardConfig(configText)
-	if err != nil {
+	if failure := a.checkNewWireGuard(tag, name, wg, settings.WireGuardConfigs); failure != nil {
+		return failure
+	}
+
+	// Добавляем конфиг
+	settings.WireGuardConfigs = append(settings.WireGuardConfigs, *wg)
+
+	// Перегенерируем конфиг
+	if err := a.configBuilder.BuildConfigForProfile(a.storage.GetActiveProfileID(), settings.SubscriptionURL, settings.WireGuardConfigs); err != nil {
+		return a.rebuildErrorResult(err)
+	}
+
+	result := map[string]interface{}{
+		"success":  true,
+		"count":    len(settings.WireGuardConfigs),
+		"warnings": a.activeBuildWarnings(),
+	}
+	if wg.HasScripts() {
+		// Скрипты сохранены, но выключены до явного согласия (SetWireGuardAllowScripts)
+		result["scripts_require_consent"] = true
+		result["post_up"] = wg.PostUp
+		result["post_down"] = wg.PostDown
+	}
+	return result
+}
+
+// checkNewWireGuard проверяет новый конфиг против конфигов профиля (тег, AllowedIPs,
+// лимит, уникальность, конфликты) и задаёт ему тег и имя. nil если конфиг можно добавить.
+func (a *App) checkNewWireGuard(tag string, name string, wg *UserWireGuardConfig, existingConfigs []UserWireGuardConfig) map[string]interface{} {
+	// Валидируем тег
+	if err := ValidateTag(tag); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка парсинга конфига: %v", err),
+			"error":   err.Error(),
 		}
 	}
 
@@ -149,48 +273,43 @@ func (a *App) AddWireGuard(tag string, name string, configText string) map[strin
 		wg.Name = tag
 	}
 
-	// Загружаем текущие настройки
-	settings, err := a.storage.GetUserSettings()
-	if err != nil {
-		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		}
-	}
-
 	// Проверяем лимит
-	if len(settings.WireGuardConfigs) >= MaxWireGuardConfigs {
+	if len(existingConfigs) >= MaxWireGuardConfigs {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Достигнут лимит WireGuard конфигов (%d)", MaxWireGuardConfigs),
+			"error":   a.tr("wireguard_limit_reached", MaxWireGuardConfigs),
 		}
 	}
 
 	// Проверяем уникальность тега
-	for _, existing := range settings.WireGuardConfigs {
+	for _, existing := range existingConfigs {
 		if existing.Tag == tag {
 			return map[string]interface{}{
 				"success": false,
-				"error":   fmt.Sprintf("Конфиг с тегом '%s' уже существует", tag),
+				"error":   a.tr("wireguard_tag_exists", tag),
 			}
 		}
 	}
 
-	// Добавляем конфиг
-	settings.WireGuardConfigs = append(settings.WireGuardConfigs, *wg)
-
-	// Перегенерируем конфиг
-	if err := a.configBuilder.BuildConfigForProfile(a.storage.GetActiveProfileID(), settings.SubscriptionURL, settings.WireGuardConfigs); err != nil {
+	// Проверяем конфликты адресов/ключей с другими конфигами профиля
+	if conflict := FindWireGuardConflict(*wg, existingConfigs); conflict != nil {
 		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
+			"success":  false,
+			"error":    conflict.Error(),
+			"conflict": conflict.ToMap(),
 		}
 	}
 
-	return map[string]interface{}{
-		"success": true,
-		"count":   len(settings.WireGuardConfigs),
+	// Сети конфига не должны пересекаться с подсетью TUN из template.json
+	if conflict := FindTUNConflict(*wg, templateTUNSubnets(a.storage.GetTemplatePath())); conflict != nil {
+		return map[string]interface{}{
+			"success":  false,
+			"error":    conflict.Error(),
+			"conflict": conflict.ToMap(),
+		}
 	}
+
+	return nil
 }
 
 // UpdateWireGuard обновляет существующий WireGuard конфиг
@@ -203,7 +322,7 @@ func (a *App) UpdateWireGuard(oldTag string, tag string, name string, configText
 		a.mu.Unlock()
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нельзя редактировать VPN пока соединение активно. Сначала отключите VPN.",
+			"error":   a.tr("vpn_active_edit"),
 		}
 	}
 	a.mu.Unlock()
@@ -211,7 +330,7 @@ func (a *App) UpdateWireGuard(oldTag string, tag string, name string, configText
 	if a.configBuilder == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "ConfigBuilder не инициализирован",
+			"error":   a.tr("config_builder_not_initialized"),
 		}
 	}
 
@@ -228,7 +347,7 @@ func (a *App) UpdateWireGuard(oldTag string, tag string, name string, configText
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка парсинга конфига: %v", err),
+			"error":   a.tr("config_parse_failed", err),
 		}
 	}
 
@@ -265,11 +384,16 @@ func (a *App) UpdateWireGuard(oldTag string, tag string, name string, configText
 					if other.Tag == tag {
 						return map[string]interface{}{
 							"success": false,
-							"error":   fmt.Sprintf("Конфиг с тегом '%s' уже существует", tag),
+							"error":   a.tr("wireguard_tag_exists", tag),
 						}
 					}
 				}
 			}
+			// Согласие на скрипты сохраняется, только если команды не изменились
+			if existing.AllowScripts && equalStringSlices(existing.PostUp, wg.PostUp) && equalStringSlices(existing.PostDown, wg.PostDown) {
+				wg.AllowScripts = true
+			}
+			wg.AutoMTU = existing.AutoMTU
 			settings.WireGuardConfigs[i] = *wg
 			found = true
 			break
@@ -279,21 +403,44 @@ func (a *App) UpdateWireGuard(oldTag string, tag string, name string, configText
 	if !found {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Конфиг с тегом '%s' не найден", oldTag),
+			"error":   a.tr("wireguard_tag_not_found", oldTag),
 		}
 	}
 
-	// Перегенерируем конфиг
-	if err := a.configBuilder.BuildConfigForProfile(a.storage.GetActiveProfileID(), settings.SubscriptionURL, settings.WireGuardConfigs); err != nil {
+	// Проверяем конфликты адресов/ключей с другими конфигами профиля
+	if conflict := FindWireGuardConflict(*wg, settings.WireGuardConfigs); conflict != nil {
 		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
+			"success":  false,
+			"error":    conflict.Error(),
+			"conflict": conflict.ToMap(),
 		}
 	}
 
-	return map[string]interface{}{
-		"success": true,
+	// Сети конфига не должны пересекаться с подсетью TUN из template.json
+	if conflict := FindTUNConflict(*wg, templateTUNSubnets(a.storage.GetTemplatePath())); conflict != nil {
+		return map[string]interface{}{
+			"success":  false,
+			"error":    conflict.Error(),
+			"conflict": conflict.ToMap(),
+		}
 	}
+
+	// Перегенерируем конфиг
+	if err := a.configBuilder.BuildConfigForProfile(a.storage.GetActiveProfileID(), settings.SubscriptionURL, settings.WireGuardConfigs); err != nil {
+		return a.rebuildErrorResult(err)
+	}
+
+	result := map[string]interface{}{
+		"success":  true,
+		"warnings": a.activeBuildWarnings(),
+	}
+	if wg.HasScripts() {
+		result["scripts_require_consent"] = !wg.AllowScripts
+		result["allow_scripts"] = wg.AllowScripts
+		result["post_up"] = wg.PostUp
+		result["post_down"] = wg.PostDown
+	}
+	return result
 }
 
 // DeleteWireGuard удаляет WireGuard конфиг
@@ -306,7 +453,7 @@ func (a *App) DeleteWireGuard(tag string) map[string]interface{} {
 		a.mu.Unlock()
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нельзя удалять VPN пока соединение активно. Сначала отключите VPN.",
+			"error":   a.tr("vpn_active_delete"),
 		}
 	}
 	a.mu.Unlock()
@@ -314,7 +461,7 @@ func (a *App) DeleteWireGuard(tag string) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 
@@ -341,7 +488,7 @@ func (a *App) DeleteWireGuard(tag string) map[string]interface{} {
 	if !found {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Конфиг с тегом '%s' не найден", tag),
+			"error":   a.tr("wireguard_tag_not_found", tag),
 		}
 	}
 
@@ -349,10 +496,7 @@ func (a *App) DeleteWireGuard(tag string) map[string]interface{} {
 
 	// Перегенерируем конфиг
 	if err := a.configBuilder.BuildConfigForProfile(a.storage.GetActiveProfileID(), settings.SubscriptionURL, settings.WireGuardConfigs); err != nil {
-		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		}
+		return a.rebuildErrorResult(err)
 	}
 
 	return map[string]interface{}{
@@ -368,7 +512,7 @@ func (a *App) GetWireGuardConfig(tag string) map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 
@@ -382,32 +526,36 @@ func (a *App) GetWireGuardConfig(tag string) map[string]interface{} {
 
 	for _, wg := range settings.WireGuardConfigs {
 		if wg.Tag == tag {
-			endpoint := wg.Endpoint
-			if wg.EndpointPort > 0 {
-				endpoint = fmt.Sprintf("%s:%d", wg.Endpoint, wg.EndpointPort)
-			}
+			endpoint := wg.EndpointAddress()
 			
 			return map[string]interface{}{
 				"success":              true,
 				"tag":                  wg.Tag,
 				"name":                 wg.Name,
-				"private_key":          wg.PrivateKey,
+				"private_key":          wg.PrivateKey.Value(),
 				"local_address":        wg.LocalAddress,
 				"dns":                  wg.DNS,
 				"mtu":                  wg.MTU,
 				"public_key":           wg.PublicKey,
-				"preshared_key":        wg.PresharedKey,
+				"preshared_key":        wg.PresharedKey.Value(),
 				"allowed_ips":          wg.AllowedIPs,
 				"endpoint":             endpoint,
 				"persistent_keepalive": wg.PersistentKeepalive,
 				"internal_domains":     wg.InternalDomains,
+				"internal_domains_mode": wg.GetInternalDomainsMode(),
+				"derived_domains":      wg.DerivedInternalDomains(),
+				"effective_domains":    wg.GetInternalDomains(),
+				"post_up":              wg.PostUp,
+				"post_down":            wg.PostDown,
+				"allow_scripts":        wg.AllowScripts,
+				"auto_mtu":             wg.AutoMTU,
 			}
 		}
 	}
 
 	return map[string]interface{}{
 		"success": false,
-		"error":   fmt.Sprintf("Конфиг с тегом '%s' не найден", tag),
+		"error":   a.tr("wireguard_tag_not_found", tag),
 	}
 }
 
@@ -422,7 +570,7 @@ func (a *App) UpdateWireGuardInternalDomains(tag string, domains []string) map[s
 		a.mu.Unlock()
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Нельзя изменять настройки пока VPN активен. Сначала отключите VPN.",
+			"error":   a.tr("vpn_active_settings"),
 		}
 	}
 	a.mu.Unlock()
@@ -430,7 +578,7 @@ func (a *App) UpdateWireGuardInternalDomains(tag string, domains []string) map[s
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 		}
 	}
 
@@ -454,7 +602,7 @@ func (a *App) UpdateWireGuardInternalDomains(tag string, domains []string) map[s
 	if foundIndex == -1 {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Конфиг с тегом '%s' не найден", tag),
+			"error":   a.tr("wireguard_tag_not_found", tag),
 		}
 	}
 
@@ -480,10 +628,7 @@ func (a *App) UpdateWireGuardInternalDomains(tag string, domains []string) map[s
 		settings.SubscriptionURL,
 		settings.WireGuardConfigs,
 	); err != nil {
-		return map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		}
+		return a.rebuildErrorResult(err)
 	}
 
 	// Собираем все внутренние домены для информации
@@ -495,9 +640,248 @@ func (a *App) UpdateWireGuardInternalDomains(tag string, domains []string) map[s
 		"domains":       normalizedDomains,
 		"all_domains":   allDomains,
 		"domains_count": len(normalizedDomains),
+		"mode":          settings.WireGuardConfigs[foundIndex].GetInternalDomainsMode(),
+		"effective_domains": settings.WireGuardConfigs[foundIndex].GetInternalDomains(),
 	}
 }
 
+// SetWireGuardInternalDomainsMode задаёт режим внутренних доменов WireGuard конфига:
+// auto - извлекать из Endpoint если список пуст, manual - только заданный список,
+// none - не добавлять DNS правила для внутренних доменов
+func (a *App) SetWireGuardInternalDomainsMode(tag string, mode string) map[string]interface{} {
+	a.waitForInit()
+	
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_settings"),
+		}
+	}
+	a.mu.Unlock()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := ValidateInternalDomainsMode(mode); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings, err := a.storage.GetUserSettings()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	for i := range settings.WireGuardConfigs {
+		wg := &settings.WireGuardConfigs[i]
+		if wg.Tag != tag {
+			continue
+		}
+		
+		// auto хранится как пустое значение (совместимо со старыми настройками)
+		if mode == InternalDomainsAuto {
+			mode = ""
+		}
+		wg.InternalDomainsMode = mode
+		
+		if err := a.configBuilder.BuildConfigForProfile(
+			a.storage.GetActiveProfileID(),
+			settings.SubscriptionURL,
+			settings.WireGuardConfigs,
+		); err != nil {
+			return a.rebuildErrorResult(err)
+		}
+		
+		a.writeLog(fmt.Sprintf("[WireGuard] Internal domains mode for %s: %s", tag, wg.GetInternalDomainsMode()))
+		
+		return map[string]interface{}{
+			"success":           true,
+			"tag":               tag,
+			"mode":              wg.GetInternalDomainsMode(),
+			"derived_domains":   wg.DerivedInternalDomains(),
+			"effective_domains": wg.GetInternalDomains(),
+			"all_domains":       CollectAllInternalDomains(settings.WireGuardConfigs),
+		}
+	}
+
+	return map[string]interface{}{
+		"success": false,
+		"error":   a.tr("wireguard_tag_not_found", tag),
+	}
+}
+
+// SetWireGuardAllowScripts включает/выключает выполнение PostUp/PostDown для конфига.
+// Это явный шаг согласия пользователя: по умолчанию скрипты не выполняются.
+func (a *App) SetWireGuardAllowScripts(tag string, allow bool) map[string]interface{} {
+	a.waitForInit()
+	
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_settings"),
+		}
+	}
+	a.mu.Unlock()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profileID := a.storage.GetActiveProfileID()
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	configs := profile.WireGuardConfigs
+	for i := range configs {
+		if configs[i].Tag != tag {
+			continue
+		}
+		
+		// Проверяем команды по чёрному списку, чтобы пользователь сразу видел отклонённые
+		refused := []string{}
+		for _, cmd := range append(append([]string{}, configs[i].PostUp...), configs[i].PostDown...) {
+			if err := CheckScriptCommand(cmd); err != nil {
+				refused = append(refused, cmd)
+			}
+		}
+		
+		configs[i].AllowScripts = allow
+		if err := a.storage.UpdateProfileWireGuard(profileID, configs); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+		
+		a.writeLog(fmt.Sprintf("[WireGuard] Scripts for %s: allowed=%v", tag, allow))
+		
+		return map[string]interface{}{
+			"success":       true,
+			"tag":           tag,
+			"allow_scripts": allow,
+			"refused":       refused,
+		}
+	}
+
+	return map[string]interface{}{
+		"success": false,
+		"error":   a.tr("wireguard_tag_not_found", tag),
+	}
+}
+
+// SetWireGuardAutoMTU включает/выключает перезапуск туннеля с MTU, найденным
+// проверкой пути, для конфига. Действует со следующего запуска туннеля
+func (a *App) SetWireGuardAutoMTU(tag string, enabled bool) map[string]interface{} {
+	a.waitForInit()
+	
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	profileID := a.storage.GetActiveProfileID()
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	
+	configs := profile.WireGuardConfigs
+	for i := range configs {
+		if configs[i].Tag != tag {
+			continue
+		}
+		configs[i].AutoMTU = enabled
+		if err := a.storage.UpdateProfileWireGuard(profileID, configs); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+		
+		a.writeLog(fmt.Sprintf("[WireGuard] Auto MTU for %s: %v", tag, enabled))
+		
+		return map[string]interface{}{
+			"success":  true,
+			"tag":      tag,
+			"auto_mtu": enabled,
+		}
+	}
+	
+	return map[string]interface{}{
+		"success": false,
+		"error":   a.tr("wireguard_tag_not_found", tag),
+	}
+}
+
+// SetWireGuardMTUProbe включает/выключает проверку MTU пути после запуска туннелей
+func (a *App) SetWireGuardMTUProbe(enabled bool) map[string]interface{} {
+	a.waitForInit()
+	
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	
+	settings := a.storage.GetAppSettings()
+	settings.DisableMTUProbe = !enabled
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	if a.nativeWG != nil {
+		a.nativeWG.SetMTUProbe(enabled)
+	}
+	
+	a.writeLog(fmt.Sprintf("[WireGuard] MTU probe after start: %v", enabled))
+	return map[string]interface{}{
+		"success":   true,
+		"mtu_probe": enabled,
+	}
+}
+
+// equalStringSlices сравнивает два списка строк поэлементно
+func equalStringSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // GetAllInternalDomains возвращает все собранные внутренние домены из всех WireGuard конфигов
 func (a *App) GetAllInternalDomains() map[string]interface{} {
 	a.waitForInit()
@@ -505,7 +889,7 @@ func (a *App) GetAllInternalDomains() map[string]interface{} {
 	if a.storage == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Storage не инициализирован",
+			"error":   a.tr("storage_not_initialized"),
 			"domains": []string{},
 		}
 	}
@@ -541,7 +925,7 @@ func (a *App) GetNativeWireGuardStatus() map[string]interface{} {
 		return map[string]interface{}{
 			"success":   false,
 			"installed": false,
-			"error":     "Native WireGuard Manager not initialized",
+			"error":     a.tr("wireguard_not_initialized"),
 		}
 	}
 	
@@ -557,7 +941,7 @@ func (a *App) StartNativeWireGuard(tag string) map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 		}
 	}
 	
@@ -565,7 +949,7 @@ func (a *App) StartNativeWireGuard(tag string) map[string]interface{} {
 	if !a.nativeWG.IsInstalled() {
 		return map[string]interface{}{
 			"success":          false,
-			"error":            "WireGuard не установлен",
+			"error":            a.tr("wireguard_not_installed"),
 			"install_required": true,
 		}
 	}
@@ -593,7 +977,7 @@ func (a *App) StartNativeWireGuard(tag string) map[string]interface{} {
 	if foundConfig == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Конфиг '%s' не найден", tag),
+			"error":   a.tr("wireguard_config_not_found", tag),
 		}
 	}
 	
@@ -602,13 +986,21 @@ func (a *App) StartNativeWireGuard(tag string) map[string]interface{} {
 	
 	// Start the tunnel
 	if err := a.nativeWG.StartTunnel(configIndex, nativeConfig); err != nil {
+		if conflict, ok := classifyTunnelStartError(tag, err).(*WireGuardConflictError); ok {
+			return map[string]interface{}{
+				"success":  false,
+				"error":    conflict.Error(),
+				"conflict": conflict.ToMap(),
+			}
+		}
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка запуска туннеля: %v", err),
+			"error":   a.tr("tunnel_start_failed", err),
 		}
 	}
 	
 	a.writeLog(fmt.Sprintf("Native WireGuard tunnel started: %s", tag))
+	a.startWireGuardHealthCheck()
 	
 	return map[string]interface{}{
 		"success": true,
@@ -624,7 +1016,7 @@ func (a *App) StopNativeWireGuard(tag string) map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 		}
 	}
 	
@@ -649,7 +1041,7 @@ func (a *App) StopNativeWireGuard(tag string) map[string]interface{} {
 	if configIndex < 0 {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Конфиг '%s' не найден", tag),
+			"error":   a.tr("wireguard_config_not_found", tag),
 		}
 	}
 	
@@ -657,7 +1049,7 @@ func (a *App) StopNativeWireGuard(tag string) map[string]interface{} {
 	if err := a.nativeWG.StopTunnel(configIndex); err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Ошибка остановки туннеля: %v", err),
+			"error":   a.tr("tunnel_stop_failed", err),
 		}
 	}
 	
@@ -676,10 +1068,11 @@ func (a *App) StopAllNativeWireGuard() map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 		}
 	}
 	
+	a.nativeWG.StopHealthCheck()
 	a.nativeWG.StopAllTunnels()
 	a.writeLog("All Native WireGuard tunnels stopped")
 	
@@ -695,14 +1088,14 @@ func (a *App) StartAllNativeWireGuard() map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 		}
 	}
 	
 	if !a.nativeWG.IsInstalled() {
 		return map[string]interface{}{
 			"success":          false,
-			"error":            "WireGuard не установлен",
+			"error":            a.tr("wireguard_not_installed"),
 			"install_required": true,
 		}
 	}
@@ -717,10 +1110,22 @@ func (a *App) StartAllNativeWireGuard() map[string]interface{} {
 	
 	started := 0
 	errors := []string{}
+	skipped := []map[string]interface{}{}
+	
+	// Conflicting configs are skipped, the rest are started
+	conflicts := FindWireGuardConflicts(settings.WireGuardConfigs)
 	
 	for i, wg := range settings.WireGuardConfigs {
+		if conflict := conflicts[i]; conflict != nil {
+			skipped = append(skipped, conflict.ToMap())
+			continue
+		}
 		nativeConfig := wg.ToWireGuardConfig()
 		if err := a.nativeWG.StartTunnel(i, nativeConfig); err != nil {
+			if conflict, ok := classifyTunnelStartError(wg.Tag, err).(*WireGuardConflictError); ok {
+				skipped = append(skipped, conflict.ToMap())
+				continue
+			}
 			errors = append(errors, fmt.Sprintf("%s: %v", wg.Tag, err))
 		} else {
 			started++
@@ -728,7 +1133,7 @@ func (a *App) StartAllNativeWireGuard() map[string]interface{} {
 	}
 	
 	result := map[string]interface{}{
-		"success": len(errors) == 0,
+		"success": len(errors) == 0 && len(skipped) == 0,
 		"started": started,
 		"total":   len(settings.WireGuardConfigs),
 	}
@@ -736,8 +1141,14 @@ func (a *App) StartAllNativeWireGuard() map[string]interface{} {
 	if len(errors) > 0 {
 		result["errors"] = errors
 	}
+	if len(skipped) > 0 {
+		result["skipped"] = skipped
+	}
 	
 	a.writeLog(fmt.Sprintf("Started %d/%d Native WireGuard tunnels", started, len(settings.WireGuardConfigs)))
+	if started > 0 {
+		a.startWireGuardHealthCheck()
+	}
 	
 	return result
 }
@@ -749,7 +1160,7 @@ func (a *App) GetNativeWireGuardTunnels() map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 			"tunnels": []TunnelState{},
 		}
 	}
@@ -766,6 +1177,10 @@ func (a *App) GetNativeWireGuardTunnels() map[string]interface{} {
 			"config_id":  t.ConfigID,
 			"started_at": t.StartedAt,
 			"active":     t.Active,
+			"mtu_probed": t.MTUProbed,
+		}
+		if t.ProbedMTU > 0 {
+			tunnel["probed_mtu"] = t.ProbedMTU
 		}
 		
 		// Find config name
@@ -792,7 +1207,7 @@ func (a *App) IsNativeWireGuardActive(tag string) map[string]interface{} {
 		return map[string]interface{}{
 			"success": false,
 			"active":  false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 		}
 	}
 	
@@ -820,7 +1235,7 @@ func (a *App) IsNativeWireGuardActive(tag string) map[string]interface{} {
 	return map[string]interface{}{
 		"success": false,
 		"active":  false,
-		"error":   fmt.Sprintf("Конфиг '%s' не найден", tag),
+		"error":   a.tr("wireguard_config_not_found", tag),
 	}
 }
 
@@ -831,7 +1246,7 @@ func (a *App) GetWireGuardBundleInfo() map[string]interface{} {
 	if a.nativeWG == nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Native WireGuard Manager not initialized",
+			"error":   a.tr("wireguard_not_initialized"),
 		}
 	}
 	
@@ -844,3 +1259,36 @@ func (a *App) GetWireGuardBundleInfo() map[string]interface{} {
 		"wgPath":        a.nativeWG.wgPath,
 	}
 }
+
+// CheckWireGuardRoutes checks that the system routing table has routes for
+// AllowedIPs of every active tunnel (diagnostics)
+func (a *App) CheckWireGuardRoutes() map[string]interface{} {
+	a.waitForInit()
+	
+	if a.nativeWG == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("wireguard_not_initialized"),
+		}
+	}
+	
+	checks, err := a.nativeWG.CheckTunnelRoutes()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("route_table_read_failed", err),
+		}
+	}
+	
+	ok := true
+	for _, check := range checks {
+		if !check.OK() {
+			ok = false
+		}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"ok":      ok,
+		"tunnels": checks,
+	}
+}
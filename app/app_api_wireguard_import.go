@@ -0,0 +1,261 @@
+package main
+
+// WireGuard file import for Kampus VPN
+// This file contains importing WireGuard configs from .conf files and zip bundles
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Limits of the WireGuard file import
+const (
+	MaxWireGuardZipSize  = 10 * 1024 * 1024 // Zip bundle size
+	MaxWireGuardConfSize = 64 * 1024        // One .conf file
+)
+
+// wireGuardImportFile is one .conf from the chosen file or zip
+type wireGuardImportFile struct {
+	Name string // File name inside the zip or on disk
+	Text string
+}
+
+// wireGuardTagFromFilename builds a default tag from a file name by the
+// ValidateTag rules: latin letters, digits, '-' and '_', starting with a letter
+func wireGuardTagFromFilename(filename string) string {
+	base := strings.TrimSuffix(path.Base(filepath.ToSlash(filename)), path.Ext(filename))
+
+	var b strings.Builder
+	for _, r := range base {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ' || r == '.':
+			b.WriteRune('-')
+		}
+	}
+	tag := strings.Trim(b.String(), "-_")
+	if tag == "" || !((tag[0] >= 'a' && tag[0] <= 'z') || (tag[0] >= 'A' && tag[0] <= 'Z')) {
+		tag = "wg-" + tag
+	}
+	if len(tag) > 32 {
+		tag = strings.TrimRight(tag[:32], "-_")
+	}
+	return tag
+}
+
+// readWireGuardImportFiles reads a .conf file or the .conf files of a zip bundle
+func readWireGuardImportFiles(filename string) ([]wireGuardImportFile, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".conf":
+		if info.Size() > MaxWireGuardConfSize {
+			return nil, fmt.Errorf("файл слишком большой для конфига WireGuard")
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return []wireGuardImportFile{{Name: filepath.Base(filename), Text: string(data)}}, nil
+
+	case ".zip":
+		if info.Size() > MaxWireGuardZipSize {
+			return nil, fmt.Errorf("архив больше %d МБ", MaxWireGuardZipSize/1024/1024)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return readWireGuardZip(data)
+
+	default:
+		return nil, fmt.Errorf("поддерживаются только файлы .conf и .zip")
+	}
+}
+
+// readWireGuardZip extracts the .conf files of a zip in memory
+func readWireGuardZip(data []byte) ([]wireGuardImportFile, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть архив: %v", err)
+	}
+
+	var files []wireGuardImportFile
+	for _, f := range archive.File {
+		name := f.Name
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") ||
+			strings.HasPrefix(path.Base(name), "._") || strings.ToLower(path.Ext(name)) != ".conf" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		// One byte over the limit tells a too large file from an exact fit
+		text, err := io.ReadAll(io.LimitReader(rc, MaxWireGuardConfSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if len(text) > MaxWireGuardConfSize {
+			text = nil
+		}
+		files = append(files, wireGuardImportFile{Name: name, Text: string(text)})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("в архиве нет файлов .conf")
+	}
+	return files, nil
+}
+
+// ImportWireGuardFromFile добавляет WireGuard конфиги из выбранного файла .conf
+// или zip архива с несколькими .conf (API для фронтенда)
+func (a *App) ImportWireGuardFromFile() map[string]interface{} {
+	a.waitForInit()
+
+	// Проверяем что VPN выключен
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_active_add"),
+		}
+	}
+	a.mu.Unlock()
+
+	if a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("config_builder_not_initialized"),
+		}
+	}
+
+	filename, err := wailsRuntime.OpenFileDialog(a.ctx, wailsRuntime.OpenDialogOptions{
+		Title: "Импорт WireGuard",
+		Filters: []wailsRuntime.FileFilter{
+			{
+				DisplayName: "Конфиги WireGuard (*.conf, *.zip)",
+				Pattern:     "*.conf;*.zip",
+			},
+		},
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("open_dialog_failed", err),
+		}
+	}
+	if filename == "" {
+		// User cancelled
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("cancelled"),
+		}
+	}
+
+	files, err := readWireGuardImportFiles(filename)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("file_read_failed", err),
+		}
+	}
+
+	settings, err := a.storage.GetUserSettings()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	configs := settings.WireGuardConfigs
+	results := []map[string]interface{}{}
+	imported := 0
+	for _, f := range files {
+		tag := wireGuardTagFromFilename(f.Name)
+		entry := map[string]interface{}{
+			"file": f.Name,
+			"tag":  tag,
+		}
+		results = append(results, entry)
+
+		duplicate := false
+		for _, existing := range configs {
+			if existing.Tag == tag {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			entry["status"] = "skipped"
+			entry["error"] = a.tr("wireguard_tag_exists", tag)
+			continue
+		}
+
+		if f.Text == "" {
+			entry["status"] = "failed"
+			entry["error"] = a.tr("file_empty_or_too_large")
+			continue
+		}
+		wg, err := ParseWireGuardConfig(f.Text)
+		if err != nil {
+			entry["status"] = "failed"
+			entry["error"] = a.tr("config_parse_failed", err)
+			continue
+		}
+		if failure := a.checkNewWireGuard(tag, tag, wg, configs); failure != nil {
+			entry["status"] = "failed"
+			entry["error"] = failure["error"]
+			if conflict, ok := failure["conflict"]; ok {
+				entry["conflict"] = conflict
+			}
+			continue
+		}
+
+		configs = append(configs, *wg)
+		imported++
+		entry["status"] = "imported"
+		if wg.HasScripts() {
+			// Скрипты сохранены, но выключены до явного согласия (SetWireGuardAllowScripts)
+			entry["scripts_require_consent"] = true
+		}
+	}
+
+	if imported == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("wireguard_none_imported"),
+			"files":   results,
+		}
+	}
+
+	// Перегенерируем конфиг один раз для всех импортированных
+	if err := a.configBuilder.BuildConfigForProfile(a.storage.GetActiveProfileID(), settings.SubscriptionURL, configs); err != nil {
+		result := a.rebuildErrorResult(err)
+		result["files"] = results
+		return result
+	}
+
+	a.writeLog(fmt.Sprintf("Imported %d of %d WireGuard configs from %s", imported, len(files), filepath.Base(filename)))
+	return map[string]interface{}{
+		"success":  true,
+		"imported": imported,
+		"count":    len(configs),
+		"files":    results,
+		"warnings": a.activeBuildWarnings(),
+	}
+}
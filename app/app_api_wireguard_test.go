@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// storedWireGuard returns the config with tag from the active profile
+func storedWireGuard(t *testing.T, a *App, tag string) UserWireGuardConfig {
+	t.Helper()
+	settings, err := a.storage.GetUserSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wg := range settings.WireGuardConfigs {
+		if wg.Tag == tag {
+			return wg
+		}
+	}
+	t.Fatalf("WireGuard config %q not stored", tag)
+	return UserWireGuardConfig{}
+}
+
+// tunnelDNSRule returns the domain_suffix of the DNS rule for server of the active config (nil if none)
+func tunnelDNSRule(t *testing.T, a *App, server string) []string {
+	t.Helper()
+	profile := mustStoredProfile(t, a.storage, a.storage.GetActiveProfileID())
+	data, err := json.Marshal(profile.SingboxConfig["dns"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dns struct {
+		Rules []struct {
+			Server       string   `json:"server"`
+			DomainSuffix []string `json:"domain_suffix"`
+		} `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &dns); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range dns.Rules {
+		if rule.Server == server {
+			return rule.DomainSuffix
+		}
+	}
+	return nil
+}
+
+func TestSetWireGuardInternalDomainsMode(t *testing.T) {
+	a := testWireGuardApp(t)
+	conf := strings.Replace(testWireGuardConf(t, "DNS = 10.8.0.1"), "vpn.example.com", "vpn.corp.local", 1)
+	if result := a.AddWireGuard("office", "Office", conf); result["success"] != true {
+		t.Fatalf("AddWireGuard = %v", result)
+	}
+	derived := []string{".corp.local", ".vpn.corp.local"}
+
+	config := a.GetWireGuardConfig("office")
+	if config["internal_domains_mode"] != InternalDomainsAuto {
+		t.Errorf("mode = %v, want auto by default", config["internal_domains_mode"])
+	}
+	if got, _ := config["derived_domains"].([]string); !equalStringSlices(got, derived) {
+		t.Errorf("derived_domains = %v, want %v", got, derived)
+	}
+
+	if result := a.UpdateWireGuardInternalDomains("office", []string{"Wiki.Office"}); result["success"] != true {
+		t.Fatalf("UpdateWireGuardInternalDomains = %v", result)
+	}
+
+	tests := []struct {
+		mode      string
+		stored    string
+		effective []string
+		rule      []string
+	}{
+		{InternalDomainsManual, InternalDomainsManual, []string{".wiki.office"}, []string{".wiki.office"}},
+		{InternalDomainsNone, InternalDomainsNone, []string{}, nil},
+		{InternalDomainsAuto, "", []string{".wiki.office"}, []string{".wiki.office", ".local", ".office.local"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			result := a.SetWireGuardInternalDomainsMode("office", tt.mode)
+			if result["success"] != true || result["mode"] != tt.mode {
+				t.Fatalf("SetWireGuardInternalDomainsMode = %v", result)
+			}
+			if got, _ := result["effective_domains"].([]string); !equalStringSlices(got, tt.effective) {
+				t.Errorf("effective_domains = %v, want %v", got, tt.effective)
+			}
+			if got, _ := result["derived_domains"].([]string); !equalStringSlices(got, derived) {
+				t.Errorf("derived_domains = %v, want %v", got, derived)
+			}
+			if stored := storedWireGuard(t, a, "office").InternalDomainsMode; stored != tt.stored {
+				t.Errorf("stored mode = %q, want %q", stored, tt.stored)
+			}
+			if rule := tunnelDNSRule(t, a, "dns-office"); !equalStringSlices(rule, tt.rule) {
+				t.Errorf("tunnel DNS rule = %v, want %v", rule, tt.rule)
+			}
+		})
+	}
+
+	result := a.SetWireGuardInternalDomainsMode("office", "everything")
+	if result["success"] != false {
+		t.Errorf("unknown mode accepted: %v", result)
+	}
+	if result := a.SetWireGuardInternalDomainsMode("missing", InternalDomainsNone); result["success"] != false {
+		t.Errorf("unknown tag accepted: %v", result)
+	}
+}
+
+func TestInternalDomainsModeExportImport(t *testing.T) {
+	a := testWireGuardApp(t)
+	conf := strings.Replace(testWireGuardConf(t, "DNS = 10.8.0.1"), "vpn.example.com", "vpn.corp.local", 1)
+	if result := a.AddWireGuard("office", "Office", conf); result["success"] != true {
+		t.Fatalf("AddWireGuard = %v", result)
+	}
+	if result := a.SetWireGuardInternalDomainsMode("office", InternalDomainsNone); result["success"] != true {
+		t.Fatalf("SetWireGuardInternalDomainsMode = %v", result)
+	}
+
+	export := a.ExportAllProfiles("")
+	data, _ := export["data"].(string)
+	if !strings.Contains(data, `"internal_domains_mode": "none"`) {
+		t.Errorf("export does not carry the mode:\n%s", data)
+	}
+	if result := a.ValidateImportData(data); result["success"] != true {
+		t.Errorf("ValidateImportData(export) = %v", result)
+	}
+
+	broken := strings.Replace(data, `"internal_domains_mode": "none"`, `"internal_domains_mode": "everything"`, 1)
+	if result := a.ValidateImportData(broken); result["success"] != false {
+		t.Errorf("import with an unknown mode accepted: %v", result)
+	}
+}
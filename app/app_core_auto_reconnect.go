@@ -0,0 +1,198 @@
+package main
+
+// Auto-reconnect for Kampus VPN
+// This file contains restarting sing-box with backoff after it exits unexpectedly
+
+import (
+	"fmt"
+	"time"
+)
+
+// Auto-reconnect configuration
+const (
+	// DefaultReconnectAttempts is the number of attempts when settings don't set one.
+	DefaultReconnectAttempts = 5
+	// ReconnectStableAfter is how long sing-box must run before the attempt counter resets.
+	ReconnectStableAfter = 2 * time.Minute
+)
+
+// reconnectBackoff is the delay before each attempt; the last one repeats
+var reconnectBackoff = []time.Duration{
+	1 * time.Second,
+	5 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+	60 * time.Second,
+}
+
+// reconnectDelay returns the delay before attempt (1-based)
+func reconnectDelay(attempt int) time.Duration {
+	if attempt > len(reconnectBackoff) {
+		return reconnectBackoff[len(reconnectBackoff)-1]
+	}
+	return reconnectBackoff[attempt-1]
+}
+
+// ReconnectAttempts returns the configured attempt limit (0 in settings = default)
+func (s GlobalAppSettings) ReconnectAttempts() int {
+	if s.AutoReconnectAttempts <= 0 {
+		return DefaultReconnectAttempts
+	}
+	return s.AutoReconnectAttempts
+}
+
+// autoReconnectEnabled reports whether the auto-reconnect setting is on
+func (a *App) autoReconnectEnabled() bool {
+	return a.storage != nil && a.storage.GetAppSettings().AutoReconnect
+}
+
+// noteSessionEnded resets the attempt counter if the session that just ended
+// ran long enough to count as recovered. Must be called with a.mu held.
+func (a *App) noteSessionEnded() {
+	if !a.startedAt.IsZero() && time.Since(a.startedAt) >= ReconnectStableAfter {
+		a.reconnectMu.Lock()
+		a.reconnectAttempts = 0
+		a.reconnectMu.Unlock()
+	}
+}
+
+// scheduleReconnect starts sing-box again after the backoff delay of the next
+// attempt. After the last attempt the error state is left as is.
+func (a *App) scheduleReconnect(cause error) {
+	limit := a.storage.GetAppSettings().ReconnectAttempts()
+
+	a.reconnectMu.Lock()
+	if a.reconnectStop != nil {
+		// Already waiting
+		a.reconnectMu.Unlock()
+		return
+	}
+	a.reconnectAttempts++
+	attempt := a.reconnectAttempts
+	if attempt > limit {
+		a.reconnectAttempts = 0
+		a.reconnectMu.Unlock()
+		a.writeLog(fmt.Sprintf("[Reconnect] Giving up after %d attempts: %v", limit, cause))
+		a.addLogEntry(LogSourceApp, LogLevelError, fmt.Sprintf("Не удалось переподключиться после %d попыток", limit))
+		a.emitEvent("vpn-reconnect-failed", map[string]interface{}{
+			"attempts": limit,
+			"error":    cause.Error(),
+		})
+		return
+	}
+	stop := make(chan struct{})
+	a.reconnectStop = stop
+	a.reconnectMu.Unlock()
+
+	delay := reconnectDelay(attempt)
+	a.writeLog(fmt.Sprintf("[Reconnect] Attempt %d/%d in %v: %v", attempt, limit, delay, cause))
+	a.AddToLogBuffer(fmt.Sprintf("Переподключение через %d сек (попытка %d из %d)", int(delay.Seconds()), attempt, limit))
+	a.emitEvent("vpn-reconnecting", map[string]interface{}{
+		"attempt":   attempt,
+		"max":       limit,
+		"delay_sec": int(delay.Seconds()),
+		"error":     cause.Error(),
+	})
+
+	go a.crash.Supervise("vpn-reconnect", func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-stop:
+			return
+		}
+
+		a.reconnectMu.Lock()
+		if a.reconnectStop != stop {
+			// Cancelled while the timer fired
+			a.reconnectMu.Unlock()
+			return
+		}
+		a.reconnectStop = nil
+		a.reconnectMu.Unlock()
+
+		a.mu.Lock()
+		running := a.isRunning
+		a.mu.Unlock()
+		if running {
+			// The user connected in the meantime
+			return
+		}
+
+		result := a.Start()
+		if success, _ := result["success"].(bool); !success {
+			a.writeLog(fmt.Sprintf("[Reconnect] Attempt %d failed: %v", attempt, result["error"]))
+			a.emitEvent("vpn-status-changed", false)
+			a.scheduleReconnect(fmt.Errorf("%v", result["error"]))
+			return
+		}
+		a.writeLog(fmt.Sprintf("[Reconnect] Attempt %d: sing-box started", attempt))
+		a.AddToLogBuffer("VPN переподключён")
+		a.emitEvent("vpn-status-changed", true)
+	})
+}
+
+// cancelReconnect stops a pending reconnect and resets the attempt counter
+// (user disconnected or the app is quitting)
+func (a *App) cancelReconnect() {
+	a.reconnectMu.Lock()
+	defer a.reconnectMu.Unlock()
+
+	if a.reconnectStop != nil {
+		close(a.reconnectStop)
+		a.reconnectStop = nil
+		a.writeLog("[Reconnect] Cancelled")
+	}
+	a.reconnectAttempts = 0
+}
+
+// getReconnectStatus returns the pending reconnect for GetStatus (nil if none)
+func (a *App) getReconnectStatus() map[string]interface{} {
+	a.reconnectMu.Lock()
+	defer a.reconnectMu.Unlock()
+
+	if a.reconnectStop == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"attempt": a.reconnectAttempts,
+	}
+}
+
+// SetAutoReconnect turns auto-reconnect on or off; attempts <= 0 uses
+// DefaultReconnectAttempts (API для фронтенда)
+func (a *App) SetAutoReconnect(enabled bool, attempts int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.AutoReconnect = enabled
+	settings.AutoReconnectAttempts = attempts
+	if attempts < 0 {
+		settings.AutoReconnectAttempts = 0
+	}
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	if !enabled {
+		a.cancelReconnect()
+	}
+
+	a.writeLog(fmt.Sprintf("Auto-reconnect: %v, %d attempts", enabled, settings.ReconnectAttempts()))
+	return map[string]interface{}{
+		"success":  true,
+		"enabled":  enabled,
+		"attempts": settings.ReconnectAttempts(),
+	}
+}
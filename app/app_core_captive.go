@@ -0,0 +1,161 @@
+package main
+
+// Captive portal handling for Kampus VPN
+// This file contains the pre-connect portal check and the wait-and-connect loop
+
+import (
+	"fmt"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// checkCaptivePortal probes the network before connecting. If a portal is found,
+// it starts waiting for the portal to clear and returns an error result;
+// the VPN connects automatically once the user has logged in.
+func (a *App) checkCaptivePortal() map[string]interface{} {
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		return nil
+	}
+
+	result := DetectCaptivePortal(newCaptivePortalClient())
+	if !result.Detected {
+		a.clearCaptivePortal()
+		return nil
+	}
+
+	a.writeLog(fmt.Sprintf("Captive portal detected: %s (probe %s)", result.PortalURL, result.ProbeURL))
+	a.AddToLogBuffer(a.tr("captive_portal_detected"))
+	a.startCaptivePortalWait(result)
+
+	return map[string]interface{}{
+		"success":        false,
+		"error":          a.tr("captive_portal_detected"),
+		"captive_portal": true,
+		"portal_url":     result.PortalURL,
+		"action":         "open_portal",
+	}
+}
+
+// startCaptivePortalWait remembers the portal and re-probes it until it clears
+func (a *App) startCaptivePortalWait(result CaptivePortalResult) {
+	a.captiveMu.Lock()
+	a.captivePortal = &result
+	if a.captiveStop != nil {
+		// Already waiting
+		a.captiveMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	a.captiveStop = stop
+	a.captiveMu.Unlock()
+
+	a.emitEvent("captive-portal-detected", map[string]interface{}{
+		"message":    a.tr("captive_portal_detected"),
+		"portal_url": result.PortalURL,
+		"action":     "open_portal",
+	})
+
+	go a.crash.Supervise("captive-portal-watcher", func() {
+		ticker := time.NewTicker(CaptivePortalRetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			probe := DetectCaptivePortal(newCaptivePortalClient())
+			if probe.Detected {
+				a.captiveMu.Lock()
+				a.captivePortal = &probe
+				a.captiveMu.Unlock()
+				continue
+			}
+
+			a.captiveMu.Lock()
+			if a.captiveStop != stop {
+				// Cancelled while probing
+				a.captiveMu.Unlock()
+				return
+			}
+			a.captivePortal = nil
+			a.captiveStop = nil
+			a.captiveMu.Unlock()
+
+			a.writeLog("Captive portal cleared, connecting")
+			a.AddToLogBuffer("Авторизация в сети пройдена, подключаем VPN")
+			a.emitEvent("captive-portal-cleared")
+
+			startResult := a.Start()
+			a.mu.Lock()
+			running := a.isRunning
+			a.mu.Unlock()
+			if success, _ := startResult["success"].(bool); !success {
+				a.writeLog(fmt.Sprintf("Auto-connect after captive portal failed: %v", startResult["error"]))
+			}
+			a.emitEvent("vpn-status-changed", running)
+			return
+		}
+	})
+}
+
+// clearCaptivePortal stops waiting for the portal (user disconnected or network is free)
+func (a *App) clearCaptivePortal() {
+	a.captiveMu.Lock()
+	defer a.captiveMu.Unlock()
+
+	if a.captiveStop != nil {
+		close(a.captiveStop)
+		a.captiveStop = nil
+	}
+	a.captivePortal = nil
+}
+
+// getCaptivePortalStatus returns the detected portal for GetStatus (nil if none)
+func (a *App) getCaptivePortalStatus() map[string]interface{} {
+	a.captiveMu.Lock()
+	defer a.captiveMu.Unlock()
+
+	if a.captivePortal == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"message":    a.tr("captive_portal_detected"),
+		"portal_url": a.captivePortal.PortalURL,
+		"checked_at": a.captivePortal.CheckedAt.Format(time.RFC3339),
+		"waiting":    a.captiveStop != nil,
+	}
+}
+
+// OpenCaptivePortal opens the detected portal login page in the default browser (API для фронтенда)
+func (a *App) OpenCaptivePortal() map[string]interface{} {
+	a.captiveMu.Lock()
+	portal := a.captivePortal
+	a.captiveMu.Unlock()
+
+	if portal == nil || portal.PortalURL == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("captive_portal_not_found"),
+		}
+	}
+
+	wailsRuntime.BrowserOpenURL(a.ctx, portal.PortalURL)
+	return map[string]interface{}{
+		"success": true,
+	}
+}
+
+// CancelCaptivePortalWait cancels automatic connection after portal login (API для фронтенда)
+func (a *App) CancelCaptivePortalWait() map[string]interface{} {
+	a.clearCaptivePortal()
+	return map[string]interface{}{
+		"success": true,
+	}
+}
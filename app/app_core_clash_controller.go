@@ -0,0 +1,30 @@
+package main
+
+// Clash API controller for Kampus VPN
+// This file contains choosing the controller address before sing-box starts
+
+import (
+	"fmt"
+)
+
+// selectClashController picks the controller port for the next sing-box start
+// and points all Clash API consumers at it. Must be called with a.mu held.
+func (a *App) selectClashController() {
+	if a.storage == nil {
+		return
+	}
+	address, err := pickClashAPIAddress()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[ClashAPI] %v, using %s", err, defaultClashAPIAddress()))
+		address = defaultClashAPIAddress()
+	}
+	if address != defaultClashAPIAddress() {
+		a.writeLog(fmt.Sprintf("[ClashAPI] %s is taken by another program, using %s", defaultClashAPIAddress(), address))
+	}
+	a.storage.SetClashController(address)
+	// The config write fails without a secret; generation is retried here
+	if err := a.storage.EnsureClashAPISecret(); err != nil {
+		a.writeLog(fmt.Sprintf("[ClashAPI] %v", err))
+	}
+	setClashAPIEndpoint(address, a.storage.GetAppSettings().ClashAPISecret)
+}
@@ -0,0 +1,90 @@
+package main
+
+// Measurement on connect for Kampus VPN
+// This file contains the one-shot fastest server selection after connect and its per-profile toggle
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// startConnectMeasurement measures servers right after sing-box started if the
+// active profile asks for it. Must be called with a.mu held.
+func (a *App) startConnectMeasurement() {
+	a.measureDone = nil
+	a.measurePinned = false
+	if a.storage == nil {
+		return
+	}
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil || !profile.MeasureOnConnect {
+		return
+	}
+
+	done := make(chan struct{})
+	a.measureDone = done
+
+	go func() {
+		defer a.crash.Guard("connect-measure")
+		defer close(done)
+
+		started := time.Now()
+		result := MeasureOnConnect(ConnectMeasureTimeout)
+		a.writeLog(fmt.Sprintf("[Measure] %s (%d servers, %s)",
+			result.Summary(), result.Measured, time.Since(started).Round(100*time.Millisecond)))
+
+		a.mu.Lock()
+		if a.measureDone == done {
+			a.measurePinned = result.Switched
+		}
+		a.mu.Unlock()
+
+		if result.Switched {
+			a.AddToLogBuffer(fmt.Sprintf("Выбран самый быстрый сервер: %s (%d мс)", result.Best, result.BestDelay))
+		}
+		if a.trafficStats != nil {
+			a.trafficStats.SetSessionMeasurement(result)
+		}
+		a.emitEvent("connect-measurement", result)
+	}()
+}
+
+// unpinMeasuredServer returns the selector to auto-select before sing-box stops.
+// Must be called with a.mu held.
+func (a *App) unpinMeasuredServer() {
+	if !a.measurePinned {
+		return
+	}
+	a.measurePinned = false
+	client := &http.Client{Timeout: time.Second}
+	if err := clashSelectProxy(client, ConnectMeasureSelector, ConnectMeasureGroup); err != nil {
+		a.writeLog(fmt.Sprintf("[Measure] Failed to restore auto-select: %v", err))
+	}
+}
+
+// SetProfileMeasureOnConnect toggles measuring servers on connect for a profile;
+// applies on the next connect (API для фронтенда)
+func (a *App) SetProfileMeasureOnConnect(profileID int, enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.SetProfileMeasureOnConnect(profileID, enabled); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Measure on connect for profile %d: %v", profileID, enabled))
+	return map[string]interface{}{
+		"success": true,
+		"enabled": enabled,
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+// Crash reporting for Kampus VPN
+// This file contains the "crashed last time" notice and the crash log API
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// CrashReportLogLines is the number of log buffer lines added to a problem report
+const CrashReportLogLines = 50
+
+// checkLastCrash picks up the marker left by a fatal panic in the previous run
+func (a *App) checkLastCrash() {
+	info := a.crash.LastCrash()
+	if info == nil {
+		return
+	}
+	a.crash.ClearMarker()
+
+	a.mu.Lock()
+	a.lastCrash = info
+	a.mu.Unlock()
+
+	a.writeLog(fmt.Sprintf("Previous run crashed in %s: %s (%s)", info.Where, info.Panic, info.File))
+	a.AddToLogBuffer("⚠️ Приложение аварийно завершилось в прошлый раз")
+	a.emitEvent("app-crashed-last-time", info.ToMap())
+}
+
+// getLastCrashStatus returns the previous crash for GetStatus (nil if none).
+// Must be called with a.mu held.
+func (a *App) getLastCrashStatus() map[string]interface{} {
+	if a.lastCrash == nil {
+		return nil
+	}
+	return a.lastCrash.ToMap()
+}
+
+// GetLastCrash returns the crash of the previous run, if any (API для фронтенда)
+func (a *App) GetLastCrash() map[string]interface{} {
+	a.mu.Lock()
+	crash := a.getLastCrashStatus()
+	a.mu.Unlock()
+
+	return map[string]interface{}{
+		"success": true,
+		"crashed": crash != nil,
+		"crash":   crash,
+	}
+}
+
+// OpenCrashLog opens the crash file of the previous run (API для фронтенда)
+func (a *App) OpenCrashLog() map[string]interface{} {
+	a.mu.Lock()
+	info := a.lastCrash
+	a.mu.Unlock()
+
+	if info == nil || info.File == "" || !fileExists(info.File) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("crash_file_not_found"),
+		}
+	}
+
+	openFolder(info.File)
+	return map[string]interface{}{
+		"success": true,
+		"file":    info.File,
+	}
+}
+
+// GetCrashReport returns a pre-filled problem report for the previous crash (API для фронтенда)
+func (a *App) GetCrashReport() map[string]interface{} {
+	a.mu.Lock()
+	info := a.lastCrash
+	a.mu.Unlock()
+
+	if info == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("crash_none"),
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Приложение аварийно завершилось\n\n")
+	sb.WriteString(fmt.Sprintf("Версия: %s (при сбое: %s)\n", Version, info.Version))
+	sb.WriteString(fmt.Sprintf("ОС: %s/%s\n", runtime.GOOS, runtime.GOARCH))
+	sb.WriteString(fmt.Sprintf("Время: %s\n", info.Time.Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("Где: %s\n", info.Where))
+	sb.WriteString(fmt.Sprintf("Ошибка: %s\n", info.Panic))
+
+	if data, err := os.ReadFile(info.File); err == nil {
+		sb.WriteString("\n--- Трассировка ---\n")
+		sb.Write(data)
+	}
+
+	if logs, ok := a.GetLogs("", "", CrashReportLogLines)["logs"].([]string); ok && len(logs) > 0 {
+		sb.WriteString("\n--- Журнал ---\n")
+		sb.WriteString(strings.Join(logs, "\n"))
+		sb.WriteString("\n")
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"report":  sb.String(),
+		"file":    info.File,
+	}
+}
+
+// DismissLastCrash hides the crash notice (API для фронтенда)
+func (a *App) DismissLastCrash() map[string]interface{} {
+	a.mu.Lock()
+	a.lastCrash = nil
+	a.mu.Unlock()
+
+	return map[string]interface{}{
+		"success": true,
+	}
+}
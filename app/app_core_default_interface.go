@@ -0,0 +1,145 @@
+package main
+
+// Direct outbound interface binding for Kampus VPN
+// This file contains binding of direct traffic to the default adapter and the watcher that reconnects when it disappears
+
+import (
+	"fmt"
+	"time"
+)
+
+// detectDirectInterface sets the adapter runtime configs bind direct traffic to.
+// Returns "" when binding is off or no adapter is connected.
+func (a *App) detectDirectInterface() string {
+	if a.storage == nil {
+		return ""
+	}
+	iface := ""
+	if !a.storage.GetAppSettings().DisableDirectInterfaceBinding {
+		var err error
+		if iface, err = DefaultInterface(); err != nil {
+			a.writeLog(fmt.Sprintf("[Interface] Failed to detect default interface: %v", err))
+		}
+	}
+	a.storage.SetDirectInterface(iface)
+	return iface
+}
+
+// bindDirectInterface picks the adapter for direct traffic of the next session.
+// Must be called with a.mu held.
+func (a *App) bindDirectInterface() {
+	a.boundInterface = ""
+	iface := a.detectDirectInterface()
+	if iface == "" {
+		return
+	}
+	// Native WireGuard traffic leaves through "direct" too, see renderRuntimeConfig
+	if profile, err := a.storage.GetActiveProfile(); err != nil || len(profile.WireGuardConfigs) > 0 {
+		return
+	}
+	a.boundInterface = iface
+	a.writeLog(fmt.Sprintf("[Interface] Direct traffic bound to %s", iface))
+}
+
+// startInterfaceWatch restarts VPN when the bound adapter disappears, so the
+// next session binds to the adapter that took over.
+// Must be called with a.mu held.
+func (a *App) startInterfaceWatch() {
+	if a.interfaceStop != nil {
+		close(a.interfaceStop)
+		a.interfaceStop = nil
+	}
+	bound := a.boundInterface
+	if bound == "" {
+		return
+	}
+	stop := make(chan struct{})
+	a.interfaceStop = stop
+
+	go a.crash.Supervise("interface-watch", func() {
+		ticker := time.NewTicker(InterfacePollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			interfaces, err := listGatewayInterfaces()
+			if err != nil || len(interfaces) == 0 {
+				// No network at all: nothing better to bind to
+				continue
+			}
+			found := false
+			for _, iface := range interfaces {
+				if iface.Name == bound {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+
+			a.writeLog(fmt.Sprintf("[Interface] %s is gone, default is now %s", bound, interfaces[0].Name))
+			go a.restartVPN(fmt.Sprintf("Сетевой адаптер сменился: %s → %s", bound, interfaces[0].Name))
+			return
+		}
+	})
+}
+
+// stopInterfaceWatch stops the default interface watcher
+func (a *App) stopInterfaceWatch() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.interfaceStop != nil {
+		close(a.interfaceStop)
+		a.interfaceStop = nil
+	}
+}
+
+// getDirectInterfaceStatus returns the bound adapter for GetStatus.
+// Must be called with a.mu held.
+func (a *App) getDirectInterfaceStatus() map[string]interface{} {
+	enabled := false
+	if a.storage != nil {
+		enabled = !a.storage.GetAppSettings().DisableDirectInterfaceBinding
+	}
+	return map[string]interface{}{
+		"enabled": enabled,
+		"bound":   a.boundInterface,
+	}
+}
+
+// SetBindDirectToDefaultInterface turns binding of direct traffic to the default
+// adapter on or off; reconnects if VPN is running (API для фронтенда)
+func (a *App) SetBindDirectToDefaultInterface(enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.DisableDirectInterfaceBinding = !enabled
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Bind direct to default interface: %v", enabled))
+	go a.restartVPN("Применение настройки привязки к сетевому адаптеру")
+
+	return map[string]interface{}{
+		"success": true,
+		"enabled": enabled,
+	}
+}
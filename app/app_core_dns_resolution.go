@@ -0,0 +1,94 @@
+package main
+
+// Internal domain resolution tracking for Kampus VPN
+// This file contains the per-session DNS tracker and the resolution report API
+
+import (
+	"fmt"
+	"strings"
+)
+
+// startDNSResolutionTracking starts counting resolvers of internal domains for
+// the new session. Must be called with a.mu held.
+func (a *App) startDNSResolutionTracking() {
+	a.dnsTracker = nil
+	if a.storage == nil {
+		return
+	}
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return
+	}
+	suffixes := CollectAllInternalDomains(profile.WireGuardConfigs)
+	if len(suffixes) == 0 {
+		return
+	}
+
+	finalTag := DefaultFinalDNSTag
+	if dns, ok := profile.SingboxConfig["dns"].(map[string]interface{}); ok {
+		finalTag = finalDNSTag(dns)
+	}
+	a.dnsTracker = NewDNSResolutionTracker(suffixes, finalTag)
+}
+
+// GetInternalDomainResolutionReport shows which DNS server answered each WireGuard
+// internal domain this session, plus problems found in the active config's dns.rules (API для фронтенда)
+func (a *App) GetInternalDomainResolutionReport() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	suffixes := CollectAllInternalDomains(profile.WireGuardConfigs)
+	issues := CheckInternalDNSRules(profile.SingboxConfig, suffixes, profile.WireGuardConfigs)
+
+	a.mu.Lock()
+	tracker := a.dnsTracker
+	a.mu.Unlock()
+
+	report := BuildResolutionReport(tracker.Counts(), profile.WireGuardConfigs)
+	misrouted := []string{}
+	for _, entry := range report {
+		if entry.Misrouted {
+			misrouted = append(misrouted, entry.Domain)
+		}
+	}
+
+	logLevel := string(a.storage.GetAppSettings().LogLevel)
+	result := map[string]interface{}{
+		"success":          true,
+		"internal_domains": suffixes,
+		"domains":          report,
+		"misrouted":        misrouted,
+		"rule_issues":      issues,
+		"tracking":         tracker != nil,
+		"log_level":        logLevel,
+	}
+
+	switch {
+	case len(suffixes) == 0:
+		result["message"] = a.tr("wireguard_domains_none")
+	case tracker != nil && !tracker.Observing():
+		// Queries only appear in the log at debug level
+		if logLevel != "debug" && logLevel != "trace" {
+			result["message"] = a.tr("dns_stats_need_debug")
+		}
+	}
+
+	if len(misrouted) > 0 {
+		a.writeLog(fmt.Sprintf("[DNS] Internal domains answered by non-corporate resolver: %s", strings.Join(misrouted, ", ")))
+	}
+	return result
+}
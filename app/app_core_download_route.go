@@ -0,0 +1,94 @@
+package main
+
+// Download route for Kampus VPN
+// This file contains choosing the download inbound port and switching app
+// downloads between the running VPN and direct
+
+import (
+	"fmt"
+)
+
+// selectDownloadPort picks the port of the download inbound for the next
+// sing-box start (none when downloads are forced direct). Must be called with a.mu held.
+func (a *App) selectDownloadPort() {
+	if a.storage == nil {
+		return
+	}
+	port := 0
+	if !a.storage.GetAppSettings().DownloadsDirect {
+		var err error
+		if port, err = pickLocalInboundPort(); err != nil {
+			a.writeLog(fmt.Sprintf("[Downloads] No free port (%v), downloads go direct this session", err))
+		}
+	}
+	a.storage.SetDownloadPort(port)
+}
+
+// enableDownloadRoute sends app downloads through the started sing-box
+func (a *App) enableDownloadRoute() {
+	if a.storage == nil {
+		return
+	}
+	if port := a.storage.GetDownloadPort(); port != 0 {
+		setDownloadProxyPort(port)
+		a.writeLog(fmt.Sprintf("[Downloads] Filter and update downloads go through VPN (127.0.0.1:%d)", port))
+	}
+}
+
+// disableDownloadRoute sends app downloads direct once sing-box is gone
+func (a *App) disableDownloadRoute() {
+	setDownloadProxyPort(0)
+}
+
+// SetDownloadsDirect forces filter and update downloads to bypass the VPN
+// (API для фронтенда)
+func (a *App) SetDownloadsDirect(direct bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.DownloadsDirect = direct
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	// Forcing direct takes effect immediately, the VPN route on the next connect
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if direct {
+		a.disableDownloadRoute()
+	} else if running {
+		a.enableDownloadRoute()
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"route":   currentDownloadRoute(),
+	}
+}
+
+// --- Storage ---
+
+// SetDownloadPort sets the download inbound port runtime configs use (0 = none).
+func (s *Storage) SetDownloadPort(port int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloadPort = port
+}
+
+// GetDownloadPort returns the download inbound port of the current session.
+func (s *Storage) GetDownloadPort() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.downloadPort
+}
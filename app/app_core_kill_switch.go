@@ -0,0 +1,158 @@
+package main
+
+// Kill switch for Kampus VPN
+// This file contains engaging and releasing the kill switch around the sing-box lifetime
+
+import (
+	"fmt"
+)
+
+// killSwitchEnabled reports whether the kill switch setting is on
+func (a *App) killSwitchEnabled() bool {
+	return a.storage != nil && a.storage.GetAppSettings().KillSwitch
+}
+
+// prepareKillSwitch resolves proxy servers of the active profile while the
+// network still works, so the rules can be installed instantly when sing-box
+// dies. Must be called with a.mu held.
+func (a *App) prepareKillSwitch() {
+	a.killSwitchAddrs = nil
+	if !a.killSwitchEnabled() || a.configBuilder == nil {
+		return
+	}
+
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil || profile.SingboxConfig == nil {
+		return
+	}
+	servers := configProxyServers(profile.SingboxConfig)
+	a.killSwitchAddrs = resolveKillSwitchAddrs(servers, a.configBuilder.resolver)
+	a.writeLog(fmt.Sprintf("[KillSwitch] Armed: %d servers, %d addresses allowed", len(servers), len(a.killSwitchAddrs)))
+}
+
+// engageKillSwitch blocks traffic after sing-box exited without the user
+// disconnecting. netsh runs without a.mu; holding a.actionMu keeps a connect
+// from starting while the rules go in.
+func (a *App) engageKillSwitch() {
+	if !a.killSwitchEnabled() {
+		return
+	}
+
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	a.mu.Lock()
+	running := a.isRunning
+	addrs := a.killSwitchAddrs
+	a.mu.Unlock()
+	if running {
+		// Reconnected while waiting for the lock
+		return
+	}
+
+	if err := InstallKillSwitch(addrs); err != nil {
+		a.writeLog(fmt.Sprintf("[KillSwitch] Failed to install firewall rules: %v", err))
+		a.AddToLogBuffer(fmt.Sprintf("Не удалось включить kill switch: %v", err))
+		return
+	}
+	a.mu.Lock()
+	a.killSwitchOn = true
+	a.mu.Unlock()
+	a.writeLog("[KillSwitch] Engaged: traffic outside proxy servers is blocked")
+	a.AddToLogBuffer("Kill switch: трафик заблокирован до отключения или переподключения VPN")
+	a.emitEvent("kill-switch-changed", true)
+}
+
+// releaseKillSwitch removes the kill switch rules. The firewall is only checked
+// while the kill switch is engaged or enabled: rules left by a run that crashed
+// are picked up by detectKillSwitch at launch. netsh runs without a.mu, so
+// callers hold a.actionMu instead.
+func (a *App) releaseKillSwitch() {
+	a.mu.Lock()
+	engaged := a.killSwitchOn
+	a.mu.Unlock()
+	if !engaged && !a.killSwitchEnabled() {
+		return
+	}
+
+	if err := RemoveKillSwitch(); err != nil {
+		a.writeLog(fmt.Sprintf("[KillSwitch] Failed to remove firewall rules: %v", err))
+		return
+	}
+	if !engaged {
+		return
+	}
+	a.mu.Lock()
+	a.killSwitchOn = false
+	a.mu.Unlock()
+	a.writeLog("[KillSwitch] Released")
+	a.AddToLogBuffer("Kill switch отключён")
+	a.emitEvent("kill-switch-changed", false)
+}
+
+// detectKillSwitch picks up rules left by a previous run that crashed while
+// the kill switch was engaged, so the next disconnect removes them
+func (a *App) detectKillSwitch() {
+	if !KillSwitchInstalled() {
+		return
+	}
+	a.mu.Lock()
+	a.killSwitchOn = true
+	a.mu.Unlock()
+	a.writeLog("[KillSwitch] Rules of a previous run are still installed")
+	a.AddToLogBuffer("Kill switch активен с прошлого запуска: трафик заблокирован до подключения или отключения VPN")
+}
+
+// getKillSwitchStatus returns kill switch state for GetStatus and Start/Stop.
+// Must be called with a.mu held.
+func (a *App) getKillSwitchStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled": a.killSwitchEnabled(),
+		"engaged": a.killSwitchOn,
+	}
+}
+
+// SetKillSwitch turns the kill switch on or off (API для фронтенда)
+func (a *App) SetKillSwitch(enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.KillSwitch = enabled
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	if !enabled {
+		// Turning it off lifts rules installed after a crash
+		a.actionMu.Lock()
+		a.releaseKillSwitch()
+		a.actionMu.Unlock()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if enabled {
+		if a.isRunning {
+			a.prepareKillSwitch()
+		}
+	} else {
+		a.killSwitchAddrs = nil
+	}
+	a.writeLog(fmt.Sprintf("Kill switch: %v", enabled))
+
+	return map[string]interface{}{
+		"success":    true,
+		"killSwitch": a.getKillSwitchStatus(),
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordFirewall replaces netsh with a fake that records calls; show reports
+// whether rules are installed
+func recordFirewall(t *testing.T, installed bool) *[]string {
+	t.Helper()
+	var calls []string
+	previous := firewallCommand
+	firewallCommand = func(timeout time.Duration, name string, args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args[2:], " "))
+		if args[2] == "show" && !installed {
+			return []byte("No rules match the specified criteria."), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { firewallCommand = previous })
+	return &calls
+}
+
+func TestReleaseKillSwitch(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		engaged   bool
+		installed bool
+		calls     []string
+	}{
+		{"disabled and idle", false, false, true, nil},
+		{"enabled without rules", true, false, false, []string{"show rule name=" + KillSwitchRuleName}},
+		{"engaged", false, true, true, []string{"show rule name=" + KillSwitchRuleName, "delete rule name=" + KillSwitchRuleName}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := testActivationApp(t)
+			settings := a.storage.GetAppSettings()
+			settings.KillSwitch = tt.enabled
+			if err := a.storage.UpdateAppSettings(settings); err != nil {
+				t.Fatal(err)
+			}
+			a.killSwitchOn = tt.engaged
+			calls := recordFirewall(t, tt.installed)
+
+			a.releaseKillSwitch()
+			if !equalStringSlices(*calls, tt.calls) {
+				t.Errorf("netsh calls = %q, want %q", *calls, tt.calls)
+			}
+			if a.killSwitchOn {
+				t.Error("kill switch still marked engaged")
+			}
+		})
+	}
+}
+
+func TestEngageKillSwitchSkipsNewSession(t *testing.T) {
+	a, _ := testActivationApp(t)
+	settings := a.storage.GetAppSettings()
+	settings.KillSwitch = true
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	calls := recordFirewall(t, false)
+
+	// A connect that won the action lock must not be blocked by the old session
+	a.isRunning = true
+	a.engageKillSwitch()
+	if len(*calls) != 0 || a.killSwitchOn {
+		t.Errorf("engaged over a running session: %q", *calls)
+	}
+
+	a.isRunning = false
+	a.engageKillSwitch()
+	if !a.killSwitchOn {
+		t.Error("kill switch not engaged after sing-box exited")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+// Latency history for Kampus VPN
+// This file contains the delay sampler of the current proxy and its API
+
+import (
+	"net/http"
+	"time"
+)
+
+// startLatencySampler samples the delay of the current proxy while the window
+// is visible. Must be called with a.mu held.
+func (a *App) startLatencySampler() {
+	if a.latencyStop != nil {
+		close(a.latencyStop)
+	}
+	stop := make(chan struct{})
+	a.latencyStop = stop
+	// A new session starts a new series
+	history := NewLatencyHistory()
+	a.latencyHistory = history
+
+	go a.crash.Supervise("latency-sampler", func() {
+		client := &http.Client{Timeout: LatencySampleTimeout + 2*time.Second}
+		ticker := time.NewTicker(LatencySampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			// Hidden window (or tray-only mode): no tests that wake the radio
+			a.mu.Lock()
+			visible := a.windowVisible && a.ctx != nil
+			a.mu.Unlock()
+			if !visible {
+				continue
+			}
+
+			proxy, err := clashActiveProxy(client)
+			if err != nil {
+				continue // sing-box is starting or already gone
+			}
+			delay, err := clashProxyDelay(client, proxy, LatencySampleTimeout)
+			sample := LatencySample{At: time.Now(), Delay: delay}
+			if err != nil {
+				sample.Delay = 0
+				sample.Error = classifyDelayError(err)
+			}
+			history.Add(proxy, sample)
+			a.emitEvent("latency-sample", map[string]interface{}{
+				"proxy":  proxy,
+				"sample": sample,
+			})
+		}
+	})
+}
+
+// stopLatencySampler stops the sampler; the last series stays readable
+func (a *App) stopLatencySampler() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.latencyStop != nil {
+		close(a.latencyStop)
+		a.latencyStop = nil
+	}
+}
+
+// GetLatencyHistory returns the delay samples of the current proxy with
+// average, p95 and jitter (API для фронтенда)
+func (a *App) GetLatencyHistory() map[string]interface{} {
+	a.mu.Lock()
+	history := a.latencyHistory
+	sampling := a.latencyStop != nil
+	a.mu.Unlock()
+
+	if history == nil {
+		return map[string]interface{}{
+			"success":  true,
+			"sampling": false,
+			"samples":  []LatencySample{},
+		}
+	}
+
+	proxy, since, samples := history.Snapshot()
+	result := map[string]interface{}{
+		"success":  true,
+		"sampling": sampling,
+		"proxy":    proxy,
+		"samples":  samples,
+		"stats":    computeLatencyStats(samples),
+		"interval": int(LatencySampleInterval.Seconds()),
+	}
+	if !since.IsZero() {
+		result["since"] = since.Format(time.RFC3339)
+	}
+	return result
+}
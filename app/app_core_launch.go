@@ -0,0 +1,100 @@
+package main
+
+// Launch options for Kampus VPN
+// This file contains connect on launch and the start minimized / connect on launch settings API
+
+import (
+	"fmt"
+	"time"
+)
+
+// Connect on launch: networking at boot comes up after the app does
+const (
+	// LaunchNetworkAttempts is how many times the network is checked before connecting anyway.
+	LaunchNetworkAttempts = 10
+	// LaunchNetworkRetryDelay is the pause between the checks.
+	LaunchNetworkRetryDelay = 3 * time.Second
+)
+
+// connectOnLaunch connects VPN after initialization when ConnectOnLaunch is set
+func (a *App) connectOnLaunch() {
+	if a.storage == nil || !a.storage.GetAppSettings().ConnectOnLaunch {
+		return
+	}
+
+	if !a.waitForNetwork() {
+		a.writeLog(fmt.Sprintf("[Launch] No network after %d checks, connecting anyway", LaunchNetworkAttempts))
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running {
+		a.writeLog("[Launch] VPN already connected")
+		return
+	}
+
+	a.writeLog("[Launch] Connecting on launch")
+	result := a.Start()
+	if success, _ := result["success"].(bool); !success {
+		a.writeLog(fmt.Sprintf("[Launch] Connect on launch failed: %v", result["error"]))
+		a.AddToLogBuffer(fmt.Sprintf("Не удалось подключиться при запуске: %v", result["error"]))
+		ShowTrayMessage(a.tr("connect_failed", result["error"]))
+		return
+	}
+	a.AddToLogBuffer("VPN подключён при запуске")
+	a.emitEvent("vpn-status-changed", true)
+}
+
+// waitForNetwork waits until an adapter with a default gateway is up
+func (a *App) waitForNetwork() bool {
+	for attempt := 1; attempt <= LaunchNetworkAttempts; attempt++ {
+		interfaces, err := listGatewayInterfaces()
+		if err == nil && len(interfaces) > 0 {
+			if attempt > 1 {
+				a.writeLog(fmt.Sprintf("[Launch] Network is up (%s) after %d checks", interfaces[0].Name, attempt))
+			}
+			return true
+		}
+		if attempt < LaunchNetworkAttempts {
+			a.writeLog(fmt.Sprintf("[Launch] Waiting for network (%d/%d)", attempt, LaunchNetworkAttempts))
+			time.Sleep(LaunchNetworkRetryDelay)
+		}
+	}
+	return false
+}
+
+// SetLaunchOptions saves start minimized and connect on launch and
+// re-registers the autostart entry with the matching flags (API для фронтенда)
+func (a *App) SetLaunchOptions(startMinimized, connectOnLaunch bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.StartMinimized = startMinimized
+	settings.ConnectOnLaunch = connectOnLaunch
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	if settings.AutoStart {
+		if err := SetAutoStart(true, startMinimized); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("autostart_failed", err),
+			}
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Launch options: start minimized %v, connect on launch %v", startMinimized, connectOnLaunch))
+	return a.GetAutoStartStatus()
+}
@@ -4,46 +4,52 @@ package main
 // This file contains all logging-related operations
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 )
 
-// setupLogPath sets up the log file path
-func (a *App) setupLogPath() {
-	var logDir string
-
+// defaultLogDir returns the per-user log directory
+func defaultLogDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		// %LOCALAPPDATA%\KampusVPN\logs
-		logDir = filepath.Join(os.Getenv("LOCALAPPDATA"), "KampusVPN", "logs")
+		return filepath.Join(os.Getenv("LOCALAPPDATA"), "KampusVPN", "logs")
 	case "darwin":
 		// ~/Library/Logs/KampusVPN
 		home, _ := os.UserHomeDir()
-		logDir = filepath.Join(home, "Library", "Logs", "KampusVPN")
+		return filepath.Join(home, "Library", "Logs", "KampusVPN")
 	default:
 		// ~/.local/share/kampusvpn/logs
 		home, _ := os.UserHomeDir()
-		logDir = filepath.Join(home, ".local", "share", "kampusvpn", "logs")
+		return filepath.Join(home, ".local", "share", "kampusvpn", "logs")
 	}
+}
 
+// setupLogPath sets up the log file path
+func (a *App) setupLogPath() {
+	logDir := defaultLogDir()
 	os.MkdirAll(logDir, 0755)
 	a.logPath = filepath.Join(logDir, "vpn.log")
 }
 
-// openLogFile opens log file with rotation
-func (a *App) openLogFile() error {
-	// Check existing file size and rotate if needed
-	if err := a.rotateLogIfNeeded(); err != nil {
-		// Not critical, continue
+// logMaxSize returns the log file size before rotation in bytes
+func (a *App) logMaxSize() int64 {
+	if a.storage != nil {
+		if mb := a.storage.GetAppSettings().LogMaxSizeMB; mb > 0 {
+			return int64(mb) * 1024 * 1024
+		}
 	}
+	return MaxLogSize
+}
 
+// openLogFile opens log file with rotation
+func (a *App) openLogFile() error {
 	var err error
-	a.logFile, err = os.OpenFile(a.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	a.logFile, err = OpenRotatingLogFile(a.logPath, a.logMaxSize(), LogRotateKeep)
 	if err != nil {
 		return err
 	}
@@ -55,60 +61,6 @@ func (a *App) openLogFile() error {
 	return nil
 }
 
-// rotateLogIfNeeded checks log size and truncates if needed
-func (a *App) rotateLogIfNeeded() error {
-	info, err := os.Stat(a.logPath)
-	if err != nil {
-		return nil // File doesn't exist - ok
-	}
-
-	if info.Size() < MaxLogSize {
-		return nil // Size is ok
-	}
-
-	// Read last TruncateToSize bytes
-	file, err := os.Open(a.logPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Seek to position (size - TruncateToSize)
-	offset := info.Size() - TruncateToSize
-	if offset < 0 {
-		offset = 0
-	}
-	file.Seek(offset, 0)
-
-	// Skip first incomplete line
-	reader := bufio.NewReader(file)
-	reader.ReadString('\n')
-
-	// Read remainder
-	remainingData, err := io.ReadAll(reader)
-	if err != nil {
-		return err
-	}
-
-	// Rewrite file
-	file.Close()
-	err = os.WriteFile(a.logPath, remainingData, 0644)
-	if err != nil {
-		return err
-	}
-
-	// Add rotation marker
-	marker := fmt.Sprintf("=== Log rotated at %s (old logs truncated) ===\n",
-		time.Now().Format("2006-01-02 15:04:05"))
-	f, _ := os.OpenFile(a.logPath, os.O_APPEND|os.O_WRONLY, 0644)
-	if f != nil {
-		f.WriteString(marker)
-		f.Close()
-	}
-
-	return nil
-}
-
 // closeLogFile closes log file
 func (a *App) closeLogFile() {
 	if a.logFile != nil {
@@ -119,62 +71,167 @@ func (a *App) closeLogFile() {
 	}
 }
 
-// writeLog writes to log file
+// writeLog writes to log file (secrets masked)
 func (a *App) writeLog(message string) {
 	if a.logFile != nil {
+		message = a.logScrubber.Load().Scrub(message)
 		timestamp := time.Now().Format("15:04:05")
 		a.logFile.WriteString(fmt.Sprintf("[%s] %s\n", timestamp, message))
 	}
 }
 
-// AddToLogBuffer adds message to log buffer for UI
+// AddToLogBuffer adds an application message to the UI log (secrets masked)
 func (a *App) AddToLogBuffer(message string) {
-	a.logBufferMu.Lock()
-	defer a.logBufferMu.Unlock()
-
-	// Limit buffer size
-	if len(a.logBuffer) >= MaxLogBufferSize {
-		a.logBuffer = a.logBuffer[100:] // Remove first 100 entries
+	source := LogSourceApp
+	if strings.HasPrefix(message, "WireGuard") {
+		source = LogSourceWireGuard
 	}
-
-	timestamp := time.Now().Format("15:04:05")
-	a.logBuffer = append(a.logBuffer, fmt.Sprintf("[%s] %s", timestamp, message))
+	a.addLogEntry(source, LogLevelInfo, message)
 }
 
-// GetLogs returns logs from buffer (API for frontend)
-func (a *App) GetLogs(lastN int) map[string]interface{} {
-	a.logBufferMu.RLock()
-	defer a.logBufferMu.RUnlock()
+// addLogEntry adds an entry to the UI log (secrets masked)
+func (a *App) addLogEntry(source string, level LogLevel, message string) {
+	a.logStore.Add(LogEntry{
+		Time:    time.Now(),
+		Source:  source,
+		Level:   level,
+		Message: a.logScrubber.Load().Scrub(message),
+	})
+}
 
-	if lastN <= 0 || lastN > len(a.logBuffer) {
-		lastN = len(a.logBuffer)
+// GetLogs returns the last limit log entries (0 = all) of at least level
+// ("" = any) containing search (API for frontend)
+func (a *App) GetLogs(level string, search string, limit int) map[string]interface{} {
+	minLevel := LogLevel(strings.ToLower(level))
+	if _, ok := logLevelRank[minLevel]; !ok && minLevel != "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("log_level_invalid", level),
+		}
 	}
 
-	// Return last N entries
-	startIdx := len(a.logBuffer) - lastN
-	if startIdx < 0 {
-		startIdx = 0
+	entries, matched := a.logStore.Query(minLevel, search, limit)
+	logs := make([]string, len(entries))
+	for i, entry := range entries {
+		logs[i] = entry.String()
 	}
 
-	logs := make([]string, lastN)
-	copy(logs, a.logBuffer[startIdx:])
-
 	return map[string]interface{}{
 		"success": true,
 		"logs":    logs,
-		"total":   len(a.logBuffer),
+		"entries": entries,
+		"matched": matched,
+		"total":   a.logStore.Len(),
 	}
 }
 
 // ClearLogs clears log buffer
 func (a *App) ClearLogs() map[string]interface{} {
-	a.logBufferMu.Lock()
-	defer a.logBufferMu.Unlock()
+	a.logStore.Clear()
+
+	return map[string]interface{}{
+		"success": true,
+		"message": a.tr("logs_cleared"),
+	}
+}
 
-	a.logBuffer = make([]string, 0, MaxLogBufferSize)
+// GetLogFilesInfo returns the log file and its rotated generations with sizes (API for frontend)
+func (a *App) GetLogFilesInfo() map[string]interface{} {
+	files := listLogFiles(a.logPath, LogRotateKeep)
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+
+	return map[string]interface{}{
+		"success":   true,
+		"files":     files,
+		"totalSize": total,
+		"maxSize":   a.logMaxSize(),
+		"keepFiles": LogRotateKeep,
+		"logDir":    filepath.Dir(a.logPath),
+	}
+}
+
+// ClearAllLogs empties the log file and deletes rotated generations.
+// While VPN is running the open file is truncated in place, so sing-box
+// output keeps going to the same handle (API for frontend)
+func (a *App) ClearAllLogs() map[string]interface{} {
+	var err error
+	if logFile := a.logFile; logFile != nil {
+		err = logFile.Truncate()
+	} else if fileExists(a.logPath) {
+		err = os.Truncate(a.logPath, 0)
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("log_clear_failed", err),
+		}
+	}
+
+	failed := 0
+	for i := 1; i <= LogRotateKeep; i++ {
+		path := logGenerationPath(a.logPath, i)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("old_logs_delete_failed", failed),
+		}
+	}
+
+	a.writeLog("[Log] Log files cleared")
+	return map[string]interface{}{
+		"success": true,
+		"message": a.tr("log_files_cleared"),
+	}
+}
+
+// SetLogMaxSize sets the log file size before rotation in MB (0 = default).
+// Applies from the next connection (API for frontend)
+func (a *App) SetLogMaxSize(sizeMB int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if sizeMB < 0 || sizeMB > 1024 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("log_size_invalid"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.LogMaxSizeMB = sizeMB
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
 
 	return map[string]interface{}{
 		"success": true,
-		"message": "Логи очищены",
 	}
 }
+
+// updateLogScrubber rebuilds secret masking from the active profile before connect
+func (a *App) updateLogScrubber() {
+	if a.storage == nil {
+		return
+	}
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil {
+		return
+	}
+	a.logScrubber.Store(NewLogScrubber(profile.SingboxConfig, profile.WireGuardConfigs))
+}
@@ -0,0 +1,113 @@
+package main
+
+// Network change handling for Kampus VPN
+// This file contains the watcher that recovers the connection after the network changed while VPN is running
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startNetworkWatch polls the network fingerprint while VPN is running and
+// handles a change once it stopped flapping.
+// Must be called with a.mu held.
+func (a *App) startNetworkWatch() {
+	if a.networkStop != nil {
+		close(a.networkStop)
+		a.networkStop = nil
+	}
+	stop := make(chan struct{})
+	a.networkStop = stop
+
+	go a.crash.Supervise("network-watch", func() {
+		current, err := readNetworkFingerprint()
+		known := err == nil
+		if err != nil {
+			a.writeLog(fmt.Sprintf("[Network] Failed to read network state: %v", err))
+		}
+		var pending NetworkFingerprint
+		var pendingSince time.Time
+
+		ticker := time.NewTicker(NetworkPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			fingerprint, err := readNetworkFingerprint()
+			if err != nil {
+				continue
+			}
+			switch {
+			case !known:
+				current = fingerprint
+				known = true
+				continue
+			case fingerprint.Equal(current):
+				// Flapped back before the change settled
+				pendingSince = time.Time{}
+				continue
+			case pendingSince.IsZero() || !fingerprint.Equal(pending):
+				pending = fingerprint
+				pendingSince = time.Now()
+				continue
+			case time.Since(pendingSince) < NetworkChangeDebounce:
+				continue
+			}
+
+			previous := current
+			current = fingerprint
+			pendingSince = time.Time{}
+			// Nothing to recover until a network is back
+			if fingerprint.IsEmpty() {
+				a.writeLog("[Network] All networks disconnected")
+				continue
+			}
+			a.onNetworkChange(previous, fingerprint)
+		}
+	})
+}
+
+// stopNetworkWatch stops the network change watcher
+func (a *App) stopNetworkWatch() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.networkStop != nil {
+		close(a.networkStop)
+		a.networkStop = nil
+	}
+}
+
+// onNetworkChange drops state bound to the old network: cached DNS answers,
+// sing-box connections and WireGuard handshakes
+func (a *App) onNetworkChange(previous, current NetworkFingerprint) {
+	from := strings.Join(previous.Interfaces, ", ")
+	to := strings.Join(current.Interfaces, ", ")
+	a.writeLog(fmt.Sprintf("[Network] Network changed: [%s] -> [%s]", from, to))
+	a.AddToLogBuffer(fmt.Sprintf("Сеть сменилась (%s), восстановление соединений", to))
+
+	if err := flushDNSCache(); err != nil {
+		a.writeLog(fmt.Sprintf("[Network] DNS cache flush failed: %v", err))
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if err := clashCloseConnections(client); err != nil {
+		a.writeLog(fmt.Sprintf("[Network] Failed to close sing-box connections: %v", err))
+	}
+
+	if a.nativeWG != nil && len(a.nativeWG.GetActiveTunnels()) > 0 {
+		a.nativeWG.NotifyNetworkChange()
+	}
+
+	a.emitEvent("network-changed", map[string]interface{}{
+		"previous":   previous.Interfaces,
+		"interfaces": current.Interfaces,
+	})
+}
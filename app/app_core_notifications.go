@@ -0,0 +1,60 @@
+package main
+
+// Notifications for Kampus VPN
+// This file contains showing desktop notifications for connection events
+
+import (
+	"fmt"
+)
+
+// notificationsEnabled reports whether the notifications setting is on
+func (a *App) notificationsEnabled() bool {
+	return a.storage != nil && a.storage.GetAppSettings().Notifications
+}
+
+// notify shows a notification in the background if notifications are enabled
+func (a *App) notify(title, message string) {
+	if a.notifier == nil || !a.notificationsEnabled() {
+		return
+	}
+	go a.crash.Supervise("notification", func() {
+		if err := a.notifier.Notify(title, message); err != nil {
+			a.writeLog(fmt.Sprintf("[Notify] %v", err))
+		}
+	})
+}
+
+// notifyUpdateAvailable notifies about a new version once per version
+func (a *App) notifyUpdateAvailable(version string) {
+	a.mu.Lock()
+	if a.notifiedUpdate == version {
+		a.mu.Unlock()
+		return
+	}
+	a.notifiedUpdate = version
+	a.mu.Unlock()
+
+	a.notify("Доступно обновление", fmt.Sprintf("Kampus VPN %s готов к установке", version))
+}
+
+// TestNotification shows a notification right away, ignoring the setting,
+// so the user can check that notifications work (API для фронтенда)
+func (a *App) TestNotification() map[string]interface{} {
+	if a.notifier == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("notifications_unavailable"),
+		}
+	}
+
+	if err := a.notifier.show("Kampus VPN", "Уведомления работают"); err != nil {
+		a.writeLog(fmt.Sprintf("[Notify] Test failed: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("notification_failed", err),
+		}
+	}
+	return map[string]interface{}{
+		"success": true,
+	}
+}
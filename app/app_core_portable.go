@@ -0,0 +1,105 @@
+package main
+
+// Portable mode handling for Kampus VPN
+// This file contains the removable drive watcher and the pending changes API
+
+import (
+	"fmt"
+	"time"
+)
+
+// watchPortableDrive polls for the drive to come back while changes are pending,
+// then writes them and re-opens the log file
+func (a *App) watchPortableDrive() {
+	ticker := time.NewTicker(PortableDrivePollInterval)
+	defer ticker.Stop()
+
+	wasPending := false
+	for range ticker.C {
+		pending, lastErr := a.storage.PendingChanges()
+		if !pending {
+			wasPending = false
+			continue
+		}
+
+		if !wasPending {
+			wasPending = true
+			a.writeLog(fmt.Sprintf("[Portable] Settings not saved, kept in memory: %v", lastErr))
+			a.AddToLogBuffer(a.tr("pending_changes_drive_gone"))
+			a.emitEvent("storage-pending-changes", a.tr("pending_changes"))
+		}
+
+		if !volumePresent(a.storage.GetResourcesPath()) {
+			continue
+		}
+
+		if err := a.storage.FlushPendingChanges(); err != nil {
+			continue
+		}
+
+		wasPending = false
+		a.reopenLogFile()
+		a.writeLog("[Portable] Drive is back, pending settings saved")
+		a.AddToLogBuffer("Диск снова доступен, изменения сохранены")
+		a.emitEvent("storage-changes-flushed")
+	}
+}
+
+// reopenLogFile replaces a log handle that went bad while the drive was missing
+func (a *App) reopenLogFile() {
+	if a.logFile == nil {
+		return
+	}
+	if err := a.logFile.Reopen(); err != nil {
+		a.logFile = nil
+	}
+}
+
+// getStorageStatus returns portable mode state for GetStatus
+func (a *App) getStorageStatus() map[string]interface{} {
+	if a.storage == nil {
+		return nil
+	}
+
+	pending, _ := a.storage.PendingChanges()
+	status := map[string]interface{}{
+		"portable":       a.storage.IsPortable(),
+		"pendingChanges": pending,
+	}
+	if pending {
+		status["message"] = a.tr("pending_changes")
+	}
+	return status
+}
+
+// FlushPendingChanges saves settings right away, e.g. before ejecting the drive (API для фронтенда)
+func (a *App) FlushPendingChanges() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if err := a.storage.FlushPendingChanges(); err != nil {
+		if err == ErrStorageDriveGone {
+			return map[string]interface{}{
+				"success":        false,
+				"error":          err.Error(),
+				"pendingChanges": true,
+			}
+		}
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog("Settings flushed to disk")
+	return map[string]interface{}{
+		"success": true,
+		"message": a.tr("portable_flushed"),
+	}
+}
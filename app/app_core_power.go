@@ -0,0 +1,42 @@
+package main
+
+// Suspend/resume handling for Kampus VPN
+// This file contains the reaction to the system resuming from sleep or hibernation
+
+import (
+	"fmt"
+)
+
+// startPowerWatcher subscribes to suspend/resume notifications
+func (a *App) startPowerWatcher() {
+	watcher := NewPowerWatcher(
+		func() { a.writeLog("[Power] System is suspending") },
+		a.onSystemResume,
+	)
+	if err := watcher.Start(); err != nil {
+		a.writeLog(fmt.Sprintf("[Power] Resume notifications unavailable: %v", err))
+		return
+	}
+	a.powerWatcher = watcher
+}
+
+// stopPowerWatcher unsubscribes from suspend/resume notifications
+func (a *App) stopPowerWatcher() {
+	if a.powerWatcher != nil {
+		a.powerWatcher.Stop()
+		a.powerWatcher = nil
+	}
+}
+
+// onSystemResume re-checks WireGuard tunnels right after resume instead of
+// waiting for the next health check tick
+func (a *App) onSystemResume() {
+	defer a.crash.Guard("power-resume")
+
+	a.writeLog("[Power] System resumed")
+	if a.nativeWG != nil && len(a.nativeWG.GetActiveTunnels()) > 0 {
+		a.AddToLogBuffer("Выход из спящего режима: проверка WireGuard туннелей")
+		a.nativeWG.NotifyResume()
+	}
+	a.emitEvent("system-resumed")
+}
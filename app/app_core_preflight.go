@@ -0,0 +1,102 @@
+package main
+
+// Connectivity preflight for Kampus VPN
+// This file contains the check that holds the "connected" state until a
+// request through the proxy succeeds
+
+import (
+	"fmt"
+	"time"
+)
+
+// startPreflight checks traffic through the proxy after sing-box started;
+// the tray stays "connecting" until it passes. Must be called with a.mu held.
+func (a *App) startPreflight() {
+	status := PreflightStatus{
+		State:     PreflightChecking,
+		StartedAt: time.Now(),
+	}
+
+	a.preflightMu.Lock()
+	if a.preflightStop != nil {
+		close(a.preflightStop)
+	}
+	stop := make(chan struct{})
+	a.preflightStop = stop
+	a.preflight = &status
+	a.preflightMu.Unlock()
+
+	UpdateTrayIcon("connecting")
+
+	go func() {
+		defer a.crash.Guard("preflight")
+
+		delay, err := RunPreflight(stop)
+		if err == errPreflightStopped {
+			return
+		}
+
+		a.preflightMu.Lock()
+		if a.preflightStop != stop {
+			a.preflightMu.Unlock()
+			return
+		}
+		result := *a.preflight
+		result.CheckedAt = time.Now()
+		if err != nil {
+			result.State = PreflightFailed
+			result.Error = err.Error()
+		} else {
+			result.State = PreflightVerified
+			result.Delay = delay
+		}
+		a.preflight = &result
+		a.preflightMu.Unlock()
+
+		if result.Verified() {
+			a.writeLog(fmt.Sprintf("[Preflight] Proxy verified in %s (%d ms)", result.CheckedAt.Sub(result.StartedAt).Round(100*time.Millisecond), delay))
+			// Profile readiness criteria own the tray state while they are tracked
+			if a.getReadinessStatus() == nil {
+				UpdateTrayIcon("connected")
+			}
+			a.notify("Kampus VPN", "VPN подключён")
+			a.emitEvent("vpn-connected", result.ToMap())
+		} else {
+			a.writeLog(fmt.Sprintf("[Preflight] No traffic through proxy after %s: %v", PreflightTimeout, err))
+			UpdateTrayIcon("no-internet")
+			a.notify("Kampus VPN", "VPN запущен, но интернет через прокси недоступен")
+			a.emitEvent("vpn-preflight-failed", result.ToMap())
+		}
+		a.AddToLogBuffer(result.Message())
+	}()
+}
+
+// stopPreflight stops a running check and clears the state
+func (a *App) stopPreflight() {
+	a.preflightMu.Lock()
+	defer a.preflightMu.Unlock()
+
+	if a.preflightStop != nil {
+		close(a.preflightStop)
+		a.preflightStop = nil
+	}
+	a.preflight = nil
+}
+
+// getPreflightStatus returns the check result for GetStatus (nil when stopped)
+func (a *App) getPreflightStatus() map[string]interface{} {
+	a.preflightMu.Lock()
+	defer a.preflightMu.Unlock()
+
+	if a.preflight == nil {
+		return nil
+	}
+	return a.preflight.ToMap()
+}
+
+// isConnectionVerified reports whether traffic through the proxy was confirmed
+func (a *App) isConnectionVerified() bool {
+	a.preflightMu.Lock()
+	defer a.preflightMu.Unlock()
+	return a.preflight != nil && a.preflight.Verified()
+}
@@ -0,0 +1,249 @@
+package main
+
+// Connection readiness for Kampus VPN
+// This file contains the readiness evaluation loop and the readiness criteria API
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// startReadinessCheck waits for the active profile criteria before reporting
+// the connection as established. Must be called with a.mu held.
+func (a *App) startReadinessCheck() {
+	if a.storage == nil {
+		return
+	}
+	profile, err := a.storage.GetActiveProfile()
+	if err != nil || profile.Readiness.IsEmpty() {
+		return
+	}
+
+	criteria := *profile.Readiness
+	tunnelIDs := make(map[string]int, len(profile.WireGuardConfigs))
+	for i, wg := range profile.WireGuardConfigs {
+		tunnelIDs[wg.Tag] = i
+	}
+
+	status := ReadinessStatus{
+		State:     ReadinessConnecting,
+		Unmet:     append([]string(nil), criteria.RequiredTunnels...),
+		StartedAt: time.Now(),
+	}
+	if criteria.RequireProxyReachable {
+		status.Unmet = append(status.Unmet, ReadinessProxyCriterion)
+	}
+
+	a.readinessMu.Lock()
+	if a.readinessStop != nil {
+		close(a.readinessStop)
+	}
+	stop := make(chan struct{})
+	a.readinessStop = stop
+	a.readiness = &status
+	a.readinessMu.Unlock()
+
+	UpdateTrayIcon("connecting")
+	a.AddToLogBuffer(status.Message())
+
+	// Criteria are evaluated after the measurement on connect picked a server
+	measureDone := a.measureDone
+
+	go a.crash.Supervise("readiness", func() {
+		if measureDone != nil {
+			select {
+			case <-measureDone:
+			case <-stop:
+				return
+			}
+		}
+		a.readinessLoop(criteria, tunnelIDs, stop)
+	})
+}
+
+// readinessLoop evaluates criteria until stopped; state changes update the tray and frontend
+func (a *App) readinessLoop(criteria ReadinessCriteria, tunnelIDs map[string]int, stop chan struct{}) {
+	client := &http.Client{Timeout: 6 * time.Second}
+
+	tunnelHealthy := func(tag string) bool {
+		configID, ok := tunnelIDs[tag]
+		if !ok || a.nativeWG == nil || !a.nativeWG.IsTunnelActive(configID) {
+			return false
+		}
+		healthy, _ := a.nativeWG.checkTunnelHealth(configID)
+		return healthy
+	}
+	proxyReachable := func() bool {
+		_, err := clashProxyDelay(client, "proxy", 5*time.Second)
+		return err == nil
+	}
+
+	deadline := time.Now().Add(criteria.Timeout())
+	interval := ReadinessCheckInterval
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-a.readinessKick:
+		case <-stop:
+			return
+		}
+
+		unmet := criteria.Evaluate(tunnelHealthy, proxyReachable)
+
+		a.readinessMu.Lock()
+		if a.readinessStop != stop {
+			a.readinessMu.Unlock()
+			return
+		}
+		status := *a.readiness
+		previous := status.State
+		status.Unmet = unmet
+		switch {
+		case len(unmet) == 0:
+			if previous != ReadinessReady {
+				status.ReadyAt = time.Now()
+			}
+			status.State = ReadinessReady
+		case previous == ReadinessConnecting && time.Now().Before(deadline):
+			// Still waiting
+		default:
+			status.State = ReadinessDegraded
+		}
+		a.readiness = &status
+		a.readinessMu.Unlock()
+
+		if status.State != ReadinessConnecting {
+			interval = ReadinessRecheckInterval
+		}
+		if status.State == previous {
+			continue
+		}
+
+		switch status.State {
+		case ReadinessReady:
+			UpdateTrayIcon("connected")
+			a.writeLog(fmt.Sprintf("[Readiness] Ready after %s", status.ReadyAt.Sub(status.StartedAt).Round(time.Second)))
+		case ReadinessDegraded:
+			UpdateTrayIcon("warning")
+			a.writeLog(fmt.Sprintf("[Readiness] Connected with unmet criteria: %v", unmet))
+		}
+		a.AddToLogBuffer(status.Message())
+		a.emitEvent("vpn-readiness-changed", status.ToMap())
+	}
+}
+
+// kickReadiness re-evaluates criteria right away (e.g. after a tunnel restart)
+func (a *App) kickReadiness() {
+	select {
+	case a.readinessKick <- struct{}{}:
+	default:
+	}
+}
+
+// stopReadinessCheck stops the readiness loop and clears the state
+func (a *App) stopReadinessCheck() {
+	a.readinessMu.Lock()
+	defer a.readinessMu.Unlock()
+
+	if a.readinessStop != nil {
+		close(a.readinessStop)
+		a.readinessStop = nil
+	}
+	a.readiness = nil
+}
+
+// getReadinessStatus returns readiness for GetStatus (nil if the profile has no criteria)
+func (a *App) getReadinessStatus() map[string]interface{} {
+	a.readinessMu.Lock()
+	defer a.readinessMu.Unlock()
+
+	if a.readiness == nil {
+		return nil
+	}
+	return a.readiness.ToMap()
+}
+
+// GetProfileReadiness returns readiness criteria of a profile (API для фронтенда)
+func (a *App) GetProfileReadiness(profileID int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	criteria := profile.Readiness
+	if criteria == nil {
+		criteria = &ReadinessCriteria{}
+	}
+	tags := make([]string, 0, len(profile.WireGuardConfigs))
+	for _, wg := range profile.WireGuardConfigs {
+		tags = append(tags, wg.Tag)
+	}
+
+	return map[string]interface{}{
+		"success":         true,
+		"criteria":        criteria,
+		"timeout_sec":     int(criteria.Timeout().Seconds()),
+		"available_tags":  tags,
+		"default_timeout": DefaultReadinessTimeoutSec,
+	}
+}
+
+// SetProfileReadiness sets readiness criteria of a profile; applies on the next connect (API для фронтенда)
+func (a *App) SetProfileReadiness(profileID int, criteria ReadinessCriteria) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profile, err := a.storage.GetProfile(profileID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if err := criteria.Validate(profile.WireGuardConfigs); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	var stored *ReadinessCriteria
+	if !criteria.IsEmpty() {
+		stored = &criteria
+	}
+	if err := a.storage.SetProfileReadiness(profileID, stored); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Readiness criteria updated for profile %d: tunnels=%v proxy=%v",
+		profileID, criteria.RequiredTunnels, criteria.RequireProxyReachable))
+
+	return map[string]interface{}{
+		"success":  true,
+		"criteria": criteria,
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+// Scheduled profile switching for Kampus VPN
+// This file contains the scheduler loop and the schedule settings API
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProfileScheduleCheckInterval is how often the schedule is evaluated.
+// Evaluation uses wall-clock time, so a boundary missed during sleep is
+// applied on the first tick after wake.
+const ProfileScheduleCheckInterval = 30 * time.Second
+
+// profileScheduleState is the scheduler state shown in GetStatus
+type profileScheduleState struct {
+	lastTarget int       // Last profile applied by the schedule (0 = none yet)
+	ruleIndex  int       // Matching rule (-1 = default profile)
+	nextSwitch time.Time // Next rule boundary
+	skipped    string    // Reason the last switch was skipped
+}
+
+// runProfileScheduler evaluates the schedule at startup, on every tick and on settings change
+func (a *App) runProfileScheduler() {
+	ticker := time.NewTicker(ProfileScheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.evaluateProfileSchedule(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-a.scheduleKick:
+		}
+	}
+}
+
+// kickProfileScheduler requests immediate schedule evaluation
+func (a *App) kickProfileScheduler() {
+	select {
+	case a.scheduleKick <- struct{}{}:
+	default:
+	}
+}
+
+// evaluateProfileSchedule switches to the scheduled profile when the target changes.
+// A manual switch is kept until the next boundary changes the target again.
+func (a *App) evaluateProfileSchedule(now time.Time) {
+	if a.storage == nil {
+		return
+	}
+
+	schedule := a.storage.GetAppSettings().ProfileSchedule
+	if schedule == nil || !schedule.Enabled {
+		a.scheduleMu.Lock()
+		a.schedule = profileScheduleState{}
+		a.scheduleMu.Unlock()
+		return
+	}
+
+	target, ruleIndex := schedule.Target(now)
+
+	a.scheduleMu.Lock()
+	a.schedule.ruleIndex = ruleIndex
+	a.schedule.nextSwitch = schedule.NextBoundary(now)
+	lastTarget := a.schedule.lastTarget
+	a.scheduleMu.Unlock()
+
+	if target == 0 || target == lastTarget {
+		return
+	}
+
+	if target == a.storage.GetActiveProfileID() {
+		a.setScheduleApplied(target)
+		return
+	}
+
+	if reason := a.scheduleBlockReason(target); reason != "" {
+		a.skipScheduledSwitch(target, reason)
+		return
+	}
+
+	if err := a.switchProfileReconnect(target); err != nil {
+		a.skipScheduledSwitch(target, err.Error())
+		return
+	}
+
+	a.setScheduleApplied(target)
+	a.writeLog(fmt.Sprintf("[Schedule] Switched to profile %d (rule %d)", target, ruleIndex))
+	a.AddToLogBuffer(fmt.Sprintf("Профиль переключён по расписанию: %d", target))
+	a.emitEvent("profile-schedule-switched", map[string]interface{}{
+		"profile_id": target,
+		"rule_index": ruleIndex,
+	})
+}
+
+// scheduleBlockReason returns why the scheduled switch can't happen now ("" if it can)
+func (a *App) scheduleBlockReason(target int) string {
+	a.mu.Lock()
+	restarting := a.restarting
+	a.mu.Unlock()
+	if restarting {
+		return "VPN перезапускается"
+	}
+
+	a.captiveMu.Lock()
+	waitingPortal := a.captiveStop != nil
+	a.captiveMu.Unlock()
+	if waitingPortal {
+		return "ожидается авторизация в сети Wi-Fi"
+	}
+
+	profile, err := a.storage.GetProfile(target)
+	if err != nil {
+		return fmt.Sprintf("профиль %d не найден", target)
+	}
+	if len(profile.SingboxConfig) == 0 {
+		return fmt.Sprintf("профиль '%s' не настроен", profile.Name)
+	}
+	return ""
+}
+
+// switchProfileReconnect activates the profile, reconnecting if VPN is running
+func (a *App) switchProfileReconnect(target int) error {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	a.mu.Lock()
+	if a.restarting {
+		a.mu.Unlock()
+		return fmt.Errorf("VPN перезапускается")
+	}
+	wasRunning := a.isRunning
+	if wasRunning {
+		a.restarting = true
+	}
+	a.mu.Unlock()
+
+	if !wasRunning {
+		result := a.setActiveProfile(target)
+		if success, _ := result["success"].(bool); !success {
+			return fmt.Errorf("%v", result["error"])
+		}
+		return nil
+	}
+
+	defer func() {
+		a.mu.Lock()
+		a.restarting = false
+		a.mu.Unlock()
+	}()
+
+	a.writeLog(fmt.Sprintf("Reconnecting to switch to profile %d", target))
+	a.stopVPN()
+	a.waitForStopped()
+
+	result := a.setActiveProfile(target)
+	var switchErr error
+	if success, _ := result["success"].(bool); !success {
+		// Reconnect with the previous profile
+		switchErr = fmt.Errorf("%v", result["error"])
+	}
+
+	startResult := a.startVPN()
+	if success, _ := startResult["success"].(bool); !success {
+		a.writeLog(fmt.Sprintf("Reconnect to switch profile failed: %v", startResult["error"]))
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	a.emitEvent("vpn-status-changed", running)
+
+	return switchErr
+}
+
+// setScheduleApplied remembers the applied target and clears the skip reason
+func (a *App) setScheduleApplied(target int) {
+	a.scheduleMu.Lock()
+	a.schedule.lastTarget = target
+	a.schedule.skipped = ""
+	a.scheduleMu.Unlock()
+}
+
+// skipScheduledSwitch notifies about a skipped switch once; it is retried on the next tick
+func (a *App) skipScheduledSwitch(target int, reason string) {
+	a.scheduleMu.Lock()
+	repeated := a.schedule.skipped == reason
+	a.schedule.skipped = reason
+	a.scheduleMu.Unlock()
+
+	if repeated {
+		return
+	}
+
+	message := fmt.Sprintf("Переключение профиля по расписанию отложено: %s", reason)
+	a.writeLog(fmt.Sprintf("[Schedule] Switch to profile %d skipped: %s", target, reason))
+	a.AddToLogBuffer(message)
+	a.emitEvent("profile-schedule-skipped", map[string]interface{}{
+		"profile_id": target,
+		"reason":     reason,
+		"message":    message,
+	})
+}
+
+// getProfileScheduleStatus returns schedule state for GetStatus (nil if disabled)
+func (a *App) getProfileScheduleStatus() map[string]interface{} {
+	if a.storage == nil {
+		return nil
+	}
+	schedule := a.storage.GetAppSettings().ProfileSchedule
+	if schedule == nil || !schedule.Enabled {
+		return nil
+	}
+
+	a.scheduleMu.Lock()
+	defer a.scheduleMu.Unlock()
+
+	status := map[string]interface{}{
+		"rule_index": a.schedule.ruleIndex,
+		"profile_id": a.schedule.lastTarget,
+		"skipped":    a.schedule.skipped,
+	}
+	if !a.schedule.nextSwitch.IsZero() {
+		status["next_switch"] = a.schedule.nextSwitch.Format(time.RFC3339)
+	}
+	return status
+}
+
+// GetProfileSchedule returns the profile switching schedule (API для фронтенда)
+func (a *App) GetProfileSchedule() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	schedule := a.storage.GetAppSettings().ProfileSchedule
+	if schedule == nil {
+		schedule = &ProfileSchedule{Rules: []ScheduleRule{}}
+	}
+
+	return map[string]interface{}{
+		"success":  true,
+		"schedule": schedule,
+		"state":    a.getProfileScheduleStatus(),
+	}
+}
+
+// SetProfileSchedule validates and saves the schedule, then applies it (API для фронтенда)
+func (a *App) SetProfileSchedule(schedule ProfileSchedule) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	profileExists := func(id int) bool {
+		_, err := a.storage.GetProfile(id)
+		return err == nil
+	}
+	if err := ValidateProfileSchedule(schedule, profileExists); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.ProfileSchedule = &schedule
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	// New rules apply immediately, even if they select the same profile as before
+	a.scheduleMu.Lock()
+	a.schedule = profileScheduleState{}
+	a.scheduleMu.Unlock()
+	a.kickProfileScheduler()
+
+	return map[string]interface{}{
+		"success":  true,
+		"schedule": schedule,
+	}
+}
+
+// ClearProfileSchedule removes all schedule rules (API для фронтенда)
+func (a *App) ClearProfileSchedule() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.ProfileSchedule = nil
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.kickProfileScheduler()
+
+	return map[string]interface{}{
+		"success": true,
+	}
+}
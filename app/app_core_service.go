@@ -0,0 +1,403 @@
+package main
+
+// Service mode for Kampus VPN
+// This file contains starting sing-box directly or through the installed service,
+// and the service install/uninstall API
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// ServiceInstallTimeout is how long install/uninstall wait for the service to appear/disappear
+const ServiceInstallTimeout = 30 * time.Second
+
+// singboxProcess is a running sing-box, started directly or by the service
+type singboxProcess interface {
+	Pid() int
+	Wait() error
+	Stop() error
+}
+
+// launchSingbox starts sing-box through the service when it is running,
+// otherwise (or if the service refuses) directly. Returns stdout and stderr of sing-box.
+func (a *App) launchSingbox(configPath string) (singboxProcess, io.Reader, io.Reader, error) {
+	if serviceAvailable() {
+		proc, stdout, stderr, err := startServiceSingbox(configPath)
+		if err == nil {
+			a.writeLog(fmt.Sprintf("Started sing-box via %s (pid %d)", ServiceName, proc.Pid()))
+			return proc, stdout, stderr, nil
+		}
+		a.writeLog(fmt.Sprintf("Service could not start sing-box, starting directly: %v", err))
+	}
+	return a.startDirectSingbox(configPath)
+}
+
+// --- Direct ---
+
+// directProcess is sing-box started by the app itself (needs the app elevated for TUN)
+type directProcess struct {
+	cmd *exec.Cmd
+}
+
+// startDirectSingbox starts sing-box as a child process
+func (a *App) startDirectSingbox(configPath string) (singboxProcess, io.Reader, io.Reader, error) {
+	cmd := exec.Command(a.singboxPath, "run", "-c", configPath)
+
+	// Get stdout and stderr for logging
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+
+	// Hide console window on Windows
+	if runtime.GOOS == "windows" {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			HideWindow:    true,
+			CreationFlags: 0x08000000, // CREATE_NO_WINDOW
+		}
+	}
+
+	// Set working directory to resources folder
+	if a.storage != nil {
+		cmd.Dir = a.storage.GetResourcesPath()
+	} else {
+		cmd.Dir = a.basePath
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+	return &directProcess{cmd: cmd}, stdout, stderr, nil
+}
+
+func (p *directProcess) Pid() int    { return p.cmd.Process.Pid }
+func (p *directProcess) Wait() error { return p.cmd.Wait() }
+
+// Stop terminates the process (the monitor goroutine sees Wait return)
+func (p *directProcess) Stop() error {
+	if runtime.GOOS == "windows" {
+		// On Windows use taskkill for proper termination
+		_, err := runHiddenCommand(10*time.Second, "taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", p.cmd.Process.Pid))
+		return err
+	}
+	// On Unix send SIGTERM
+	return p.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// --- Service ---
+
+// serviceProcess is sing-box run by the service; the start connection stays
+// open for its output and closes with the exit event
+type serviceProcess struct {
+	conn *os.File
+	pid  int
+	done chan struct{}
+	err  error
+}
+
+// dialService connects to the service pipe
+func dialService() (*os.File, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := os.OpenFile(servicePipeName, os.O_RDWR, 0)
+		if err == nil {
+			return conn, nil
+		}
+		// All instances busy: the service creates the next one right away
+		if errors.Is(err, windows.ERROR_PIPE_BUSY) && attempt < 5 {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		return nil, err
+	}
+}
+
+// sendServiceRequest writes one request line
+func sendServiceRequest(conn *os.File, req serviceRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+// readServiceMessage reads one message line
+func readServiceMessage(reader *bufio.Reader) (serviceMessage, error) {
+	var msg serviceMessage
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(line, &msg)
+	return msg, err
+}
+
+// callService sends a request and returns the single reply
+func callService(req serviceRequest) (serviceMessage, error) {
+	conn, err := dialService()
+	if err != nil {
+		return serviceMessage{}, err
+	}
+	defer conn.Close()
+
+	if err := sendServiceRequest(conn, req); err != nil {
+		return serviceMessage{}, err
+	}
+	msg, err := readServiceMessage(bufio.NewReader(conn))
+	if err != nil {
+		return msg, err
+	}
+	if !msg.OK {
+		return msg, errors.New(msg.Error)
+	}
+	return msg, nil
+}
+
+// serviceAvailable reports whether the service is running and answering
+func serviceAvailable() bool {
+	_, err := callService(serviceRequest{Command: ServiceCommandStatus})
+	return err == nil
+}
+
+// startServiceSingbox asks the service to start sing-box with configPath
+func startServiceSingbox(configPath string) (*serviceProcess, io.Reader, io.Reader, error) {
+	conn, err := dialService()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := sendServiceRequest(conn, serviceRequest{Command: ServiceCommandStart, ConfigPath: configPath}); err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	msg, err := readServiceMessage(reader)
+	if err == nil && !msg.OK {
+		err = errors.New(msg.Error)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	p := &serviceProcess{conn: conn, pid: msg.PID, done: make(chan struct{})}
+	go p.relay(reader, stdoutWriter, stderrWriter)
+	return p, stdoutReader, stderrReader, nil
+}
+
+// relay splits service events into stdout/stderr until the exit event
+func (p *serviceProcess) relay(reader *bufio.Reader, stdout, stderr *io.PipeWriter) {
+	defer close(p.done)
+	defer p.conn.Close()
+	defer stdout.Close()
+	defer stderr.Close()
+
+	for {
+		msg, err := readServiceMessage(reader)
+		if err != nil {
+			p.err = fmt.Errorf("связь с сервисом потеряна: %v", err)
+			return
+		}
+		switch msg.Event {
+		case ServiceEventLog:
+			out := stdout
+			if msg.Source == LogSourceErr {
+				out = stderr
+			}
+			out.Write([]byte(msg.Line + "\n"))
+		case ServiceEventExit:
+			if msg.Error != "" {
+				p.err = errors.New(msg.Error)
+			}
+			return
+		}
+	}
+}
+
+func (p *serviceProcess) Pid() int { return p.pid }
+
+// Wait waits for the exit event of the session
+func (p *serviceProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Stop asks the service to terminate sing-box
+func (p *serviceProcess) Stop() error {
+	_, err := callService(serviceRequest{Command: ServiceCommandStop})
+	return err
+}
+
+// --- Install ---
+
+// serviceInstalled reports whether the service is registered
+func serviceInstalled() bool {
+	_, err := runHiddenCommand(10*time.Second, "sc", "query", ServiceName)
+	return err == nil
+}
+
+// runElevatedCommandLine runs a cmd.exe command line with admin rights
+// (one UAC prompt, none if the app is already elevated)
+func runElevatedCommandLine(commandLine string) error {
+	verb, _ := windows.UTF16PtrFromString("runas")
+	file, _ := windows.UTF16PtrFromString("cmd.exe")
+	args, _ := windows.UTF16PtrFromString("/C " + commandLine)
+	return windows.ShellExecute(0, verb, file, args, nil, windows.SW_HIDE)
+}
+
+// serviceInstallCommandLine copies the executable and sing-box into installDir,
+// makes it admin-only and registers the service running from there. The app
+// folder stays writable by the user, so SYSTEM never runs binaries from it.
+func serviceInstallCommandLine(installDir, exePath, singboxPath, resourcesPath string) string {
+	serviceExe := filepath.Join(installDir, filepath.Base(exePath))
+	binDir := filepath.Join(installDir, "bin")
+	binPath := fmt.Sprintf(`\"%s\" %s %s \"%s\"`, serviceExe, ServiceFlag, ServiceResourcesFlag, resourcesPath)
+
+	steps := []string{
+		fmt.Sprintf(`(if not exist "%s" mkdir "%s")`, binDir, binDir),
+		fmt.Sprintf(`copy /Y "%s" "%s"`, exePath, serviceExe),
+		fmt.Sprintf(`copy /Y "%s" "%s"`, singboxPath, filepath.Join(binDir, "sing-box.exe")),
+		// Owner administrators; SYSTEM and administrators full access, users read-only
+		fmt.Sprintf(`icacls "%s" /setowner *S-1-5-32-544 /T /Q`, installDir),
+		fmt.Sprintf(`icacls "%s" /inheritance:r /grant:r *S-1-5-18:(OI)(CI)F *S-1-5-32-544:(OI)(CI)F *S-1-5-32-545:(OI)(CI)RX /T /Q`, installDir),
+		fmt.Sprintf(`sc create %s binPath= "%s" start= auto DisplayName= "%s"`, ServiceName, binPath, ServiceDisplayName),
+		"sc start " + ServiceName,
+	}
+	return strings.Join(steps, " && ")
+}
+
+// waitService polls until ready reports true or ServiceInstallTimeout passes
+func waitService(ready func() bool) bool {
+	deadline := time.Now().Add(ServiceInstallTimeout)
+	for time.Now().Before(deadline) {
+		if ready() {
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return false
+}
+
+// GetServiceStatus returns whether the service is installed, running and used
+// by the current connection (API для фронтенда)
+func (a *App) GetServiceStatus() map[string]interface{} {
+	a.mu.Lock()
+	_, inUse := a.singbox.(*serviceProcess)
+	a.mu.Unlock()
+
+	return map[string]interface{}{
+		"success":   true,
+		"installed": serviceInstalled(),
+		"running":   serviceAvailable(),
+		"inUse":     inUse,
+	}
+}
+
+// InstallService copies the app and sing-box into the admin-only service folder,
+// registers and starts the service, so VPN can be started without running the
+// app as administrator (API для фронтенда)
+func (a *App) InstallService() map[string]interface{} {
+	if runtime.GOOS != "windows" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("service_windows_only"),
+		}
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("exe_path_failed", err),
+		}
+	}
+
+	if a.storage == nil || a.singboxPath == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("service_files_missing"),
+		}
+	}
+
+	installDir := serviceInstallDir()
+	if !serviceInstalled() {
+		commandLine := serviceInstallCommandLine(installDir, exePath, a.singboxPath, a.storage.GetResourcesPath())
+		a.writeLog(fmt.Sprintf("Installing %s: %s", ServiceName, commandLine))
+		if err := runElevatedCommandLine(commandLine); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("service_install_failed", err),
+			}
+		}
+	} else {
+		runElevatedCommandLine("sc start " + ServiceName)
+	}
+
+	if !waitService(serviceAvailable) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("service_not_started", filepath.Join(installDir, serviceDataFolder, "service.log")),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("%s installed and running", ServiceName))
+	a.AddToLogBuffer("Сервис установлен: VPN запускается без прав администратора")
+	return map[string]interface{}{
+		"success": true,
+	}
+}
+
+// UninstallService stops and removes the service (API для фронтенда)
+func (a *App) UninstallService() map[string]interface{} {
+	a.mu.Lock()
+	_, inUse := a.singbox.(*serviceProcess)
+	running := a.isRunning
+	a.mu.Unlock()
+	if running && inUse {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("service_vpn_running"),
+		}
+	}
+
+	if !serviceInstalled() {
+		return map[string]interface{}{
+			"success": true,
+		}
+	}
+
+	// The folder is removed once the stopped service has released its exe
+	commandLine := fmt.Sprintf(`sc stop %s & sc delete %s & ping -n 3 127.0.0.1 >nul & rmdir /S /Q "%s"`,
+		ServiceName, ServiceName, serviceInstallDir())
+	if err := runElevatedCommandLine(commandLine); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("service_uninstall_failed", err),
+		}
+	}
+
+	if !waitService(func() bool { return !serviceInstalled() }) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("service_delete_pending"),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("%s uninstalled", ServiceName))
+	a.AddToLogBuffer("Сервис удалён")
+	return map[string]interface{}{
+		"success": true,
+	}
+}
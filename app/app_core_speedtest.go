@@ -0,0 +1,200 @@
+package main
+
+// Speed test for Kampus VPN
+// This file contains the speed test inbound port, the background speed monitor
+// lifecycle and the speed test API
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// selectSpeedTestPort picks the port of the speed test inbound for the next
+// sing-box start (none when the speed test is off). Must be called with a.mu held.
+func (a *App) selectSpeedTestPort() {
+	if a.storage == nil {
+		return
+	}
+	port := 0
+	if a.storage.GetAppSettings().SpeedTest.Enabled {
+		var err error
+		if port, err = pickLocalInboundPort(); err != nil {
+			a.writeLog(fmt.Sprintf("[SpeedTest] No free port (%v), speed test unavailable this session", err))
+		}
+	}
+	a.storage.SetSpeedTestPort(port)
+}
+
+// startSpeedMonitor starts the background speed test if enabled in settings.
+// Must be called with a.mu held.
+func (a *App) startSpeedMonitor() {
+	if a.storage == nil {
+		return
+	}
+	settings := a.storage.GetAppSettings().SpeedTest
+	port := a.storage.GetSpeedTestPort()
+	if !settings.Enabled || !settings.AutoSwitch || port == 0 {
+		return
+	}
+
+	monitor := NewSpeedMonitor(settings, port, &a.speedTestMu, a.writeLog)
+	monitor.SetCallbacks(
+		func(result SpeedTestResult) {
+			a.emitEvent("speed-test-result", result)
+		},
+		func(sw SpeedSwitch) {
+			// Stop returns the selector to auto-select, as after the measurement on connect
+			a.mu.Lock()
+			a.measurePinned = true
+			a.mu.Unlock()
+			a.AddToLogBuffer(fmt.Sprintf("Сервер %s медленный (меньше %.1f Мбит/с), переключено на %s",
+				sw.From, settings.Normalized().MinMbps, sw.To))
+			a.emitEvent("speed-test-switch", sw)
+		},
+	)
+	monitor.Start()
+	a.speedMonitor = monitor
+}
+
+// stopSpeedMonitor stops the background speed test if it is running.
+func (a *App) stopSpeedMonitor() {
+	a.mu.Lock()
+	monitor := a.speedMonitor
+	a.speedMonitor = nil
+	a.mu.Unlock()
+
+	if monitor != nil {
+		monitor.Stop()
+	}
+}
+
+// RunSpeedTest measures the throughput of a server (current one if proxyName
+// is empty); the selection is restored afterwards (API для фронтенда)
+func (a *App) RunSpeedTest(proxyName string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings().SpeedTest
+	if !settings.Enabled {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("speedtest_disabled"),
+		}
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	port := a.storage.GetSpeedTestPort()
+	if !running || port == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("speedtest_needs_vpn"),
+		}
+	}
+
+	if !a.speedTestMu.TryLock() {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("speedtest_running"),
+		}
+	}
+	result := RunProxySpeedTest(port, proxyName, settings)
+	a.speedTestMu.Unlock()
+
+	a.writeLog(fmt.Sprintf("[SpeedTest] %s: %.1f Mbps (%d bytes in %.1fs) %s",
+		result.Proxy, result.Mbps, result.Bytes, result.DurationSec, result.Error))
+	if result.Error != "" && result.Bytes == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("speedtest_failed", result.Error),
+			"result":  result,
+		}
+	}
+	a.emitEvent("speed-test-result", result)
+	return map[string]interface{}{
+		"success": true,
+		"result":  result,
+	}
+}
+
+// SaveSpeedTestSettings saves the speed test settings (API для фронтенда)
+// The inbound and the background test change on the next VPN start; disabling
+// the background test takes effect immediately.
+func (a *App) SaveSpeedTestSettings(enabled bool, testURL string, durationSec int, autoSwitch bool, intervalMin int, minMbps float64) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	testURL = strings.TrimSpace(testURL)
+	if testURL != "" {
+		if u, err := url.Parse(testURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("speedtest_url_invalid"),
+			}
+		}
+	}
+	if durationSec < 0 || durationSec > 60 || intervalMin < 0 || minMbps < 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("speedtest_params_invalid"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.SpeedTest = SpeedTestSettings{
+		Enabled:     enabled,
+		URL:         testURL,
+		DurationSec: durationSec,
+		AutoSwitch:  autoSwitch,
+		IntervalMin: intervalMin,
+		MinMbps:     minMbps,
+	}.Normalized()
+	if settings.SpeedTest.URL == DefaultSpeedTestURL {
+		settings.SpeedTest.URL = ""
+	}
+
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	if !enabled || !autoSwitch {
+		a.stopSpeedMonitor()
+	}
+
+	return map[string]interface{}{
+		"success": true,
+	}
+}
+
+// --- Storage ---
+
+// SetSpeedTestPort sets the speed test inbound port runtime configs use (0 = none).
+func (s *Storage) SetSpeedTestPort(port int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speedTestPort = port
+}
+
+// GetSpeedTestPort returns the speed test inbound port of the current session.
+func (s *Storage) GetSpeedTestPort() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.speedTestPort
+}
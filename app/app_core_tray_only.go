@@ -0,0 +1,153 @@
+package main
+
+// Tray-only mode for Kampus VPN
+// This file contains the lite mode that defers the window and the tray menu actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TrayOnlyFlag starts the app without the window
+const TrayOnlyFlag = "--tray-only"
+
+// MinimizedFlag is added to the autostart entry with StartMinimized; the
+// window is deferred like in tray-only mode
+const MinimizedFlag = "--minimized"
+
+// TrayProfileSlots is the number of profiles listed in the tray menu
+const TrayProfileSlots = 10
+
+// trayOnlyRequested reports whether to start without the window:
+// the --tray-only or --minimized flag or the saved setting
+func trayOnlyRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == TrayOnlyFlag || arg == MinimizedFlag {
+			return true
+		}
+	}
+	return trayOnlySetting()
+}
+
+// trayOnlySetting reads the setting directly, storage isn't initialized yet
+func trayOnlySetting() bool {
+	exePath, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	exePath, _ = filepath.EvalSymlinks(exePath)
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(exePath), ResourcesFolder, SettingsFileName))
+	if err != nil {
+		return false
+	}
+	var settings SettingsFile
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return false
+	}
+	return settings.App.TrayOnly
+}
+
+// requestGUI lets main start the window in tray-only mode
+func (a *App) requestGUI() {
+	a.guiRequestOnce.Do(func() {
+		a.writeLog("Window requested from tray, starting GUI")
+		close(a.guiRequested)
+	})
+}
+
+// getTrayOnlyStatus returns tray-only mode state for GetStatus
+func (a *App) getTrayOnlyStatus() map[string]interface{} {
+	enabled := false
+	if a.storage != nil {
+		enabled = a.storage.GetAppSettings().TrayOnly
+	}
+	return map[string]interface{}{
+		"active":  a.trayOnly,
+		"enabled": enabled,
+	}
+}
+
+// TrayToggleConnection connects or disconnects VPN from the tray menu
+func (a *App) TrayToggleConnection() {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+
+	if running {
+		a.stopVPN()
+		return
+	}
+
+	result := a.startVPN()
+	if success, _ := result["success"].(bool); !success {
+		a.writeLog(fmt.Sprintf("Tray connect failed: %v", result["error"]))
+		ShowTrayMessage(a.tr("connect_failed", result["error"]))
+	}
+}
+
+// TraySwitchProfile activates a profile from the tray menu, reconnecting if needed
+func (a *App) TraySwitchProfile(id int) {
+	if a.storage == nil || a.storage.GetActiveProfileID() == id {
+		return
+	}
+	if err := a.switchProfileReconnect(id); err != nil {
+		a.writeLog(fmt.Sprintf("Tray profile switch failed: %v", err))
+		ShowTrayMessage(a.tr("profile_switch_failed", err))
+		return
+	}
+
+	if profile, err := a.storage.GetProfile(id); err == nil {
+		a.AddToLogBuffer(fmt.Sprintf("Профиль '%s' выбран из трея", profile.Name))
+	}
+	a.emitEvent("profile-changed", id)
+}
+
+// trayMenuState returns what the tray menu shows: connection state and profiles
+func (a *App) trayMenuState() (running bool, profiles []ProfileData, activeID int) {
+	a.mu.Lock()
+	running = a.isRunning
+	a.mu.Unlock()
+
+	if a.storage == nil {
+		return running, nil, 0
+	}
+	profiles = a.storage.GetAllProfiles()
+	if len(profiles) > TrayProfileSlots {
+		profiles = profiles[:TrayProfileSlots]
+	}
+	return running, profiles, a.storage.GetActiveProfileID()
+}
+
+// SetTrayOnlyMode saves the tray-only setting; applies on the next launch (API для фронтенда)
+func (a *App) SetTrayOnlyMode(enabled bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.TrayOnly = enabled
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Tray-only mode on next launch: %v", enabled))
+	return map[string]interface{}{
+		"success":  true,
+		"trayOnly": enabled,
+		"message":  a.tr("tray_only_on_restart"),
+	}
+}
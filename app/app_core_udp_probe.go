@@ -0,0 +1,234 @@
+package main
+
+// UDP capability probe for Kampus VPN
+// This file contains probing UDP relay of proxies after connect and on demand,
+// and the settings that keep proxies without UDP out of auto-select
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// selectUDPProbePort picks the port of the UDP probe inbound for the next
+// sing-box start. Must be called with a.mu held.
+func (a *App) selectUDPProbePort() {
+	if a.storage == nil {
+		return
+	}
+	port, err := pickLocalInboundPort()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[UDPProbe] No free port (%v), UDP probe unavailable this session", err))
+	}
+	a.storage.SetUDPProbePort(port)
+}
+
+// startUDPProbe probes all proxies once the connection settled, unless the
+// probe on connect is off. Must be called with a.mu held.
+func (a *App) startUDPProbe() {
+	if a.udpProbeStop != nil {
+		close(a.udpProbeStop)
+		a.udpProbeStop = nil
+	}
+	if a.storage == nil || a.storage.GetAppSettings().DisableUDPProbe || a.storage.GetUDPProbePort() == 0 {
+		return
+	}
+	stop := make(chan struct{})
+	a.udpProbeStop = stop
+
+	go a.crash.Supervise("udp-probe", func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(UDPProbeStartDelay):
+		}
+		if _, err := a.probeUDPCapabilities(stop, nil); err != nil {
+			a.writeLog(fmt.Sprintf("[UDPProbe] Probe after connect failed: %v", err))
+		}
+	})
+}
+
+// stopUDPProbe stops a running probe
+func (a *App) stopUDPProbe() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.udpProbeStop != nil {
+		close(a.udpProbeStop)
+		a.udpProbeStop = nil
+	}
+}
+
+// probeUDPCapabilities probes the given proxies (all if names is empty) one
+// by one and stores the results in the active profile. Only one probe runs at
+// a time.
+func (a *App) probeUDPCapabilities(stop chan struct{}, names []string) (map[string]UDPCapability, error) {
+	if !a.udpProbeMu.TryLock() {
+		return nil, fmt.Errorf("%s", a.tr("udp_probe_running"))
+	}
+	defer a.udpProbeMu.Unlock()
+
+	port := a.storage.GetUDPProbePort()
+	if port == 0 {
+		return nil, fmt.Errorf("%s", a.tr("udp_probe_unavailable"))
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	members, _, err := clashGroupMembers(client, udpProbeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("%s", a.tr("udp_probe_unavailable"))
+	}
+	if len(names) == 0 {
+		names = members
+	} else {
+		known := map[string]bool{}
+		for _, member := range members {
+			known[member] = true
+		}
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("%s", a.tr("udp_probe_unknown_proxy", name))
+			}
+		}
+	}
+
+	results := make(map[string]UDPCapability, len(names))
+	without := 0
+	for _, name := range names {
+		select {
+		case <-stop:
+			return results, fmt.Errorf("stopped")
+		default:
+		}
+
+		capability := UDPCapability{Status: UDPSupportUnknown, CheckedAt: time.Now()}
+		if err := clashSelectProxy(client, udpProbeSelector, name); err != nil {
+			capability.Error = err.Error()
+		} else if ok, err := probeUDPRelay(port, UDPProbeTimeout); err != nil {
+			capability.Error = err.Error()
+		} else if ok {
+			capability.Status = UDPSupportYes
+		} else {
+			capability.Status = UDPSupportNo
+			without++
+		}
+		results[name] = capability
+	}
+
+	if err := a.storage.SetProfileUDPCapabilities(a.storage.GetActiveProfileID(), results); err != nil {
+		a.writeLog(fmt.Sprintf("[UDPProbe] Failed to save results: %v", err))
+	}
+	a.writeLog(fmt.Sprintf("[UDPProbe] Probed %d proxies, %d without UDP", len(results), without))
+	if without > 0 {
+		a.AddToLogBuffer(fmt.Sprintf("Серверов без поддержки UDP: %d из %d", without, len(results)))
+	}
+	a.emitEvent("udp-probe-finished", results)
+	return results, nil
+}
+
+// ProbeProxyCapabilities probes UDP relay of a proxy and returns the result;
+// an empty name probes all proxies in the background and reports them with the
+// "udp-probe-finished" event (API для фронтенда)
+func (a *App) ProbeProxyCapabilities(name string) map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if !running || a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+
+	if name == "" {
+		go a.crash.Supervise("udp-probe-all", func() {
+			if _, err := a.probeUDPCapabilities(nil, nil); err != nil {
+				a.writeLog(fmt.Sprintf("[UDPProbe] Probe failed: %v", err))
+				a.emitEvent("udp-probe-finished", map[string]UDPCapability{})
+			}
+		})
+		return map[string]interface{}{
+			"success": true,
+			"started": true,
+		}
+	}
+
+	results, err := a.probeUDPCapabilities(nil, []string{name})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"udp":     results[name],
+	}
+}
+
+// GetUDPProbeSettings returns the UDP probe settings (API для фронтенда)
+func (a *App) GetUDPProbeSettings() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	settings := a.storage.GetAppSettings()
+	return map[string]interface{}{
+		"success":          true,
+		"probe_on_connect": !settings.DisableUDPProbe,
+		"exclude_non_udp":  settings.ExcludeNonUDPNodes,
+	}
+}
+
+// SetUDPProbeSettings turns the UDP probe after connect and keeping proxies
+// without UDP out of auto-select on or off. A changed exclusion rebuilds the
+// active profile and reconnects if VPN is running (API для фронтенда)
+func (a *App) SetUDPProbeSettings(probeOnConnect, excludeNonUDP bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil || a.configBuilder == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	rebuild := settings.ExcludeNonUDPNodes != excludeNonUDP
+	settings.DisableUDPProbe = !probeOnConnect
+	settings.ExcludeNonUDPNodes = excludeNonUDP
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+	a.writeLog(fmt.Sprintf("UDP probe on connect: %v, exclude non-UDP nodes: %v", probeOnConnect, excludeNonUDP))
+
+	restarting := false
+	if rebuild {
+		profile, err := a.storage.GetActiveProfile()
+		if err == nil && len(profile.SingboxConfig) > 0 && profile.SubscriptionURL != "" {
+			if err := a.configBuilder.BuildConfigForProfile(profile.ID, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+				return a.rebuildErrorResult(err)
+			}
+			a.mu.Lock()
+			restarting = a.isRunning
+			a.mu.Unlock()
+			if restarting {
+				go a.restartVPN("Исключение серверов без UDP")
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"restarting": restarting,
+	}
+}
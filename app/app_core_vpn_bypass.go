@@ -0,0 +1,173 @@
+package main
+
+// Temporary VPN bypass for Kampus VPN
+// This file contains disconnecting for a few minutes (e.g. to log into a captive portal) and reconnecting afterwards
+
+import (
+	"fmt"
+	"time"
+)
+
+// Temporary bypass limits
+const (
+	// MaxBypassMinutes is the longest bypass accepted.
+	MaxBypassMinutes = 60
+	// BypassCountdownInterval is how often the remaining time is sent to the frontend.
+	BypassCountdownInterval = time.Second
+)
+
+// TemporarilyBypassVPN disconnects VPN and connects it again after minutes.
+// The bypass lives in memory only: quitting the app during it doesn't
+// reconnect on the next launch (API для фронтенда)
+func (a *App) TemporarilyBypassVPN(minutes int) map[string]interface{} {
+	a.waitForInit()
+
+	if minutes < 1 || minutes > MaxBypassMinutes {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_bypass_invalid", MaxBypassMinutes),
+		}
+	}
+
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if !running {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+
+	// Stop also ends a previous bypass, so calling again restarts the countdown
+	a.stopVPN()
+	a.waitForStopped()
+
+	until := time.Now().Add(time.Duration(minutes) * time.Minute)
+	a.startBypass(until)
+
+	a.writeLog(fmt.Sprintf("[Bypass] VPN bypassed for %d min, reconnecting at %s", minutes, until.Format("15:04:05")))
+	a.AddToLogBuffer(fmt.Sprintf("VPN приостановлен на %d мин", minutes))
+	a.emitEvent("vpn-status-changed", false)
+	return map[string]interface{}{
+		"success": true,
+		"bypass":  a.getBypassStatus(),
+	}
+}
+
+// CancelVPNBypass ends the bypass early and connects VPN now (API для фронтенда)
+func (a *App) CancelVPNBypass() map[string]interface{} {
+	a.waitForInit()
+
+	if !a.cancelBypass("cancelled") {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_bypass_inactive"),
+		}
+	}
+
+	a.writeLog("[Bypass] Cancelled, connecting")
+	result := a.Start()
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	a.emitEvent("vpn-status-changed", running)
+	return result
+}
+
+// startBypass runs the countdown and connects VPN when it expires
+func (a *App) startBypass(until time.Time) {
+	stop := make(chan struct{})
+	a.bypassMu.Lock()
+	a.bypassStop = stop
+	a.bypassUntil = until
+	a.bypassMu.Unlock()
+
+	a.emitEvent("vpn-bypass-started", map[string]interface{}{
+		"until":     until.Format(time.RFC3339),
+		"remaining": int(time.Until(until).Seconds()),
+	})
+
+	go a.crash.Supervise("vpn-bypass", func() {
+		ticker := time.NewTicker(BypassCountdownInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			remaining := time.Until(until)
+			if remaining > 0 {
+				a.emitEvent("vpn-bypass-countdown", int(remaining.Round(time.Second).Seconds()))
+				continue
+			}
+
+			a.bypassMu.Lock()
+			if a.bypassStop != stop {
+				// Cancelled while the ticker fired
+				a.bypassMu.Unlock()
+				return
+			}
+			a.bypassStop = nil
+			a.bypassUntil = time.Time{}
+			a.bypassMu.Unlock()
+
+			a.writeLog("[Bypass] Time is up, connecting")
+			a.emitEvent("vpn-bypass-ended", "expired")
+			result := a.Start()
+			if success, _ := result["success"].(bool); !success {
+				a.writeLog(fmt.Sprintf("[Bypass] Reconnect failed: %v", result["error"]))
+				a.AddToLogBuffer(fmt.Sprintf("Не удалось подключиться после паузы: %v", result["error"]))
+			} else {
+				a.AddToLogBuffer("VPN снова подключён после паузы")
+			}
+			a.mu.Lock()
+			running := a.isRunning
+			a.mu.Unlock()
+			a.emitEvent("vpn-status-changed", running)
+			return
+		}
+	})
+}
+
+// cancelBypass stops the countdown without connecting; reports whether a
+// bypass was active. Called on manual connect/disconnect and on exit.
+func (a *App) cancelBypass(reason string) bool {
+	a.bypassMu.Lock()
+	stop := a.bypassStop
+	a.bypassStop = nil
+	a.bypassUntil = time.Time{}
+	a.bypassMu.Unlock()
+
+	if stop == nil {
+		return false
+	}
+	close(stop)
+	a.writeLog(fmt.Sprintf("[Bypass] Ended: %s", reason))
+	a.emitEvent("vpn-bypass-ended", reason)
+	return true
+}
+
+// getBypassStatus returns the running bypass for GetStatus (nil if none)
+func (a *App) getBypassStatus() map[string]interface{} {
+	a.bypassMu.Lock()
+	defer a.bypassMu.Unlock()
+
+	if a.bypassStop == nil {
+		return nil
+	}
+	remaining := time.Until(a.bypassUntil)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return map[string]interface{}{
+		"until":     a.bypassUntil.Format(time.RFC3339),
+		"remaining": int(remaining.Round(time.Second).Seconds()),
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+// Conflicting VPN check for Kampus VPN
+// This file contains the pre-start check for other VPNs and its override
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkConflictingVPNs looks for other VPNs taking the default route before
+// connecting. Returns an error result naming them, nil if start can go on.
+func (a *App) checkConflictingVPNs() map[string]interface{} {
+	a.mu.Lock()
+	running := a.isRunning
+	ignore := a.ignoreVPNConflicts
+	a.mu.Unlock()
+	if running {
+		return nil
+	}
+
+	conflicts, err := DetectConflictingVPNs()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Warning: conflicting VPN check failed: %v", err))
+		return nil
+	}
+	blocking := blockingConflicts(conflicts)
+	if len(blocking) == 0 {
+		// The override lasts until the conflict is gone
+		a.mu.Lock()
+		a.ignoreVPNConflicts = false
+		a.mu.Unlock()
+		return nil
+	}
+
+	names := make([]string, 0, len(blocking))
+	for _, c := range blocking {
+		names = append(names, fmt.Sprintf("%s (%s)", c.Name, c.Kind))
+	}
+	if ignore {
+		a.writeLog(fmt.Sprintf("Starting despite conflicting VPN: %s", strings.Join(names, ", ")))
+		return nil
+	}
+
+	a.writeLog(fmt.Sprintf("Start refused, conflicting VPN routes all traffic: %s", strings.Join(names, ", ")))
+	message := a.tr("vpn_conflict", strings.Join(names, ", "))
+	a.AddToLogBuffer(message)
+	return map[string]interface{}{
+		"success":      false,
+		"error":        message,
+		"conflicts":    blocking,
+		"can_override": true,
+	}
+}
+
+// CheckConflictingVPNs returns adapters of other VPNs that are up (API для фронтенда)
+func (a *App) CheckConflictingVPNs() map[string]interface{} {
+	conflicts, err := DetectConflictingVPNs()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"success":   true,
+		"conflicts": conflicts,
+		"blocking":  len(blockingConflicts(conflicts)) > 0,
+	}
+}
+
+// StartIgnoringConflicts starts VPN even though another VPN routes all
+// traffic; automatic reconnects keep ignoring it until it is gone (API для фронтенда)
+func (a *App) StartIgnoringConflicts() map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	a.ignoreVPNConflicts = true
+	a.mu.Unlock()
+
+	return a.Start()
+}
@@ -0,0 +1,248 @@
+package main
+
+// VPN pause for Kampus VPN
+// This file contains pausing the VPN without stopping sing-box: the "proxy"
+// selector is switched to direct and switched back on resume, which is much
+// faster than tearing down and setting up the TUN. Rules of the custom routing
+// mode that name a proxy directly instead of the selector stay as they are.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// VPN pause limits
+const (
+	// DefaultPauseMinutes is how long a pause lasts unless settings say otherwise.
+	DefaultPauseMinutes = 15
+	// MaxPauseMinutes is the longest pause accepted in settings.
+	MaxPauseMinutes = 240
+	// pauseSelectTimeout bounds one Clash API call of pause and resume.
+	pauseSelectTimeout = 5 * time.Second
+)
+
+// PauseMinutes returns how long a pause lasts
+func (s GlobalAppSettings) PauseMinutes() int {
+	if s.PauseTimeoutMinutes <= 0 {
+		return DefaultPauseMinutes
+	}
+	return s.PauseTimeoutMinutes
+}
+
+// PauseVPN routes all traffic direct while sing-box keeps running; the pause
+// ends by itself after the pause timeout from settings (API для фронтенда)
+func (a *App) PauseVPN() map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if !running {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_not_running"),
+		}
+	}
+	if status := a.getPauseStatus(); status != nil {
+		return map[string]interface{}{
+			"success": true,
+			"pause":   status,
+		}
+	}
+
+	client := &http.Client{Timeout: pauseSelectTimeout}
+	_, previous, err := clashGroupMembers(client, ConnectMeasureSelector)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_pause_failed", err),
+		}
+	}
+	if err := clashSelectProxy(client, ConnectMeasureSelector, "direct"); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_pause_failed", err),
+		}
+	}
+	// sing-box answers 204 even if it ignored the change
+	if _, now, err := clashGroupMembers(client, ConnectMeasureSelector); err != nil || now != "direct" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_pause_failed", fmt.Sprintf("selector is %q", now)),
+		}
+	}
+
+	minutes := DefaultPauseMinutes
+	if a.storage != nil {
+		minutes = a.storage.GetAppSettings().PauseMinutes()
+	}
+	until := time.Now().Add(time.Duration(minutes) * time.Minute)
+	a.startPause(previous, until)
+
+	a.writeLog(fmt.Sprintf("[Pause] VPN paused for %d min (was %s)", minutes, previous))
+	a.AddToLogBuffer(fmt.Sprintf("VPN на паузе %d мин: трафик идёт напрямую", minutes))
+	UpdateTrayIcon("paused")
+	return map[string]interface{}{
+		"success": true,
+		"pause":   a.getPauseStatus(),
+	}
+}
+
+// ResumeVPN ends the pause and selects the outbound used before it (API для фронтенда)
+func (a *App) ResumeVPN() map[string]interface{} {
+	a.waitForInit()
+
+	if err := a.resumePause("resumed"); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"success": true,
+	}
+}
+
+// startPause records the pause and ends it when the timeout expires
+func (a *App) startPause(previous string, until time.Time) {
+	stop := make(chan struct{})
+	a.pauseMu.Lock()
+	a.pauseStop = stop
+	a.pauseUntil = until
+	a.pausedProxy = previous
+	a.pauseMu.Unlock()
+
+	a.emitEvent("vpn-paused", map[string]interface{}{
+		"until":    until.Format(time.RFC3339),
+		"previous": previous,
+	})
+
+	go a.crash.Supervise("vpn-pause", func() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		if err := a.resumePause("expired"); err != nil {
+			a.writeLog(fmt.Sprintf("[Pause] Resume after timeout failed: %v", err))
+		} else {
+			a.notify("Kampus VPN", "Пауза закончилась, VPN снова работает")
+		}
+	})
+}
+
+// resumePause selects the outbound of before the pause again. An outbound
+// missing from the selector by now falls back to automatic selection.
+func (a *App) resumePause(reason string) error {
+	a.pauseMu.Lock()
+	stop := a.pauseStop
+	previous := a.pausedProxy
+	a.pauseStop = nil
+	a.pauseUntil = time.Time{}
+	a.pausedProxy = ""
+	a.pauseMu.Unlock()
+
+	if stop == nil {
+		return fmt.Errorf("%s", a.tr("vpn_pause_inactive"))
+	}
+	close(stop)
+
+	client := &http.Client{Timeout: pauseSelectTimeout}
+	members, _, err := clashGroupMembers(client, ConnectMeasureSelector)
+	if err != nil {
+		a.emitEvent("vpn-resumed", reason)
+		return fmt.Errorf("%s", a.tr("vpn_resume_failed", err))
+	}
+	target := ConnectMeasureGroup
+	for _, member := range members {
+		if member == previous {
+			target = previous
+			break
+		}
+	}
+	if err := clashSelectProxy(client, ConnectMeasureSelector, target); err != nil {
+		a.emitEvent("vpn-resumed", reason)
+		return fmt.Errorf("%s", a.tr("vpn_resume_failed", err))
+	}
+
+	a.writeLog(fmt.Sprintf("[Pause] Ended (%s), selected %s", reason, target))
+	a.AddToLogBuffer("Пауза VPN закончилась")
+	UpdateTrayIcon("connected")
+	a.emitEvent("vpn-resumed", reason)
+	return nil
+}
+
+// endPause forgets the pause without touching the selector (sing-box is gone
+// or another server was selected); reports whether a pause was active
+func (a *App) endPause(reason string) bool {
+	a.pauseMu.Lock()
+	stop := a.pauseStop
+	a.pauseStop = nil
+	a.pauseUntil = time.Time{}
+	a.pausedProxy = ""
+	a.pauseMu.Unlock()
+
+	if stop == nil {
+		return false
+	}
+	close(stop)
+	a.writeLog(fmt.Sprintf("[Pause] Ended: %s", reason))
+	a.emitEvent("vpn-resumed", reason)
+	return true
+}
+
+// getPauseStatus returns the running pause for GetStatus (nil if none)
+func (a *App) getPauseStatus() map[string]interface{} {
+	a.pauseMu.Lock()
+	defer a.pauseMu.Unlock()
+
+	if a.pauseStop == nil {
+		return nil
+	}
+	remaining := time.Until(a.pauseUntil)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return map[string]interface{}{
+		"until":     a.pauseUntil.Format(time.RFC3339),
+		"remaining": int(remaining.Round(time.Second).Seconds()),
+		"previous":  a.pausedProxy,
+	}
+}
+
+// SetPauseTimeout sets how long a VPN pause lasts (0 = default) (API для фронтенда)
+func (a *App) SetPauseTimeout(minutes int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	if minutes < 0 || minutes > MaxPauseMinutes {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_pause_timeout_invalid", MaxPauseMinutes),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.PauseTimeoutMinutes = minutes
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Pause timeout: %d min", settings.PauseMinutes()))
+	return map[string]interface{}{
+		"success": true,
+		"minutes": settings.PauseMinutes(),
+	}
+}
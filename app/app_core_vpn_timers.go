@@ -0,0 +1,224 @@
+package main
+
+// Scheduled connect/disconnect for Kampus VPN
+// This file contains the VPN timer loop and the timer settings API
+
+import (
+	"fmt"
+	"time"
+)
+
+// startVPNTimers starts the timer loop; stopVPNTimers waits for it to finish
+func (a *App) startVPNTimers() {
+	a.timerStop = make(chan struct{})
+	a.timerDone = make(chan struct{})
+	go func() {
+		defer close(a.timerDone)
+		a.crash.Supervise("vpn-timers", a.runVPNTimers)
+	}()
+}
+
+// stopVPNTimers stops the timer loop before the app exits
+func (a *App) stopVPNTimers() {
+	if a.timerStop == nil {
+		return
+	}
+	close(a.timerStop)
+	<-a.timerDone
+	a.timerStop = nil
+}
+
+// runVPNTimers fires the timers due since the previous tick. The window is
+// based on wall-clock time, so after sleep the missed triggers show up as
+// late and are skipped instead of firing retroactively.
+func (a *App) runVPNTimers() {
+	ticker := time.NewTicker(VPNTimerCheckInterval)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-a.timerStop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if a.storage != nil {
+			a.evaluateVPNTimers(lastCheck, now)
+		}
+		lastCheck = now
+	}
+}
+
+// evaluateVPNTimers runs the timers triggered in (from, to]
+func (a *App) evaluateVPNTimers(from, to time.Time) {
+	for _, due := range dueVPNTimers(a.storage.GetAppSettings().VPNTimers, from, to) {
+		if due.Late {
+			a.writeLog(fmt.Sprintf("[Timer] Timer %d (%s at %s) missed while asleep, skipped",
+				due.Index+1, due.Timer.Action, due.At.Format("2006-01-02 15:04")))
+			continue
+		}
+		a.fireVPNTimer(due)
+	}
+}
+
+// fireVPNTimer connects (switching profile first if needed) or disconnects
+func (a *App) fireVPNTimer(due dueVPNTimer) {
+	timer := due.Timer
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+
+	var err error
+	var message string
+	switch timer.Action {
+	case VPNTimerConnect:
+		message = "VPN подключён по таймеру"
+		if target := timer.ProfileID; target != 0 && target != a.storage.GetActiveProfileID() {
+			if reason := a.scheduleBlockReason(target); reason != "" {
+				err = fmt.Errorf("%s", reason)
+				break
+			}
+			// Reconnects when VPN is running
+			if err = a.switchProfileReconnect(target); err != nil || running {
+				break
+			}
+		} else if running {
+			a.writeLog(fmt.Sprintf("[Timer] Timer %d: VPN already connected", due.Index+1))
+			return
+		}
+		result := a.Start()
+		if success, _ := result["success"].(bool); !success {
+			err = fmt.Errorf("%v", result["error"])
+		}
+
+	case VPNTimerDisconnect:
+		if !running {
+			a.writeLog(fmt.Sprintf("[Timer] Timer %d: VPN already disconnected", due.Index+1))
+			return
+		}
+		a.Stop()
+		message = "VPN отключён по таймеру"
+	}
+
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Timer] Timer %d (%s at %s) failed: %v", due.Index+1, timer.Action, timer.Time, err))
+		a.AddToLogBuffer(fmt.Sprintf("Таймер %s не сработал: %v", timer.Time, err))
+		a.emitEvent("vpn-timer-failed", map[string]interface{}{
+			"index":  due.Index,
+			"action": timer.Action,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	a.writeLog(fmt.Sprintf("[Timer] Timer %d fired: %s at %s (profile %d)",
+		due.Index+1, timer.Action, timer.Time, a.storage.GetActiveProfileID()))
+	a.AddToLogBuffer(message)
+	a.mu.Lock()
+	running = a.isRunning
+	a.mu.Unlock()
+	a.emitEvent("vpn-status-changed", running)
+	a.emitEvent("vpn-timer-fired", map[string]interface{}{
+		"index":  due.Index,
+		"action": timer.Action,
+	})
+}
+
+// GetVPNTimers returns the connect/disconnect timers (API для фронтенда)
+func (a *App) GetVPNTimers() map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	timers := a.storage.GetAppSettings().VPNTimers
+	if timers == nil {
+		timers = []VPNTimer{}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"timers":  timers,
+	}
+}
+
+// AddVPNTimer validates and adds a timer (API для фронтенда)
+func (a *App) AddVPNTimer(timer VPNTimer) map[string]interface{} {
+	return a.saveVPNTimer(-1, &timer)
+}
+
+// UpdateVPNTimer replaces the timer at index (API для фронтенда)
+func (a *App) UpdateVPNTimer(index int, timer VPNTimer) map[string]interface{} {
+	return a.saveVPNTimer(index, &timer)
+}
+
+// RemoveVPNTimer removes the timer at index (API для фронтенда)
+func (a *App) RemoveVPNTimer(index int) map[string]interface{} {
+	return a.saveVPNTimer(index, nil)
+}
+
+// saveVPNTimer adds (index -1), replaces or removes (timer nil) a timer
+func (a *App) saveVPNTimer(index int, timer *VPNTimer) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	timers := append([]VPNTimer{}, settings.VPNTimers...)
+	if (timer == nil || index != -1) && (index < 0 || index >= len(timers)) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("vpn_timer_not_found", index+1),
+		}
+	}
+
+	if timer == nil {
+		timers = append(timers[:index], timers[index+1:]...)
+	} else {
+		profileExists := func(id int) bool {
+			_, err := a.storage.GetProfile(id)
+			return err == nil
+		}
+		if err := ValidateVPNTimer(*timer, timers, index, profileExists); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   a.tr("vpn_timer_invalid", err),
+			}
+		}
+		if index == -1 {
+			timers = append(timers, *timer)
+		} else {
+			timers[index] = *timer
+		}
+	}
+
+	if len(timers) == 0 {
+		timers = nil
+	}
+	settings.VPNTimers = timers
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("[Timer] Timers updated: %d", len(timers)))
+	if timers == nil {
+		timers = []VPNTimer{}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"timers":  timers,
+	}
+}
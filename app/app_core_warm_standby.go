@@ -0,0 +1,133 @@
+package main
+
+// Warm standby for Kampus VPN
+// This file contains pre-building of recently used profiles' configs and the background refresh of stale ones
+
+import (
+	"fmt"
+	"sort"
+)
+
+// refreshWarmStandby rewrites standby configs for the current recently used list
+func (a *App) refreshWarmStandby() {
+	if a.storage == nil {
+		return
+	}
+	count := a.storage.GetAppSettings().WarmStandbyCount()
+	written, err := a.storage.WriteStandbyConfigs(count)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Standby] Failed to write standby config: %v", err))
+	}
+	if count > 0 {
+		a.writeLog(fmt.Sprintf("[Standby] %d profile config(s) ready", len(written)))
+	}
+}
+
+// afterProfileSwitch updates the standby set and refreshes the new profile's
+// config in the background if it is older than StandbyMaxAge
+func (a *App) afterProfileSwitch(id int) {
+	if a.storage == nil || !a.storage.GetAppSettings().WarmStandby {
+		return
+	}
+	a.refreshWarmStandby()
+
+	profile, err := a.storage.GetProfile(id)
+	if err != nil || profile.SubscriptionURL == "" || !configIsStale(profile.BuildInfo) {
+		return
+	}
+	go a.rebuildStaleProfile(id)
+}
+
+// rebuildStaleProfile rebuilds a profile whose config is older than StandbyMaxAge.
+// A running connection keeps the old config; the frontend is told a new one is ready.
+func (a *App) rebuildStaleProfile(id int) {
+	defer a.crash.Guard("standby-rebuild")
+
+	if !a.standbyRebuild.TryLock() {
+		return
+	}
+	defer a.standbyRebuild.Unlock()
+
+	if a.configBuilder == nil {
+		return
+	}
+	profile, err := a.storage.GetProfile(id)
+	if err != nil {
+		return
+	}
+
+	before := a.storage.ProfileConfigHash(id)
+	a.writeLog(fmt.Sprintf("[Standby] Config of profile %d is older than %v, rebuilding in background", id, StandbyMaxAge))
+	if err := a.configBuilder.BuildConfigForProfile(id, profile.SubscriptionURL, profile.WireGuardConfigs); err != nil {
+		a.writeLog(fmt.Sprintf("[Standby] Background rebuild of profile %d failed: %v", id, err))
+		return
+	}
+	a.refreshWarmStandby()
+
+	if a.storage.ProfileConfigHash(id) == before {
+		return
+	}
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if running && a.storage.GetActiveProfileID() == id {
+		a.AddToLogBuffer("Конфиг профиля обновлён, изменения применятся после переподключения")
+		a.emitEvent("standby-config-updated", id)
+	}
+}
+
+// getWarmStandbyStatus returns the standby set for GetProfiles
+func (a *App) getWarmStandbyStatus(standby map[int]StandbyConfig) map[string]interface{} {
+	settings := a.storage.GetAppSettings()
+
+	ids := make([]int, 0, len(standby))
+	for id := range standby {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return map[string]interface{}{
+		"enabled":     settings.WarmStandby,
+		"count":       settings.WarmStandbyCount(),
+		"clearOnExit": settings.ClearStandbyOnExit,
+		"profiles":    ids,
+	}
+}
+
+// SetWarmStandby configures pre-building of recently used profiles (API для фронтенда)
+func (a *App) SetWarmStandby(enabled bool, count int, clearOnExit bool) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+	if count < 0 || count > MaxRecentProfiles {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("warm_standby_count_invalid", MaxRecentProfiles),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.WarmStandby = enabled
+	settings.WarmStandbyProfiles = count
+	settings.ClearStandbyOnExit = clearOnExit
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.refreshWarmStandby()
+	a.writeLog(fmt.Sprintf("Warm standby: %v (%d profiles)", enabled, settings.WarmStandbyCount()))
+
+	return map[string]interface{}{
+		"success":     true,
+		"warmStandby": a.getWarmStandbyStatus(a.storage.StandbyConfigs()),
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+// sing-box resource watchdog for Kampus VPN
+// This file contains the memory/CPU sampler of the sing-box process and the runaway memory guard
+
+import (
+	"fmt"
+	"time"
+)
+
+// Resource watchdog configuration
+const (
+	// ResourceSampleInterval is the interval between sing-box resource samples.
+	ResourceSampleInterval = 30 * time.Second
+	// MemoryGuardSamples is the number of consecutive samples above the limit before restart.
+	MemoryGuardSamples = 3
+	// MemoryRestartCooldown is the least time between two restarts over the memory limit.
+	MemoryRestartCooldown = time.Hour
+	// MinSingboxMemoryLimitMB is the smallest memory limit accepted.
+	MinSingboxMemoryLimitMB = 128
+)
+
+// startResourceMonitor starts sampling the sing-box process launched at startedAt.
+// Must be called with a.mu held.
+func (a *App) startResourceMonitor(pid int, startedAt time.Time) {
+	monitor, err := NewProcessMonitor(pid, startedAt)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("[Watchdog] Resource monitor not started: %v", err))
+		return
+	}
+	stop := make(chan struct{})
+	a.procMonitor = monitor
+	a.procMonitorStop = stop
+
+	go a.crash.Supervise("resource-monitor", func() {
+		ticker := time.NewTicker(ResourceSampleInterval)
+		defer ticker.Stop()
+
+		overLimit := 0
+		warned := false
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			sample, err := monitor.Sample()
+			if err != nil {
+				// Process is gone - the monitor goroutine will stop us
+				a.writeLog(fmt.Sprintf("[Watchdog] Sample failed: %v", err))
+				continue
+			}
+
+			a.emitEvent("singbox-resource-usage", map[string]interface{}{
+				"memoryMB":     sample.WorkingSetMB,
+				"peakMemoryMB": sample.PeakWorkingSetMB,
+				"cpuPercent":   sample.CPUPercent,
+			})
+
+			limit, softLimit := 0, 0
+			if a.storage != nil {
+				settings := a.storage.GetAppSettings()
+				limit, softLimit = settings.MaxSingboxMemoryMB, settings.SoftSingboxMemoryMB
+			}
+
+			// Soft limit: warn once per crossing
+			if softLimit > 0 && sample.WorkingSetMB > softLimit {
+				if !warned {
+					warned = true
+					a.writeLog(fmt.Sprintf("[Watchdog] sing-box memory %d MB exceeds soft limit %d MB", sample.WorkingSetMB, softLimit))
+					a.AddToLogBuffer(a.tr("memory_high", formatMemoryMB(sample.WorkingSetMB, a.uiLanguage())))
+					a.emitEvent("singbox-memory-warning", map[string]interface{}{
+						"memoryMB": sample.WorkingSetMB,
+						"limitMB":  softLimit,
+					})
+				}
+			} else {
+				warned = false
+			}
+
+			if limit <= 0 || sample.WorkingSetMB <= limit {
+				overLimit = 0
+				continue
+			}
+
+			overLimit++
+			a.writeLog(fmt.Sprintf("[Watchdog] sing-box memory %d MB exceeds limit %d MB (%d/%d)",
+				sample.WorkingSetMB, limit, overLimit, MemoryGuardSamples))
+			if overLimit < MemoryGuardSamples {
+				continue
+			}
+
+			a.mu.Lock()
+			last := a.memoryRestartAt
+			if !last.IsZero() && time.Since(last) < MemoryRestartCooldown {
+				a.mu.Unlock()
+				if overLimit == MemoryGuardSamples {
+					a.writeLog(fmt.Sprintf("[Watchdog] Restart skipped, last one was at %s", last.Format("15:04:05")))
+				}
+				continue
+			}
+			a.memoryRestartAt = time.Now()
+			a.mu.Unlock()
+
+			reason := a.tr("memory_restart", formatMemoryMB(sample.WorkingSetMB, a.uiLanguage()))
+			a.emitEvent("singbox-memory-restart", map[string]interface{}{
+				"memoryMB": sample.WorkingSetMB,
+				"limitMB":  limit,
+				"reason":   reason,
+			})
+			a.notify("Kampus VPN", reason)
+			go a.restartVPN(reason)
+			return
+		}
+	})
+}
+
+// stopResourceMonitor stops the sampler. Does not wait for the goroutine.
+func (a *App) stopResourceMonitor() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.procMonitorStop != nil {
+		close(a.procMonitorStop)
+		a.procMonitorStop = nil
+	}
+	// The last sample stays available to the status API
+	if a.procMonitor != nil {
+		a.procMonitor.Close()
+	}
+}
+
+// getResourceUsage returns the latest sing-box resource sample (nil if not sampled yet).
+// Must be called with a.mu held.
+func (a *App) getResourceUsage() map[string]interface{} {
+	if a.procMonitor == nil {
+		return nil
+	}
+	sample := a.procMonitor.Latest()
+	if sample.SampledAt.IsZero() {
+		return nil
+	}
+	return map[string]interface{}{
+		"memoryMB":     sample.WorkingSetMB,
+		"peakMemoryMB": sample.PeakWorkingSetMB,
+		"cpuPercent":   sample.CPUPercent,
+		"sampledAt":    sample.SampledAt.Format(time.RFC3339),
+	}
+}
+
+// GetCoreResourceUsage returns memory and CPU of sing-box and the memory
+// limits (API для фронтенда)
+func (a *App) GetCoreResourceUsage() map[string]interface{} {
+	a.waitForInit()
+
+	a.mu.Lock()
+	running := a.isRunning
+	usage := a.getResourceUsage()
+	lastRestart := a.memoryRestartAt
+	a.mu.Unlock()
+
+	result := map[string]interface{}{
+		"success": true,
+		"running": running,
+		"usage":   usage,
+	}
+	if a.storage != nil {
+		settings := a.storage.GetAppSettings()
+		result["limitMB"] = settings.MaxSingboxMemoryMB
+		result["softLimitMB"] = settings.SoftSingboxMemoryMB
+	}
+	if !lastRestart.IsZero() {
+		result["lastRestart"] = lastRestart.Format(time.RFC3339)
+	}
+	return result
+}
+
+// restartVPN stops and starts sing-box again with a logged reason.
+// Concurrent restarts are ignored.
+func (a *App) restartVPN(reason string) {
+	a.mu.Lock()
+	if a.restarting || !a.isRunning {
+		a.mu.Unlock()
+		return
+	}
+	a.restarting = true
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		a.restarting = false
+		a.mu.Unlock()
+	}()
+
+	// Connect and disconnect of other callers wait until sing-box is back
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	a.mu.Lock()
+	running := a.isRunning
+	a.mu.Unlock()
+	if !running {
+		// Disconnected while waiting for the lock
+		return
+	}
+
+	a.writeLog("Restarting VPN: " + reason)
+	a.AddToLogBuffer(reason)
+
+	a.stopVPN()
+	a.waitForStopped()
+
+	result := a.startVPN()
+	if success, _ := result["success"].(bool); !success {
+		a.writeLog(fmt.Sprintf("Restart failed: %v", result["error"]))
+	}
+
+	a.mu.Lock()
+	running = a.isRunning
+	a.mu.Unlock()
+
+	a.emitEvent("vpn-restarted", reason)
+	a.emitEvent("vpn-status-changed", running)
+}
+
+// waitForStopped waits for the monitor goroutine to finish cleanup after Stop (max 10 sec)
+func (a *App) waitForStopped() {
+	for i := 0; i < 100; i++ {
+		a.mu.Lock()
+		running := a.isRunning
+		a.mu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// formatMemoryMB formats megabytes for user messages ("1,4 ГБ" / "1.4 GB")
+func formatMemoryMB(mb int, lang Language) string {
+	return FormatBytesLocalized(int64(mb)<<20, lang)
+}
+
+// SetMaxSingboxMemory sets memory limit for sing-box in MB, 0 disables the guard (API для фронтенда)
+func (a *App) SetMaxSingboxMemory(limitMB int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	if limitMB < 0 || (limitMB > 0 && limitMB < MinSingboxMemoryLimitMB) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("memory_limit_invalid", MinSingboxMemoryLimitMB),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	settings.MaxSingboxMemoryMB = limitMB
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	return map[string]interface{}{
+		"success": true,
+	}
+}
+
+// SetSingboxMemoryWarning sets the memory usage of sing-box in MB above which
+// a warning is logged, 0 disables it (API для фронтенда)
+func (a *App) SetSingboxMemoryWarning(limitMB int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("storage_not_initialized"),
+		}
+	}
+
+	settings := a.storage.GetAppSettings()
+	if limitMB < 0 || (limitMB > 0 && limitMB < MinSingboxMemoryLimitMB) ||
+		(limitMB > 0 && settings.MaxSingboxMemoryMB > 0 && limitMB >= settings.MaxSingboxMemoryMB) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("memory_warning_invalid", MinSingboxMemoryLimitMB),
+		}
+	}
+
+	settings.SoftSingboxMemoryMB = limitMB
+	if err := a.storage.UpdateAppSettings(settings); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   a.tr("settings_save_failed", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("[Watchdog] Memory warning limit: %d MB", limitMB))
+	return map[string]interface{}{
+		"success": true,
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestFormatMemoryMB(t *testing.T) {
+	tests := []struct {
+		mb   int
+		lang Language
+		want string
+	}{
+		{512, LangRussian, "512,0 МБ"},
+		{512, LangEnglish, "512.0 MB"},
+		{1434, LangRussian, "1,4 ГБ"},
+		{1434, LangEnglish, "1.4 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatMemoryMB(tt.mb, tt.lang); got != tt.want {
+			t.Errorf("formatMemoryMB(%d, %s) = %q, want %q", tt.mb, tt.lang, got, tt.want)
+		}
+	}
+
+	if got := translate(LangEnglish, "memory_restart", formatMemoryMB(1434, LangEnglish)); got != "sing-box restarted: memory usage 1.4 GB" {
+		t.Errorf("restart reason = %q", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"golang.org/x/sys/windows/registry"
@@ -96,21 +97,30 @@ func (c *AppConfig) Save(configPath string) error {
 }
 
 // SetAutoStart enables or disables system startup launch (standalone function).
-func SetAutoStart(enable bool) error {
+// With minimized the entry starts the app in the tray (MinimizedFlag).
+func SetAutoStart(enable, minimized bool) error {
 	if runtime.GOOS != "windows" {
 		// Not implemented for other OS yet
 		return nil
 	}
-	return setAutoStartWindows(enable)
+	return setAutoStartWindows(enable, minimized)
 }
 
 // SetAutoStart enables or disables system startup launch (method on AppConfig).
 func (c *AppConfig) SetAutoStart(enable bool) error {
-	return SetAutoStart(enable)
+	return SetAutoStart(enable, false)
+}
+
+// autoStartCommand returns the Run key command line for the executable
+func autoStartCommand(exePath string, minimized bool) string {
+	if !minimized {
+		return exePath
+	}
+	return fmt.Sprintf("\"%s\" %s", exePath, MinimizedFlag)
 }
 
 // setAutoStartWindows manages Windows registry for auto-start.
-func setAutoStartWindows(enable bool) error {
+func setAutoStartWindows(enable, minimized bool) error {
 	key, _, err := registry.CreateKey(
 		registry.CURRENT_USER,
 		`Software\Microsoft\Windows\CurrentVersion\Run`,
@@ -128,7 +138,7 @@ func setAutoStartWindows(enable bool) error {
 		}
 		exePath, _ = filepath.EvalSymlinks(exePath)
 
-		err = key.SetStringValue(AppName, exePath)
+		err = key.SetStringValue(AppName, autoStartCommand(exePath, minimized))
 		if err != nil {
 			return fmt.Errorf("failed to add to autostart: %w", err)
 		}
@@ -142,10 +152,20 @@ func setAutoStartWindows(enable bool) error {
 	return nil
 }
 
-// IsAutoStartEnabled checks if auto-start is currently enabled.
-func IsAutoStartEnabled() bool {
+// AutoStartEntry is the autostart entry as registered in the Run key.
+type AutoStartEntry struct {
+	Enabled   bool     `json:"enabled"`
+	Command   string   `json:"command,omitempty"` // Command line as stored
+	Path      string   `json:"path,omitempty"`    // Executable the entry starts
+	Flags     []string `json:"flags,omitempty"`   // Arguments after the executable
+	Minimized bool     `json:"minimized"`         // Starts in the tray (MinimizedFlag)
+}
+
+// ReadAutoStartEntry reads the registered autostart entry; it may have been
+// written by an older version or edited outside the app.
+func ReadAutoStartEntry() AutoStartEntry {
 	if runtime.GOOS != "windows" {
-		return false
+		return AutoStartEntry{}
 	}
 
 	key, err := registry.OpenKey(
@@ -154,12 +174,51 @@ func IsAutoStartEnabled() bool {
 		registry.QUERY_VALUE,
 	)
 	if err != nil {
-		return false
+		return AutoStartEntry{}
 	}
 	defer key.Close()
 
-	_, _, err = key.GetStringValue(AppName)
-	return err == nil
+	command, _, err := key.GetStringValue(AppName)
+	if err != nil {
+		return AutoStartEntry{}
+	}
+	return parseAutoStartCommand(command)
+}
+
+// parseAutoStartCommand splits a Run key command line into the executable and
+// its flags. Unquoted paths with spaces (as written before flags were added)
+// are taken whole up to ".exe".
+func parseAutoStartCommand(command string) AutoStartEntry {
+	entry := AutoStartEntry{Enabled: true, Command: command}
+	command = strings.TrimSpace(command)
+
+	rest := ""
+	if strings.HasPrefix(command, "\"") {
+		if end := strings.Index(command[1:], "\""); end >= 0 {
+			entry.Path = command[1 : end+1]
+			rest = command[end+2:]
+		} else {
+			entry.Path = strings.Trim(command, "\"")
+		}
+	} else if i := strings.Index(strings.ToLower(command), ".exe"); i >= 0 {
+		entry.Path = command[:i+len(".exe")]
+		rest = command[i+len(".exe"):]
+	} else {
+		entry.Path = command
+	}
+
+	entry.Flags = strings.Fields(rest)
+	for _, flag := range entry.Flags {
+		if flag == MinimizedFlag || flag == TrayOnlyFlag {
+			entry.Minimized = true
+		}
+	}
+	return entry
+}
+
+// IsAutoStartEnabled checks if auto-start is currently enabled.
+func IsAutoStartEnabled() bool {
+	return ReadAutoStartEntry().Enabled
 }
 
 // GetLogLevelString returns the log level as string for sing-box config.
@@ -0,0 +1,154 @@
+// Package main provides per-application split tunneling for KampusVPN.
+// sing-box matches the process that opened a connection by name on Windows,
+// so selected applications can bypass the VPN, always use it or be blocked
+// regardless of the routing mode.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// App rule actions
+const (
+	AppRuleDirect = "direct" // Bypass the VPN
+	AppRuleProxy  = "proxy"  // Always through the VPN
+	AppRuleBlock  = "block"  // No network access
+)
+
+// AppRule routes all connections of one process.
+type AppRule struct {
+	ProcessName string `json:"process_name"` // e.g. steam.exe
+	Action      string `json:"action"`       // AppRuleDirect, AppRuleProxy or AppRuleBlock
+}
+
+// normalizeAppRule validates a rule; a full path is reduced to the file name.
+func normalizeAppRule(processName, action string) (AppRule, error) {
+	name := strings.TrimSpace(processName)
+	if i := strings.LastIndexAny(name, `\/`); i != -1 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return AppRule{}, fmt.Errorf("не указано имя процесса")
+	}
+
+	action = strings.ToLower(strings.TrimSpace(action))
+	switch action {
+	case AppRuleDirect, AppRuleProxy, AppRuleBlock:
+	default:
+		return AppRule{}, fmt.Errorf("неизвестное действие: %s", action)
+	}
+	return AppRule{ProcessName: name, Action: action}, nil
+}
+
+// appRouteRules converts app rules to sing-box route rules, one per action.
+// Block comes first, so a blocked application can't leak through another rule.
+func appRouteRules(rules []AppRule) []interface{} {
+	byAction := map[string][]string{}
+	for _, rule := range rules {
+		byAction[rule.Action] = append(byAction[rule.Action], rule.ProcessName)
+	}
+
+	routeRules := []interface{}{}
+	if names := byAction[AppRuleBlock]; len(names) > 0 {
+		routeRules = append(routeRules, map[string]interface{}{
+			"process_name": names,
+			"action":       "reject",
+		})
+	}
+	for _, action := range []string{AppRuleDirect, AppRuleProxy} {
+		if names := byAction[action]; len(names) > 0 {
+			routeRules = append(routeRules, map[string]interface{}{
+				"process_name": names,
+				"action":       "route",
+				"outbound":     action,
+			})
+		}
+	}
+	return routeRules
+}
+
+// insertAppRules puts app rules right after the sniff rule, ahead of the
+// domain and IP rules of the routing mode
+func insertAppRules(route map[string]interface{}, rules []AppRule) {
+	if len(rules) == 0 {
+		return
+	}
+	existing, _ := route["rules"].([]interface{})
+
+	insertIdx := 0
+	for i, r := range existing {
+		if ruleMap, ok := r.(map[string]interface{}); ok {
+			if action, _ := ruleMap["action"].(string); action == "sniff" {
+				insertIdx = i + 1
+				break
+			}
+		}
+	}
+
+	appRules := appRouteRules(rules)
+	finalRules := make([]interface{}, 0, len(existing)+len(appRules))
+	finalRules = append(finalRules, existing[:insertIdx]...)
+	finalRules = append(finalRules, appRules...)
+	finalRules = append(finalRules, existing[insertIdx:]...)
+	route["rules"] = finalRules
+	fmt.Printf("[applyRoutingMode] Added %d app rules at position %d\n", len(rules), insertIdx)
+}
+
+// isAppRouteRule reports whether a route rule was generated from app rules
+func isAppRouteRule(rule interface{}) bool {
+	ruleMap, ok := rule.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = ruleMap["process_name"]
+	return ok
+}
+
+// --- Storage ---
+
+// AddProfileAppRule adds an app rule to a profile; a process can have one rule.
+func (s *Storage) AddProfileAppRule(id int, rule AppRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		for _, existing := range p.AppRules {
+			if strings.EqualFold(existing.ProcessName, rule.ProcessName) {
+				return fmt.Errorf("правило для %s уже существует", existing.ProcessName)
+			}
+		}
+		p.AppRules = append(p.AppRules, rule)
+		return s.saveInternal()
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// RemoveProfileAppRule removes the app rule of a process from a profile.
+func (s *Storage) RemoveProfileAppRule(id int, processName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		rules := make([]AppRule, 0, len(p.AppRules))
+		for _, rule := range p.AppRules {
+			if !strings.EqualFold(rule.ProcessName, processName) {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == len(p.AppRules) {
+			return fmt.Errorf("правило для %s не найдено", processName)
+		}
+		p.AppRules = rules
+		return s.saveInternal()
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
@@ -0,0 +1,318 @@
+// Package main provides ISP block detection for KampusVPN.
+// A site failing over direct routing is either blocked by the ISP (and should
+// go through the proxy) or genuinely down; DNS answers and the direct HTTP
+// response are compared against known block-page signatures to tell which.
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:embed config/block_signatures.json
+var embeddedBlockSignatures []byte
+
+// BlockSignaturesFile overrides the embedded signatures when present in resources
+const BlockSignaturesFile = "block_signatures.json"
+
+// Block check verdicts
+const (
+	BlockVerdictBlockedByISP = "blocked_by_isp"
+	BlockVerdictServerDown   = "server_down"
+	BlockVerdictReachable    = "reachable"
+	BlockVerdictInconclusive = "inconclusive"
+)
+
+// BlockCheckTimeout limits each probe of the block check
+const BlockCheckTimeout = 8 * time.Second
+
+// BlockSignatures are known ISP block-page markers.
+type BlockSignatures struct {
+	Version     string   `json:"version"`
+	BlockIPs    []string `json:"block_ips"`    // Stub page addresses returned by ISP resolvers
+	BlockHosts  []string `json:"block_hosts"`  // Hosts ISPs redirect blocked requests to
+	BodyMarkers []string `json:"body_markers"` // Text found on block pages
+}
+
+// LoadBlockSignatures returns signatures from resourcesPath if a valid file
+// exists there, otherwise the embedded ones.
+func LoadBlockSignatures(resourcesPath string) BlockSignatures {
+	var signatures BlockSignatures
+	if resourcesPath != "" {
+		if data, err := os.ReadFile(filepath.Join(resourcesPath, BlockSignaturesFile)); err == nil {
+			if json.Unmarshal(data, &signatures) == nil && len(signatures.BlockIPs)+len(signatures.BodyMarkers) > 0 {
+				return signatures
+			}
+		}
+	}
+	json.Unmarshal(embeddedBlockSignatures, &signatures)
+	return signatures
+}
+
+// blockFetchResult is the outcome of an HTTP fetch of the domain.
+type blockFetchResult struct {
+	Status   int
+	Location string
+	Body     string
+}
+
+// BlockDetector compares direct and trusted views of a domain.
+// Lookups and fetches are fields so the comparison logic can run on canned responses.
+type BlockDetector struct {
+	signatures    BlockSignatures
+	lookupDirect  func(ctx context.Context, host string) ([]string, error)
+	lookupTrusted func(ctx context.Context, host string) ([]string, error)
+	fetchDirect   func(ctx context.Context, rawURL string) (*blockFetchResult, error)
+	fetchProxy    func(ctx context.Context, rawURL string) (*blockFetchResult, error) // nil when VPN is off
+}
+
+// BlockCheckResult is the verdict with the evidence it is based on.
+type BlockCheckResult struct {
+	Domain     string   `json:"domain"`
+	Verdict    string   `json:"verdict"`
+	Evidence   []string `json:"evidence"`
+	DirectIPs  []string `json:"direct_ips,omitempty"`
+	TrustedIPs []string `json:"trusted_ips,omitempty"`
+	HTTPStatus int      `json:"http_status,omitempty"`
+}
+
+// NewBlockDetector returns a detector using the system resolver and the
+// network directly, DoH (through proxyURL if set) as the trusted resolver.
+func NewBlockDetector(signatures BlockSignatures, proxyURL *url.URL) *BlockDetector {
+	directClient := newBlockCheckClient(nil)
+	trustedClient := newBlockCheckClient(proxyURL)
+
+	d := &BlockDetector{
+		signatures: signatures,
+		lookupDirect: func(ctx context.Context, host string) ([]string, error) {
+			return net.DefaultResolver.LookupHost(ctx, host)
+		},
+		lookupTrusted: func(ctx context.Context, host string) ([]string, error) {
+			return lookupDoH(ctx, trustedClient, host)
+		},
+		fetchDirect: func(ctx context.Context, rawURL string) (*blockFetchResult, error) {
+			return fetchForBlockCheck(ctx, directClient, rawURL)
+		},
+	}
+	if proxyURL != nil {
+		d.fetchProxy = func(ctx context.Context, rawURL string) (*blockFetchResult, error) {
+			return fetchForBlockCheck(ctx, trustedClient, rawURL)
+		}
+	}
+	return d
+}
+
+// newBlockCheckClient returns a client that doesn't follow redirects (to see block redirects)
+func newBlockCheckClient(proxyURL *url.URL) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{
+		Timeout:   BlockCheckTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// fetchForBlockCheck fetches rawURL and reads the start of the body
+func fetchForBlockCheck(ctx context.Context, client *http.Client, rawURL string) (*blockFetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return &blockFetchResult{
+		Status:   resp.StatusCode,
+		Location: resp.Header.Get("Location"),
+		Body:     string(body),
+	}, nil
+}
+
+// lookupDoH resolves host via the Cloudflare DoH JSON API
+func lookupDoH(ctx context.Context, client *http.Client, host string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://1.1.1.1/dns-query?type=A&name="+url.QueryEscape(host), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Status int `json:"Status"`
+		Answer []struct {
+			Type int    `json:"type"`
+			Data string `json:"data"`
+		} `json:"Answer"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&answer); err != nil {
+		return nil, err
+	}
+	if answer.Status == 3 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	ips := []string{}
+	for _, a := range answer.Answer {
+		if a.Type == 1 { // A record
+			ips = append(ips, a.Data)
+		}
+	}
+	return ips, nil
+}
+
+// isNotFound reports an NXDOMAIN error
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// containsAny returns the first item of list contained in text (case-insensitive)
+func containsAny(text string, list []string) string {
+	lower := strings.ToLower(text)
+	for _, item := range list {
+		if item != "" && strings.Contains(lower, strings.ToLower(item)) {
+			return item
+		}
+	}
+	return ""
+}
+
+// Check runs the detection for domain.
+func (d *BlockDetector) Check(ctx context.Context, domain string) BlockCheckResult {
+	result := BlockCheckResult{Domain: domain, Evidence: []string{}}
+
+	directIPs, directErr := d.lookupDirect(ctx, domain)
+	trustedIPs, trustedErr := d.lookupTrusted(ctx, domain)
+	result.DirectIPs = directIPs
+	result.TrustedIPs = trustedIPs
+
+	// 1. Resolver returned a known stub page address
+	for _, ip := range directIPs {
+		for _, blockIP := range d.signatures.BlockIPs {
+			if ip == blockIP {
+				result.Verdict = BlockVerdictBlockedByISP
+				result.Evidence = append(result.Evidence, fmt.Sprintf("DNS провайдера вернул адрес страницы блокировки %s", ip))
+				return result
+			}
+		}
+	}
+
+	// 2. Domain "doesn't exist" only for the ISP resolver
+	if isNotFound(directErr) && trustedErr == nil && len(trustedIPs) > 0 {
+		result.Verdict = BlockVerdictBlockedByISP
+		result.Evidence = append(result.Evidence, "DNS провайдера отвечает «домен не существует», а доверенный DNS возвращает адреса")
+		return result
+	}
+	if isNotFound(directErr) && isNotFound(trustedErr) {
+		result.Verdict = BlockVerdictServerDown
+		result.Evidence = append(result.Evidence, "Домен не существует по данным обоих DNS-серверов")
+		return result
+	}
+	if directErr != nil {
+		result.Evidence = append(result.Evidence, fmt.Sprintf("Ошибка DNS провайдера: %v", directErr))
+	}
+	if trustedErr != nil {
+		result.Evidence = append(result.Evidence, fmt.Sprintf("Ошибка доверенного DNS: %v", trustedErr))
+	}
+
+	// 3. Direct HTTP response looks like a block page
+	fetch, fetchErr := d.fetchDirect(ctx, "http://"+domain+"/")
+	if fetchErr == nil {
+		result.HTTPStatus = fetch.Status
+		if fetch.Status == http.StatusUnavailableForLegalReasons {
+			result.Verdict = BlockVerdictBlockedByISP
+			result.Evidence = append(result.Evidence, "Сервер провайдера ответил статусом 451 (недоступно по юридическим причинам)")
+			return result
+		}
+		if fetch.Location != "" {
+			if host := subscriptionHost(fetch.Location); host != "" && containsAny(host, d.signatures.BlockHosts) != "" {
+				result.Verdict = BlockVerdictBlockedByISP
+				result.Evidence = append(result.Evidence, fmt.Sprintf("Перенаправление на страницу блокировки %s", host))
+				return result
+			}
+		}
+		if marker := containsAny(fetch.Body, d.signatures.BodyMarkers); marker != "" {
+			result.Verdict = BlockVerdictBlockedByISP
+			result.Evidence = append(result.Evidence, fmt.Sprintf("Страница содержит признак блокировки: «%s»", marker))
+			return result
+		}
+		if fetch.Status < 500 {
+			result.Verdict = BlockVerdictReachable
+			result.Evidence = append(result.Evidence, fmt.Sprintf("Сайт отвечает напрямую (HTTP %d)", fetch.Status))
+			return result
+		}
+		result.Evidence = append(result.Evidence, fmt.Sprintf("Сайт отвечает ошибкой сервера (HTTP %d)", fetch.Status))
+	} else {
+		result.Evidence = append(result.Evidence, fmt.Sprintf("Прямое подключение не удалось: %v", fetchErr))
+	}
+
+	// 4. Direct failed: compare with the proxy path (only while VPN is connected)
+	if d.fetchProxy != nil {
+		proxyFetch, proxyErr := d.fetchProxy(ctx, "http://"+domain+"/")
+		switch {
+		case proxyErr == nil && proxyFetch.Status < 500:
+			result.Verdict = BlockVerdictBlockedByISP
+			result.Evidence = append(result.Evidence, fmt.Sprintf("Через прокси сайт доступен (HTTP %d), напрямую — нет", proxyFetch.Status))
+		case proxyErr == nil:
+			result.Verdict = BlockVerdictServerDown
+			result.Evidence = append(result.Evidence, fmt.Sprintf("Через прокси сайт тоже отвечает ошибкой (HTTP %d)", proxyFetch.Status))
+		default:
+			result.Verdict = BlockVerdictServerDown
+			result.Evidence = append(result.Evidence, fmt.Sprintf("Через прокси сайт тоже недоступен: %v", proxyErr))
+		}
+		return result
+	}
+
+	if fetchErr == nil {
+		result.Verdict = BlockVerdictServerDown
+	} else {
+		result.Verdict = BlockVerdictInconclusive
+		result.Evidence = append(result.Evidence, "Подключите VPN, чтобы сравнить с доступом через прокси")
+	}
+	return result
+}
+
+// normalizeCheckDomain extracts the host from user input ("https://site.com/page" -> "site.com")
+func normalizeCheckDomain(input string) (string, error) {
+	input = strings.TrimSpace(strings.ToLower(input))
+	if strings.Contains(input, "://") {
+		if u, err := url.Parse(input); err == nil {
+			input = u.Hostname()
+		}
+	}
+	input = strings.TrimSuffix(strings.SplitN(input, "/", 2)[0], ".")
+	if host, _, err := net.SplitHostPort(input); err == nil {
+		input = host
+	}
+	if input == "" || !strings.Contains(input, ".") || strings.ContainsAny(input, " \t") {
+		return "", fmt.Errorf("некорректный домен: %q", input)
+	}
+	return input, nil
+}
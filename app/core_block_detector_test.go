@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cannedLookup answers a DNS lookup with fixed addresses or an error
+func cannedLookup(ips []string, err error) func(ctx context.Context, host string) ([]string, error) {
+	return func(ctx context.Context, host string) ([]string, error) {
+		return ips, err
+	}
+}
+
+// cannedFetch answers an HTTP fetch with a fixed response or an error and counts calls
+func cannedFetch(result *blockFetchResult, err error, calls *int) func(ctx context.Context, rawURL string) (*blockFetchResult, error) {
+	return func(ctx context.Context, rawURL string) (*blockFetchResult, error) {
+		*calls++
+		return result, err
+	}
+}
+
+func TestBlockDetectorCheck(t *testing.T) {
+	nxdomain := &net.DNSError{Err: "no such host", Name: "site.example", IsNotFound: true}
+	refused := errors.New("dial tcp 203.0.113.10:80: connection refused")
+	realIPs := []string{"203.0.113.10"}
+	ok := &blockFetchResult{Status: http.StatusOK, Body: "<title>Site</title>"}
+
+	tests := []struct {
+		name        string
+		directIPs   []string
+		directErr   error
+		trustedIPs  []string
+		trustedErr  error
+		direct      *blockFetchResult
+		directFail  error
+		proxy       *blockFetchResult
+		proxyFail   error
+		withProxy   bool
+		verdict     string
+		fetchesHTTP bool
+	}{
+		{name: "ISP stub address", directIPs: []string{"95.167.13.50"}, trustedIPs: realIPs, verdict: BlockVerdictBlockedByISP},
+		{name: "NXDOMAIN only from the ISP", directErr: nxdomain, trustedIPs: realIPs, verdict: BlockVerdictBlockedByISP},
+		{name: "NXDOMAIN from both", directErr: nxdomain, trustedErr: nxdomain, verdict: BlockVerdictServerDown},
+		{
+			name: "451 status", directIPs: realIPs, trustedIPs: realIPs,
+			direct:  &blockFetchResult{Status: http.StatusUnavailableForLegalReasons},
+			verdict: BlockVerdictBlockedByISP, fetchesHTTP: true,
+		},
+		{
+			name: "redirect to the ISP stub", directIPs: realIPs, trustedIPs: realIPs,
+			direct:  &blockFetchResult{Status: http.StatusFound, Location: "http://warning.rt.ru/?id=17"},
+			verdict: BlockVerdictBlockedByISP, fetchesHTTP: true,
+		},
+		{
+			name: "RKN marker in the body", directIPs: realIPs, trustedIPs: realIPs,
+			direct:  &blockFetchResult{Status: http.StatusOK, Body: "<p>ДОСТУП К ИНФОРМАЦИОННОМУ РЕСУРСУ ОГРАНИЧЕН на основании 149-ФЗ</p>"},
+			verdict: BlockVerdictBlockedByISP, fetchesHTTP: true,
+		},
+		{name: "site answers", directIPs: realIPs, trustedIPs: realIPs, direct: ok, verdict: BlockVerdictReachable, fetchesHTTP: true},
+		{
+			name: "ordinary redirect", directIPs: realIPs, trustedIPs: realIPs,
+			direct:  &blockFetchResult{Status: http.StatusMovedPermanently, Location: "https://site.example/"},
+			verdict: BlockVerdictReachable, fetchesHTTP: true,
+		},
+		{
+			name: "server error without VPN", directIPs: realIPs, trustedIPs: realIPs,
+			direct:  &blockFetchResult{Status: http.StatusBadGateway},
+			verdict: BlockVerdictServerDown, fetchesHTTP: true,
+		},
+		{
+			name: "only the proxy gets through", directIPs: realIPs, trustedIPs: realIPs,
+			directFail: refused, withProxy: true, proxy: ok,
+			verdict: BlockVerdictBlockedByISP, fetchesHTTP: true,
+		},
+		{
+			name: "proxy fails too", directIPs: realIPs, trustedIPs: realIPs,
+			directFail: refused, withProxy: true, proxyFail: refused,
+			verdict: BlockVerdictServerDown, fetchesHTTP: true,
+		},
+		{
+			name: "proxy gets a server error", directIPs: realIPs, trustedIPs: realIPs,
+			directFail: refused, withProxy: true, proxy: &blockFetchResult{Status: http.StatusServiceUnavailable},
+			verdict: BlockVerdictServerDown, fetchesHTTP: true,
+		},
+		{
+			name: "direct fails without VPN", directIPs: realIPs, trustedErr: refused,
+			directFail: refused,
+			verdict:    BlockVerdictInconclusive, fetchesHTTP: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var directCalls, proxyCalls int
+			d := &BlockDetector{
+				signatures:    LoadBlockSignatures(""),
+				lookupDirect:  cannedLookup(tt.directIPs, tt.directErr),
+				lookupTrusted: cannedLookup(tt.trustedIPs, tt.trustedErr),
+				fetchDirect:   cannedFetch(tt.direct, tt.directFail, &directCalls),
+			}
+			if tt.withProxy {
+				d.fetchProxy = cannedFetch(tt.proxy, tt.proxyFail, &proxyCalls)
+			}
+
+			result := d.Check(context.Background(), "site.example")
+			if result.Verdict != tt.verdict {
+				t.Errorf("verdict = %s, want %s (evidence %q)", result.Verdict, tt.verdict, result.Evidence)
+			}
+			if len(result.Evidence) == 0 {
+				t.Error("verdict without evidence")
+			}
+			if (directCalls > 0) != tt.fetchesHTTP {
+				t.Errorf("direct fetches = %d, want fetched %v", directCalls, tt.fetchesHTTP)
+			}
+			if proxyCalls > 0 && tt.directFail == nil {
+				t.Error("proxy fetched although the direct fetch gave an answer")
+			}
+			if tt.direct != nil && result.HTTPStatus != tt.direct.Status {
+				t.Errorf("http_status = %d, want %d", result.HTTPStatus, tt.direct.Status)
+			}
+		})
+	}
+}
+
+func TestLoadBlockSignatures(t *testing.T) {
+	embedded := LoadBlockSignatures("")
+	if embedded.Version == "" || len(embedded.BlockIPs) == 0 || len(embedded.BlockHosts) == 0 || len(embedded.BodyMarkers) == 0 {
+		t.Fatalf("embedded signatures = %+v", embedded)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		version string
+	}{
+		{"updated file", `{"version":"2026.11.01","block_ips":["198.51.100.1"]}`, "2026.11.01"},
+		{"broken file", `{"version":`, embedded.Version},
+		{"file without signatures", `{"version":"2026.11.01"}`, embedded.Version},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, BlockSignaturesFile), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := LoadBlockSignatures(dir).Version; got != tt.version {
+				t.Errorf("version = %q, want %q", got, tt.version)
+			}
+		})
+	}
+}
+
+func TestNormalizeCheckDomain(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"site.example", "site.example"},
+		{"  Site.Example.  ", "site.example"},
+		{"https://www.site.example/page?q=1", "www.site.example"},
+		{"site.example/page", "site.example"},
+		{"site.example:8080", "site.example"},
+		{"", ""},
+		{"localhost", ""},
+		{"site example.com", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeCheckDomain(tt.input)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("normalizeCheckDomain(%q) = %q, want an error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeCheckDomain(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupDoH(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		ips      []string
+		notFound bool
+	}{
+		{"A records", `{"Status":0,"Answer":[{"type":5,"data":"cdn.site.example."},{"type":1,"data":"203.0.113.10"},{"type":1,"data":"203.0.113.11"}]}`, []string{"203.0.113.10", "203.0.113.11"}, false},
+		{"NXDOMAIN", `{"Status":3}`, nil, true},
+		{"no records", `{"Status":0}`, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.URL.Query().Get("name") != "site.example" || req.Header.Get("Accept") != "application/dns-json" {
+					t.Errorf("request = %s, Accept %q", req.URL, req.Header.Get("Accept"))
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(tt.answer)), Header: http.Header{}}, nil
+			})}
+
+			ips, err := lookupDoH(context.Background(), client, "site.example")
+			if isNotFound(err) != tt.notFound {
+				t.Fatalf("error = %v, NXDOMAIN want %v", err, tt.notFound)
+			}
+			if !tt.notFound && (err != nil || !equalStringSlices(ips, tt.ips)) {
+				t.Errorf("ips = %v, %v; want %v", ips, err, tt.ips)
+			}
+		})
+	}
+}
+
+func TestFetchForBlockCheckKeepsRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://warning.rt.ru/?id=17", http.StatusFound)
+	}))
+	defer server.Close()
+
+	fetch, err := fetchForBlockCheck(context.Background(), newBlockCheckClient(nil), server.URL)
+	if err != nil {
+		t.Fatalf("fetchForBlockCheck: %v", err)
+	}
+	if fetch.Status != http.StatusFound || fetch.Location != "http://warning.rt.ru/?id=17" {
+		t.Errorf("fetch = %+v, want the redirect itself", fetch)
+	}
+}
+
+func TestAddAlwaysProxyDomain(t *testing.T) {
+	a := testWireGuardApp(t)
+
+	for _, input := range []string{"https://Blocked.Example/page", "blocked.example"} {
+		result := a.AddAlwaysProxyDomain(input)
+		if result["success"] != true {
+			t.Fatalf("AddAlwaysProxyDomain(%q) = %v", input, result)
+		}
+		if domains, _ := result["domains"].([]string); !equalStringSlices(domains, []string{"blocked.example"}) {
+			t.Errorf("domains = %v, want blocked.example once", domains)
+		}
+	}
+
+	profile := mustStoredProfile(t, a.storage, a.storage.GetActiveProfileID())
+	route, _ := profile.SingboxConfig["route"].(map[string]interface{})
+	rules, _ := json.Marshal(route["rules"])
+	if !strings.Contains(string(rules), `{"domain_suffix":["blocked.example"],"outbound":"proxy"}`) {
+		t.Errorf("rebuilt rules have no proxy rule for the domain: %s", rules)
+	}
+
+	if result := a.RemoveAlwaysProxyDomain("Blocked.Example"); result["success"] != true {
+		t.Fatalf("RemoveAlwaysProxyDomain = %v", result)
+	}
+	if domains := a.storage.GetAppSettings().AlwaysProxyDomains; len(domains) != 0 {
+		t.Errorf("domains = %v after removal", domains)
+	}
+}
@@ -0,0 +1,195 @@
+// Package main provides the bootstrap proxy of KampusVPN.
+// A blocked subscription server can't be reached before the first VPN
+// connection. When the direct fetch fails with a network error, the fetch is
+// repeated through a user-supplied proxy link: a temporary sing-box instance
+// with a local mixed inbound and that link as its only outbound. The
+// bootstrap proxy is used for fetching only and never enters a profile config.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Subscription fetch routes
+const (
+	SubscriptionRouteDirect    = "direct"    // Fetched without a proxy
+	SubscriptionRouteBootstrap = "bootstrap" // Fetched through the bootstrap proxy
+)
+
+// Bootstrap instance limits
+const (
+	// BootstrapStartTimeout is the wait for the temporary sing-box to listen.
+	BootstrapStartTimeout = 10 * time.Second
+	// bootstrapPollInterval is the pause between listen checks.
+	bootstrapPollInterval = 100 * time.Millisecond
+)
+
+// BootstrapProxy is the proxy used when the subscription server is unreachable.
+type BootstrapProxy struct {
+	Link        string // Proxy link (vless://, ss://, ...)
+	SingboxPath string // sing-box binary running the temporary instance
+}
+
+// ParseBootstrapLink validates a bootstrap proxy link.
+func ParseBootstrapLink(link string) (ProxyConfig, error) {
+	if !isDirectProxyLink(link) {
+		return ProxyConfig{}, fmt.Errorf("not a proxy link")
+	}
+	proxy, err := NewSubscriptionFetcher().ParseSingleLink(link)
+	if err != nil {
+		return ProxyConfig{}, err
+	}
+	if proxy.Server == "" || proxy.ServerPort == 0 {
+		return ProxyConfig{}, fmt.Errorf("link has no server address")
+	}
+	return proxy, nil
+}
+
+// isBootstrapRetryable reports whether a failed fetch may succeed through the
+// bootstrap proxy: the request failed in transport, not with an HTTP status
+// or an untrusted certificate
+func isBootstrapRetryable(err error) bool {
+	if _, ok := asSubscriptionTLSError(err); ok {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// bootstrapInstance is a running temporary sing-box
+type bootstrapInstance struct {
+	cmd        *exec.Cmd
+	configPath string
+	port       int
+	exited     chan struct{}
+}
+
+// startBootstrapInstance runs sing-box with the proxy as its only outbound and
+// waits until the local mixed inbound accepts connections
+func startBootstrapInstance(proxy ProxyConfig, singboxPath string) (*bootstrapInstance, error) {
+	if singboxPath == "" || !fileExists(singboxPath) {
+		return nil, fmt.Errorf("sing-box not found")
+	}
+	port, err := pickLocalInboundPort()
+	if err != nil {
+		return nil, fmt.Errorf("no free port: %w", err)
+	}
+
+	proxy.Tag = "bootstrap"
+	config := map[string]interface{}{
+		"log": map[string]interface{}{"level": "warn"},
+		"inbounds": []interface{}{
+			map[string]interface{}{
+				"type":        "mixed",
+				"tag":         "bootstrap-in",
+				"listen":      proxyInboundListen,
+				"listen_port": port,
+			},
+		},
+		"outbounds": []interface{}{
+			proxy.ToSingboxOutbound(),
+			map[string]interface{}{"type": "direct", "tag": "direct"},
+		},
+		"route": map[string]interface{}{"final": proxy.Tag},
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "kampus-bootstrap-*.json")
+	if err != nil {
+		return nil, err
+	}
+	configPath := file.Name()
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		os.Remove(configPath)
+		return nil, err
+	}
+
+	cmd := exec.Command(singboxPath, "run", "-c", configPath)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if err := cmd.Start(); err != nil {
+		os.Remove(configPath)
+		return nil, fmt.Errorf("failed to start sing-box: %w", err)
+	}
+
+	instance := &bootstrapInstance{cmd: cmd, configPath: configPath, port: port, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(instance.exited)
+	}()
+
+	address := net.JoinHostPort(proxyInboundListen, strconv.Itoa(port))
+	deadline := time.Now().Add(BootstrapStartTimeout)
+	for {
+		if conn, err := net.DialTimeout("tcp", address, bootstrapPollInterval); err == nil {
+			conn.Close()
+			return instance, nil
+		}
+		select {
+		case <-instance.exited:
+			os.Remove(configPath)
+			return nil, fmt.Errorf("sing-box exited, the proxy link is probably not supported")
+		case <-time.After(bootstrapPollInterval):
+		}
+		if time.Now().After(deadline) {
+			instance.Close()
+			return nil, fmt.Errorf("sing-box didn't start within %v", BootstrapStartTimeout)
+		}
+	}
+}
+
+// proxyClient returns a copy of client that sends requests through the instance
+func (i *bootstrapInstance) proxyClient(client *http.Client) *http.Client {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(proxyInboundListen, strconv.Itoa(i.port)),
+	})
+
+	proxied := *client
+	proxied.Transport = transport
+	return &proxied
+}
+
+// Close stops the instance and removes its config
+func (i *bootstrapInstance) Close() {
+	if i.cmd.Process != nil {
+		i.cmd.Process.Kill()
+	}
+	<-i.exited
+	os.Remove(i.configPath)
+}
+
+// fetchViaBootstrap repeats a fetch through the bootstrap proxy
+func (f *SubscriptionFetcher) fetchViaBootstrap(ctx context.Context, subscriptionURL string, client *http.Client, opts SubscriptionRequestOptions) ([]ProxyConfig, *SubscriptionUserInfo, error) {
+	proxy, err := ParseBootstrapLink(opts.Bootstrap.Link)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid bootstrap proxy: %w", err)
+	}
+	instance, err := startBootstrapInstance(proxy, opts.Bootstrap.SingboxPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bootstrap proxy: %w", err)
+	}
+	defer instance.Close()
+
+	return f.fetchAndParse(ctx, subscriptionURL, instance.proxyClient(client), opts)
+}
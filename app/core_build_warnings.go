@@ -0,0 +1,109 @@
+// Package main provides structured config build warnings for KampusVPN.
+// Warnings are collected by BuildConfigForProfile, stored with the profile
+// and replaced by every rebuild, so the frontend can show a persistent badge.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Build warning severities
+const (
+	WarningSeverityInfo    = "info"
+	WarningSeverityWarning = "warning"
+)
+
+// Build warning codes
+const (
+	WarnTransportFiltered  = "transport_filtered"   // Proxies dropped for unsupported transports
+	WarnTransportKept      = "transport_kept"       // Unsupported transports kept by user override
+	WarnHostOverlap        = "host_overlap"         // Proxy server reachable through a WireGuard tunnel
+	WarnTUNOverlap         = "tun_overlap"          // WireGuard network overlaps the sing-box TUN subnet
+	WarnPreferredDNSFailed = "preferred_dns_failed" // Selected final resolver couldn't be applied
+	WarnProxyLinkFields    = "proxy_link_fields"    // Link fields dropped while parsing (e.g. obfs without password)
+	WarnEndpointPinning    = "endpoint_pinning"     // Proxy hostnames not (freshly) resolved for pinning
+	WarnLegacy             = "legacy"               // Plain text warning saved by an older version
+)
+
+// BuildWarning is one problem found while building a profile config.
+type BuildWarning struct {
+	Code     string            `json:"code"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Context  map[string]string `json:"context,omitempty"`
+}
+
+// NewBuildWarning returns a warning with the default severity.
+func NewBuildWarning(code, message string, context map[string]string) BuildWarning {
+	return BuildWarning{Code: code, Severity: WarningSeverityWarning, Message: message, Context: context}
+}
+
+// UnmarshalJSON also accepts plain strings stored by older versions.
+func (w *BuildWarning) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*w = BuildWarning{Code: WarnLegacy, Severity: WarningSeverityWarning, Message: text}
+		return nil
+	}
+	type plain BuildWarning
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*w = BuildWarning(decoded)
+	return nil
+}
+
+// transportWarning converts the transport filter result to a warning
+func transportWarning(result FilterResult) BuildWarning {
+	code := WarnTransportFiltered
+	if result.Forced {
+		code = WarnTransportKept
+	}
+	return NewBuildWarning(code, result.Message, map[string]string{
+		"count": fmt.Sprintf("%d", len(result.Entries)),
+	})
+}
+
+// overlapWarning converts a WireGuard overlap to a warning
+func overlapWarning(o HostOverlap) BuildWarning {
+	context := map[string]string{
+		"proxy":     o.ProxyTag,
+		"server":    o.ProxyServer,
+		"ip":        o.IP,
+		"wireguard": o.WireGuardTag,
+		"reason":    o.Reason,
+	}
+	if o.CIDR != "" {
+		context["cidr"] = o.CIDR
+	}
+	return NewBuildWarning(WarnHostOverlap, o.Message(), context)
+}
+
+// tunOverlapWarning converts a WireGuard/TUN overlap to a warning
+func tunOverlapWarning(conflict *WireGuardConflictError) BuildWarning {
+	return NewBuildWarning(WarnTUNOverlap, conflict.Error(), map[string]string{
+		"wireguard": conflict.Tag,
+		"cidr":      conflict.Value,
+		"tun_cidr":  conflict.OtherValue,
+	})
+}
+
+// proxyLinkWarning lists proxies whose links had fields dropped while parsing
+// (false if there are none)
+func proxyLinkWarning(proxies []ProxyConfig) (BuildWarning, bool) {
+	var problems []string
+	for _, p := range proxies {
+		for _, w := range p.ParseWarnings {
+			problems = append(problems, fmt.Sprintf("%s: %s", p.Name, w))
+		}
+	}
+	if len(problems) == 0 {
+		return BuildWarning{}, false
+	}
+	return NewBuildWarning(WarnProxyLinkFields,
+		fmt.Sprintf("Часть параметров ссылок проигнорирована: %s", strings.Join(problems, "; ")),
+		map[string]string{"count": fmt.Sprintf("%d", len(problems))}), true
+}
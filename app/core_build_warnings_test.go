@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+// warningCodes returns the sorted codes of warnings
+func warningCodes(warnings []BuildWarning) []string {
+	codes := make([]string, 0, len(warnings))
+	for _, w := range warnings {
+		codes = append(codes, w.Code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func TestBuildWarningsPersistedAndCleared(t *testing.T) {
+	base := t.TempDir()
+	storage := NewStorage(base)
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetProfileRoutingMode(profile.ID, RoutingModeAllTraffic); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{storage: storage, logStore: NewLogStore(), initialized: true}
+
+	extra := []string{
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@nl.example.com:443?type=xhttp&security=tls#NL",
+		"hysteria2://pa55@hy.example.com:443/?sni=hy.example.com&obfs=salamander#HY",
+		"trojan://secret@us.example.com:443?security=tls&sni=us.example.com#US",
+	}
+	for _, link := range append([]string{testDirectLink}, extra...) {
+		if err := storage.AddProfileSubscription(profile.ID, link, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := storage.GetAppSettings()
+	settings.MaxProxiesPerProfile = 2
+	settings.PreferredDNS = "tls://dns.example"
+	if err := storage.UpdateAppSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	wg := []UserWireGuardConfig{{
+		Tag: "office", Endpoint: "vpn.corp.example", DNS: "10.8.0.1",
+		AllowedIPs: []string{"10.8.0.0/24", "172.19.0.0/16"},
+	}}
+
+	builder := NewConfigBuilderForStorage(storage)
+	// Every proxy server resolves into the tunnel network
+	builder.resolver, _ = fakeResolver(map[string]string{
+		"de.example.com":   "10.8.0.50",
+		"hy.example.com":   "10.8.0.51",
+		"us.example.com":   "10.8.0.52",
+		"vpn.corp.example": "203.0.113.10",
+	})
+	if err := builder.BuildConfigForProfile(profile.ID, testDirectLink, wg); err != nil {
+		t.Fatalf("BuildConfigForProfile: %v", err)
+	}
+
+	// Two of three proxies are kept under the cap, both overlap the tunnel
+	want := []string{
+		WarnHostOverlap, WarnHostOverlap, WarnPreferredDNSFailed, WarnProxiesOmitted,
+		WarnProxyLinkFields, WarnTransportFiltered, WarnTUNOverlap,
+	}
+	sort.Strings(want)
+	if got := warningCodes(mustStoredProfile(t, storage, profile.ID).BuildWarnings); !equalStringSlices(got, want) {
+		t.Fatalf("warnings = %v, want %v", got, want)
+	}
+
+	// The warnings survive a restart
+	reopened := NewStorage(base)
+	if err := reopened.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	persisted := mustStoredProfile(t, reopened, profile.ID).BuildWarnings
+	if got := warningCodes(persisted); !equalStringSlices(got, want) {
+		t.Errorf("persisted warnings = %v, want %v", got, want)
+	}
+	for _, w := range persisted {
+		if w.Severity == "" || w.Message == "" {
+			t.Errorf("persisted warning %+v lost its severity or message", w)
+		}
+		if w.Code == WarnTUNOverlap && (w.Context["wireguard"] != "office" || w.Context["cidr"] == "") {
+			t.Errorf("tun overlap context = %v", w.Context)
+		}
+	}
+
+	info := a.GetProfileBuildInfo(profile.ID)
+	if info["warning_count"] != len(want) {
+		t.Errorf("GetProfileBuildInfo warning_count = %v, want %d", info["warning_count"], len(want))
+	}
+
+	// A clean rebuild replaces the whole set
+	for _, link := range extra {
+		if _, err := storage.RemoveProfileSubscription(profile.ID, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings.MaxProxiesPerProfile = 0
+	settings.PreferredDNS = ""
+	if err := storage.UpdateAppSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	builder.resolver, _ = fakeResolver(map[string]string{"de.example.com": "203.0.113.20"})
+	if err := builder.BuildConfigForProfile(profile.ID, testDirectLink, nil); err != nil {
+		t.Fatalf("clean BuildConfigForProfile: %v", err)
+	}
+	if warnings := mustStoredProfile(t, storage, profile.ID).BuildWarnings; len(warnings) != 0 {
+		t.Errorf("warnings after a clean rebuild = %+v", warnings)
+	}
+	info = a.GetProfileBuildInfo(profile.ID)
+	if info["warning_count"] != 0 {
+		t.Errorf("GetProfileBuildInfo warning_count = %v after a clean rebuild", info["warning_count"])
+	}
+
+	reopened = NewStorage(base)
+	if err := reopened.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	if warnings := mustStoredProfile(t, reopened, profile.ID).BuildWarnings; len(warnings) != 0 {
+		t.Errorf("persisted warnings after a clean rebuild = %+v", warnings)
+	}
+}
+
+func TestBuildWarningUnmarshal(t *testing.T) {
+	data := `["Серверы с транспортом xhttp пропущены",
+		{"code":"tun_overlap","severity":"warning","message":"overlap","context":{"wireguard":"office"}}]`
+
+	var warnings []BuildWarning
+	if err := json.Unmarshal([]byte(data), &warnings); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := []BuildWarning{
+		{Code: WarnLegacy, Severity: WarningSeverityWarning, Message: "Серверы с транспортом xhttp пропущены"},
+		{Code: WarnTUNOverlap, Severity: WarningSeverityWarning, Message: "overlap", Context: map[string]string{"wireguard": "office"}},
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("warnings = %+v", warnings)
+	}
+	for i := range want {
+		got, _ := json.Marshal(warnings[i])
+		expected, _ := json.Marshal(want[i])
+		if string(got) != string(expected) {
+			t.Errorf("warning %d = %s, want %s", i, got, expected)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package main provides captive portal detection for KampusVPN.
+// Connecting the VPN before logging into a hotel/airport Wi-Fi portal results
+// in a black hole, so the network is probed directly before sing-box starts.
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Captive portal detection settings
+const (
+	// CaptivePortalProbeTimeout limits one probe request.
+	CaptivePortalProbeTimeout = 5 * time.Second
+	// CaptivePortalRetryInterval is the interval between probes while a portal is active.
+	CaptivePortalRetryInterval = 15 * time.Second
+)
+
+// captivePortalProbeURLs return 204 with an empty body on a free network.
+// The second host is used when the first one is blocked by the network.
+var captivePortalProbeURLs = []string{
+	DefaultDelayTestURL,
+	"http://cp.cloudflare.com/generate_204",
+}
+
+// CaptivePortalResult is the result of a captive portal probe.
+type CaptivePortalResult struct {
+	Detected  bool      `json:"detected"`
+	PortalURL string    `json:"portal_url,omitempty"`
+	ProbeURL  string    `json:"probe_url,omitempty"`
+	Reachable bool      `json:"reachable"` // At least one probe host answered
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// newCaptivePortalClient returns an HTTP client that doesn't follow redirects,
+// so the portal redirect itself is visible.
+func newCaptivePortalClient() *http.Client {
+	return &http.Client{
+		Timeout: CaptivePortalProbeTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// DetectCaptivePortal probes the network directly.
+// A redirect or a non-empty 200 instead of 204 means portal. If a probe host is
+// unreachable the next one is tried; when none answers, no portal is reported,
+// so networks that merely block the probe URL never trigger a false positive.
+func DetectCaptivePortal(client *http.Client) CaptivePortalResult {
+	result := CaptivePortalResult{CheckedAt: time.Now()}
+
+	for _, probeURL := range captivePortalProbeURLs {
+		resp, err := client.Get(probeURL)
+		if err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		result.Reachable = true
+
+		switch {
+		case resp.StatusCode == http.StatusNoContent:
+			return result
+
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			location := resp.Header.Get("Location")
+			if location == "" {
+				continue
+			}
+			result.Detected = true
+			result.ProbeURL = probeURL
+			result.PortalURL = location
+			return result
+
+		case resp.StatusCode == http.StatusOK && len(strings.TrimSpace(string(body))) > 0:
+			// Login page served in place of the empty response
+			result.Detected = true
+			result.ProbeURL = probeURL
+			result.PortalURL = probeURL
+			return result
+		}
+		// Other statuses (403 from a filtering proxy etc.) are inconclusive
+	}
+
+	return result
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// probeResponse is a canned answer of a probe host; err simulates a blocked host
+type probeResponse struct {
+	status   int
+	location string
+	body     string
+	err      error
+}
+
+// roundTripFunc lets a function serve as the HTTP layer of a client
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// stubCaptivePortalClient returns the probe client answering each probe URL from responses
+func stubCaptivePortalClient(responses map[string]probeResponse) (*http.Client, *[]string) {
+	var requested []string
+	client := newCaptivePortalClient()
+	client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		r, ok := responses[req.URL.String()]
+		if !ok {
+			return nil, errors.New("unexpected request " + req.URL.String())
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		header := make(http.Header)
+		if r.location != "" {
+			header.Set("Location", r.location)
+		}
+		return &http.Response{
+			StatusCode: r.status,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(r.body)),
+			Request:    req,
+		}, nil
+	})
+	return client, &requested
+}
+
+func TestDetectCaptivePortal(t *testing.T) {
+	primary, fallback := captivePortalProbeURLs[0], captivePortalProbeURLs[1]
+	blocked := probeResponse{err: errors.New("connection reset")}
+	free := probeResponse{status: http.StatusNoContent}
+	const portal = "http://portal.hotel.example/login"
+
+	tests := []struct {
+		name      string
+		primary   probeResponse
+		fallback  probeResponse
+		detected  bool
+		portalURL string
+		probeURL  string
+		reachable bool
+		requests  int
+	}{
+		{"free network", free, free, false, "", "", true, 1},
+		{"redirect to portal", probeResponse{status: http.StatusFound, location: portal}, free, true, portal, primary, true, 1},
+		{"login page instead of 204", probeResponse{status: http.StatusOK, body: "<html><form>Room number</form></html>"}, free, true, primary, primary, true, 1},
+		{"empty 200 is inconclusive", probeResponse{status: http.StatusOK, body: " \n"}, free, false, "", "", true, 2},
+		{"redirect without location", probeResponse{status: http.StatusFound}, free, false, "", "", true, 2},
+		{"filtering proxy", probeResponse{status: http.StatusForbidden, body: "blocked"}, free, false, "", "", true, 2},
+		{"probe host blocked, fallback free", blocked, free, false, "", "", true, 2},
+		{"probe host blocked, fallback redirects", blocked, probeResponse{status: http.StatusTemporaryRedirect, location: portal}, true, portal, fallback, true, 2},
+		{"both hosts blocked", blocked, blocked, false, "", "", false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, requested := stubCaptivePortalClient(map[string]probeResponse{primary: tt.primary, fallback: tt.fallback})
+			result := DetectCaptivePortal(client)
+
+			if result.Detected != tt.detected || result.PortalURL != tt.portalURL || result.ProbeURL != tt.probeURL {
+				t.Errorf("result = %+v, want detected=%v portal=%q probe=%q", result, tt.detected, tt.portalURL, tt.probeURL)
+			}
+			if result.Reachable != tt.reachable {
+				t.Errorf("reachable = %v, want %v", result.Reachable, tt.reachable)
+			}
+			// The portal redirect itself must not be followed
+			if len(*requested) != tt.requests {
+				t.Errorf("requests = %v, want %d", *requested, tt.requests)
+			}
+			if result.CheckedAt.IsZero() {
+				t.Error("CheckedAt not set")
+			}
+		})
+	}
+}
+
+func TestCaptivePortalStatus(t *testing.T) {
+	a, _ := testActivationApp(t)
+	if status := a.getCaptivePortalStatus(); status != nil {
+		t.Fatalf("status without portal = %v", status)
+	}
+	if result := a.OpenCaptivePortal(); result["success"] != false || result["error"] != a.tr("captive_portal_not_found") {
+		t.Errorf("OpenCaptivePortal without portal = %v", result)
+	}
+
+	stop := make(chan struct{})
+	a.captivePortal = &CaptivePortalResult{Detected: true, PortalURL: "http://portal.hotel.example/login"}
+	a.captiveStop = stop
+	status := a.getCaptivePortalStatus()
+	if status["portal_url"] != "http://portal.hotel.example/login" || status["waiting"] != true {
+		t.Errorf("status = %v", status)
+	}
+	if status["message"] != a.tr("captive_portal_detected") {
+		t.Errorf("message = %v", status["message"])
+	}
+
+	// Cancelling stops the watcher and clears the status
+	a.CancelCaptivePortalWait()
+	select {
+	case <-stop:
+	default:
+		t.Error("watcher not stopped")
+	}
+	if status := a.getCaptivePortalStatus(); status != nil {
+		t.Errorf("status after cancel = %v", status)
+	}
+}
@@ -0,0 +1,89 @@
+// Package main provides the Clash API controller settings of KampusVPN.
+// The controller is protected by a random secret generated once per
+// installation, and listens on ClashAPIPort unless another program (e.g.
+// Clash Verge) already took it, in which case a free port is picked.
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// generateClashAPISecret returns a new controller secret (replaced in tests)
+var generateClashAPISecret = GenerateLocalAPIToken
+
+// ensureClashAPISecret generates the controller secret if settings have none.
+// Returns true if settings changed.
+func ensureClashAPISecret(settings *GlobalAppSettings) (bool, error) {
+	if settings.ClashAPISecret != "" {
+		return false, nil
+	}
+	secret, err := generateClashAPISecret()
+	if err != nil {
+		return false, fmt.Errorf("Clash API secret: %w", err)
+	}
+	settings.ClashAPISecret = secret
+	return true, nil
+}
+
+// defaultClashAPIAddress returns the preferred controller address
+func defaultClashAPIAddress() string {
+	return net.JoinHostPort(ClashAPIHost, strconv.Itoa(ClashAPIPort))
+}
+
+// pickClashAPIAddress returns the preferred controller address if its port
+// is free, otherwise an address with a port the system reports as free.
+func pickClashAPIAddress() (string, error) {
+	ln, err := net.Listen("tcp", defaultClashAPIAddress())
+	if err == nil {
+		ln.Close()
+		return defaultClashAPIAddress(), nil
+	}
+	ln, err = net.Listen("tcp", net.JoinHostPort(ClashAPIHost, "0"))
+	if err != nil {
+		return "", fmt.Errorf("no free port for Clash API: %w", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+	return address, nil
+}
+
+// applyClashController points the clash_api of a config at address and sets its secret
+func applyClashController(config map[string]interface{}, address, secret string) {
+	experimental, ok := config["experimental"].(map[string]interface{})
+	if !ok {
+		experimental = map[string]interface{}{}
+		config["experimental"] = experimental
+	}
+	clashAPI, ok := experimental["clash_api"].(map[string]interface{})
+	if !ok {
+		clashAPI = map[string]interface{}{}
+		experimental["clash_api"] = clashAPI
+	}
+	clashAPI["external_controller"] = address
+	if secret != "" {
+		clashAPI["secret"] = secret
+	} else {
+		delete(clashAPI, "secret")
+	}
+}
+
+// EnsureClashAPISecret generates and saves the controller secret if settings
+// have none (generation failed on load).
+func (s *Storage) EnsureClashAPISecret() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed, err := ensureClashAPISecret(&s.data.App)
+	if err != nil || !changed {
+		return err
+	}
+	return s.saveInternal()
+}
+
+// SetClashController sets the controller address runtime configs use ("" = default).
+func (s *Storage) SetClashController(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clashController = address
+}
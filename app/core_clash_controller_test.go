@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// failClashSecret makes secret generation fail until the test ends
+func failClashSecret(t *testing.T) {
+	t.Helper()
+	previous := generateClashAPISecret
+	generateClashAPISecret = func() (string, error) { return "", errors.New("no entropy") }
+	t.Cleanup(func() { generateClashAPISecret = previous })
+}
+
+func TestEnsureClashAPISecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		fail        bool
+		wantChanged bool
+		wantErr     bool
+	}{
+		{"existing secret", "kept", false, false, false},
+		{"existing secret, generator broken", "kept", true, false, false},
+		{"generated", "", false, true, false},
+		{"generator broken", "", true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fail {
+				failClashSecret(t)
+			}
+			settings := GlobalAppSettings{ClashAPISecret: tt.secret}
+			changed, err := ensureClashAPISecret(&settings)
+			if changed != tt.wantChanged || (err != nil) != tt.wantErr {
+				t.Fatalf("ensureClashAPISecret = %v, %v", changed, err)
+			}
+			switch {
+			case tt.secret != "" && settings.ClashAPISecret != tt.secret:
+				t.Errorf("secret = %q, want %q kept", settings.ClashAPISecret, tt.secret)
+			case tt.wantErr && settings.ClashAPISecret != "":
+				t.Errorf("secret = %q after a failed generation", settings.ClashAPISecret)
+			case tt.wantChanged && len(settings.ClashAPISecret) != 64:
+				t.Errorf("secret = %q, want 32 random bytes in hex", settings.ClashAPISecret)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfigNeedsClashSecret(t *testing.T) {
+	failClashSecret(t)
+	storage := NewStorage(t.TempDir())
+	// Settings still load: only the runtime config needs the secret
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	if err := storage.UpdateProfileConfig(DefaultProfileID, testRuntimeConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.WriteActiveConfigToFile(); err == nil {
+		t.Fatal("config written without a Clash API secret")
+	}
+	if err := storage.EnsureClashAPISecret(); err == nil {
+		t.Error("EnsureClashAPISecret succeeded with a broken generator")
+	}
+
+	// Generation works again before the next connect
+	generateClashAPISecret = GenerateLocalAPIToken
+	if err := storage.EnsureClashAPISecret(); err != nil {
+		t.Fatalf("EnsureClashAPISecret: %v", err)
+	}
+	secret := storage.GetAppSettings().ClashAPISecret
+	if secret == "" {
+		t.Fatal("no secret saved")
+	}
+	path, err := storage.WriteActiveConfigToFile()
+	if err != nil {
+		t.Fatalf("WriteActiveConfigToFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Experimental struct {
+			ClashAPI struct {
+				Secret string `json:"secret"`
+			} `json:"clash_api"`
+		} `json:"experimental"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Experimental.ClashAPI.Secret != secret {
+		t.Errorf("clash_api.secret = %q, want the saved secret", config.Experimental.ClashAPI.Secret)
+	}
+}
@@ -0,0 +1,717 @@
+// Package main provides the sing-box config generation steps for KampusVPN.
+// ConfigBuilderForStorage and the legacy file-based ConfigBuilder both turn
+// template.json into a config with the same steps: outbounds from the proxies,
+// WireGuard DNS and route rules, the routing mode and the Clash API section.
+// Each step edits the template map in place.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// configGenerator holds the config generation steps shared by the builders
+type configGenerator struct {
+	filterManager *FilterManager // Local rule-sets of blocked_only mode
+}
+
+// outboundOptions are the builder inputs of generateOutbounds
+type outboundOptions struct {
+	Avoided       map[string]bool   // Proxy tags kept out of auto-select
+	Pinned        []string          // Proxy tags placed right after auto-select in the selector
+	Multiplex     MultiplexSettings // Default multiplex for proxies whose links don't set it
+	GroupByRegion bool              // Add per-country urltest groups to the selector
+}
+
+// newConfigGenerator creates a generator using the given filter manager
+func newConfigGenerator(filterManager *FilterManager) *configGenerator {
+	return &configGenerator{filterManager: filterManager}
+}
+
+// applyWireGuard prepares the template for native WireGuard tunnels:
+// strict_route off and DNS servers for the tunnel networks. The route rules
+// are added by updateRouteRulesForWireGuard after the routing mode.
+func (g *configGenerator) applyWireGuard(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
+	g.disableStrictRouteForWireGuard(template, wireGuardConfigs)
+	g.addWireGuardDNS(template, wireGuardConfigs)
+}
+
+// generateOutbounds generates outbounds list.
+// Proxies from opts.Avoided stay in the selector but are excluded from auto-select;
+// proxies from opts.Pinned come first in the selector, right after auto-select.
+func (g *configGenerator) generateOutbounds(template map[string]interface{}, proxies []ProxyConfig, opts outboundOptions) []interface{} {
+	outbounds := []interface{}{}
+	proxyTags := []string{}
+	urltestTags := []string{}
+	avoided := opts.Avoided
+
+	for _, p := range proxies {
+		applyDefaultMultiplex(&p, opts.Multiplex)
+		outbounds = append(outbounds, p.ToSingboxOutbound())
+		proxyTags = append(proxyTags, p.Tag)
+		if !avoided[p.Tag] {
+			urltestTags = append(urltestTags, p.Tag)
+		}
+	}
+
+	// Never leave auto-select empty - if everything is avoided, use all proxies
+	if len(urltestTags) == 0 {
+		urltestTags = proxyTags
+	}
+
+	outboundsTemplate, ok := template["outbounds_template"].(map[string]interface{})
+	if !ok {
+		outboundsTemplate = map[string]interface{}{}
+	}
+
+	if len(proxyTags) > 0 {
+		urltest, ok := outboundsTemplate["urltest"].(map[string]interface{})
+		if !ok {
+			urltest = map[string]interface{}{
+				"type":      "urltest",
+				"tag":       "auto-select",
+				"url":       "https://www.gstatic.com/generate_204",
+				"interval":  "3m",
+				"tolerance": 50,
+			}
+		}
+		autoSelect := copyMap(urltest)
+		autoSelect["outbounds"] = urltestTags
+		outbounds = append(outbounds, autoSelect)
+
+		// Pinned proxies, then per-country urltest groups go right after auto-select
+		pinnedTags, otherTags := splitPinnedTags(proxyTags, opts.Pinned)
+		selectorOutbounds := append([]string{"auto-select"}, pinnedTags...)
+		if opts.GroupByRegion {
+			groups, groupTags := regionGroupOutbounds(proxies, avoided, urltest)
+			outbounds = append(outbounds, groups...)
+			selectorOutbounds = append(selectorOutbounds, groupTags...)
+		}
+		selectorOutbounds = append(selectorOutbounds, otherTags...)
+		selectorOutbounds = append(selectorOutbounds, "direct")
+
+		if selector, ok := outboundsTemplate["selector"].(map[string]interface{}); ok {
+			selector = copyMap(selector)
+			selector["outbounds"] = selectorOutbounds
+			outbounds = append(outbounds, selector)
+		} else {
+			outbounds = append(outbounds, map[string]interface{}{
+				"type":      "selector",
+				"tag":       "proxy",
+				"outbounds": selectorOutbounds,
+				"default":   "auto-select",
+			})
+		}
+	} else {
+		outbounds = append(outbounds, map[string]interface{}{
+			"type":      "selector",
+			"tag":       "proxy",
+			"outbounds": []string{"direct"},
+			"default":   "direct",
+		})
+	}
+
+	if direct, ok := outboundsTemplate["direct"].(map[string]interface{}); ok {
+		outbounds = append(outbounds, copyMap(direct))
+	} else {
+		outbounds = append(outbounds, map[string]interface{}{
+			"type": "direct",
+			"tag":  "direct",
+		})
+	}
+
+	// block и dns-out удалены - в sing-box 1.11+ используются rule actions
+	// action: "reject" вместо outbound: "block"
+	// action: "hijack-dns" вместо outbound: "dns-out"
+
+	return outbounds
+}
+
+// disableStrictRouteForWireGuard disables strict_route in TUN when WireGuard is used.
+// This allows system routes (WireGuard interface) to work alongside sing-box TUN.
+func (g *configGenerator) disableStrictRouteForWireGuard(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
+	if len(wireGuardConfigs) == 0 {
+		return
+	}
+
+	inbounds, ok := template["inbounds"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for i, inbound := range inbounds {
+		if inboundMap, ok := inbound.(map[string]interface{}); ok {
+			if inboundMap["type"] == "tun" {
+				// Disable strict_route to allow WireGuard routes to work
+				inboundMap["strict_route"] = false
+				inbounds[i] = inboundMap
+				fmt.Printf("[disableStrictRouteForWireGuard] Disabled strict_route for TUN\n")
+				break
+			}
+		}
+	}
+
+	template["inbounds"] = inbounds
+}
+
+// addWireGuardDNS adds DNS servers for WireGuard networks (native WireGuard mode).
+// DNS queries go through "direct" - the WireGuard interface handles routing.
+func (g *configGenerator) addWireGuardDNS(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
+	if len(wireGuardConfigs) == 0 {
+		return
+	}
+
+	dns, ok := template["dns"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	servers, _ := dns["servers"].([]interface{})
+	if servers == nil {
+		servers = []interface{}{}
+	}
+
+	dnsRules, _ := dns["rules"].([]interface{})
+	if dnsRules == nil {
+		dnsRules = []interface{}{}
+	}
+
+	for _, wg := range wireGuardConfigs {
+		if wg.DNS == "" {
+			continue
+		}
+
+		dnsTag := fmt.Sprintf("dns-%s", wg.Tag)
+
+		// Add DNS server - no special binding needed
+		// Traffic to DNS server IP will be excluded from TUN and go through WireGuard
+		server := map[string]interface{}{
+			"type":        "udp",
+			"tag":         dnsTag,
+			"server":      wg.DNS,
+			"server_port": 53,
+		}
+		servers = append(servers, server)
+
+		// Build domain suffixes for DNS rule (none mode adds no rule)
+		domainSuffixes := wg.DNSDomainSuffixes()
+		if len(domainSuffixes) == 0 {
+			fmt.Printf("[addWireGuardDNS] Added DNS server %s (%s) without domain rule\n", dnsTag, wg.DNS)
+			continue
+		}
+
+		// Add DNS rule at the beginning
+		dnsRule := map[string]interface{}{
+			"domain_suffix": domainSuffixes,
+			"action":        "route",
+			"server":        dnsTag,
+		}
+		dnsRules = append([]interface{}{dnsRule}, dnsRules...)
+
+		fmt.Printf("[addWireGuardDNS] Added DNS server %s (%s) for domains: %v\n", dnsTag, wg.DNS, domainSuffixes)
+	}
+
+	dns["servers"] = servers
+	dns["rules"] = dnsRules
+}
+
+// updateRouteRulesForWireGuard adds the route rules of native WireGuard tunnels.
+// It runs after the routing mode, which replaces route.rules.
+// Traffic goes through "direct" - the WireGuard interface handles routing based on AllowedIPs.
+func (g *configGenerator) updateRouteRulesForWireGuard(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
+	route, ok := template["route"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	rules, _ := route["rules"].([]interface{})
+	route["rules"] = placeWireGuardRouteRules(rules, wireGuardConfigs)
+}
+
+// wireGuardRouteRules returns the DNS bypass rule for the tunnel DNS servers
+// and the rule for the tunnel networks (nil when there is nothing to route)
+func wireGuardRouteRules(wireGuardConfigs []UserWireGuardConfig) (dnsBypass, cidrRule map[string]interface{}) {
+	dnsServers := []string{}
+	allowedIPs := []string{}
+	for _, wg := range wireGuardConfigs {
+		if wg.DNS != "" {
+			dnsServers = append(dnsServers, wg.DNS)
+		}
+		allowedIPs = append(allowedIPs, wg.AllowedIPs...)
+	}
+	// Canonical networks: a full tunnel must not send all traffic direct
+	cidrs := ExtractNetworksFromAllowedIPs(allowedIPs)
+	if len(dnsServers) > 0 {
+		dnsBypass = map[string]interface{}{
+			"ip_cidr":  dnsServers,
+			"port":     53,
+			"action":   "route",
+			"outbound": "direct",
+		}
+	}
+	if len(cidrs) > 0 {
+		cidrRule = map[string]interface{}{
+			"ip_cidr":  cidrs,
+			"action":   "route",
+			"outbound": "direct",
+		}
+	}
+	return dnsBypass, cidrRule
+}
+
+// placeWireGuardRouteRules puts the WireGuard rules in the documented order:
+// the DNS bypass right before hijack-dns, so queries to the tunnel DNS servers
+// reach them, and the tunnel networks right after it. Earlier WireGuard rules
+// are removed first, so placing twice gives the same result.
+func placeWireGuardRouteRules(rules []interface{}, wireGuardConfigs []UserWireGuardConfig) []interface{} {
+	dnsBypass, cidrRule := wireGuardRouteRules(wireGuardConfigs)
+	if dnsBypass == nil && cidrRule == nil {
+		return rules
+	}
+
+	wgAddresses := map[string]bool{}
+	for _, rule := range []map[string]interface{}{dnsBypass, cidrRule} {
+		for _, cidr := range ruleCIDRs(rule) {
+			wgAddresses[cidr] = true
+		}
+	}
+	wgOutbounds := map[string]bool{"direct": true}
+	for _, wg := range wireGuardConfigs {
+		wgOutbounds[wg.Tag] = true
+	}
+	kept := make([]interface{}, 0, len(rules)+2)
+	for _, rule := range rules {
+		if isWireGuardRouteRule(rule, wgAddresses, wgOutbounds) {
+			continue
+		}
+		kept = append(kept, rule)
+	}
+
+	// Without hijack-dns both go right after sniff
+	hijackIdx, afterSniff := -1, 0
+	for i, rule := range kept {
+		if ruleMap, ok := rule.(map[string]interface{}); ok {
+			action, _ := ruleMap["action"].(string)
+			if action == "hijack-dns" {
+				hijackIdx = i
+				break
+			}
+			if action == "sniff" {
+				afterSniff = i + 1
+			}
+		}
+	}
+
+	before, after := kept[:afterSniff], kept[afterSniff:]
+	if hijackIdx >= 0 {
+		before, after = kept[:hijackIdx], kept[hijackIdx:]
+	}
+	result := make([]interface{}, 0, len(kept)+2)
+	result = append(result, before...)
+	if dnsBypass != nil {
+		result = append(result, dnsBypass)
+	}
+	if hijackIdx >= 0 {
+		result = append(result, after[0])
+		after = after[1:]
+	}
+	if cidrRule != nil {
+		result = append(result, cidrRule)
+	}
+	result = append(result, after...)
+
+	fmt.Printf("[updateRouteRulesForWireGuard] DNS bypass %v, tunnel networks %v\n", ruleCIDRs(dnsBypass), ruleCIDRs(cidrRule))
+	return result
+}
+
+// isWireGuardRouteRule reports whether rule routes only addresses of WireGuard
+// tunnels (optionally on port 53) direct. Older builds routed them to the tunnel tag.
+func isWireGuardRouteRule(rule interface{}, wgAddresses, wgOutbounds map[string]bool) bool {
+	ruleMap, ok := rule.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, value := range ruleMap {
+		switch key {
+		case "ip_cidr":
+		case "outbound":
+			if tag, _ := value.(string); !wgOutbounds[tag] {
+				return false
+			}
+		case "action":
+			if value != "route" {
+				return false
+			}
+		case "port":
+			if port, ok := jsonNumber(value); !ok || port != 53 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	cidrs := ruleCIDRs(ruleMap)
+	if len(cidrs) == 0 {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if !wgAddresses[cidr] {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleCIDRs returns the ip_cidr list of a rule, built or decoded from JSON
+func ruleCIDRs(rule map[string]interface{}) []string {
+	switch v := rule["ip_cidr"].(type) {
+	case []string:
+		return v
+	case string:
+		return []string{v}
+	case []interface{}:
+		cidrs := make([]string, 0, len(v))
+		for _, item := range v {
+			if cidr, ok := item.(string); ok {
+				cidrs = append(cidrs, cidr)
+			}
+		}
+		return cidrs
+	}
+	return nil
+}
+
+// jsonNumber returns a number of a built or decoded config value
+func jsonNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// addExperimentalAPI adds experimental section for traffic stats.
+func (g *configGenerator) addExperimentalAPI(template map[string]interface{}) {
+	experimental, ok := template["experimental"].(map[string]interface{})
+	if !ok {
+		experimental = map[string]interface{}{}
+		template["experimental"] = experimental
+	}
+
+	// The controller address is only the default here: renderRuntimeConfig
+	// moves it to the port picked at connect and adds the secret
+	clashAPI, ok := experimental["clash_api"].(map[string]interface{})
+	if !ok {
+		experimental["clash_api"] = map[string]interface{}{
+			"external_controller": defaultClashAPIAddress(),
+		}
+	} else {
+		if _, exists := clashAPI["external_controller"]; !exists {
+			clashAPI["external_controller"] = defaultClashAPIAddress()
+		}
+	}
+
+	// Persist urltest results across restarts (sing-box 1.8+).
+	// Relative path: sing-box runs with resources as working directory,
+	// so the stored config stays machine-independent in exports.
+	experimental["cache_file"] = map[string]interface{}{
+		"enabled": true,
+		"path":    URLTestCacheFile,
+	}
+}
+
+// applyRoutingMode applies routing rules based on the routing mode of the profile.
+// App rules of the profile are placed ahead of the mode rules. Only invalid
+// custom routing fails.
+func (g *configGenerator) applyRoutingMode(template map[string]interface{}, mode RoutingMode, appRules []AppRule, customRules *CustomDomainRules, customRouting *CustomRouting) error {
+	route, ok := template["route"].(map[string]interface{})
+	if !ok {
+		route = map[string]interface{}{}
+		template["route"] = route
+	}
+
+	// Clean up DNS rules that reference remote rule_sets (geosite-*)
+	g.cleanupDNSRuleSets(template)
+
+	switch mode {
+	case RoutingModeBlockedOnly:
+		// Only blocked sites through VPN - use Re:filter + community rule-sets
+		g.applyBlockedOnlyMode(route)
+
+	case RoutingModeExceptRussia:
+		// All except Russia through VPN - use built-in RU domain list
+		g.applyExceptRussiaMode(route)
+
+	case RoutingModeAllTraffic:
+		// All traffic through VPN - remove direct rules for Russia
+		g.applyAllTrafficMode(route)
+
+	case RoutingModeCustom:
+		// The user's own rules after the mandatory ones
+		if err := g.applyCustomMode(template, route, customRouting); err != nil {
+			return err
+		}
+
+	default:
+		// Unknown mode, use blocked_only as safest default
+		fmt.Printf("[applyRoutingMode] Unknown mode %s, using blocked_only\n", mode)
+		g.applyBlockedOnlyMode(route)
+	}
+
+	insertAppRules(route, appRules)
+	insertCustomRules(route, customRules)
+	return nil
+}
+
+// cleanupDNSRuleSets removes DNS rules that reference remote rule_sets (geosite-*).
+// These are not available in blocked_only and all_traffic modes.
+func (g *configGenerator) cleanupDNSRuleSets(template map[string]interface{}) {
+	dns, ok := template["dns"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	rules, ok := dns["rules"].([]interface{})
+	if !ok {
+		return
+	}
+
+	// Filter out rules that use rule_set with geosite-*
+	newRules := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			newRules = append(newRules, rule)
+			continue
+		}
+
+		// Check if this rule uses rule_set
+		if ruleSet, hasRuleSet := ruleMap["rule_set"]; hasRuleSet {
+			// Skip rules with geosite-* rule_sets
+			if ruleSetArr, ok := ruleSet.([]interface{}); ok {
+				hasGeosite := false
+				for _, rs := range ruleSetArr {
+					if rsStr, ok := rs.(string); ok {
+						if strings.HasPrefix(rsStr, "geosite-") || strings.HasPrefix(rsStr, "geoip-") {
+							hasGeosite = true
+							break
+						}
+					}
+				}
+				if hasGeosite {
+					fmt.Printf("[cleanupDNSRuleSets] Removed DNS rule with remote rule_set: %v\n", ruleSet)
+					continue
+				}
+			}
+		}
+
+		newRules = append(newRules, rule)
+	}
+
+	dns["rules"] = newRules
+}
+
+// applyBlockedOnlyMode configures routing for blocked sites only.
+func (g *configGenerator) applyBlockedOnlyMode(route map[string]interface{}) {
+	fmt.Printf("[applyRoutingMode] Using blocked_only mode with local filters\n")
+
+	// Get local filter rule_sets
+	filterRuleSets := g.filterManager.GetRuleSetConfigs()
+	if len(filterRuleSets) == 0 {
+		fmt.Printf("[applyRoutingMode] WARNING: No filter files found, falling back to except_russia\n")
+		return
+	}
+
+	// Build new rule_set array with only local filters
+	newRuleSets := make([]interface{}, 0, len(filterRuleSets))
+	for _, rs := range filterRuleSets {
+		newRuleSets = append(newRuleSets, rs)
+	}
+	route["rule_set"] = newRuleSets
+
+	// Build new rules for blocked_only mode
+	newRules := []interface{}{
+		// 1. Sniff for protocol detection
+		map[string]interface{}{
+			"action": "sniff",
+		},
+		// 2. Local domains direct
+		map[string]interface{}{
+			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
+			"action":        "route",
+			"outbound":      "direct",
+		},
+		// 3. Hijack DNS
+		map[string]interface{}{
+			"protocol": "dns",
+			"action":   "hijack-dns",
+		},
+		// 4. Private IPs direct
+		map[string]interface{}{
+			"ip_is_private": true,
+			"action":        "route",
+			"outbound":      "direct",
+		},
+	}
+
+	// 5. Add rules for blocked domains/IPs through proxy, only for loaded
+	// rule_sets: a filter missing after a failed update must not break the config
+	loaded := make(map[string]bool, len(filterRuleSets))
+	for _, rs := range filterRuleSets {
+		if tag, ok := rs["tag"].(string); ok {
+			loaded[tag] = true
+		}
+	}
+	for _, f := range FilterFiles {
+		if !loaded[f.Tag] {
+			continue
+		}
+		newRules = append(newRules, map[string]interface{}{
+			"rule_set": []string{f.Tag},
+			"action":   "route",
+			"outbound": "proxy",
+		})
+	}
+
+	route["rules"] = newRules
+	route["final"] = "direct"
+
+	fmt.Printf("[applyRoutingMode] Applied blocked_only: %d rule_sets, %d rules, final=direct\n",
+		len(newRuleSets), len(newRules))
+}
+
+// applyAllTrafficMode configures routing for all traffic through VPN.
+func (g *configGenerator) applyAllTrafficMode(route map[string]interface{}) {
+	fmt.Printf("[applyRoutingMode] Using all_traffic mode\n")
+
+	// Remove rule_sets (not needed for all traffic mode)
+	route["rule_set"] = []interface{}{}
+
+	// Minimal rules
+	newRules := []interface{}{
+		map[string]interface{}{
+			"action": "sniff",
+		},
+		map[string]interface{}{
+			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
+			"action":        "route",
+			"outbound":      "direct",
+		},
+		map[string]interface{}{
+			"protocol": "dns",
+			"action":   "hijack-dns",
+		},
+		map[string]interface{}{
+			"ip_is_private": true,
+			"action":        "route",
+			"outbound":      "direct",
+		},
+	}
+
+	route["rules"] = newRules
+	route["final"] = "proxy"
+
+	fmt.Printf("[applyRoutingMode] Applied all_traffic: minimal rules, final=proxy\n")
+}
+
+// applyExceptRussiaMode configures routing for all traffic except Russia through VPN.
+// Uses built-in domain list instead of remote geosite to avoid download issues.
+func (g *configGenerator) applyExceptRussiaMode(route map[string]interface{}) {
+	fmt.Printf("[applyRoutingMode] Using except_russia mode with built-in domain list\n")
+
+	// No remote rule_sets needed - we use built-in domain suffixes
+	route["rule_set"] = []interface{}{}
+
+	// Russian domain suffixes for direct routing
+	ruDomainSuffixes := []string{
+		// Top-level domains
+		".ru", ".su", ".рф",
+		// Yandex
+		".yandex.com", ".yandex.net", ".yandex.ru", ".ya.ru", ".yandex.by", ".yandex.kz",
+		// VK / Mail.ru
+		".vk.com", ".vkontakte.ru", ".vk.me", ".userapi.com",
+		".mail.ru", ".mailru.com", ".mycdn.me", ".imgsmail.ru",
+		".ok.ru", ".odnoklassniki.ru",
+		// Banks
+		".sberbank.ru", ".sber.ru", ".tinkoff.ru", ".tinkoff.com", ".vtb.ru", ".alfabank.ru",
+		".raiffeisen.ru", ".gazprombank.ru", ".open.ru", ".rosbank.ru",
+		// Government
+		".gosuslugi.ru", ".mos.ru", ".nalog.ru", ".government.ru", ".kremlin.ru",
+		".duma.gov.ru", ".cbr.ru", ".pfrf.ru", ".fss.ru",
+		// News
+		".ria.ru", ".rbc.ru", ".interfax.ru", ".tass.ru", ".kommersant.ru",
+		".lenta.ru", ".gazeta.ru", ".kp.ru", ".mk.ru", ".iz.ru", ".rt.com",
+		// E-commerce
+		".ozon.ru", ".wildberries.ru", ".lamoda.ru", ".dns-shop.ru", ".mvideo.ru",
+		".eldorado.ru", ".citilink.ru", ".avito.ru", ".youla.ru",
+		// Retail
+		".perekrestok.ru", ".magnit.ru", ".5ka.ru", ".dixy.ru", ".lenta.com",
+		".sbermarket.ru", ".delivery-club.ru",
+		// Transport
+		".rzd.ru", ".aeroflot.ru", ".s7.ru", ".utair.ru", ".pobeda.aero",
+		".pochta.ru", ".cdek.ru", ".boxberry.ru", ".dpd.ru",
+		// Telecom
+		".mts.ru", ".megafon.ru", ".beeline.ru", ".tele2.ru",
+		".rostelecom.ru", ".rt.ru",
+		// Media
+		".vgtrk.ru", ".1tv.ru", ".ntv.ru", ".ren.tv", ".ctc.ru",
+		".rutube.ru", ".ivi.ru", ".okko.tv", ".more.tv", ".kinopoisk.ru",
+		".dzen.ru", ".zen.yandex.ru",
+		// Maps / Navigation
+		".2gis.ru", ".2gis.com",
+		// Other popular
+		".sports.ru", ".championat.com", ".sport-express.ru",
+		".hh.ru", ".superjob.ru", ".rabota.ru",
+		".cian.ru", ".domclick.ru", ".avito.ru",
+		".pikabu.ru", ".habr.com", ".vc.ru", ".dtf.ru",
+	}
+
+	// Russian domain keywords for additional matching
+	ruDomainKeywords := []string{
+		"yandex", "sber", "tinkoff", "gosuslugi", "rutube",
+		"vkontakte", "mailru", "rambler", "wildberries", "ozon",
+	}
+
+	newRules := []interface{}{
+		// 1. Sniff for protocol detection
+		map[string]interface{}{
+			"action": "sniff",
+		},
+		// 2. Local domains direct
+		map[string]interface{}{
+			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
+			"action":        "route",
+			"outbound":      "direct",
+		},
+		// 3. Hijack DNS
+		map[string]interface{}{
+			"protocol": "dns",
+			"action":   "hijack-dns",
+		},
+		// 4. Private IPs direct
+		map[string]interface{}{
+			"ip_is_private": true,
+			"action":        "route",
+			"outbound":      "direct",
+		},
+		// 5. Russian domains direct
+		map[string]interface{}{
+			"domain_suffix": ruDomainSuffixes,
+			"action":        "route",
+			"outbound":      "direct",
+		},
+		// 6. Russian domain keywords direct
+		map[string]interface{}{
+			"domain_keyword": ruDomainKeywords,
+			"action":         "route",
+			"outbound":       "direct",
+		},
+	}
+
+	route["rules"] = newRules
+	route["final"] = "proxy"
+
+	fmt.Printf("[applyRoutingMode] Applied except_russia: %d domain suffixes, %d keywords, final=proxy\n",
+		len(ruDomainSuffixes), len(ruDomainKeywords))
+}
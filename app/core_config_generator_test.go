@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWireGuardRouteRulesNormalizesAllowedIPs(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowedIPs []string
+		want       []string
+	}{
+		{"subnets", []string{"10.8.0.0/24", "fd00::/64"}, []string{"10.8.0.0/24", "fd00::/64"}},
+		{"host bits set", []string{"10.8.0.5/24", "fd00::1/64"}, []string{"10.8.0.0/24", "fd00::/64"}},
+		{"single addresses", []string{"10.8.0.1", "fd00::1"}, []string{"10.8.0.1/32", "fd00::1/128"}},
+		{"spaces and duplicates", []string{" 10.8.0.0/24", "10.8.0.7/24 "}, []string{"10.8.0.0/24"}},
+		{"invalid entries", []string{"vpn.example.com", "10.8.0.0/33", ""}, nil},
+		{"full tunnel", []string{"0.0.0.0/0", "::/0"}, nil},
+		{"full tunnel with host bits", []string{"10.0.0.1/0", "::1/0"}, nil},
+		{"split default route", []string{"0.0.0.0/1", "128.0.0.0/1", "::/1", "8000::/1"}, nil},
+		{"full tunnel beside subnet", []string{"0.0.0.0/0", "192.168.50.0/24"}, []string{"192.168.50.0/24"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rule := wireGuardRouteRules([]UserWireGuardConfig{{Tag: "wg", AllowedIPs: tt.allowedIPs}})
+			if tt.want == nil {
+				if rule != nil {
+					t.Fatalf("rule = %v, want none", rule)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatal("no rule")
+			}
+			if got := ruleCIDRs(rule); !equalStringSlices(got, tt.want) {
+				t.Errorf("ip_cidr = %v, want %v", got, tt.want)
+			}
+			if rule["outbound"] != "direct" {
+				t.Errorf("outbound = %v, want direct", rule["outbound"])
+			}
+		})
+	}
+}
+
+func TestWireGuardRouteRulesMergesConfigs(t *testing.T) {
+	configs := []UserWireGuardConfig{
+		{Tag: "office", DNS: "10.8.0.1", AllowedIPs: []string{"10.8.0.0/24"}},
+		{Tag: "lab", AllowedIPs: []string{"10.8.0.9/24", "172.16.0.0/16"}},
+	}
+
+	dnsBypass, rule := wireGuardRouteRules(configs)
+	if got := ruleCIDRs(rule); !equalStringSlices(got, []string{"10.8.0.0/24", "172.16.0.0/16"}) {
+		t.Errorf("ip_cidr = %v", got)
+	}
+	if got := ruleCIDRs(dnsBypass); !equalStringSlices(got, []string{"10.8.0.1"}) {
+		t.Errorf("DNS bypass = %v", got)
+	}
+}
+
+// testGeneratorTemplate returns a template with the sections the generator edits
+func testGeneratorTemplate() map[string]interface{} {
+	return map[string]interface{}{
+		"dns": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"rule_set": []interface{}{"geosite-ru"}, "server": "local"},
+				map[string]interface{}{"domain_suffix": []interface{}{".lan"}, "server": "local"},
+			},
+		},
+		"inbounds": []interface{}{
+			map[string]interface{}{"type": "tun", "tag": "tun-in", "strict_route": true},
+		},
+		"route": map[string]interface{}{
+			"rule_set": []interface{}{map[string]interface{}{"tag": "geosite-ru", "type": "remote"}},
+			"rules":    []interface{}{map[string]interface{}{"action": "sniff"}},
+			"final":    "proxy",
+		},
+	}
+}
+
+// testFilterManager returns a filter manager whose folder holds the given filter files
+func testFilterManager(t *testing.T, names ...string) *FilterManager {
+	t.Helper()
+	base := t.TempDir()
+	fm := NewFilterManager(base)
+	if err := os.MkdirAll(fm.GetFiltersPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(fm.GetFiltersPath(), name), []byte("srs"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fm
+}
+
+// routeRuleOutbounds returns "action" or "action:outbound" of every route rule
+func routeRuleOutbounds(route map[string]interface{}) []string {
+	rules, _ := route["rules"].([]interface{})
+	result := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		ruleMap, _ := rule.(map[string]interface{})
+		action, _ := ruleMap["action"].(string)
+		if outbound, ok := ruleMap["outbound"].(string); ok {
+			action += ":" + outbound
+		}
+		result = append(result, action)
+	}
+	return result
+}
+
+func TestApplyRoutingMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     RoutingMode
+		filters  []string
+		final    string
+		ruleSets int
+		rules    []string
+	}{
+		{
+			name:     "blocked only",
+			mode:     RoutingModeBlockedOnly,
+			filters:  []string{"refilter_domains.srs", "discord_ips.srs"},
+			final:    "direct",
+			ruleSets: 2,
+			rules:    []string{"sniff", "route:direct", "hijack-dns", "route:direct", "route:proxy", "route:proxy"},
+		},
+		{
+			name:     "unknown mode is blocked only",
+			mode:     RoutingMode("bogus"),
+			filters:  []string{"refilter_ips.srs"},
+			final:    "direct",
+			ruleSets: 1,
+			rules:    []string{"sniff", "route:direct", "hijack-dns", "route:direct", "route:proxy"},
+		},
+		{
+			name:  "all traffic",
+			mode:  RoutingModeAllTraffic,
+			final: "proxy",
+			rules: []string{"sniff", "route:direct", "hijack-dns", "route:direct"},
+		},
+		{
+			name:  "except russia",
+			mode:  RoutingModeExceptRussia,
+			final: "proxy",
+			rules: []string{"sniff", "route:direct", "hijack-dns", "route:direct", "route:direct", "route:direct"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := testGeneratorTemplate()
+			g := newConfigGenerator(testFilterManager(t, tt.filters...))
+			if err := g.applyRoutingMode(template, tt.mode, nil, nil, nil); err != nil {
+				t.Fatalf("applyRoutingMode: %v", err)
+			}
+
+			route := template["route"].(map[string]interface{})
+			if route["final"] != tt.final {
+				t.Errorf("final = %v, want %s", route["final"], tt.final)
+			}
+			if ruleSets, _ := route["rule_set"].([]interface{}); len(ruleSets) != tt.ruleSets {
+				t.Errorf("rule_set = %v, want %d local filters", ruleSets, tt.ruleSets)
+			}
+			if got := routeRuleOutbounds(route); !equalStringSlices(got, tt.rules) {
+				t.Errorf("rules = %v, want %v", got, tt.rules)
+			}
+
+			// DNS rules of remote rule-sets are dropped in every mode
+			dnsRules := template["dns"].(map[string]interface{})["rules"].([]interface{})
+			if len(dnsRules) != 1 {
+				t.Errorf("dns rules = %v, want the geosite rule removed", dnsRules)
+			}
+		})
+	}
+}
+
+func TestApplyBlockedOnlyWithoutFilters(t *testing.T) {
+	// Without filter files blocked_only keeps the template rules
+	template := testGeneratorTemplate()
+	g := newConfigGenerator(testFilterManager(t))
+	if err := g.applyRoutingMode(template, RoutingModeBlockedOnly, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	route := template["route"].(map[string]interface{})
+	if got := routeRuleOutbounds(route); !equalStringSlices(got, []string{"sniff"}) {
+		t.Errorf("rules = %v, want the template rules kept", got)
+	}
+	if route["final"] != "proxy" {
+		t.Errorf("final = %v, want the template final", route["final"])
+	}
+}
+
+func TestPlaceWireGuardRouteRules(t *testing.T) {
+	wg := []UserWireGuardConfig{{Tag: "office", DNS: "10.8.0.1", AllowedIPs: []string{"10.8.0.0/24"}}}
+	sniff := map[string]interface{}{"action": "sniff"}
+	local := map[string]interface{}{"domain_suffix": []string{".lan"}, "action": "route", "outbound": "direct"}
+	hijack := map[string]interface{}{"protocol": "dns", "action": "hijack-dns"}
+	private := map[string]interface{}{"ip_is_private": true, "action": "route", "outbound": "direct"}
+
+	tests := []struct {
+		name  string
+		rules []interface{}
+		want  []string
+	}{
+		{
+			name:  "around hijack-dns",
+			rules: []interface{}{sniff, local, hijack, private},
+			want:  []string{"sniff", "route:direct", "wg-dns", "hijack-dns", "wg-net", "route:direct"},
+		},
+		{
+			name:  "after sniff without hijack-dns",
+			rules: []interface{}{sniff, private},
+			want:  []string{"sniff", "wg-dns", "wg-net", "route:direct"},
+		},
+		{
+			name:  "empty rules",
+			rules: nil,
+			want:  []string{"wg-dns", "wg-net"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := placeWireGuardRouteRules(tt.rules, wg)
+			if got := wireGuardRuleNames(rules); !equalStringSlices(got, tt.want) {
+				t.Errorf("rules = %v, want %v", got, tt.want)
+			}
+
+			// Placing again moves the rules instead of adding copies
+			again := placeWireGuardRouteRules(rules, wg)
+			if got := wireGuardRuleNames(again); !equalStringSlices(got, tt.want) {
+				t.Errorf("placed twice = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// wireGuardRuleNames is routeRuleOutbounds with the WireGuard rules named
+// wg-dns (port 53) and wg-net
+func wireGuardRuleNames(rules []interface{}) []string {
+	names := routeRuleOutbounds(map[string]interface{}{"rules": rules})
+	for i, rule := range rules {
+		ruleMap := rule.(map[string]interface{})
+		if _, ok := ruleMap["ip_cidr"]; !ok {
+			continue
+		}
+		if _, ok := ruleMap["port"]; ok {
+			names[i] = "wg-dns"
+		} else {
+			names[i] = "wg-net"
+		}
+	}
+	return names
+}
+
+// outboundGroup returns the tags of outbounds and the members of the outbound tagged group
+func outboundGroup(outbounds []interface{}, group string) (tags, members []string) {
+	for _, outbound := range outbounds {
+		outboundMap := outbound.(map[string]interface{})
+		tag, _ := outboundMap["tag"].(string)
+		tags = append(tags, tag)
+		if tag == group {
+			members, _ = outboundMap["outbounds"].([]string)
+		}
+	}
+	return tags, members
+}
+
+func TestGenerateOutbounds(t *testing.T) {
+	proxies := []ProxyConfig{
+		{Type: "trojan", Tag: "de", Server: "de.example.com", ServerPort: 443, Password: "p"},
+		{Type: "trojan", Tag: "nl", Server: "nl.example.com", ServerPort: 443, Password: "p"},
+		{Type: "trojan", Tag: "us", Server: "us.example.com", ServerPort: 443, Password: "p"},
+	}
+
+	tests := []struct {
+		name       string
+		proxies    []ProxyConfig
+		opts       outboundOptions
+		tags       []string
+		autoSelect []string
+		selector   []string
+	}{
+		{
+			name:       "plain",
+			proxies:    proxies,
+			tags:       []string{"de", "nl", "us", "auto-select", "proxy", "direct"},
+			autoSelect: []string{"de", "nl", "us"},
+			selector:   []string{"auto-select", "de", "nl", "us", "direct"},
+		},
+		{
+			name:       "avoided stay in the selector",
+			proxies:    proxies,
+			opts:       outboundOptions{Avoided: map[string]bool{"nl": true}},
+			tags:       []string{"de", "nl", "us", "auto-select", "proxy", "direct"},
+			autoSelect: []string{"de", "us"},
+			selector:   []string{"auto-select", "de", "nl", "us", "direct"},
+		},
+		{
+			name:       "all avoided",
+			proxies:    proxies,
+			opts:       outboundOptions{Avoided: map[string]bool{"de": true, "nl": true, "us": true}},
+			tags:       []string{"de", "nl", "us", "auto-select", "proxy", "direct"},
+			autoSelect: []string{"de", "nl", "us"},
+			selector:   []string{"auto-select", "de", "nl", "us", "direct"},
+		},
+		{
+			name:       "pinned first",
+			proxies:    proxies,
+			opts:       outboundOptions{Pinned: []string{"us", "gone"}},
+			tags:       []string{"de", "nl", "us", "auto-select", "proxy", "direct"},
+			autoSelect: []string{"de", "nl", "us"},
+			selector:   []string{"auto-select", "us", "de", "nl", "direct"},
+		},
+		{
+			name:     "no proxies",
+			tags:     []string{"proxy", "direct"},
+			selector: []string{"direct"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newConfigGenerator(nil)
+			outbounds := g.generateOutbounds(map[string]interface{}{}, tt.proxies, tt.opts)
+			tags, selector := outboundGroup(outbounds, "proxy")
+			if !equalStringSlices(tags, tt.tags) {
+				t.Errorf("outbounds = %v, want %v", tags, tt.tags)
+			}
+			if !equalStringSlices(selector, tt.selector) {
+				t.Errorf("selector = %v, want %v", selector, tt.selector)
+			}
+			if _, autoSelect := outboundGroup(outbounds, "auto-select"); !equalStringSlices(autoSelect, tt.autoSelect) {
+				t.Errorf("auto-select = %v, want %v", autoSelect, tt.autoSelect)
+			}
+		})
+	}
+}
+
+func TestConfigGenerationDeterministic(t *testing.T) {
+	fm := testFilterManager(t, "refilter_domains.srs", "community_ips.srs")
+	proxies := []ProxyConfig{
+		{Type: "trojan", Tag: "de", Server: "de.example.com", ServerPort: 443, Password: "p"},
+		{Type: "vless", Tag: "nl", Server: "nl.example.com", ServerPort: 443, UUID: "b831381d-6324-4d53-ad4f-8cda48b30811"},
+	}
+	wg := []UserWireGuardConfig{{Tag: "office", DNS: "10.8.0.1", AllowedIPs: []string{"10.8.0.0/24", "172.16.0.0/16"}}}
+
+	generate := func(mode RoutingMode) []byte {
+		template := testGeneratorTemplate()
+		g := newConfigGenerator(fm)
+		template["outbounds"] = g.generateOutbounds(template, proxies, outboundOptions{Avoided: map[string]bool{"nl": true}})
+		g.applyWireGuard(template, wg)
+		if err := g.applyRoutingMode(template, mode, nil, nil, nil); err != nil {
+			t.Fatalf("applyRoutingMode: %v", err)
+		}
+		g.updateRouteRulesForWireGuard(template, wg)
+		g.addExperimentalAPI(template)
+		data, err := MarshalCanonicalJSON(template)
+		if err != nil {
+			t.Fatalf("MarshalCanonicalJSON: %v", err)
+		}
+		return data
+	}
+
+	for _, mode := range []RoutingMode{RoutingModeBlockedOnly, RoutingModeAllTraffic, RoutingModeExceptRussia} {
+		first := generate(mode)
+		for i := 0; i < 5; i++ {
+			if again := generate(mode); !bytes.Equal(again, first) {
+				t.Fatalf("%s: generation %d differs:\n%s\n%s", mode, i+2, first, again)
+			}
+		}
+	}
+}
+
+// goldenWireGuard is the WireGuard config of the golden builds
+var goldenWireGuard = []UserWireGuardConfig{{
+	Tag:          "wg-office",
+	Name:         "Office",
+	LocalAddress: []string{"10.8.0.2/32"},
+	DNS:          "10.8.0.1",
+	AllowedIPs:   []string{"10.8.0.0/24", "192.168.50.0/24"},
+	Endpoint:     "vpn.corp.example",
+	EndpointPort: 51820,
+}}
+
+// TestBuildConfigForProfileGolden compares configs of the Storage builder with
+// testdata/config_golden. The files were generated by the builder before the
+// configGenerator extraction, then updated only for the WireGuard rule order
+// fix, relocatable rule_set paths and the WireGuard DNS rule following the
+// internal domains mode. A changed file must come with a deliberate change.
+func TestBuildConfigForProfileGolden(t *testing.T) {
+	tests := []struct {
+		golden    string
+		mode      RoutingMode
+		wireGuard []UserWireGuardConfig
+	}{
+		{"blocked_only", RoutingModeBlockedOnly, nil},
+		{"except_russia", RoutingModeExceptRussia, nil},
+		{"all_traffic", RoutingModeAllTraffic, nil},
+		{"blocked_only_wireguard", RoutingModeBlockedOnly, goldenWireGuard},
+		{"all_traffic_wireguard", RoutingModeAllTraffic, goldenWireGuard},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			base := t.TempDir()
+			storage := NewStorage(base)
+			if err := storage.Init(); err != nil {
+				t.Fatalf("Storage.Init: %v", err)
+			}
+			filtersPath := filepath.Join(base, "bin", FiltersFolder)
+			if err := os.MkdirAll(filtersPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"refilter_domains.srs", "refilter_ips.srs", "community_domains.srs", "community_ips.srs", "discord_ips.srs"} {
+				if err := os.WriteFile(filepath.Join(filtersPath, name), []byte("srs"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			profile, err := storage.CreateProfile("Golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.SetProfileRoutingMode(profile.ID, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewConfigBuilderForStorage(storage).BuildConfigForProfile(profile.ID, testDirectLink, tt.wireGuard); err != nil {
+				t.Fatalf("BuildConfigForProfile: %v", err)
+			}
+			got, err := json.MarshalIndent(mustStoredProfile(t, storage, profile.ID).SingboxConfig, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join("testdata", "config_golden", tt.golden+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, gotConfig interface{}
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("golden file: %v", err)
+			}
+			if err := json.Unmarshal(got, &gotConfig); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotConfig, want) {
+				t.Errorf("config differs from %s.json:\n%s", tt.golden, got)
+			}
+		})
+	}
+}
+
+func TestBuildConfigURLTestCacheFile(t *testing.T) {
+	storage, profile := testOverlapStorage(t)
+	if err := NewConfigBuilderForStorage(storage).BuildConfigForProfile(profile.ID, testDirectLink, nil); err != nil {
+		t.Fatalf("BuildConfigForProfile: %v", err)
+	}
+
+	stored := mustStoredProfile(t, storage, profile.ID)
+	experimental, _ := stored.SingboxConfig["experimental"].(map[string]interface{})
+	cacheFile, _ := experimental["cache_file"].(map[string]interface{})
+	if cacheFile["enabled"] != true || cacheFile["path"] != URLTestCacheFile {
+		t.Fatalf("cache_file = %v, want enabled with the relative %s", cacheFile, URLTestCacheFile)
+	}
+
+	// sing-box runs in resources, so the relative path stays inside it
+	runtime := map[string]interface{}{"experimental": map[string]interface{}{"cache_file": map[string]interface{}{"path": cacheFile["path"]}}}
+	storage.ResolveConfigPaths(runtime)
+	path := runtime["experimental"].(map[string]interface{})["cache_file"].(map[string]interface{})["path"].(string)
+	if got := filepath.Join(storage.GetResourcesPath(), path); got != storage.URLTestCachePath() {
+		t.Errorf("cache file at %s, want %s", got, storage.URLTestCachePath())
+	}
+	if filepath.Dir(storage.URLTestCachePath()) != storage.GetResourcesPath() {
+		t.Errorf("URLTestCachePath = %s, outside resources", storage.URLTestCachePath())
+	}
+
+	// An absolute path of another installation is moved to these resources
+	other := filepath.Join(t.TempDir(), "old-install", ResourcesFolder, URLTestCacheFile)
+	legacy := map[string]interface{}{"experimental": map[string]interface{}{"cache_file": map[string]interface{}{"path": other}}}
+	storage.ResolveConfigPaths(legacy)
+	if got := legacy["experimental"].(map[string]interface{})["cache_file"].(map[string]interface{})["path"]; got != storage.URLTestCachePath() {
+		t.Errorf("legacy cache path = %v, want %s", got, storage.URLTestCachePath())
+	}
+}
+
+func TestWireGuardDNSRuleFollowsInternalDomainsMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		domains  []string
+		suffixes []string // nil: no rule for the tunnel
+	}{
+		{"auto", "", nil, []string{".corp.example", ".vpn.corp.example", ".local", ".office.local"}},
+		{"auto with a list", InternalDomainsAuto, []string{"wiki.office"}, []string{".wiki.office", ".local", ".office.local"}},
+		{"manual", InternalDomainsManual, []string{"wiki.office"}, []string{".wiki.office"}},
+		{"manual without a list", InternalDomainsManual, nil, nil},
+		{"none", InternalDomainsNone, []string{"wiki.office"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wg := UserWireGuardConfig{
+				Tag: "office", DNS: "10.8.0.1", Endpoint: "vpn.corp.example",
+				InternalDomains: tt.domains, InternalDomainsMode: tt.mode,
+			}
+			template := testGeneratorTemplate()
+			newConfigGenerator(nil).addWireGuardDNS(template, []UserWireGuardConfig{wg})
+
+			dns := template["dns"].(map[string]interface{})
+			servers, _ := dns["servers"].([]interface{})
+			if len(servers) != 1 || servers[0].(map[string]interface{})["tag"] != "dns-office" {
+				t.Errorf("servers = %v, want the tunnel DNS in every mode", servers)
+			}
+
+			rules, _ := dns["rules"].([]interface{})
+			var suffixes []string
+			for _, r := range rules {
+				if rule := r.(map[string]interface{}); rule["server"] == "dns-office" {
+					suffixes, _ = rule["domain_suffix"].([]string)
+					if suffixes == nil {
+						t.Fatalf("rule without domain_suffix: %v", rule)
+					}
+				}
+			}
+			if !reflect.DeepEqual(suffixes, tt.suffixes) {
+				t.Errorf("tunnel DNS rule suffixes = %v, want %v", suffixes, tt.suffixes)
+			}
+			wantRules := 2 // The template rules stay
+			if tt.suffixes != nil {
+				wantRules++
+			}
+			if len(rules) != wantRules {
+				t.Errorf("rules = %v, want %d", rules, wantRules)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+// Package main provides migrations of stored sing-box configs for KampusVPN.
+// Configs stamped with an older schema revision are upgraded by a chain of pure
+// transformations before use, so configs built by old app versions keep working
+// after sing-box drops legacy fields.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ConfigMigration upgrades a stored config to Revision.
+// Apply receives its own copy of the config and the WireGuard configs of the
+// profile, and returns the result with a list of changes.
+type ConfigMigration struct {
+	Revision    int
+	Description string
+	Apply       func(config map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) (map[string]interface{}, []string)
+}
+
+// configMigrations is the ordered migration chain. Revision of the last entry
+// must equal ConfigSchemaRevision.
+var configMigrations = []ConfigMigration{
+	{
+		Revision:    2,
+		Description: "legacy dns.servers address strings to typed servers",
+		Apply:       migrateLegacyDNSServers,
+	},
+	{
+		Revision:    3,
+		Description: "block/dns-out outbounds to rule actions",
+		Apply:       migrateSpecialOutboundsToActions,
+	},
+	{
+		Revision:    4,
+		Description: "WireGuard DNS bypass before hijack-dns, tunnel networks after it",
+		Apply:       migrateWireGuardRouteRules,
+	},
+}
+
+// ConfigMigrationStep describes one applied migration.
+type ConfigMigrationStep struct {
+	Revision    int      `json:"revision"`
+	Description string   `json:"description"`
+	Changes     []string `json:"changes"`
+}
+
+// ConfigMigrationReport is the result of running the migration chain.
+type ConfigMigrationReport struct {
+	FromRevision int                   `json:"from_revision"`
+	ToRevision   int                   `json:"to_revision"`
+	Steps        []ConfigMigrationStep `json:"steps"`
+}
+
+// Changed reports whether any migration modified the config.
+func (r *ConfigMigrationReport) Changed() bool {
+	for _, step := range r.Steps {
+		if len(step.Changes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// configRevision returns the schema revision of a stamp (0 for unstamped configs).
+func configRevision(info *ConfigBuildInfo) int {
+	if info == nil {
+		return 0
+	}
+	return info.SchemaRevision
+}
+
+// NeedsConfigMigration reports whether a config with this stamp is older than the builder.
+func NeedsConfigMigration(info *ConfigBuildInfo) bool {
+	return configRevision(info) < ConfigSchemaRevision
+}
+
+// MigrateConfig runs all migrations newer than fromRevision for a profile with
+// the given WireGuard configs. The input config is not modified.
+func MigrateConfig(config map[string]interface{}, fromRevision int, wireGuardConfigs []UserWireGuardConfig) (map[string]interface{}, *ConfigMigrationReport) {
+	report := &ConfigMigrationReport{
+		FromRevision: fromRevision,
+		ToRevision:   fromRevision,
+		Steps:        []ConfigMigrationStep{},
+	}
+
+	result := config
+	for _, migration := range configMigrations {
+		if migration.Revision <= fromRevision {
+			continue
+		}
+		var changes []string
+		result, changes = migration.Apply(deepCopyJSONMap(result), wireGuardConfigs)
+		if changes == nil {
+			changes = []string{}
+		}
+		report.Steps = append(report.Steps, ConfigMigrationStep{
+			Revision:    migration.Revision,
+			Description: migration.Description,
+			Changes:     changes,
+		})
+		report.ToRevision = migration.Revision
+	}
+
+	return result, report
+}
+
+// migrateLegacyDNSServers converts dns servers like {"tag": "x", "address": "tls://1.1.1.1"}
+// to the typed format {"type": "tls", "server": "1.1.1.1"} and rewrites rules that
+// referenced removed rcode:// servers to reject actions.
+func migrateLegacyDNSServers(config map[string]interface{}, _ []UserWireGuardConfig) (map[string]interface{}, []string) {
+	var changes []string
+
+	dns, ok := config["dns"].(map[string]interface{})
+	if !ok {
+		return config, changes
+	}
+	servers, ok := dns["servers"].([]interface{})
+	if !ok {
+		return config, changes
+	}
+
+	rcodeServers := make(map[string]bool)
+	migrated := make([]interface{}, 0, len(servers))
+	for _, srv := range servers {
+		srvMap, ok := srv.(map[string]interface{})
+		if !ok {
+			migrated = append(migrated, srv)
+			continue
+		}
+		address, ok := srvMap["address"].(string)
+		if !ok {
+			migrated = append(migrated, srv)
+			continue
+		}
+
+		tag, _ := srvMap["tag"].(string)
+		if strings.HasPrefix(address, "rcode://") {
+			rcodeServers[tag] = true
+			changes = append(changes, fmt.Sprintf("dns server %q (%s) removed, rules use reject action", tag, address))
+			continue
+		}
+
+		typed, err := typedDNSServer(address)
+		if err != nil {
+			migrated = append(migrated, srv)
+			changes = append(changes, fmt.Sprintf("dns server %q left as is: %v", tag, err))
+			continue
+		}
+		for _, key := range []string{"tag", "detour"} {
+			if value, ok := srvMap[key]; ok {
+				typed[key] = value
+			}
+		}
+		if resolver, ok := srvMap["address_resolver"].(string); ok && resolver != "" {
+			if strategy, ok := srvMap["address_strategy"].(string); ok && strategy != "" {
+				typed["domain_resolver"] = map[string]interface{}{
+					"server":   resolver,
+					"strategy": strategy,
+				}
+			} else {
+				typed["domain_resolver"] = resolver
+			}
+		}
+
+		migrated = append(migrated, typed)
+		changes = append(changes, fmt.Sprintf("dns server %q: address %q -> type %q", tag, address, typed["type"]))
+	}
+	dns["servers"] = migrated
+
+	if len(rcodeServers) > 0 {
+		if rules, ok := dns["rules"].([]interface{}); ok {
+			for _, rule := range rules {
+				ruleMap, ok := rule.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if server, _ := ruleMap["server"].(string); rcodeServers[server] {
+					delete(ruleMap, "server")
+					ruleMap["action"] = "reject"
+				}
+			}
+		}
+		if final, _ := dns["final"].(string); rcodeServers[final] {
+			delete(dns, "final")
+			changes = append(changes, fmt.Sprintf("dns final %q removed", final))
+		}
+	}
+
+	return config, changes
+}
+
+// typedDNSServer converts a legacy address string to a typed dns server.
+func typedDNSServer(address string) (map[string]interface{}, error) {
+	switch {
+	case address == "local":
+		return map[string]interface{}{"type": "local"}, nil
+	case address == "fakeip":
+		return map[string]interface{}{"type": "fakeip"}, nil
+	case strings.HasPrefix(address, "dhcp://"):
+		server := map[string]interface{}{"type": "dhcp"}
+		if iface := strings.TrimPrefix(address, "dhcp://"); iface != "" && iface != "auto" {
+			server["interface"] = iface
+		}
+		return server, nil
+	}
+
+	// Plain IP means UDP
+	if !strings.Contains(address, "://") {
+		address = "udp://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+
+	serverType := u.Scheme
+	switch serverType {
+	case "udp", "tcp", "tls", "https", "quic", "h3":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", serverType)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("empty server in %q", address)
+	}
+	server := map[string]interface{}{
+		"type":   serverType,
+		"server": host,
+	}
+	if port := u.Port(); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			server["server_port"] = p
+		}
+	}
+	if (serverType == "https" || serverType == "h3") && u.Path != "" && u.Path != "/dns-query" {
+		server["path"] = u.Path
+	}
+	return server, nil
+}
+
+// migrateSpecialOutboundsToActions replaces rules routed to block/dns outbounds
+// with reject/hijack-dns actions and removes those outbounds.
+func migrateSpecialOutboundsToActions(config map[string]interface{}, _ []UserWireGuardConfig) (map[string]interface{}, []string) {
+	var changes []string
+
+	// Find special outbounds by type
+	special := make(map[string]string) // tag -> action
+	if outbounds, ok := config["outbounds"].([]interface{}); ok {
+		filtered := make([]interface{}, 0, len(outbounds))
+		for _, ob := range outbounds {
+			obMap, ok := ob.(map[string]interface{})
+			if !ok {
+				filtered = append(filtered, ob)
+				continue
+			}
+			obType, _ := obMap["type"].(string)
+			tag, _ := obMap["tag"].(string)
+			switch obType {
+			case "block":
+				special[tag] = "reject"
+			case "dns":
+				special[tag] = "hijack-dns"
+			default:
+				filtered = append(filtered, ob)
+				continue
+			}
+			changes = append(changes, fmt.Sprintf("outbound %q (%s) removed", tag, obType))
+		}
+		config["outbounds"] = filtered
+
+		// Drop references from groups
+		for _, ob := range filtered {
+			obMap, ok := ob.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			members, ok := obMap["outbounds"].([]interface{})
+			if !ok {
+				continue
+			}
+			kept := make([]interface{}, 0, len(members))
+			for _, member := range members {
+				if name, _ := member.(string); special[name] == "" {
+					kept = append(kept, member)
+				}
+			}
+			if len(kept) != len(members) {
+				obMap["outbounds"] = kept
+				tag, _ := obMap["tag"].(string)
+				changes = append(changes, fmt.Sprintf("group %q: removed block/dns members", tag))
+			}
+		}
+	}
+
+	route, ok := config["route"].(map[string]interface{})
+	if !ok {
+		return config, changes
+	}
+
+	if rules, ok := route["rules"].([]interface{}); ok {
+		for i, rule := range rules {
+			ruleMap, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			outbound, _ := ruleMap["outbound"].(string)
+			action := special[outbound]
+			if action == "" {
+				continue
+			}
+			delete(ruleMap, "outbound")
+			ruleMap["action"] = action
+			changes = append(changes, fmt.Sprintf("route rule %d: outbound %q -> action %q", i, outbound, action))
+		}
+	}
+
+	if final, _ := route["final"].(string); special[final] != "" {
+		delete(route, "final")
+		changes = append(changes, fmt.Sprintf("route final %q removed", final))
+	}
+
+	return config, changes
+}
+
+// migrateWireGuardRouteRules puts the WireGuard route rules of a stored config
+// in the order the builder uses (placeWireGuardRouteRules). Configs of older
+// builds had the tunnel networks before hijack-dns, routed to the tunnel tag,
+// or lost them to the routing mode.
+func migrateWireGuardRouteRules(config map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) (map[string]interface{}, []string) {
+	route, ok := config["route"].(map[string]interface{})
+	if !ok {
+		return config, nil
+	}
+	rules, _ := route["rules"].([]interface{})
+	placed := placeWireGuardRouteRules(rules, wireGuardConfigs)
+	// Built and decoded rules differ in types, not in JSON
+	before, _ := json.Marshal(rules)
+	after, _ := json.Marshal(placed)
+	if string(before) == string(after) {
+		return config, nil
+	}
+	route["rules"] = placed
+
+	dnsBypass, cidrRule := wireGuardRouteRules(wireGuardConfigs)
+	var changes []string
+	if dnsBypass != nil {
+		changes = append(changes, fmt.Sprintf("route rules: DNS bypass for %v before hijack-dns", ruleCIDRs(dnsBypass)))
+	}
+	if cidrRule != nil {
+		changes = append(changes, fmt.Sprintf("route rules: WireGuard networks %v after hijack-dns", ruleCIDRs(cidrRule)))
+	}
+	return config, changes
+}
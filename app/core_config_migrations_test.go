@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseTestConfig decodes a JSON fixture config
+func parseTestConfig(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("fixture: %v", err)
+	}
+	return config
+}
+
+// assertConfigJSON compares a config with a JSON fixture
+func assertConfigJSON(t *testing.T, got map[string]interface{}, want string) {
+	t.Helper()
+	// Round trip: migrations build []interface{} and map values of Go types
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parseTestConfig(t, string(data)), parseTestConfig(t, want)) {
+		t.Errorf("config = %s\nwant %s", data, want)
+	}
+}
+
+// legacyConfig is a config of schema revision 1: address dns servers and block/dns outbounds
+const legacyConfig = `{
+	"dns": {
+		"servers": [
+			{"tag": "remote", "address": "tls://1.1.1.1", "detour": "proxy"},
+			{"tag": "block", "address": "rcode://success"}
+		],
+		"rules": [{"rule_set": ["ads"], "server": "block"}],
+		"final": "remote"
+	},
+	"outbounds": [
+		{"type": "trojan", "tag": "de"},
+		{"type": "block", "tag": "block"},
+		{"type": "dns", "tag": "dns-out"},
+		{"type": "selector", "tag": "proxy", "outbounds": ["de", "block"]}
+	],
+	"route": {
+		"rules": [
+			{"protocol": "dns", "outbound": "dns-out"},
+			{"rule_set": ["ads"], "outbound": "block"}
+		],
+		"final": "proxy"
+	}
+}`
+
+func TestMigrateLegacyDNSServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		changes int
+	}{
+		{
+			name: "address schemes",
+			config: `{"dns": {"servers": [
+				{"tag": "tls", "address": "tls://1.1.1.1", "detour": "proxy"},
+				{"tag": "plain", "address": "8.8.8.8"},
+				{"tag": "doh", "address": "https://dns.google/dns-query"},
+				{"tag": "doh-path", "address": "https://dns.example.com:8443/custom"},
+				{"tag": "local", "address": "local"},
+				{"tag": "dhcp", "address": "dhcp://auto"},
+				{"tag": "dhcp-if", "address": "dhcp://Ethernet"}
+			]}}`,
+			want: `{"dns": {"servers": [
+				{"tag": "tls", "type": "tls", "server": "1.1.1.1", "detour": "proxy"},
+				{"tag": "plain", "type": "udp", "server": "8.8.8.8"},
+				{"tag": "doh", "type": "https", "server": "dns.google"},
+				{"tag": "doh-path", "type": "https", "server": "dns.example.com", "server_port": 8443, "path": "/custom"},
+				{"tag": "local", "type": "local"},
+				{"tag": "dhcp", "type": "dhcp"},
+				{"tag": "dhcp-if", "type": "dhcp", "interface": "Ethernet"}
+			]}}`,
+			changes: 7,
+		},
+		{
+			name: "address resolver",
+			config: `{"dns": {"servers": [
+				{"tag": "doh", "address": "https://dns.google/dns-query", "address_resolver": "local"},
+				{"tag": "doh4", "address": "https://dns.google/dns-query", "address_resolver": "local", "address_strategy": "ipv4_only"}
+			]}}`,
+			want: `{"dns": {"servers": [
+				{"tag": "doh", "type": "https", "server": "dns.google", "domain_resolver": "local"},
+				{"tag": "doh4", "type": "https", "server": "dns.google", "domain_resolver": {"server": "local", "strategy": "ipv4_only"}}
+			]}}`,
+			changes: 2,
+		},
+		{
+			name: "rcode server",
+			config: `{"dns": {
+				"servers": [{"tag": "remote", "address": "1.1.1.1"}, {"tag": "block", "address": "rcode://success"}],
+				"rules": [{"rule_set": ["ads"], "server": "block"}, {"domain": ["a.example"], "server": "remote"}],
+				"final": "block"
+			}}`,
+			want: `{"dns": {
+				"servers": [{"tag": "remote", "type": "udp", "server": "1.1.1.1"}],
+				"rules": [{"rule_set": ["ads"], "action": "reject"}, {"domain": ["a.example"], "server": "remote"}]
+			}}`,
+			changes: 3,
+		},
+		{
+			name:    "unsupported scheme",
+			config:  `{"dns": {"servers": [{"tag": "odd", "address": "sdns://AgcAAAAAAAAA"}]}}`,
+			want:    `{"dns": {"servers": [{"tag": "odd", "address": "sdns://AgcAAAAAAAAA"}]}}`,
+			changes: 1,
+		},
+		{
+			name:   "typed servers",
+			config: `{"dns": {"servers": [{"tag": "remote", "type": "tls", "server": "1.1.1.1"}]}}`,
+			want:   `{"dns": {"servers": [{"tag": "remote", "type": "tls", "server": "1.1.1.1"}]}}`,
+		},
+		{
+			name:   "no dns",
+			config: `{"route": {"final": "proxy"}}`,
+			want:   `{"route": {"final": "proxy"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := migrateLegacyDNSServers(parseTestConfig(t, tt.config), nil)
+			assertConfigJSON(t, got, tt.want)
+			if len(changes) != tt.changes {
+				t.Errorf("changes = %q, want %d", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestMigrateSpecialOutboundsToActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		changes int
+	}{
+		{
+			name: "block and dns outbounds",
+			config: `{
+				"outbounds": [
+					{"type": "trojan", "tag": "de"},
+					{"type": "block", "tag": "block"},
+					{"type": "dns", "tag": "dns-out"},
+					{"type": "selector", "tag": "proxy", "outbounds": ["de", "block"]}
+				],
+				"route": {
+					"rules": [
+						{"protocol": "dns", "outbound": "dns-out"},
+						{"rule_set": ["ads"], "outbound": "block"},
+						{"ip_is_private": true, "outbound": "direct"}
+					],
+					"final": "block"
+				}
+			}`,
+			want: `{
+				"outbounds": [
+					{"type": "trojan", "tag": "de"},
+					{"type": "selector", "tag": "proxy", "outbounds": ["de"]}
+				],
+				"route": {
+					"rules": [
+						{"protocol": "dns", "action": "hijack-dns"},
+						{"rule_set": ["ads"], "action": "reject"},
+						{"ip_is_private": true, "outbound": "direct"}
+					]
+				}
+			}`,
+			// 2 outbounds, 1 group, 2 rules, final
+			changes: 6,
+		},
+		{
+			name:   "action rules",
+			config: `{"outbounds": [{"type": "direct", "tag": "direct"}], "route": {"rules": [{"protocol": "dns", "action": "hijack-dns"}], "final": "direct"}}`,
+			want:   `{"outbounds": [{"type": "direct", "tag": "direct"}], "route": {"rules": [{"protocol": "dns", "action": "hijack-dns"}], "final": "direct"}}`,
+		},
+		{
+			name:   "no route",
+			config: `{"outbounds": [{"type": "trojan", "tag": "de"}]}`,
+			want:   `{"outbounds": [{"type": "trojan", "tag": "de"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := migrateSpecialOutboundsToActions(parseTestConfig(t, tt.config), nil)
+			assertConfigJSON(t, got, tt.want)
+			if len(changes) != tt.changes {
+				t.Errorf("changes = %q, want %d", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      int
+		revisions []int
+	}{
+		{"unstamped", 0, []int{2, 3, 4}},
+		{"revision 1", 1, []int{2, 3, 4}},
+		{"revision 3", 3, []int{4}},
+		{"current", ConfigSchemaRevision, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := parseTestConfig(t, legacyConfig)
+			_, report := MigrateConfig(input, tt.from, nil)
+
+			var revisions []int
+			for _, step := range report.Steps {
+				revisions = append(revisions, step.Revision)
+			}
+			if !reflect.DeepEqual(revisions, tt.revisions) {
+				t.Errorf("steps = %v, want %v", revisions, tt.revisions)
+			}
+			wantTo := tt.from
+			if len(tt.revisions) > 0 {
+				wantTo = tt.revisions[len(tt.revisions)-1]
+			}
+			if report.FromRevision != tt.from || report.ToRevision != wantTo {
+				t.Errorf("report %d -> %d, want %d -> %d", report.FromRevision, report.ToRevision, tt.from, wantTo)
+			}
+			assertConfigJSON(t, input, legacyConfig)
+		})
+	}
+
+	// The last migration lands on the builder schema
+	if last := configMigrations[len(configMigrations)-1].Revision; last != ConfigSchemaRevision {
+		t.Errorf("last migration revision = %d, want ConfigSchemaRevision %d", last, ConfigSchemaRevision)
+	}
+}
+
+// testLegacyProfile returns a storage with a profile holding legacyConfig of revision 1
+func testLegacyProfile(t *testing.T, base string) (*Storage, *ProfileData) {
+	t.Helper()
+	storage := NewStorage(base)
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.PatchProfileConfig(profile.ID, parseTestConfig(t, legacyConfig)); err != nil {
+		t.Fatal(err)
+	}
+	setTestBuildInfo(t, storage, profile.ID, &ConfigBuildInfo{AppVersion: "0.9.0", SchemaRevision: 1, RoutingMode: RoutingModeExceptRussia})
+	return storage, profile
+}
+
+func TestMigrateProfileConfig(t *testing.T) {
+	base := t.TempDir()
+	storage, profile := testLegacyProfile(t, base)
+
+	report, err := storage.MigrateProfileConfig(profile.ID)
+	if err != nil {
+		t.Fatalf("MigrateProfileConfig: %v", err)
+	}
+	if report == nil || report.FromRevision != 1 || report.ToRevision != ConfigSchemaRevision || !report.Changed() {
+		t.Fatalf("report = %+v", report)
+	}
+
+	migrated := mustStoredProfile(t, storage, profile.ID)
+	if migrated.BuildInfo.SchemaRevision != ConfigSchemaRevision || migrated.BuildInfo.AppVersion != Version {
+		t.Errorf("BuildInfo = %+v, want this builder's stamp", migrated.BuildInfo)
+	}
+	// The routing mode of the stamp is the one the config was built with
+	if migrated.BuildInfo.RoutingMode != RoutingModeExceptRussia {
+		t.Errorf("BuildInfo.RoutingMode = %q, want except_russia", migrated.BuildInfo.RoutingMode)
+	}
+	if tags := jsonOutboundTags(migrated.SingboxConfig); containsString(tags, "block") || containsString(tags, "dns-out") {
+		t.Errorf("outbounds = %v, block/dns outbounds left", tags)
+	}
+
+	// Saved: a reloaded storage has the migrated config
+	reloaded := NewStorage(base)
+	if err := reloaded.Init(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := mustStoredProfile(t, reloaded, profile.ID); got.BuildInfo.SchemaRevision != ConfigSchemaRevision {
+		t.Errorf("reloaded revision = %d, want %d", got.BuildInfo.SchemaRevision, ConfigSchemaRevision)
+	}
+
+	// Re-stamped configs are not migrated again
+	if report, err := storage.MigrateProfileConfig(profile.ID); report != nil || err != nil {
+		t.Errorf("second MigrateProfileConfig = %+v, %v, want nil", report, err)
+	}
+}
+
+func TestPreviewConfigMigration(t *testing.T) {
+	storage, profile := testLegacyProfile(t, t.TempDir())
+	a := &App{storage: storage, logStore: NewLogStore(), initialized: true}
+
+	result := a.PreviewConfigMigration(profile.ID)
+	if result["success"] != true || result["needs_migration"] != true || result["changed"] != true {
+		t.Fatalf("result = %v", result)
+	}
+	if result["from_revision"] != 1 || result["to_revision"] != ConfigSchemaRevision {
+		t.Errorf("revisions = %v -> %v", result["from_revision"], result["to_revision"])
+	}
+	if steps, _ := result["steps"].([]ConfigMigrationStep); len(steps) != 3 {
+		t.Errorf("steps = %v, want 3", result["steps"])
+	}
+	preview, _ := result["config"].(string)
+	if !strings.Contains(preview, `"type": "tls"`) || strings.Contains(preview, "rcode://") {
+		t.Errorf("config preview not migrated:\n%s", preview)
+	}
+
+	// Preview doesn't save
+	stored := mustStoredProfile(t, storage, profile.ID)
+	if stored.BuildInfo.SchemaRevision != 1 || !containsString(jsonOutboundTags(stored.SingboxConfig), "block") {
+		t.Error("preview changed the stored config")
+	}
+
+	// Nothing to preview after the migration
+	if _, err := storage.MigrateProfileConfig(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+	result = a.PreviewConfigMigration(profile.ID)
+	if result["success"] != true || result["needs_migration"] != false {
+		t.Errorf("migrated profile: %v", result)
+	}
+
+	if result := a.PreviewConfigMigration(9999); result["success"] != false {
+		t.Errorf("unknown profile: %v", result)
+	}
+}
+
+// migrationWireGuard is the WireGuard config of the route rule fixtures
+var migrationWireGuard = []UserWireGuardConfig{{Tag: "wg-office", DNS: "10.8.0.1", AllowedIPs: []string{"10.8.0.0/24"}}}
+
+// orderedWireGuardRules are route rules in the builder order
+const orderedWireGuardRules = `{"route": {"rules": [
+	{"action": "sniff"},
+	{"ip_cidr": ["10.8.0.1"], "port": 53, "action": "route", "outbound": "direct"},
+	{"protocol": "dns", "action": "hijack-dns"},
+	{"ip_cidr": ["10.8.0.0/24"], "action": "route", "outbound": "direct"},
+	{"ip_is_private": true, "action": "route", "outbound": "direct"}
+]}}`
+
+func TestMigrateWireGuardRouteRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wireGuard []UserWireGuardConfig
+		want      string
+		changes   int
+	}{
+		{
+			name: "networks before hijack-dns",
+			config: `{"route": {"rules": [
+				{"action": "sniff"},
+				{"ip_cidr": ["10.8.0.0/24"], "action": "route", "outbound": "direct"},
+				{"protocol": "dns", "action": "hijack-dns"},
+				{"ip_is_private": true, "action": "route", "outbound": "direct"}
+			]}}`,
+			wireGuard: migrationWireGuard,
+			want:      orderedWireGuardRules,
+			changes:   2,
+		},
+		{
+			name: "routed to the tunnel tag",
+			config: `{"route": {"rules": [
+				{"action": "sniff"},
+				{"protocol": "dns", "action": "hijack-dns"},
+				{"ip_cidr": ["10.8.0.0/24"], "action": "route", "outbound": "wg-office"},
+				{"ip_is_private": true, "action": "route", "outbound": "direct"}
+			]}}`,
+			wireGuard: migrationWireGuard,
+			want:      orderedWireGuardRules,
+			changes:   2,
+		},
+		{
+			name: "lost to the routing mode",
+			config: `{"route": {"rules": [
+				{"action": "sniff"},
+				{"protocol": "dns", "action": "hijack-dns"},
+				{"ip_is_private": true, "action": "route", "outbound": "direct"}
+			]}}`,
+			wireGuard: migrationWireGuard,
+			want:      orderedWireGuardRules,
+			changes:   2,
+		},
+		{
+			name:      "builder order",
+			config:    orderedWireGuardRules,
+			wireGuard: migrationWireGuard,
+			want:      orderedWireGuardRules,
+		},
+		{
+			name:   "no WireGuard",
+			config: `{"route": {"rules": [{"action": "sniff"}, {"protocol": "dns", "action": "hijack-dns"}]}}`,
+			want:   `{"route": {"rules": [{"action": "sniff"}, {"protocol": "dns", "action": "hijack-dns"}]}}`,
+		},
+		{
+			name:      "no route",
+			config:    `{"outbounds": []}`,
+			wireGuard: migrationWireGuard,
+			want:      `{"outbounds": []}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := migrateWireGuardRouteRules(parseTestConfig(t, tt.config), tt.wireGuard)
+			assertConfigJSON(t, got, tt.want)
+			if len(changes) != tt.changes {
+				t.Errorf("changes = %q, want %d", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestMigrateProfileConfigWireGuardOrder(t *testing.T) {
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UpdateProfileWireGuard(profile.ID, migrationWireGuard); err != nil {
+		t.Fatal(err)
+	}
+	// Stored by a revision 3 builder: tunnel networks before hijack-dns
+	legacy := `{"route": {"rules": [
+		{"action": "sniff"},
+		{"ip_cidr": ["10.8.0.0/24"], "action": "route", "outbound": "direct"},
+		{"protocol": "dns", "action": "hijack-dns"},
+		{"ip_is_private": true, "action": "route", "outbound": "direct"}
+	]}}`
+	if err := storage.PatchProfileConfig(profile.ID, parseTestConfig(t, legacy)); err != nil {
+		t.Fatal(err)
+	}
+	setTestBuildInfo(t, storage, profile.ID, &ConfigBuildInfo{AppVersion: "1.0.0", SchemaRevision: 3})
+
+	report, err := storage.MigrateProfileConfig(profile.ID)
+	if err != nil {
+		t.Fatalf("MigrateProfileConfig: %v", err)
+	}
+	if report == nil || len(report.Steps) != 1 || report.Steps[0].Revision != 4 || !report.Changed() {
+		t.Fatalf("report = %+v", report)
+	}
+	assertConfigJSON(t, mustStoredProfile(t, storage, profile.ID).SingboxConfig, orderedWireGuardRules)
+}
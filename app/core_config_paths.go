@@ -0,0 +1,114 @@
+// Package main provides relocatable file paths in stored sing-box configs for KampusVPN.
+// Stored configs refer to the filters and resources folders through
+// placeholders, resolved to this installation's folders only when the runtime
+// config is written. A portable folder moved to another drive and profiles
+// exported on another machine keep working without a rebuild; absolute paths
+// of configs stored by older versions are mapped to the current folders too.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Placeholders of installation folders in stored configs
+const (
+	// FiltersPathPlaceholder stands for bin/filters (local rule_set files).
+	FiltersPathPlaceholder = "${filters}"
+	// ResourcesPathPlaceholder stands for the resources folder (cache file, logs).
+	ResourcesPathPlaceholder = "${resources}"
+)
+
+// configFolders are the installation folders placeholders resolve to
+type configFolders struct {
+	filters   string
+	resources string
+}
+
+// configFolders returns the folders of this installation
+func (s *Storage) configFolders() configFolders {
+	return configFolders{
+		filters:   filepath.Join(filepath.Dir(s.resourcesPath), "bin", FiltersFolder),
+		resources: s.resourcesPath,
+	}
+}
+
+// ResolveConfigPaths resolves the file paths of a copy of a stored config to
+// this installation's folders.
+func (s *Storage) ResolveConfigPaths(config map[string]interface{}) {
+	mapConfigPaths(config, s.configFolders().resolve)
+}
+
+// relocatable replaces the folder of a path inside an installation folder with its placeholder
+func (f configFolders) relocatable(path string) string {
+	for _, folder := range []struct{ dir, placeholder string }{
+		{f.filters, FiltersPathPlaceholder},
+		{f.resources, ResourcesPathPlaceholder},
+	} {
+		rel, err := filepath.Rel(folder.dir, path)
+		if err != nil || !filepath.IsAbs(path) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return folder.placeholder + "/" + filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// resolve turns a stored path into a path of this installation. Absolute
+// paths of another installation that don't exist here are mapped by the
+// folder they were in (filters) or by the cache file name.
+func (f configFolders) resolve(path string) string {
+	for _, folder := range []struct{ dir, placeholder string }{
+		{f.filters, FiltersPathPlaceholder},
+		{f.resources, ResourcesPathPlaceholder},
+	} {
+		if rest, ok := strings.CutPrefix(path, folder.placeholder); ok {
+			return filepath.Join(folder.dir, filepath.FromSlash(strings.TrimPrefix(rest, "/")))
+		}
+	}
+
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	name := filepath.Base(path)
+	switch {
+	case filepath.Base(filepath.Dir(path)) == FiltersFolder:
+		return filepath.Join(f.filters, name)
+	case name == URLTestCacheFile:
+		return filepath.Join(f.resources, name)
+	}
+	return path
+}
+
+// mapConfigPaths replaces the file paths of a config: local rule_set files,
+// the cache file and the log file
+func mapConfigPaths(config map[string]interface{}, fn func(string) string) {
+	if route, ok := config["route"].(map[string]interface{}); ok {
+		ruleSets, _ := route["rule_set"].([]interface{})
+		for _, item := range ruleSets {
+			rs, ok := item.(map[string]interface{})
+			if !ok || rs["type"] != "local" {
+				continue
+			}
+			if path, ok := rs["path"].(string); ok && path != "" {
+				rs["path"] = fn(path)
+			}
+		}
+	}
+	if experimental, ok := config["experimental"].(map[string]interface{}); ok {
+		if cacheFile, ok := experimental["cache_file"].(map[string]interface{}); ok {
+			if path, ok := cacheFile["path"].(string); ok && path != "" {
+				cacheFile["path"] = fn(path)
+			}
+		}
+	}
+	if logSection, ok := config["log"].(map[string]interface{}); ok {
+		if path, ok := logSection["output"].(string); ok && path != "" {
+			logSection["output"] = fn(path)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFoldersRelocatable(t *testing.T) {
+	base := t.TempDir()
+	f := NewStorage(base).configFolders()
+	filters := filepath.Join(base, "bin", FiltersFolder)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(filters, "refilter_domains.srs"), FiltersPathPlaceholder + "/refilter_domains.srs"},
+		{filepath.Join(filters, "custom", "office.srs"), FiltersPathPlaceholder + "/custom/office.srs"},
+		{filepath.Join(base, ResourcesFolder, URLTestCacheFile), ResourcesPathPlaceholder + "/" + URLTestCacheFile},
+		{filepath.Join(base, ResourcesFolder, "logs", "box.log"), ResourcesPathPlaceholder + "/logs/box.log"},
+		// A sibling folder whose name starts like the filters folder is not inside it
+		{filepath.Join(base, "bin", FiltersFolder+"-old", "refilter_domains.srs"), filepath.Join(base, "bin", FiltersFolder+"-old", "refilter_domains.srs")},
+		{filepath.Join(base, "bin", "sing-box.exe"), filepath.Join(base, "bin", "sing-box.exe")},
+		{URLTestCacheFile, URLTestCacheFile},
+		{FiltersPathPlaceholder + "/refilter_ips.srs", FiltersPathPlaceholder + "/refilter_ips.srs"},
+	}
+
+	for _, tt := range tests {
+		if got := f.relocatable(tt.path); got != tt.want {
+			t.Errorf("relocatable(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestConfigFoldersResolve(t *testing.T) {
+	base := t.TempDir()
+	f := NewStorage(base).configFolders()
+	filters := filepath.Join(base, "bin", FiltersFolder)
+	resources := filepath.Join(base, ResourcesFolder)
+
+	// Files of another installation that doesn't exist on this machine
+	other := filepath.Join(t.TempDir(), "KampusVPN")
+	// A file outside any installation that exists
+	existing := filepath.Join(t.TempDir(), "office.srs")
+	if err := os.WriteFile(existing, []byte("srs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"filters placeholder", FiltersPathPlaceholder + "/refilter_domains.srs", filepath.Join(filters, "refilter_domains.srs")},
+		{"nested placeholder", FiltersPathPlaceholder + "/custom/office.srs", filepath.Join(filters, "custom", "office.srs")},
+		{"resources placeholder", ResourcesPathPlaceholder + "/" + URLTestCacheFile, filepath.Join(resources, URLTestCacheFile)},
+		{"relative", URLTestCacheFile, URLTestCacheFile},
+		{"existing absolute file", existing, existing},
+		{"filters of another installation", filepath.Join(other, "bin", FiltersFolder, "refilter_ips.srs"), filepath.Join(filters, "refilter_ips.srs")},
+		{"cache of another installation", filepath.Join(other, ResourcesFolder, URLTestCacheFile), filepath.Join(resources, URLTestCacheFile)},
+		{"unknown file of another installation", filepath.Join(other, ResourcesFolder, "box.log"), filepath.Join(other, ResourcesFolder, "box.log")},
+	}
+
+	for _, tt := range tests {
+		if got := f.resolve(tt.path); got != tt.want {
+			t.Errorf("%s: resolve(%s) = %s, want %s", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
+
+// localRuleSetPaths returns the paths of local rule_set entries of config
+func localRuleSetPaths(t *testing.T, config map[string]interface{}) []string {
+	t.Helper()
+	route, _ := config["route"].(map[string]interface{})
+	ruleSets, _ := route["rule_set"].([]interface{})
+	var paths []string
+	for _, item := range ruleSets {
+		if rs, ok := item.(map[string]interface{}); ok && rs["type"] == "local" {
+			path, _ := rs["path"].(string)
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		t.Fatal("config has no local rule sets")
+	}
+	return paths
+}
+
+// writtenRuleSetPaths writes the active runtime config of storage and returns
+// its local rule_set paths; none may refer to oldBase
+func writtenRuleSetPaths(t *testing.T, storage *Storage, oldBase string) []string {
+	t.Helper()
+	path, err := storage.WriteActiveConfigToFile()
+	if err != nil {
+		t.Fatalf("WriteActiveConfigToFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escaped, _ := json.Marshal(oldBase); strings.Contains(string(data), strings.Trim(string(escaped), `"`)) {
+		t.Errorf("runtime config refers to the old folder %s", oldBase)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return localRuleSetPaths(t, config)
+}
+
+func TestConfigRelocatesToAnotherBasePath(t *testing.T) {
+	filterNames := []string{"refilter_domains.srs", "refilter_ips.srs", "community_domains.srs", "community_ips.srs", "discord_ips.srs"}
+	oldBase := filepath.Join(t.TempDir(), "KampusVPN")
+	storage := NewStorage(oldBase)
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	oldFilters := filepath.Join(oldBase, "bin", FiltersFolder)
+	if err := os.MkdirAll(oldFilters, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range filterNames {
+		if err := os.WriteFile(filepath.Join(oldFilters, name), []byte("srs"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profile, err := storage.CreateProfile("Portable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetProfileRoutingMode(profile.ID, RoutingModeBlockedOnly); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConfigBuilderForStorage(storage).BuildConfigForProfile(profile.ID, testDirectLink, nil); err != nil {
+		t.Fatalf("BuildConfigForProfile: %v", err)
+	}
+	if err := storage.SetActiveProfileID(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := mustStoredProfile(t, storage, profile.ID)
+	for _, path := range localRuleSetPaths(t, stored.SingboxConfig) {
+		if !strings.HasPrefix(path, FiltersPathPlaceholder+"/") {
+			t.Errorf("stored rule_set path %s is not relative to %s", path, FiltersPathPlaceholder)
+		}
+	}
+	exported, err := json.Marshal(storage.GetAllProfiles())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The portable folder is moved to another drive
+	newBase := filepath.Join(t.TempDir(), "KampusVPN")
+	if err := os.Rename(oldBase, newBase); err != nil {
+		t.Fatal(err)
+	}
+	newFilters := filepath.Join(newBase, "bin", FiltersFolder)
+
+	assertRelocated := func(t *testing.T, storage *Storage, filters string) {
+		t.Helper()
+		for _, path := range writtenRuleSetPaths(t, storage, oldBase) {
+			if filepath.Dir(path) != filters {
+				t.Errorf("rule_set path %s, want it in %s", path, filters)
+			} else if !fileExists(path) {
+				t.Errorf("rule_set file %s not found", path)
+			}
+		}
+	}
+
+	t.Run("moved folder", func(t *testing.T) {
+		moved := NewStorage(newBase)
+		if err := moved.Init(); err != nil {
+			t.Fatalf("Storage.Init: %v", err)
+		}
+		assertRelocated(t, moved, newFilters)
+	})
+
+	t.Run("absolute paths of an older version", func(t *testing.T) {
+		settingsPath := filepath.Join(newBase, ResourcesFolder, SettingsFileName)
+		data, err := os.ReadFile(settingsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		escaped, _ := json.Marshal(oldFilters)
+		legacy := strings.ReplaceAll(string(data), FiltersPathPlaceholder, strings.Trim(string(escaped), `"`))
+		if legacy == string(data) {
+			t.Fatal("settings.json has no filters placeholder to replace")
+		}
+		if err := os.WriteFile(settingsPath, []byte(legacy), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		moved := NewStorage(newBase)
+		if err := moved.Init(); err != nil {
+			t.Fatalf("Storage.Init: %v", err)
+		}
+		assertRelocated(t, moved, newFilters)
+	})
+
+	t.Run("profiles imported on another machine", func(t *testing.T) {
+		otherBase := t.TempDir()
+		other := NewStorage(otherBase)
+		if err := other.Init(); err != nil {
+			t.Fatalf("Storage.Init: %v", err)
+		}
+		otherFilters := filepath.Join(otherBase, "bin", FiltersFolder)
+		if err := os.MkdirAll(otherFilters, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range filterNames {
+			if err := os.WriteFile(filepath.Join(otherFilters, name), []byte("srs"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var profiles []ProfileData
+		if err := json.Unmarshal(exported, &profiles); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.ReplaceAllProfiles(profiles); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.SetActiveProfileID(profile.ID); err != nil {
+			t.Fatal(err)
+		}
+		// No rebuild: the stored config is used as imported
+		assertRelocated(t, other, otherFilters)
+	})
+}
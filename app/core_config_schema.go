@@ -0,0 +1,83 @@
+// Package main provides schema stamping of generated sing-box configs for KampusVPN.
+// Each stored SingboxConfig is stamped with the app version and builder schema revision
+// that produced it, so configs created by a newer app version are not silently downgraded.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ConfigSchemaRevision is the revision of the config structure produced by this builder.
+// Increment when the generated config layout changes in a way older versions don't understand,
+// and add a migration for stored configs to configMigrations.
+//   - 1: first stamped revision
+//   - 2: typed dns servers instead of legacy "address" strings
+//   - 3: rule actions instead of block/dns-out outbounds
+//   - 4: WireGuard DNS bypass before hijack-dns, tunnel networks after it
+const ConfigSchemaRevision = 4
+
+// ConfigBuildInfo is the stamp stored next to a generated SingboxConfig.
+type ConfigBuildInfo struct {
+	AppVersion     string      `json:"app_version"`            // App version that generated the config
+	SchemaRevision int         `json:"schema_revision"`        // Builder schema revision
+	BuiltAt        time.Time   `json:"built_at"`               // Generation time
+	RoutingMode    RoutingMode `json:"routing_mode,omitempty"` // Routing mode of the profile at build time
+}
+
+// NewConfigBuildInfo returns a stamp for a config built by this app version.
+func NewConfigBuildInfo() *ConfigBuildInfo {
+	return &ConfigBuildInfo{
+		AppVersion:     Version,
+		SchemaRevision: ConfigSchemaRevision,
+		BuiltAt:        time.Now(),
+	}
+}
+
+// IsNewer reports whether the config was produced by a newer builder than this one.
+func (i *ConfigBuildInfo) IsNewer() bool {
+	return i != nil && i.SchemaRevision > ConfigSchemaRevision
+}
+
+// ToMap converts build info to API response format.
+func (i *ConfigBuildInfo) ToMap() map[string]interface{} {
+	if i == nil {
+		return map[string]interface{}{
+			"stamped":         false,
+			"schema_revision": 0,
+			"read_only":       false,
+		}
+	}
+	return map[string]interface{}{
+		"stamped":         true,
+		"app_version":     i.AppVersion,
+		"schema_revision": i.SchemaRevision,
+		"built_at":        i.BuiltAt.Format(time.RFC3339),
+		"read_only":       i.IsNewer(),
+		"routing_mode":    string(i.RoutingMode),
+	}
+}
+
+// ConfigDowngradeError is returned when a rebuild would replace a config
+// produced by a newer app version without user confirmation.
+type ConfigDowngradeError struct {
+	ProfileID      int
+	AppVersion     string
+	SchemaRevision int
+}
+
+func (e *ConfigDowngradeError) Error() string {
+	return fmt.Sprintf("конфиг профиля создан более новой версией приложения (%s, схема %d). "+
+		"Перестроение понизит конфиг до схемы %d - требуется подтверждение",
+		e.AppVersion, e.SchemaRevision, ConfigSchemaRevision)
+}
+
+// asConfigDowngradeError extracts ConfigDowngradeError from err.
+func asConfigDowngradeError(err error) (*ConfigDowngradeError, bool) {
+	var downgradeErr *ConfigDowngradeError
+	if errors.As(err, &downgradeErr) {
+		return downgradeErr, true
+	}
+	return nil, false
+}
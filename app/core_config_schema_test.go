@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// testDirectLink is a proxy link the builder parses without network access
+const testDirectLink = "trojan://secret@de.example.com:443?security=tls&sni=de.example.com#DE"
+
+// newerBuildInfo returns a stamp of an app version with a newer builder
+func newerBuildInfo() *ConfigBuildInfo {
+	return &ConfigBuildInfo{AppVersion: "9.0.0", SchemaRevision: ConfigSchemaRevision + 1}
+}
+
+// testNewerConfigStorage returns a storage whose active profile holds a config of a newer app version
+func testNewerConfigStorage(t *testing.T) (*Storage, *ProfileData) {
+	t.Helper()
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UpdateProfileConfig(profile.ID, testRuntimeConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetActiveProfileID(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+	setTestBuildInfo(t, storage, profile.ID, newerBuildInfo())
+	return storage, profile
+}
+
+func TestConfigBuildInfoIsNewer(t *testing.T) {
+	tests := []struct {
+		name string
+		info *ConfigBuildInfo
+		want bool
+	}{
+		{"unstamped", nil, false},
+		{"older", &ConfigBuildInfo{SchemaRevision: ConfigSchemaRevision - 1}, false},
+		{"current", NewConfigBuildInfo(), false},
+		{"newer", newerBuildInfo(), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.info.IsNewer(); got != tt.want {
+			t.Errorf("%s: IsNewer() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.info.ToMap()["read_only"]; got != tt.want {
+			t.Errorf("%s: read_only = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConnectUsesNewerConfigWithoutRebuild(t *testing.T) {
+	storage, profile := testNewerConfigStorage(t)
+	before, _ := json.Marshal(mustStoredProfile(t, storage, profile.ID).SingboxConfig)
+
+	// Connect migrates older configs only and writes the stored one as is
+	report, err := storage.MigrateProfileConfig(profile.ID)
+	if err != nil || report != nil {
+		t.Errorf("MigrateProfileConfig = %v, %v, want nothing to do", report, err)
+	}
+	path, err := storage.WriteActiveConfigToFile()
+	if err != nil {
+		t.Fatalf("WriteActiveConfigToFile: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("active config not written: %v", err)
+	}
+
+	stored := mustStoredProfile(t, storage, profile.ID)
+	if after, _ := json.Marshal(stored.SingboxConfig); string(after) != string(before) {
+		t.Errorf("stored config changed on connect:\n got %s\nwant %s", after, before)
+	}
+	if !stored.BuildInfo.IsNewer() {
+		t.Errorf("BuildInfo = %+v, want the newer stamp kept", stored.BuildInfo)
+	}
+}
+
+func TestBuildNewerConfigNeedsConfirmation(t *testing.T) {
+	storage, profile := testNewerConfigStorage(t)
+	builder := NewConfigBuilderForStorage(storage)
+	before, _ := json.Marshal(mustStoredProfile(t, storage, profile.ID).SingboxConfig)
+
+	err := builder.BuildConfigForProfile(profile.ID, testDirectLink, nil)
+	downgradeErr, ok := asConfigDowngradeError(err)
+	if !ok {
+		t.Fatalf("BuildConfigForProfile = %v, want ConfigDowngradeError", err)
+	}
+	if downgradeErr.ProfileID != profile.ID || downgradeErr.SchemaRevision != ConfigSchemaRevision+1 || downgradeErr.AppVersion != "9.0.0" {
+		t.Errorf("error = %+v", downgradeErr)
+	}
+	if after, _ := json.Marshal(mustStoredProfile(t, storage, profile.ID).SingboxConfig); string(after) != string(before) {
+		t.Error("refused build changed the stored config")
+	}
+
+	// Confirmed rebuild replaces the config and stamps it with this builder
+	builder.ConfirmDowngrade(profile.ID)
+	if err := builder.BuildConfigForProfile(profile.ID, testDirectLink, nil); err != nil {
+		t.Fatalf("confirmed BuildConfigForProfile: %v", err)
+	}
+	rebuilt := mustStoredProfile(t, storage, profile.ID)
+	if rebuilt.BuildInfo.IsNewer() || rebuilt.BuildInfo.SchemaRevision != ConfigSchemaRevision {
+		t.Errorf("BuildInfo = %+v, want this builder's stamp", rebuilt.BuildInfo)
+	}
+	if tags := jsonOutboundTags(rebuilt.SingboxConfig); !containsString(tags, "DE") {
+		t.Errorf("outbounds = %v, want the subscription proxy", tags)
+	}
+
+	// The confirmation is one-shot
+	setTestBuildInfo(t, storage, profile.ID, newerBuildInfo())
+	if _, ok := asConfigDowngradeError(builder.BuildConfigForProfile(profile.ID, testDirectLink, nil)); !ok {
+		t.Error("second build downgraded without a new confirmation")
+	}
+}
+
+func TestValidateImportDataMixedStamps(t *testing.T) {
+	export := FullExportData{
+		Version: "1.0.0",
+		Profiles: []ProfileData{
+			{ID: 1, Name: "Old", BuildInfo: &ConfigBuildInfo{AppVersion: "0.9.0", SchemaRevision: 1}},
+			{ID: 2, Name: "Current", BuildInfo: NewConfigBuildInfo()},
+			{ID: 3, Name: "Newer", BuildInfo: newerBuildInfo()},
+			{ID: 4, Name: "Unstamped"},
+		},
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := (&App{}).ValidateImportData(string(data))
+	if result["success"] != true {
+		t.Fatalf("ValidateImportData = %v", result)
+	}
+	if result["newer_configs_count"] != 1 {
+		t.Errorf("newer_configs_count = %v, want 1", result["newer_configs_count"])
+	}
+	stamps := result["build_stamps"].([]map[string]interface{})
+	if len(stamps) != 4 {
+		t.Fatalf("build_stamps = %v", stamps)
+	}
+	for i, want := range []bool{false, false, true, false} {
+		if stamps[i]["read_only"] != want || stamps[i]["profile_id"] != export.Profiles[i].ID {
+			t.Errorf("stamp %d = %v, want read_only %v", i, stamps[i], want)
+		}
+	}
+	if stamps[3]["stamped"] != false {
+		t.Errorf("unstamped profile reported as stamped: %v", stamps[3])
+	}
+}
+
+// mustStoredProfile returns a stored profile or fails the test
+func mustStoredProfile(t *testing.T, s *Storage, id int) *ProfileData {
+	t.Helper()
+	profile, err := s.GetProfile(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+// jsonOutboundTags returns tags of the outbounds of a config
+func jsonOutboundTags(config map[string]interface{}) []string {
+	outbounds, _ := config["outbounds"].([]interface{})
+	tags := make([]string, 0, len(outbounds))
+	for _, outbound := range outbounds {
+		if outboundMap, ok := outbound.(map[string]interface{}); ok {
+			tag, _ := outboundMap["tag"].(string)
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,169 @@
+// Package main provides the one-shot "fastest server now" measurement on connect.
+// auto-select's periodic urltest often starts the day on yesterday's best
+// server; right after sing-box is up the likely candidates are measured and
+// the fastest one is used if it beats the current server by the tolerance.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Connect measurement settings
+const (
+	// ConnectMeasureTimeout bounds the whole measurement, including waiting for the Clash API.
+	ConnectMeasureTimeout = 5 * time.Second
+	// ConnectMeasureTopK is the number of best known servers measured in large groups.
+	ConnectMeasureTopK = 10
+	// ConnectMeasureTolerance is the delay gain (ms) needed to switch, as the urltest tolerance.
+	ConnectMeasureTolerance = 50
+	// ConnectMeasureGroup is the urltest group measured on connect.
+	ConnectMeasureGroup = "auto-select"
+	// ConnectMeasureSelector is the selector pinned to the measured best server.
+	ConnectMeasureSelector = "proxy"
+)
+
+// ConnectMeasurement is the outcome of the measurement on connect.
+type ConnectMeasurement struct {
+	Measured      int    `json:"measured"`       // Servers tested
+	Previous      string `json:"previous"`       // Server auto-select used before
+	PreviousDelay int    `json:"previous_delay"` // ms, 0 if it failed or wasn't tested
+	Best          string `json:"best"`
+	BestDelay     int    `json:"best_delay"`
+	Switched      bool   `json:"switched"` // Selector pinned to Best for this session
+	TimedOut      bool   `json:"timed_out"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Summary is a short description for logs and the history export.
+func (m *ConnectMeasurement) Summary() string {
+	switch {
+	case m == nil:
+		return ""
+	case m.Error != "":
+		return "error: " + m.Error
+	case m.Switched:
+		return fmt.Sprintf("switched %s (%d ms) -> %s (%d ms)", m.Previous, m.PreviousDelay, m.Best, m.BestDelay)
+	case m.Best != "":
+		return fmt.Sprintf("kept %s, best %s (%d ms)", m.Previous, m.Best, m.BestDelay)
+	}
+	return "no server answered"
+}
+
+// pickMeasureCandidates returns never-measured members plus the top k by last known delay
+func pickMeasureCandidates(members []string, known map[string]DelayMeasurement, k int) []string {
+	candidates := []string{}
+	measured := []string{}
+	for _, name := range members {
+		if m := known[name]; m.Status == DelayStatusOK {
+			measured = append(measured, name)
+		} else if m.Status == DelayStatusNotTested || m.Status == "" {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.SliceStable(measured, func(i, j int) bool { return known[measured[i]].Delay < known[measured[j]].Delay })
+	if len(measured) > k {
+		measured = measured[:k]
+	}
+	return append(measured, candidates...)
+}
+
+// MeasureOnConnect waits for the Clash API, measures candidate servers of the
+// auto-select group in parallel and pins the selector to the fastest one when
+// it beats the current server by ConnectMeasureTolerance.
+func MeasureOnConnect(timeout time.Duration) *ConnectMeasurement {
+	result := &ConnectMeasurement{}
+	deadline := time.Now().Add(timeout)
+	client := &http.Client{Timeout: timeout}
+
+	// sing-box needs a moment to open the Clash API
+	var members []string
+	var err error
+	for {
+		members, result.Previous, err = clashGroupMembers(client, ConnectMeasureGroup)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if err != nil {
+		result.TimedOut = true
+		result.Error = fmt.Sprintf("Clash API unavailable: %v", err)
+		return result
+	}
+
+	known, err := clashProxyHistories(client)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	candidates := pickMeasureCandidates(members, known, ConnectMeasureTopK)
+	if result.Previous != "" && !containsString(candidates, result.Previous) {
+		candidates = append(candidates, result.Previous)
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		result.TimedOut = true
+		return result
+	}
+
+	delays := make(map[string]int, len(candidates))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range candidates {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			delay, err := clashProxyDelay(client, name, remaining)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			delays[name] = delay
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	result.Measured = len(candidates)
+	result.TimedOut = time.Now().After(deadline)
+	result.PreviousDelay = delays[result.Previous]
+	for name, delay := range delays {
+		if result.Best == "" || delay < result.BestDelay || (delay == result.BestDelay && name < result.Best) {
+			result.Best, result.BestDelay = name, delay
+		}
+	}
+
+	if result.Best == "" || result.Best == result.Previous {
+		return result
+	}
+	// A failed current server is always worse
+	if result.PreviousDelay > 0 && result.PreviousDelay-result.BestDelay <= ConnectMeasureTolerance {
+		return result
+	}
+
+	// A server chosen by the user is left alone
+	if _, selected, err := clashGroupMembers(client, ConnectMeasureSelector); err != nil || selected != ConnectMeasureGroup {
+		return result
+	}
+	if err := clashSelectProxy(client, ConnectMeasureSelector, result.Best); err != nil {
+		result.Error = fmt.Sprintf("switch failed: %v", err)
+		return result
+	}
+	result.Switched = true
+	return result
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Package main provides the live connection list for KampusVPN.
+// The Clash API /connections list is normalized into rows a dashboard can
+// show: the process that opened a connection, where it goes, the outbound
+// chain, the rule that routed it, its age and transferred bytes. Rows are
+// also grouped by destination host to spot chatty hosts at a glance.
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ActiveConnection is one open connection of the running sing-box
+type ActiveConnection struct {
+	ID          string   `json:"id"`
+	Network     string   `json:"network"` // tcp or udp
+	Inbound     string   `json:"inbound"`
+	Source      string   `json:"source"`
+	Process     string   `json:"process,omitempty"` // Executable name, if sing-box found the process
+	ProcessPath string   `json:"processPath,omitempty"`
+	Host        string   `json:"host"` // Sniffed domain, or the destination IP without one
+	Destination string   `json:"destination"`
+	Outbound    string   `json:"outbound"`
+	Chains      []string `json:"chains"`
+	Rule        string   `json:"rule"`
+	RulePayload string   `json:"rulePayload,omitempty"`
+	Start       string   `json:"start,omitempty"`
+	Duration    int64    `json:"duration"` // Seconds
+	Upload      int64    `json:"upload"`
+	Download    int64    `json:"download"`
+}
+
+// ConnectionHostGroup counts the open connections to one destination host
+type ConnectionHostGroup struct {
+	Host      string   `json:"host"`
+	Count     int      `json:"count"`
+	Upload    int64    `json:"upload"`
+	Download  int64    `json:"download"`
+	Outbounds []string `json:"outbounds"`
+}
+
+// normalizeConnections turns the Clash API list into rows, newest first, and
+// groups them by destination host, most connections first
+func normalizeConnections(connections []clashConnection, now time.Time) ([]ActiveConnection, []ConnectionHostGroup) {
+	rows := make([]ActiveConnection, 0, len(connections))
+	groups := map[string]*ConnectionHostGroup{}
+	for _, conn := range connections {
+		row := ActiveConnection{
+			ID:          conn.ID,
+			Network:     conn.Metadata.Network,
+			Inbound:     conn.Metadata.Type,
+			Source:      joinHostPort(conn.Metadata.SourceIP, conn.Metadata.SourcePort),
+			ProcessPath: conn.Metadata.ProcessPath,
+			Host:        conn.connectionDomain(),
+			Destination: joinHostPort(conn.connectionDomain(), conn.Metadata.DestinationPort),
+			Outbound:    conn.connectionOutbound(),
+			Chains:      conn.Chains,
+			Rule:        conn.Rule,
+			RulePayload: conn.RulePayload,
+			Upload:      conn.Upload,
+			Download:    conn.Download,
+		}
+		if row.Chains == nil {
+			row.Chains = []string{}
+		}
+		if conn.Metadata.ProcessPath != "" {
+			row.Process = filepath.Base(conn.Metadata.ProcessPath)
+		}
+		if !conn.Start.IsZero() {
+			row.Start = conn.Start.Format(time.RFC3339)
+			if d := now.Sub(conn.Start); d > 0 {
+				row.Duration = int64(d / time.Second)
+			}
+		}
+		rows = append(rows, row)
+
+		group, ok := groups[row.Host]
+		if !ok {
+			group = &ConnectionHostGroup{Host: row.Host, Outbounds: []string{}}
+			groups[row.Host] = group
+		}
+		group.Count++
+		group.Upload += row.Upload
+		group.Download += row.Download
+		if !containsString(group.Outbounds, row.Outbound) {
+			group.Outbounds = append(group.Outbounds, row.Outbound)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Duration < rows[j].Duration
+	})
+
+	byHost := make([]ConnectionHostGroup, 0, len(groups))
+	for _, group := range groups {
+		byHost = append(byHost, *group)
+	}
+	sort.Slice(byHost, func(i, j int) bool {
+		if byHost[i].Count != byHost[j].Count {
+			return byHost[i].Count > byHost[j].Count
+		}
+		return byHost[i].Host < byHost[j].Host
+	})
+	return rows, byHost
+}
+
+// joinHostPort joins a host and a port, leaving the host alone without a port
+func joinHostPort(host, port string) string {
+	if port == "" || port == "0" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,222 @@
+// Package main provides crash recording for KampusVPN.
+// Panics in the main goroutine and long-lived loops are written to a crash
+// file in the log directory; fatal ones leave a marker so the next start can
+// tell the user the app crashed. Supervised loops are restarted instead.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Crash recording settings
+const (
+	// CrashMarkerFile is left in the log directory after a fatal panic.
+	CrashMarkerFile = "crashed.marker"
+	// CrashFilePrefix names crash files: crash-20060102-150405.log
+	CrashFilePrefix = "crash-"
+	// MaxCrashFiles is the number of crash files kept.
+	MaxCrashFiles = 10
+	// MaxSupervisedRestarts limits restarts of one supervised loop.
+	MaxSupervisedRestarts = 5
+	// SupervisorRestartDelay is the pause before restarting a loop that panicked.
+	SupervisorRestartDelay = 5 * time.Second
+)
+
+// supervisorRestartDelay is SupervisorRestartDelay, shortened by tests
+var supervisorRestartDelay = SupervisorRestartDelay
+
+// CrashInfo describes a recorded panic.
+type CrashInfo struct {
+	Time    time.Time `json:"time"`
+	Where   string    `json:"where"` // Goroutine or loop name
+	Panic   string    `json:"panic"`
+	File    string    `json:"file"` // Crash file with the stack trace
+	Version string    `json:"version"`
+}
+
+// ToMap converts crash info to API response format.
+func (c *CrashInfo) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"time":    c.Time.Format(time.RFC3339),
+		"where":   c.Where,
+		"panic":   c.Panic,
+		"file":    c.File,
+		"version": c.Version,
+		"message": "Приложение аварийно завершилось в прошлый раз",
+	}
+}
+
+// CrashReporter writes crash files. A nil reporter lets panics through untouched.
+type CrashReporter struct {
+	dir string
+	log func(string)
+	mu  sync.Mutex
+}
+
+// NewCrashReporter creates a reporter writing to dir.
+func NewCrashReporter(dir string, logFunc func(string)) *CrashReporter {
+	return &CrashReporter{dir: dir, log: logFunc}
+}
+
+func (c *CrashReporter) logf(format string, args ...interface{}) {
+	if c.log != nil {
+		c.log(fmt.Sprintf("[Crash] "+format, args...))
+	}
+}
+
+// Record writes the panic value and stack to a crash file and returns its path.
+// Fatal crashes also leave the marker for the next start.
+func (c *CrashReporter) Record(where string, value interface{}, stack []byte, fatal bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	os.MkdirAll(c.dir, 0755)
+	stamp := now.Format("20060102-150405.000")
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Kampus VPN %s crash report\n", Version))
+	sb.WriteString(fmt.Sprintf("Time: %s\n", now.Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("OS: %s/%s, Go: %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version()))
+	sb.WriteString(fmt.Sprintf("Where: %s\n", where))
+	sb.WriteString(fmt.Sprintf("Fatal: %v\n", fatal))
+	sb.WriteString(fmt.Sprintf("Panic: %v\n\n", value))
+	sb.Write(stack)
+
+	path, err := writeCrashFile(c.dir, stamp, sb.String())
+	if err != nil {
+		c.logf("Failed to write crash file: %v", err)
+		path = ""
+	}
+	c.pruneCrashFiles()
+
+	if fatal {
+		info := CrashInfo{
+			Time:    now,
+			Where:   where,
+			Panic:   fmt.Sprint(value),
+			File:    path,
+			Version: Version,
+		}
+		if data, err := json.Marshal(info); err == nil {
+			os.WriteFile(filepath.Join(c.dir, CrashMarkerFile), data, 0644)
+		}
+	}
+	return path
+}
+
+// writeCrashFile creates a new crash file. Crashes within the same millisecond
+// get a numbered name instead of overwriting each other.
+func writeCrashFile(dir, stamp, content string) (string, error) {
+	for i := 0; ; i++ {
+		name := stamp
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d", stamp, i)
+		}
+		path := filepath.Join(dir, CrashFilePrefix+name+".log")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return path, err
+	}
+}
+
+// pruneCrashFiles keeps the newest MaxCrashFiles crash files
+func (c *CrashReporter) pruneCrashFiles() {
+	matches, err := filepath.Glob(filepath.Join(c.dir, CrashFilePrefix+"*.log"))
+	if err != nil || len(matches) <= MaxCrashFiles {
+		return
+	}
+	sort.Strings(matches) // Timestamped names sort chronologically
+	for _, old := range matches[:len(matches)-MaxCrashFiles] {
+		os.Remove(old)
+	}
+}
+
+// Guard records a panic as fatal and re-panics. Use as `defer crash.Guard("name")`
+// in goroutines that cannot be safely restarted.
+func (c *CrashReporter) Guard(where string) {
+	if c == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		path := c.Record(where, r, debug.Stack(), true)
+		c.logf("Panic in %s: %v (see %s)", where, r, path)
+		panic(r)
+	}
+}
+
+// Supervise runs loop and restarts it after a panic, up to MaxSupervisedRestarts
+// times. Returns when loop returns normally or restarts are exhausted.
+func (c *CrashReporter) Supervise(where string, loop func()) {
+	if c == nil {
+		loop()
+		return
+	}
+
+	for restarts := 0; ; restarts++ {
+		if !c.runRecovered(where, loop) {
+			return
+		}
+		if restarts >= MaxSupervisedRestarts {
+			c.logf("%s panicked %d times, not restarting", where, restarts+1)
+			return
+		}
+		time.Sleep(supervisorRestartDelay)
+		c.logf("Restarting %s (restart %d/%d)", where, restarts+1, MaxSupervisedRestarts)
+	}
+}
+
+// runRecovered runs loop and reports whether it panicked
+func (c *CrashReporter) runRecovered(where string, loop func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			path := c.Record(where, r, debug.Stack(), false)
+			c.logf("Panic in %s: %v (see %s)", where, r, path)
+		}
+	}()
+	loop()
+	return false
+}
+
+// LastCrash returns the fatal crash left by the previous run (nil if none).
+func (c *CrashReporter) LastCrash() *CrashInfo {
+	if c == nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, CrashMarkerFile))
+	if err != nil {
+		return nil
+	}
+	var info CrashInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+// ClearMarker removes the "crashed last time" marker.
+func (c *CrashReporter) ClearMarker() {
+	if c == nil {
+		return
+	}
+	os.Remove(filepath.Join(c.dir, CrashMarkerFile))
+}
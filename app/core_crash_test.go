@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testCrashReporter returns a reporter writing to a temp dir and its log lines
+func testCrashReporter(t *testing.T) (*CrashReporter, func() []string) {
+	t.Helper()
+	previous := supervisorRestartDelay
+	supervisorRestartDelay = 0
+	t.Cleanup(func() { supervisorRestartDelay = previous })
+
+	var mu sync.Mutex
+	var lines []string
+	reporter := NewCrashReporter(t.TempDir(), func(line string) {
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+	})
+	return reporter, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), lines...)
+	}
+}
+
+// crashFiles returns crash files of dir
+func crashFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, CrashFilePrefix+"*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestSuperviseRestartsAfterPanic(t *testing.T) {
+	tests := []struct {
+		name   string
+		panics int // Panics before the loop returns normally
+		runs   int
+	}{
+		{"no panic", 0, 1},
+		{"restarted twice", 2, 3},
+		{"restarts exhausted", 100, MaxSupervisedRestarts + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter, logLines := testCrashReporter(t)
+			runs := 0
+			reporter.Supervise("test-loop", func() {
+				runs++
+				if runs <= tt.panics {
+					panic("loop failed")
+				}
+			})
+
+			if runs != tt.runs {
+				t.Errorf("loop ran %d times, want %d", runs, tt.runs)
+			}
+			panics := tt.panics
+			if panics > tt.runs {
+				panics = tt.runs
+			}
+			files := crashFiles(t, reporter.dir)
+			if len(files) != panics {
+				t.Fatalf("crash files = %v, want %d", files, panics)
+			}
+			for _, file := range files {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				content := string(data)
+				if !strings.Contains(content, "Where: test-loop") || !strings.Contains(content, "Panic: loop failed") ||
+					!strings.Contains(content, "Fatal: false") || !strings.Contains(content, "goroutine") {
+					t.Errorf("crash file %s:\n%s", file, content)
+				}
+			}
+			// A supervised panic is not a crash of the app
+			if reporter.LastCrash() != nil {
+				t.Error("marker left by a supervised panic")
+			}
+
+			restarts := 0
+			for _, line := range logLines() {
+				if strings.HasPrefix(line, "[Crash] Restarting test-loop") {
+					restarts++
+				}
+			}
+			if want := tt.runs - 1; restarts != want {
+				t.Errorf("restarts logged = %d, want %d", restarts, want)
+			}
+		})
+	}
+}
+
+func TestGuardRecordsFatalPanic(t *testing.T) {
+	reporter, _ := testCrashReporter(t)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "fatal failure" {
+				t.Errorf("recovered %v, want the original panic", r)
+			}
+		}()
+		defer reporter.Guard("main")
+		panic("fatal failure")
+	}()
+
+	crash := reporter.LastCrash()
+	if crash == nil {
+		t.Fatal("no marker after a fatal panic")
+	}
+	if crash.Where != "main" || crash.Panic != "fatal failure" || crash.Version != Version {
+		t.Errorf("crash = %+v", crash)
+	}
+	if _, err := os.Stat(crash.File); err != nil {
+		t.Errorf("crash file: %v", err)
+	}
+
+	reporter.ClearMarker()
+	if reporter.LastCrash() != nil {
+		t.Error("marker not cleared")
+	}
+}
+
+func TestCrashFilesPruned(t *testing.T) {
+	reporter, _ := testCrashReporter(t)
+	for i := 0; i < MaxCrashFiles+3; i++ {
+		if path := reporter.Record("loop", i, nil, false); path == "" {
+			t.Fatalf("record %d not written", i)
+		}
+	}
+	if files := crashFiles(t, reporter.dir); len(files) != MaxCrashFiles {
+		t.Errorf("crash files = %d, want %d", len(files), MaxCrashFiles)
+	}
+}
+
+func TestNilCrashReporter(t *testing.T) {
+	var reporter *CrashReporter
+	runs := 0
+	reporter.Supervise("loop", func() { runs++ })
+	if runs != 1 {
+		t.Errorf("loop ran %d times", runs)
+	}
+	reporter.Guard("main")
+	if reporter.LastCrash() != nil {
+		t.Error("nil reporter has a crash")
+	}
+}
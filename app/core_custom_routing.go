@@ -0,0 +1,230 @@
+// Package main provides the "custom" routing mode for KampusVPN.
+// Users who maintain their own rule list supply sing-box route rules (and
+// optionally rule_set entries) stored per profile instead of editing
+// template.json, whose route.rules every routing mode overwrites. The builder
+// validates them, puts the mandatory sniff/hijack-dns/private rules first and
+// sets the final outbound chosen by the user.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CustomRouting is the user's route section of a profile in the custom routing mode.
+type CustomRouting struct {
+	Rules    []map[string]interface{} `json:"rules"`
+	RuleSets []map[string]interface{} `json:"rule_set,omitempty"`
+	Final    string                   `json:"final,omitempty"` // "" = proxy
+}
+
+// EffectiveFinal returns the final outbound (proxy if unset)
+func (c *CustomRouting) EffectiveFinal() string {
+	if c.Final == "" {
+		return "proxy"
+	}
+	return c.Final
+}
+
+// ParseCustomRouting parses the rules and rule_set JSON arrays entered by the
+// user. Outbound references are checked at build time, when the outbound tags
+// are known.
+func ParseCustomRouting(rulesJSON, ruleSetsJSON, final string) (*CustomRouting, error) {
+	rules, err := parseJSONObjects(rulesJSON, "rules")
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("нужно хотя бы одно правило")
+	}
+	ruleSets, err := parseJSONObjects(ruleSetsJSON, "rule_set")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]bool{}
+	for i, rs := range ruleSets {
+		tag, _ := rs["tag"].(string)
+		if tag == "" {
+			return nil, fmt.Errorf("rule_set[%d]: нет тега", i)
+		}
+		if tags[tag] {
+			return nil, fmt.Errorf("rule_set[%d]: тег %s уже используется", i, tag)
+		}
+		tags[tag] = true
+		if kind, _ := rs["type"].(string); kind == "" {
+			return nil, fmt.Errorf("rule_set[%d]: нет типа (local, remote, inline)", i)
+		}
+	}
+
+	return &CustomRouting{Rules: rules, RuleSets: ruleSets, Final: strings.TrimSpace(final)}, nil
+}
+
+// parseJSONObjects parses a JSON array whose elements must all be objects ("" = empty)
+func parseJSONObjects(data, name string) ([]map[string]interface{}, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var items []interface{}
+	if err := json.Unmarshal([]byte(data), &items); err != nil {
+		return nil, fmt.Errorf("%s: нужен JSON-массив: %w", name, err)
+	}
+	objects := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: элемент должен быть объектом", name, i)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// mandatoryRouteRules are the rules every routing mode starts with: sniffing,
+// local domains and private IPs direct, DNS hijack
+func mandatoryRouteRules() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"action": "sniff",
+		},
+		map[string]interface{}{
+			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
+			"action":        "route",
+			"outbound":      "direct",
+		},
+		map[string]interface{}{
+			"protocol": "dns",
+			"action":   "hijack-dns",
+		},
+		map[string]interface{}{
+			"ip_is_private": true,
+			"action":        "route",
+			"outbound":      "direct",
+		},
+	}
+}
+
+// outboundTags returns the tags of the outbounds and endpoints of a config
+func outboundTags(template map[string]interface{}) map[string]bool {
+	tags := map[string]bool{"direct": true, "proxy": true}
+	for _, section := range []string{"outbounds", "endpoints"} {
+		items, _ := template[section].([]interface{})
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok {
+				if tag, _ := m["tag"].(string); tag != "" {
+					tags[tag] = true
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// validateCustomRouting checks the outbound and rule_set references of custom rules
+func validateCustomRouting(custom *CustomRouting, outbounds, ruleSets map[string]bool) error {
+	for i, rule := range custom.Rules {
+		if outbound, ok := rule["outbound"]; ok {
+			tag, _ := outbound.(string)
+			if !outbounds[tag] {
+				return fmt.Errorf("правило %d: неизвестный outbound %v", i+1, outbound)
+			}
+		}
+		for _, tag := range ruleSetReferences(rule["rule_set"]) {
+			if !ruleSets[tag] {
+				return fmt.Errorf("правило %d: неизвестный rule_set %s", i+1, tag)
+			}
+		}
+		// Rules of a logical rule reference rule sets as well
+		if nested, ok := rule["rules"].([]interface{}); ok {
+			for _, n := range nested {
+				if m, ok := n.(map[string]interface{}); ok {
+					for _, tag := range ruleSetReferences(m["rule_set"]) {
+						if !ruleSets[tag] {
+							return fmt.Errorf("правило %d: неизвестный rule_set %s", i+1, tag)
+						}
+					}
+				}
+			}
+		}
+	}
+	if !outbounds[custom.EffectiveFinal()] {
+		return fmt.Errorf("неизвестный outbound для final: %s", custom.EffectiveFinal())
+	}
+	return nil
+}
+
+// ruleSetReferences returns the tags of a rule_set field (string or array)
+func ruleSetReferences(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, item := range v {
+			if tag, ok := item.(string); ok {
+				tags = append(tags, tag)
+			}
+		}
+		return tags
+	}
+	return nil
+}
+
+// applyCustomMode replaces the route rules with the user's rules after the
+// mandatory ones. Local filter rule sets stay available to the rules.
+func (g *configGenerator) applyCustomMode(template map[string]interface{}, route map[string]interface{}, custom *CustomRouting) error {
+	fmt.Printf("[applyRoutingMode] Using custom mode\n")
+	if custom == nil || len(custom.Rules) == 0 {
+		return fmt.Errorf("режим custom: правила маршрутизации не заданы")
+	}
+
+	ruleSets := []interface{}{}
+	known := map[string]bool{}
+	for _, rs := range g.filterManager.GetRuleSetConfigs() {
+		if tag, ok := rs["tag"].(string); ok {
+			known[tag] = true
+		}
+		ruleSets = append(ruleSets, rs)
+	}
+	for _, rs := range custom.RuleSets {
+		tag, _ := rs["tag"].(string)
+		if known[tag] {
+			return fmt.Errorf("режим custom: rule_set %s совпадает с тегом встроенного фильтра", tag)
+		}
+		known[tag] = true
+		ruleSets = append(ruleSets, rs)
+	}
+
+	if err := validateCustomRouting(custom, outboundTags(template), known); err != nil {
+		return fmt.Errorf("режим custom: %w", err)
+	}
+
+	rules := mandatoryRouteRules()
+	for _, rule := range custom.Rules {
+		rules = append(rules, rule)
+	}
+	route["rule_set"] = ruleSets
+	route["rules"] = rules
+	route["final"] = custom.EffectiveFinal()
+
+	fmt.Printf("[applyRoutingMode] Applied custom: %d rule_sets, %d rules, final=%s\n",
+		len(ruleSets), len(rules), custom.EffectiveFinal())
+	return nil
+}
+
+// --- Storage ---
+
+// SetProfileCustomRouting sets the custom routing of a profile (nil clears it).
+func (s *Storage) SetProfileCustomRouting(id int, custom *CustomRouting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].CustomRouting = custom
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
@@ -0,0 +1,228 @@
+// Package main provides per-profile custom domain rules for KampusVPN.
+// One-off exceptions: a domain that must go through the proxy even in
+// blocked_only mode, one that must go direct in all_traffic mode, or one that
+// must be blocked. The rules are inserted ahead of the routing mode rules, so
+// they win in every mode.
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+)
+
+// Custom rule lists
+const (
+	CustomRuleProxy  = "proxy"  // Always through the VPN
+	CustomRuleDirect = "direct" // Always bypass the VPN
+	CustomRuleBlock  = "block"  // Rejected
+)
+
+// CustomDomainExactPrefix marks an entry matching only the domain itself
+// ("full:example.com"); other entries match the domain and its subdomains.
+const CustomDomainExactPrefix = "full:"
+
+// CustomDomainRules are the user's domain lists of a profile.
+type CustomDomainRules struct {
+	ProxyDomains  []string `json:"proxy_domains,omitempty"`
+	DirectDomains []string `json:"direct_domains,omitempty"`
+	BlockDomains  []string `json:"block_domains,omitempty"`
+}
+
+// IsEmpty reports whether all lists are empty
+func (r *CustomDomainRules) IsEmpty() bool {
+	return r == nil || len(r.ProxyDomains)+len(r.DirectDomains)+len(r.BlockDomains) == 0
+}
+
+// list returns the list of a rule kind
+func (r *CustomDomainRules) list(kind string) (*[]string, error) {
+	switch kind {
+	case CustomRuleProxy:
+		return &r.ProxyDomains, nil
+	case CustomRuleDirect:
+		return &r.DirectDomains, nil
+	case CustomRuleBlock:
+		return &r.BlockDomains, nil
+	default:
+		return nil, fmt.Errorf("неизвестный список: %s", kind)
+	}
+}
+
+// normalizeCustomDomain turns user input ("https://Example.com/path",
+// "*.example.com", "full:example.com") into a stored entry.
+func normalizeCustomDomain(entry string) (string, error) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	exact := strings.HasPrefix(entry, CustomDomainExactPrefix)
+	entry = strings.TrimPrefix(entry, CustomDomainExactPrefix)
+
+	if i := strings.Index(entry, "://"); i != -1 {
+		entry = entry[i+3:]
+	}
+	if i := strings.IndexAny(entry, "/?#"); i != -1 {
+		entry = entry[:i]
+	}
+	if i := strings.LastIndex(entry, "@"); i != -1 {
+		entry = entry[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(entry); err == nil {
+		entry = host
+	}
+	entry = strings.TrimPrefix(entry, "*")
+	entry = strings.Trim(entry, ".")
+
+	if entry == "" {
+		return "", fmt.Errorf("пустой домен")
+	}
+	for _, r := range entry {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '.' {
+			return "", fmt.Errorf("недопустимый домен: %s", entry)
+		}
+	}
+	if exact {
+		return CustomDomainExactPrefix + entry, nil
+	}
+	return entry, nil
+}
+
+// customDomainRouteRule converts one list to a route rule (nil if empty)
+func customDomainRouteRule(entries []string) map[string]interface{} {
+	var exact, suffixes []string
+	for _, entry := range entries {
+		if domain, ok := strings.CutPrefix(entry, CustomDomainExactPrefix); ok {
+			exact = append(exact, domain)
+		} else {
+			suffixes = append(suffixes, entry)
+		}
+	}
+	if len(exact) == 0 && len(suffixes) == 0 {
+		return nil
+	}
+	rule := map[string]interface{}{}
+	if len(exact) > 0 {
+		rule["domain"] = exact
+	}
+	if len(suffixes) > 0 {
+		rule["domain_suffix"] = suffixes
+	}
+	return rule
+}
+
+// customRouteRules converts custom rules to sing-box route rules.
+// Block comes first, then direct, then proxy.
+func customRouteRules(rules *CustomDomainRules) []interface{} {
+	routeRules := []interface{}{}
+	if rules == nil {
+		return routeRules
+	}
+	if rule := customDomainRouteRule(rules.BlockDomains); rule != nil {
+		rule["action"] = "reject"
+		routeRules = append(routeRules, rule)
+	}
+	if rule := customDomainRouteRule(rules.DirectDomains); rule != nil {
+		rule["action"] = "route"
+		rule["outbound"] = "direct"
+		routeRules = append(routeRules, rule)
+	}
+	if rule := customDomainRouteRule(rules.ProxyDomains); rule != nil {
+		rule["action"] = "route"
+		rule["outbound"] = "proxy"
+		routeRules = append(routeRules, rule)
+	}
+	return routeRules
+}
+
+// insertCustomRules puts custom rules right after hijack-dns (or after sniff
+// and app rules without it), ahead of the rules of the routing mode
+func insertCustomRules(route map[string]interface{}, rules *CustomDomainRules) {
+	if rules.IsEmpty() {
+		return
+	}
+	existing, _ := route["rules"].([]interface{})
+
+	insertIdx := 0
+	for i, r := range existing {
+		ruleMap, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if action, _ := ruleMap["action"].(string); action == "hijack-dns" {
+			insertIdx = i + 1
+			break
+		}
+		if action, _ := ruleMap["action"].(string); action == "sniff" || isAppRouteRule(r) {
+			insertIdx = i + 1
+		}
+	}
+
+	customRules := customRouteRules(rules)
+	finalRules := make([]interface{}, 0, len(existing)+len(customRules))
+	finalRules = append(finalRules, existing[:insertIdx]...)
+	finalRules = append(finalRules, customRules...)
+	finalRules = append(finalRules, existing[insertIdx:]...)
+	route["rules"] = finalRules
+	fmt.Printf("[applyRoutingMode] Added %d custom domain rules at position %d\n", len(customRules), insertIdx)
+}
+
+// --- Storage ---
+
+// AddProfileCustomDomain adds a normalized domain to a custom list of a profile.
+func (s *Storage) AddProfileCustomDomain(id int, kind, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		if p.CustomRules == nil {
+			p.CustomRules = &CustomDomainRules{}
+		}
+		list, err := p.CustomRules.list(kind)
+		if err != nil {
+			return err
+		}
+		if containsString(*list, domain) {
+			return fmt.Errorf("%s уже есть в списке", domain)
+		}
+		*list = append(*list, domain)
+		return s.saveInternal()
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// RemoveProfileCustomDomain removes a domain from a custom list of a profile.
+func (s *Storage) RemoveProfileCustomDomain(id int, kind, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		if p.CustomRules == nil {
+			p.CustomRules = &CustomDomainRules{}
+		}
+		list, err := p.CustomRules.list(kind)
+		if err != nil {
+			return err
+		}
+		kept := make([]string, 0, len(*list))
+		for _, entry := range *list {
+			if entry != domain {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == len(*list) {
+			return fmt.Errorf("%s не найден в списке", domain)
+		}
+		*list = kept
+		if p.CustomRules.IsEmpty() {
+			p.CustomRules = nil
+		}
+		return s.saveInternal()
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
@@ -0,0 +1,112 @@
+// Package main provides detection of the default network interface.
+// The direct outbound is bound to it so "direct" traffic can't leave through
+// a dead or virtual adapter after a network change.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Default interface settings
+const (
+	// InterfacePollInterval is how often the default interface is re-checked while connected.
+	InterfacePollInterval = 5 * time.Second
+	// singboxTunName is the TUN interface name from the template (never a default for direct traffic).
+	singboxTunName = "singbox-tun"
+	// ifTypePropVirtual is IF_TYPE_PROP_VIRTUAL (WireGuard, Wintun and other virtual adapters).
+	ifTypePropVirtual = 53
+)
+
+// NetworkInterface is a physical adapter that can carry direct traffic.
+type NetworkInterface struct {
+	Name   string `json:"name"`   // Friendly name sing-box binds to ("Ethernet", "Wi-Fi")
+	Index  uint32 `json:"index"`  // Interface index
+	Metric uint32 `json:"metric"` // IPv4 route metric, lower wins
+}
+
+// readAdapterAddresses returns the GetAdaptersAddresses list of all adapters
+// (nil when there are none)
+func readAdapterAddresses() (*windows.IpAdapterAddresses, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for i := 0; i < 3; i++ {
+		buf = make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_GATEWAYS,
+			0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			break
+		}
+		if err == windows.ERROR_NO_DATA {
+			return nil, nil
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, fmt.Errorf("GetAdaptersAddresses: %w", err)
+		}
+		buf = nil
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("GetAdaptersAddresses: buffer too small")
+	}
+	return (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), nil
+}
+
+// listGatewayInterfaces returns adapters that are up and have a default gateway,
+// ordered by metric
+func listGatewayInterfaces() ([]NetworkInterface, error) {
+	first, err := readAdapterAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []NetworkInterface{}
+	for aa := first; aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp || aa.FirstGatewayAddress == nil {
+			continue
+		}
+		switch aa.IfType {
+		case windows.IF_TYPE_SOFTWARE_LOOPBACK, windows.IF_TYPE_TUNNEL, ifTypePropVirtual:
+			continue
+		}
+		name := windows.UTF16PtrToString(aa.FriendlyName)
+		if name == "" || name == singboxTunName {
+			continue
+		}
+		result = append(result, NetworkInterface{Name: name, Index: aa.IfIndex, Metric: aa.Ipv4Metric})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Metric < result[j].Metric })
+	return result, nil
+}
+
+// DefaultInterface returns the adapter the OS would use for direct traffic
+// ("" if there is no connected adapter).
+func DefaultInterface() (string, error) {
+	interfaces, err := listGatewayInterfaces()
+	if err != nil || len(interfaces) == 0 {
+		return "", err
+	}
+	return interfaces[0].Name, nil
+}
+
+// applyDirectInterface binds the direct outbound and the default route of
+// config to iface. auto_detect_interface conflicts with default_interface.
+func applyDirectInterface(config map[string]interface{}, iface string) {
+	if iface == "" {
+		return
+	}
+	if route, ok := config["route"].(map[string]interface{}); ok {
+		delete(route, "auto_detect_interface")
+		route["default_interface"] = iface
+	}
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, o := range outbounds {
+		if outbound, ok := o.(map[string]interface{}); ok && outbound["type"] == "direct" {
+			outbound["bind_interface"] = iface
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// directShape returns the direct outbound and the interface fields of route in config
+func directShape(t *testing.T, config map[string]interface{}) (direct map[string]interface{}, route map[string]interface{}) {
+	t.Helper()
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, o := range outbounds {
+		if outbound, ok := o.(map[string]interface{}); ok && outbound["type"] == "direct" {
+			direct = outbound
+		}
+	}
+	if direct == nil {
+		t.Fatal("config has no direct outbound")
+	}
+	route = map[string]interface{}{}
+	r, _ := config["route"].(map[string]interface{})
+	for _, key := range []string{"auto_detect_interface", "default_interface"} {
+		if v, ok := r[key]; ok {
+			route[key] = v
+		}
+	}
+	return direct, route
+}
+
+// otherOutbounds returns the JSON of all outbounds but direct
+func otherOutbounds(t *testing.T, config map[string]interface{}) string {
+	t.Helper()
+	others := []interface{}{}
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, o := range outbounds {
+		if outbound, ok := o.(map[string]interface{}); !ok || outbound["type"] != "direct" {
+			others = append(others, o)
+		}
+	}
+	data, err := json.Marshal(others)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+var (
+	// Direct outbound and route interface fields of the generated config, unbound and bound to Ethernet
+	unboundDirect = map[string]interface{}{"type": "direct", "tag": "direct", "tcp_fast_open": true, "tcp_multi_path": true}
+	boundDirect   = map[string]interface{}{"type": "direct", "tag": "direct", "tcp_fast_open": true, "tcp_multi_path": true, "bind_interface": "Ethernet"}
+	unboundRoute  = map[string]interface{}{"auto_detect_interface": true}
+	boundRoute    = map[string]interface{}{"default_interface": "Ethernet"}
+)
+
+func TestApplyDirectInterface(t *testing.T) {
+	data, err := os.ReadFile("testdata/config_golden/except_russia.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		iface  string
+		direct map[string]interface{}
+		route  map[string]interface{}
+	}{
+		{"bound", "Ethernet", boundDirect, boundRoute},
+		{"no adapter", "", unboundDirect, unboundRoute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config map[string]interface{}
+			if err := json.Unmarshal(data, &config); err != nil {
+				t.Fatal(err)
+			}
+			before := otherOutbounds(t, config)
+
+			applyDirectInterface(config, tt.iface)
+
+			direct, route := directShape(t, config)
+			if !reflect.DeepEqual(direct, tt.direct) {
+				t.Errorf("direct outbound = %v, want %v", direct, tt.direct)
+			}
+			if !reflect.DeepEqual(route, tt.route) {
+				t.Errorf("route interface fields = %v, want %v", route, tt.route)
+			}
+			if after := otherOutbounds(t, config); after != before {
+				t.Errorf("other outbounds changed:\n%s\n%s", before, after)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfigDirectInterfaceBinding(t *testing.T) {
+	tests := []struct {
+		name      string
+		disabled  bool
+		wireGuard []UserWireGuardConfig
+		direct    map[string]interface{}
+		route     map[string]interface{}
+	}{
+		{"setting on", false, nil, boundDirect, boundRoute},
+		{"setting off", true, nil, unboundDirect, unboundRoute},
+		// Native WireGuard traffic leaves through direct and must reach the tunnel adapter
+		{"setting on with WireGuard", false, goldenWireGuard, unboundDirect, unboundRoute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := NewStorage(t.TempDir())
+			if err := storage.Init(); err != nil {
+				t.Fatalf("Storage.Init: %v", err)
+			}
+			profile, err := storage.CreateProfile("Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.SetProfileRoutingMode(profile.ID, RoutingModeExceptRussia); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewConfigBuilderForStorage(storage).BuildConfigForProfile(profile.ID, testDirectLink, tt.wireGuard); err != nil {
+				t.Fatalf("BuildConfigForProfile: %v", err)
+			}
+			if err := storage.SetActiveProfileID(profile.ID); err != nil {
+				t.Fatal(err)
+			}
+			settings := storage.GetAppSettings()
+			settings.DisableDirectInterfaceBinding = tt.disabled
+			if err := storage.UpdateAppSettings(settings); err != nil {
+				t.Fatal(err)
+			}
+
+			// The adapter detected at connect; with the setting off detection clears it
+			storage.SetDirectInterface("Ethernet")
+			if tt.disabled {
+				a := &App{storage: storage, logStore: NewLogStore()}
+				if iface := a.detectDirectInterface(); iface != "" {
+					t.Fatalf("detectDirectInterface = %q with the setting off", iface)
+				}
+			}
+
+			path, err := storage.WriteActiveConfigToFile()
+			if err != nil {
+				t.Fatalf("WriteActiveConfigToFile: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var written map[string]interface{}
+			if err := json.Unmarshal(data, &written); err != nil {
+				t.Fatal(err)
+			}
+
+			direct, route := directShape(t, written)
+			if !reflect.DeepEqual(direct, tt.direct) {
+				t.Errorf("direct outbound = %v, want %v", direct, tt.direct)
+			}
+			if !reflect.DeepEqual(route, tt.route) {
+				t.Errorf("route interface fields = %v, want %v", route, tt.route)
+			}
+
+			stored, _ := directShape(t, mustStoredProfile(t, storage, profile.ID).SingboxConfig)
+			if _, ok := stored["bind_interface"]; ok {
+				t.Error("binding leaked into the stored config")
+			}
+		})
+	}
+}
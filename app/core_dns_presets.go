@@ -0,0 +1,177 @@
+// Package main provides the preferred DNS override for KampusVPN.
+// The user can replace the final (remote) resolver of the template with a
+// preset or a custom address; WireGuard and other special servers are kept.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultFinalDNSTag is the template resolver used when dns.final is not set
+const DefaultFinalDNSTag = "dns-remote"
+
+// DNSPreset is a curated public resolver
+type DNSPreset struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// DNSPresets lists resolvers offered in the UI. IP-based DoH addresses
+// don't need a bootstrap resolver.
+var DNSPresets = []DNSPreset{
+	{ID: "cloudflare", Name: "Cloudflare", Address: "https://1.1.1.1/dns-query"},
+	{ID: "google", Name: "Google", Address: "https://8.8.8.8/dns-query"},
+	{ID: "adguard", Name: "AdGuard DNS", Address: "https://94.140.14.14/dns-query"},
+	{ID: "quad9", Name: "Quad9", Address: "https://9.9.9.9/dns-query"},
+	{ID: "comss", Name: "Comss.one DNS", Address: "https://dns.comss.one/dns-query"},
+}
+
+// ResolvePreferredDNS returns the resolver address for a preset ID or validates
+// a custom address (IP or DoH URL). Empty value means template default.
+func ResolvePreferredDNS(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	for _, preset := range DNSPresets {
+		if strings.EqualFold(value, preset.ID) {
+			return preset.Address, nil
+		}
+	}
+
+	if net.ParseIP(value) != nil {
+		return value, nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return "", fmt.Errorf("DNS-сервер должен быть IP-адресом или DoH-адресом вида https://host/dns-query")
+	}
+	return value, nil
+}
+
+// preferredDNSServer builds the dns.servers entry for address, keeping the tag
+// and detour of the entry it replaces.
+func preferredDNSServer(address string, replaced map[string]interface{}) (map[string]interface{}, error) {
+	server, err := typedDNSServer(address)
+	if err != nil {
+		return nil, err
+	}
+	server["tag"] = replaced["tag"]
+	if detour, ok := replaced["detour"]; ok {
+		server["detour"] = detour
+	}
+	// DoH by hostname needs a resolver for the server name itself
+	if host, _ := server["server"].(string); host != "" && net.ParseIP(host) == nil {
+		server["domain_resolver"] = "dns-direct"
+	}
+	return server, nil
+}
+
+// finalDNSTag returns the tag of the default resolver of a config
+func finalDNSTag(dns map[string]interface{}) string {
+	if final, ok := dns["final"].(string); ok && final != "" {
+		return final
+	}
+	return DefaultFinalDNSTag
+}
+
+// wireGuardDNSTags returns tags of DNS servers generated for WireGuard tunnels
+func wireGuardDNSTags(wireGuardConfigs []UserWireGuardConfig) map[string]bool {
+	tags := make(map[string]bool, len(wireGuardConfigs))
+	for _, wg := range wireGuardConfigs {
+		tags[fmt.Sprintf("dns-%s", wg.Tag)] = true
+	}
+	return tags
+}
+
+// applyPreferredDNS replaces the final resolver of config. An empty address
+// restores the template entry given as fallback (nil keeps the current one).
+func applyPreferredDNS(config map[string]interface{}, address string, fallback map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) error {
+	dns, ok := config["dns"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	servers, _ := dns["servers"].([]interface{})
+	finalTag := finalDNSTag(dns)
+
+	if wireGuardDNSTags(wireGuardConfigs)[finalTag] {
+		// Tunnel resolvers are never overridden
+		return nil
+	}
+
+	for i, s := range servers {
+		server, ok := s.(map[string]interface{})
+		if !ok || server["tag"] != finalTag {
+			continue
+		}
+
+		if address == "" {
+			if fallback != nil {
+				servers[i] = deepCopyJSONMap(fallback)
+			}
+			return nil
+		}
+
+		replacement, err := preferredDNSServer(address, server)
+		if err != nil {
+			return err
+		}
+		servers[i] = replacement
+		return nil
+	}
+	return nil
+}
+
+// templateDNSServer returns the template dns.servers entry with tag (nil if not found)
+func templateDNSServer(templatePath, tag string) map[string]interface{} {
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil
+	}
+	var template map[string]interface{}
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil
+	}
+	dns, _ := template["dns"].(map[string]interface{})
+	servers, _ := dns["servers"].([]interface{})
+	for _, s := range servers {
+		if server, ok := s.(map[string]interface{}); ok && server["tag"] == tag {
+			return server
+		}
+	}
+	return nil
+}
+
+// describeDNSServer returns a display address for a dns.servers entry
+func describeDNSServer(server map[string]interface{}) string {
+	serverType, _ := server["type"].(string)
+	host, _ := server["server"].(string)
+	if host == "" {
+		return serverType
+	}
+
+	address := host
+	if port, ok := server["server_port"]; ok {
+		address = fmt.Sprintf("%s:%v", host, port)
+	}
+	switch serverType {
+	case "", "udp":
+		return address
+	case "https", "h3":
+		path, _ := server["path"].(string)
+		if path == "" {
+			path = "/dns-query"
+		}
+		return serverType + "://" + address + path
+	default:
+		return serverType + "://" + address
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResolvePreferredDNS(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"  ", "", false},
+		{"cloudflare", "https://1.1.1.1/dns-query", false},
+		{"Quad9", "https://9.9.9.9/dns-query", false},
+		{"8.8.4.4", "8.8.4.4", false},
+		{"2606:4700:4700::1111", "2606:4700:4700::1111", false},
+		{"https://dns.example.com/dns-query", "https://dns.example.com/dns-query", false},
+		{"http://dns.example.com/dns-query", "", true},
+		{"dns.example.com", "", true},
+		{"https:///dns-query", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolvePreferredDNS(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolvePreferredDNS(%q) = %q, %v, want %q (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// testDNSTemplate returns a generator template with a remote, a direct and a tunnel resolver
+func testDNSTemplate() map[string]interface{} {
+	template := testGeneratorTemplate()
+	dns := template["dns"].(map[string]interface{})
+	dns["servers"] = []interface{}{
+		map[string]interface{}{"type": "tls", "tag": "dns-remote", "server": "8.8.8.8", "detour": "proxy"},
+		map[string]interface{}{"type": "udp", "tag": "dns-direct", "server": "77.88.8.8"},
+		map[string]interface{}{"type": "udp", "tag": "dns-office", "server": "10.8.0.1"},
+	}
+	dns["final"] = "dns-remote"
+	return template
+}
+
+func TestPreferredDNSPresetsPerRoutingMode(t *testing.T) {
+	modes := []RoutingMode{RoutingModeBlockedOnly, RoutingModeExceptRussia, RoutingModeAllTraffic}
+	wg := []UserWireGuardConfig{{Tag: "office", DNS: "10.8.0.1", AllowedIPs: []string{"10.8.0.0/24"}}}
+
+	for _, mode := range modes {
+		for _, preset := range DNSPresets {
+			t.Run(string(mode)+"/"+preset.ID, func(t *testing.T) {
+				template := testDNSTemplate()
+				g := newConfigGenerator(testFilterManager(t, "refilter_domains.srs"))
+				if err := g.applyRoutingMode(template, mode, nil, nil, nil); err != nil {
+					t.Fatalf("applyRoutingMode: %v", err)
+				}
+				address, err := ResolvePreferredDNS(preset.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := applyPreferredDNS(template, address, nil, wg); err != nil {
+					t.Fatalf("applyPreferredDNS: %v", err)
+				}
+
+				servers := template["dns"].(map[string]interface{})["servers"].([]interface{})
+				final := servers[0].(map[string]interface{})
+				want, _ := typedDNSServer(preset.Address)
+				if final["type"] != want["type"] || final["server"] != want["server"] {
+					t.Errorf("final resolver = %v, want %s", final, preset.Address)
+				}
+				if final["tag"] != "dns-remote" || final["detour"] != "proxy" {
+					t.Errorf("final resolver = %v, want tag and detour kept", final)
+				}
+				_, byName := final["domain_resolver"]
+				if byName != (preset.ID == "comss") {
+					t.Errorf("domain_resolver set = %v for %s", byName, preset.Address)
+				}
+				if direct := servers[1].(map[string]interface{}); direct["server"] != "77.88.8.8" {
+					t.Errorf("direct resolver = %v, want it kept", direct)
+				}
+				if tunnel := servers[2].(map[string]interface{}); tunnel["server"] != "10.8.0.1" {
+					t.Errorf("tunnel resolver = %v, want it kept", tunnel)
+				}
+			})
+		}
+	}
+}
+
+func TestApplyPreferredDNSKeepsTunnelAndRestoresTemplate(t *testing.T) {
+	wg := []UserWireGuardConfig{{Tag: "office", DNS: "10.8.0.1"}}
+
+	// A tunnel resolver as dns.final is never overridden
+	config := testDNSTemplate()
+	config["dns"].(map[string]interface{})["final"] = "dns-office"
+	if err := applyPreferredDNS(config, "https://1.1.1.1/dns-query", nil, wg); err != nil {
+		t.Fatal(err)
+	}
+	if tunnel := config["dns"].(map[string]interface{})["servers"].([]interface{})[2].(map[string]interface{}); tunnel["server"] != "10.8.0.1" {
+		t.Errorf("tunnel resolver = %v, want it kept", tunnel)
+	}
+
+	// An empty address restores the template entry
+	config = testDNSTemplate()
+	if err := applyPreferredDNS(config, "https://9.9.9.9/dns-query", nil, wg); err != nil {
+		t.Fatal(err)
+	}
+	fallback := map[string]interface{}{"type": "tls", "tag": "dns-remote", "server": "8.8.8.8", "detour": "proxy"}
+	if err := applyPreferredDNS(config, "", fallback, wg); err != nil {
+		t.Fatal(err)
+	}
+	if final := config["dns"].(map[string]interface{})["servers"].([]interface{})[0].(map[string]interface{}); final["server"] != "8.8.8.8" || final["type"] != "tls" {
+		t.Errorf("final resolver = %v, want the template entry", final)
+	}
+}
@@ -0,0 +1,337 @@
+// Package main provides tracking of how WireGuard internal domains are resolved.
+// sing-box debug log lines are matched by query ID to find which DNS server
+// answered each internal domain, and the active config's dns.rules are
+// checked statically for a missing or shadowed corporate DNS rule.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dnsTrackerMaxPending bounds query IDs waiting for their domain or server
+const dnsTrackerMaxPending = 1000
+
+// localDNSTag is the system resolver tag used for internal domains by older configs
+const localDNSTag = "dns-local"
+
+var (
+	// [3805417385 12ms] - query ID and elapsed time of a sing-box log line
+	dnsLogIDPattern = regexp.MustCompile(`\[(\d+) [^\]]*\]`)
+	// dns: match[2] domain_suffix=[.corp] => route(dns-wg-1)
+	dnsLogRoutePattern = regexp.MustCompile(`dns: match\[\d+\].*=> route\(([^)]+)\)`)
+	// dns: exchange example.corp. IN A / dns: lookup domain example.corp
+	dnsLogDomainPattern = regexp.MustCompile(`dns: (?:exchange|lookup domain) ([^\s]+)`)
+	// dns: exchanged example.corp. ... (answer received)
+	dnsLogAnsweredPattern = regexp.MustCompile(`dns: exchanged `)
+)
+
+// dnsQueryTrace collects log lines of one query ID
+type dnsQueryTrace struct {
+	domain string
+	server string
+}
+
+// DNSResolutionTracker counts which DNS server answered internal domains.
+type DNSResolutionTracker struct {
+	suffixes  []string
+	finalTag  string
+	mu        sync.Mutex
+	pending   map[string]*dnsQueryTrace
+	counts    map[string]map[string]int // domain -> server tag -> queries
+	observing bool                      // Saw at least one DNS debug line
+}
+
+// NewDNSResolutionTracker tracks domains ending with suffixes; queries
+// without a matched rule are attributed to finalTag.
+func NewDNSResolutionTracker(suffixes []string, finalTag string) *DNSResolutionTracker {
+	return &DNSResolutionTracker{
+		suffixes: suffixes,
+		finalTag: finalTag,
+		pending:  make(map[string]*dnsQueryTrace),
+		counts:   make(map[string]map[string]int),
+	}
+}
+
+// matchSuffix returns the internal suffix domain belongs to ("" if none)
+func (t *DNSResolutionTracker) matchSuffix(domain string) string {
+	domain = "." + strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, suffix := range t.suffixes {
+		if strings.HasSuffix(domain, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// Observe processes one sing-box log line.
+func (t *DNSResolutionTracker) Observe(line string) {
+	if t == nil || !strings.Contains(line, "dns: ") {
+		return
+	}
+	idMatch := dnsLogIDPattern.FindStringSubmatch(line)
+	if idMatch == nil {
+		return
+	}
+	id := idMatch[1]
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.observing = true
+	trace := t.pending[id]
+	if trace == nil {
+		if len(t.pending) >= dnsTrackerMaxPending {
+			t.pending = make(map[string]*dnsQueryTrace)
+		}
+		trace = &dnsQueryTrace{}
+		t.pending[id] = trace
+	}
+
+	if m := dnsLogRoutePattern.FindStringSubmatch(line); m != nil {
+		trace.server = m[1]
+	} else if m := dnsLogDomainPattern.FindStringSubmatch(line); m != nil && trace.domain == "" {
+		trace.domain = strings.TrimSuffix(strings.ToLower(m[1]), ".")
+	} else if dnsLogAnsweredPattern.MatchString(line) && trace.server == "" {
+		// Answered without a matching rule: the final server was used
+		trace.server = t.finalTag
+	}
+
+	if trace.domain == "" || trace.server == "" {
+		return
+	}
+	delete(t.pending, id)
+
+	if t.matchSuffix(trace.domain) == "" {
+		return
+	}
+	if t.counts[trace.domain] == nil {
+		t.counts[trace.domain] = make(map[string]int)
+	}
+	t.counts[trace.domain][trace.server]++
+}
+
+// Counts returns a copy of per-domain counts by server tag.
+func (t *DNSResolutionTracker) Counts() map[string]map[string]int {
+	result := make(map[string]map[string]int)
+	if t == nil {
+		return result
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for domain, servers := range t.counts {
+		result[domain] = make(map[string]int, len(servers))
+		for tag, n := range servers {
+			result[domain][tag] = n
+		}
+	}
+	return result
+}
+
+// Observing reports whether DNS debug lines were seen (log level is high enough).
+func (t *DNSResolutionTracker) Observing() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.observing
+}
+
+// DNSRuleIssue is a problem with dns.rules for an internal domain.
+type DNSRuleIssue struct {
+	Domain     string                 `json:"domain"`
+	Kind       string                 `json:"kind"` // missing_rule, shadowed_rule, possibly_shadowed
+	Message    string                 `json:"message"`
+	RuleIndex  int                    `json:"rule_index"` // Rule that currently wins (-1 if none)
+	Suggestion map[string]interface{} `json:"suggestion"` // Rule to add, or the rule to move first
+}
+
+// DNS rule issue kinds
+const (
+	DNSIssueMissingRule      = "missing_rule"
+	DNSIssueShadowedRule     = "shadowed_rule"
+	DNSIssuePossiblyShadowed = "possibly_shadowed"
+)
+
+// dnsRuleActionKeys are DNS rule fields that are not match conditions
+var dnsRuleActionKeys = map[string]bool{
+	"action": true, "server": true, "disable_cache": true, "rewrite_ttl": true,
+	"client_subnet": true, "strategy": true,
+}
+
+// dnsRuleMatch tells whether a DNS rule matches domain. maybe is set when the rule
+// has conditions that can't be evaluated statically (rule_set, domain_regex, ...).
+func dnsRuleMatch(rule map[string]interface{}, domain string) (matches bool, maybe bool) {
+	domain = strings.ToLower(domain)
+
+	for _, s := range jsonStrings(rule["domain"]) {
+		if strings.EqualFold(s, domain) {
+			return true, false
+		}
+	}
+	for _, s := range jsonStrings(rule["domain_suffix"]) {
+		if strings.HasSuffix("."+domain, "."+strings.TrimPrefix(strings.ToLower(s), ".")) {
+			return true, false
+		}
+	}
+	for _, s := range jsonStrings(rule["domain_keyword"]) {
+		if strings.Contains(domain, strings.ToLower(s)) {
+			return true, false
+		}
+	}
+
+	for key := range rule {
+		switch {
+		case dnsRuleActionKeys[key]:
+		case key == "domain" || key == "domain_suffix" || key == "domain_keyword":
+		default:
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// jsonStrings returns a decoded JSON string list (or a single string) as []string
+func jsonStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []string:
+		return val
+	case []interface{}:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// corporateDNSTags returns tags of resolvers that may answer internal domains
+func corporateDNSTags(wireGuardConfigs []UserWireGuardConfig) map[string]bool {
+	tags := wireGuardDNSTags(wireGuardConfigs)
+	tags[localDNSTag] = true
+	return tags
+}
+
+// suggestedCorporateTag picks the corporate resolver to suggest for a domain
+func suggestedCorporateTag(config map[string]interface{}, corporate map[string]bool) string {
+	dns, _ := config["dns"].(map[string]interface{})
+	servers, _ := dns["servers"].([]interface{})
+	for _, s := range servers {
+		if server, ok := s.(map[string]interface{}); ok {
+			if tag, _ := server["tag"].(string); corporate[tag] && tag != localDNSTag {
+				return tag
+			}
+		}
+	}
+	return localDNSTag
+}
+
+// CheckInternalDNSRules checks the order of dns.rules for each internal domain
+// suffix: the first matching rule must route to a corporate resolver.
+func CheckInternalDNSRules(config map[string]interface{}, suffixes []string, wireGuardConfigs []UserWireGuardConfig) []DNSRuleIssue {
+	issues := []DNSRuleIssue{}
+	dns, ok := config["dns"].(map[string]interface{})
+	if !ok {
+		return issues
+	}
+	rules, _ := dns["rules"].([]interface{})
+	corporate := corporateDNSTags(wireGuardConfigs)
+
+	for _, suffix := range suffixes {
+		// A representative name under the suffix
+		domain := "host" + suffix
+		if !strings.HasPrefix(suffix, ".") {
+			domain = "host." + suffix
+		}
+
+		winner, maybeBefore, corporateIdx := -1, -1, -1
+		for i, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			matches, maybe := dnsRuleMatch(rule, domain)
+			server, _ := rule["server"].(string)
+			if matches && corporate[server] && corporateIdx < 0 {
+				corporateIdx = i
+			}
+			if maybe && winner < 0 && maybeBefore < 0 && !corporate[server] {
+				maybeBefore = i
+			}
+			if matches && winner < 0 {
+				winner = i
+			}
+		}
+
+		switch {
+		case corporateIdx < 0:
+			issues = append(issues, DNSRuleIssue{
+				Domain:    suffix,
+				Kind:      DNSIssueMissingRule,
+				Message:   fmt.Sprintf("Нет DNS правила, направляющего %s на корпоративный DNS", suffix),
+				RuleIndex: winner,
+				Suggestion: map[string]interface{}{
+					"domain_suffix": []string{suffix},
+					"action":        "route",
+					"server":        suggestedCorporateTag(config, corporate),
+				},
+			})
+		case winner != corporateIdx:
+			server, _ := rules[winner].(map[string]interface{})["server"].(string)
+			issues = append(issues, DNSRuleIssue{
+				Domain: suffix,
+				Kind:   DNSIssueShadowedRule,
+				Message: fmt.Sprintf("Правило #%d (сервер %s) срабатывает раньше корпоративного правила #%d — переместите его в начало",
+					winner, server, corporateIdx),
+				RuleIndex:  winner,
+				Suggestion: rules[corporateIdx].(map[string]interface{}),
+			})
+		case maybeBefore >= 0 && maybeBefore < corporateIdx:
+			server, _ := rules[maybeBefore].(map[string]interface{})["server"].(string)
+			issues = append(issues, DNSRuleIssue{
+				Domain: suffix,
+				Kind:   DNSIssuePossiblyShadowed,
+				Message: fmt.Sprintf("Правило #%d (сервер %s) может перехватить %s раньше корпоративного правила #%d",
+					maybeBefore, server, suffix, corporateIdx),
+				RuleIndex:  maybeBefore,
+				Suggestion: rules[corporateIdx].(map[string]interface{}),
+			})
+		}
+	}
+	return issues
+}
+
+// InternalDomainResolution is the resolution summary of one internal domain.
+type InternalDomainResolution struct {
+	Domain    string         `json:"domain"`
+	Servers   map[string]int `json:"servers"` // Server tag -> queries
+	Misrouted bool           `json:"misrouted"`
+}
+
+// BuildResolutionReport summarizes tracker counts; a domain is misrouted when
+// any query was answered by a non-corporate resolver.
+func BuildResolutionReport(counts map[string]map[string]int, wireGuardConfigs []UserWireGuardConfig) []InternalDomainResolution {
+	corporate := corporateDNSTags(wireGuardConfigs)
+	report := make([]InternalDomainResolution, 0, len(counts))
+	for domain, servers := range counts {
+		entry := InternalDomainResolution{Domain: domain, Servers: servers}
+		for tag := range servers {
+			if !corporate[tag] {
+				entry.Misrouted = true
+			}
+		}
+		report = append(report, entry)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Domain < report[j].Domain })
+	return report
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadDNSFixture reads a sing-box config from testdata
+func loadDNSFixture(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return config
+}
+
+func TestCheckInternalDNSRules(t *testing.T) {
+	office := []UserWireGuardConfig{{Tag: "office", DNS: "10.8.0.1"}}
+	generated := []UserWireGuardConfig{{Tag: "wg-office", DNS: "10.8.0.1"}}
+
+	type issue struct {
+		domain    string
+		kind      string
+		ruleIndex int
+		server    string // Server of the suggested rule
+	}
+	tests := []struct {
+		fixture  string
+		suffixes []string
+		wg       []UserWireGuardConfig
+		want     []issue
+	}{
+		{"dns_rules/correct.json", []string{".corp.local", ".office.local", "local"}, office, nil},
+		{"dns_rules/system_resolver.json", []string{".corp.local"}, nil, nil},
+		{
+			"dns_rules/missing_rule.json", []string{".corp.local", ".lan"}, office,
+			[]issue{
+				{".corp.local", DNSIssueMissingRule, -1, "dns-office"},
+				{".lan", DNSIssueMissingRule, 0, "dns-office"},
+			},
+		},
+		{
+			"dns_rules/missing_rule.json", []string{".corp.local"}, nil,
+			[]issue{{".corp.local", DNSIssueMissingRule, -1, localDNSTag}},
+		},
+		{
+			"dns_rules/shadowed_rule.json", []string{".corp.local", ".other.local"}, office,
+			[]issue{
+				{".corp.local", DNSIssueShadowedRule, 0, "dns-office"},
+				{".other.local", DNSIssueMissingRule, 0, "dns-office"},
+			},
+		},
+		{
+			"dns_rules/shadowed_by_keyword.json", []string{"corp.local"}, office,
+			[]issue{{"corp.local", DNSIssueShadowedRule, 0, "dns-office"}},
+		},
+		{
+			"dns_rules/possibly_shadowed.json", []string{".corp.local"}, office,
+			[]issue{{".corp.local", DNSIssuePossiblyShadowed, 0, "dns-office"}},
+		},
+		// Configs the generator writes must pass their own check
+		{"config_golden/all_traffic_wireguard.json", []string{".corp.example", ".vpn.corp.example", ".wg-office.local"}, generated, nil},
+		{"config_golden/blocked_only_wireguard.json", []string{".corp.example", ".local", ".internal"}, generated, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			issues := CheckInternalDNSRules(loadDNSFixture(t, tt.fixture), tt.suffixes, tt.wg)
+			if len(issues) != len(tt.want) {
+				t.Fatalf("issues = %+v, want %d", issues, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := issues[i]
+				if got.Domain != want.domain || got.Kind != want.kind || got.RuleIndex != want.ruleIndex {
+					t.Errorf("issue %d = %s %s at rule %d, want %s %s at rule %d",
+						i, got.Domain, got.Kind, got.RuleIndex, want.domain, want.kind, want.ruleIndex)
+				}
+				if server, _ := got.Suggestion["server"].(string); server != want.server {
+					t.Errorf("issue %d suggests server %q, want %q", i, server, want.server)
+				}
+				if got.Message == "" {
+					t.Errorf("issue %d has no message", i)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckInternalDNSRulesWithoutDNS(t *testing.T) {
+	issues := CheckInternalDNSRules(map[string]interface{}{}, []string{".corp.local"}, nil)
+	if issues == nil || len(issues) != 0 {
+		t.Errorf("issues = %#v, want an empty list", issues)
+	}
+}
+
+func TestDNSRuleMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		matches bool
+		maybe   bool
+	}{
+		{"exact domain", `{"domain":["Host.Corp.Local"],"server":"remote"}`, true, false},
+		{"other domain", `{"domain":["wiki.corp.local"],"server":"remote"}`, false, false},
+		{"suffix with dot", `{"domain_suffix":[".corp.local"],"server":"remote"}`, true, false},
+		{"suffix without dot", `{"domain_suffix":["corp.local"],"server":"remote"}`, true, false},
+		{"suffix on a label boundary only", `{"domain_suffix":["p.local"],"server":"remote"}`, false, false},
+		{"single string suffix", `{"domain_suffix":".local","server":"remote"}`, true, false},
+		{"keyword", `{"domain_keyword":["corp"],"server":"remote"}`, true, false},
+		{"rule set", `{"rule_set":["geosite-ru"],"server":"local"}`, false, true},
+		{"regex", `{"domain_regex":["^host\\."],"server":"local"}`, false, true},
+		{"action only", `{"action":"route","server":"remote","disable_cache":true}`, false, false},
+		{"suffix wins over rule set", `{"domain_suffix":[".local"],"rule_set":["geosite-ru"],"server":"remote"}`, true, false},
+	}
+
+	for _, tt := range tests {
+		var rule map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.rule), &rule); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		matches, maybe := dnsRuleMatch(rule, "host.corp.local")
+		if matches != tt.matches || maybe != tt.maybe {
+			t.Errorf("%s: dnsRuleMatch = %v, %v; want %v, %v", tt.name, matches, maybe, tt.matches, tt.maybe)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package main provides the download route of KampusVPN.
+// Filter and update downloads go to GitHub, which is often throttled on the
+// networks this app is for. While sing-box runs they go through a local mixed
+// inbound routed to the "proxy" selector; otherwise (or when the user forces
+// it) they go direct. Results report the route so failures can be diagnosed.
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Download routes
+const (
+	DownloadRouteProxy  = "proxy"  // Through the download inbound of the running sing-box
+	DownloadRouteDirect = "direct" // Without the app's proxy
+)
+
+// downloadInboundTag is the tag of the local inbound used for app downloads
+const downloadInboundTag = "download-in"
+
+// downloadProxyPort is the port of the download inbound of the running
+// sing-box (0 = not running or downloads forced direct)
+var downloadProxyPort atomic.Int32
+
+// setDownloadProxyPort points app downloads at the download inbound (0 = direct)
+func setDownloadProxyPort(port int) {
+	downloadProxyPort.Store(int32(port))
+}
+
+// currentDownloadRoute returns the route new downloads take
+func currentDownloadRoute() string {
+	if downloadProxyPort.Load() != 0 {
+		return DownloadRouteProxy
+	}
+	return DownloadRouteDirect
+}
+
+// newDownloadClient returns an HTTP client for app downloads and its route
+func newDownloadClient(timeout time.Duration) (*http.Client, string) {
+	port := int(downloadProxyPort.Load())
+	if port == 0 {
+		return &http.Client{Timeout: timeout}, DownloadRouteDirect
+	}
+	proxyURL := &url.URL{Scheme: "http", Host: net.JoinHostPort(proxyInboundListen, strconv.Itoa(port))}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}, DownloadRouteProxy
+}
+
+// pickLocalInboundPort returns a free local port for an app-only inbound
+func pickLocalInboundPort() (int, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(proxyInboundListen, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// applyLocalProxyInbound adds a localhost mixed inbound whose traffic always
+// goes to the "proxy" selector, whatever the routing mode (port 0 = no inbound)
+func applyLocalProxyInbound(config map[string]interface{}, tag string, port int) {
+	if port == 0 {
+		return
+	}
+	inbounds, _ := config["inbounds"].([]interface{})
+	config["inbounds"] = append(inbounds, map[string]interface{}{
+		"type":        "mixed",
+		"tag":         tag,
+		"listen":      proxyInboundListen,
+		"listen_port": port,
+	})
+	insertRuleAfterSniff(config, map[string]interface{}{
+		"inbound":  []string{tag},
+		"outbound": ConnectMeasureSelector,
+	})
+}
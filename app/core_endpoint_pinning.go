@@ -0,0 +1,341 @@
+// Package main provides endpoint pinning for KampusVPN.
+// When the resolver sing-box uses for proxy hostnames is poisoned, the
+// connection fails although the server works by IP. With pinning on, a
+// profile's proxy hostnames are resolved through a trusted DoH resolver at
+// build time and the outbounds connect to the IP, keeping the hostname as
+// TLS server name (and transport Host) so certificates still validate.
+// The last resolved IPs are kept as a fallback for when DoH fails.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint pinning settings
+const (
+	// DefaultPinningResolver is the DoH resolver used when settings don't set one.
+	DefaultPinningResolver = "https://1.1.1.1/dns-query"
+	// PinningResolveTimeout bounds resolving one hostname.
+	PinningResolveTimeout = 5 * time.Second
+	// pinningWorkers is how many hostnames are resolved at once.
+	pinningWorkers = 8
+)
+
+// DNS record types queried for pinning
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// EndpointPinResult describes what pinning did to a build.
+type EndpointPinResult struct {
+	Pinned  map[string][]string // Hostname -> IPs written to the config
+	Stale   []string            // DoH failed, the previous IPs were used
+	Failed  []string            // DoH failed without previous IPs, the hostname was kept
+	Changed []string            // None of the previous IPs were returned any more
+}
+
+// ValidatePinningResolver checks a DoH resolver: preset ID or https:// URL ("" = default).
+func ValidatePinningResolver(value string) (string, error) {
+	address, err := ResolvePreferredDNS(value)
+	if err != nil {
+		return "", err
+	}
+	if address != "" && !strings.HasPrefix(address, "https://") {
+		return "", fmt.Errorf("нужен DoH-адрес вида https://host/dns-query")
+	}
+	return address, nil
+}
+
+// newPinningClient returns a client that reaches the resolver directly
+func newPinningClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return &http.Client{Timeout: PinningResolveTimeout, Transport: transport}
+}
+
+// resolveDoH resolves host through an RFC 8484 resolver: A records, or AAAA
+// records when the host has no IPv4 address
+func resolveDoH(client *http.Client, resolverURL, host string) ([]string, error) {
+	ips, err := queryDoH(client, resolverURL, host, dnsTypeA)
+	if err != nil || len(ips) > 0 {
+		return ips, err
+	}
+	return queryDoH(client, resolverURL, host, dnsTypeAAAA)
+}
+
+// queryDoH sends one DNS query over HTTPS and returns the addresses of the answer
+func queryDoH(client *http.Client, resolverURL, host string, qtype uint16) ([]string, error) {
+	query, err := buildDNSQuery(host, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PinningResolveTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resolverURL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH status %d", resp.StatusCode)
+	}
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSAnswers(msg, qtype)
+}
+
+// buildDNSQuery encodes a recursive query for host (ID 0 as RFC 8484 recommends)
+func buildDNSQuery(host string, qtype uint16) ([]byte, error) {
+	msg := []byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid hostname %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // IN
+	return msg, nil
+}
+
+// parseDNSAnswers returns the addresses of qtype records in a DNS response
+func parseDNSAnswers(msg []byte, qtype uint16) ([]string, error) {
+	if len(msg) < 12 {
+		return nil, fmt.Errorf("DNS response too short")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case 3:
+		return nil, fmt.Errorf("no such host")
+	default:
+		return nil, fmt.Errorf("DNS error code %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:6]))
+	answers := int(binary.BigEndian.Uint16(msg[6:8]))
+
+	off := 12
+	for i := 0; i < questions; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+4 > len(msg) {
+			return nil, fmt.Errorf("malformed DNS response")
+		}
+		off += 4
+	}
+
+	var ips []string
+	for i := 0; i < answers; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+10 > len(msg) {
+			return nil, fmt.Errorf("malformed DNS response")
+		}
+		rtype := binary.BigEndian.Uint16(msg[off : off+2])
+		length := int(binary.BigEndian.Uint16(msg[off+8 : off+10]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, fmt.Errorf("malformed DNS response")
+		}
+		// CNAME records come first and are skipped, the addresses follow them
+		if rtype == qtype && (length == net.IPv4len || length == net.IPv6len) {
+			ips = append(ips, net.IP(msg[off:off+length]).String())
+		}
+		off += length
+	}
+	return ips, nil
+}
+
+// skipDNSName returns the offset after a (possibly compressed) name
+func skipDNSName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			return off + 1, true
+		case length&0xc0 == 0xc0:
+			return off + 2, off+2 <= len(msg)
+		default:
+			off += 1 + length
+		}
+	}
+	return 0, false
+}
+
+// pinProxyEndpoints resolves the hostnames of proxies and points them at the
+// IPs. previous holds the IPs of the last build, used when resolving fails.
+func pinProxyEndpoints(proxies []ProxyConfig, previous map[string][]string, resolve func(host string) ([]string, error)) ([]ProxyConfig, EndpointPinResult) {
+	result := EndpointPinResult{Pinned: map[string][]string{}}
+
+	hosts := map[string]bool{}
+	for _, p := range proxies {
+		if host := strings.Trim(p.Server, "[]"); host != "" && net.ParseIP(host) == nil {
+			hosts[strings.ToLower(host)] = true
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, pinningWorkers)
+	for host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ips, err := resolve(host)
+			mu.Lock()
+			defer mu.Unlock()
+			old := previous[host]
+			switch {
+			case err == nil && len(ips) > 0:
+				result.Pinned[host] = ips
+				if len(old) > 0 && !sharesAddress(old, ips) {
+					result.Changed = append(result.Changed, host)
+				}
+			case len(old) > 0:
+				result.Pinned[host] = old
+				result.Stale = append(result.Stale, host)
+			default:
+				result.Failed = append(result.Failed, host)
+			}
+		}(host)
+	}
+	wg.Wait()
+	sort.Strings(result.Stale)
+	sort.Strings(result.Failed)
+	sort.Strings(result.Changed)
+
+	pinned := make([]ProxyConfig, len(proxies))
+	for i, p := range proxies {
+		host := strings.ToLower(strings.Trim(p.Server, "[]"))
+		if ips, ok := result.Pinned[host]; ok {
+			p = pinProxy(p, host, ips)
+		}
+		pinned[i] = p
+	}
+	return pinned, result
+}
+
+// pinProxy points a proxy at the first IP, keeping the hostname where the
+// server sees it: the TLS server name and the HTTP transport Host
+func pinProxy(p ProxyConfig, host string, ips []string) ProxyConfig {
+	if p.SNI == "" {
+		p.SNI = host
+	}
+	switch p.Network {
+	case "ws", "httpupgrade", "http", "h2":
+		if p.Host == "" {
+			p.Host = host
+		}
+	}
+	p.PinnedHost = host
+	p.ServerIPs = ips
+	p.Server = ips[0]
+	return p
+}
+
+// sharesAddress reports whether two address lists have an address in common
+func sharesAddress(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endpointPinningWarning reports hostnames that couldn't be resolved; ok is false when all were
+func endpointPinningWarning(result EndpointPinResult) (BuildWarning, bool) {
+	if len(result.Stale) == 0 && len(result.Failed) == 0 && len(result.Changed) == 0 {
+		return BuildWarning{}, false
+	}
+	var parts []string
+	context := map[string]string{}
+	if len(result.Stale) > 0 {
+		parts = append(parts, fmt.Sprintf("DoH не ответил, использованы прежние адреса: %s", strings.Join(result.Stale, ", ")))
+		context["stale"] = strings.Join(result.Stale, ",")
+	}
+	if len(result.Failed) > 0 {
+		parts = append(parts, fmt.Sprintf("не удалось закрепить адрес: %s", strings.Join(result.Failed, ", ")))
+		context["failed"] = strings.Join(result.Failed, ",")
+	}
+	if len(result.Changed) > 0 {
+		parts = append(parts, fmt.Sprintf("прежние адреса больше не действуют: %s", strings.Join(result.Changed, ", ")))
+		context["changed"] = strings.Join(result.Changed, ",")
+	}
+	warning := NewBuildWarning(WarnEndpointPinning, "Закрепление адресов серверов: "+strings.Join(parts, "; "), context)
+	if len(result.Stale) == 0 && len(result.Failed) == 0 {
+		warning.Severity = WarningSeverityInfo
+	}
+	return warning, true
+}
+
+// pinningResolverHost returns the resolver host for logs
+func pinningResolverHost(resolverURL string) string {
+	if u, err := url.Parse(resolverURL); err == nil {
+		return u.Host
+	}
+	return resolverURL
+}
+
+// --- Storage ---
+
+// SetProfileEndpointPinning enables or disables endpoint pinning of a profile.
+// Turning it off forgets the pinned IPs.
+func (s *Storage) SetProfileEndpointPinning(id int, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].PinEndpoints = enabled
+			if !enabled {
+				s.data.Profiles[i].PinnedEndpoints = nil
+			}
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// setProfilePinnedEndpoints saves the IPs pinned by a build.
+func (s *Storage) setProfilePinnedEndpoints(id int, pinned map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			if len(pinned) == 0 {
+				pinned = nil
+			}
+			s.data.Profiles[i].PinnedEndpoints = pinned
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
@@ -0,0 +1,157 @@
+// Package main provides passphrase encryption of profile exports for KampusVPN.
+// An export holds WireGuard private keys and proxy passwords. With a passphrase
+// the export JSON is sealed with AES-256-GCM under a scrypt-derived key and
+// wrapped in an envelope that import recognizes before parsing profiles.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptedExportFormat marks an encrypted export envelope
+const EncryptedExportFormat = "kampus-encrypted-v1"
+
+// scrypt parameters of new exports (stored in the envelope, so they may change)
+const (
+	exportScryptN   = 1 << 15
+	exportScryptR   = 8
+	exportScryptP   = 1
+	exportSaltSize  = 16
+	exportKeyLength = 32 // AES-256
+)
+
+// Accepted scrypt parameters of imported envelopes. The file is untrusted:
+// without limits a crafted N and r make key derivation allocate gigabytes.
+const (
+	exportScryptMaxN      = 1 << 20
+	exportScryptMaxR      = 16
+	exportScryptMaxP      = 4
+	exportScryptMaxMemory = 256 << 20 // 128*N*r bytes
+	exportMaxSaltSize     = 64
+)
+
+// ErrWrongPassphrase is returned when the envelope doesn't open with the passphrase.
+// GCM can't tell a wrong passphrase from a damaged file.
+var ErrWrongPassphrase = errors.New("неверный пароль или файл повреждён")
+
+// EncryptedExport is the envelope of an encrypted export file.
+// Byte fields are base64 in JSON.
+type EncryptedExport struct {
+	Format     string `json:"format"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// IsEncryptedExport reports whether data is an encrypted export envelope
+func IsEncryptedExport(data []byte) bool {
+	var probe struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Format == EncryptedExportFormat
+}
+
+// exportCipher derives the key from passphrase and returns the AEAD
+func exportCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, exportKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения ключа: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptExport seals plaintext export JSON into an envelope
+func EncryptExport(plaintext []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("пустой пароль")
+	}
+
+	envelope := EncryptedExport{
+		Format: EncryptedExportFormat,
+		KDF:    "scrypt",
+		N:      exportScryptN,
+		R:      exportScryptR,
+		P:      exportScryptP,
+		Salt:   make([]byte, exportSaltSize),
+	}
+	if _, err := rand.Read(envelope.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := exportCipher(passphrase, envelope.Salt, envelope.N, envelope.R, envelope.P)
+	if err != nil {
+		return nil, err
+	}
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(envelope.Nonce); err != nil {
+		return nil, err
+	}
+	// The format is authenticated too, so the envelope can't be relabeled
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, plaintext, []byte(EncryptedExportFormat))
+
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+// DecryptExport opens an envelope and returns the export JSON.
+// A wrong passphrase returns ErrWrongPassphrase.
+func DecryptExport(data []byte, passphrase string) ([]byte, error) {
+	var envelope EncryptedExport
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("неверный формат зашифрованного файла: %w", err)
+	}
+	if envelope.Format != EncryptedExportFormat {
+		return nil, fmt.Errorf("неподдерживаемый формат: %s", envelope.Format)
+	}
+	if envelope.KDF != "scrypt" {
+		return nil, fmt.Errorf("неподдерживаемый KDF: %s", envelope.KDF)
+	}
+	if err := validateExportKDF(envelope); err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("файл зашифрован, введите пароль")
+	}
+
+	aead, err := exportCipher(passphrase, envelope.Salt, envelope.N, envelope.R, envelope.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("неверный формат зашифрованного файла: nonce %d байт", len(envelope.Nonce))
+	}
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, []byte(EncryptedExportFormat))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// validateExportKDF checks the key derivation parameters of an envelope
+// before they are used
+func validateExportKDF(envelope EncryptedExport) error {
+	n, r, p := envelope.N, envelope.R, envelope.P
+	if n < 2 || n > exportScryptMaxN || n&(n-1) != 0 ||
+		r < 1 || r > exportScryptMaxR || p < 1 || p > exportScryptMaxP ||
+		128*n*r > exportScryptMaxMemory {
+		return fmt.Errorf("неподдерживаемые параметры scrypt: N=%d, r=%d, p=%d", n, r, p)
+	}
+	if len(envelope.Salt) < exportSaltSize || len(envelope.Salt) > exportMaxSaltSize {
+		return fmt.Errorf("неверный формат зашифрованного файла: соль %d байт", len(envelope.Salt))
+	}
+	return nil
+}
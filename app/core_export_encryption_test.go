@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestExportEncryptionRoundTrip(t *testing.T) {
+	plaintext := []byte(`{"profiles":[{"name":"Work"}]}`)
+
+	sealed, err := EncryptExport(plaintext, "correct horse")
+	if err != nil {
+		t.Fatalf("EncryptExport: %v", err)
+	}
+	if !IsEncryptedExport(sealed) {
+		t.Fatal("IsEncryptedExport = false for an envelope")
+	}
+	if IsEncryptedExport(plaintext) {
+		t.Error("IsEncryptedExport = true for plain export JSON")
+	}
+
+	opened, err := DecryptExport(sealed, "correct horse")
+	if err != nil {
+		t.Fatalf("DecryptExport: %v", err)
+	}
+	if string(opened) != string(plaintext) {
+		t.Errorf("DecryptExport = %s, want %s", opened, plaintext)
+	}
+
+	if _, err := DecryptExport(sealed, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := DecryptExport(sealed, ""); err == nil {
+		t.Error("empty passphrase accepted")
+	}
+	if _, err := EncryptExport(plaintext, ""); err == nil {
+		t.Error("EncryptExport accepted an empty passphrase")
+	}
+}
+
+func TestDecryptExportRejectsEnvelope(t *testing.T) {
+	sealed, err := EncryptExport([]byte(`{}`), "secret")
+	if err != nil {
+		t.Fatalf("EncryptExport: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(e *EncryptedExport)
+	}{
+		{"huge N", func(e *EncryptedExport) { e.N = 1 << 30 }},
+		{"N not power of two", func(e *EncryptedExport) { e.N = 1<<15 + 1 }},
+		{"zero N", func(e *EncryptedExport) { e.N = 0 }},
+		{"huge r", func(e *EncryptedExport) { e.R = 1 << 10 }},
+		{"memory over limit", func(e *EncryptedExport) { e.N, e.R = 1<<20, 16 }},
+		{"zero r", func(e *EncryptedExport) { e.R = 0 }},
+		{"huge p", func(e *EncryptedExport) { e.P = 1 << 20 }},
+		{"negative p", func(e *EncryptedExport) { e.P = -1 }},
+		{"short salt", func(e *EncryptedExport) { e.Salt = []byte{1, 2, 3} }},
+		{"no salt", func(e *EncryptedExport) { e.Salt = nil }},
+		{"long salt", func(e *EncryptedExport) { e.Salt = make([]byte, 1<<20) }},
+		{"other KDF", func(e *EncryptedExport) { e.KDF = "argon2id" }},
+		{"short nonce", func(e *EncryptedExport) { e.Nonce = e.Nonce[:4] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var envelope EncryptedExport
+			if err := json.Unmarshal(sealed, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&envelope)
+			data, err := json.Marshal(envelope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DecryptExport(data, "secret"); err == nil {
+				t.Error("envelope accepted, want rejected")
+			}
+		})
+	}
+}
+
+func TestDecryptExportTamperedCiphertext(t *testing.T) {
+	sealed, err := EncryptExport([]byte(`{"profiles":[]}`), "secret")
+	if err != nil {
+		t.Fatalf("EncryptExport: %v", err)
+	}
+	var envelope EncryptedExport
+	if err := json.Unmarshal(sealed, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	envelope.Ciphertext[0] ^= 0xff
+	data, _ := json.Marshal(envelope)
+
+	if _, err := DecryptExport(data, "secret"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("tampered ciphertext: err = %v, want ErrWrongPassphrase", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package main provides filter sources of KampusVPN.
+// Re:filter publishes compiled .srs rule-sets, the community and Discord
+// lists are plain .lst files (one domain or CIDR per line). A .lst download
+// is compiled into .srs with the bundled sing-box before validation.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Filter kinds: what the lines of a .lst source contain
+const (
+	FilterKindDomain = "domain"
+	FilterKindIP     = "ip"
+)
+
+// Filter source limits
+const (
+	FilterCompileTimeout = 30 * time.Second
+	// filterSourceVersion is the sing-box rule-set source format version
+	filterSourceVersion = 2
+)
+
+// filterSourceIsList reports whether a source URL points at a .lst list
+// rather than a compiled .srs rule-set
+func filterSourceIsList(sourceURL string) bool {
+	if u, err := url.Parse(sourceURL); err == nil {
+		sourceURL = u.Path
+	}
+	return !strings.EqualFold(path.Ext(sourceURL), ".srs")
+}
+
+// ValidateFilterSourceURL checks a user-supplied filter source URL
+func ValidateFilterSourceURL(sourceURL string) error {
+	u, err := url.Parse(sourceURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("некорректный URL")
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("поддерживаются только http и https")
+	}
+	return nil
+}
+
+// findFilterFile returns the FilterFiles entry of a file name
+func findFilterFile(filename string) (FilterFileSpec, bool) {
+	for _, f := range FilterFiles {
+		if f.Name == filename {
+			return f, true
+		}
+	}
+	return FilterFileSpec{}, false
+}
+
+// parseFilterList extracts the entries of a .lst file. Comments, blank
+// lines and lines that aren't a domain or CIDR are skipped; a list without
+// a single entry (or an HTML error page) is rejected.
+func parseFilterList(data []byte, kind string) ([]string, error) {
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "<") {
+		return nil, fmt.Errorf("got an HTML page instead of a list")
+	}
+
+	seen := make(map[string]bool)
+	var entries []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		var entry string
+		switch kind {
+		case FilterKindIP:
+			entry = normalizeFilterCIDR(line)
+		default:
+			entry = normalizeFilterDomain(line)
+		}
+		if entry == "" || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("list has no %s entries", kind)
+	}
+	return entries, nil
+}
+
+// normalizeFilterCIDR returns a CIDR for a list line ("" if it isn't an IP)
+func normalizeFilterCIDR(line string) string {
+	if _, network, err := net.ParseCIDR(line); err == nil {
+		return network.String()
+	}
+	ip := net.ParseIP(line)
+	if ip == nil {
+		return ""
+	}
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+// normalizeFilterDomain returns a lowercase domain for a list line ("" if it isn't one)
+func normalizeFilterDomain(line string) string {
+	domain := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(line, "*"), "."))
+	if !strings.Contains(domain, ".") || len(domain) > 253 {
+		return ""
+	}
+	for _, r := range domain {
+		if !((r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '.') {
+			return ""
+		}
+	}
+	return domain
+}
+
+// compileFilterList compiles a downloaded .lst into a binary rule-set with
+// the bundled sing-box. Returns the number of entries.
+func (fm *FilterManager) compileFilterList(listPath, kind, destPath string) (int, error) {
+	if fm.singboxPath == "" || !fileExists(fm.singboxPath) {
+		return 0, fmt.Errorf("sing-box unavailable, can't compile list")
+	}
+
+	data, err := os.ReadFile(listPath)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := parseFilterList(data, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	rule := map[string]interface{}{}
+	if kind == FilterKindIP {
+		rule["ip_cidr"] = entries
+	} else {
+		rule["domain_suffix"] = entries
+	}
+	source, err := json.Marshal(map[string]interface{}{
+		"version": filterSourceVersion,
+		"rules":   []interface{}{rule},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sourcePath := destPath + ".json"
+	defer os.Remove(sourcePath)
+	if err := os.WriteFile(sourcePath, source, 0644); err != nil {
+		return 0, err
+	}
+
+	output, err := fm.runCommand(FilterCompileTimeout, fm.singboxPath,
+		"rule-set", "compile", "--output", destPath, sourcePath)
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return 0, fmt.Errorf("sing-box failed to compile list: %s", msg)
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,127 @@
+// Package main provides validation of downloaded filter rule-sets.
+// A new .srs file replaces the old one only after sing-box parsed it,
+// so a truncated or incompatible download can't break the next connect.
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Filter validation limits
+const (
+	MinFilterFileSize     = 1024             // Smaller downloads are error pages or truncated
+	MaxFilterFileSize     = 50 * 1024 * 1024 // Larger downloads are not rule-sets
+	FilterValidateTimeout = 15 * time.Second
+)
+
+// Parse outcomes of a downloaded filter
+const (
+	FilterParsedVerified   = "verified"   // sing-box parsed the rule-set
+	FilterParsedUnverified = "unverified" // sing-box unavailable, only magic bytes checked
+	FilterParsedFailed     = "failed"
+)
+
+// srsMagic starts every binary sing-box rule-set
+var srsMagic = []byte("SRS")
+
+// FilterUpdateResult is the outcome of updating one filter file.
+type FilterUpdateResult struct {
+	File    string `json:"file"`
+	Updated bool   `json:"updated"`          // New file replaced the old one
+	Parsed  string `json:"parsed,omitempty"` // verified, unverified or failed
+	SizeKB  int    `json:"size_kb"`
+	Error   string `json:"error,omitempty"`
+	Route   string `json:"route,omitempty"`   // DownloadRouteProxy or DownloadRouteDirect
+	Source  string `json:"source,omitempty"`  // URL the file was downloaded from
+	Entries int    `json:"entries,omitempty"` // Entries of a compiled .lst source
+}
+
+// commandRunner runs an external command with a timeout and returns its combined output
+type commandRunner func(timeout time.Duration, name string, args ...string) ([]byte, error)
+
+// runHiddenCommand runs a command without a console window
+func runHiddenCommand(timeout time.Duration, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("timed out after %v", timeout)
+	}
+	return output, err
+}
+
+// checkFilterSize rejects files that can't be a real rule-set
+func checkFilterSize(size int64) error {
+	if size < MinFilterFileSize {
+		return fmt.Errorf("file too small (%d bytes)", size)
+	}
+	if size > MaxFilterFileSize {
+		return fmt.Errorf("file too large (%d MB)", size/1024/1024)
+	}
+	return nil
+}
+
+// ValidateFilterFile checks a downloaded .srs file: size first, then a full
+// parse by sing-box, falling back to the magic bytes when sing-box is unavailable.
+// Returns the parse outcome.
+func (fm *FilterManager) ValidateFilterFile(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return FilterParsedFailed, err
+	}
+	if err := checkFilterSize(stat.Size()); err != nil {
+		return FilterParsedFailed, err
+	}
+	return fm.parseRuleSet(path)
+}
+
+// parseRuleSet has sing-box parse a binary rule-set, falling back to the
+// magic bytes when sing-box is unavailable. Returns the parse outcome.
+func (fm *FilterManager) parseRuleSet(path string) (string, error) {
+	if fm.singboxPath == "" || !fileExists(fm.singboxPath) {
+		if err := checkSRSMagic(path); err != nil {
+			return FilterParsedFailed, err
+		}
+		return FilterParsedUnverified, nil
+	}
+
+	// match forces a full parse; whether the domain matches doesn't matter
+	output, err := fm.runCommand(FilterValidateTimeout, fm.singboxPath,
+		"rule-set", "match", "--format", "binary", path, "example.com")
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return FilterParsedFailed, fmt.Errorf("sing-box rejected rule-set: %s", msg)
+	}
+	return FilterParsedVerified, nil
+}
+
+// checkSRSMagic verifies the binary rule-set header
+func checkSRSMagic(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(srsMagic))
+	if _, err := f.Read(header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if !bytes.Equal(header, srsMagic) {
+		return fmt.Errorf("not a binary rule-set (bad magic bytes)")
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRuleSetParser stands in for "sing-box rule-set match": it reads the
+// rule-set header and inflates the body, failing like sing-box on a broken file
+func fakeRuleSetParser(t *testing.T, calls *int) commandRunner {
+	return func(timeout time.Duration, name string, args ...string) ([]byte, error) {
+		*calls++
+		if len(args) != 6 || args[0] != "rule-set" || args[1] != "match" || args[3] != "binary" {
+			t.Errorf("sing-box called with %v", args)
+		}
+		data, err := os.ReadFile(args[4])
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 4 || !bytes.HasPrefix(data, srsMagic) {
+			return []byte("FATAL[0000] read rule-set: invalid sing-box rule-set file"), errors.New("exit status 1")
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data[4:]))
+		if err == nil {
+			_, err = io.Copy(io.Discard, r)
+		}
+		if err != nil {
+			return []byte("FATAL[0000] read rule-set: " + err.Error()), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+}
+
+// validatingFilterManager returns a filter manager with a sing-box binary (when
+// withSingbox) that is run through fakeRuleSetParser
+func validatingFilterManager(t *testing.T, withSingbox bool) (*FilterManager, *int) {
+	t.Helper()
+	base := t.TempDir()
+	fm := NewFilterManager(base)
+	calls := new(int)
+	fm.runCommand = fakeRuleSetParser(t, calls)
+	if withSingbox {
+		singbox := filepath.Join(base, "sing-box.exe")
+		if err := os.WriteFile(singbox, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+		fm.SetSingboxPath(singbox)
+	} else {
+		fm.SetSingboxPath(filepath.Join(base, "missing", "sing-box.exe"))
+	}
+	return fm, calls
+}
+
+func TestValidateFilterFile(t *testing.T) {
+	valid, err := os.ReadFile("testdata/filters/valid.srs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiny := filepath.Join(t.TempDir(), "tiny.srs")
+	if err := os.WriteFile(tiny, valid[:512], 0644); err != nil {
+		t.Fatal(err)
+	}
+	huge := filepath.Join(t.TempDir(), "huge.srs")
+	if err := os.WriteFile(huge, valid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(huge, MaxFilterFileSize+1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		singbox    bool
+		parsed     string
+		errText    string
+		runsBinary bool
+	}{
+		{"valid", "testdata/filters/valid.srs", true, FilterParsedVerified, "", true},
+		{"truncated", "testdata/filters/corrupt.srs", true, FilterParsedFailed, "unexpected EOF", true},
+		{"error page", "testdata/filters/not_srs.srs", true, FilterParsedFailed, "invalid sing-box rule-set", true},
+		{"too small", tiny, true, FilterParsedFailed, "too small", false},
+		{"too large", huge, true, FilterParsedFailed, "too large", false},
+		{"missing", "testdata/filters/absent.srs", true, FilterParsedFailed, "", false},
+		{"valid without sing-box", "testdata/filters/valid.srs", false, FilterParsedUnverified, "", false},
+		// Only the header is checked without sing-box: a truncated body passes
+		{"truncated without sing-box", "testdata/filters/corrupt.srs", false, FilterParsedUnverified, "", false},
+		{"error page without sing-box", "testdata/filters/not_srs.srs", false, FilterParsedFailed, "bad magic bytes", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, calls := validatingFilterManager(t, tt.singbox)
+			parsed, err := fm.ValidateFilterFile(tt.path)
+			if parsed != tt.parsed {
+				t.Errorf("parsed = %s, want %s (error %v)", parsed, tt.parsed, err)
+			}
+			if (err != nil) != (tt.parsed == FilterParsedFailed) {
+				t.Errorf("error = %v with parsed %s", err, parsed)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.errText)
+			}
+			if (*calls > 0) != tt.runsBinary {
+				t.Errorf("sing-box runs = %d, want run %v", *calls, tt.runsBinary)
+			}
+		})
+	}
+}
+
+func TestParseRuleSetRunnerErrorWithoutOutput(t *testing.T) {
+	fm, _ := validatingFilterManager(t, true)
+	fm.runCommand = func(timeout time.Duration, name string, args ...string) ([]byte, error) {
+		if timeout != FilterValidateTimeout {
+			t.Errorf("timeout = %v, want %v", timeout, FilterValidateTimeout)
+		}
+		return nil, errors.New("timed out after 15s")
+	}
+	parsed, err := fm.ValidateFilterFile("testdata/filters/valid.srs")
+	if parsed != FilterParsedFailed || err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("ValidateFilterFile = %s, %v; want failed with the runner error", parsed, err)
+	}
+}
+
+func TestUpdateAllKeepsPreviousFileOnFailure(t *testing.T) {
+	fixtures := map[string]string{
+		"/refilter_domains.srs": "testdata/filters/valid.srs",
+		"/refilter_ips.srs":     "testdata/filters/corrupt.srs",
+		"/discord_ips.srs":      "testdata/filters/not_srs.srs",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, fixtures[r.URL.Path])
+	}))
+	defer server.Close()
+
+	saved := FilterURLs
+	t.Cleanup(func() { FilterURLs = saved })
+	FilterURLs = map[string]string{}
+	for path := range fixtures {
+		FilterURLs[strings.TrimPrefix(path, "/")] = server.URL + path
+	}
+
+	fm, _ := validatingFilterManager(t, true)
+	if err := os.MkdirAll(fm.GetFiltersPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path := range fixtures {
+		if err := os.WriteFile(filepath.Join(fm.GetFiltersPath(), strings.TrimPrefix(path, "/")), []byte("previous"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := fm.UpdateAll()
+	if err != nil {
+		t.Fatalf("UpdateAll: %v", err)
+	}
+
+	want := map[string]struct {
+		updated bool
+		parsed  string
+	}{
+		"refilter_domains.srs": {true, FilterParsedVerified},
+		"refilter_ips.srs":     {false, FilterParsedFailed},
+		"discord_ips.srs":      {false, FilterParsedFailed},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %d", results, len(want))
+	}
+	for _, result := range results {
+		w := want[result.File]
+		if result.Updated != w.updated || result.Parsed != w.parsed || (result.Error == "") != w.updated {
+			t.Errorf("%s: updated %v, parsed %s, error %q; want updated %v, parsed %s",
+				result.File, result.Updated, result.Parsed, result.Error, w.updated, w.parsed)
+		}
+		content, _ := os.ReadFile(filepath.Join(fm.GetFiltersPath(), result.File))
+		if kept := string(content) == "previous"; kept == w.updated {
+			t.Errorf("%s: previous file kept = %v", result.File, kept)
+		}
+		if _, err := os.Stat(filepath.Join(fm.GetFiltersPath(), result.File+".tmp")); !os.IsNotExist(err) {
+			t.Errorf("%s: temp file left behind", result.File)
+		}
+	}
+
+	version, err := fm.LoadVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(version.LastUpdate) != len(want) {
+		t.Errorf("version.json last_update = %+v", version.LastUpdate)
+	}
+	if _, ok := version.Files["refilter_domains"]; !ok || len(version.Files) != 1 {
+		t.Errorf("version.json files = %v, want only the updated file", version.Files)
+	}
+}
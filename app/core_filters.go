@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,18 @@ type FilterVersion struct {
 	UpdatedAt      time.Time `json:"updated_at"`      // When filters were last updated
 	MaxAgeDays     int       `json:"max_age_days"`    // Days before warning (default 30)
 	Sources        []string  `json:"sources"`         // Source URLs for reference
+	
+	Files      map[string]*FilterFileVersion `json:"files,omitempty"`       // Per-file metadata, keyed by name without .srs
+	LastUpdate []FilterUpdateResult          `json:"last_update,omitempty"` // Per-file outcome of the last update
+}
+
+// FilterFileVersion contains metadata about one filter file.
+type FilterFileVersion struct {
+	File        string    `json:"file"`
+	Description string    `json:"description,omitempty"`
+	SourceURL   string    `json:"source_url,omitempty"`
+	Entries     int       `json:"entries,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"` // Zero until updated by the app
 }
 
 // FilterInfo contains information about filters for UI.
@@ -39,11 +52,18 @@ type FilterFile struct {
 	Tag      string `json:"tag"`      // sing-box rule_set tag
 	SizeKB   int    `json:"size_kb"`  // Size in KB
 	IsLoaded bool   `json:"is_loaded"` // True if file exists
+	
+	SourceURL string `json:"source_url"`           // Where updates come from
+	IsCustom  bool   `json:"is_custom"`            // SourceURL set by the user
+	UpdatedAt string `json:"updated_at,omitempty"` // Last successful update of this file
 }
 
 // FilterManager manages rule-set filter files.
 type FilterManager struct {
-	filtersPath string // Path to bin/filters/ directory
+	filtersPath string        // Path to bin/filters/ directory
+	singboxPath string        // sing-box binary used to validate downloads ("" = magic bytes only)
+	runCommand  commandRunner // Runs sing-box (replaceable in tests)
+	sourceURLs  map[string]string // User overrides of FilterURLs
 }
 
 // Filter file constants
@@ -53,32 +73,58 @@ const (
 	DefaultMaxAgeDays  = 30
 )
 
+// FilterFileSpec describes one filter file.
+type FilterFileSpec struct {
+	Name string // File name in bin/filters/
+	Tag  string // sing-box rule_set tag
+	Kind string // FilterKindDomain or FilterKindIP (entries of a .lst source)
+}
+
 // Filter file names (must match files in dependencies/filters/)
-var FilterFiles = []struct {
-	Name string
-	Tag  string
-}{
-	{"refilter_domains.srs", "refilter-domains"},
-	{"refilter_ips.srs", "refilter-ips"},
-	{"community_domains.srs", "community-domains"},
-	{"community_ips.srs", "community-ips"},
-	{"discord_ips.srs", "discord-ips"},
+var FilterFiles = []FilterFileSpec{
+	{"refilter_domains.srs", "refilter-domains", FilterKindDomain},
+	{"refilter_ips.srs", "refilter-ips", FilterKindIP},
+	{"community_domains.srs", "community-domains", FilterKindDomain},
+	{"community_ips.srs", "community-ips", FilterKindIP},
+	{"discord_ips.srs", "discord-ips", FilterKindIP},
 }
 
-// Remote filter URLs for updates
+// Default remote filter URLs for updates.
+// .srs sources are used as is, .lst sources are compiled with sing-box.
 var FilterURLs = map[string]string{
-	"refilter_domains.srs": "https://github.com/1andrevich/Re-filter-lists/releases/latest/download/refilter_domains.srs",
-	"refilter_ips.srs":     "https://github.com/1andrevich/Re-filter-lists/releases/latest/download/refilter_ips.srs",
-	// Community filters don't have direct URLs - they're compiled from .lst files
+	"refilter_domains.srs":  "https://github.com/1andrevich/Re-filter-lists/releases/latest/download/ruleset-domain-refilter_domains.srs",
+	"refilter_ips.srs":      "https://github.com/1andrevich/Re-filter-lists/releases/latest/download/ruleset-ip-refilter_ipsum.srs",
+	"community_domains.srs": "https://raw.githubusercontent.com/1andrevich/Re-filter-lists/main/community.lst",
+	"community_ips.srs":     "https://raw.githubusercontent.com/1andrevich/Re-filter-lists/main/community_ips.lst",
+	"discord_ips.srs":       "https://raw.githubusercontent.com/1andrevich/Re-filter-lists/main/discord_ips.lst",
 }
 
 // NewFilterManager creates a new filter manager.
 func NewFilterManager(basePath string) *FilterManager {
 	return &FilterManager{
 		filtersPath: filepath.Join(basePath, "bin", FiltersFolder),
+		runCommand:  runHiddenCommand,
 	}
 }
 
+// SetSingboxPath sets the sing-box binary used to validate downloaded filters.
+func (fm *FilterManager) SetSingboxPath(path string) {
+	fm.singboxPath = path
+}
+
+// SetSourceURLs sets user overrides of the default filter URLs (file name -> URL).
+func (fm *FilterManager) SetSourceURLs(urls map[string]string) {
+	fm.sourceURLs = urls
+}
+
+// SourceURL returns the update URL of a filter file and whether the user set it.
+func (fm *FilterManager) SourceURL(filename string) (string, bool) {
+	if u := fm.sourceURLs[filename]; u != "" {
+		return u, true
+	}
+	return FilterURLs[filename], false
+}
+
 // GetFiltersPath returns the path to filters directory.
 func (fm *FilterManager) GetFiltersPath() string {
 	return fm.filtersPath
@@ -180,6 +226,7 @@ func (fm *FilterManager) GetInfo() (*FilterInfo, error) {
 // GetFilterFiles returns list of filter files with their status.
 func (fm *FilterManager) GetFilterFiles() []FilterFile {
 	files := make([]FilterFile, 0, len(FilterFiles))
+	version, _ := fm.LoadVersion()
 	
 	for _, f := range FilterFiles {
 		filterPath := filepath.Join(fm.filtersPath, f.Name)
@@ -193,6 +240,12 @@ func (fm *FilterManager) GetFilterFiles() []FilterFile {
 			ff.IsLoaded = true
 			ff.SizeKB = int(stat.Size() / 1024)
 		}
+		ff.SourceURL, ff.IsCustom = fm.SourceURL(f.Name)
+		if version != nil {
+			if fv := version.Files[filterVersionKey(f.Name)]; fv != nil && !fv.UpdatedAt.IsZero() {
+				ff.UpdatedAt = fv.UpdatedAt.Format("2006-01-02")
+			}
+		}
 		
 		files = append(files, ff)
 	}
@@ -216,45 +269,131 @@ func (fm *FilterManager) CheckFreshness() (bool, int, error) {
 	return daysOld > version.MaxAgeDays, daysOld, nil
 }
 
-// UpdateRefilters downloads latest Re:filter rule-sets.
-// Returns number of updated files.
-func (fm *FilterManager) UpdateRefilters() (int, error) {
+// UpdateAll downloads the latest version of every filter file.
+// Each download is validated before it replaces the old file, so a failed
+// file keeps its previous version and doesn't stop the others.
+// Returns the per-file results.
+func (fm *FilterManager) UpdateAll() ([]FilterUpdateResult, error) {
 	// Ensure filters directory exists
 	if err := os.MkdirAll(fm.filtersPath, 0755); err != nil {
-		return 0, fmt.Errorf("failed to create filters directory: %w", err)
+		return nil, fmt.Errorf("failed to create filters directory: %w", err)
 	}
 	
+	results := make([]FilterUpdateResult, 0, len(FilterFiles))
 	updated := 0
 	
-	for filename, url := range FilterURLs {
-		filterPath := filepath.Join(fm.filtersPath, filename)
-		
-		// Download file
-		if err := downloadFile(url, filterPath); err != nil {
-			fmt.Printf("[FilterManager] Failed to download %s: %v\n", filename, err)
+	version, _ := fm.LoadVersion()
+	if version == nil {
+		version = &FilterVersion{MaxAgeDays: DefaultMaxAgeDays}
+	}
+	if version.Files == nil {
+		version.Files = make(map[string]*FilterFileVersion)
+	}
+	
+	// Through the running VPN if possible: GitHub is often throttled direct
+	client, route := newDownloadClient(60 * time.Second)
+	
+	for _, f := range FilterFiles {
+		sourceURL, _ := fm.SourceURL(f.Name)
+		if sourceURL == "" {
 			continue
 		}
 		
-		updated++
-		fmt.Printf("[FilterManager] Updated %s\n", filename)
+		result := fm.updateFilterFile(client, f, sourceURL)
+		result.Route = route
+		if result.Updated {
+			updated++
+			fmt.Printf("[FilterManager] Updated %s (parsed: %s)\n", f.Name, result.Parsed)
+			
+			key := filterVersionKey(f.Name)
+			fv := version.Files[key]
+			if fv == nil {
+				fv = &FilterFileVersion{File: f.Name}
+				version.Files[key] = fv
+			}
+			fv.SourceURL = sourceURL
+			fv.UpdatedAt = time.Now()
+			if result.Entries > 0 {
+				fv.Entries = result.Entries
+			}
+		} else {
+			fmt.Printf("[FilterManager] Kept previous %s: %s\n", f.Name, result.Error)
+		}
+		results = append(results, result)
 	}
 	
+	// Update version
 	if updated > 0 {
-		// Update version
-		version, _ := fm.LoadVersion()
-		if version == nil {
-			version = &FilterVersion{MaxAgeDays: DefaultMaxAgeDays}
-		}
-		
 		version.FiltersVersion = time.Now().Format("2006.01.02")
 		version.UpdatedAt = time.Now()
-		
-		if err := fm.SaveVersion(version); err != nil {
-			fmt.Printf("[FilterManager] Failed to save version: %v\n", err)
+	}
+	version.LastUpdate = results
+	
+	if err := fm.SaveVersion(version); err != nil {
+		fmt.Printf("[FilterManager] Failed to save version: %v\n", err)
+	}
+	
+	return results, nil
+}
+
+// updateFilterFile downloads one filter to a temp file (compiling .lst
+// sources) and swaps it in if valid
+func (fm *FilterManager) updateFilterFile(client *http.Client, f FilterFileSpec, url string) FilterUpdateResult {
+	result := FilterUpdateResult{File: f.Name, Source: url}
+	filterPath := filepath.Join(fm.filtersPath, f.Name)
+	tempPath := filterPath + ".tmp"
+	defer os.Remove(tempPath)
+	
+	var parsed string
+	var err error
+	if filterSourceIsList(url) {
+		parsed, err = fm.downloadFilterList(client, f.Kind, url, tempPath, &result)
+	} else {
+		var size int64
+		if size, err = downloadFile(client, url, tempPath); err != nil {
+			result.Error = fmt.Sprintf("download failed: %v", err)
+			return result
 		}
+		result.SizeKB = int(size / 1024)
+		parsed, err = fm.ValidateFilterFile(tempPath)
+	}
+	result.Parsed = parsed
+	if err != nil {
+		result.Error = err.Error()
+		return result
 	}
 	
-	return updated, nil
+	if err := os.Rename(tempPath, filterPath); err != nil {
+		result.Error = fmt.Sprintf("failed to replace file: %v", err)
+		return result
+	}
+	result.Updated = true
+	return result
+}
+
+// downloadFilterList downloads a .lst source and compiles it into destPath.
+// Compiled lists may be tiny, so only the parse of the result is checked.
+func (fm *FilterManager) downloadFilterList(client *http.Client, kind, url, destPath string, result *FilterUpdateResult) (string, error) {
+	listPath := destPath + ".lst"
+	defer os.Remove(listPath)
+	
+	if _, err := downloadFile(client, url, listPath); err != nil {
+		return "", fmt.Errorf("download failed: %v", err)
+	}
+	entries, err := fm.compileFilterList(listPath, kind, destPath)
+	if err != nil {
+		return FilterParsedFailed, err
+	}
+	result.Entries = entries
+	if stat, err := os.Stat(destPath); err == nil {
+		result.SizeKB = int(stat.Size() / 1024)
+	}
+	return fm.parseRuleSet(destPath)
+}
+
+// filterVersionKey returns the key of a filter file in FilterVersion.Files
+func filterVersionKey(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
 }
 
 // EnsureFiltersExist checks if filter files exist.
@@ -283,8 +422,9 @@ func (fm *FilterManager) GetRuleSetConfigs() []map[string]interface{} {
 	for _, f := range FilterFiles {
 		filterPath := filepath.Join(fm.filtersPath, f.Name)
 		
-		// Only include existing files
-		if _, err := os.Stat(filterPath); err != nil {
+		// Only include existing, non-empty files: rules reference only the
+		// tags listed here, so a missing file never breaks the config
+		if stat, err := os.Stat(filterPath); err != nil || stat.Size() == 0 {
 			continue
 		}
 		
@@ -292,7 +432,7 @@ func (fm *FilterManager) GetRuleSetConfigs() []map[string]interface{} {
 			"type":   "local",
 			"tag":    f.Tag,
 			"format": "binary",
-			"path":   filterPath, // Absolute path to .srs file
+			"path":   filterPath, // Absolute path, stored as ${filters} (see mapConfigPaths)
 		}
 		
 		configs = append(configs, config)
@@ -301,44 +441,41 @@ func (fm *FilterManager) GetRuleSetConfigs() []map[string]interface{} {
 	return configs
 }
 
-// downloadFile downloads a file from URL to local path.
-func downloadFile(url, destPath string) error {
+// downloadFile downloads a file from URL to local path and returns its size.
+// Downloads larger than MaxFilterFileSize are aborted.
+func downloadFile(client *http.Client, url, destPath string) (int64, error) {
 	// Create HTTP request
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	
 	req.Header.Set("User-Agent", "KampusVPN/"+Version)
 	
 	// Send request
-	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 	
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return 0, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
 	
-	// Create temp file
-	tempPath := destPath + ".tmp"
-	out, err := os.Create(tempPath)
+	out, err := os.Create(destPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	
-	// Copy response body
-	_, err = io.Copy(out, resp.Body)
+	// Copy response body (one byte over the limit is enough to reject it)
+	size, err := io.Copy(out, io.LimitReader(resp.Body, MaxFilterFileSize+1))
 	out.Close()
 	
 	if err != nil {
-		os.Remove(tempPath)
-		return err
+		os.Remove(destPath)
+		return 0, err
 	}
 	
-	// Rename to final path
-	return os.Rename(tempPath, destPath)
+	return size, nil
 }
@@ -0,0 +1,225 @@
+// Package main provides detection of proxy servers reachable through WireGuard tunnels for KampusVPN.
+// When a proxy server resolves into a WireGuard AllowedIPs range or to a WireGuard endpoint,
+// the proxy's own traffic is routed into the tunnel and the connection periodically stalls.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Host resolution settings for overlap detection
+const (
+	// OverlapResolveTimeout limits a single host lookup.
+	OverlapResolveTimeout = 2 * time.Second
+	// OverlapResolveCacheTTL is how long resolved addresses are reused between builds.
+	OverlapResolveCacheTTL = 10 * time.Minute
+	// overlapResolveWorkers limits concurrent lookups.
+	overlapResolveWorkers = 16
+)
+
+// HostOverlap describes a proxy server whose address collides with a WireGuard tunnel.
+type HostOverlap struct {
+	ProxyTag     string `json:"proxy_tag"`
+	ProxyServer  string `json:"proxy_server"`
+	IP           string `json:"ip"`
+	WireGuardTag string `json:"wireguard_tag"`
+	Reason       string `json:"reason"` // "endpoint" or "allowed_ips"
+	CIDR         string `json:"cidr,omitempty"`
+}
+
+// Message returns a user-facing description of the overlap.
+func (o HostOverlap) Message() string {
+	if o.Reason == "endpoint" {
+		return fmt.Sprintf("Прокси %s (%s) и WireGuard %s используют один сервер %s",
+			o.ProxyTag, o.ProxyServer, o.WireGuardTag, o.IP)
+	}
+	return fmt.Sprintf("Адрес прокси %s (%s -> %s) входит в AllowedIPs %s туннеля WireGuard %s",
+		o.ProxyTag, o.ProxyServer, o.IP, o.CIDR, o.WireGuardTag)
+}
+
+type resolvedHost struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// HostResolver resolves hostnames with a short timeout and caches results.
+type HostResolver struct {
+	lookup func(ctx context.Context, host string) ([]net.IP, error)
+	cache  map[string]resolvedHost
+	mu     sync.Mutex
+}
+
+// NewHostResolver creates a resolver using the system DNS.
+func NewHostResolver() *HostResolver {
+	return &HostResolver{
+		lookup: func(ctx context.Context, host string) ([]net.IP, error) {
+			addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			ips := make([]net.IP, 0, len(addrs))
+			for _, addr := range addrs {
+				ips = append(ips, addr.IP)
+			}
+			return ips, nil
+		},
+		cache: make(map[string]resolvedHost),
+	}
+}
+
+// Resolve returns addresses of host. IP literals are returned as is,
+// failed lookups return nil.
+func (r *HostResolver) Resolve(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	if host == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	if entry, ok := r.cache[host]; ok && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.ips
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), OverlapResolveTimeout)
+	defer cancel()
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	r.cache[host] = resolvedHost{ips: ips, expires: time.Now().Add(OverlapResolveCacheTTL)}
+	r.mu.Unlock()
+	return ips
+}
+
+// resolveAll resolves hosts concurrently.
+func (r *HostResolver) resolveAll(hosts []string) map[string][]net.IP {
+	result := make(map[string][]net.IP, len(hosts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, overlapResolveWorkers)
+
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ips := r.Resolve(host)
+			mu.Lock()
+			result[host] = ips
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return result
+}
+
+// DetectHostOverlaps finds proxies whose server address is a WireGuard endpoint
+// or falls into WireGuard AllowedIPs. Default routes (0.0.0.0/0, ::/0) are ignored:
+// they are rejected by AllowedIPs validation anyway.
+func DetectHostOverlaps(proxies []ProxyConfig, wireGuardConfigs []UserWireGuardConfig, resolver *HostResolver) []HostOverlap {
+	if len(proxies) == 0 || len(wireGuardConfigs) == 0 {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(proxies)+len(wireGuardConfigs))
+	for _, p := range proxies {
+		hosts = append(hosts, p.Server)
+	}
+	for _, wg := range wireGuardConfigs {
+		hosts = append(hosts, wg.Endpoint)
+	}
+	resolved := resolver.resolveAll(hosts)
+
+	var overlaps []HostOverlap
+	for _, p := range proxies {
+		seen := make(map[string]bool)
+		for _, ip := range resolved[p.Server] {
+			for _, wg := range wireGuardConfigs {
+				key := ip.String() + "|" + wg.Tag
+				if seen[key] {
+					continue
+				}
+
+				if overlap, ok := matchWireGuardOverlap(p, ip, wg, resolved[wg.Endpoint]); ok {
+					seen[key] = true
+					overlaps = append(overlaps, overlap)
+				}
+			}
+		}
+	}
+	return overlaps
+}
+
+// matchWireGuardOverlap checks one proxy address against one WireGuard config.
+func matchWireGuardOverlap(p ProxyConfig, ip net.IP, wg UserWireGuardConfig, endpointIPs []net.IP) (HostOverlap, bool) {
+	overlap := HostOverlap{
+		ProxyTag:     p.Tag,
+		ProxyServer:  p.Server,
+		IP:           ip.String(),
+		WireGuardTag: wg.Tag,
+	}
+
+	for _, endpointIP := range endpointIPs {
+		if endpointIP.Equal(ip) {
+			overlap.Reason = "endpoint"
+			return overlap, true
+		}
+	}
+
+	for _, cidr := range wg.AllowedIPs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones == 0 {
+			continue
+		}
+		if network.Contains(ip) {
+			overlap.Reason = "allowed_ips"
+			overlap.CIDR = cidr
+			return overlap, true
+		}
+	}
+
+	return HostOverlap{}, false
+}
+
+// overlapExceptionRule returns a route rule sending overlapping proxy addresses direct.
+func overlapExceptionRule(overlaps []HostOverlap) map[string]interface{} {
+	cidrs := []string{}
+	seen := make(map[string]bool)
+	for _, o := range overlaps {
+		ip := net.ParseIP(o.IP)
+		if ip == nil || seen[o.IP] {
+			continue
+		}
+		seen[o.IP] = true
+		if ip.To4() != nil {
+			cidrs = append(cidrs, o.IP+"/32")
+		} else {
+			cidrs = append(cidrs, o.IP+"/128")
+		}
+	}
+	return map[string]interface{}{
+		"ip_cidr":  cidrs,
+		"action":   "route",
+		"outbound": "direct",
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeResolver returns a resolver answering from hosts and counting lookups
+func fakeResolver(hosts map[string]string) (*HostResolver, *int) {
+	var mu sync.Mutex
+	lookups := 0
+	return &HostResolver{
+		lookup: func(ctx context.Context, host string) ([]net.IP, error) {
+			mu.Lock()
+			lookups++
+			mu.Unlock()
+			ip, ok := hosts[host]
+			if !ok {
+				return nil, errors.New("no such host")
+			}
+			return []net.IP{net.ParseIP(ip)}, nil
+		},
+		cache: make(map[string]resolvedHost),
+	}, &lookups
+}
+
+func TestDetectHostOverlaps(t *testing.T) {
+	resolver, _ := fakeResolver(map[string]string{
+		"inside.example":   "10.8.0.50",
+		"endpoint.example": "203.0.113.10",
+		"outside.example":  "198.51.100.7",
+		"vpn.corp.example": "203.0.113.10",
+	})
+	wg := UserWireGuardConfig{
+		Tag:        "office",
+		Endpoint:   "vpn.corp.example",
+		AllowedIPs: []string{"10.8.0.0/24", "203.0.113.0/24", "0.0.0.0/0"},
+	}
+
+	tests := []struct {
+		name   string
+		server string
+		want   *HostOverlap
+	}{
+		{"in AllowedIPs", "inside.example", &HostOverlap{IP: "10.8.0.50", Reason: "allowed_ips", CIDR: "10.8.0.0/24"}},
+		// The endpoint match wins over the AllowedIPs range holding it
+		{"WireGuard endpoint", "endpoint.example", &HostOverlap{IP: "203.0.113.10", Reason: "endpoint"}},
+		{"IP literal", "10.8.0.9", &HostOverlap{IP: "10.8.0.9", Reason: "allowed_ips", CIDR: "10.8.0.0/24"}},
+		// 0.0.0.0/0 would match everything and is ignored
+		{"default route only", "outside.example", nil},
+		{"unresolvable", "missing.example", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := ProxyConfig{Tag: "de", Server: tt.server}
+			overlaps := DetectHostOverlaps([]ProxyConfig{proxy}, []UserWireGuardConfig{wg}, resolver)
+			if tt.want == nil {
+				if len(overlaps) != 0 {
+					t.Errorf("overlaps = %+v, want none", overlaps)
+				}
+				return
+			}
+			if len(overlaps) != 1 {
+				t.Fatalf("overlaps = %+v, want one", overlaps)
+			}
+			got := overlaps[0]
+			if got.IP != tt.want.IP || got.Reason != tt.want.Reason || got.CIDR != tt.want.CIDR {
+				t.Errorf("overlap = %+v, want %+v", got, *tt.want)
+			}
+			if got.ProxyTag != "de" || got.ProxyServer != tt.server || got.WireGuardTag != "office" {
+				t.Errorf("overlap = %+v", got)
+			}
+		})
+	}
+
+	if overlaps := DetectHostOverlaps([]ProxyConfig{{Tag: "de", Server: "inside.example"}}, nil, resolver); overlaps != nil {
+		t.Errorf("without WireGuard: %+v", overlaps)
+	}
+}
+
+func TestHostResolverCache(t *testing.T) {
+	resolver, lookups := fakeResolver(map[string]string{"de.example.com": "198.51.100.7"})
+
+	hosts := []string{"de.example.com", "203.0.113.1", "missing.example"}
+	for i := 0; i < 2; i++ {
+		resolved := resolver.resolveAll(hosts)
+		if ips := resolved["de.example.com"]; len(ips) != 1 || ips[0].String() != "198.51.100.7" {
+			t.Fatalf("de.example.com = %v", ips)
+		}
+		if ips := resolved["203.0.113.1"]; len(ips) != 1 {
+			t.Errorf("IP literal = %v", ips)
+		}
+	}
+	// One lookup for the cached host, one per build for the failed one; none for IP literals
+	if *lookups != 3 {
+		t.Errorf("lookups = %d, want 3", *lookups)
+	}
+}
+
+// testOverlapStorage returns a storage with a profile whose WireGuard networks hold the test proxy server
+func testOverlapStorage(t *testing.T) (*Storage, *ProfileData) {
+	t.Helper()
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetProfileRoutingMode(profile.ID, RoutingModeAllTraffic); err != nil {
+		t.Fatal(err)
+	}
+	return storage, profile
+}
+
+func TestBuildOverlapExceptionBeforeWireGuardRule(t *testing.T) {
+	wg := []UserWireGuardConfig{{Tag: "office", Endpoint: "vpn.corp.example", DNS: "10.8.0.1", AllowedIPs: []string{"10.8.0.0/24"}}}
+
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{"exception enabled", true},
+		{"exception disabled", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, profile := testOverlapStorage(t)
+			if err := storage.SetProfileOverlapException(profile.ID, tt.enabled); err != nil {
+				t.Fatal(err)
+			}
+			builder := NewConfigBuilderForStorage(storage)
+			// The proxy of testDirectLink resolves into the tunnel network
+			builder.resolver, _ = fakeResolver(map[string]string{
+				"de.example.com":   "10.8.0.50",
+				"vpn.corp.example": "203.0.113.10",
+			})
+			if err := builder.BuildConfigForProfile(profile.ID, testDirectLink, wg); err != nil {
+				t.Fatalf("BuildConfigForProfile: %v", err)
+			}
+
+			stored := mustStoredProfile(t, storage, profile.ID)
+			route, _ := stored.SingboxConfig["route"].(map[string]interface{})
+			rules, _ := route["rules"].([]interface{})
+			exceptionIdx, wireGuardIdx := -1, -1
+			for i, rule := range rules {
+				ruleMap, _ := rule.(map[string]interface{})
+				switch cidrs := jsonStringList(ruleMap["ip_cidr"]); {
+				case equalStringSlices(cidrs, []string{"10.8.0.50/32"}):
+					exceptionIdx = i
+				case equalStringSlices(cidrs, []string{"10.8.0.0/24"}):
+					wireGuardIdx = i
+				}
+			}
+			// The overlap is reported either way
+			found := false
+			for _, warning := range stored.BuildWarnings {
+				found = found || warning.Code == WarnHostOverlap
+			}
+			if !found {
+				t.Errorf("warnings = %+v, want the overlap", stored.BuildWarnings)
+			}
+			if wireGuardIdx < 0 {
+				t.Fatalf("no WireGuard rule in %v", rules)
+			}
+			if !tt.enabled {
+				if exceptionIdx >= 0 {
+					t.Errorf("exception rule at %d although disabled", exceptionIdx)
+				}
+				return
+			}
+			if exceptionIdx < 0 || exceptionIdx > wireGuardIdx {
+				t.Errorf("exception rule at %d, WireGuard rule at %d: want the exception first", exceptionIdx, wireGuardIdx)
+			}
+		})
+	}
+}
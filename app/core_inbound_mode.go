@@ -0,0 +1,118 @@
+// Package main provides the inbound mode of KampusVPN.
+// In TUN mode sing-box captures all traffic through its virtual adapter. In
+// proxy mode the TUN inbound is dropped and only the local mixed (SOCKS5 +
+// HTTP) inbound is left, so apps that are pointed at 127.0.0.1:PORT use the
+// VPN and nothing else is touched.
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Inbound modes
+const (
+	InboundModeTUN   = "tun"   // Virtual adapter, all traffic (default)
+	InboundModeProxy = "proxy" // Local SOCKS5/HTTP proxy only
+)
+
+// Proxy inbound settings
+const (
+	DefaultProxyInboundPort = 2080 // Port of the mixed inbound of the template
+	proxyInboundTag         = "mixed-in"
+	proxyInboundListen      = "127.0.0.1"
+)
+
+// EffectiveInboundMode returns the inbound mode ("" = InboundModeTUN)
+func (s GlobalAppSettings) EffectiveInboundMode() string {
+	if s.InboundMode == InboundModeProxy {
+		return InboundModeProxy
+	}
+	return InboundModeTUN
+}
+
+// EffectiveProxyInboundPort returns the local proxy port (0 = DefaultProxyInboundPort)
+func (s GlobalAppSettings) EffectiveProxyInboundPort() int {
+	if s.ProxyInboundPort > 0 {
+		return s.ProxyInboundPort
+	}
+	return DefaultProxyInboundPort
+}
+
+// validateInboundMode checks a mode name coming from the frontend
+func validateInboundMode(mode string) error {
+	switch mode {
+	case InboundModeTUN, InboundModeProxy:
+		return nil
+	default:
+		return fmt.Errorf("неизвестный режим подключения: %s", mode)
+	}
+}
+
+// checkProxyPortFree reports an error if the local proxy port is taken by another program
+func checkProxyPortFree(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("недопустимый порт: %d", port)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(proxyInboundListen, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("порт %d уже занят другой программой", port)
+	}
+	ln.Close()
+	return nil
+}
+
+// applyInboundMode adapts the inbounds of a sing-box config to the inbound mode.
+// Proxy mode removes TUN inbounds and the route rules only TUN traffic needs
+// (DNS hijacking and direct private ranges) and moves the mixed inbound to port.
+func applyInboundMode(config map[string]interface{}, mode string, port int) {
+	if mode != InboundModeProxy {
+		return
+	}
+
+	inbounds, _ := config["inbounds"].([]interface{})
+	kept := make([]interface{}, 0, len(inbounds)+1)
+	var mixed map[string]interface{}
+	for _, in := range inbounds {
+		inbound, ok := in.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch inbound["type"] {
+		case "tun":
+			continue
+		case "mixed":
+			if mixed == nil {
+				mixed = inbound
+			}
+		}
+		kept = append(kept, inbound)
+	}
+	if mixed == nil {
+		mixed = map[string]interface{}{
+			"type": "mixed",
+			"tag":  proxyInboundTag,
+		}
+		kept = append(kept, mixed)
+	}
+	mixed["listen"] = proxyInboundListen
+	mixed["listen_port"] = port
+	config["inbounds"] = kept
+
+	route, ok := config["route"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	rules, _ := route["rules"].([]interface{})
+	filtered := make([]interface{}, 0, len(rules))
+	for _, r := range rules {
+		if rule, ok := r.(map[string]interface{}); ok {
+			if rule["action"] == "hijack-dns" || rule["ip_is_private"] == true {
+				continue
+			}
+		}
+		filtered = append(filtered, r)
+	}
+	route["rules"] = filtered
+}
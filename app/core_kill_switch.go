@@ -0,0 +1,197 @@
+// Package main provides the kill switch for KampusVPN.
+// When sing-box dies unexpectedly, traffic would silently fall back to the
+// raw connection. With the kill switch on, Windows Firewall rules then block
+// all outbound traffic except loopback and the proxy servers until the user
+// disconnects or reconnects.
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kill switch settings
+const (
+	// KillSwitchRuleName is the name of every firewall rule of the kill switch.
+	KillSwitchRuleName = "KampusVPN-KillSwitch" // No spaces: netsh parses its own command line
+	// killSwitchRangesPerRule keeps netsh command lines well below the length limit.
+	killSwitchRangesPerRule = 200
+	// KillSwitchCommandTimeout bounds one netsh call.
+	KillSwitchCommandTimeout = 10 * time.Second
+)
+
+// Address ranges that stay reachable while the kill switch is engaged
+var killSwitchAlwaysAllowed = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// addrRange is an inclusive address range
+type addrRange struct {
+	from, to netip.Addr
+}
+
+// prefixRange returns the first and last address of a prefix
+func prefixRange(p netip.Prefix) addrRange {
+	p = p.Masked()
+	from := p.Addr()
+	bytes := from.As16()
+	hostBits := from.BitLen() - p.Bits()
+	offset := 16 - from.BitLen()/8 // IPv4 lives in the last 4 bytes
+	for i := 15; i >= offset && hostBits > 0; i-- {
+		if hostBits >= 8 {
+			bytes[i] = 0xff
+			hostBits -= 8
+		} else {
+			bytes[i] |= byte(1<<hostBits - 1)
+			hostBits = 0
+		}
+	}
+	to := netip.AddrFrom16(bytes)
+	if from.Is4() {
+		to = to.Unmap()
+	}
+	return addrRange{from: from, to: to}
+}
+
+// complementRanges returns the ranges of [min, max] not covered by allowed
+func complementRanges(allowed []addrRange, min, max netip.Addr) []addrRange {
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i].from.Less(allowed[j].from) })
+
+	gaps := []addrRange{}
+	cur := min
+	for _, r := range allowed {
+		if cur.Less(r.from) {
+			gaps = append(gaps, addrRange{from: cur, to: r.from.Prev()})
+		}
+		if !r.to.Less(cur) {
+			if r.to == max {
+				return gaps
+			}
+			cur = r.to.Next()
+		}
+	}
+	return append(gaps, addrRange{from: cur, to: max})
+}
+
+// KillSwitchBlockRanges returns netsh remoteip ranges covering everything
+// except loopback and the allowed addresses.
+func KillSwitchBlockRanges(allowed []netip.Addr) []string {
+	var v4, v6 []addrRange
+	for _, prefix := range killSwitchAlwaysAllowed {
+		if prefix.Addr().Is4() {
+			v4 = append(v4, prefixRange(prefix))
+		} else {
+			v6 = append(v6, prefixRange(prefix))
+		}
+	}
+	for _, addr := range allowed {
+		addr = addr.Unmap()
+		if addr.Is4() {
+			v4 = append(v4, addrRange{from: addr, to: addr})
+		} else {
+			v6 = append(v6, addrRange{from: addr, to: addr})
+		}
+	}
+
+	ranges := []string{}
+	for _, gap := range complementRanges(v4, netip.MustParseAddr("0.0.0.0"), netip.MustParseAddr("255.255.255.255")) {
+		ranges = append(ranges, formatAddrRange(gap))
+	}
+	for _, gap := range complementRanges(v6, netip.MustParseAddr("::"), netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")) {
+		ranges = append(ranges, formatAddrRange(gap))
+	}
+	return ranges
+}
+
+// formatAddrRange formats a range the way netsh expects it
+func formatAddrRange(r addrRange) string {
+	if r.from == r.to {
+		return r.from.String()
+	}
+	return r.from.String() + "-" + r.to.String()
+}
+
+// configProxyServers returns server addresses of proxy outbounds in a sing-box config
+func configProxyServers(config map[string]interface{}) []string {
+	servers := []string{}
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, o := range outbounds {
+		outbound, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if server, _ := outbound["server"].(string); server != "" && !containsString(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// resolveKillSwitchAddrs resolves proxy servers to the addresses the kill switch allows
+func resolveKillSwitchAddrs(servers []string, resolver *HostResolver) []netip.Addr {
+	addrs := []netip.Addr{}
+	for _, ips := range resolver.resolveAll(servers) {
+		for _, ip := range ips {
+			if addr, ok := netip.AddrFromSlice(ip); ok {
+				addrs = append(addrs, addr.Unmap())
+			}
+		}
+	}
+	return addrs
+}
+
+// firewallCommand runs netsh; tests replace it
+var firewallCommand commandRunner = runHiddenCommand
+
+// netshFirewall runs a `netsh advfirewall firewall` command
+func netshFirewall(args ...string) error {
+	output, err := firewallCommand(KillSwitchCommandTimeout, "netsh", append([]string{"advfirewall", "firewall"}, args...)...)
+	if err != nil {
+		return fmt.Errorf("netsh: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// InstallKillSwitch blocks all outbound traffic except loopback and allowed.
+// Existing kill switch rules are replaced.
+func InstallKillSwitch(allowed []netip.Addr) error {
+	RemoveKillSwitch()
+
+	ranges := KillSwitchBlockRanges(allowed)
+	for start := 0; start < len(ranges); start += killSwitchRangesPerRule {
+		end := start + killSwitchRangesPerRule
+		if end > len(ranges) {
+			end = len(ranges)
+		}
+		err := netshFirewall("add", "rule",
+			"name="+KillSwitchRuleName,
+			"dir=out",
+			"action=block",
+			"profile=any",
+			"enable=yes",
+			"remoteip="+strings.Join(ranges[start:end], ","),
+		)
+		if err != nil {
+			RemoveKillSwitch()
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveKillSwitch deletes all kill switch rules; no rules is not an error.
+func RemoveKillSwitch() error {
+	if !KillSwitchInstalled() {
+		return nil
+	}
+	return netshFirewall("delete", "rule", "name="+KillSwitchRuleName)
+}
+
+// KillSwitchInstalled reports whether kill switch rules exist (e.g. left by a previous run)
+func KillSwitchInstalled() bool {
+	return netshFirewall("show", "rule", "name="+KillSwitchRuleName) == nil
+}
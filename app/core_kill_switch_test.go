@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPrefixRange(t *testing.T) {
+	tests := []struct {
+		prefix string
+		from   string
+		to     string
+	}{
+		{"10.0.0.0/8", "10.0.0.0", "10.255.255.255"},
+		{"10.17.2.3/12", "10.16.0.0", "10.31.255.255"},
+		{"192.168.1.7/32", "192.168.1.7", "192.168.1.7"},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255"},
+		{"::1/128", "::1", "::1"},
+		{"fd00::/8", "fd00::", "fdff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{"2001:db8::/33", "2001:db8::", "2001:db8:7fff:ffff:ffff:ffff:ffff:ffff"},
+	}
+
+	for _, tt := range tests {
+		got := prefixRange(netip.MustParsePrefix(tt.prefix))
+		if got.from.String() != tt.from || got.to.String() != tt.to {
+			t.Errorf("prefixRange(%s) = %s-%s, want %s-%s", tt.prefix, got.from, got.to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestKillSwitchBlockRanges(t *testing.T) {
+	const (
+		v4Tail = "128.0.0.0-255.255.255.255"
+		v6Head = "::"
+		v6Tail = "::2-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"
+	)
+
+	tests := []struct {
+		name    string
+		allowed []string
+		want    []string
+	}{
+		{
+			name: "loopback only",
+			want: []string{"0.0.0.0-126.255.255.255", v4Tail, v6Head, v6Tail},
+		},
+		{
+			name:    "one proxy",
+			allowed: []string{"203.0.113.10"},
+			want:    []string{"0.0.0.0-126.255.255.255", "128.0.0.0-203.0.113.9", "203.0.113.11-255.255.255.255", v6Head, v6Tail},
+		},
+		{
+			name:    "unsorted, duplicate and adjacent",
+			allowed: []string{"8.8.8.8", "1.1.1.1", "8.8.8.9", "1.1.1.1"},
+			want:    []string{"0.0.0.0-1.1.1.0", "1.1.1.2-8.8.8.7", "8.8.8.10-126.255.255.255", v4Tail, v6Head, v6Tail},
+		},
+		{
+			name:    "IPv4-mapped IPv6",
+			allowed: []string{"::ffff:203.0.113.10"},
+			want:    []string{"0.0.0.0-126.255.255.255", "128.0.0.0-203.0.113.9", "203.0.113.11-255.255.255.255", v6Head, v6Tail},
+		},
+		{
+			name:    "inside loopback",
+			allowed: []string{"127.0.0.1"},
+			want:    []string{"0.0.0.0-126.255.255.255", v4Tail, v6Head, v6Tail},
+		},
+		{
+			name:    "range edges",
+			allowed: []string{"0.0.0.0", "255.255.255.255", "::"},
+			want:    []string{"0.0.0.1-126.255.255.255", "128.0.0.0-255.255.255.254", v6Tail},
+		},
+		{
+			name:    "IPv6 proxy",
+			allowed: []string{"2001:db8::1"},
+			want:    []string{"0.0.0.0-126.255.255.255", v4Tail, v6Head, "::2-2001:db8::", "2001:db8::2-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		},
+		{
+			name:    "last IPv6 address",
+			allowed: []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+			want:    []string{"0.0.0.0-126.255.255.255", v4Tail, v6Head, "::2-ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := make([]netip.Addr, 0, len(tt.allowed))
+			for _, addr := range tt.allowed {
+				allowed = append(allowed, netip.MustParseAddr(addr))
+			}
+			if got := KillSwitchBlockRanges(allowed); !equalStringSlices(got, tt.want) {
+				t.Errorf("KillSwitchBlockRanges(%v) = %v, want %v", tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigProxyServers(t *testing.T) {
+	config := map[string]interface{}{
+		"outbounds": []interface{}{
+			map[string]interface{}{"type": "trojan", "tag": "de", "server": "de.example.com"},
+			map[string]interface{}{"type": "vless", "tag": "de-2", "server": "de.example.com"},
+			map[string]interface{}{"type": "shadowsocks", "tag": "nl", "server": "203.0.113.10"},
+			map[string]interface{}{"type": "selector", "tag": "proxy"},
+			"garbage",
+		},
+	}
+	want := []string{"de.example.com", "203.0.113.10"}
+	if got := configProxyServers(config); !equalStringSlices(got, want) {
+		t.Errorf("configProxyServers = %v, want %v", got, want)
+	}
+}
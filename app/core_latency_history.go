@@ -0,0 +1,150 @@
+// Package main provides latency history of the current proxy for KampusVPN.
+// While the window is open the delay of the proxy that actually carries
+// traffic is sampled into a ring buffer, so a node that is consistently slow
+// can be told apart from one that had a single spike. Switching to another
+// proxy starts a fresh series.
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency history settings
+const (
+	// LatencySampleInterval is the interval between delay samples.
+	LatencySampleInterval = 30 * time.Second
+	// LatencyHistorySize is how many samples are kept (an hour at the interval above).
+	LatencyHistorySize = 120
+	// LatencySampleTimeout bounds one delay test.
+	LatencySampleTimeout = 5 * time.Second
+	// maxGroupDepth bounds following selector -> urltest -> proxy.
+	maxGroupDepth = 4
+)
+
+// LatencySample is one delay test of the current proxy.
+type LatencySample struct {
+	At    time.Time `json:"at"`
+	Delay int       `json:"delay"`           // ms, 0 when the test failed
+	Error string    `json:"error,omitempty"` // timeout/unreachable/error
+}
+
+// LatencyStats summarizes the successful samples of a series.
+type LatencyStats struct {
+	Samples  int     `json:"samples"`
+	Failures int     `json:"failures"`
+	Average  int     `json:"average"` // ms
+	P95      int     `json:"p95"`     // ms
+	Jitter   int     `json:"jitter"`  // Mean absolute difference between consecutive delays, ms
+	LossRate float64 `json:"loss_rate"`
+}
+
+// LatencyHistory is a ring buffer of delay samples of one proxy.
+type LatencyHistory struct {
+	proxy   string
+	since   time.Time
+	samples []LatencySample
+	next    int // Index the next sample overwrites once the buffer is full
+	mu      sync.Mutex
+}
+
+// NewLatencyHistory creates an empty history.
+func NewLatencyHistory() *LatencyHistory {
+	return &LatencyHistory{}
+}
+
+// Add records a sample; a sample of another proxy starts a new series.
+func (h *LatencyHistory) Add(proxy string, sample LatencySample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if proxy != h.proxy {
+		h.proxy = proxy
+		h.since = sample.At
+		h.samples = nil
+		h.next = 0
+	}
+	if len(h.samples) < LatencyHistorySize {
+		h.samples = append(h.samples, sample)
+		return
+	}
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % LatencyHistorySize
+}
+
+// Snapshot returns the proxy of the series and its samples, oldest first.
+func (h *LatencyHistory) Snapshot() (string, time.Time, []LatencySample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]LatencySample, 0, len(h.samples))
+	samples = append(samples, h.samples[h.next:]...)
+	samples = append(samples, h.samples[:h.next]...)
+	return h.proxy, h.since, samples
+}
+
+// computeLatencyStats returns average, 95th percentile and jitter of the
+// successful samples and the share of failed ones
+func computeLatencyStats(samples []LatencySample) LatencyStats {
+	stats := LatencyStats{Samples: len(samples)}
+	var delays []int
+	for _, s := range samples {
+		if s.Delay > 0 {
+			delays = append(delays, s.Delay)
+		} else {
+			stats.Failures++
+		}
+	}
+	if len(samples) > 0 {
+		stats.LossRate = float64(stats.Failures) / float64(len(samples))
+	}
+	if len(delays) == 0 {
+		return stats
+	}
+
+	sum, diffs := 0, 0
+	for i, d := range delays {
+		sum += d
+		if i > 0 {
+			diffs += int(math.Abs(float64(d - delays[i-1])))
+		}
+	}
+	stats.Average = sum / len(delays)
+	if len(delays) > 1 {
+		stats.Jitter = diffs / (len(delays) - 1)
+	}
+
+	sorted := append([]int(nil), delays...)
+	sort.Ints(sorted)
+	// Nearest-rank percentile
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	stats.P95 = sorted[rank]
+	return stats
+}
+
+// clashActiveProxy follows "now" from the selector through nested groups
+// (auto-select, region groups) to the proxy that carries traffic
+func clashActiveProxy(client *http.Client) (string, error) {
+	name := "proxy"
+	for depth := 0; depth < maxGroupDepth; depth++ {
+		var info struct {
+			Now string `json:"now"`
+		}
+		if err := clashGetJSON(client, "/proxies/"+url.PathEscape(name), &info); err != nil {
+			return "", err
+		}
+		if info.Now == "" {
+			return name, nil
+		}
+		name = info.Now
+	}
+	return "", fmt.Errorf("too many nested groups")
+}
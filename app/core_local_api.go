@@ -0,0 +1,111 @@
+// Package main provides the local REST listener for KampusVPN integrations.
+// The listener is bound to loopback only and every request must carry the bearer token.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LocalAPIServer is a loopback HTTP listener for Stream Deck buttons and scripts.
+type LocalAPIServer struct {
+	port   int
+	token  string
+	server *http.Server
+}
+
+// NewLocalAPIServer creates a listener on 127.0.0.1:port that serves handler
+// after loopback and token checks.
+func NewLocalAPIServer(port int, token string, handler http.Handler) *LocalAPIServer {
+	s := &LocalAPIServer{port: port, token: token}
+	s.server = &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", LocalAPIHost, port),
+		Handler:           s.guard(handler),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		// Connect waits for sing-box start
+		WriteTimeout: LongHTTPTimeout,
+	}
+	return s
+}
+
+// Start binds the port and serves in background. Bind errors are returned immediately.
+func (s *LocalAPIServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Stop closes the listener and waits for in-flight requests.
+func (s *LocalAPIServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+// Port returns the listening port.
+func (s *LocalAPIServer) Port() int {
+	return s.port
+}
+
+// guard rejects non-loopback clients and requests without a valid bearer token.
+func (s *LocalAPIServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackRequest(r) {
+			writeLocalAPIJSON(w, http.StatusForbidden, map[string]interface{}{
+				"success": false,
+				"error":   "forbidden",
+			})
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeLocalAPIJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"success": false,
+				"error":   "unauthorized",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackRequest checks that the request came from the local machine.
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// writeLocalAPIJSON writes a JSON response with the given status code.
+func writeLocalAPIJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// GenerateLocalAPIToken returns a random 256-bit token in hex.
+func GenerateLocalAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
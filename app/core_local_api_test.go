@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLocalAPIToken = "0123456789abcdef0123456789abcdef"
+
+// startTestLocalAPI starts a listener on a free loopback port serving an "ok" handler
+func startTestLocalAPI(t *testing.T) (*LocalAPIServer, string) {
+	t.Helper()
+	probe, err := net.Listen("tcp", LocalAPIHost+":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := probe.Addr().(*net.TCPAddr).Port
+	probe.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeLocalAPIJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+	server := NewLocalAPIServer(port, testLocalAPIToken, handler)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(server.Stop)
+	return server, fmt.Sprintf("http://%s:%d", LocalAPIHost, port)
+}
+
+// localAPIGet sends GET /status with the given Authorization header
+func localAPIGet(t *testing.T, baseURL, auth string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /status: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestLocalAPIRejectsBadTokens(t *testing.T) {
+	_, baseURL := startTestLocalAPI(t)
+
+	tests := []struct {
+		name string
+		auth string
+		want int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"token prefix", "Bearer " + testLocalAPIToken[:8], http.StatusUnauthorized},
+		{"other scheme", "Basic " + testLocalAPIToken, http.StatusUnauthorized},
+		{"bare token", testLocalAPIToken, http.StatusUnauthorized},
+		{"empty bearer", "Bearer ", http.StatusUnauthorized},
+		{"valid", "Bearer " + testLocalAPIToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localAPIGet(t, baseURL, tt.auth); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalAPILoopbackOnly(t *testing.T) {
+	server, _ := startTestLocalAPI(t)
+	if !strings.HasPrefix(server.server.Addr, LocalAPIHost+":") {
+		t.Errorf("listening on %s, want loopback", server.server.Addr)
+	}
+
+	// Remote clients are refused even with the right token
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"192.168.1.20:51000", http.StatusForbidden},
+		{"[2001:db8::1]:51000", http.StatusForbidden},
+		{"garbage", http.StatusForbidden},
+		{"127.0.0.1:51000", http.StatusOK},
+		{"[::1]:51000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("Authorization", "Bearer "+testLocalAPIToken)
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.remoteAddr, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestLocalAPIStartStop(t *testing.T) {
+	server, baseURL := startTestLocalAPI(t)
+	if got := localAPIGet(t, baseURL, "Bearer "+testLocalAPIToken); got != http.StatusOK {
+		t.Fatalf("status = %d, want %d", got, http.StatusOK)
+	}
+
+	// A second listener on the same port fails at once
+	busy := NewLocalAPIServer(server.Port(), testLocalAPIToken, http.NotFoundHandler())
+	if err := busy.Start(); err == nil {
+		busy.Stop()
+		t.Error("second listener on a busy port started")
+	}
+
+	server.Stop()
+	client := &http.Client{Timeout: 2 * time.Second}
+	if resp, err := client.Get(baseURL + "/status"); err == nil {
+		resp.Body.Close()
+		t.Error("listener still answers after Stop")
+	}
+
+	// The port is free again for the next start
+	restarted := NewLocalAPIServer(server.Port(), testLocalAPIToken, http.NotFoundHandler())
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("restart on the same port: %v", err)
+	}
+	restarted.Stop()
+}
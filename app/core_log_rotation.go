@@ -0,0 +1,164 @@
+// Package main provides the size-capped sing-box log file for KampusVPN.
+// When the file outgrows the limit it is renamed to vpn.log.1 (older
+// generations shift to .2, .3, ...; the oldest is deleted) and a fresh file
+// is opened. Writes from the log reader goroutines and rotation share one lock.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogFileInfo describes one log file on disk.
+type LogFileInfo struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Generation int       `json:"generation"` // 0 = current file
+}
+
+// RotatingLogFile is an append-only log file rotated by size.
+type RotatingLogFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+}
+
+// OpenRotatingLogFile opens path for appending. A file already over maxSize is rotated first.
+func OpenRotatingLogFile(path string, maxSize int64, keep int) (*RotatingLogFile, error) {
+	f := &RotatingLogFile{path: path, maxSize: maxSize, keep: keep}
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxSize {
+		rotateLogGenerations(path, keep)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the current file. Must be called with f.mu held (or before sharing f).
+func (f *RotatingLogFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	if info, err := file.Stat(); err == nil {
+		f.size = info.Size()
+	}
+	return nil
+}
+
+// WriteString appends s, rotating first if s would take the file over the limit.
+func (f *RotatingLogFile) WriteString(s string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(s)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.WriteString(s)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate closes the file, shifts generations and opens a fresh file.
+// Windows can't rename an open file, hence the close. Must be called with f.mu held.
+func (f *RotatingLogFile) rotate() error {
+	f.file.Close()
+	rotateLogGenerations(f.path, f.keep)
+	if err := f.open(); err != nil {
+		f.file = nil
+		return err
+	}
+	f.file.WriteString(fmt.Sprintf("=== Log rotated at %s ===\n", time.Now().Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+// Reopen replaces a handle that went bad (e.g. the drive was missing).
+func (f *RotatingLogFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	if err := f.open(); err != nil {
+		f.file = nil
+		return err
+	}
+	return nil
+}
+
+// Truncate empties the current file in place; the handle stays valid.
+func (f *RotatingLogFile) Truncate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	if err := f.file.Truncate(0); err != nil {
+		return err
+	}
+	f.size = 0
+	return nil
+}
+
+// Close closes the file.
+func (f *RotatingLogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// logGenerationPath returns the path of a rotated generation (0 = current file)
+func logGenerationPath(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, generation)
+}
+
+// rotateLogGenerations deletes the oldest generation, shifts the others up by
+// one and renames the current file to generation 1
+func rotateLogGenerations(path string, keep int) {
+	os.Remove(logGenerationPath(path, keep))
+	for i := keep - 1; i >= 0; i-- {
+		from := logGenerationPath(path, i)
+		if fileExists(from) {
+			os.Rename(from, logGenerationPath(path, i+1))
+		}
+	}
+}
+
+// listLogFiles returns the current file and rotated generations that exist
+func listLogFiles(path string, keep int) []LogFileInfo {
+	files := []LogFileInfo{}
+	for i := 0; i <= keep; i++ {
+		p := logGenerationPath(path, i)
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		files = append(files, LogFileInfo{Path: p, Size: info.Size(), ModifiedAt: info.ModTime(), Generation: i})
+	}
+	return files
+}
@@ -0,0 +1,107 @@
+// Package main provides masking of secrets in logs for KampusVPN.
+// At debug level sing-box echoes outbound options (uuid, password) on failed
+// handshakes; lines are scrubbed before they reach the log file or the UI.
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// secretConfigKeys are config fields whose values are credentials
+var secretConfigKeys = map[string]bool{
+	"uuid":           true,
+	"password":       true,
+	"private_key":    true,
+	"pre_shared_key": true,
+	"secret":         true,
+	"auth_str":       true,
+}
+
+var (
+	// password: xxx / "password":"xxx" / password=xxx
+	passwordMarkerPattern = regexp.MustCompile(`(?i)("?password"?\s*[:=]\s*"?)([^"\s,}\]]+)`)
+	// Base64 of a 32-byte key: WireGuard private/public/preshared keys
+	wireGuardKeyPattern = regexp.MustCompile(`[A-Za-z0-9+/]{42}[AEIMQUYcgkosw048]=`)
+)
+
+// minMaskedSecretLen is the length below which secrets are masked completely
+const minMaskedSecretLen = 12
+
+// maskSecret returns a stable placeholder that keeps lines correlatable
+func maskSecret(secret string) string {
+	if len(secret) < minMaskedSecretLen {
+		return "****"
+	}
+	return secret[:4] + "…" + secret[len(secret)-4:]
+}
+
+// LogScrubber masks credentials of the active profile in log lines.
+// Build it once per connect; Scrub is safe for concurrent use.
+type LogScrubber struct {
+	known *strings.Replacer // Exact secrets from the config
+}
+
+// NewLogScrubber collects secrets from a sing-box config and WireGuard configs.
+func NewLogScrubber(config map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) *LogScrubber {
+	secrets := map[string]bool{}
+	collectConfigSecrets(config, secrets)
+	for _, wg := range wireGuardConfigs {
+		for _, s := range []string{wg.PrivateKey.Value(), wg.PresharedKey.Value()} {
+			if s != "" {
+				secrets[s] = true
+			}
+		}
+	}
+
+	pairs := make([]string, 0, len(secrets)*4)
+	for s := range secrets {
+		pairs = append(pairs, s, maskSecret(s))
+		// sing-box may print UUIDs in another case
+		if upper := strings.ToUpper(s); upper != s {
+			pairs = append(pairs, upper, maskSecret(upper))
+		}
+	}
+	return &LogScrubber{known: strings.NewReplacer(pairs...)}
+}
+
+// collectConfigSecrets walks decoded JSON and gathers values of secret fields
+func collectConfigSecrets(v interface{}, secrets map[string]bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			if s, ok := item.(string); ok && secretConfigKeys[key] && s != "" {
+				secrets[s] = true
+				continue
+			}
+			collectConfigSecrets(item, secrets)
+		}
+	case SingboxConfigMap:
+		collectConfigSecrets(map[string]interface{}(val), secrets)
+	case []interface{}:
+		for _, item := range val {
+			collectConfigSecrets(item, secrets)
+		}
+	}
+}
+
+// Scrub masks known secrets, password values and WireGuard keys in line.
+// A nil scrubber still masks the generic patterns.
+func (s *LogScrubber) Scrub(line string) string {
+	if s != nil && s.known != nil {
+		line = s.known.Replace(line)
+	}
+	if strings.Contains(strings.ToLower(line), "password") {
+		line = passwordMarkerPattern.ReplaceAllStringFunc(line, func(match string) string {
+			parts := passwordMarkerPattern.FindStringSubmatch(match)
+			if strings.Contains(parts[2], "…") || parts[2] == "****" {
+				return match // Already masked
+			}
+			return parts[1] + maskSecret(parts[2])
+		})
+	}
+	if strings.Contains(line, "=") {
+		line = wireGuardKeyPattern.ReplaceAllStringFunc(line, maskSecret)
+	}
+	return line
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Secrets of the synthetic profile
+var (
+	scrubUUID         = "b831381d-6324-4d53-ad4f-8cda48b30811"
+	scrubPassword     = "Tr0janPassw0rd-Secret"
+	scrubClashSecret  = "c1a5h-api-5ecret-token-0042"
+	scrubPrivateKey   = base64.StdEncoding.EncodeToString([]byte("wireguard-private-key-32-bytes!!"))
+	scrubPresharedKey = base64.StdEncoding.EncodeToString([]byte("wireguard-preshared-key-32bytes!"))
+	scrubPeerKey      = base64.StdEncoding.EncodeToString([]byte("peer-public-key-not-in-config-32"))
+	scrubStrayPass    = "hunter2hunter2"
+)
+
+// testScrubber returns a scrubber built from a config holding the secrets above
+func testScrubber() *LogScrubber {
+	config := map[string]interface{}{
+		"outbounds": []interface{}{
+			map[string]interface{}{"type": "vless", "tag": "de-1", "uuid": scrubUUID},
+			map[string]interface{}{"type": "trojan", "tag": "nl-1", "password": scrubPassword},
+		},
+		"experimental": map[string]interface{}{
+			"clash_api": map[string]interface{}{"secret": scrubClashSecret},
+		},
+	}
+	wg := []UserWireGuardConfig{{Tag: "office", PrivateKey: NewSecret(scrubPrivateKey), PresharedKey: NewSecret(scrubPresharedKey)}}
+	return NewLogScrubber(config, wg)
+}
+
+// syntheticSingboxLines are debug lines echoing each kind of secret
+func syntheticSingboxLines() []string {
+	return []string{
+		`+0300 2026-10-17 12:00:00 DEBUG [1234 5ms] outbound/vless[de-1]: options {"type":"vless","server":"de.example.com","uuid":"` + scrubUUID + `","flow":"xtls-rprx-vision"}`,
+		`+0300 2026-10-17 12:00:01 DEBUG [1235 1ms] outbound/vless[de-1]: user ` + strings.ToUpper(scrubUUID) + ` rejected`,
+		`+0300 2026-10-17 12:00:02 WARN [1236 3ms] outbound/trojan[nl-1]: handshake failed, password: ` + scrubPassword,
+		`DEBUG outbound/trojan[nl-1]: {"password":"` + scrubPassword + `","server_port":443}`,
+		`DEBUG endpoint/wireguard[office]: private_key=` + scrubPrivateKey + ` preshared_key=` + scrubPresharedKey,
+		`DEBUG endpoint/wireguard[office]: peer public_key=` + scrubPeerKey,
+		`DEBUG clash-api: authorization Bearer ` + scrubClashSecret,
+		`DEBUG outbound/shadowsocks[us]: password=` + scrubStrayPass + ` method=aes-128-gcm`,
+	}
+}
+
+// assertScrubbed checks that no secret survived in output
+func assertScrubbed(t *testing.T, channel, output string) {
+	t.Helper()
+	for _, secret := range []string{scrubUUID, strings.ToUpper(scrubUUID), scrubPassword, scrubClashSecret,
+		scrubPrivateKey, scrubPresharedKey, scrubPeerKey, scrubStrayPass} {
+		if strings.Contains(output, secret) {
+			t.Errorf("%s leaks %q:\n%s", channel, secret, output)
+		}
+	}
+}
+
+func TestLogScrubberScrub(t *testing.T) {
+	scrubber := testScrubber()
+	lines := syntheticSingboxLines()
+	for _, line := range lines {
+		assertScrubbed(t, "Scrub", scrubber.Scrub(line))
+	}
+
+	// Placeholders keep lines correlatable
+	if got := scrubber.Scrub(lines[0]); !strings.Contains(got, maskSecret(scrubUUID)) || !strings.Contains(got, "de.example.com") {
+		t.Errorf("Scrub = %q", got)
+	}
+	if got := scrubber.Scrub(lines[2]); !strings.HasSuffix(got, "password: "+maskSecret(scrubPassword)) {
+		t.Errorf("Scrub = %q", got)
+	}
+	if scrubber.Scrub(lines[0]) != scrubber.Scrub(lines[0]) {
+		t.Error("placeholder not stable")
+	}
+	// Masking twice changes nothing
+	once := scrubber.Scrub(lines[3])
+	if twice := scrubber.Scrub(once); twice != once {
+		t.Errorf("second pass = %q, want %q", twice, once)
+	}
+
+	plain := "INFO inbound/tun[tun-in]: started at 172.19.0.1/30"
+	if got := scrubber.Scrub(plain); got != plain {
+		t.Errorf("plain line changed: %q", got)
+	}
+
+	// Without a profile the generic patterns still apply
+	var none *LogScrubber
+	if got := none.Scrub(lines[7]); strings.Contains(got, scrubStrayPass) {
+		t.Errorf("nil scrubber = %q", got)
+	}
+	if got := none.Scrub(lines[5]); strings.Contains(got, scrubPeerKey) {
+		t.Errorf("nil scrubber = %q", got)
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct{ secret, want string }{
+		{"short", "****"},
+		{"exactly12chr", "exac…2chr"},
+		{scrubUUID, "b831…0811"},
+	}
+	for _, tt := range tests {
+		if got := maskSecret(tt.secret); got != tt.want {
+			t.Errorf("maskSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestLogOutputScrubsAllChannels(t *testing.T) {
+	a, _ := testActivationApp(t)
+	logPath := filepath.Join(t.TempDir(), "vpn.log")
+	logFile, err := OpenRotatingLogFile(logPath, MaxLogSize, LogRotateKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.logFile = logFile
+	a.logScrubber.Store(testScrubber())
+
+	a.logOutput(strings.NewReader(strings.Join(syntheticSingboxLines(), "\n")), "sing-box")
+	a.AddToLogBuffer("Bearer " + scrubClashSecret)
+	a.writeLog("WireGuard key " + scrubPrivateKey)
+	a.closeLogFile()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertScrubbed(t, "log file", string(data))
+	if !strings.Contains(string(data), maskSecret(scrubUUID)) {
+		t.Errorf("log file lacks the masked uuid:\n%s", data)
+	}
+
+	logs := a.GetLogs("", "", 0)
+	lines, _ := logs["logs"].([]string)
+	if len(lines) != len(syntheticSingboxLines())+1 {
+		t.Fatalf("UI log = %d lines, want %d", len(lines), len(syntheticSingboxLines())+1)
+	}
+	assertScrubbed(t, "UI log", strings.Join(lines, "\n"))
+	// Searching for a secret finds nothing
+	if found := a.GetLogs("", scrubPassword, 0)["matched"]; found != 0 {
+		t.Errorf("search by password matched %v entries", found)
+	}
+}
@@ -0,0 +1,145 @@
+// Package main provides the structured UI log of KampusVPN.
+// Every entry keeps its time, source and level, so the log viewer can filter
+// by level and search instead of receiving a raw text tail. Levels of sing-box
+// output are parsed from its log line format.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Levels sing-box logs besides the ones of LogLevel settings
+const (
+	LogLevelTrace LogLevel = "trace"
+	LogLevelFatal LogLevel = "fatal"
+	LogLevelPanic LogLevel = "panic"
+)
+
+// logLevelRank orders levels by severity
+var logLevelRank = map[LogLevel]int{
+	LogLevelTrace: 0,
+	LogLevelDebug: 1,
+	LogLevelInfo:  2,
+	LogLevelWarn:  3,
+	LogLevelError: 4,
+	LogLevelFatal: 5,
+	LogLevelPanic: 6,
+}
+
+// Log entry sources
+const (
+	LogSourceOut       = "OUT"       // sing-box stdout
+	LogSourceErr       = "ERR"       // sing-box stderr
+	LogSourceApp       = "APP"       // Application messages
+	LogSourceWireGuard = "WireGuard" // Native WireGuard tunnels
+)
+
+// LogEntry is one line of the UI log.
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Level   LogLevel  `json:"level"`
+	Message string    `json:"message"`
+}
+
+// String formats the entry the way the log viewer has always shown it
+func (e LogEntry) String() string {
+	if e.Source == LogSourceApp || e.Source == LogSourceWireGuard {
+		return fmt.Sprintf("[%s] %s", e.Time.Format("15:04:05"), e.Message)
+	}
+	return fmt.Sprintf("[%s] [%s] %s", e.Time.Format("15:04:05"), e.Source, e.Message)
+}
+
+// IsError reports whether the entry is error level or worse
+func (e LogEntry) IsError() bool {
+	return logLevelRank[e.Level] >= logLevelRank[LogLevelError]
+}
+
+// ansiEscapePattern matches color codes sing-box adds when stdout looks like a terminal
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// parseSingboxLogLine extracts the level of a sing-box log line:
+// "+0300 2024-05-01 12:00:00 ERROR [1234 5ms] message", or "ERROR message"
+// with timestamps disabled. Lines without a level are info.
+func parseSingboxLogLine(line string) (LogLevel, string) {
+	line = ansiEscapePattern.ReplaceAllString(line, "")
+	fields := strings.Fields(line)
+	// The level follows at most the zone, date and time fields
+	for i := 0; i < len(fields) && i < 4; i++ {
+		level := LogLevel(strings.ToLower(fields[i]))
+		if _, ok := logLevelRank[level]; ok && fields[i] == strings.ToUpper(fields[i]) {
+			return level, line
+		}
+	}
+	return LogLevelInfo, line
+}
+
+// LogStore keeps the last MaxLogBufferSize UI log entries.
+type LogStore struct {
+	mu      sync.RWMutex
+	entries []LogEntry
+}
+
+// NewLogStore creates an empty log store.
+func NewLogStore() *LogStore {
+	return &LogStore{entries: make([]LogEntry, 0, MaxLogBufferSize)}
+}
+
+// Add appends an entry, dropping the oldest ones when the store is full
+func (s *LogStore) Add(entry LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= MaxLogBufferSize {
+		s.entries = s.entries[100:] // Remove first 100 entries
+	}
+	s.entries = append(s.entries, entry)
+}
+
+// Query returns the last limit entries (0 = all) of at least minLevel ("" = any)
+// whose message or source contains search (case-insensitive).
+// Returns the entries and the number of entries that matched.
+func (s *LogStore) Query(minLevel LogLevel, search string, limit int) ([]LogEntry, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	minRank := logLevelRank[minLevel]
+	search = strings.ToLower(search)
+
+	matched := []LogEntry{}
+	for _, entry := range s.entries {
+		if logLevelRank[entry.Level] < minRank {
+			continue
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(entry.Message), search) &&
+			!strings.Contains(strings.ToLower(entry.Source), search) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	total := len(matched)
+	if limit > 0 && limit < total {
+		matched = matched[total-limit:]
+	}
+	return matched, total
+}
+
+// Len returns the number of stored entries
+func (s *LogStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// Clear removes all entries
+func (s *LogStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make([]LogEntry, 0, MaxLogBufferSize)
+}
@@ -0,0 +1,98 @@
+// Package main provides sing-box multiplex settings for KampusVPN.
+// A link may ask for multiplex with mux=1&mux_protocol=h2mux&mux_max_streams=8;
+// proxies without these params get the global default when it is enabled.
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultMuxProtocol is used when multiplex is on and no protocol is given
+const DefaultMuxProtocol = "smux"
+
+// muxProtocols are multiplex protocols supported by sing-box
+var muxProtocols = map[string]bool{
+	"smux":  true,
+	"yamux": true,
+	"h2mux": true,
+}
+
+// MultiplexSettings is the global multiplex default for proxies whose links don't set it
+type MultiplexSettings struct {
+	Enabled    bool   `json:"enabled"`
+	Protocol   string `json:"protocol,omitempty"`    // smux/yamux/h2mux ("" = smux)
+	MaxStreams int    `json:"max_streams,omitempty"` // Streams per connection (0 = sing-box default)
+}
+
+// ValidateMultiplex returns an error for an unknown protocol or a negative stream limit
+func ValidateMultiplex(protocol string, maxStreams int) error {
+	if protocol != "" && !muxProtocols[protocol] {
+		return fmt.Errorf("неизвестный протокол мультиплексирования: %s", protocol)
+	}
+	if maxStreams < 0 {
+		return fmt.Errorf("число потоков не может быть отрицательным")
+	}
+	return nil
+}
+
+// multiplexSupported reports whether sing-box accepts multiplex for the proxy.
+// XTLS flows carry raw TLS records and break inside a mux stream.
+func multiplexSupported(p *ProxyConfig) bool {
+	switch p.Type {
+	case "vless":
+		return p.Flow == ""
+	case "vmess", "trojan", "shadowsocks":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseMultiplexParams reads mux, mux_protocol and mux_max_streams of a share link
+func parseMultiplexParams(q url.Values, cfg *ProxyConfig) {
+	switch strings.ToLower(q.Get("mux")) {
+	case "1", "true", "on":
+		cfg.Mux = true
+	default:
+		return
+	}
+	if protocol := strings.ToLower(q.Get("mux_protocol")); muxProtocols[protocol] {
+		cfg.MuxProtocol = protocol
+	}
+	if n, err := strconv.Atoi(q.Get("mux_max_streams")); err == nil && n > 0 {
+		cfg.MuxMaxStreams = n
+	}
+}
+
+// applyDefaultMultiplex turns on the global multiplex default for a proxy whose link doesn't set it
+func applyDefaultMultiplex(p *ProxyConfig, settings MultiplexSettings) {
+	if !settings.Enabled || p.Mux {
+		return
+	}
+	p.Mux = true
+	p.MuxProtocol = settings.Protocol
+	p.MuxMaxStreams = settings.MaxStreams
+}
+
+// buildMultiplex returns the sing-box multiplex block of the proxy (nil if off or unsupported)
+func buildMultiplex(p *ProxyConfig) map[string]interface{} {
+	if !p.Mux || !multiplexSupported(p) {
+		return nil
+	}
+
+	protocol := p.MuxProtocol
+	if protocol == "" {
+		protocol = DefaultMuxProtocol
+	}
+	multiplex := map[string]interface{}{
+		"enabled":  true,
+		"protocol": protocol,
+	}
+	if p.MuxMaxStreams > 0 {
+		multiplex["max_streams"] = p.MuxMaxStreams
+	}
+	return multiplex
+}
@@ -0,0 +1,99 @@
+// Package main provides network change detection for KampusVPN.
+// Switching from Ethernet to Wi-Fi or resuming from sleep leaves sing-box
+// with connections bound to the old network and WireGuard tunnels waiting
+// minutes for a re-handshake. The connected adapters, their addresses and
+// gateways are polled, and a change that stays put for a few seconds is
+// reported once instead of once per flap.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Network change detection settings
+const (
+	// NetworkPollInterval is how often the network fingerprint is re-read while connected.
+	NetworkPollInterval = 3 * time.Second
+	// NetworkChangeDebounce is how long a new fingerprint must stay unchanged before it is handled.
+	NetworkChangeDebounce = 6 * time.Second
+	// NetworkChangeHandshakeWait is how long WireGuard tunnels get to re-handshake after a change.
+	NetworkChangeHandshakeWait = 20 * time.Second
+)
+
+var (
+	modDnsapi                 = windows.NewLazySystemDLL("dnsapi.dll")
+	procDnsFlushResolverCache = modDnsapi.NewProc("DnsFlushResolverCache")
+)
+
+// NetworkFingerprint describes the connected networks: adapters with a default
+// gateway, their addresses and gateways. Equal fingerprints mean the same network.
+type NetworkFingerprint struct {
+	Interfaces []string // Adapter names ordered by metric
+	key        string
+}
+
+// Equal reports whether both fingerprints describe the same network
+func (f NetworkFingerprint) Equal(other NetworkFingerprint) bool {
+	return f.key == other.key
+}
+
+// IsEmpty reports whether no adapter is connected
+func (f NetworkFingerprint) IsEmpty() bool {
+	return f.key == ""
+}
+
+// readNetworkFingerprint returns the fingerprint of the current networks.
+// Virtual adapters (the TUN, WireGuard) are skipped like for the default interface.
+func readNetworkFingerprint() (NetworkFingerprint, error) {
+	interfaces, err := listGatewayInterfaces()
+	if err != nil {
+		return NetworkFingerprint{}, err
+	}
+	first, err := readAdapterAddresses()
+	if err != nil {
+		return NetworkFingerprint{}, err
+	}
+
+	connected := map[uint32]bool{}
+	names := make([]string, 0, len(interfaces))
+	for _, iface := range interfaces {
+		connected[iface.Index] = true
+		names = append(names, iface.Name)
+	}
+
+	parts := []string{}
+	for aa := first; aa != nil; aa = aa.Next {
+		if !connected[aa.IfIndex] {
+			continue
+		}
+		addresses := []string{}
+		for ua := aa.FirstUnicastAddress; ua != nil; ua = ua.Next {
+			addresses = append(addresses, ua.Address.IP().String())
+		}
+		for ga := aa.FirstGatewayAddress; ga != nil; ga = ga.Next {
+			addresses = append(addresses, "gw="+ga.Address.IP().String())
+		}
+		sort.Strings(addresses)
+		parts = append(parts, fmt.Sprintf("%d:%s", aa.IfIndex, strings.Join(addresses, ",")))
+	}
+	sort.Strings(parts)
+
+	return NetworkFingerprint{Interfaces: names, key: strings.Join(parts, ";")}, nil
+}
+
+// flushDNSCache empties the Windows DNS client cache (ipconfig /flushdns)
+func flushDNSCache() error {
+	if err := procDnsFlushResolverCache.Find(); err != nil {
+		return err
+	}
+	ret, _, callErr := procDnsFlushResolverCache.Call()
+	if ret == 0 {
+		return fmt.Errorf("DnsFlushResolverCache failed: %v", callErr)
+	}
+	return nil
+}
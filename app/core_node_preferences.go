@@ -0,0 +1,151 @@
+// Package main provides per-profile node preferences for KampusVPN.
+// Favorite servers are pinned to the top of the "proxy" selector right after
+// auto-select, junk servers are hidden from both the selector and auto-select.
+// Preferences are keyed by the generated outbound tag, so they survive
+// subscription refreshes; tags that leave the subscription are dropped.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodePreferences are the pinned and hidden proxies of a profile.
+type NodePreferences struct {
+	Pinned []string `json:"pinned,omitempty"` // Tags shown first in the selector, in this order
+	Hidden []string `json:"hidden,omitempty"` // Tags left out of the config
+}
+
+// Empty reports whether no proxy is pinned or hidden.
+func (p *NodePreferences) Empty() bool {
+	return p == nil || (len(p.Pinned) == 0 && len(p.Hidden) == 0)
+}
+
+// normalize trims and dedupes the tags; a tag both pinned and hidden stays hidden
+func (p NodePreferences) normalize() NodePreferences {
+	hidden := uniqueTags(p.Hidden, nil)
+	skip := make(map[string]bool, len(hidden))
+	for _, tag := range hidden {
+		skip[tag] = true
+	}
+	return NodePreferences{Pinned: uniqueTags(p.Pinned, skip), Hidden: hidden}
+}
+
+// uniqueTags returns the non-empty tags in order without duplicates and skipped ones
+func uniqueTags(tags []string, skip map[string]bool) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] || skip[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// prune drops tags that aren't in the snapshot and returns them
+func (p *NodePreferences) prune(snapshot []ProxySnapshotEntry) []string {
+	if p.Empty() {
+		return nil
+	}
+	present := make(map[string]bool, len(snapshot))
+	for _, e := range snapshot {
+		present[e.Tag] = true
+	}
+
+	var removed []string
+	keep := func(tags []string) []string {
+		var kept []string
+		for _, tag := range tags {
+			if present[tag] {
+				kept = append(kept, tag)
+			} else {
+				removed = append(removed, tag)
+			}
+		}
+		return kept
+	}
+	p.Pinned = keep(p.Pinned)
+	p.Hidden = keep(p.Hidden)
+	return removed
+}
+
+// removeHiddenProxies returns the proxies that aren't hidden and the number removed
+func removeHiddenProxies(proxies []ProxyConfig, prefs *NodePreferences) ([]ProxyConfig, int) {
+	if prefs == nil || len(prefs.Hidden) == 0 {
+		return proxies, 0
+	}
+	hidden := make(map[string]bool, len(prefs.Hidden))
+	for _, tag := range prefs.Hidden {
+		hidden[tag] = true
+	}
+
+	visible := make([]ProxyConfig, 0, len(proxies))
+	for _, p := range proxies {
+		if !hidden[p.Tag] {
+			visible = append(visible, p)
+		}
+	}
+	return visible, len(proxies) - len(visible)
+}
+
+// splitPinnedTags returns the pinned tags present in tags (in pin order) and
+// the rest of tags in their original order
+func splitPinnedTags(tags []string, pinned []string) ([]string, []string) {
+	if len(pinned) == 0 {
+		return nil, tags
+	}
+	present := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		present[tag] = true
+	}
+
+	var first []string
+	isFirst := map[string]bool{}
+	for _, tag := range pinned {
+		if present[tag] && !isFirst[tag] {
+			isFirst[tag] = true
+			first = append(first, tag)
+		}
+	}
+	rest := make([]string, 0, len(tags)-len(first))
+	for _, tag := range tags {
+		if !isFirst[tag] {
+			rest = append(rest, tag)
+		}
+	}
+	return first, rest
+}
+
+// --- Storage ---
+
+// SetProfileNodePreferences saves the pinned and hidden proxies of a profile.
+// Tags missing from the last subscription snapshot are dropped and returned
+// along with the saved preferences.
+func (s *Storage) SetProfileNodePreferences(id int, prefs NodePreferences) (*NodePreferences, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		profile := &s.data.Profiles[i]
+		if profile.ID != id {
+			continue
+		}
+
+		saved := prefs.normalize()
+		var unknown []string
+		if profile.ProxySnapshot != nil {
+			unknown = saved.prune(profile.ProxySnapshot)
+		}
+		if saved.Empty() {
+			profile.NodePreferences = nil
+		} else {
+			profile.NodePreferences = &saved
+		}
+		return &saved, unknown, s.saveInternal()
+	}
+	return nil, nil, fmt.Errorf("profile with ID %d not found", id)
+}
@@ -0,0 +1,94 @@
+// Package main provides desktop notifications for KampusVPN.
+// On Windows a toast is shown through the WinRT ToastNotificationManager from
+// a hidden PowerShell process; on other systems notifications are dropped.
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// Notifier settings
+const (
+	// NotificationTimeout limits the PowerShell process showing one toast.
+	NotificationTimeout = 15 * time.Second
+	// NotificationMinInterval drops a repeat of the same notification within this time.
+	NotificationMinInterval = 30 * time.Second
+	// notificationAppID is the AppUserModelID toasts are shown under. The app
+	// has no registered ID of its own, and toasts of unregistered IDs are
+	// silently dropped, so the PowerShell ID is borrowed.
+	notificationAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+)
+
+// Notifier shows desktop notifications
+type Notifier struct {
+	mu       sync.Mutex
+	lastSent map[string]time.Time // Last time each title+message was shown
+	show     func(title, message string) error
+}
+
+// NewNotifier creates a notifier for the current OS
+func NewNotifier() *Notifier {
+	n := &Notifier{lastSent: make(map[string]time.Time)}
+	if runtime.GOOS == "windows" {
+		n.show = showWindowsToast
+	} else {
+		n.show = func(title, message string) error { return nil }
+	}
+	return n
+}
+
+// Notify shows a notification. The same notification repeated within
+// NotificationMinInterval is skipped (a flapping tunnel shouldn't flood the screen).
+func (n *Notifier) Notify(title, message string) error {
+	key := title + "\n" + message
+	n.mu.Lock()
+	if last, ok := n.lastSent[key]; ok && time.Since(last) < NotificationMinInterval {
+		n.mu.Unlock()
+		return nil
+	}
+	n.lastSent[key] = time.Now()
+	n.mu.Unlock()
+
+	return n.show(title, message)
+}
+
+// showWindowsToast shows a toast with two lines of text
+func showWindowsToast(title, message string) error {
+	script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode(` + powerShellQuote(title) + `)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode(` + powerShellQuote(message) + `)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(` + powerShellQuote(notificationAppID) + `).Show($toast)`
+
+	output, err := runHiddenCommand(NotificationTimeout, "powershell",
+		"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"-EncodedCommand", encodePowerShellCommand(script))
+	if err != nil {
+		return fmt.Errorf("toast: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// powerShellQuote returns s as a single-quoted PowerShell string literal
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodePowerShellCommand encodes a script for -EncodedCommand (base64 of UTF-16LE),
+// which keeps Cyrillic text and quotes intact on any console code page
+func encodePowerShellCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	buf := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		buf = append(buf, byte(u), byte(u>>8))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,195 @@
+// Package main provides proxy reachability tests without a running VPN for KampusVPN.
+// The Clash API delay test needs sing-box; before connecting, servers are
+// checked by the time of a TCP connect (and TLS handshake where the proxy
+// uses TLS) instead. The result is marked DelayMethodTCP so the UI doesn't
+// compare it with URL test delays.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Offline ping settings
+const (
+	OfflinePingWorkers  = 16               // Servers tested at once
+	OfflinePingTimeout  = 3 * time.Second  // Per server (connect plus handshake)
+	OfflinePingDeadline = 10 * time.Second // Whole test, however large the subscription
+)
+
+// udpOnlyOutbounds are proxy types without a TCP port to connect to
+var udpOnlyOutbounds = map[string]bool{
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+	"wireguard": true,
+}
+
+// offlinePingTarget is the server of one proxy outbound
+type offlinePingTarget struct {
+	Name   string
+	Type   string
+	Server string
+	Port   int
+	TLS    bool
+	SNI    string
+}
+
+// OfflinePingResult is the reachability of one proxy server.
+type OfflinePingResult struct {
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	Server      string           `json:"server"`
+	Port        int              `json:"port"`
+	Measurement DelayMeasurement `json:"measurement"`
+	TLSDelay    int              `json:"tls_delay,omitempty"` // ms of the TLS handshake after connect
+	Error       string           `json:"error,omitempty"`
+}
+
+// offlineTargetsFromOutbounds returns the servers of proxy outbounds in a sing-box config
+func offlineTargetsFromOutbounds(outbounds []interface{}) []offlinePingTarget {
+	targets := []offlinePingTarget{}
+	for _, o := range outbounds {
+		outbound, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		server, _ := outbound["server"].(string)
+		port := jsonInt(outbound["server_port"])
+		if server == "" || port == 0 {
+			continue
+		}
+		target := offlinePingTarget{Server: server, Port: port}
+		target.Name, _ = outbound["tag"].(string)
+		target.Type, _ = outbound["type"].(string)
+		if tlsConfig, ok := outbound["tls"].(map[string]interface{}); ok {
+			target.TLS, _ = tlsConfig["enabled"].(bool)
+			target.SNI, _ = tlsConfig["server_name"].(string)
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// offlineTargetsFromProxies returns the servers of parsed subscription proxies
+func offlineTargetsFromProxies(proxies []ProxyConfig) []offlinePingTarget {
+	outbounds := make([]interface{}, 0, len(proxies))
+	for i := range proxies {
+		outbound := proxies[i].ToSingboxOutbound()
+		if proxies[i].Name != "" {
+			outbound["tag"] = proxies[i].Name
+		}
+		outbounds = append(outbounds, outbound)
+	}
+	return offlineTargetsFromOutbounds(outbounds)
+}
+
+// jsonInt converts a JSON number (float64 after decoding, int when built in code)
+func jsonInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// PingProxiesOffline measures connect time to every server with a bounded
+// worker pool. Servers not reached before OfflinePingDeadline stay not tested.
+// Results keep the order of targets.
+func PingProxiesOffline(targets []offlinePingTarget) []OfflinePingResult {
+	ctx, cancel := context.WithTimeout(context.Background(), OfflinePingDeadline)
+	defer cancel()
+
+	results := make([]OfflinePingResult, len(targets))
+	for i, t := range targets {
+		results[i] = OfflinePingResult{
+			Name:        t.Name,
+			Type:        t.Type,
+			Server:      t.Server,
+			Port:        t.Port,
+			Measurement: DelayMeasurement{Status: DelayStatusNotTested, Method: DelayMethodTCP},
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < OfflinePingWorkers && w < len(targets); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				pingTarget(ctx, targets[i], &results[i])
+			}
+		}()
+	}
+
+feed:
+	for i := range targets {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range results {
+		if results[i].Measurement.Status == DelayStatusNotTested && results[i].Error == "" {
+			results[i].Error = "не проверен: превышено время теста"
+		}
+	}
+	return results
+}
+
+// pingTarget measures one server into result
+func pingTarget(ctx context.Context, target offlinePingTarget, result *OfflinePingResult) {
+	if udpOnlyOutbounds[target.Type] {
+		result.Error = "UDP протокол: проверка TCP недоступна"
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, OfflinePingTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(target.Server, strconv.Itoa(target.Port))
+	started := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Measurement = NewDelayMeasurement(0, err, time.Now())
+		result.Measurement.Method = DelayMethodTCP
+		result.Error = err.Error()
+		return
+	}
+	defer conn.Close()
+
+	delay := int(time.Since(started).Milliseconds())
+	if delay == 0 {
+		delay = 1 // Same host: 0 would read as failed
+	}
+	result.Measurement = NewDelayMeasurement(delay, nil, time.Now())
+	result.Measurement.Method = DelayMethodTCP
+
+	if !target.TLS {
+		return
+	}
+	sni := target.SNI
+	if sni == "" {
+		sni = target.Server
+	}
+	// Only the handshake time matters: the certificate is checked by sing-box
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: sni, InsecureSkipVerify: true})
+	handshakeStarted := time.Now()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		result.Error = fmt.Sprintf("TLS: %v", err)
+		return
+	}
+	result.TLSDelay = int(time.Since(handshakeStarted).Milliseconds())
+}
@@ -0,0 +1,152 @@
+// Package main provides portable-mode storage handling for KampusVPN.
+// When the app runs from a USB stick the drive can disappear at any time;
+// settings are then kept in memory and written once the drive is back.
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Portable mode write settings
+const (
+	// PortableWriteRetries is the number of write attempts for transient failures.
+	PortableWriteRetries = 3
+	// PortableWriteBackoff is the delay before the first retry (doubled each time).
+	PortableWriteBackoff = 100 * time.Millisecond
+	// PortableDrivePollInterval is how often a missing drive is checked for.
+	PortableDrivePollInterval = 5 * time.Second
+)
+
+// ErrStorageDriveGone is returned when the drive with settings is not available
+var ErrStorageDriveGone = errors.New("Диск с программой недоступен. Подключите его снова, изменения сохранятся автоматически")
+
+// driveGoneErrors are Windows errors returned for files on a removed drive
+var driveGoneErrors = []error{
+	windows.ERROR_NOT_READY,
+	windows.ERROR_DEV_NOT_EXIST,
+	windows.ERROR_INVALID_DRIVE,
+	windows.ERROR_PATH_NOT_FOUND,
+}
+
+// isDriveGoneError reports whether err means the drive (not the file) is missing.
+// Permission errors are reported separately by os.IsPermission.
+func isDriveGoneError(err error) bool {
+	for _, target := range driveGoneErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeRoot returns the drive root of path ("E:\")
+func volumeRoot(path string) string {
+	return filepath.VolumeName(path) + `\`
+}
+
+// isRemovableDrive reports whether path is on removable media (USB stick, card)
+func isRemovableDrive(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	root, err := windows.UTF16PtrFromString(volumeRoot(abs))
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(root) == windows.DRIVE_REMOVABLE
+}
+
+// volumePresent reports whether the drive of path is mounted
+func volumePresent(path string) bool {
+	_, err := os.Stat(volumeRoot(path))
+	return err == nil
+}
+
+// SetPortable enables write-with-retry and in-memory queueing of failed saves.
+func (s *Storage) SetPortable(portable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portable = portable
+}
+
+// IsPortable reports whether storage runs in portable mode.
+func (s *Storage) IsPortable() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.portable
+}
+
+// PendingChanges reports whether settings changed in memory could not be written yet,
+// and the last write error.
+func (s *Storage) PendingChanges() (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pending, s.pendingErr
+}
+
+// writeSettings writes serialized settings. In portable mode transient failures
+// are retried with backoff, and if the drive is gone the change stays queued in
+// memory (nil is returned). Permission errors are never queued.
+// Must be called with s.mu held.
+func (s *Storage) writeSettings(data []byte) error {
+	if !s.portable {
+		return s.writeFile(s.settingsPath, data, 0644)
+	}
+
+	var err error
+	backoff := PortableWriteBackoff
+	for attempt := 0; attempt < PortableWriteRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = s.writeFile(s.settingsPath, data, 0644)
+		if err == nil {
+			s.pending = false
+			s.pendingErr = nil
+			return nil
+		}
+		if isDriveGoneError(err) || os.IsPermission(err) {
+			break
+		}
+	}
+
+	if os.IsPermission(err) {
+		return err
+	}
+
+	s.pending = true
+	s.pendingErr = err
+	return nil
+}
+
+// FlushPendingChanges writes in-memory settings to disk right away.
+// Returns ErrStorageDriveGone if the drive is still missing.
+func (s *Storage) FlushPendingChanges() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.marshalSettings()
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeFile(s.settingsPath, data, 0644); err != nil {
+		s.pendingErr = err
+		if isDriveGoneError(err) {
+			s.pending = true
+			return ErrStorageDriveGone
+		}
+		return err
+	}
+
+	s.pending = false
+	s.pendingErr = nil
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// flakyDrive replaces the storage writer: while fail is set every write returns it
+type flakyDrive struct {
+	mu     sync.Mutex
+	fail   []error // Errors of the next writes, the last one repeats
+	writes int
+	write  func(name string, data []byte, perm os.FileMode) error
+}
+
+func (d *flakyDrive) set(errs ...error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fail = errs
+	d.writes = 0
+}
+
+func (d *flakyDrive) writeFile(name string, data []byte, perm os.FileMode) error {
+	d.mu.Lock()
+	d.writes++
+	var err error
+	if len(d.fail) > 0 {
+		err = d.fail[0]
+		if len(d.fail) > 1 {
+			d.fail = d.fail[1:]
+		}
+	}
+	d.mu.Unlock()
+	if err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return d.write(name, data, perm)
+}
+
+// testPortableStorage returns an initialized storage whose writes go through a flakyDrive
+func testPortableStorage(t *testing.T, portable bool) (*Storage, *flakyDrive, string) {
+	t.Helper()
+	base := t.TempDir()
+	storage := NewStorage(base)
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	drive := &flakyDrive{write: storage.writeFile}
+	storage.writeFile = drive.writeFile
+	storage.SetPortable(portable)
+	return storage, drive, base
+}
+
+// storedProfileName reads the default profile name from settings.json on disk
+func storedProfileName(t *testing.T, base string) string {
+	t.Helper()
+	storage := NewStorage(base)
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.GetProfile(DefaultProfileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile.Name
+}
+
+func TestIsDriveGoneError(t *testing.T) {
+	tests := []struct {
+		err  error
+		gone bool
+	}{
+		{windows.ERROR_NOT_READY, true},
+		{windows.ERROR_DEV_NOT_EXIST, true},
+		{windows.ERROR_INVALID_DRIVE, true},
+		{windows.ERROR_PATH_NOT_FOUND, true},
+		{windows.ERROR_FILE_NOT_FOUND, false},
+		{windows.ERROR_SHARING_VIOLATION, false},
+		{os.ErrPermission, false},
+		{errors.New("disk full"), false},
+	}
+
+	for _, tt := range tests {
+		err := &os.PathError{Op: "open", Path: `E:\KampusVPN\resources\settings.json`, Err: tt.err}
+		if got := isDriveGoneError(err); got != tt.gone {
+			t.Errorf("isDriveGoneError(%v) = %v, want %v", tt.err, got, tt.gone)
+		}
+	}
+}
+
+func TestPortableStorageDriveGoneAndBack(t *testing.T) {
+	storage, drive, base := testPortableStorage(t, true)
+
+	drive.set(windows.ERROR_NOT_READY)
+	if err := storage.UpdateProfile(DefaultProfileID, "Renamed"); err != nil {
+		t.Fatalf("UpdateProfile with the drive gone = %v, want the change queued", err)
+	}
+	if drive.writes != 1 {
+		t.Errorf("writes = %d, a missing drive must not be retried", drive.writes)
+	}
+	pending, lastErr := storage.PendingChanges()
+	if !pending || !isDriveGoneError(lastErr) {
+		t.Fatalf("PendingChanges = %v, %v; want pending with the drive error", pending, lastErr)
+	}
+	if profile, _ := storage.GetProfile(DefaultProfileID); profile.Name != "Renamed" {
+		t.Errorf("in-memory name = %q, want the queued change", profile.Name)
+	}
+	if name := storedProfileName(t, base); name == "Renamed" {
+		t.Error("the change reached the disk while the drive was gone")
+	}
+
+	// Still gone: flushing keeps the queue
+	if err := storage.FlushPendingChanges(); err != ErrStorageDriveGone {
+		t.Fatalf("FlushPendingChanges = %v, want ErrStorageDriveGone", err)
+	}
+	if pending, _ := storage.PendingChanges(); !pending {
+		t.Fatal("queue dropped by a failed flush")
+	}
+
+	// The drive is back
+	drive.set()
+	if err := storage.FlushPendingChanges(); err != nil {
+		t.Fatalf("FlushPendingChanges = %v", err)
+	}
+	if pending, lastErr := storage.PendingChanges(); pending || lastErr != nil {
+		t.Errorf("PendingChanges = %v, %v after the flush", pending, lastErr)
+	}
+	if name := storedProfileName(t, base); name != "Renamed" {
+		t.Errorf("stored name = %q, want the flushed change", name)
+	}
+}
+
+func TestPortableStorageWriteFailures(t *testing.T) {
+	transient := windows.ERROR_SHARING_VIOLATION
+
+	tests := []struct {
+		name     string
+		portable bool
+		errs     []error
+		wantErr  bool
+		pending  bool
+		writes   int
+	}{
+		{"retried until it succeeds", true, []error{transient, nil}, false, false, 2},
+		{"retries exhausted", true, []error{transient}, false, true, PortableWriteRetries},
+		{"permission denied", true, []error{os.ErrPermission}, true, false, 1},
+		{"drive gone without portable mode", false, []error{windows.ERROR_NOT_READY}, true, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, drive, base := testPortableStorage(t, tt.portable)
+			drive.set(tt.errs...)
+
+			err := storage.UpdateProfile(DefaultProfileID, "Renamed")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UpdateProfile error = %v, want error %v", err, tt.wantErr)
+			}
+			if drive.writes != tt.writes {
+				t.Errorf("writes = %d, want %d", drive.writes, tt.writes)
+			}
+			if pending, _ := storage.PendingChanges(); pending != tt.pending {
+				t.Errorf("pending = %v, want %v", pending, tt.pending)
+			}
+			saved := storedProfileName(t, base) == "Renamed"
+			if saved != (!tt.wantErr && !tt.pending) {
+				t.Errorf("saved on disk = %v", saved)
+			}
+		})
+	}
+}
+
+func TestFlushPendingChangesAPI(t *testing.T) {
+	storage, drive, _ := testPortableStorage(t, true)
+	a := &App{storage: storage, logStore: NewLogStore(), initialized: true}
+
+	drive.set(windows.ERROR_DEV_NOT_EXIST)
+	if err := storage.UpdateProfile(DefaultProfileID, "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	status := a.getStorageStatus()
+	if status["portable"] != true || status["pendingChanges"] != true || status["message"] != a.tr("pending_changes") {
+		t.Errorf("storage status = %v", status)
+	}
+
+	result := a.FlushPendingChanges()
+	if result["success"] != false || result["pendingChanges"] != true || result["error"] != ErrStorageDriveGone.Error() {
+		t.Errorf("FlushPendingChanges with the drive gone = %v", result)
+	}
+
+	drive.set()
+	if result := a.FlushPendingChanges(); result["success"] != true {
+		t.Fatalf("FlushPendingChanges = %v", result)
+	}
+	status = a.getStorageStatus()
+	if status["pendingChanges"] != false {
+		t.Errorf("storage status after the flush = %v", status)
+	}
+	if _, ok := status["message"]; ok {
+		t.Errorf("message %v shown without pending changes", status["message"])
+	}
+}
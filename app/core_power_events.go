@@ -0,0 +1,113 @@
+// Package main provides suspend/resume notifications for KampusVPN.
+// Tunnels and sing-box outlive a sleep, but their handshakes, connections and
+// sometimes routes don't; subscribers re-check them as soon as the system resumes.
+package main
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modPowrprof                                  = windows.NewLazySystemDLL("powrprof.dll")
+	procPowerRegisterSuspendResumeNotification   = modPowrprof.NewProc("PowerRegisterSuspendResumeNotification")
+	procPowerUnregisterSuspendResumeNotification = modPowrprof.NewProc("PowerUnregisterSuspendResumeNotification")
+)
+
+// Power broadcast events (winuser.h)
+const (
+	pbtAPMSuspend         = 0x4  // PBT_APMSUSPEND
+	pbtAPMResumeAutomatic = 0x12 // PBT_APMRESUMEAUTOMATIC, sent on every resume
+	deviceNotifyCallback  = 2    // DEVICE_NOTIFY_CALLBACK
+)
+
+// deviceNotifySubscribeParameters mirrors DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS.
+type deviceNotifySubscribeParameters struct {
+	Callback uintptr
+	Context  uintptr
+}
+
+// PowerWatcher calls its handlers when the system suspends or resumes.
+type PowerWatcher struct {
+	onSuspend func()
+	onResume  func()
+	handle    uintptr
+	params    *deviceNotifySubscribeParameters // Must stay alive while registered
+}
+
+var (
+	// Callbacks created by windows.NewCallback are never freed, so one is shared
+	powerCallback     uintptr
+	powerCallbackOnce sync.Once
+	powerWatcher      *PowerWatcher
+	powerWatcherMu    sync.Mutex
+)
+
+// powerNotify dispatches a power event to the registered watcher.
+// It runs on a system thread, so handlers are started in goroutines.
+func powerNotify(context, eventType, setting uintptr) uintptr {
+	powerWatcherMu.Lock()
+	w := powerWatcher
+	powerWatcherMu.Unlock()
+	if w == nil {
+		return 0
+	}
+	switch eventType {
+	case pbtAPMSuspend:
+		if w.onSuspend != nil {
+			go w.onSuspend()
+		}
+	case pbtAPMResumeAutomatic:
+		if w.onResume != nil {
+			go w.onResume()
+		}
+	}
+	return 0
+}
+
+// NewPowerWatcher creates a watcher; only one can be started at a time.
+func NewPowerWatcher(onSuspend, onResume func()) *PowerWatcher {
+	return &PowerWatcher{onSuspend: onSuspend, onResume: onResume}
+}
+
+// Start registers for suspend/resume notifications.
+func (w *PowerWatcher) Start() error {
+	if err := procPowerRegisterSuspendResumeNotification.Find(); err != nil {
+		return err
+	}
+	powerCallbackOnce.Do(func() {
+		powerCallback = windows.NewCallback(powerNotify)
+	})
+
+	powerWatcherMu.Lock()
+	defer powerWatcherMu.Unlock()
+	if powerWatcher != nil {
+		return fmt.Errorf("power watcher already started")
+	}
+
+	w.params = &deviceNotifySubscribeParameters{Callback: powerCallback}
+	ret, _, _ := procPowerRegisterSuspendResumeNotification.Call(
+		deviceNotifyCallback,
+		uintptr(unsafe.Pointer(w.params)),
+		uintptr(unsafe.Pointer(&w.handle)),
+	)
+	if ret != 0 {
+		return fmt.Errorf("PowerRegisterSuspendResumeNotification failed: %w", windows.Errno(ret))
+	}
+	powerWatcher = w
+	return nil
+}
+
+// Stop unregisters the watcher.
+func (w *PowerWatcher) Stop() {
+	powerWatcherMu.Lock()
+	defer powerWatcherMu.Unlock()
+	if powerWatcher != w {
+		return
+	}
+	procPowerUnregisterSuspendResumeNotification.Call(w.handle)
+	powerWatcher = nil
+}
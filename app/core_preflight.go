@@ -0,0 +1,119 @@
+// Package main provides the connectivity preflight of KampusVPN.
+// A started sing-box process doesn't mean traffic flows: every outbound may
+// be dead. After start the app waits for the Clash API and requests a 204 URL
+// through the "proxy" selector; only a successful request marks the
+// connection as verified.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Preflight states
+const (
+	PreflightChecking = "checking" // Waiting for the Clash API or the 204 URL
+	PreflightVerified = "verified" // Request through the proxy succeeded
+	PreflightFailed   = "failed"   // No success within PreflightTimeout, VPN keeps running
+)
+
+// Preflight settings
+const (
+	// PreflightTimeout is the overall wait for a request through the proxy.
+	PreflightTimeout = 15 * time.Second
+	// PreflightRetryInterval is the pause between attempts.
+	PreflightRetryInterval = 500 * time.Millisecond
+	// preflightDelayTimeout limits one request through the proxy.
+	preflightDelayTimeout = 5 * time.Second
+)
+
+// errPreflightStopped is returned when the VPN stops during the check
+var errPreflightStopped = errors.New("preflight stopped")
+
+// PreflightStatus is the result of the connectivity check of the current connection.
+type PreflightStatus struct {
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Delay     int       `json:"delay,omitempty"` // Milliseconds of the successful request
+	StartedAt time.Time `json:"started_at"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Verified reports whether traffic through the proxy was confirmed.
+func (s PreflightStatus) Verified() bool {
+	return s.State == PreflightVerified
+}
+
+// Message returns the state text for the UI.
+func (s PreflightStatus) Message() string {
+	switch s.State {
+	case PreflightVerified:
+		return "Подключено"
+	case PreflightFailed:
+		return fmt.Sprintf("Подключено (нет интернета через прокси): %s", s.Error)
+	default:
+		return "Проверка соединения…"
+	}
+}
+
+// ToMap converts the status to API response format.
+func (s PreflightStatus) ToMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"state":      s.State,
+		"verified":   s.Verified(),
+		"message":    s.Message(),
+		"started_at": s.StartedAt.Format(time.RFC3339),
+	}
+	if s.Error != "" {
+		result["error"] = s.Error
+	}
+	if s.Delay > 0 {
+		result["delay"] = s.Delay
+	}
+	if !s.CheckedAt.IsZero() {
+		result["checked_at"] = s.CheckedAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+// RunPreflight waits for the Clash API and then for a successful request
+// through the "proxy" selector, retrying until PreflightTimeout. Returns the
+// delay in milliseconds; errPreflightStopped if stop is closed first.
+func RunPreflight(stop <-chan struct{}) (int, error) {
+	client := &http.Client{Timeout: preflightDelayTimeout + time.Second}
+	deadline := time.Now().Add(PreflightTimeout)
+
+	apiUp := false
+	var lastErr error
+	for {
+		if !apiUp {
+			if resp, err := clashGet(client, "/version"); err == nil {
+				resp.Body.Close()
+				apiUp = resp.StatusCode == http.StatusOK
+				if !apiUp {
+					lastErr = fmt.Errorf("Clash API ответил %d", resp.StatusCode)
+				}
+			} else {
+				lastErr = fmt.Errorf("Clash API недоступен: %v", err)
+			}
+		}
+		if apiUp {
+			delay, err := clashProxyDelay(client, ConnectMeasureSelector, preflightDelayTimeout)
+			if err == nil {
+				return delay, nil
+			}
+			lastErr = fmt.Errorf("запрос через прокси не прошёл: %v", err)
+		}
+
+		if time.Now().Add(PreflightRetryInterval).After(deadline) {
+			return 0, lastErr
+		}
+		select {
+		case <-time.After(PreflightRetryInterval):
+		case <-stop:
+			return 0, errPreflightStopped
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package main provides child process resource sampling for KampusVPN.
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modKernel32                 = windows.NewLazySystemDLL("kernel32.dll")
+	procK32GetProcessMemoryInfo = modKernel32.NewProc("K32GetProcessMemoryInfo")
+)
+
+// processMemoryCounters mirrors PROCESS_MEMORY_COUNTERS from psapi.h.
+type processMemoryCounters struct {
+	CB                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// ProcessSample contains one resource usage sample of a process.
+type ProcessSample struct {
+	WorkingSetMB     int       `json:"working_set_mb"`
+	PeakWorkingSetMB int       `json:"peak_working_set_mb"`
+	CPUPercent       float64   `json:"cpu_percent"`
+	SampledAt        time.Time `json:"sampled_at"`
+}
+
+// processStartSlack allows for the coarse clock of process creation times
+const processStartSlack = 2 * time.Second
+
+// ProcessMonitor samples memory and CPU usage of a child process.
+// The process handle is opened once and kept until Close: a handle pins the
+// process object, so the PID can't be reused by another process under it.
+type ProcessMonitor struct {
+	pid        int
+	handle     windows.Handle // 0 after Close
+	lastCPU    time.Duration
+	lastSample time.Time
+	latest     ProcessSample
+	peakMB     int
+	mu         sync.RWMutex
+}
+
+// NewProcessMonitor opens the process with the given ID. A process created
+// before startedAt is not the one that was launched (its PID was reused).
+func NewProcessMonitor(pid int, startedAt time.Time) (*ProcessMonitor, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		windows.CloseHandle(handle)
+		return nil, fmt.Errorf("GetProcessTimes failed: %w", err)
+	}
+	if created := time.Unix(0, creation.Nanoseconds()); created.Before(startedAt.Add(-processStartSlack)) {
+		windows.CloseHandle(handle)
+		return nil, fmt.Errorf("process %d was created at %s, before the launch: not sing-box", pid, created.Format("15:04:05"))
+	}
+
+	return &ProcessMonitor{pid: pid, handle: handle}, nil
+}
+
+// Close releases the process handle; later samples fail.
+func (m *ProcessMonitor) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.handle != 0 {
+		windows.CloseHandle(m.handle)
+		m.handle = 0
+	}
+}
+
+// Sample takes a new resource sample of the process.
+func (m *ProcessMonitor) Sample() (ProcessSample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.handle == 0 {
+		return ProcessSample{}, fmt.Errorf("process %d: monitor closed", m.pid)
+	}
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(m.handle, &exitCode); err != nil {
+		return ProcessSample{}, fmt.Errorf("GetExitCodeProcess failed: %w", err)
+	}
+	if exitCode != uint32(windows.STATUS_PENDING) { // STILL_ACTIVE
+		return ProcessSample{}, fmt.Errorf("process %d exited with code %d", m.pid, exitCode)
+	}
+
+	var counters processMemoryCounters
+	counters.CB = uint32(unsafe.Sizeof(counters))
+	ret, _, callErr := procK32GetProcessMemoryInfo.Call(uintptr(m.handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.CB))
+	if ret == 0 {
+		return ProcessSample{}, fmt.Errorf("GetProcessMemoryInfo failed: %v", callErr)
+	}
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(m.handle, &creation, &exit, &kernel, &user); err != nil {
+		return ProcessSample{}, fmt.Errorf("GetProcessTimes failed: %w", err)
+	}
+	// Filetime counts 100ns intervals
+	cpuTime := time.Duration((filetimeTicks(kernel) + filetimeTicks(user)) * 100)
+	now := time.Now()
+
+	sample := ProcessSample{
+		WorkingSetMB: int(counters.WorkingSetSize / (1024 * 1024)),
+		SampledAt:    now,
+	}
+	if !m.lastSample.IsZero() {
+		wall := now.Sub(m.lastSample)
+		if wall > 0 {
+			sample.CPUPercent = float64(cpuTime-m.lastCPU) / float64(wall) / float64(runtime.NumCPU()) * 100
+		}
+	}
+	if sample.WorkingSetMB > m.peakMB {
+		m.peakMB = sample.WorkingSetMB
+	}
+	sample.PeakWorkingSetMB = m.peakMB
+
+	m.lastCPU = cpuTime
+	m.lastSample = now
+	m.latest = sample
+	return sample, nil
+}
+
+// Latest returns the most recent sample.
+func (m *ProcessMonitor) Latest() ProcessSample {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latest
+}
+
+// filetimeTicks converts Filetime to number of 100ns ticks.
+func filetimeTicks(ft windows.Filetime) int64 {
+	return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+}
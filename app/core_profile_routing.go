@@ -0,0 +1,70 @@
+// Package main provides the per-profile routing mode for KampusVPN.
+// Each profile keeps its own routing mode, so switching from a "Work" profile
+// routing all traffic to a "Home" profile routing only blocked sites changes
+// routing as well. The global RoutingMode of older versions is the mode new
+// profiles start with and is copied into profiles that have none.
+package main
+
+import (
+	"fmt"
+)
+
+// ValidateRoutingMode returns an error for an unknown routing mode
+func ValidateRoutingMode(mode RoutingMode) error {
+	switch mode {
+	case RoutingModeBlockedOnly, RoutingModeExceptRussia, RoutingModeAllTraffic, RoutingModeCustom:
+		return nil
+	default:
+		return fmt.Errorf("неизвестный режим маршрутизации: %s", mode)
+	}
+}
+
+// EffectiveRoutingMode returns the routing mode of the profile (DefaultRoutingMode if unset)
+func (p *ProfileData) EffectiveRoutingMode() RoutingMode {
+	if p.RoutingMode == "" {
+		return DefaultRoutingMode
+	}
+	return p.RoutingMode
+}
+
+// migrateProfileRoutingMode gives a profile of an older version (or an old
+// export) the global routing mode it used to be built with.
+func migrateProfileRoutingMode(profile *ProfileData, global RoutingMode) {
+	if profile.RoutingMode != "" {
+		return
+	}
+	if ValidateRoutingMode(global) != nil {
+		global = DefaultRoutingMode
+	}
+	profile.RoutingMode = global
+}
+
+// configRoutingModeStale reports whether the stored config of the profile was
+// built with another routing mode. Configs stamped before the mode was
+// recorded were built with the mode migrated into the profile.
+func configRoutingModeStale(profile *ProfileData) bool {
+	if len(profile.SingboxConfig) == 0 || profile.BuildInfo == nil || profile.BuildInfo.RoutingMode == "" {
+		return false
+	}
+	return profile.BuildInfo.RoutingMode != profile.EffectiveRoutingMode()
+}
+
+// --- Storage ---
+
+// SetProfileRoutingMode sets the routing mode of a profile.
+func (s *Storage) SetProfileRoutingMode(id int, mode RoutingMode) error {
+	if err := ValidateRoutingMode(mode); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].RoutingMode = mode
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
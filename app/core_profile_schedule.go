@@ -0,0 +1,155 @@
+// Package main provides scheduled profile switching for KampusVPN.
+// Rules map days of week and a time window to a profile, e.g. the corporate
+// profile on weekdays 09:00-18:00 and the personal one otherwise.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ScheduleRule activates ProfileID on Days between Start and End (local time).
+// End before Start means the window runs past midnight into the next day.
+type ScheduleRule struct {
+	Days      []int  `json:"days"`  // 0 = Sunday ... 6 = Saturday
+	Start     string `json:"start"` // "HH:MM"
+	End       string `json:"end"`   // "HH:MM"
+	ProfileID int    `json:"profile_id"`
+}
+
+// ProfileSchedule is the list of switching rules. Later rules win on overlap.
+type ProfileSchedule struct {
+	Enabled bool           `json:"enabled"`
+	Rules   []ScheduleRule `json:"rules"`
+	// Profile used outside of all rules (0 = keep the current profile)
+	DefaultProfileID int `json:"default_profile_id,omitempty"`
+}
+
+// parseScheduleTime parses "HH:MM" into minutes since midnight.
+func parseScheduleTime(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("неверное время %q (ожидается ЧЧ:ММ)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// window returns rule start/end in minutes since midnight.
+func (r ScheduleRule) window() (int, int) {
+	start, _ := parseScheduleTime(r.Start)
+	end, _ := parseScheduleTime(r.End)
+	return start, end
+}
+
+// hasDay reports whether the rule is defined for the weekday.
+func (r ScheduleRule) hasDay(day time.Weekday) bool {
+	for _, d := range r.Days {
+		if d == int(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether t falls into the rule window.
+func (r ScheduleRule) Matches(t time.Time) bool {
+	start, end := r.window()
+	minute := t.Hour()*60 + t.Minute()
+
+	if start < end {
+		return r.hasDay(t.Weekday()) && minute >= start && minute < end
+	}
+	// Overnight window: evening part belongs to the start day, morning part to the next one
+	if minute >= start {
+		return r.hasDay(t.Weekday())
+	}
+	if minute < end {
+		return r.hasDay(t.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+// ValidateProfileSchedule checks rule syntax and profile existence, and rejects
+// ambiguous sets: rules with the same days and window but different profiles.
+func ValidateProfileSchedule(schedule ProfileSchedule, profileExists func(int) bool) error {
+	seen := make(map[string]ScheduleRule)
+
+	for i, rule := range schedule.Rules {
+		n := i + 1
+		if len(rule.Days) == 0 {
+			return fmt.Errorf("правило %d: не выбраны дни недели", n)
+		}
+		for _, d := range rule.Days {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("правило %d: неверный день недели %d", n, d)
+			}
+		}
+		start, err := parseScheduleTime(rule.Start)
+		if err != nil {
+			return fmt.Errorf("правило %d: %w", n, err)
+		}
+		end, err := parseScheduleTime(rule.End)
+		if err != nil {
+			return fmt.Errorf("правило %d: %w", n, err)
+		}
+		if start == end {
+			return fmt.Errorf("правило %d: время начала и окончания совпадают", n)
+		}
+		if !profileExists(rule.ProfileID) {
+			return fmt.Errorf("правило %d: профиль %d не найден", n, rule.ProfileID)
+		}
+
+		days := append([]int(nil), rule.Days...)
+		sort.Ints(days)
+		key := fmt.Sprintf("%v|%d|%d", days, start, end)
+		if other, exists := seen[key]; exists && other.ProfileID != rule.ProfileID {
+			return fmt.Errorf("правило %d: совпадает по дням и времени с другим правилом, но выбирает другой профиль", n)
+		}
+		seen[key] = rule
+	}
+
+	if schedule.DefaultProfileID != 0 && !profileExists(schedule.DefaultProfileID) {
+		return fmt.Errorf("профиль по умолчанию %d не найден", schedule.DefaultProfileID)
+	}
+	return nil
+}
+
+// Target returns the profile the schedule selects at t and the index of the
+// matching rule (-1 for the default profile). Profile 0 means no switch.
+func (s ProfileSchedule) Target(t time.Time) (int, int) {
+	for i := len(s.Rules) - 1; i >= 0; i-- {
+		if s.Rules[i].Matches(t) {
+			return s.Rules[i].ProfileID, i
+		}
+	}
+	return s.DefaultProfileID, -1
+}
+
+// NextBoundary returns the next rule start or end after t (zero time if none).
+func (s ProfileSchedule) NextBoundary(t time.Time) time.Time {
+	var next time.Time
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	for _, rule := range s.Rules {
+		start, end := rule.window()
+		// Look back one day for overnight windows ending today
+		for dayOffset := -1; dayOffset <= 7; dayOffset++ {
+			day := midnight.AddDate(0, 0, dayOffset)
+			if !rule.hasDay(day.Weekday()) {
+				continue
+			}
+			startAt := day.Add(time.Duration(start) * time.Minute)
+			endAt := day.Add(time.Duration(end) * time.Minute)
+			if end < start {
+				endAt = endAt.AddDate(0, 0, 1)
+			}
+			for _, boundary := range []time.Time{startAt, endAt} {
+				if boundary.After(t) && (next.IsZero() || boundary.Before(next)) {
+					next = boundary
+				}
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,110 @@
+// Package main provides proxy delay measurements with status and freshness for KampusVPN.
+// Delay 0 used to mean both "not tested" and "failed"; every measurement now
+// carries an explicit status and the time it was taken.
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Proxy delay statuses
+const (
+	DelayStatusOK          = "ok"
+	DelayStatusTimeout     = "timeout"
+	DelayStatusUnreachable = "unreachable"
+	DelayStatusNotTested   = "not_tested"
+)
+
+// Delay measurement methods: the UI must not compare one with the other
+const (
+	DelayMethodHTTP = "http" // URL test through the proxy (Clash API)
+	DelayMethodTCP  = "tcp"  // TCP connect to the server, VPN not required
+)
+
+// DefaultDelayFreshnessSec is how long a delay measurement is considered current
+const DefaultDelayFreshnessSec = 180
+
+// DelayMeasurement is a single proxy delay result.
+type DelayMeasurement struct {
+	Delay      int       `json:"delay"` // ms, 0 unless Status is ok
+	Status     string    `json:"status"`
+	MeasuredAt time.Time `json:"measured_at"`
+	Method     string    `json:"method,omitempty"` // "" = DelayMethodHTTP
+}
+
+// NewDelayMeasurement converts a probe result to a measurement.
+func NewDelayMeasurement(delay int, err error, measuredAt time.Time) DelayMeasurement {
+	if err != nil || delay <= 0 {
+		return DelayMeasurement{Status: classifyDelayError(err), MeasuredAt: measuredAt}
+	}
+	return DelayMeasurement{Delay: delay, Status: DelayStatusOK, MeasuredAt: measuredAt}
+}
+
+// IsStale reports whether the measurement is older than the freshness window.
+// Untested proxies are always stale.
+func (m DelayMeasurement) IsStale(now time.Time, window time.Duration) bool {
+	if m.Status == DelayStatusNotTested || m.MeasuredAt.IsZero() {
+		return true
+	}
+	return now.Sub(m.MeasuredAt) > window
+}
+
+// Fields returns the additive response fields of the measurement.
+func (m DelayMeasurement) Fields(now time.Time, window time.Duration) map[string]interface{} {
+	status := m.Status
+	if status == "" {
+		status = DelayStatusNotTested
+	}
+	method := m.Method
+	if method == "" {
+		method = DelayMethodHTTP
+	}
+	fields := map[string]interface{}{
+		"delay":    m.Delay,
+		"status":   status,
+		"method":   method,
+		"is_stale": m.IsStale(now, window),
+	}
+	if !m.MeasuredAt.IsZero() {
+		fields["measured_at"] = m.MeasuredAt.Format(time.RFC3339)
+	}
+	return fields
+}
+
+// classifyDelayError maps a failed delay test to timeout or unreachable.
+func classifyDelayError(err error) string {
+	if err == nil {
+		return DelayStatusUnreachable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return DelayStatusTimeout
+	}
+	lower := strings.ToLower(err.Error())
+	if strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded") {
+		return DelayStatusTimeout
+	}
+	return DelayStatusUnreachable
+}
+
+// clashHistoryEntry is one Clash API delay history record.
+type clashHistoryEntry struct {
+	Time  time.Time `json:"time"`
+	Delay int       `json:"delay"`
+}
+
+// measurementFromHistory returns the last Clash history record as a measurement.
+// Clash stores failed tests with delay 0; an empty history means not tested.
+func measurementFromHistory(history []clashHistoryEntry) DelayMeasurement {
+	if len(history) == 0 {
+		return DelayMeasurement{Status: DelayStatusNotTested}
+	}
+	last := history[len(history)-1]
+	if last.Delay <= 0 {
+		return DelayMeasurement{Status: DelayStatusUnreachable, MeasuredAt: last.Time}
+	}
+	return DelayMeasurement{Delay: last.Delay, Status: DelayStatusOK, MeasuredAt: last.Time}
+}
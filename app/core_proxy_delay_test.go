@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewDelayMeasurement(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		delay  int
+		err    error
+		status string
+		want   int
+	}{
+		{"measured", 45, nil, DelayStatusOK, 45},
+		{"zero delay without error", 0, nil, DelayStatusUnreachable, 0},
+		{"net timeout", 0, fmt.Errorf("dial: %w", timeoutError{}), DelayStatusTimeout, 0},
+		{"deadline", 0, context.DeadlineExceeded, DelayStatusTimeout, 0},
+		{"clash timeout message", 0, errors.New("Timeout"), DelayStatusTimeout, 0},
+		{"refused", 0, errors.New("connect: connection refused"), DelayStatusUnreachable, 0},
+		// A delay returned together with an error is not a measurement
+		{"delay with error", 45, errors.New("no response"), DelayStatusUnreachable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDelayMeasurement(tt.delay, tt.err, now)
+			if m.Status != tt.status || m.Delay != tt.want || !m.MeasuredAt.Equal(now) {
+				t.Errorf("measurement = %+v, want status %s and delay %d", m, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelayMeasurementIsStale(t *testing.T) {
+	window := 3 * time.Minute
+	now := time.Now()
+	tests := []struct {
+		name  string
+		m     DelayMeasurement
+		stale bool
+	}{
+		{"fresh", DelayMeasurement{Delay: 45, Status: DelayStatusOK, MeasuredAt: now.Add(-time.Minute)}, false},
+		{"at the window edge", DelayMeasurement{Delay: 45, Status: DelayStatusOK, MeasuredAt: now.Add(-window)}, false},
+		{"ten minutes old", DelayMeasurement{Delay: 45, Status: DelayStatusOK, MeasuredAt: now.Add(-10 * time.Minute)}, true},
+		{"fresh failure", DelayMeasurement{Status: DelayStatusTimeout, MeasuredAt: now}, false},
+		{"not tested", DelayMeasurement{Status: DelayStatusNotTested}, true},
+		{"no timestamp", DelayMeasurement{Delay: 45, Status: DelayStatusOK}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.IsStale(now, window); got != tt.stale {
+			t.Errorf("%s: IsStale = %v, want %v", tt.name, got, tt.stale)
+		}
+	}
+}
+
+func TestDelayMeasurementFields(t *testing.T) {
+	now := time.Now()
+	window := 3 * time.Minute
+
+	untested := DelayMeasurement{}.Fields(now, window)
+	if untested["status"] != DelayStatusNotTested || untested["delay"] != 0 || untested["is_stale"] != true {
+		t.Errorf("untested fields = %v", untested)
+	}
+	if _, ok := untested["measured_at"]; ok {
+		t.Error("untested proxy has measured_at")
+	}
+	if untested["method"] != DelayMethodHTTP {
+		t.Errorf("method = %v, want %s by default", untested["method"], DelayMethodHTTP)
+	}
+
+	measuredAt := now.Add(-time.Minute).Truncate(time.Second)
+	fields := DelayMeasurement{Delay: 45, Status: DelayStatusOK, MeasuredAt: measuredAt, Method: DelayMethodTCP}.Fields(now, window)
+	if fields["delay"] != 45 || fields["is_stale"] != false || fields["method"] != DelayMethodTCP {
+		t.Errorf("fields = %v", fields)
+	}
+	if fields["measured_at"] != measuredAt.Format(time.RFC3339) {
+		t.Errorf("measured_at = %v, want %s", fields["measured_at"], measuredAt.Format(time.RFC3339))
+	}
+}
+
+func TestMeasurementFromHistory(t *testing.T) {
+	at := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name    string
+		history []clashHistoryEntry
+		want    DelayMeasurement
+	}{
+		{"empty", nil, DelayMeasurement{Status: DelayStatusNotTested}},
+		{"measured", []clashHistoryEntry{{Time: at, Delay: 120}}, DelayMeasurement{Delay: 120, Status: DelayStatusOK, MeasuredAt: at}},
+		{"last test failed", []clashHistoryEntry{{Time: at.Add(-time.Minute), Delay: 120}, {Time: at}}, DelayMeasurement{Status: DelayStatusUnreachable, MeasuredAt: at}},
+		{"recovered", []clashHistoryEntry{{Time: at.Add(-time.Minute)}, {Time: at, Delay: 80}}, DelayMeasurement{Delay: 80, Status: DelayStatusOK, MeasuredAt: at}},
+	}
+
+	for _, tt := range tests {
+		if got := measurementFromHistory(tt.history); got != tt.want {
+			t.Errorf("%s: measurement = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeClashDelays serves the auto-select group and per-proxy delay answers
+type fakeClashDelays struct {
+	mu      sync.Mutex
+	members []string
+	answers map[string]string // proxy -> JSON of the delay endpoint
+}
+
+func (f *fakeClashDelays) set(members []string, answers map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members = members
+	f.answers = answers
+}
+
+func (f *fakeClashDelays) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/proxies/auto-select" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"all": f.members, "now": f.members[0]})
+		return
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/proxies/"), "/delay")
+	w.Write([]byte(f.answers[name]))
+}
+
+func TestProberDelayStatusTransitions(t *testing.T) {
+	clash := &fakeClashDelays{}
+	server := httptest.NewServer(clash)
+	defer server.Close()
+	useClashEndpoint(t, strings.TrimPrefix(server.URL, "http://"))
+
+	const (
+		ok      = `{"delay":45}`
+		timeout = `{"message":"Timeout"}`
+		refused = `{"message":"dial tcp: connection refused"}`
+	)
+	p := NewProxyProber(AdvancedProbingSettings{ProbesPerCycle: 1}, nil, nil)
+
+	cycles := []struct {
+		name    string
+		members []string
+		answers map[string]string
+		want    map[string]string // proxy -> status, missing means not probed
+	}{
+		{
+			name:    "first cycle",
+			members: []string{"de", "nl", "us"},
+			answers: map[string]string{"de": ok, "nl": timeout, "us": refused},
+			want:    map[string]string{"de": DelayStatusOK, "nl": DelayStatusTimeout, "us": DelayStatusUnreachable},
+		},
+		{
+			name:    "statuses flip",
+			members: []string{"de", "nl", "us"},
+			answers: map[string]string{"de": timeout, "nl": ok, "us": ok},
+			want:    map[string]string{"de": DelayStatusTimeout, "nl": DelayStatusOK, "us": DelayStatusOK},
+		},
+		{
+			name:    "proxy removed from the config",
+			members: []string{"de", "nl"},
+			answers: map[string]string{"de": ok, "nl": refused},
+			want:    map[string]string{"de": DelayStatusOK, "nl": DelayStatusUnreachable},
+		},
+	}
+
+	for _, cycle := range cycles {
+		t.Run(cycle.name, func(t *testing.T) {
+			clash.set(cycle.members, cycle.answers)
+			p.runCycle()
+
+			for _, name := range []string{"de", "nl", "us"} {
+				q, probed := p.GetProxyQuality(name)
+				want, listed := cycle.want[name]
+				if probed != listed {
+					t.Fatalf("%s: probed = %v, want %v", name, probed, listed)
+				}
+				m := q.Measurement()
+				if !listed {
+					// The API then reports it as not tested rather than a stale 0 ms
+					if m.Status != DelayStatusNotTested || !m.IsStale(time.Now(), time.Minute) {
+						t.Errorf("%s: measurement = %+v, want not tested", name, m)
+					}
+					continue
+				}
+				if m.Status != want {
+					t.Errorf("%s: status = %s, want %s", name, m.Status, want)
+				}
+				if (m.Delay > 0) != (want == DelayStatusOK) {
+					t.Errorf("%s: delay = %d with status %s", name, m.Delay, m.Status)
+				}
+				if m.IsStale(time.Now(), time.Minute) {
+					t.Errorf("%s: fresh measurement is stale", name)
+				}
+				if !m.IsStale(time.Now().Add(2*time.Minute), time.Minute) {
+					t.Errorf("%s: measurement not stale after the window", name)
+				}
+			}
+		})
+	}
+}
+
+func TestGetProxiesWithDelayStatus(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+	recent := now.Add(-time.Minute).UTC().Format(time.RFC3339)
+	clash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"proxies":{
+			"auto-select": {"name":"auto-select","type":"URLTest"},
+			"de": {"name":"de","type":"VLESS","history":[{"time":%q,"delay":45}]},
+			"nl": {"name":"nl","type":"VLESS","history":[{"time":%q,"delay":80},{"time":%q,"delay":0}]},
+			"us": {"name":"us","type":"VLESS"},
+			"fi": {"name":"fi","type":"VLESS","history":[{"time":%q,"delay":60}]}
+		}}`, old, old, recent, old)
+	}))
+	defer clash.Close()
+	useClashEndpoint(t, strings.TrimPrefix(clash.URL, "http://"))
+
+	a, _ := testActivationApp(t)
+	a.isRunning = true
+	// The prober measured fi after the urltest, its result wins
+	a.prober = NewProxyProber(AdvancedProbingSettings{}, nil, nil)
+	a.prober.applyResults(map[string]QualityMetrics{"fi": {AvgDelay: 70, Score: 90, Status: DelayStatusOK}}, now)
+
+	result := a.GetProxiesWithDelay(0, 0)
+	if result["success"] != true {
+		t.Fatalf("GetProxiesWithDelay = %v", result)
+	}
+	if result["freshness_sec"] != DefaultDelayFreshnessSec {
+		t.Errorf("freshness_sec = %v, want %d", result["freshness_sec"], DefaultDelayFreshnessSec)
+	}
+
+	want := map[string]struct {
+		status string
+		delay  int
+		stale  bool
+	}{
+		"de": {DelayStatusOK, 45, true},
+		"nl": {DelayStatusUnreachable, 0, false},
+		"us": {DelayStatusNotTested, 0, true},
+		"fi": {DelayStatusOK, 70, false},
+	}
+	proxies, _ := result["proxies"].([]map[string]interface{})
+	if len(proxies) != len(want) {
+		t.Fatalf("proxies = %v, want %d", proxies, len(want))
+	}
+	for _, entry := range proxies {
+		name, _ := entry["name"].(string)
+		w := want[name]
+		if entry["status"] != w.status || entry["delay"] != w.delay || entry["is_stale"] != w.stale {
+			t.Errorf("%s: status %v, delay %v, is_stale %v; want %s, %d, %v",
+				name, entry["status"], entry["delay"], entry["is_stale"], w.status, w.delay, w.stale)
+		}
+		if _, ok := entry["measured_at"]; ok == (w.status == DelayStatusNotTested) {
+			t.Errorf("%s: measured_at = %v", name, entry["measured_at"])
+		}
+	}
+}
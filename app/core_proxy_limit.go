@@ -0,0 +1,140 @@
+// Package main provides the per-profile proxy cap for KampusVPN.
+// Public subscriptions may return hundreds of servers; a config with all of
+// them makes sing-box start slowly and urltest flood the network, so only a
+// deterministic subset is written to the config.
+package main
+
+import (
+	"fmt"
+)
+
+// Proxy cap settings
+const (
+	// DefaultMaxProxiesPerProfile is the cap used when settings don't set one.
+	DefaultMaxProxiesPerProfile = 150
+	// DefaultProxyPageSize is the page size of proxy listings when no limit is given.
+	DefaultProxyPageSize = 100
+)
+
+// WarnProxiesOmitted is the build warning code for proxies left out by the cap
+const WarnProxiesOmitted = "proxies_omitted"
+
+// MaxProxies returns the configured cap (0 in settings = default).
+func (s GlobalAppSettings) MaxProxies() int {
+	if s.MaxProxiesPerProfile <= 0 {
+		return DefaultMaxProxiesPerProfile
+	}
+	return s.MaxProxiesPerProfile
+}
+
+// proxyRegion returns the flag emoji of a proxy name ("" if there is none).
+// Subscriptions mark the server country with a flag, e.g. "🇩🇪 Frankfurt".
+func proxyRegion(name string) string {
+	runes := []rune(name)
+	for i := 0; i+1 < len(runes); i++ {
+		if isRegionalIndicator(runes[i]) && isRegionalIndicator(runes[i+1]) {
+			return string(runes[i : i+2])
+		}
+	}
+	return ""
+}
+
+// isRegionalIndicator reports whether r is one half of a flag emoji
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// LimitProxies keeps at most max proxies. Pinned proxies (by name or tag) are
+// kept first, the rest is filled round-robin across regions so every country
+// stays available, and within a region the subscription order wins.
+// The kept proxies keep their subscription order. max <= 0 keeps everything.
+func LimitProxies(proxies []ProxyConfig, max int, pinned []string) ([]ProxyConfig, int) {
+	if max <= 0 || len(proxies) <= max {
+		return proxies, 0
+	}
+
+	keep := make([]bool, len(proxies))
+	kept := 0
+
+	pinnedSet := make(map[string]bool, len(pinned))
+	for _, name := range pinned {
+		pinnedSet[name] = true
+	}
+	for i, p := range proxies {
+		if kept == max {
+			break
+		}
+		if pinnedSet[p.Name] || pinnedSet[p.Tag] {
+			keep[i] = true
+			kept++
+		}
+	}
+
+	// Remaining proxies grouped by region in order of first appearance
+	var regions []string
+	byRegion := map[string][]int{}
+	for i, p := range proxies {
+		if keep[i] {
+			continue
+		}
+		region := proxyRegion(p.Name)
+		if _, ok := byRegion[region]; !ok {
+			regions = append(regions, region)
+		}
+		byRegion[region] = append(byRegion[region], i)
+	}
+
+	for round := 0; kept < max; round++ {
+		added := false
+		for _, region := range regions {
+			if kept == max {
+				break
+			}
+			if indexes := byRegion[region]; round < len(indexes) {
+				keep[indexes[round]] = true
+				kept++
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+
+	result := make([]ProxyConfig, 0, kept)
+	for i, p := range proxies {
+		if keep[i] {
+			result = append(result, p)
+		}
+	}
+	return result, len(proxies) - len(result)
+}
+
+// proxyLimitWarning describes the proxies left out of the config
+func proxyLimitWarning(omitted, total, max int) BuildWarning {
+	return NewBuildWarning(WarnProxiesOmitted,
+		fmt.Sprintf("В конфигурацию добавлено %d из %d серверов (лимит %d), пропущено: %d", total-omitted, total, max, omitted),
+		map[string]string{
+			"omitted": fmt.Sprintf("%d", omitted),
+			"total":   fmt.Sprintf("%d", total),
+			"limit":   fmt.Sprintf("%d", max),
+		})
+}
+
+// pageBounds returns the slice bounds of a page; limit <= 0 uses DefaultProxyPageSize.
+func pageBounds(total, offset, limit int) (int, int) {
+	if limit <= 0 {
+		limit = DefaultProxyPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	// Compared without adding: a huge limit mustn't overflow
+	if limit > total-offset {
+		return offset, total
+	}
+	return offset, offset + limit
+}
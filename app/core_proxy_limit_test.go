@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// proxyLimitFlags are the regions of the synthetic subscription; most servers are German
+var proxyLimitFlags = []string{"🇩🇪", "🇳🇱", "🇫🇮", "🇺🇸", "🇬🇧", "🇫🇷", "🇸🇪", "🇵🇱", "🇹🇷", "🇰🇿"}
+
+// syntheticProxies returns n proxies: the first 90% in Germany, the rest
+// spread over the other regions
+func syntheticProxies(n int) []ProxyConfig {
+	proxies := make([]ProxyConfig, n)
+	german := n * 9 / 10
+	for i := range proxies {
+		flag := proxyLimitFlags[0]
+		if i >= german {
+			flag = proxyLimitFlags[1+(i-german)%(len(proxyLimitFlags)-1)]
+		}
+		proxies[i] = ProxyConfig{
+			Type:       "trojan",
+			Name:       fmt.Sprintf("%s node-%04d", flag, i),
+			Tag:        fmt.Sprintf("node-%04d", i),
+			Server:     fmt.Sprintf("n%d.example.com", i),
+			ServerPort: 443,
+		}
+	}
+	return proxies
+}
+
+func TestLimitProxies(t *testing.T) {
+	proxies := syntheticProxies(1000)
+	pinned := []string{"🇩🇪 node-0899", "node-0500"}
+
+	kept, omitted := LimitProxies(proxies, DefaultMaxProxiesPerProfile, pinned)
+	if len(kept) != DefaultMaxProxiesPerProfile || omitted != 1000-DefaultMaxProxiesPerProfile {
+		t.Fatalf("kept %d, omitted %d", len(kept), omitted)
+	}
+
+	byName := map[string]bool{}
+	perRegion := map[string]int{}
+	last := -1
+	for _, p := range kept {
+		byName[p.Name] = true
+		perRegion[proxyRegion(p.Name)]++
+		var index int
+		fmt.Sscanf(p.Tag, "node-%d", &index)
+		if index <= last {
+			t.Fatalf("subscription order lost: %s after node-%04d", p.Tag, last)
+		}
+		last = index
+	}
+
+	// Pinned by name and by tag, even from the end of the list
+	if !byName["🇩🇪 node-0899"] || !byName["🇩🇪 node-0500"] {
+		t.Error("pinned proxies dropped")
+	}
+	// The 100 servers outside Germany fit under the cap and all stay
+	for _, flag := range proxyLimitFlags[1:] {
+		if perRegion[flag] == 0 {
+			t.Errorf("region %s dropped", flag)
+		}
+	}
+	if outside := len(kept) - perRegion[proxyLimitFlags[0]]; outside != 100 {
+		t.Errorf("servers outside Germany = %d, want 100", outside)
+	}
+	// Within a region the subscription order wins
+	if !byName["🇩🇪 node-0000"] || !byName["🇩🇪 node-0001"] {
+		t.Error("first German servers dropped")
+	}
+
+	again, _ := LimitProxies(proxies, DefaultMaxProxiesPerProfile, pinned)
+	for i := range again {
+		if again[i].Tag != kept[i].Tag {
+			t.Fatalf("selection not deterministic at %d: %s vs %s", i, again[i].Tag, kept[i].Tag)
+		}
+	}
+}
+
+func TestLimitProxiesEdges(t *testing.T) {
+	proxies := syntheticProxies(20)
+
+	tests := []struct {
+		name    string
+		max     int
+		pinned  []string
+		kept    int
+		omitted int
+		first   string
+	}{
+		{"under the cap", 50, nil, 20, 0, "node-0000"},
+		{"exactly the cap", 20, nil, 20, 0, "node-0000"},
+		{"no cap", 0, nil, 20, 0, "node-0000"},
+		{"more pinned than the cap", 2, []string{"node-0010", "node-0011", "node-0012"}, 2, 18, "node-0010"},
+		{"cap of one", 1, nil, 1, 19, "node-0000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, omitted := LimitProxies(proxies, tt.max, tt.pinned)
+			if len(kept) != tt.kept || omitted != tt.omitted {
+				t.Fatalf("kept %d, omitted %d, want %d, %d", len(kept), omitted, tt.kept, tt.omitted)
+			}
+			if kept[0].Tag != tt.first {
+				t.Errorf("first = %s, want %s", kept[0].Tag, tt.first)
+			}
+		})
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name                 string
+		total, offset, limit int
+		start, end           int
+	}{
+		{"first default page", 1000, 0, 0, 0, DefaultProxyPageSize},
+		{"middle page", 1000, 200, 50, 200, 250},
+		{"last partial page", 1000, 950, 100, 950, 1000},
+		{"offset past the end", 1000, 2000, 10, 1000, 1000},
+		{"negative offset", 1000, -5, 10, 0, 10},
+		{"negative limit", 1000, 10, -1, 10, 10 + DefaultProxyPageSize},
+		{"empty list", 0, 0, 10, 0, 0},
+		{"huge limit", 10, 5, math.MaxInt, 5, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := pageBounds(tt.total, tt.offset, tt.limit)
+			if start != tt.start || end != tt.end {
+				t.Errorf("pageBounds(%d, %d, %d) = %d, %d, want %d, %d", tt.total, tt.offset, tt.limit, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestBuildConfigCapsProxies(t *testing.T) {
+	var links []string
+	for _, p := range syntheticProxies(1000) {
+		links = append(links, fmt.Sprintf("trojan://secret@%s:443?security=tls&sni=%s#%s", p.Server, p.Server, p.Tag))
+	}
+	subscription := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(links, "\n")))
+	}))
+	defer subscription.Close()
+
+	storage, profile := testOverlapStorage(t)
+	// The parser keeps DefaultMaxSubscriptionProxies unless raised in settings
+	settings := storage.GetAppSettings()
+	settings.MaxSubscriptionProxies = 1000
+	if err := storage.UpdateAppSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	countProxies := func() (int, *BuildWarning) {
+		t.Helper()
+		if err := NewConfigBuilderForStorage(storage).BuildConfigForProfile(profile.ID, subscription.URL, nil); err != nil {
+			t.Fatalf("BuildConfigForProfile: %v", err)
+		}
+		stored := mustStoredProfile(t, storage, profile.ID)
+		outbounds, _ := stored.SingboxConfig["outbounds"].([]interface{})
+		count := 0
+		for _, outbound := range outbounds {
+			if o, _ := outbound.(map[string]interface{}); o["type"] == "trojan" {
+				count++
+			}
+		}
+		for i := range stored.BuildWarnings {
+			if stored.BuildWarnings[i].Code == WarnProxiesOmitted {
+				return count, &stored.BuildWarnings[i]
+			}
+		}
+		return count, nil
+	}
+
+	count, warning := countProxies()
+	if count != DefaultMaxProxiesPerProfile {
+		t.Errorf("outbounds = %d, want %d", count, DefaultMaxProxiesPerProfile)
+	}
+	if warning == nil || warning.Context["omitted"] != "850" || warning.Context["total"] != "1000" {
+		t.Errorf("warning = %+v, want 850 of 1000 omitted", warning)
+	}
+
+	// The per-profile override keeps everything
+	if err := storage.SetProfileProxyLimit(profile.ID, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if count, warning := countProxies(); count != 1000 || warning != nil {
+		t.Errorf("keep all: outbounds = %d, warning = %+v", count, warning)
+	}
+}
@@ -0,0 +1,475 @@
+// Package main provides connection-quality probing for KampusVPN.
+// The prober periodically measures delay, jitter and failure rate of every
+// proxy in the auto-select group and keeps a temporary avoidance list of
+// servers that keep failing.
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdvancedProbingSettings contains thresholds for the background prober.
+type AdvancedProbingSettings struct {
+	Enabled          bool    `json:"enabled"`            // Whole feature on/off (off saves traffic on metered links)
+	ProbesPerCycle   int     `json:"probes_per_cycle"`   // Number of delay probes per proxy per cycle
+	CycleIntervalSec int     `json:"cycle_interval_sec"` // Pause between probe cycles
+	ProbeTimeoutMs   int     `json:"probe_timeout_ms"`   // Timeout of a single probe
+	MaxFailureRate   float64 `json:"max_failure_rate"`   // Cycle is "failed" when failure rate reaches this value (0..1)
+	FailedCycles     int     `json:"failed_cycles"`      // Consecutive failed cycles before the proxy is avoided
+	CooldownMinutes  int     `json:"cooldown_minutes"`   // How long an avoided proxy stays excluded from auto-select
+	FreshnessSec     int     `json:"freshness_sec"`      // Delay results older than this are marked stale in the UI
+}
+
+// Default prober thresholds.
+const (
+	DefaultProbesPerCycle   = 3
+	DefaultCycleIntervalSec = 120
+	DefaultProbeTimeoutMs   = 3000
+	DefaultMaxFailureRate   = 0.5
+	DefaultFailedCycles     = 3
+	DefaultCooldownMinutes  = 30
+)
+
+// Normalized returns settings with zero values replaced by defaults.
+func (s AdvancedProbingSettings) Normalized() AdvancedProbingSettings {
+	if s.ProbesPerCycle <= 0 {
+		s.ProbesPerCycle = DefaultProbesPerCycle
+	}
+	if s.CycleIntervalSec <= 0 {
+		s.CycleIntervalSec = DefaultCycleIntervalSec
+	}
+	if s.ProbeTimeoutMs <= 0 {
+		s.ProbeTimeoutMs = DefaultProbeTimeoutMs
+	}
+	if s.MaxFailureRate <= 0 || s.MaxFailureRate > 1 {
+		s.MaxFailureRate = DefaultMaxFailureRate
+	}
+	if s.FailedCycles <= 0 {
+		s.FailedCycles = DefaultFailedCycles
+	}
+	if s.CooldownMinutes <= 0 {
+		s.CooldownMinutes = DefaultCooldownMinutes
+	}
+	if s.FreshnessSec <= 0 {
+		s.FreshnessSec = DefaultDelayFreshnessSec
+	}
+	return s
+}
+
+// QualityMetrics contains computed quality of a single probe cycle.
+type QualityMetrics struct {
+	AvgDelay    int     `json:"avg_delay"`    // Average delay of successful probes, ms
+	Jitter      int     `json:"jitter"`       // Mean absolute difference between consecutive delays, ms
+	FailureRate float64 `json:"failure_rate"` // Share of failed probes (0..1)
+	Score       int     `json:"score"`        // Quality score 0..100 (higher is better)
+	Status      string  `json:"status"`       // ok if any probe succeeded, otherwise timeout/unreachable
+}
+
+// ProxyQuality contains the latest probe results for a proxy.
+type ProxyQuality struct {
+	Name                    string    `json:"name"`
+	QualityMetrics                    // Last cycle metrics
+	ConsecutiveFailedCycles int       `json:"consecutive_failed_cycles"`
+	LastProbed              time.Time `json:"last_probed"`
+	AvoidedUntil            time.Time `json:"avoided_until,omitempty"`
+}
+
+// IsAvoided reports whether the proxy is currently excluded from auto-select.
+func (q ProxyQuality) IsAvoided(now time.Time) bool {
+	return !q.AvoidedUntil.IsZero() && now.Before(q.AvoidedUntil)
+}
+
+// computeQualityScore computes quality metrics from one cycle of probes.
+// delays contains successful probe delays in order, total is the number of probes sent.
+func computeQualityScore(delays []int, total int) QualityMetrics {
+	if total <= 0 {
+		return QualityMetrics{}
+	}
+
+	failures := total - len(delays)
+	if failures < 0 {
+		failures = 0
+	}
+	m := QualityMetrics{
+		FailureRate: float64(failures) / float64(total),
+	}
+
+	if len(delays) == 0 {
+		m.FailureRate = 1
+		return m
+	}
+
+	sum := 0
+	for _, d := range delays {
+		sum += d
+	}
+	m.AvgDelay = sum / len(delays)
+
+	if len(delays) > 1 {
+		diffSum := 0
+		for i := 1; i < len(delays); i++ {
+			diff := delays[i] - delays[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			diffSum += diff
+		}
+		m.Jitter = diffSum / (len(delays) - 1)
+	}
+
+	// Penalties: delay up to 40, jitter up to 20, failures up to 40 points
+	delayPenalty := math.Min(float64(m.AvgDelay)/25, 40)
+	jitterPenalty := math.Min(float64(m.Jitter)/10, 20)
+	failurePenalty := m.FailureRate * 40
+
+	score := 100 - delayPenalty - jitterPenalty - failurePenalty
+	if score < 0 {
+		score = 0
+	}
+	m.Score = int(math.Round(score))
+	return m
+}
+
+// applyAvoidedProxies removes the proxies avoided at now from the urltest
+// groups of a runtime config. Stored configs keep every proxy, so the list
+// takes effect and expires on the next sing-box start without a rebuild.
+// A group is never left empty.
+func applyAvoidedProxies(config map[string]interface{}, avoided map[string]time.Time, now time.Time) {
+	active := map[string]bool{}
+	for tag, until := range avoided {
+		if now.Before(until) {
+			active[tag] = true
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, item := range outbounds {
+		group, ok := item.(map[string]interface{})
+		if !ok || group["type"] != "urltest" {
+			continue
+		}
+		members := jsonStringList(group["outbounds"])
+		kept := make([]interface{}, 0, len(members))
+		for _, tag := range members {
+			if !active[tag] {
+				kept = append(kept, tag)
+			}
+		}
+		if len(kept) > 0 && len(kept) < len(members) {
+			group["outbounds"] = kept
+		}
+	}
+}
+
+// ProxyProber periodically probes proxies via the Clash API.
+type ProxyProber struct {
+	settings AdvancedProbingSettings
+	client   *http.Client
+	stats    map[string]*ProxyQuality
+	mu       sync.RWMutex
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	running  bool
+	logger   func(string)
+
+	// onAvoidChange is called with the current avoidance list whenever it changes
+	onAvoidChange func(avoided map[string]time.Time)
+}
+
+// NewProxyProber creates a new prober with the given settings.
+func NewProxyProber(settings AdvancedProbingSettings, avoided map[string]time.Time, logger func(string)) *ProxyProber {
+	settings = settings.Normalized()
+	p := &ProxyProber{
+		settings: settings,
+		client:   &http.Client{Timeout: time.Duration(settings.ProbeTimeoutMs)*time.Millisecond + 2*time.Second},
+		stats:    make(map[string]*ProxyQuality),
+		logger:   logger,
+	}
+	// Restore persisted avoidance entries that have not expired yet
+	now := time.Now()
+	for name, until := range avoided {
+		if now.Before(until) {
+			p.stats[name] = &ProxyQuality{Name: name, AvoidedUntil: until}
+		}
+	}
+	return p
+}
+
+// SetAvoidChangeCallback sets callback for avoidance list changes.
+func (p *ProxyProber) SetAvoidChangeCallback(cb func(avoided map[string]time.Time)) {
+	p.onAvoidChange = cb
+}
+
+func (p *ProxyProber) log(msg string) {
+	if p.logger != nil {
+		p.logger("[Prober] " + msg)
+	}
+}
+
+// Start starts the background probe loop.
+func (p *ProxyProber) Start() {
+	p.mu.Lock()
+	if p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.running = true
+	p.stop = make(chan struct{})
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go p.loop()
+	p.log(fmt.Sprintf("Started (%d probes every %ds)", p.settings.ProbesPerCycle, p.settings.CycleIntervalSec))
+}
+
+// Stop stops the background probe loop and waits for it to finish.
+func (p *ProxyProber) Stop() {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.running = false
+	close(p.stop)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.log("Stopped")
+}
+
+// loop runs probe cycles until stopped.
+func (p *ProxyProber) loop() {
+	defer p.wg.Done()
+
+	// Give sing-box time to start and run its own first urltest
+	select {
+	case <-time.After(10 * time.Second):
+	case <-p.stop:
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(p.settings.CycleIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		p.runCycle()
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// runCycle probes every proxy of the auto-select group once.
+func (p *ProxyProber) runCycle() {
+	// auto-select holds only proxies written to the config (see LimitProxies)
+	names, _, err := clashGroupMembers(p.client, "auto-select")
+	if err != nil {
+		p.log(fmt.Sprintf("Failed to list proxies: %v", err))
+		return
+	}
+
+	results := make(map[string]QualityMetrics, len(names))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			delays := []int{}
+			var lastErr error
+			for i := 0; i < p.settings.ProbesPerCycle; i++ {
+				select {
+				case <-p.stop:
+					return
+				default:
+				}
+				delay, err := clashProxyDelay(p.client, name, time.Duration(p.settings.ProbeTimeoutMs)*time.Millisecond)
+				if err == nil {
+					delays = append(delays, delay)
+				} else {
+					lastErr = err
+				}
+			}
+
+			metrics := computeQualityScore(delays, p.settings.ProbesPerCycle)
+			metrics.Status = DelayStatusOK
+			if len(delays) == 0 {
+				metrics.Status = classifyDelayError(lastErr)
+			}
+
+			resultsMu.Lock()
+			results[name] = metrics
+			resultsMu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	select {
+	case <-p.stop:
+		return
+	default:
+	}
+
+	p.pruneStats(names)
+	p.applyResults(results, time.Now())
+}
+
+// pruneStats drops entries of proxies that are no longer in the group
+// (e.g. removed from the subscription between cycles). Avoided proxies are
+// not in the group by design and stay until their cooldown expires.
+func (p *ProxyProber) pruneStats(names []string) {
+	current := make(map[string]bool, len(names))
+	for _, name := range names {
+		current[name] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, q := range p.stats {
+		if !current[name] && q.AvoidedUntil.IsZero() {
+			delete(p.stats, name)
+		}
+	}
+}
+
+// applyResults updates per-proxy statistics and the avoidance list.
+func (p *ProxyProber) applyResults(results map[string]QualityMetrics, now time.Time) {
+	p.mu.Lock()
+	changed := false
+	for name, metrics := range results {
+		q, ok := p.stats[name]
+		if !ok {
+			q = &ProxyQuality{Name: name}
+			p.stats[name] = q
+		}
+		q.QualityMetrics = metrics
+		q.LastProbed = now
+
+		if metrics.FailureRate >= p.settings.MaxFailureRate {
+			q.ConsecutiveFailedCycles++
+		} else {
+			q.ConsecutiveFailedCycles = 0
+		}
+
+		if q.ConsecutiveFailedCycles >= p.settings.FailedCycles && !q.IsAvoided(now) {
+			q.AvoidedUntil = now.Add(time.Duration(p.settings.CooldownMinutes) * time.Minute)
+			q.ConsecutiveFailedCycles = 0
+			changed = true
+			p.log(fmt.Sprintf("%s excluded from auto-select until %s (failure rate %.0f%%)",
+				name, q.AvoidedUntil.Format("15:04"), metrics.FailureRate*100))
+		}
+	}
+
+	// Expire cooldowns
+	for _, q := range p.stats {
+		if !q.AvoidedUntil.IsZero() && !now.Before(q.AvoidedUntil) {
+			q.AvoidedUntil = time.Time{}
+			changed = true
+			p.log(fmt.Sprintf("%s returned to auto-select", q.Name))
+		}
+	}
+	p.mu.Unlock()
+
+	if changed {
+		p.notifyAvoidChange()
+	}
+}
+
+// notifyAvoidChange calls the avoidance callback with the current list.
+func (p *ProxyProber) notifyAvoidChange() {
+	if p.onAvoidChange != nil {
+		p.onAvoidChange(p.AvoidedProxies())
+	}
+}
+
+// GetQuality returns a snapshot of all proxy quality entries sorted by score.
+func (p *ProxyProber) GetQuality() []ProxyQuality {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]ProxyQuality, 0, len(p.stats))
+	for _, q := range p.stats {
+		result = append(result, *q)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Measurement returns the last cycle of a proxy as a delay measurement.
+func (q ProxyQuality) Measurement() DelayMeasurement {
+	if q.LastProbed.IsZero() {
+		return DelayMeasurement{Status: DelayStatusNotTested}
+	}
+	status := q.Status
+	if status == "" {
+		status = DelayStatusNotTested
+	}
+	delay := 0
+	if status == DelayStatusOK {
+		delay = q.AvgDelay
+	}
+	return DelayMeasurement{Delay: delay, Status: status, MeasuredAt: q.LastProbed}
+}
+
+// GetProxyQuality returns quality entry for a single proxy.
+func (p *ProxyProber) GetProxyQuality(name string) (ProxyQuality, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	q, ok := p.stats[name]
+	if !ok {
+		return ProxyQuality{}, false
+	}
+	return *q, true
+}
+
+// AvoidedProxies returns the currently avoided proxies with their expiry.
+func (p *ProxyProber) AvoidedProxies() map[string]time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	result := make(map[string]time.Time)
+	for name, q := range p.stats {
+		if q.IsAvoided(now) {
+			result[name] = q.AvoidedUntil
+		}
+	}
+	return result
+}
+
+// ClearAvoidance manually returns a proxy to auto-select.
+func (p *ProxyProber) ClearAvoidance(name string) bool {
+	p.mu.Lock()
+	q, ok := p.stats[name]
+	if !ok || q.AvoidedUntil.IsZero() {
+		p.mu.Unlock()
+		return false
+	}
+	q.AvoidedUntil = time.Time{}
+	q.ConsecutiveFailedCycles = 0
+	p.mu.Unlock()
+
+	p.log(fmt.Sprintf("%s manually returned to auto-select", name))
+	p.notifyAvoidChange()
+	return true
+}
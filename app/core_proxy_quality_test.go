@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeQualityScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		delays []int
+		total  int
+		want   QualityMetrics
+	}{
+		{"no probes", nil, 0, QualityMetrics{}},
+		{"all failed", nil, 3, QualityMetrics{FailureRate: 1}},
+		{"stable", []int{100, 100, 100}, 3, QualityMetrics{AvgDelay: 100, Score: 96}},
+		{"jitter", []int{50, 150, 50}, 3, QualityMetrics{AvgDelay: 83, Jitter: 100, Score: 87}},
+		{"half failed", []int{100, 200}, 4, QualityMetrics{AvgDelay: 150, Jitter: 100, FailureRate: 0.5, Score: 64}},
+		{"delay penalty capped", []int{2000}, 1, QualityMetrics{AvgDelay: 2000, Score: 60}},
+		{"jitter penalty capped", []int{100, 1000}, 2, QualityMetrics{AvgDelay: 550, Jitter: 900, Score: 58}},
+		{"more delays than probes", []int{100, 100}, 1, QualityMetrics{AvgDelay: 100, Score: 96}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeQualityScore(tt.delays, tt.total); got != tt.want {
+				t.Errorf("computeQualityScore(%v, %d) = %+v, want %+v", tt.delays, tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProberAvoidsAndExpires(t *testing.T) {
+	p := NewProxyProber(AdvancedProbingSettings{FailedCycles: 2, CooldownMinutes: 10}, nil, nil)
+	var notified []map[string]time.Time
+	p.SetAvoidChangeCallback(func(avoided map[string]time.Time) {
+		notified = append(notified, avoided)
+	})
+
+	start := time.Now()
+	failed := map[string]QualityMetrics{"bad": {FailureRate: 1}, "good": {AvgDelay: 50, Score: 98}}
+
+	p.applyResults(failed, start)
+	if len(notified) != 0 {
+		t.Fatalf("avoided after one failed cycle: %v", notified)
+	}
+	p.applyResults(failed, start.Add(time.Minute))
+	if len(notified) != 1 {
+		t.Fatalf("got %d notifications after two failed cycles, want 1", len(notified))
+	}
+	if q, _ := p.GetProxyQuality("bad"); !q.IsAvoided(start.Add(2 * time.Minute)) {
+		t.Error("bad proxy not avoided")
+	}
+	if q, _ := p.GetProxyQuality("good"); q.IsAvoided(start.Add(2 * time.Minute)) {
+		t.Error("good proxy avoided")
+	}
+
+	// Avoided proxies are not in auto-select, so they are missing from the probed group
+	p.pruneStats([]string{"good"})
+	if _, ok := p.GetProxyQuality("bad"); !ok {
+		t.Fatal("avoided proxy pruned before its cooldown ended")
+	}
+
+	p.applyResults(map[string]QualityMetrics{"good": {AvgDelay: 50, Score: 98}}, start.Add(12*time.Minute))
+	if len(notified) != 2 {
+		t.Fatalf("got %d notifications, want the expiry reported", len(notified))
+	}
+	if q, _ := p.GetProxyQuality("bad"); !q.AvoidedUntil.IsZero() {
+		t.Errorf("cooldown not cleared: %v", q.AvoidedUntil)
+	}
+
+	p.pruneStats([]string{"good"})
+	if _, ok := p.GetProxyQuality("bad"); ok {
+		t.Error("expired proxy missing from the group not pruned")
+	}
+}
+
+func TestApplyAvoidedProxies(t *testing.T) {
+	now := time.Now()
+	config := map[string]interface{}{
+		"outbounds": []interface{}{
+			map[string]interface{}{"type": "vless", "tag": "de"},
+			map[string]interface{}{"type": "urltest", "tag": "auto-select", "outbounds": []interface{}{"de", "nl", "us"}},
+			map[string]interface{}{"type": "urltest", "tag": "Germany", "outbounds": []interface{}{"de"}},
+			map[string]interface{}{"type": "selector", "tag": "proxy", "outbounds": []interface{}{"auto-select", "de", "nl", "us"}},
+		},
+	}
+	avoided := map[string]time.Time{
+		"de": now.Add(time.Minute),
+		"us": now.Add(-time.Minute), // Expired
+	}
+
+	applyAvoidedProxies(config, avoided, now)
+
+	outbounds := config["outbounds"].([]interface{})
+	members := func(i int) []string {
+		return jsonStringList(outbounds[i].(map[string]interface{})["outbounds"])
+	}
+	if got := members(1); !equalStringSlices(got, []string{"nl", "us"}) {
+		t.Errorf("auto-select = %v, want [nl us]", got)
+	}
+	if got := members(2); !equalStringSlices(got, []string{"de"}) {
+		t.Errorf("group with only avoided proxies = %v, want it kept", got)
+	}
+	if got := members(3); len(got) != 4 {
+		t.Errorf("selector = %v, want avoided proxies still selectable", got)
+	}
+}
@@ -0,0 +1,139 @@
+// Package main provides per-profile connection readiness criteria for KampusVPN.
+// A profile can require WireGuard tunnels with a recent handshake (and a
+// reachable proxy) before the connection is reported as established.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Readiness states
+const (
+	ReadinessConnecting = "connecting" // Waiting for criteria
+	ReadinessReady      = "ready"      // All criteria met
+	ReadinessDegraded   = "degraded"   // Timeout passed with unmet criteria
+)
+
+// Readiness check settings
+const (
+	DefaultReadinessTimeoutSec = 60
+	// ReadinessCheckInterval is the evaluation interval while connecting.
+	ReadinessCheckInterval = 3 * time.Second
+	// ReadinessRecheckInterval is the evaluation interval once ready or degraded.
+	ReadinessRecheckInterval = 30 * time.Second
+	// ReadinessProxyCriterion is the name of the proxy reachability criterion.
+	ReadinessProxyCriterion = "proxy"
+)
+
+// ReadinessCriteria lists what must pass before the profile is "connected".
+type ReadinessCriteria struct {
+	RequiredTunnels       []string `json:"required_tunnels,omitempty"` // WireGuard tags with a recent handshake
+	RequireProxyReachable bool     `json:"require_proxy_reachable,omitempty"`
+	TimeoutSec            int      `json:"timeout_sec,omitempty"` // Then "connected with warnings" (0 = default)
+}
+
+// IsEmpty reports whether there is nothing to wait for.
+func (c *ReadinessCriteria) IsEmpty() bool {
+	return c == nil || (len(c.RequiredTunnels) == 0 && !c.RequireProxyReachable)
+}
+
+// Timeout returns the overall wait before the state becomes degraded.
+func (c *ReadinessCriteria) Timeout() time.Duration {
+	if c == nil || c.TimeoutSec <= 0 {
+		return DefaultReadinessTimeoutSec * time.Second
+	}
+	return time.Duration(c.TimeoutSec) * time.Second
+}
+
+// Validate checks that required tunnels exist in the profile.
+func (c *ReadinessCriteria) Validate(wireGuardConfigs []UserWireGuardConfig) error {
+	if c == nil {
+		return nil
+	}
+	if c.TimeoutSec < 0 {
+		return fmt.Errorf("таймаут не может быть отрицательным")
+	}
+	for _, tag := range c.RequiredTunnels {
+		found := false
+		for _, wg := range wireGuardConfigs {
+			if wg.Tag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("WireGuard туннель '%s' не найден в профиле", tag)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns unmet criteria (empty when ready). Tunnel criteria are
+// named by tag, proxy reachability by ReadinessProxyCriterion.
+func (c *ReadinessCriteria) Evaluate(tunnelHealthy func(tag string) bool, proxyReachable func() bool) []string {
+	unmet := []string{}
+	if c == nil {
+		return unmet
+	}
+	for _, tag := range c.RequiredTunnels {
+		if !tunnelHealthy(tag) {
+			unmet = append(unmet, tag)
+		}
+	}
+	if c.RequireProxyReachable && !proxyReachable() {
+		unmet = append(unmet, ReadinessProxyCriterion)
+	}
+	return unmet
+}
+
+// ReadinessStatus is the current readiness of the connection.
+type ReadinessStatus struct {
+	State     string    `json:"state"`
+	Unmet     []string  `json:"unmet"`
+	StartedAt time.Time `json:"started_at"`
+	ReadyAt   time.Time `json:"ready_at,omitempty"`
+}
+
+// describeCriteria formats criteria names for messages
+func describeCriteria(names []string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == ReadinessProxyCriterion {
+			parts = append(parts, "доступность прокси")
+		} else {
+			parts = append(parts, "туннель "+name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Message returns the state text for the UI.
+func (s ReadinessStatus) Message() string {
+	switch s.State {
+	case ReadinessConnecting:
+		if len(s.Unmet) == 0 {
+			return "Подключение…"
+		}
+		return fmt.Sprintf("Подключение… (ожидание: %s)", describeCriteria(s.Unmet))
+	case ReadinessDegraded:
+		return fmt.Sprintf("Подключено с предупреждениями: не выполнено — %s", describeCriteria(s.Unmet))
+	default:
+		return "Подключено"
+	}
+}
+
+// ToMap converts the status to API response format.
+func (s ReadinessStatus) ToMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"state":      s.State,
+		"unmet":      s.Unmet,
+		"message":    s.Message(),
+		"started_at": s.StartedAt.Format(time.RFC3339),
+	}
+	if !s.ReadyAt.IsZero() {
+		result["ready_at"] = s.ReadyAt.Format(time.RFC3339)
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+// Package main provides per-region url-test groups for KampusVPN.
+// A single auto-select over servers in many countries keeps jumping between
+// distant regions. With grouping enabled, every detected country gets its own
+// urltest group in the main selector, so the user can pin a region and still
+// get automatic selection inside it.
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Region group settings
+const (
+	// RegionGroupPrefix starts the tag of every region group ("region-DE").
+	RegionGroupPrefix = "region-"
+	// RegionOther is the group of proxies whose country isn't detected.
+	RegionOther = "Other"
+)
+
+// regionKeywords maps ISO codes to lowercase country and city names found in proxy names
+var regionKeywords = map[string][]string{
+	"AE": {"emirates", "dubai", "оаэ", "эмираты", "дубай"},
+	"AM": {"armenia", "yerevan", "армения", "ереван"},
+	"AT": {"austria", "vienna", "австрия", "вена"},
+	"AU": {"australia", "sydney", "австралия", "сидней"},
+	"BR": {"brazil", "бразилия"},
+	"CA": {"canada", "toronto", "канада", "торонто"},
+	"CH": {"switzerland", "zurich", "швейцария", "цюрих"},
+	"CZ": {"czech", "prague", "чехия", "прага"},
+	"DE": {"germany", "frankfurt", "berlin", "германия", "франкфурт", "берлин"},
+	"EE": {"estonia", "tallinn", "эстония", "таллин"},
+	"ES": {"spain", "madrid", "испания", "мадрид"},
+	"FI": {"finland", "helsinki", "финляндия", "хельсинки"},
+	"FR": {"france", "paris", "франция", "париж"},
+	"GB": {"united kingdom", "britain", "england", "london", "великобритания", "англия", "лондон"},
+	"GE": {"georgia", "tbilisi", "грузия", "тбилиси"},
+	"HK": {"hong kong", "hongkong", "гонконг"},
+	"IL": {"israel", "израиль"},
+	"IN": {"india", "индия"},
+	"IT": {"italy", "milan", "италия", "милан"},
+	"JP": {"japan", "tokyo", "япония", "токио"},
+	"KR": {"korea", "seoul", "корея", "сеул"},
+	"KZ": {"kazakhstan", "almaty", "казахстан", "алматы"},
+	"LT": {"lithuania", "vilnius", "литва", "вильнюс"},
+	"LV": {"latvia", "riga", "латвия", "рига"},
+	"MD": {"moldova", "молдова"},
+	"NL": {"netherlands", "amsterdam", "holland", "нидерланды", "амстердам", "голландия"},
+	"NO": {"norway", "oslo", "норвегия", "осло"},
+	"PL": {"poland", "warsaw", "польша", "варшава"},
+	"RS": {"serbia", "belgrade", "сербия", "белград"},
+	"RU": {"russia", "moscow", "россия", "москва"},
+	"SE": {"sweden", "stockholm", "швеция", "стокгольм"},
+	"SG": {"singapore", "сингапур"},
+	"TR": {"turkey", "türkiye", "istanbul", "турция", "стамбул"},
+	"TW": {"taiwan", "тайвань"},
+	"UA": {"ukraine", "kyiv", "украина", "киев"},
+	"US": {"united states", "usa", "america", "new york", "los angeles", "сша", "америка"},
+}
+
+// regionCodeAliases are codes used in proxy names instead of the ISO code
+var regionCodeAliases = map[string]string{
+	"UK": "GB",
+}
+
+// proxyCountry detects the country of a proxy from its name: a flag emoji,
+// an uppercase ISO code ("DE-1", "[NL]") or a country or city name.
+// Returns the ISO code, or "" if nothing matched.
+func proxyCountry(name string) string {
+	// Flag emoji: two regional indicators spell the ISO code
+	if flag := []rune(proxyRegion(name)); len(flag) == 2 {
+		code := string([]rune{'A' + flag[0] - 0x1F1E6, 'A' + flag[1] - 0x1F1E6})
+		if code == "UK" {
+			return "GB"
+		}
+		return code
+	}
+
+	// Uppercase two-letter words only: lowercase "in", "it", "no" are ordinary words
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, word := range words {
+		if len(word) != 2 || word != strings.ToUpper(word) {
+			continue
+		}
+		if alias, ok := regionCodeAliases[word]; ok {
+			return alias
+		}
+		if _, ok := regionKeywords[word]; ok {
+			return word
+		}
+	}
+
+	lower := strings.ToLower(name)
+	codes := make([]string, 0, len(regionKeywords))
+	for code := range regionKeywords {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes) // Deterministic when a name mentions two countries
+	for _, code := range codes {
+		for _, keyword := range regionKeywords[code] {
+			if strings.Contains(lower, keyword) {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// regionGroupTag returns the tag of a region group; the tag never collides with taken tags
+func regionGroupTag(region string, taken map[string]bool) string {
+	tag := RegionGroupPrefix + region
+	for i := 2; taken[tag]; i++ {
+		tag = RegionGroupPrefix + region + "-" + strconv.Itoa(i)
+	}
+	return tag
+}
+
+// isRegionGroupTag reports whether tag names a region group rather than a server
+func isRegionGroupTag(tag string) bool {
+	return strings.HasPrefix(tag, RegionGroupPrefix)
+}
+
+// regionGroupOutbounds creates a urltest group per detected country from
+// urltest (the template of auto-select). Avoided proxies are left out of a group
+// unless every proxy of the group is avoided. Returns the groups in country
+// order with RegionOther last, and their tags.
+func regionGroupOutbounds(proxies []ProxyConfig, avoided map[string]bool, urltest map[string]interface{}) ([]interface{}, []string) {
+	members := map[string][]string{}
+	avoidedMembers := map[string][]string{}
+	taken := map[string]bool{}
+	for _, p := range proxies {
+		taken[p.Tag] = true
+		region := proxyCountry(p.Name)
+		if region == "" {
+			region = RegionOther
+		}
+		if avoided[p.Tag] {
+			avoidedMembers[region] = append(avoidedMembers[region], p.Tag)
+		} else {
+			members[region] = append(members[region], p.Tag)
+		}
+	}
+
+	regions := []string{}
+	for region := range members {
+		regions = append(regions, region)
+	}
+	for region := range avoidedMembers {
+		if _, ok := members[region]; !ok {
+			regions = append(regions, region)
+		}
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if (regions[i] == RegionOther) != (regions[j] == RegionOther) {
+			return regions[j] == RegionOther
+		}
+		return regions[i] < regions[j]
+	})
+
+	groups := []interface{}{}
+	tags := []string{}
+	for _, region := range regions {
+		outbounds := members[region]
+		if len(outbounds) == 0 {
+			outbounds = avoidedMembers[region]
+		}
+		tag := regionGroupTag(region, taken)
+		taken[tag] = true
+
+		group := copyMap(urltest)
+		group["tag"] = tag
+		group["outbounds"] = outbounds
+		groups = append(groups, group)
+		tags = append(tags, tag)
+	}
+	return groups, tags
+}
@@ -0,0 +1,313 @@
+// Package main provides route explanation for KampusVPN.
+// "Why does example.com go direct?" is answered by walking the route rules
+// of a config in order, the way sing-box does for a connection to the domain:
+// domain fields are compared directly, IP fields against the addresses the
+// domain resolves to, and local .srs rule-sets are checked with
+// `sing-box rule-set match`. Rules on processes, ports or protocols can't
+// match a bare domain and are passed over.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Route explanation limits
+const (
+	// ExplainResolveTimeout bounds resolving the explained domain.
+	ExplainResolveTimeout = 5 * time.Second
+	// RuleSetMatchTimeout bounds one `sing-box rule-set match` run.
+	RuleSetMatchTimeout = 15 * time.Second
+)
+
+// RouteMatch is the route rule that decides a connection.
+type RouteMatch struct {
+	Index     int                    `json:"index"`           // Position in route.rules (-1 = final)
+	Field     string                 `json:"field"`           // Rule field that matched (domain_suffix, rule_set, ip_cidr, ...)
+	Value     string                 `json:"value,omitempty"` // Matched entry, rule-set tag or CIDR
+	Rule      map[string]interface{} `json:"rule,omitempty"`  // The whole rule (nil for final)
+	Action    string                 `json:"action"`          // route or reject
+	Outbound  string                 `json:"outbound,omitempty"`
+	Unchecked []string               `json:"unchecked,omitempty"` // Rule-sets that couldn't be checked
+}
+
+// routeTarget is what a rule is matched against
+type routeTarget struct {
+	Domain string
+	IPs    []net.IP
+}
+
+// ruleSetMatcher checks a rule-set of the config against a domain or an IP
+type ruleSetMatcher func(ruleSet map[string]interface{}, value string) (bool, error)
+
+// routeAddressFields are the rule fields a bare domain can be matched on;
+// sing-box ORs them within a rule
+var routeAddressFields = []string{"domain", "domain_suffix", "domain_keyword", "domain_regex", "rule_set", "ip_cidr", "ip_is_private"}
+
+// routeIgnoredFields don't restrict the destination
+var routeIgnoredFields = map[string]bool{"action": true, "outbound": true, "method": true, "no_drop": true}
+
+// normalizeExplainDomain accepts a domain or a URL
+func normalizeExplainDomain(input string) (string, error) {
+	domain, err := normalizeCustomDomain(input)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(domain, CustomDomainExactPrefix), nil
+}
+
+// resolveExplainTarget resolves the domain through the system resolver,
+// which is the VPN's DNS while connected. An IP literal is used as is.
+func resolveExplainTarget(domain string) (routeTarget, error) {
+	if ip := net.ParseIP(domain); ip != nil {
+		return routeTarget{IPs: []net.IP{ip}}, nil
+	}
+	target := routeTarget{Domain: domain}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExplainResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
+	if err != nil {
+		return target, err
+	}
+	for _, addr := range addrs {
+		target.IPs = append(target.IPs, addr.IP)
+	}
+	return target, nil
+}
+
+// explainRoute returns the first rule of route matching the target, or the final outbound
+func explainRoute(route map[string]interface{}, target routeTarget, matchRuleSet ruleSetMatcher) RouteMatch {
+	ruleSets := map[string]map[string]interface{}{}
+	if list, ok := route["rule_set"].([]interface{}); ok {
+		for _, item := range list {
+			if rs, ok := item.(map[string]interface{}); ok {
+				if tag, _ := rs["tag"].(string); tag != "" {
+					ruleSets[tag] = rs
+				}
+			}
+		}
+	}
+
+	var unchecked []string
+	rules, _ := route["rules"].([]interface{})
+	for i, item := range rules {
+		rule, ok := item.(map[string]interface{})
+		if !ok || !routeRuleApplies(rule) {
+			continue
+		}
+		action, _ := rule["action"].(string)
+		if action == "" {
+			action = "route"
+		}
+		if action != "route" && action != "reject" {
+			continue
+		}
+
+		field, value, skipped := matchRouteRule(rule, target, ruleSets, matchRuleSet)
+		unchecked = append(unchecked, skipped...)
+		if field == "" {
+			continue
+		}
+		outbound, _ := rule["outbound"].(string)
+		return RouteMatch{Index: i, Field: field, Value: value, Rule: rule, Action: action, Outbound: outbound, Unchecked: unchecked}
+	}
+
+	final, _ := route["final"].(string)
+	if final == "" {
+		final = "direct"
+	}
+	return RouteMatch{Index: -1, Field: "final", Action: "route", Outbound: final, Unchecked: unchecked}
+}
+
+// routeRuleApplies reports whether a rule can match a bare domain: a plain
+// rule with at least one address field and no other conditions
+func routeRuleApplies(rule map[string]interface{}) bool {
+	if t, _ := rule["type"].(string); t != "" && t != "default" {
+		return false
+	}
+	if invert, _ := rule["invert"].(bool); invert {
+		return false
+	}
+	hasAddress := false
+	for key := range rule {
+		if routeIgnoredFields[key] {
+			continue
+		}
+		isAddress := false
+		for _, field := range routeAddressFields {
+			if key == field {
+				isAddress = true
+				break
+			}
+		}
+		if !isAddress {
+			return false
+		}
+		hasAddress = true
+	}
+	return hasAddress
+}
+
+// matchRouteRule returns the field and value of the rule that match the target
+// ("" if none) and the rule-sets that couldn't be checked
+func matchRouteRule(rule map[string]interface{}, target routeTarget, ruleSets map[string]map[string]interface{}, matchRuleSet ruleSetMatcher) (string, string, []string) {
+	domain := target.Domain
+	if domain != "" {
+		for _, entry := range jsonStringList(rule["domain"]) {
+			if strings.EqualFold(entry, domain) {
+				return "domain", entry, nil
+			}
+		}
+		for _, entry := range jsonStringList(rule["domain_suffix"]) {
+			if domainHasSuffix(domain, entry) {
+				return "domain_suffix", entry, nil
+			}
+		}
+		for _, entry := range jsonStringList(rule["domain_keyword"]) {
+			if entry != "" && strings.Contains(domain, strings.ToLower(entry)) {
+				return "domain_keyword", entry, nil
+			}
+		}
+		for _, entry := range jsonStringList(rule["domain_regex"]) {
+			if re, err := regexp.Compile(entry); err == nil && re.MatchString(domain) {
+				return "domain_regex", entry, nil
+			}
+		}
+	}
+
+	for _, entry := range jsonStringList(rule["ip_cidr"]) {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			if ip := net.ParseIP(entry); ip != nil {
+				network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+			} else {
+				continue
+			}
+		}
+		for _, ip := range target.IPs {
+			if network.Contains(ip) {
+				return "ip_cidr", entry, nil
+			}
+		}
+	}
+	if private, _ := rule["ip_is_private"].(bool); private {
+		for _, ip := range target.IPs {
+			if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				return "ip_is_private", ip.String(), nil
+			}
+		}
+	}
+
+	var unchecked []string
+	for _, tag := range jsonStringList(rule["rule_set"]) {
+		rs, ok := ruleSets[tag]
+		if !ok || matchRuleSet == nil {
+			unchecked = append(unchecked, tag)
+			continue
+		}
+		values := make([]string, 0, len(target.IPs)+1)
+		if domain != "" {
+			values = append(values, domain)
+		}
+		for _, ip := range target.IPs {
+			values = append(values, ip.String())
+		}
+		for _, value := range values {
+			matched, err := matchRuleSet(rs, value)
+			if err != nil {
+				unchecked = append(unchecked, tag)
+				break
+			}
+			if matched {
+				return "rule_set", tag, unchecked
+			}
+		}
+	}
+	return "", "", unchecked
+}
+
+// domainHasSuffix matches like sing-box domain_suffix: ".example.com" matches
+// subdomains only, "example.com" the domain itself too
+func domainHasSuffix(domain, suffix string) bool {
+	suffix = strings.ToLower(suffix)
+	if suffix == "" {
+		return false
+	}
+	if strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(domain, suffix)
+	}
+	return domain == suffix || strings.HasSuffix(domain, "."+suffix)
+}
+
+// localRuleSetMatcher checks local rule-sets with `sing-box rule-set match`;
+// remote rule-sets aren't downloaded for an explanation. Results are cached,
+// the same rule-set is checked for every routing mode.
+func localRuleSetMatcher(singboxPath string) ruleSetMatcher {
+	cache := map[string]bool{}
+	return func(ruleSet map[string]interface{}, value string) (bool, error) {
+		if t, _ := ruleSet["type"].(string); t != "local" {
+			return false, fmt.Errorf("remote rule-set")
+		}
+		path, _ := ruleSet["path"].(string)
+		if path == "" || !fileExists(path) {
+			return false, fmt.Errorf("rule-set file missing")
+		}
+		if singboxPath == "" || !fileExists(singboxPath) {
+			return false, fmt.Errorf("sing-box not found")
+		}
+		format, _ := ruleSet["format"].(string)
+		if format == "" {
+			format = "binary"
+		}
+
+		key := path + "|" + value
+		if matched, ok := cache[key]; ok {
+			return matched, nil
+		}
+		output, err := runHiddenCommand(RuleSetMatchTimeout, singboxPath, "rule-set", "match", "-f", format, path, value)
+		if err != nil {
+			return false, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+		matched := strings.Contains(string(output), "match rules.")
+		cache[key] = matched
+		return matched, nil
+	}
+}
+
+// --- Config builder ---
+
+// RoutingModeRoutes returns the route section every routing mode would give
+// the profile: template.json with the mode, app and custom rules applied.
+func (b *ConfigBuilderForStorage) RoutingModeRoutes(profileID int) (map[RoutingMode]map[string]interface{}, error) {
+	templateData, err := os.ReadFile(b.storage.templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить template.json: %w", err)
+	}
+
+	var appRules []AppRule
+	var customRules *CustomDomainRules
+	if profile, err := b.storage.GetProfile(profileID); err == nil {
+		appRules = profile.AppRules
+		customRules = profile.CustomRules
+	}
+
+	routes := make(map[RoutingMode]map[string]interface{}, 3)
+	for _, mode := range []RoutingMode{RoutingModeBlockedOnly, RoutingModeExceptRussia, RoutingModeAllTraffic} {
+		var template map[string]interface{}
+		if err := json.Unmarshal(templateData, &template); err != nil {
+			return nil, fmt.Errorf("ошибка парсинга template.json: %w", err)
+		}
+		// Built-in modes don't fail
+		_ = b.generator.applyRoutingMode(template, mode, appRules, customRules, nil)
+		route, _ := template["route"].(map[string]interface{})
+		routes[mode] = route
+	}
+	return routes, nil
+}
@@ -0,0 +1,350 @@
+// Package main provides encryption of secrets at rest for KampusVPN.
+// settings.json lives next to the exe and gets attached to support tickets,
+// so secrets are stored as DPAPI blobs bound to the Windows user
+// ("dpapi:" + base64): WireGuard keys, the bootstrap proxy link, subscription
+// URLs and header values (they carry access tokens) and the credentials of
+// outbounds in stored sing-box configs (passwords, UUIDs, keys). Proxy
+// snapshots keep only credential hashes and are not encrypted; exports are
+// plaintext unless a passphrase is set. Plaintext values of older files are
+// read as is and encrypted on the next save. A blob that can't be decrypted
+// (settings copied from another user or machine) only breaks its own field:
+// the blob is kept, and the error is reported for that field.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// secretPrefix marks a DPAPI-encrypted value in settings files
+const secretPrefix = "dpapi:"
+
+// SecretString is a secret stored encrypted in settings files.
+type SecretString struct {
+	value  string
+	sealed string // Blob that couldn't be decrypted, written back unchanged
+	err    error
+	plain  bool // Marshalled as plaintext (exports)
+}
+
+// NewSecret wraps a plaintext secret.
+func NewSecret(value string) SecretString {
+	return SecretString{value: value}
+}
+
+// Value returns the plaintext ("" if it couldn't be decrypted).
+func (s SecretString) Value() string {
+	return s.value
+}
+
+// IsEmpty reports whether no secret is set
+func (s SecretString) IsEmpty() bool {
+	return s.value == "" && s.sealed == ""
+}
+
+// Err returns why the stored blob couldn't be decrypted (nil if it could).
+func (s SecretString) Err() error {
+	return s.err
+}
+
+// Exportable returns a copy marshalled as plaintext, for exports that must
+// work on another machine.
+func (s SecretString) Exportable() SecretString {
+	s.plain = true
+	return s
+}
+
+// String hides the secret from formatted logs
+func (s SecretString) String() string {
+	if s.IsEmpty() {
+		return ""
+	}
+	return "[secret]"
+}
+
+// MarshalJSON implements json.Marshaler. Without DPAPI the plaintext is
+// written as in older versions rather than losing the secret.
+func (s SecretString) MarshalJSON() ([]byte, error) {
+	if s.sealed != "" {
+		return json.Marshal(s.sealed)
+	}
+	if s.value == "" || s.plain {
+		return json.Marshal(s.value)
+	}
+	return json.Marshal(sealSecret(s.value))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It never fails on a bad blob,
+// so one broken field doesn't make the whole settings file unreadable.
+func (s *SecretString) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = SecretString{}
+	value, err := openSecret(raw)
+	if err != nil {
+		s.sealed = raw
+		s.err = err
+		return nil
+	}
+	s.value = value
+	return nil
+}
+
+// sealSecret returns the blob of value. Without DPAPI the plaintext is
+// returned as in older versions rather than losing the secret.
+func sealSecret(value string) string {
+	blob, err := dpapiProtect([]byte(value))
+	if err != nil {
+		fmt.Printf("[Secrets] Warning: DPAPI encryption failed, storing plaintext: %v\n", err)
+		return value
+	}
+	return secretPrefix + base64.StdEncoding.EncodeToString(blob)
+}
+
+// openSecret returns the plaintext of a stored value; values without the
+// prefix are plaintext of older files
+func openSecret(raw string) (string, error) {
+	if !strings.HasPrefix(raw, secretPrefix) {
+		return raw, nil
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(raw, secretPrefix))
+	if err == nil {
+		var plaintext []byte
+		if plaintext, err = dpapiUnprotect(blob); err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", fmt.Errorf("не удалось расшифровать секрет (настройки с другого компьютера или пользователя?): %w", err)
+}
+
+// dpapiProtect encrypts data for the current Windows user
+func dpapiProtect(data []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// dpapiUnprotect decrypts data encrypted by dpapiProtect
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty blob")
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// exportableWireGuardConfigs returns the configs with secrets marshalled as plaintext
+// and without the local consent to run scripts
+func exportableWireGuardConfigs(configs []UserWireGuardConfig) []UserWireGuardConfig {
+	if configs == nil {
+		return nil
+	}
+	result := withoutScriptConsent(configs)
+	for i, wg := range result {
+		wg.PrivateKey = wg.PrivateKey.Exportable()
+		wg.PresharedKey = wg.PresharedKey.Exportable()
+		result[i] = wg
+	}
+	return result
+}
+
+// wireGuardSecretErrors returns the WireGuard keys that couldn't be decrypted,
+// keyed like "<tag>.private_key"
+func wireGuardSecretErrors(configs []UserWireGuardConfig) map[string]string {
+	errs := map[string]string{}
+	for _, wg := range configs {
+		if err := wg.PrivateKey.Err(); err != nil {
+			errs[wg.Tag+".private_key"] = err.Error()
+		}
+		if err := wg.PresharedKey.Err(); err != nil {
+			errs[wg.Tag+".preshared_key"] = err.Error()
+		}
+	}
+	return errs
+}
+
+// logSecretErrors reports the secrets of loaded settings that couldn't be decrypted
+func logSecretErrors(settings *SettingsFile, profileErrs map[int]map[string]string) {
+	if err := settings.App.BootstrapProxy.Err(); err != nil {
+		fmt.Printf("[Secrets] Bootstrap proxy: %v\n", err)
+	}
+	for _, profile := range settings.Profiles {
+		errs := wireGuardSecretErrors(profile.WireGuardConfigs)
+		for field, err := range profileErrs[profile.ID] {
+			errs[field] = err
+		}
+		fields := make([]string, 0, len(errs))
+		for field := range errs {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Printf("[Secrets] Profile %d, %s: %s\n", profile.ID, field, errs[field])
+		}
+	}
+}
+
+// outboundSecretKeys are the outbound options holding credentials
+var outboundSecretKeys = map[string]bool{
+	"password":               true,
+	"uuid":                   true,
+	"auth":                   true,
+	"auth_str":               true,
+	"private_key":            true,
+	"pre_shared_key":         true,
+	"private_key_passphrase": true,
+}
+
+// profileSecrets seals and opens the secrets of profiles in settings.json.
+// Blobs are remembered by plaintext, so a save writes unchanged secrets back
+// byte-identical without calling DPAPI again.
+type profileSecrets struct {
+	blobs map[string]string // Plaintext -> blob of the last load or save
+	next  map[string]string // Blobs used by the save in progress
+}
+
+// seal returns the blob of value. A blob that couldn't be opened is kept as is.
+func (p *profileSecrets) seal(value string) string {
+	if value == "" || strings.HasPrefix(value, secretPrefix) {
+		return value
+	}
+	blob, ok := p.blobs[value]
+	if !ok {
+		blob = sealSecret(value)
+	}
+	if p.next != nil {
+		p.next[value] = blob
+	}
+	return blob
+}
+
+// open returns the plaintext of a stored value, or the value and the error
+// if it can't be decrypted
+func (p *profileSecrets) open(value string) (string, error) {
+	plaintext, err := openSecret(value)
+	if err != nil {
+		return value, err
+	}
+	if plaintext != value {
+		if p.blobs == nil {
+			p.blobs = map[string]string{}
+		}
+		p.blobs[plaintext] = value
+	}
+	return plaintext, nil
+}
+
+// sealSettings returns a copy of settings for settings.json with the profile
+// secrets sealed; the profiles of settings are not modified
+func (p *profileSecrets) sealSettings(settings *SettingsFile) *SettingsFile {
+	p.next = map[string]string{}
+	defer func() {
+		p.blobs, p.next = p.next, nil
+	}()
+
+	sealed := *settings
+	sealed.Profiles = make([]ProfileData, len(settings.Profiles))
+	for i, profile := range settings.Profiles {
+		profile.SubscriptionURL = p.seal(profile.SubscriptionURL)
+		if profile.Subscriptions != nil {
+			subscriptions := make([]SubscriptionEntry, len(profile.Subscriptions))
+			for j, entry := range profile.Subscriptions {
+				entry.URL = p.seal(entry.URL)
+				subscriptions[j] = entry
+			}
+			profile.Subscriptions = subscriptions
+		}
+		if profile.SubscriptionHeaders != nil {
+			headers := make(map[string]string, len(profile.SubscriptionHeaders))
+			for name, value := range profile.SubscriptionHeaders {
+				headers[name] = p.seal(value)
+			}
+			profile.SubscriptionHeaders = headers
+		}
+		if profile.SingboxConfig != nil {
+			config := make(SingboxConfigMap, len(profile.SingboxConfig))
+			for key, value := range profile.SingboxConfig {
+				config[key] = value
+			}
+			for _, section := range []string{"outbounds", "endpoints"} {
+				if value, ok := config[section]; ok {
+					value = deepCopyJSONValue(value)
+					mapOutboundSecrets(value, "", func(_, secret string) string { return p.seal(secret) })
+					config[section] = value
+				}
+			}
+			profile.SingboxConfig = config
+		}
+		sealed.Profiles[i] = profile
+	}
+	return &sealed
+}
+
+// openProfile decrypts the secrets of a loaded profile in place and returns
+// the fields that couldn't be decrypted; they keep their blob
+func (p *profileSecrets) openProfile(profile *ProfileData) map[string]string {
+	errs := map[string]string{}
+	open := func(field, value string) string {
+		plaintext, err := p.open(value)
+		if err != nil {
+			errs[field] = err.Error()
+		}
+		return plaintext
+	}
+
+	profile.SubscriptionURL = open("subscription_url", profile.SubscriptionURL)
+	for i := range profile.Subscriptions {
+		profile.Subscriptions[i].URL = open(fmt.Sprintf("subscriptions[%d].url", i), profile.Subscriptions[i].URL)
+	}
+	for name, value := range profile.SubscriptionHeaders {
+		profile.SubscriptionHeaders[name] = open("subscription_headers."+name, value)
+	}
+	for _, section := range []string{"outbounds", "endpoints"} {
+		mapOutboundSecrets(profile.SingboxConfig[section], section, open)
+	}
+	return errs
+}
+
+// mapOutboundSecrets replaces the credential options of outbounds in place,
+// nested ones (TLS, obfs, WireGuard peers) included. fn gets the option path
+// (section.tag.key) and the value.
+func mapOutboundSecrets(value interface{}, path string, fn func(field, secret string) string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if tag, ok := v["tag"].(string); ok {
+			path += "." + tag
+		}
+		for key, item := range v {
+			if secret, ok := item.(string); ok && outboundSecretKeys[key] && secret != "" {
+				v[key] = fn(path+"."+key, secret)
+				continue
+			}
+			mapOutboundSecrets(item, path, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			mapOutboundSecrets(item, path, fn)
+		}
+	case []map[string]interface{}:
+		for _, item := range v {
+			mapOutboundSecrets(item, path, fn)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testSecretsProfile returns a profile with every kind of stored secret
+func testSecretsProfile() ProfileData {
+	return ProfileData{
+		ID:              2,
+		Name:            "Work",
+		SubscriptionURL: "https://sub.example.com/api/v1/client/subscribe?token=abc123",
+		Subscriptions: []SubscriptionEntry{
+			{URL: "https://sub.example.com/api/v1/client/subscribe?token=abc123", Name: "Main"},
+			{URL: "https://other.example.com/s/xyz789", Name: "Reserve"},
+		},
+		SubscriptionHeaders: map[string]string{"Authorization": "Bearer tkn"},
+		SingboxConfig: SingboxConfigMap{
+			"outbounds": []interface{}{
+				map[string]interface{}{"type": "vless", "tag": "de", "server": "de.example.com", "uuid": "b831381d-6324-4d53-ad4f-8cda48b30811"},
+				map[string]interface{}{"type": "shadowsocks", "tag": "nl", "password": "ss-pass", "method": "aes-128-gcm"},
+				map[string]interface{}{"type": "hysteria2", "tag": "us", "password": "hy-pass",
+					"obfs": map[string]interface{}{"type": "salamander", "password": "obfs-pass"}},
+				map[string]interface{}{"type": "selector", "tag": "proxy", "outbounds": []interface{}{"de", "nl", "us"}},
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{"type": "wireguard", "tag": "wg", "private_key": "wg-key",
+					"peers": []interface{}{map[string]interface{}{"public_key": "peer-pub", "pre_shared_key": "psk"}}},
+			},
+			"route": map[string]interface{}{"final": "proxy"},
+		},
+	}
+}
+
+// testSecretPlaintexts are the secrets of testSecretsProfile
+var testSecretPlaintexts = []string{
+	"token=abc123", "xyz789", "Bearer tkn", "b831381d-6324-4d53-ad4f-8cda48b30811",
+	"ss-pass", "hy-pass", "obfs-pass", "wg-key", "psk",
+}
+
+func TestSealSettingsEncryptsProfileSecrets(t *testing.T) {
+	var secrets profileSecrets
+	settings := &SettingsFile{Profiles: []ProfileData{testSecretsProfile()}}
+
+	data, err := json.Marshal(secrets.sealSettings(settings))
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	for _, plaintext := range testSecretPlaintexts {
+		if strings.Contains(string(data), plaintext) {
+			t.Errorf("settings.json contains %q:\n%s", plaintext, data)
+		}
+	}
+	for _, kept := range []string{"de.example.com", "aes-128-gcm", "peer-pub", `"final":"proxy"`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("settings.json lacks non-secret %q", kept)
+		}
+	}
+
+	// The profiles in memory stay plaintext
+	if got := settings.Profiles[0].SingboxConfig["outbounds"].([]interface{})[1].(map[string]interface{})["password"]; got != "ss-pass" {
+		t.Errorf("in-memory password = %v, want plaintext", got)
+	}
+	if settings.Profiles[0].SubscriptionHeaders["Authorization"] != "Bearer tkn" {
+		t.Error("in-memory subscription header sealed")
+	}
+
+	var loaded SettingsFile
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	var reader profileSecrets
+	if errs := reader.openProfile(&loaded.Profiles[0]); len(errs) != 0 {
+		t.Fatalf("openProfile errors: %v", errs)
+	}
+	want, _ := json.Marshal(settings.Profiles[0])
+	got, _ := json.Marshal(loaded.Profiles[0])
+	if string(got) != string(want) {
+		t.Errorf("round trip:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestOpenProfilePlaintextFallback(t *testing.T) {
+	// settings.json of older versions: secrets in plaintext
+	profile := testSecretsProfile()
+	var secrets profileSecrets
+	if errs := secrets.openProfile(&profile); len(errs) != 0 {
+		t.Fatalf("openProfile errors for plaintext: %v", errs)
+	}
+	if profile.SubscriptionURL != testSecretsProfile().SubscriptionURL {
+		t.Errorf("SubscriptionURL = %q, want read as is", profile.SubscriptionURL)
+	}
+
+	// The next save encrypts them
+	data, _ := json.Marshal(secrets.sealSettings(&SettingsFile{Profiles: []ProfileData{profile}}))
+	if strings.Contains(string(data), "ss-pass") {
+		t.Errorf("plaintext secret not encrypted on save:\n%s", data)
+	}
+}
+
+func TestOpenProfileUndecryptableField(t *testing.T) {
+	var secrets profileSecrets
+	sealed := secrets.sealSettings(&SettingsFile{Profiles: []ProfileData{testSecretsProfile()}})
+	profile := sealed.Profiles[0]
+
+	// A blob of another user or machine
+	foreign := secretPrefix + base64.StdEncoding.EncodeToString([]byte("not a DPAPI blob"))
+	outbounds := profile.SingboxConfig["outbounds"].([]interface{})
+	outbounds[1].(map[string]interface{})["password"] = foreign
+	profile.SubscriptionHeaders["Authorization"] = foreign
+
+	var reader profileSecrets
+	errs := reader.openProfile(&profile)
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want the two broken fields", errs)
+	}
+	for _, field := range []string{"outbounds.nl.password", "subscription_headers.Authorization"} {
+		if errs[field] == "" {
+			t.Errorf("no error for %s: %v", field, errs)
+		}
+	}
+
+	// Broken fields keep their blob, the others are decrypted
+	if got := outbounds[1].(map[string]interface{})["password"]; got != foreign {
+		t.Errorf("undecryptable password = %v, want the blob kept", got)
+	}
+	if got := outbounds[0].(map[string]interface{})["uuid"]; got != "b831381d-6324-4d53-ad4f-8cda48b30811" {
+		t.Errorf("uuid = %v, want decrypted", got)
+	}
+	if profile.SubscriptionURL != testSecretsProfile().SubscriptionURL {
+		t.Errorf("SubscriptionURL = %q, want decrypted", profile.SubscriptionURL)
+	}
+
+	// Saving again writes the kept blob back unchanged
+	resealed := reader.sealSettings(&SettingsFile{Profiles: []ProfileData{profile}})
+	if got := resealed.Profiles[0].SubscriptionHeaders["Authorization"]; got != foreign {
+		t.Errorf("kept blob re-saved as %q", got)
+	}
+}
+
+func TestSealSettingsReusesBlobs(t *testing.T) {
+	var secrets profileSecrets
+	settings := &SettingsFile{Profiles: []ProfileData{testSecretsProfile()}}
+
+	first, _ := json.Marshal(secrets.sealSettings(settings))
+	second, _ := json.Marshal(secrets.sealSettings(settings))
+	if string(first) != string(second) {
+		t.Error("unchanged secrets re-encrypted on the next save")
+	}
+
+	// After a load the blobs of the file are reused too
+	var loaded SettingsFile
+	if err := json.Unmarshal(first, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	var reader profileSecrets
+	reader.openProfile(&loaded.Profiles[0])
+	third, _ := json.Marshal(reader.sealSettings(&loaded))
+	if string(third) != string(first) {
+		t.Error("loaded secrets re-encrypted on save")
+	}
+
+	// A changed secret gets a new blob, a removed one leaves the cache
+	settings.Profiles[0].SubscriptionHeaders["Authorization"] = "Bearer new"
+	secrets.sealSettings(settings)
+	if _, ok := secrets.blobs["Bearer tkn"]; ok {
+		t.Error("blob of a removed secret kept in the cache")
+	}
+	if _, ok := secrets.blobs["Bearer new"]; !ok {
+		t.Error("blob of the new secret not cached")
+	}
+}
+
+func TestSecretStringJSON(t *testing.T) {
+	secret := NewSecret("private-key")
+	data, err := json.Marshal(secret)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if !strings.HasPrefix(string(data), `"`+secretPrefix) {
+		t.Errorf("SecretString marshalled as %s, want a blob", data)
+	}
+
+	var loaded SecretString
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if loaded.Value() != "private-key" || loaded.Err() != nil {
+		t.Errorf("loaded = %q, %v", loaded.Value(), loaded.Err())
+	}
+
+	if data, _ := json.Marshal(secret.Exportable()); string(data) != `"private-key"` {
+		t.Errorf("exportable secret marshalled as %s, want plaintext", data)
+	}
+
+	var plain SecretString
+	if err := json.Unmarshal([]byte(`"old-plaintext"`), &plain); err != nil || plain.Value() != "old-plaintext" {
+		t.Errorf("plaintext of older files = %q, %v", plain.Value(), err)
+	}
+
+	foreign := secretPrefix + base64.StdEncoding.EncodeToString([]byte("garbage"))
+	var broken SecretString
+	if err := json.Unmarshal([]byte(`"`+foreign+`"`), &broken); err != nil {
+		t.Fatalf("undecryptable blob failed the whole unmarshal: %v", err)
+	}
+	if broken.Err() == nil || broken.Value() != "" {
+		t.Errorf("undecryptable blob = %q, %v; want an error", broken.Value(), broken.Err())
+	}
+	if data, _ := json.Marshal(broken); string(data) != `"`+foreign+`"` {
+		t.Errorf("undecryptable blob re-saved as %s, want kept", data)
+	}
+}
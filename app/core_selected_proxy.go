@@ -0,0 +1,62 @@
+// Package main provides the remembered proxy selection for KampusVPN.
+// A proxy picked in the UI is saved with the profile and becomes the default
+// of the "proxy" selector, so it survives sing-box restarts.
+package main
+
+import (
+	"fmt"
+)
+
+// applySelectedProxy makes name the default of the "proxy" selector if the
+// selector offers it. Returns false when the proxy is no longer in the config.
+func applySelectedProxy(config map[string]interface{}, name string) bool {
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, o := range outbounds {
+		outbound, ok := o.(map[string]interface{})
+		if !ok || outbound["type"] != "selector" || outbound["tag"] != ConnectMeasureSelector {
+			continue
+		}
+		for _, member := range jsonStringList(outbound["outbounds"]) {
+			if member == name {
+				outbound["default"] = name
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// jsonStringList returns a string list from decoded JSON or a generated config
+func jsonStringList(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// SetProfileSelectedProxy remembers the proxy chosen in the selector ("" = auto-select).
+func (s *Storage) SetProfileSelectedProxy(id int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			if s.data.Profiles[i].SelectedProxy == name {
+				return nil
+			}
+			s.data.Profiles[i].SelectedProxy = name
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
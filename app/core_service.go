@@ -0,0 +1,627 @@
+// Package main provides the privileged service of KampusVPN.
+// Installed once with admin rights, a copy of the executable started with
+// --service runs as a Windows service and starts sing-box on request of the
+// unelevated GUI over a named pipe. The service and its sing-box are copied
+// into an admin-only folder under Program Files, and the service refuses to
+// start if anyone else can write there. It runs only configs from the app's
+// resources folder, as a checked copy in its own folder, so it can't be used
+// to run arbitrary programs or write arbitrary files as SYSTEM.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+)
+
+// Service settings
+const (
+	// ServiceFlag starts the executable as the privileged service
+	ServiceFlag = "--service"
+	// ServiceName is the name the service is registered under
+	ServiceName = "KampusVPNService"
+	// ServiceDisplayName is shown in services.msc
+	ServiceDisplayName = "Kampus VPN Service"
+	// servicePipeName is the pipe the GUI talks to the service over
+	servicePipeName = `\\.\pipe\KampusVPNService`
+	// ServiceFolderName is the folder under Program Files the service runs from
+	ServiceFolderName = "KampusVPN Service"
+	// ServiceResourcesFlag passes the resources folder of the app to the service
+	ServiceResourcesFlag = "--resources"
+	// serviceDataFolder holds the config copy, cache file and log of the service
+	serviceDataFolder = "data"
+	// serviceConfigFile is the checked config copy sing-box runs
+	serviceConfigFile = "config.json"
+	// servicePipeSDDL gives SYSTEM and administrators full access and
+	// interactive users read/write, so the unelevated GUI can connect
+	// (services and network logons can't)
+	servicePipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GRGW;;;IU)"
+	// serviceHeartbeat is how often a quiet sing-box session is checked for a
+	// vanished GUI (a failed write means the GUI is gone)
+	serviceHeartbeat = 5 * time.Second
+)
+
+// Service commands
+const (
+	ServiceCommandStatus = "status"
+	ServiceCommandStart  = "start"
+	ServiceCommandStop   = "stop"
+)
+
+// Service session events
+const (
+	ServiceEventLog       = "log"
+	ServiceEventExit      = "exit"
+	ServiceEventHeartbeat = "heartbeat"
+)
+
+// serviceRequest is one request line of the GUI
+type serviceRequest struct {
+	Command    string `json:"command"`
+	ConfigPath string `json:"config_path,omitempty"`
+}
+
+// serviceMessage is one response or event line of the service.
+// A start request is answered once, then the same connection carries the log
+// lines of sing-box and ends with the exit event.
+type serviceMessage struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Running bool   `json:"running"`
+	PID     int    `json:"pid,omitempty"`
+	Event   string `json:"event,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Line    string `json:"line,omitempty"`
+}
+
+// serviceModeRequested reports whether the executable was started as the service
+func serviceModeRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == ServiceFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceResourcesArg returns the value of ServiceResourcesFlag ("" if missing)
+func serviceResourcesArg(args []string) string {
+	for i, arg := range args {
+		if arg == ServiceResourcesFlag && i+1 < len(args) {
+			return filepath.Clean(args[i+1])
+		}
+	}
+	return ""
+}
+
+// serviceInstallDir returns the admin-only folder the service is installed into
+func serviceInstallDir() string {
+	programFiles, err := windows.KnownFolderPath(windows.FOLDERID_ProgramFiles, 0)
+	if err != nil {
+		programFiles = `C:\Program Files`
+	}
+	return filepath.Join(programFiles, ServiceFolderName)
+}
+
+// runService runs the service until the service manager stops it
+func runService() {
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Fatalf("service: %v", err)
+	}
+	exePath, _ = filepath.EvalSymlinks(exePath)
+	exeDir := filepath.Dir(exePath)
+	dataPath := filepath.Join(exeDir, serviceDataFolder)
+	os.MkdirAll(dataPath, 0755)
+
+	if logFile, err := os.OpenFile(filepath.Join(dataPath, "service.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		defer logFile.Close()
+		log.SetOutput(logFile)
+	}
+
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		log.Printf("service: %s must be started by the service manager", ServiceFlag)
+		return
+	}
+
+	core := &serviceCore{
+		exePath:       exePath,
+		resourcesPath: serviceResourcesArg(os.Args[1:]),
+		dataPath:      dataPath,
+		// Only the copy in the service folder, never the app's own sing-box
+		singboxPath: filepath.Join(exeDir, "bin", "sing-box.exe"),
+	}
+	if err := svc.Run(ServiceName, &kampusService{core: core}); err != nil {
+		log.Printf("service: %v", err)
+	}
+}
+
+// kampusService is the svc.Handler of the service
+type kampusService struct {
+	core *serviceCore
+}
+
+// Execute serves the pipe until stop or shutdown
+func (s *kampusService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	if err := s.core.checkInstallation(); err != nil {
+		log.Printf("service: refusing to start: %v", err)
+		return true, 1
+	}
+
+	listener, err := newServicePipeListener()
+	if err != nil {
+		log.Printf("service: pipe: %v", err)
+		return true, 1
+	}
+	go listener.serve(s.core.handle)
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	log.Printf("service: started, sing-box %s", s.core.singboxPath)
+
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			changes <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			s.core.stop()
+			log.Printf("service: stopped")
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// --- Pipe server ---
+
+// servicePipeListener creates pipe instances and hands connected clients over
+type servicePipeListener struct {
+	sa    *windows.SecurityAttributes
+	first bool
+}
+
+// newServicePipeListener prepares the pipe security
+func newServicePipeListener() (*servicePipeListener, error) {
+	sd, err := windows.SecurityDescriptorFromString(servicePipeSDDL)
+	if err != nil {
+		return nil, err
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	return &servicePipeListener{sa: sa, first: true}, nil
+}
+
+// accept creates a pipe instance and waits for a client
+func (l *servicePipeListener) accept() (*os.File, error) {
+	name, err := windows.UTF16PtrFromString(servicePipeName)
+	if err != nil {
+		return nil, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX)
+	if l.first {
+		// Fail instead of sharing the name with a pipe another process created first
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	handle, err := windows.CreateNamedPipe(name, flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, 4096, 4096, 0, l.sa)
+	if err != nil {
+		return nil, err
+	}
+	l.first = false
+
+	if err := windows.ConnectNamedPipe(handle, nil); err != nil && err != windows.ERROR_PIPE_CONNECTED {
+		windows.CloseHandle(handle)
+		return nil, err
+	}
+	return os.NewFile(uintptr(handle), servicePipeName), nil
+}
+
+// serve accepts clients forever, each in its own goroutine
+func (l *servicePipeListener) serve(handle func(conn *os.File)) {
+	for {
+		conn, err := l.accept()
+		if err != nil {
+			log.Printf("service: accept: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go handle(conn)
+	}
+}
+
+// --- sing-box control ---
+
+// serviceCore runs one sing-box at a time for the GUI
+type serviceCore struct {
+	mu            sync.Mutex
+	exePath       string
+	resourcesPath string // Resources folder of the app (configs come from there)
+	dataPath      string // Service folder for the config copy, cache and log
+	singboxPath   string
+	cmd           *exec.Cmd
+}
+
+// checkInstallation refuses a service whose binaries or data folder non-admins
+// can write: replacing them would run code as SYSTEM
+func (c *serviceCore) checkInstallation() error {
+	if c.resourcesPath == "" {
+		return fmt.Errorf("не указан %s", ServiceResourcesFlag)
+	}
+	exeDir := filepath.Dir(c.exePath)
+	for _, path := range []string{exeDir, c.exePath, filepath.Dir(c.singboxPath), c.singboxPath, c.dataPath} {
+		if err := checkAdminOnly(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceConn writes messages of one connection; writers are serialized
+type serviceConn struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (c *serviceConn) send(msg serviceMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(msg)
+}
+
+// handle serves one connection: one request, then the reply (and the session for start)
+func (c *serviceCore) handle(conn *os.File) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req serviceRequest
+	out := &serviceConn{enc: json.NewEncoder(conn)}
+	if err := json.Unmarshal(line, &req); err != nil {
+		out.send(serviceMessage{Error: fmt.Sprintf("неверный запрос: %v", err)})
+		return
+	}
+
+	switch req.Command {
+	case ServiceCommandStatus:
+		out.send(c.status())
+	case ServiceCommandStop:
+		c.stop()
+		out.send(serviceMessage{OK: true})
+	case ServiceCommandStart:
+		c.run(req.ConfigPath, out)
+	default:
+		out.send(serviceMessage{Error: fmt.Sprintf("неизвестная команда: %s", req.Command)})
+	}
+}
+
+// status returns whether sing-box is running
+func (c *serviceCore) status() serviceMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msg := serviceMessage{OK: true}
+	if c.cmd != nil {
+		msg.Running = true
+		msg.PID = c.cmd.Process.Pid
+	}
+	return msg
+}
+
+// run starts sing-box with configPath and streams its output to the client
+// until it exits. If the client goes away, sing-box is stopped: a tunnel
+// nobody controls must not outlive the GUI.
+func (c *serviceCore) run(configPath string, out *serviceConn) {
+	c.mu.Lock()
+	if c.cmd != nil {
+		c.mu.Unlock()
+		out.send(serviceMessage{Error: "sing-box уже запущен"})
+		return
+	}
+
+	// sing-box runs the checked copy: the original stays writable by the user
+	data, err := prepareServiceConfig(c.resourcesPath, c.dataPath, configPath)
+	if err != nil {
+		c.mu.Unlock()
+		log.Printf("service: rejected config %q: %v", configPath, err)
+		out.send(serviceMessage{Error: err.Error()})
+		return
+	}
+	runPath := filepath.Join(c.dataPath, serviceConfigFile)
+	if err := os.WriteFile(runPath, data, 0600); err != nil {
+		c.mu.Unlock()
+		out.send(serviceMessage{Error: fmt.Sprintf("ошибка записи конфига: %v", err)})
+		return
+	}
+
+	cmd := exec.Command(c.singboxPath, "run", "-c", runPath)
+	cmd.Dir = c.dataPath
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: 0x08000000} // CREATE_NO_WINDOW
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+	if err := cmd.Start(); err != nil {
+		c.mu.Unlock()
+		out.send(serviceMessage{Error: fmt.Sprintf("ошибка запуска sing-box: %v", err)})
+		return
+	}
+	c.cmd = cmd
+	c.mu.Unlock()
+
+	log.Printf("service: sing-box started, pid %d, config %s", cmd.Process.Pid, configPath)
+	stopSession := sync.OnceFunc(c.stop)
+	if err := out.send(serviceMessage{OK: true, Running: true, PID: cmd.Process.Pid}); err != nil {
+		stopSession()
+	}
+
+	var readers sync.WaitGroup
+	for source, reader := range map[string]io.Reader{LogSourceOut: stdout, LogSourceErr: stderr} {
+		readers.Add(1)
+		go func(source string, reader io.Reader) {
+			defer readers.Done()
+			scanner := bufio.NewScanner(reader)
+			for scanner.Scan() {
+				if out.send(serviceMessage{Event: ServiceEventLog, Source: source, Line: scanner.Text()}) != nil {
+					stopSession()
+				}
+			}
+		}(source, reader)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(serviceHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if out.send(serviceMessage{Event: ServiceEventHeartbeat}) != nil {
+					log.Printf("service: client gone, stopping sing-box")
+					stopSession()
+					return
+				}
+			}
+		}
+	}()
+
+	readers.Wait()
+	err = cmd.Wait()
+	close(done)
+
+	c.mu.Lock()
+	c.cmd = nil
+	c.mu.Unlock()
+
+	exit := serviceMessage{OK: true, Event: ServiceEventExit}
+	if err != nil {
+		exit.Error = err.Error()
+	}
+	log.Printf("service: sing-box exited: %v", err)
+	out.send(exit)
+}
+
+// stop terminates the running sing-box (no-op if none)
+func (c *serviceCore) stop() {
+	c.mu.Lock()
+	cmd := c.cmd
+	c.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	runHiddenCommand(10*time.Second, "taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", cmd.Process.Pid))
+}
+
+// serviceForbiddenOptions make sing-box write files or start programs as SYSTEM
+var serviceForbiddenOptions = map[string]bool{
+	"acme":            true, // TLS certificates issued into data_directory
+	"data_directory":  true,
+	"state_directory": true,
+	"cache_path":      true,
+	"executable_path": true, // tor
+	"torrc":           true,
+}
+
+// prepareServiceConfig reads a .json config inside resourcesPath (symlinks
+// resolved) and returns the copy the service runs. The log goes to the pipe,
+// the cache file and working directory are in dataPath, options that write
+// elsewhere or start programs are rejected, and files sing-box reads must be
+// inside the app or service folders. The returned bytes are what runs, so the
+// original can't be swapped after the check.
+func prepareServiceConfig(resourcesPath, dataPath, configPath string) ([]byte, error) {
+	root, err := filepath.EvalSymlinks(resourcesPath)
+	if err != nil {
+		return nil, fmt.Errorf("папка ресурсов недоступна: %v", err)
+	}
+	if !strings.EqualFold(filepath.Ext(configPath), ".json") {
+		return nil, fmt.Errorf("конфиг должен быть .json файлом")
+	}
+	resolved, err := filepath.EvalSymlinks(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("конфиг недоступен: %v", err)
+	}
+	if !pathInside(root, resolved) {
+		return nil, fmt.Errorf("конфиг вне папки приложения: %s", configPath)
+	}
+
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("конфиг недоступен: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("неверный конфиг: %v", err)
+	}
+	if err := sanitizeServiceConfig(config, root, dataPath); err != nil {
+		return nil, err
+	}
+	return json.Marshal(config)
+}
+
+// sanitizeServiceConfig rewrites the file options of a config for the service
+// and rejects the ones it can't rewrite
+func sanitizeServiceConfig(config map[string]interface{}, resourcesPath, dataPath string) error {
+	if _, ok := config["services"]; ok {
+		return fmt.Errorf("конфиг с services не поддерживается сервисом")
+	}
+	if logSection, ok := config["log"].(map[string]interface{}); ok {
+		delete(logSection, "output")
+	}
+	if experimental, ok := config["experimental"].(map[string]interface{}); ok {
+		if cacheFile, ok := experimental["cache_file"].(map[string]interface{}); ok {
+			cacheFile["path"] = filepath.Join(dataPath, URLTestCacheFile)
+		}
+		if clashAPI, ok := experimental["clash_api"].(map[string]interface{}); ok {
+			delete(clashAPI, "external_ui")
+			delete(clashAPI, "external_ui_download_url")
+			delete(clashAPI, "external_ui_download_detour")
+		}
+	}
+
+	// Local rule sets are relative to the resources folder, as in direct mode
+	mapConfigPaths(config, func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(resourcesPath, path)
+	})
+
+	roots := []string{filepath.Dir(resourcesPath), dataPath}
+	if route, ok := config["route"].(map[string]interface{}); ok {
+		ruleSets, _ := route["rule_set"].([]interface{})
+		for _, item := range ruleSets {
+			if rs, ok := item.(map[string]interface{}); ok && rs["type"] == "local" {
+				path, _ := rs["path"].(string)
+				if err := checkServiceReadPath(path, dataPath, roots); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return checkServiceConfigValue(config, dataPath, roots)
+}
+
+// checkServiceConfigValue rejects forbidden options anywhere in the config and
+// file options (*_path) outside roots
+func checkServiceConfigValue(value interface{}, dataPath string, roots []string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if serviceForbiddenOptions[key] {
+				return fmt.Errorf("опция %q не поддерживается сервисом", key)
+			}
+			// process_path is a routing match, not a file sing-box opens
+			if path, ok := item.(string); ok && strings.HasSuffix(key, "_path") && key != "process_path" {
+				if err := checkServiceReadPath(path, dataPath, roots); err != nil {
+					return err
+				}
+			}
+			if err := checkServiceConfigValue(item, dataPath, roots); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := checkServiceConfigValue(item, dataPath, roots); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkServiceReadPath accepts a file path inside one of roots (relative paths
+// are relative to dataPath, the working directory of sing-box)
+func checkServiceReadPath(path, dataPath string, roots []string) error {
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dataPath, path)
+	}
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	for _, root := range roots {
+		if pathInside(root, path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("конфиг обращается к файлу вне папки приложения: %s", path)
+}
+
+// serviceWriteAccess are the rights that let a user replace or change a file
+// or folder (0x40 is FILE_DELETE_CHILD)
+const serviceWriteAccess = windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA | 0x40 |
+	windows.DELETE | windows.WRITE_DAC | windows.WRITE_OWNER | windows.GENERIC_WRITE | windows.GENERIC_ALL
+
+// trustedInstallerSID owns system files and may write Program Files
+const trustedInstallerSID = "S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464"
+
+// isAdminSID reports whether sid is SYSTEM, administrators or TrustedInstaller
+func isAdminSID(sid *windows.SID) bool {
+	return sid.IsWellKnown(windows.WinLocalSystemSid) ||
+		sid.IsWellKnown(windows.WinBuiltinAdministratorsSid) ||
+		sid.String() == trustedInstallerSID
+}
+
+// checkAdminOnly returns an error unless only admins own and can write path
+func checkAdminOnly(path string) error {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.OWNER_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	owner, _, err := sd.Owner()
+	if err != nil || owner == nil || !isAdminSID(owner) {
+		return fmt.Errorf("%s: владелец не администратор", path)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil || dacl == nil {
+		return fmt.Errorf("%s: нет списка доступа", path)
+	}
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE ||
+			ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 ||
+			ace.Mask&serviceWriteAccess == 0 {
+			continue
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if !isAdminSID(sid) {
+			return fmt.Errorf("%s: запись разрешена не только администраторам (%s)", path, sid.String())
+		}
+	}
+	return nil
+}
+
+// pathInside reports whether path is root or below it
+func pathInside(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serviceTestFolders creates an app folder with resources and a service data folder
+func serviceTestFolders(t *testing.T) (resources, data string) {
+	t.Helper()
+	resources = filepath.Join(t.TempDir(), "app", ResourcesFolder)
+	data = filepath.Join(t.TempDir(), "service", serviceDataFolder)
+	for _, dir := range []string{resources, data} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Paths are compared after resolving symlinks (temp folders may be links)
+	resources, _ = filepath.EvalSymlinks(resources)
+	data, _ = filepath.EvalSymlinks(data)
+	return resources, data
+}
+
+// writeServiceTestConfig writes config as JSON into dir
+func writeServiceTestConfig(t *testing.T, dir, name string, config map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrepareServiceConfigRewritesFileOptions(t *testing.T) {
+	resources, data := serviceTestFolders(t)
+	filters := filepath.Join(filepath.Dir(resources), "bin", FiltersFolder, "ads.srs")
+
+	path := writeServiceTestConfig(t, resources, "config.json", map[string]interface{}{
+		"log": map[string]interface{}{"level": "info", "output": `C:\Windows\System32\drivers\etc\hosts`},
+		"experimental": map[string]interface{}{
+			"cache_file": map[string]interface{}{"enabled": true, "path": `C:\Windows\evil.db`},
+			"clash_api": map[string]interface{}{
+				"external_controller":      "127.0.0.1:9090",
+				"external_ui":              `C:\Windows\System32`,
+				"external_ui_download_url": "https://example.com/ui.zip",
+			},
+		},
+		"route": map[string]interface{}{
+			"rule_set": []interface{}{
+				map[string]interface{}{"tag": "ads", "type": "local", "path": filters},
+				map[string]interface{}{"tag": "local-rel", "type": "local", "path": "rules/custom.srs"},
+				map[string]interface{}{"tag": "remote", "type": "remote", "url": "https://example.com/r.srs"},
+			},
+		},
+	})
+
+	out, err := prepareServiceConfig(resources, data, path)
+	if err != nil {
+		t.Fatalf("prepareServiceConfig: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(out, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := config["log"].(map[string]interface{})["output"]; ok {
+		t.Error("log.output kept")
+	}
+	experimental := config["experimental"].(map[string]interface{})
+	cachePath := experimental["cache_file"].(map[string]interface{})["path"]
+	if cachePath != filepath.Join(data, URLTestCacheFile) {
+		t.Errorf("cache_file.path = %v, want inside the service data folder", cachePath)
+	}
+	clashAPI := experimental["clash_api"].(map[string]interface{})
+	for _, key := range []string{"external_ui", "external_ui_download_url"} {
+		if _, ok := clashAPI[key]; ok {
+			t.Errorf("clash_api.%s kept", key)
+		}
+	}
+	if clashAPI["external_controller"] != "127.0.0.1:9090" {
+		t.Errorf("external_controller = %v, want unchanged", clashAPI["external_controller"])
+	}
+
+	ruleSets := config["route"].(map[string]interface{})["rule_set"].([]interface{})
+	if got := ruleSets[1].(map[string]interface{})["path"]; got != filepath.Join(resources, "rules", "custom.srs") {
+		t.Errorf("relative rule_set path = %v, want resolved against resources", got)
+	}
+}
+
+func TestPrepareServiceConfigRejects(t *testing.T) {
+	resources, data := serviceTestFolders(t)
+	outside := t.TempDir()
+
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{"services", map[string]interface{}{
+			"services": []interface{}{map[string]interface{}{"type": "derp"}},
+		}},
+		{"acme", map[string]interface{}{
+			"inbounds": []interface{}{map[string]interface{}{
+				"type": "trojan",
+				"tls":  map[string]interface{}{"acme": map[string]interface{}{"domain": []interface{}{"example.com"}}},
+			}},
+		}},
+		{"tor executable", map[string]interface{}{
+			"outbounds": []interface{}{map[string]interface{}{"type": "tor", "executable_path": `C:\Temp\payload.exe`}},
+		}},
+		{"tor data directory", map[string]interface{}{
+			"outbounds": []interface{}{map[string]interface{}{"type": "tor", "data_directory": `C:\Windows`}},
+		}},
+		{"certificate outside", map[string]interface{}{
+			"outbounds": []interface{}{map[string]interface{}{
+				"type": "trojan",
+				"tls":  map[string]interface{}{"certificate_path": filepath.Join(outside, "cert.pem")},
+			}},
+		}},
+		{"rule set outside", map[string]interface{}{
+			"route": map[string]interface{}{"rule_set": []interface{}{
+				map[string]interface{}{"tag": "x", "type": "local", "path": filepath.Join(outside, "x.srs")},
+			}},
+		}},
+		{"relative escape", map[string]interface{}{
+			"outbounds": []interface{}{map[string]interface{}{
+				"type": "ssh", "private_key_path": `..\..\..\secret`,
+			}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeServiceTestConfig(t, resources, "config.json", tt.config)
+			if _, err := prepareServiceConfig(resources, data, path); err == nil {
+				t.Error("config accepted, want rejected")
+			}
+		})
+	}
+}
+
+func TestPrepareServiceConfigAcceptsPathsInsideApp(t *testing.T) {
+	resources, data := serviceTestFolders(t)
+	path := writeServiceTestConfig(t, resources, "config.json", map[string]interface{}{
+		"outbounds": []interface{}{map[string]interface{}{
+			"type": "trojan",
+			"tls":  map[string]interface{}{"certificate_path": filepath.Join(resources, "cert.pem")},
+		}},
+		"route": map[string]interface{}{"rules": []interface{}{
+			map[string]interface{}{"process_path": `C:\Program Files\App\app.exe`, "outbound": "direct"},
+		}},
+	})
+
+	if _, err := prepareServiceConfig(resources, data, path); err != nil {
+		t.Errorf("prepareServiceConfig: %v", err)
+	}
+}
+
+func TestPrepareServiceConfigLocation(t *testing.T) {
+	resources, data := serviceTestFolders(t)
+	config := map[string]interface{}{"log": map[string]interface{}{"level": "info"}}
+
+	outside := writeServiceTestConfig(t, t.TempDir(), "config.json", config)
+	if _, err := prepareServiceConfig(resources, data, outside); err == nil {
+		t.Error("config outside resources accepted")
+	}
+
+	notJSON := writeServiceTestConfig(t, resources, "config.txt", config)
+	if _, err := prepareServiceConfig(resources, data, notJSON); err == nil {
+		t.Error("non-.json config accepted")
+	}
+
+	if _, err := prepareServiceConfig(resources, data, filepath.Join(resources, "missing.json")); err == nil {
+		t.Error("missing config accepted")
+	}
+}
+
+func TestPathInside(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{root, true},
+		{filepath.Join(root, "a", "b.json"), true},
+		{filepath.Join(root, "..", "other"), false},
+		{root + "-sibling", false},
+		{filepath.Dir(root), false},
+	}
+
+	for _, tt := range tests {
+		if got := pathInside(root, filepath.Clean(tt.path)); got != tt.want {
+			t.Errorf("pathInside(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestServiceResourcesArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{ServiceFlag, ServiceResourcesFlag, `C:\KampusVPN\resources`}, filepath.Clean(`C:\KampusVPN\resources`)},
+		{[]string{ServiceFlag}, ""},
+		{[]string{ServiceFlag, ServiceResourcesFlag}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := serviceResourcesArg(tt.args); got != tt.want {
+			t.Errorf("serviceResourcesArg(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestServiceInstallCommandLine(t *testing.T) {
+	line := serviceInstallCommandLine(`C:\Program Files\KampusVPN Service`,
+		`C:\Users\u\KampusVPN\kampusvpn.exe`, `C:\Users\u\KampusVPN\bin\sing-box.exe`, `C:\Users\u\KampusVPN\resources`)
+
+	for _, want := range []string{
+		`copy /Y "C:\Users\u\KampusVPN\bin\sing-box.exe"`,
+		`/inheritance:r`,
+		`binPath= "\"C:\Program Files\KampusVPN Service\kampusvpn.exe\" --service --resources \"C:\Users\u\KampusVPN\resources\""`,
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("command line lacks %q:\n%s", want, line)
+		}
+	}
+	// The service must never run the binaries of the user-writable app folder
+	if strings.Contains(line, `binPath= "\"C:\Users`) {
+		t.Errorf("service registered from the app folder:\n%s", line)
+	}
+	if strings.Index(line, "icacls") > strings.Index(line, "sc create") {
+		t.Error("service registered before the folder is locked")
+	}
+}
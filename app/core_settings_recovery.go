@@ -0,0 +1,136 @@
+// Package main provides crash-safe writes of settings.json for KampusVPN.
+// Settings are written to a temp file and renamed over the original, and the
+// previous version is kept as settings.json.bak. A file damaged anyway (disk
+// error, manual edit) is recovered from the backup instead of being replaced
+// by defaults.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Settings file suffixes
+const (
+	SettingsBackupSuffix  = ".bak"     // Previous good version
+	SettingsCorruptSuffix = ".corrupt" // Damaged file kept for manual inspection
+)
+
+// Settings recovery sources
+const (
+	RecoveredFromBackup   = "backup"   // Loaded from settings.json.bak
+	RecoveredWithDefaults = "defaults" // Neither file was readable
+)
+
+// SettingsRecovery describes a settings.json that couldn't be loaded on startup.
+type SettingsRecovery struct {
+	Source      string    `json:"source"`                 // RecoveredFromBackup or RecoveredWithDefaults
+	Reason      string    `json:"reason"`                 // Why settings.json was rejected
+	CorruptPath string    `json:"corrupt_path,omitempty"` // Where the damaged file was moved
+	BackupTime  time.Time `json:"backup_time,omitempty"`  // Modification time of the backup used
+	RecoveredAt time.Time `json:"recovered_at"`
+}
+
+// writeFileAtomic replaces name with data by a single rename of a temp file,
+// so name exists at any moment and holds either the old or the new data.
+// The replaced version is copied to name.bak first.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	// settings.json was loaded or written successfully before, so the backup is complete
+	previous, err := os.ReadFile(name)
+	switch {
+	case err == nil:
+		if err := replaceFile(name+SettingsBackupSuffix, previous, perm); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	return replaceFile(name, data, perm)
+}
+
+// replaceFile writes data to a temp file next to name and renames it over name
+func replaceFile(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, name)
+}
+
+// readSettingsFile reads and decodes a settings file
+func readSettingsFile(path string) (*SettingsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings SettingsFile
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// recoverSettings loads the backup after settings.json was found damaged or
+// missing. reason is empty when settings.json simply doesn't exist.
+// Returns nil settings when there is nothing to recover (first run).
+// Must be called with s.mu held.
+func (s *Storage) recoverSettings(reason string) *SettingsFile {
+	recovery := &SettingsRecovery{Reason: reason, RecoveredAt: time.Now()}
+
+	if reason != "" {
+		// Keep the damaged file for inspection; it must not become the next backup
+		corruptPath := s.settingsPath + SettingsCorruptSuffix
+		if err := os.Rename(s.settingsPath, corruptPath); err == nil {
+			recovery.CorruptPath = corruptPath
+		}
+	}
+
+	backupPath := s.settingsPath + SettingsBackupSuffix
+	if info, err := os.Stat(backupPath); err == nil {
+		if settings, err := readSettingsFile(backupPath); err == nil {
+			recovery.Source = RecoveredFromBackup
+			recovery.BackupTime = info.ModTime()
+			if recovery.Reason == "" {
+				recovery.Reason = "settings.json не найден"
+			}
+			s.recovery = recovery
+			return settings
+		} else if recovery.Reason == "" {
+			recovery.Reason = fmt.Sprintf("settings.json не найден, резервная копия повреждена: %v", err)
+		}
+	}
+
+	if recovery.Reason == "" {
+		return nil // First run
+	}
+	recovery.Source = RecoveredWithDefaults
+	s.recovery = recovery
+	return nil
+}
+
+// Recovery returns how settings were recovered on load (nil if loaded normally).
+func (s *Storage) Recovery() *SettingsRecovery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.recovery
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestFile returns the content of a file ("" if it doesn't exist)
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "settings.json")
+	backup := name + SettingsBackupSuffix
+
+	tests := []struct {
+		name       string
+		data       string
+		wantBackup string
+	}{
+		{"first write", `{"v":1}`, ""},
+		{"replace", `{"v":2}`, `{"v":1}`},
+		{"replace again", `{"v":3}`, `{"v":2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := writeFileAtomic(name, []byte(tt.data), 0600); err != nil {
+				t.Fatalf("writeFileAtomic: %v", err)
+			}
+			if got := readTestFile(t, name); got != tt.data {
+				t.Errorf("file = %q, want %q", got, tt.data)
+			}
+			if got := readTestFile(t, backup); got != tt.wantBackup {
+				t.Errorf("backup = %q, want %q", got, tt.wantBackup)
+			}
+		})
+	}
+
+	// No temp files are left next to settings.json
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("files = %v, want settings.json and its backup", names)
+	}
+}
+
+func TestLoadRecoversSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string // "" removes settings.json
+	}{
+		{"damaged file", "{broken"},
+		{"deleted file", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			storage := NewStorage(base)
+			if err := storage.Init(); err != nil {
+				t.Fatalf("Storage.Init: %v", err)
+			}
+			if err := storage.UpdateProfile(DefaultProfileID, "Backup"); err != nil {
+				t.Fatal(err)
+			}
+			// The second save moves "Backup" to settings.json.bak
+			if err := storage.UpdateProfile(DefaultProfileID, "Lost"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.settings == "" {
+				if err := os.Remove(storage.settingsPath); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := os.WriteFile(storage.settingsPath, []byte(tt.settings), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded := NewStorage(base)
+			if err := reloaded.Init(); err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			if reloaded.recovery == nil || reloaded.recovery.Source != RecoveredFromBackup {
+				t.Fatalf("recovery = %+v, want the backup", reloaded.recovery)
+			}
+			if got := mustStoredProfile(t, reloaded, DefaultProfileID).Name; got != "Backup" {
+				t.Errorf("profile name = %q, want Backup", got)
+			}
+		})
+	}
+}
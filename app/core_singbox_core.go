@@ -0,0 +1,345 @@
+// Package main provides the sing-box core info and core upgrade of KampusVPN.
+// The app runs whatever binary is in bin/, so the real version is read from
+// `sing-box version`. A newer core is downloaded from the sing-box releases
+// next to the working one (sing-box.new.exe), verified, and swapped in while
+// VPN is stopped; the previous binary stays as sing-box.old.exe for rollback.
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Core compatibility and download limits
+const (
+	// SingboxRepo is the GitHub repository of sing-box releases.
+	SingboxRepo = "SagerNet/sing-box"
+	// MinSingboxVersion is the oldest core the generated config works with
+	// (1.11 rule actions, 1.12 DNS server format).
+	MinSingboxVersion = "1.12.0"
+	// CoreVersionTimeout bounds `sing-box version`.
+	CoreVersionTimeout = 10 * time.Second
+	// MaxCoreArchiveSize rejects release archives that can't be a sing-box build.
+	MaxCoreArchiveSize = 100 * 1024 * 1024
+	// coreAssetPlatform is the release asset platform suffix of this app.
+	coreAssetPlatform = "windows-amd64"
+)
+
+// CoreInfo is the sing-box binary the app runs.
+type CoreInfo struct {
+	Path           string `json:"path"`
+	Version        string `json:"version"`               // e.g. "1.12.4"
+	Commit         string `json:"commit,omitempty"`      // Revision line of `sing-box version`
+	Environment    string `json:"environment,omitempty"` // Go version and platform
+	MinVersion     string `json:"min_version"`
+	Compatible     bool   `json:"compatible"`       // Version >= MinVersion
+	BundledVersion string `json:"bundled_version"`  // Version the app was built with
+	HasBackup      bool   `json:"has_backup"`       // sing-box.old.exe is available for rollback
+	Staged         string `json:"staged,omitempty"` // Downloaded core waiting for VPN to stop ("" if none)
+}
+
+// CoreRelease is a sing-box release asset for this platform.
+type CoreRelease struct {
+	Version     string `json:"version"`
+	AssetName   string `json:"asset_name"`
+	DownloadURL string `json:"download_url"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"` // Lowercase hex of the archive
+}
+
+// coreSidePaths returns the staged and backup binaries next to the working one
+func coreSidePaths(singboxPath string) (string, string) {
+	base := strings.TrimSuffix(singboxPath, ".exe")
+	return base + ".new.exe", base + ".old.exe"
+}
+
+// parseCoreVersion extracts the version, revision and environment from the
+// output of `sing-box version`
+func parseCoreVersion(output []byte) (version, commit, environment string) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "sing-box version "):
+			version = strings.TrimSpace(strings.TrimPrefix(line, "sing-box version "))
+		case strings.HasPrefix(line, "Revision:"):
+			commit = strings.TrimSpace(strings.TrimPrefix(line, "Revision:"))
+		case strings.HasPrefix(line, "Environment:"):
+			environment = strings.TrimSpace(strings.TrimPrefix(line, "Environment:"))
+		}
+	}
+	return version, commit, environment
+}
+
+// readCoreVersion runs `sing-box version` on a binary
+func readCoreVersion(binary string) (version, commit, environment string, err error) {
+	output, err := runHiddenCommand(CoreVersionTimeout, binary, "version")
+	if err != nil {
+		return "", "", "", fmt.Errorf("sing-box version failed: %w", err)
+	}
+	version, commit, environment = parseCoreVersion(output)
+	if version == "" {
+		return "", "", "", fmt.Errorf("unexpected sing-box version output: %s", strings.TrimSpace(string(output)))
+	}
+	return version, commit, environment, nil
+}
+
+// coreVersionAtLeast compares the release part of a core version ("1.13.0-alpha.27" -> "1.13.0")
+func coreVersionAtLeast(version, min string) bool {
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	return compareVersions(version, min) >= 0
+}
+
+// ReadCoreInfo returns the version of the sing-box binary and its compatibility.
+func ReadCoreInfo(singboxPath string) (*CoreInfo, error) {
+	if singboxPath == "" || !fileExists(singboxPath) {
+		return nil, fmt.Errorf("sing-box not found")
+	}
+	version, commit, environment, err := readCoreVersion(singboxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	staged, backup := coreSidePaths(singboxPath)
+	info := &CoreInfo{
+		Path:           singboxPath,
+		Version:        version,
+		Commit:         commit,
+		Environment:    environment,
+		MinVersion:     MinSingboxVersion,
+		Compatible:     coreVersionAtLeast(version, MinSingboxVersion),
+		BundledVersion: SingBoxVersion,
+		HasBackup:      fileExists(backup),
+	}
+	if fileExists(staged) {
+		if stagedVersion, _, _, err := readCoreVersion(staged); err == nil {
+			info.Staged = stagedVersion
+		}
+	}
+	return info, nil
+}
+
+// FetchLatestCoreRelease finds the windows-amd64 archive of the latest sing-box release.
+func FetchLatestCoreRelease() (*CoreRelease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShortHTTPTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", SingboxRepo)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", AppName+"/"+Version)
+
+	client, route := newDownloadClient(ShortHTTPTimeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sing-box releases (%s): %w", route, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned status %d (%s)", resp.StatusCode, route)
+	}
+
+	var release GitHubRelease
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4*1024*1024)).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub response: %w", err)
+	}
+
+	version := strings.TrimPrefix(release.TagName, "v")
+	assetName := fmt.Sprintf("sing-box-%s-%s.zip", version, coreAssetPlatform)
+	for _, asset := range release.Assets {
+		if asset.Name != assetName {
+			continue
+		}
+		sum := parseAssetDigest(asset.Digest)
+		if sum == "" {
+			return nil, fmt.Errorf("release %s publishes no SHA256 for %s", version, assetName)
+		}
+		return &CoreRelease{
+			Version:     version,
+			AssetName:   asset.Name,
+			DownloadURL: asset.BrowserDownloadURL,
+			Size:        asset.Size,
+			SHA256:      sum,
+		}, nil
+	}
+	return nil, fmt.Errorf("release %s has no %s asset", version, assetName)
+}
+
+// StageCore downloads the release archive, verifies its SHA256 and extracts
+// sing-box.exe next to the working binary as sing-box.new.exe. Any failure
+// removes the partial files; the working binary is never touched.
+func StageCore(release *CoreRelease, singboxPath string) (string, error) {
+	staged, _ := coreSidePaths(singboxPath)
+
+	archive, err := downloadCoreArchive(release)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive)
+
+	// Keeps the .exe extension so the binary can be run for the version check
+	partial := strings.TrimSuffix(staged, ".exe") + ".part.exe"
+	if err := extractCoreBinary(archive, partial); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+
+	// The extracted binary must run on this system
+	version, _, _, err := readCoreVersion(partial)
+	if err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("extracted sing-box doesn't run: %w", err)
+	}
+	if !coreVersionAtLeast(version, MinSingboxVersion) {
+		os.Remove(partial)
+		return "", fmt.Errorf("sing-box %s is older than the required %s", version, MinSingboxVersion)
+	}
+
+	os.Remove(staged)
+	if err := os.Rename(partial, staged); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return version, nil
+}
+
+// downloadCoreArchive downloads the release archive to a temp file and checks its SHA256
+func downloadCoreArchive(release *CoreRelease) (string, error) {
+	if release.Size > MaxCoreArchiveSize {
+		return "", fmt.Errorf("archive too large (%d MB)", release.Size/1024/1024)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), LongHTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, release.DownloadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", AppName+"/"+Version)
+
+	client, route := newDownloadClient(LongHTTPTimeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed (%s): %w", route, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download returned status %d (%s)", resp.StatusCode, route)
+	}
+
+	out, err := os.CreateTemp("", AppName+"_core-*.zip")
+	if err != nil {
+		return "", err
+	}
+	archive := out.Name()
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(resp.Body, MaxCoreArchiveSize+1))
+	out.Close()
+	if err == nil && written > MaxCoreArchiveSize {
+		err = fmt.Errorf("archive too large")
+	}
+	if err == nil {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != release.SHA256 {
+			err = fmt.Errorf("SHA256 mismatch: got %s, expected %s", actual, release.SHA256)
+		}
+	}
+	if err != nil {
+		os.Remove(archive)
+		return "", fmt.Errorf("download of %s failed: %w", release.AssetName, err)
+	}
+	return archive, nil
+}
+
+// extractCoreBinary writes sing-box.exe from the release archive to dest
+func extractCoreBinary(archive, dest string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if path.Base(file.Name) != "sing-box.exe" {
+			continue
+		}
+		if file.UncompressedSize64 > MaxCoreArchiveSize*2 {
+			return fmt.Errorf("sing-box.exe in archive too large")
+		}
+		src, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, io.LimitReader(src, MaxCoreArchiveSize*2))
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return fmt.Errorf("sing-box.exe not found in archive")
+}
+
+// SwapStagedCore replaces the working binary with the staged one, keeping the
+// working one as the backup. Must only run while sing-box is stopped.
+func SwapStagedCore(singboxPath string) error {
+	staged, backup := coreSidePaths(singboxPath)
+	if !fileExists(staged) {
+		return fmt.Errorf("no staged sing-box")
+	}
+	return swapCoreBinaries(singboxPath, staged, backup)
+}
+
+// RollbackCore restores the backup binary; the rolled back one becomes the backup.
+func RollbackCore(singboxPath string) error {
+	_, backup := coreSidePaths(singboxPath)
+	if !fileExists(backup) {
+		return fmt.Errorf("no previous sing-box to roll back to")
+	}
+	swap := backup + ".swap"
+	if err := os.Rename(backup, swap); err != nil {
+		return err
+	}
+	if err := swapCoreBinaries(singboxPath, swap, backup); err != nil {
+		os.Rename(swap, backup)
+		return err
+	}
+	return nil
+}
+
+// swapCoreBinaries moves current to backup and replacement to current,
+// restoring current if the second rename fails
+func swapCoreBinaries(current, replacement, backup string) error {
+	os.Remove(backup)
+	if err := os.Rename(current, backup); err != nil {
+		return fmt.Errorf("failed to move working sing-box aside: %w", err)
+	}
+	if err := os.Rename(replacement, current); err != nil {
+		os.Rename(backup, current)
+		return fmt.Errorf("failed to install new sing-box: %w", err)
+	}
+	return nil
+}
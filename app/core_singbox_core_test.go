@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCoreVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		version     string
+		commit      string
+		environment string
+	}{
+		{
+			name: "release",
+			output: "sing-box version 1.12.4\n\nEnvironment: go1.24.5 windows/amd64\n" +
+				"Tags: with_gvisor,with_quic,with_wireguard,with_utls,with_clash_api\n" +
+				"Revision: 1d3d7c4b6b8e2c6fc2f6a1a9b1dd0f5c8f3f6e21\nCGO: disabled\n",
+			version:     "1.12.4",
+			commit:      "1d3d7c4b6b8e2c6fc2f6a1a9b1dd0f5c8f3f6e21",
+			environment: "go1.24.5 windows/amd64",
+		},
+		{
+			name:        "prerelease with CRLF",
+			output:      "sing-box version 1.13.0-alpha.27\r\n\r\nEnvironment: go1.25.1 windows/amd64\r\nRevision: abc123\r\n",
+			version:     "1.13.0-alpha.27",
+			commit:      "abc123",
+			environment: "go1.25.1 windows/amd64",
+		},
+		{
+			name:    "version only",
+			output:  "  sing-box version 1.11.15  \n",
+			version: "1.11.15",
+		},
+		{
+			name:   "other program",
+			output: "Usage: sing-box [command]\nRevision: deadbeef\n",
+			commit: "deadbeef",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, commit, environment := parseCoreVersion([]byte(tt.output))
+			if version != tt.version || commit != tt.commit || environment != tt.environment {
+				t.Errorf("parseCoreVersion = %q, %q, %q, want %q, %q, %q",
+					version, commit, environment, tt.version, tt.commit, tt.environment)
+			}
+		})
+	}
+}
+
+func TestCoreVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		min     string
+		want    bool
+	}{
+		{"1.12.0", "1.12.0", true},
+		{"1.12.4", "1.12.0", true},
+		{"1.13.0-alpha.27", "1.12.0", true},
+		{"1.12.0-beta.1", "1.12.0", true},
+		{"1.11.15", "1.12.0", false},
+		{"1.9.7", "1.12.0", false},
+		{"2.0.0+build.5", "1.12.0", true},
+		{"1.12", "1.12.0", true},
+	}
+
+	for _, tt := range tests {
+		if got := coreVersionAtLeast(tt.version, tt.min); got != tt.want {
+			t.Errorf("coreVersionAtLeast(%q, %q) = %v, want %v", tt.version, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestCoreSidePaths(t *testing.T) {
+	staged, backup := coreSidePaths(`C:\KampusVPN\bin\sing-box.exe`)
+	if staged != `C:\KampusVPN\bin\sing-box.new.exe` || backup != `C:\KampusVPN\bin\sing-box.old.exe` {
+		t.Errorf("coreSidePaths = %s, %s", staged, backup)
+	}
+}
+
+// writeTestZip writes a zip archive with the given files to path
+func writeTestZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	archive := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractCoreBinary(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "sing-box.new.exe")
+
+	archive := filepath.Join(dir, "release.zip")
+	writeTestZip(t, archive, map[string]string{
+		"sing-box-1.12.4-windows-amd64/LICENSE":      "license",
+		"sing-box-1.12.4-windows-amd64/sing-box.exe": "binary",
+	})
+	if err := extractCoreBinary(archive, dest); err != nil {
+		t.Fatalf("extractCoreBinary: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "binary" {
+		t.Errorf("extracted %q, want the binary", data)
+	}
+
+	withoutBinary := filepath.Join(dir, "other.zip")
+	writeTestZip(t, withoutBinary, map[string]string{"README.md": "readme"})
+	if err := extractCoreBinary(withoutBinary, filepath.Join(dir, "missing.exe")); err == nil {
+		t.Error("archive without sing-box.exe accepted")
+	}
+
+	notZip := filepath.Join(dir, "broken.zip")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractCoreBinary(notZip, filepath.Join(dir, "broken.exe")); err == nil {
+		t.Error("broken archive accepted")
+	}
+}
+
+func TestSwapAndRollbackCore(t *testing.T) {
+	dir := t.TempDir()
+	singbox := filepath.Join(dir, "sing-box.exe")
+	staged, backup := coreSidePaths(singbox)
+	readCore := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := os.WriteFile(singbox, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SwapStagedCore(singbox); err == nil {
+		t.Fatal("swap without a staged core succeeded")
+	}
+	if err := RollbackCore(singbox); err == nil {
+		t.Fatal("rollback without a backup succeeded")
+	}
+	if got := readCore(singbox); got != "old" {
+		t.Fatalf("working core = %q after failed swaps, want untouched", got)
+	}
+
+	if err := os.WriteFile(staged, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SwapStagedCore(singbox); err != nil {
+		t.Fatalf("SwapStagedCore: %v", err)
+	}
+	if readCore(singbox) != "new" || readCore(backup) != "old" || fileExists(staged) {
+		t.Errorf("after swap: working %q, backup %q, staged left %v", readCore(singbox), readCore(backup), fileExists(staged))
+	}
+
+	if err := RollbackCore(singbox); err != nil {
+		t.Fatalf("RollbackCore: %v", err)
+	}
+	if readCore(singbox) != "old" || readCore(backup) != "new" {
+		t.Errorf("after rollback: working %q, backup %q", readCore(singbox), readCore(backup))
+	}
+}
@@ -0,0 +1,298 @@
+// Package main provides the proxy throughput test of KampusVPN.
+// auto-select only looks at latency, so a server that answers pings quickly
+// but has collapsed throughput stays selected. The speed test downloads a test
+// file through a dedicated local inbound routed to the "proxy" selector; the
+// optional monitor repeats it for the current server and moves the selector to
+// the next best server after two slow results in a row.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpeedTestSettings configures the speed test (everything off by default)
+type SpeedTestSettings struct {
+	Enabled     bool    `json:"enabled"`       // Speed test inbound and RunSpeedTest
+	URL         string  `json:"url,omitempty"` // File downloaded by the test ("" = DefaultSpeedTestURL)
+	DurationSec int     `json:"duration_sec"`  // How long one test downloads
+	AutoSwitch  bool    `json:"auto_switch"`   // Background test of the current server
+	IntervalMin int     `json:"interval_min"`  // Pause between background tests
+	MinMbps     float64 `json:"min_mbps"`      // Slower results count as a failure
+}
+
+// Speed test defaults
+const (
+	DefaultSpeedTestURL         = "https://speed.cloudflare.com/__down?bytes=200000000"
+	DefaultSpeedTestDurationSec = 10
+	DefaultSpeedTestIntervalMin = 15
+	DefaultSpeedTestMinMbps     = 2.0
+	// SpeedTestSlowResults is the number of slow results in a row before switching
+	SpeedTestSlowResults = 2
+	speedTestInboundTag  = "speedtest-in"
+)
+
+// Normalized returns settings with zero values replaced by defaults
+func (s SpeedTestSettings) Normalized() SpeedTestSettings {
+	if s.URL == "" {
+		s.URL = DefaultSpeedTestURL
+	}
+	if s.DurationSec <= 0 {
+		s.DurationSec = DefaultSpeedTestDurationSec
+	}
+	if s.IntervalMin <= 0 {
+		s.IntervalMin = DefaultSpeedTestIntervalMin
+	}
+	if s.MinMbps <= 0 {
+		s.MinMbps = DefaultSpeedTestMinMbps
+	}
+	return s
+}
+
+// SpeedTestResult is the outcome of one test
+type SpeedTestResult struct {
+	Proxy       string    `json:"proxy"`
+	Bytes       int64     `json:"bytes"`
+	DurationSec float64   `json:"duration_sec"`
+	Mbps        float64   `json:"mbps"`
+	TestedAt    time.Time `json:"tested_at"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// measureThroughput downloads testURL through the local inbound for duration
+// and returns the bytes received and the time spent
+func measureThroughput(port int, testURL string, duration time.Duration) (int64, time.Duration, error) {
+	proxyURL := &url.URL{Scheme: "http", Host: net.JoinHostPort(proxyInboundListen, strconv.Itoa(port))}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testURL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, time.Since(started), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Since(started), fmt.Errorf("test URL returned status %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	elapsed := time.Since(started)
+	// Hitting the deadline is the normal end of the test
+	if err != nil && ctx.Err() == nil {
+		return n, elapsed, err
+	}
+	return n, elapsed, nil
+}
+
+// RunProxySpeedTest pins the selector to name (current server if ""), measures
+// throughput and restores the previous selection
+func RunProxySpeedTest(port int, name string, settings SpeedTestSettings) SpeedTestResult {
+	settings = settings.Normalized()
+	result := SpeedTestResult{Proxy: name, TestedAt: time.Now()}
+	client := &http.Client{Timeout: 3 * time.Second}
+
+	_, previous, err := clashGroupMembers(client, ConnectMeasureSelector)
+	if err != nil {
+		result.Error = fmt.Sprintf("Clash API unavailable: %v", err)
+		return result
+	}
+	if name == "" {
+		result.Proxy = currentProxy(client, previous)
+	} else if name != previous {
+		if err := clashSelectProxy(client, ConnectMeasureSelector, name); err != nil {
+			result.Error = fmt.Sprintf("select failed: %v", err)
+			return result
+		}
+		defer clashSelectProxy(client, ConnectMeasureSelector, previous)
+	}
+
+	n, elapsed, err := measureThroughput(port, settings.URL, time.Duration(settings.DurationSec)*time.Second)
+	result.Bytes = n
+	result.DurationSec = elapsed.Seconds()
+	if elapsed > 0 {
+		result.Mbps = float64(n) * 8 / elapsed.Seconds() / 1e6
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// currentProxy resolves a selection to the server in use (the urltest choice for auto-select)
+func currentProxy(client *http.Client, selected string) string {
+	if selected != ConnectMeasureGroup {
+		return selected
+	}
+	if _, now, err := clashGroupMembers(client, ConnectMeasureGroup); err == nil && now != "" {
+		return now
+	}
+	return selected
+}
+
+// nextBestProxy returns the member of auto-select with the lowest last delay, except exclude
+func nextBestProxy(client *http.Client, exclude string) (string, error) {
+	members, _, err := clashGroupMembers(client, ConnectMeasureGroup)
+	if err != nil {
+		return "", err
+	}
+	known, err := clashProxyHistories(client)
+	if err != nil {
+		return "", err
+	}
+	candidates := []string{}
+	for _, name := range members {
+		if name != exclude && known[name].Status == DelayStatusOK {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no other working server")
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return known[candidates[i]].Delay < known[candidates[j]].Delay })
+	return candidates[0], nil
+}
+
+// --- Monitor ---
+
+// SpeedSwitch describes a switch away from a slow server
+type SpeedSwitch struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Results []SpeedTestResult `json:"results"` // The slow results that caused it
+}
+
+// SpeedMonitor tests the current server periodically and switches after slow results
+type SpeedMonitor struct {
+	settings SpeedTestSettings
+	port     int
+	log      func(string)
+	onResult func(SpeedTestResult)
+	onSwitch func(SpeedSwitch)
+	testMu   *sync.Mutex // Shared with manual tests, one download at a time
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewSpeedMonitor creates a monitor; testMu serializes it with manual tests
+func NewSpeedMonitor(settings SpeedTestSettings, port int, testMu *sync.Mutex, log func(string)) *SpeedMonitor {
+	return &SpeedMonitor{
+		settings: settings.Normalized(),
+		port:     port,
+		log:      func(msg string) { log("[SpeedTest] " + msg) },
+		onResult: func(SpeedTestResult) {},
+		onSwitch: func(SpeedSwitch) {},
+		testMu:   testMu,
+	}
+}
+
+// SetCallbacks sets the result and switch callbacks
+func (m *SpeedMonitor) SetCallbacks(onResult func(SpeedTestResult), onSwitch func(SpeedSwitch)) {
+	m.onResult = onResult
+	m.onSwitch = onSwitch
+}
+
+// Start starts the background loop
+func (m *SpeedMonitor) Start() {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.stop = make(chan struct{})
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.loop()
+	m.log(fmt.Sprintf("Started (every %d min, below %.1f Mbps counts as slow)", m.settings.IntervalMin, m.settings.MinMbps))
+}
+
+// Stop stops the loop and waits for a running test to finish
+func (m *SpeedMonitor) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	close(m.stop)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	m.log("Stopped")
+}
+
+// loop tests the current server every interval
+func (m *SpeedMonitor) loop() {
+	defer m.wg.Done()
+
+	interval := time.Duration(m.settings.IntervalMin) * time.Minute
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var slow []SpeedTestResult
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+
+		m.testMu.Lock()
+		result := RunProxySpeedTest(m.port, "", m.settings)
+		m.testMu.Unlock()
+		m.onResult(result)
+
+		// A failed download says nothing about throughput (e.g. the test URL is down)
+		if result.Error != "" && result.Bytes == 0 {
+			m.log(fmt.Sprintf("%s: %s", result.Proxy, result.Error))
+			continue
+		}
+		m.log(fmt.Sprintf("%s: %.1f Mbps", result.Proxy, result.Mbps))
+
+		if result.Mbps >= m.settings.MinMbps || (len(slow) > 0 && slow[0].Proxy != result.Proxy) {
+			slow = nil
+		}
+		if result.Mbps >= m.settings.MinMbps {
+			continue
+		}
+		slow = append(slow, result)
+		if len(slow) < SpeedTestSlowResults {
+			continue
+		}
+
+		client := &http.Client{Timeout: 3 * time.Second}
+		next, err := nextBestProxy(client, result.Proxy)
+		if err != nil {
+			m.log(fmt.Sprintf("%s is slow, not switched: %v", result.Proxy, err))
+			slow = nil
+			continue
+		}
+		if err := clashSelectProxy(client, ConnectMeasureSelector, next); err != nil {
+			m.log(fmt.Sprintf("Switch to %s failed: %v", next, err))
+			continue
+		}
+		m.log(fmt.Sprintf("%s is slow, switched to %s", result.Proxy, next))
+		m.onSwitch(SpeedSwitch{From: result.Proxy, To: next, Results: slow})
+		slow = nil
+	}
+}
@@ -0,0 +1,199 @@
+// Package main provides CSV export of connection history for KampusVPN.
+// Rows are streamed from the history file so large histories aren't loaded
+// into memory; numbers are raw bytes/seconds and times are ISO 8601.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Statistics export kinds
+const (
+	StatsExportSessions = "sessions" // One row per connection
+	StatsExportDaily    = "daily"    // Per-day totals per profile
+)
+
+// statsDayFormat is the day column format of the daily export
+const statsDayFormat = "2006-01-02"
+
+// sessionsCSVHeader is the header row of the sessions export
+var sessionsCSVHeader = []string{
+	"start", "end", "duration_seconds", "profile_id", "profile",
+	"disconnect_reason", "bytes_up", "bytes_down", "connect_measure",
+}
+
+// dailyCSVHeader is the header row of the daily export
+var dailyCSVHeader = []string{
+	"date", "profile_id", "profile", "sessions", "duration_seconds", "bytes_up", "bytes_down",
+}
+
+// ValidateStatsExport checks the export kind and date range (zero time = unbounded).
+func ValidateStatsExport(kind string, from, to time.Time) error {
+	if kind != StatsExportSessions && kind != StatsExportDaily {
+		return fmt.Errorf("неизвестный тип экспорта: %s", kind)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("конец периода раньше начала")
+	}
+	return nil
+}
+
+// sessionInRange reports whether a session started within [from, to]
+func sessionInRange(record SessionRecord, from, to time.Time) bool {
+	if !from.IsZero() && record.Start.Before(from) {
+		return false
+	}
+	if !to.IsZero() && record.Start.After(to) {
+		return false
+	}
+	return true
+}
+
+// forEachSession streams history records; a missing file means no history.
+// Malformed lines (e.g. cut by a crash) are skipped.
+func forEachSession(historyPath string, fn func(SessionRecord) error) error {
+	f, err := os.Open(historyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record SessionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// newStatsCSVWriter returns an RFC 4180 writer (CRLF line endings)
+func newStatsCSVWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	return writer
+}
+
+// WriteSessionsCSV writes one row per session started within the range.
+// Returns the number of data rows.
+func WriteSessionsCSV(w io.Writer, historyPath string, from, to time.Time) (int, error) {
+	writer := newStatsCSVWriter(w)
+	if err := writer.Write(sessionsCSVHeader); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err := forEachSession(historyPath, func(record SessionRecord) error {
+		if !sessionInRange(record, from, to) {
+			return nil
+		}
+		rows++
+		return writer.Write([]string{
+			record.Start.Format(time.RFC3339),
+			record.End.Format(time.RFC3339),
+			strconv.FormatInt(int64(record.End.Sub(record.Start).Seconds()), 10),
+			strconv.Itoa(record.ProfileID),
+			record.ProfileName,
+			record.Reason,
+			strconv.FormatInt(record.Uploaded, 10),
+			strconv.FormatInt(record.Downloaded, 10),
+			record.ConnectMeasure.Summary(),
+		})
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	writer.Flush()
+	return rows, writer.Error()
+}
+
+// dailyKey groups sessions of one profile on one day
+type dailyKey struct {
+	day       string
+	profileID int
+}
+
+// dailyTotals is one row of the daily export
+type dailyTotals struct {
+	profileName string
+	sessions    int
+	seconds     int64
+	uploaded    int64
+	downloaded  int64
+}
+
+// WriteDailyCSV writes per-day totals per profile; a session counts on the
+// local day it started. Returns the number of data rows.
+func WriteDailyCSV(w io.Writer, historyPath string, from, to time.Time) (int, error) {
+	totals := map[dailyKey]*dailyTotals{}
+	err := forEachSession(historyPath, func(record SessionRecord) error {
+		if !sessionInRange(record, from, to) {
+			return nil
+		}
+		key := dailyKey{day: record.Start.Local().Format(statsDayFormat), profileID: record.ProfileID}
+		entry := totals[key]
+		if entry == nil {
+			entry = &dailyTotals{}
+			totals[key] = entry
+		}
+		// The latest name wins if the profile was renamed
+		entry.profileName = record.ProfileName
+		entry.sessions++
+		entry.seconds += int64(record.End.Sub(record.Start).Seconds())
+		entry.uploaded += record.Uploaded
+		entry.downloaded += record.Downloaded
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]dailyKey, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day != keys[j].day {
+			return keys[i].day < keys[j].day
+		}
+		return keys[i].profileID < keys[j].profileID
+	})
+
+	writer := newStatsCSVWriter(w)
+	if err := writer.Write(dailyCSVHeader); err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		entry := totals[key]
+		if err := writer.Write([]string{
+			key.day,
+			strconv.Itoa(key.profileID),
+			entry.profileName,
+			strconv.Itoa(entry.sessions),
+			strconv.FormatInt(entry.seconds, 10),
+			strconv.FormatInt(entry.uploaded, 10),
+			strconv.FormatInt(entry.downloaded, 10),
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	writer.Flush()
+	return len(keys), writer.Error()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestHistory writes records as a session history file
+func writeTestHistory(t *testing.T, records ...SessionRecord) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	// A line cut by a crash is skipped
+	buf.WriteString(`{"start":"2026-`)
+	path := filepath.Join(t.TempDir(), SessionHistoryFile)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readTestCSV parses an export and checks its line endings
+func readTestCSV(t *testing.T, data string) [][]string {
+	t.Helper()
+	if !strings.HasSuffix(data, "\r\n") {
+		t.Errorf("export doesn't end with CRLF: %q", data)
+	}
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV %q: %v", data, err)
+	}
+	return rows
+}
+
+func TestWriteSessionsCSVQuoting(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	names := []string{
+		"Дом, работа",
+		`Офис "Север"`,
+		"Две\nстроки",
+		"plain",
+	}
+	var records []SessionRecord
+	for i, name := range names {
+		records = append(records, SessionRecord{
+			Start:       start.Add(time.Duration(i) * time.Hour),
+			End:         start.Add(time.Duration(i)*time.Hour + 90*time.Second),
+			ProfileID:   i + 1,
+			ProfileName: name,
+			Reason:      "user",
+			Uploaded:    1024,
+			Downloaded:  2048,
+		})
+	}
+	path := writeTestHistory(t, records...)
+
+	var out bytes.Buffer
+	n, err := WriteSessionsCSV(&out, path, time.Time{}, time.Time{})
+	if err != nil || n != len(names) {
+		t.Fatalf("WriteSessionsCSV = %d, %v", n, err)
+	}
+	// Newlines inside a field are written as CRLF like the row endings
+	for _, quoted := range []string{`"Дом, работа"`, `"Офис ""Север"""`, "\"Две\r\nстроки\""} {
+		if !strings.Contains(out.String(), quoted) {
+			t.Errorf("export lacks %s:\n%s", quoted, out.String())
+		}
+	}
+
+	rows := readTestCSV(t, out.String())
+	if !equalStringSlices(rows[0], sessionsCSVHeader) {
+		t.Errorf("header = %v", rows[0])
+	}
+	if len(rows) != len(names)+1 {
+		t.Fatalf("rows = %d, want %d", len(rows), len(names)+1)
+	}
+	for i, name := range names {
+		row := rows[i+1]
+		if row[4] != name {
+			t.Errorf("profile = %q, want %q", row[4], name)
+		}
+		if row[0] != records[i].Start.Format(time.RFC3339) || row[2] != "90" || row[6] != "1024" || row[7] != "2048" {
+			t.Errorf("row = %v", row)
+		}
+	}
+}
+
+func TestWriteStatsCSVRange(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	path := writeTestHistory(t,
+		SessionRecord{Start: day, End: day.Add(time.Minute), ProfileID: 1, ProfileName: "Work", Uploaded: 10, Downloaded: 20},
+		SessionRecord{Start: day.Add(time.Hour), End: day.Add(time.Hour + 2*time.Minute), ProfileID: 1, ProfileName: "Work, renamed", Uploaded: 1, Downloaded: 2},
+		SessionRecord{Start: day.Add(24 * time.Hour), End: day.Add(25 * time.Hour), ProfileID: 2, ProfileName: "Home", Uploaded: 5, Downloaded: 5},
+	)
+
+	tests := []struct {
+		name     string
+		path     string
+		from, to time.Time
+		sessions int
+		daily    []string // date,profile_id,sessions,duration rows
+	}{
+		{"open range", path, time.Time{}, time.Time{}, 3, []string{"2026-03-01/1/2/180", "2026-03-02/2/1/3600"}},
+		{"first day", path, day.Add(-time.Hour), day.Add(2 * time.Hour), 2, []string{"2026-03-01/1/2/180"}},
+		{"from only", path, day.Add(time.Minute), time.Time{}, 2, []string{"2026-03-01/1/1/120", "2026-03-02/2/1/3600"}},
+		{"empty range", path, day.Add(48 * time.Hour), day.Add(72 * time.Hour), 0, nil},
+		{"no history", filepath.Join(t.TempDir(), SessionHistoryFile), time.Time{}, time.Time{}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			n, err := WriteSessionsCSV(&out, tt.path, tt.from, tt.to)
+			if err != nil || n != tt.sessions {
+				t.Fatalf("WriteSessionsCSV = %d, %v, want %d", n, err, tt.sessions)
+			}
+			// An empty range still yields a valid file with the header
+			if rows := readTestCSV(t, out.String()); len(rows) != tt.sessions+1 {
+				t.Errorf("session rows = %v", rows)
+			}
+
+			out.Reset()
+			n, err = WriteDailyCSV(&out, tt.path, tt.from, tt.to)
+			if err != nil || n != len(tt.daily) {
+				t.Fatalf("WriteDailyCSV = %d, %v, want %d", n, err, len(tt.daily))
+			}
+			rows := readTestCSV(t, out.String())
+			if !equalStringSlices(rows[0], dailyCSVHeader) {
+				t.Errorf("header = %v", rows[0])
+			}
+			var got []string
+			for _, row := range rows[1:] {
+				got = append(got, strings.Join([]string{row[0], row[1], row[3], row[4]}, "/"))
+			}
+			if !equalStringSlices(got, tt.daily) {
+				t.Errorf("daily = %v, want %v", got, tt.daily)
+			}
+		})
+	}
+}
+
+func TestValidateStatsExport(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		kind     string
+		from, to time.Time
+		wantErr  bool
+	}{
+		{"sessions", StatsExportSessions, time.Time{}, time.Time{}, false},
+		{"daily range", StatsExportDaily, now.Add(-time.Hour), now, false},
+		{"single instant", StatsExportDaily, now, now, false},
+		{"unknown kind", "weekly", time.Time{}, time.Time{}, true},
+		{"reversed range", StatsExportSessions, now, now.Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		if err := ValidateStatsExport(tt.kind, tt.from, tt.to); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -3,6 +3,8 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -25,8 +27,74 @@ type ProfileData struct {
 	ProxyCount      int                   `json:"proxy_count,omitempty"`
 	WireGuardConfigs []UserWireGuardConfig `json:"wireguard_configs,omitempty"`
 	
+	// Skip TLS certificate verification for the subscription host (explicit user consent only)
+	SubscriptionInsecureSkipVerify bool `json:"subscription_insecure_skip_verify,omitempty"`
+	
+	// Extra request headers of the subscription fetch (token, "User-Agent", ...)
+	SubscriptionHeaders map[string]string `json:"subscription_headers,omitempty"`
+	
+	// Proxies temporarily excluded from auto-select by the prober (tag -> expiry)
+	AvoidedProxies map[string]time.Time `json:"avoided_proxies,omitempty"`
+	
 	// Generated sing-box config (was config.json)
-	SingboxConfig map[string]interface{} `json:"singbox_config,omitempty"`
+	SingboxConfig SingboxConfigMap `json:"singbox_config,omitempty"`
+	
+	// Stamp of the builder that generated SingboxConfig
+	BuildInfo *ConfigBuildInfo `json:"build_info,omitempty"`
+	
+	// Warnings of the last config build (replaced by each rebuild)
+	BuildWarnings []BuildWarning `json:"build_warnings,omitempty"`
+	
+	// Proxies excluded (or force-included) by the transport filter on the last build
+	FilteredProxies []FilteredProxy `json:"filtered_proxies,omitempty"`
+	
+	// Don't route proxy servers overlapping WireGuard networks direct automatically
+	DisableOverlapException bool `json:"disable_overlap_exception,omitempty"`
+	
+	// Criteria that must pass before the connection is reported as established
+	Readiness *ReadinessCriteria `json:"readiness,omitempty"`
+	
+	// Measure servers right after connect and use the fastest one (adds seconds to connect)
+	MeasureOnConnect bool `json:"measure_on_connect,omitempty"`
+	
+	// Proxy chosen in the "proxy" selector; the default after sing-box restarts ("" = auto-select)
+	SelectedProxy string `json:"selected_proxy,omitempty"`
+	
+	// Subscriptions merged into the config (the first one mirrors SubscriptionURL)
+	Subscriptions []SubscriptionEntry `json:"subscriptions,omitempty"`
+	
+	// Write every subscription proxy to the config, ignoring MaxProxiesPerProfile
+	KeepAllProxies bool `json:"keep_all_proxies,omitempty"`
+	
+	// Resolve proxy hostnames through a trusted DoH resolver at build time and
+	// connect by IP; PinnedEndpoints keeps the last IPs as a fallback
+	PinEndpoints    bool                `json:"pin_endpoints,omitempty"`
+	PinnedEndpoints map[string][]string `json:"pinned_endpoints,omitempty"`
+	
+	// Proxies (name or tag) always kept when the subscription exceeds the cap
+	PinnedProxies []string `json:"pinned_proxies,omitempty"`
+	
+	// Last UDP relay probe result by proxy tag
+	UDPCapabilities map[string]UDPCapability `json:"udp_capabilities,omitempty"`
+	
+	// Proxies (by tag) pinned to the top of the selector or hidden from the config
+	NodePreferences *NodePreferences `json:"node_preferences,omitempty"`
+	
+	// Applications always routed direct, through the proxy or blocked, whatever the routing mode
+	AppRules []AppRule `json:"app_rules,omitempty"`
+	
+	// Domains always routed through the proxy, direct or blocked, whatever the routing mode
+	CustomRules *CustomDomainRules `json:"custom_rules,omitempty"`
+	
+	// How traffic of this profile is routed: blocked_only, except_russia, all_traffic, custom
+	RoutingMode RoutingMode `json:"routing_mode,omitempty"`
+	
+	// The user's route rules used in the custom routing mode
+	CustomRouting *CustomRouting `json:"custom_routing,omitempty"`
+	
+	// Subscription proxies of the last build and what changed against the build before
+	ProxySnapshot        []ProxySnapshotEntry `json:"proxy_snapshot,omitempty"`
+	LastSubscriptionDiff *SubscriptionDiff    `json:"last_subscription_diff,omitempty"`
 }
 
 // GlobalAppSettings contains global application settings (stored in settings.json).
@@ -39,13 +107,14 @@ type GlobalAppSettings struct {
 	// Logging settings
 	EnableLogging bool     `json:"enable_logging"`
 	LogLevel      LogLevel `json:"log_level"`
+	LogMaxSizeMB  int      `json:"log_max_size_mb,omitempty"` // Log file size before rotation (0 = MaxLogSize)
 	
 	// Appearance
 	Theme    Theme    `json:"theme"`
 	Language Language `json:"language"`
 	
 	// Routing settings
-	RoutingMode RoutingMode `json:"routing_mode"` // How traffic is routed: blocked_only, except_russia, all_traffic
+	RoutingMode RoutingMode `json:"routing_mode"` // Routing mode of new profiles (each profile has its own)
 	
 	// Subscription settings
 	AutoUpdateSub     bool      `json:"auto_update_sub"`
@@ -60,6 +129,107 @@ type GlobalAppSettings struct {
 	
 	// WireGuard settings
 	WireGuardVersion string `json:"wireguard_version"` // Native WireGuard version (e.g., "0.5.3")
+	
+	// Connection quality probing (jitter/failure rate, avoidance list)
+	AdvancedProbing AdvancedProbingSettings `json:"advanced_probing"`
+	
+	// Multiplex for proxies whose links don't set it
+	Multiplex MultiplexSettings `json:"multiplex"`
+	
+	// Throughput test and switching away from slow servers
+	SpeedTest SpeedTestSettings `json:"speed_test"`
+	
+	// Filter and update downloads never use the running VPN
+	DownloadsDirect bool `json:"downloads_direct,omitempty"`
+	
+	// User-set filter update URLs (file name -> URL), defaults in FilterURLs
+	FilterSources map[string]string `json:"filter_sources,omitempty"`
+	
+	// Proxy link for fetching subscriptions whose server is blocked ("" = none)
+	BootstrapProxy SecretString `json:"bootstrap_proxy,omitempty"`
+	
+	// sing-box memory guard: restart when working set exceeds limit (0 = off)
+	MaxSingboxMemoryMB  int `json:"max_singbox_memory_mb,omitempty"`
+	SoftSingboxMemoryMB int `json:"soft_singbox_memory_mb,omitempty"` // Warning only (0 = off)
+	
+	// How long PauseVPN routes everything direct, minutes (0 = DefaultPauseMinutes)
+	PauseTimeoutMinutes int `json:"pause_timeout_minutes,omitempty"`
+	
+	// UDP relay probe of all proxies after connect, and keeping proxies
+	// without UDP out of auto-select at build time
+	DisableUDPProbe    bool `json:"disable_udp_probe,omitempty"`
+	ExcludeNonUDPNodes bool `json:"exclude_non_udp_nodes,omitempty"`
+	
+	// Path MTU probe of native WireGuard tunnels after start
+	DisableMTUProbe bool `json:"disable_mtu_probe,omitempty"`
+	
+	// Local REST API for integrations (Stream Deck, scripts), off by default
+	LocalAPIEnabled bool   `json:"local_api_enabled,omitempty"`
+	LocalAPIPort    int    `json:"local_api_port,omitempty"`
+	LocalAPIToken   string `json:"local_api_token,omitempty"`
+	
+	// Scheduled profile switching (e.g. work profile on weekdays 09:00-18:00)
+	ProfileSchedule *ProfileSchedule `json:"profile_schedule,omitempty"`
+	
+	// Scheduled connect/disconnect (e.g. connect at 09:00 and disconnect at 19:00 on weekdays)
+	VPNTimers []VPNTimer `json:"vpn_timers,omitempty"`
+	
+	// Keep proxies with transports unsupported by the bundled core (sing-box may refuse the config)
+	AllowUnsupportedTransports bool `json:"allow_unsupported_transports,omitempty"`
+	
+	// Final DNS resolver override: preset ID or custom IP/DoH URL ("" = template default)
+	PreferredDNS string `json:"preferred_dns,omitempty"`
+	
+	// Domains always routed through the proxy (e.g. found blocked by the ISP)
+	AlwaysProxyDomains []string `json:"always_proxy_domains,omitempty"`
+	
+	// Start without the window (tray only) to save memory; applies on next launch
+	TrayOnly bool `json:"tray_only,omitempty"`
+	
+	// Autostart entry starts the app in the tray (MinimizedFlag)
+	StartMinimized bool `json:"start_minimized,omitempty"`
+	
+	// Connect VPN once the app has started and the network is up
+	ConnectOnLaunch bool `json:"connect_on_launch,omitempty"`
+	
+	// Keep runtime configs of recently used profiles ready for instant switching
+	WarmStandby         bool  `json:"warm_standby,omitempty"`
+	WarmStandbyProfiles int   `json:"warm_standby_profiles,omitempty"` // 0 = DefaultWarmStandbyCount
+	ClearStandbyOnExit  bool  `json:"clear_standby_on_exit,omitempty"`
+	RecentProfileIDs    []int `json:"recent_profile_ids,omitempty"` // Most recently activated first
+	
+	// Don't bind the direct outbound to the default adapter (BindDirectToDefaultInterface off)
+	DisableDirectInterfaceBinding bool `json:"disable_direct_interface_binding,omitempty"`
+	
+	// Proxies written to a profile config at most (0 = DefaultMaxProxiesPerProfile)
+	MaxProxiesPerProfile int `json:"max_proxies_per_profile,omitempty"`
+	
+	// Block traffic outside the proxy servers when sing-box dies unexpectedly
+	KillSwitch bool `json:"kill_switch,omitempty"`
+	
+	// How apps reach sing-box: InboundModeTUN (default) or InboundModeProxy
+	InboundMode      string `json:"inbound_mode,omitempty"`
+	ProxyInboundPort int    `json:"proxy_inbound_port,omitempty"` // 0 = DefaultProxyInboundPort
+	
+	// Secret of the Clash API controller, generated once per installation
+	ClashAPISecret string `json:"clash_api_secret,omitempty"`
+	
+	// Add a urltest group per country detected from proxy names to the selector
+	GroupProxiesByRegion bool `json:"group_proxies_by_region,omitempty"`
+	
+	// Months of per-profile daily traffic history kept (0 = DefaultTrafficHistoryMonths)
+	TrafficHistoryMonths int `json:"traffic_history_months,omitempty"`
+	
+	// DoH resolver for endpoint pinning: preset ID or https URL ("" = DefaultPinningResolver)
+	PinningResolver string `json:"pinning_resolver,omitempty"`
+	
+	// Subscription response limits (0 = DefaultMaxSubscriptionMB / DefaultMaxSubscriptionProxies)
+	MaxSubscriptionMB      int `json:"max_subscription_mb,omitempty"`
+	MaxSubscriptionProxies int `json:"max_subscription_proxies,omitempty"`
+	
+	// Start sing-box again with backoff after it exits with an error
+	AutoReconnect         bool `json:"auto_reconnect,omitempty"`
+	AutoReconnectAttempts int  `json:"auto_reconnect_attempts,omitempty"` // 0 = DefaultReconnectAttempts
 }
 
 // SettingsFile represents the complete settings.json structure.
@@ -76,6 +246,38 @@ type Storage struct {
 	templatePath  string       // Path to template.json
 	data          *SettingsFile
 	mu            sync.RWMutex
+	
+	// File writer (replaceable to simulate drive failures)
+	writeFile func(name string, data []byte, perm os.FileMode) error
+	
+	// Portable mode: settings that failed to save are kept in memory until the drive returns
+	portable   bool
+	pending    bool
+	pendingErr error
+	
+	// Warm standby configs by profile ID
+	standby map[int]StandbyConfig
+	
+	// Adapter the direct outbound is bound to at runtime ("" = sing-box auto-detect)
+	directInterface string
+	
+	// Clash API controller address of runtime configs ("" = ClashAPIHost:ClashAPIPort)
+	clashController string
+	
+	// Port of the speed test inbound of runtime configs (0 = no inbound)
+	speedTestPort int
+	
+	// Port of the download inbound of runtime configs (0 = no inbound)
+	downloadPort int
+	
+	// Port of the UDP probe inbound of runtime configs (0 = no inbound)
+	udpProbePort int
+	
+	// How settings.json was recovered on load (nil if it loaded normally)
+	recovery *SettingsRecovery
+	
+	// DPAPI blobs of the profile secrets in settings.json
+	secrets profileSecrets
 }
 
 const (
@@ -92,6 +294,7 @@ func NewStorage(basePath string) *Storage {
 		resourcesPath: resourcesPath,
 		settingsPath:  filepath.Join(resourcesPath, SettingsFileName),
 		templatePath:  filepath.Join(resourcesPath, TemplateFileName),
+		writeFile:     writeFileAtomic,
 	}
 	
 	return s
@@ -120,32 +323,57 @@ func (s *Storage) Load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	
+	var settings *SettingsFile
 	data, err := os.ReadFile(s.settingsPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Create default settings
-			s.data = s.createDefaultSettings()
-			return s.saveInternal()
-		}
+	switch {
+	case os.IsNotExist(err):
+		// Deleted by hand: the backup is used if there is one
+		settings = s.recoverSettings("")
+	case err != nil:
 		return fmt.Errorf("failed to read settings: %w", err)
+	default:
+		if err := json.Unmarshal(data, &settings); err != nil {
+			settings = s.recoverSettings(fmt.Sprintf("settings.json повреждён: %v", err))
+		}
 	}
 	
-	var settings SettingsFile
-	if err := json.Unmarshal(data, &settings); err != nil {
-		// Backup corrupted file and create new
-		backupPath := s.settingsPath + ".backup"
-		os.Rename(s.settingsPath, backupPath)
+	if settings == nil {
+		// Create default settings
 		s.data = s.createDefaultSettings()
+		if _, err := ensureClashAPISecret(&s.data.App); err != nil {
+			// Retried before connect; runtime configs aren't written without a secret
+			fmt.Printf("[Storage] Warning: %v\n", err)
+		}
 		return s.saveInternal()
 	}
 	
-	s.data = &settings
+	s.data = settings
+	secretErrs := map[int]map[string]string{}
+	for i := range s.data.Profiles {
+		secretErrs[s.data.Profiles[i].ID] = s.secrets.openProfile(&s.data.Profiles[i])
+	}
+	logSecretErrors(s.data, secretErrs)
+	
+	// Installations of older versions get a Clash API secret on first start
+	if _, err := ensureClashAPISecret(&s.data.App); err != nil {
+		fmt.Printf("[Storage] Warning: %v\n", err)
+	}
 	
 	// Ensure at least one profile exists
 	if len(s.data.Profiles) == 0 {
 		s.data.Profiles = []ProfileData{s.createDefaultProfile()}
 	}
 	
+	// Single subscription of older versions becomes the first list entry
+	for i := range s.data.Profiles {
+		migrateProfileSubscriptions(&s.data.Profiles[i])
+	}
+	
+	// Global routing mode of older versions becomes the mode of every profile
+	for i := range s.data.Profiles {
+		migrateProfileRoutingMode(&s.data.Profiles[i], s.data.App.RoutingMode)
+	}
+	
 	// Ensure default profile exists (ID=1, cannot be deleted)
 	hasDefaultProfile := false
 	for _, p := range s.data.Profiles {
@@ -211,11 +439,21 @@ func (s *Storage) createDefaultProfile() ProfileData {
 
 // saveInternal saves settings without locking.
 func (s *Storage) saveInternal() error {
-	data, err := json.MarshalIndent(s.data, "", "  ")
+	data, err := s.marshalSettings()
+	if err != nil {
+		return err
+	}
+	return s.writeSettings(data)
+}
+
+// marshalSettings serializes settings for settings.json, profile secrets sealed.
+// Must be called with s.mu held.
+func (s *Storage) marshalSettings() ([]byte, error) {
+	data, err := json.MarshalIndent(s.secrets.sealSettings(s.data), "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal settings: %w", err)
+		return nil, fmt.Errorf("failed to marshal settings: %w", err)
 	}
-	return os.WriteFile(s.settingsPath, data, 0644)
+	return data, nil
 }
 
 // Save saves settings to file.
@@ -281,6 +519,7 @@ func (s *Storage) SetActiveProfileID(id int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.data.App.ActiveProfileID = id
+	s.recordRecentProfile(id)
 	return s.saveInternal()
 }
 
@@ -333,9 +572,10 @@ func (s *Storage) CreateProfile(name string) (*ProfileData, error) {
 	}
 	
 	profile := ProfileData{
-		ID:        maxID + 1,
-		Name:      name,
-		CreatedAt: time.Now(),
+		ID:          maxID + 1,
+		Name:        name,
+		CreatedAt:   time.Now(),
+		RoutingMode: s.data.App.RoutingMode,
 	}
 	
 	s.data.Profiles = append(s.data.Profiles, profile)
@@ -378,6 +618,10 @@ func (s *Storage) DeleteProfile(id int) error {
 				s.data.App.ActiveProfileID = DefaultProfileID
 			}
 			
+			// Drop its standby config
+			delete(s.standby, id)
+			os.Remove(s.standbyPath(id))
+			
 			return s.saveInternal()
 		}
 	}
@@ -437,7 +681,7 @@ func (s *Storage) UpdateProfileSubscription(id int, subscriptionURL string, prox
 	
 	for i := range s.data.Profiles {
 		if s.data.Profiles[i].ID == id {
-			s.data.Profiles[i].SubscriptionURL = subscriptionURL
+			setPrimarySubscription(&s.data.Profiles[i], subscriptionURL)
 			s.data.Profiles[i].ProxyCount = proxyCount
 			s.data.Profiles[i].WireGuardConfigs = wireGuardConfigs
 			s.data.Profiles[i].LastUpdated = time.Now().Format("2006-01-02 15:04:05")
@@ -461,16 +705,153 @@ func (s *Storage) UpdateProfileWireGuard(id int, wireGuardConfigs []UserWireGuar
 	return fmt.Errorf("profile with ID %d not found", id)
 }
 
+// SetProfileAvoidedProxies replaces the list of proxies excluded from auto-select.
+func (s *Storage) SetProfileAvoidedProxies(id int, avoided map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			if len(avoided) == 0 {
+				s.data.Profiles[i].AvoidedProxies = nil
+			} else {
+				s.data.Profiles[i].AvoidedProxies = avoided
+			}
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
 // --- Sing-box Config ---
 
 // UpdateProfileConfig updates the generated sing-box config for a profile.
 func (s *Storage) UpdateProfileConfig(id int, config map[string]interface{}) error {
+	return s.setProfileConfig(id, config, true)
+}
+
+// PatchProfileConfig stores an edited copy of the profile config and keeps its
+// build stamp: the config was patched, not rebuilt by this builder.
+func (s *Storage) PatchProfileConfig(id int, config map[string]interface{}) error {
+	return s.setProfileConfig(id, config, false)
+}
+
+// setProfileConfig stores the config of a profile, stamping it if restamp is set
+func (s *Storage) setProfileConfig(id int, config map[string]interface{}, restamp bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	
+	// Stored configs don't depend on where the app folder is
+	mapConfigPaths(config, s.configFolders().relocatable)
+	
 	for i := range s.data.Profiles {
 		if s.data.Profiles[i].ID == id {
 			s.data.Profiles[i].SingboxConfig = config
+			if restamp {
+				s.data.Profiles[i].BuildInfo = NewConfigBuildInfo()
+				s.data.Profiles[i].BuildInfo.RoutingMode = s.data.Profiles[i].EffectiveRoutingMode()
+			}
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// MigrateProfileConfig upgrades the stored config of a profile built by an older
+// builder schema and re-stamps it. Returns nil report if no migration was needed.
+func (s *Storage) MigrateProfileConfig(id int) (*ConfigMigrationReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			profile := &s.data.Profiles[i]
+			if len(profile.SingboxConfig) == 0 || !NeedsConfigMigration(profile.BuildInfo) {
+				return nil, nil
+			}
+			
+			migrated, report := MigrateConfig(profile.SingboxConfig, configRevision(profile.BuildInfo), profile.WireGuardConfigs)
+			var builtWith RoutingMode
+			if profile.BuildInfo != nil {
+				builtWith = profile.BuildInfo.RoutingMode
+			}
+			profile.SingboxConfig = migrated
+			profile.BuildInfo = NewConfigBuildInfo()
+			profile.BuildInfo.RoutingMode = builtWith
+			return report, s.saveInternal()
+		}
+	}
+	return nil, fmt.Errorf("profile with ID %d not found", id)
+}
+
+// SetProfileBuildWarnings replaces warnings and the transport filter report of the last config build.
+func (s *Storage) SetProfileBuildWarnings(id int, warnings []BuildWarning, filtered []FilteredProxy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].BuildWarnings = warnings
+			s.data.Profiles[i].FilteredProxies = filtered
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// SetProfileReadiness replaces readiness criteria of a profile (nil clears them).
+func (s *Storage) SetProfileReadiness(id int, criteria *ReadinessCriteria) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].Readiness = criteria
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// SetProfileMeasureOnConnect enables or disables the server measurement on connect.
+func (s *Storage) SetProfileMeasureOnConnect(id int, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].MeasureOnConnect = enabled
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// SetProfileProxyLimit sets whether the proxy cap is ignored for a profile
+// and which proxies are kept first when it applies.
+func (s *Storage) SetProfileProxyLimit(id int, keepAll bool, pinned []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].KeepAllProxies = keepAll
+			s.data.Profiles[i].PinnedProxies = pinned
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// SetProfileOverlapException enables or disables the automatic direct route
+// for proxy servers overlapping WireGuard networks.
+func (s *Storage) SetProfileOverlapException(id int, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].DisableOverlapException = !enabled
 			return s.saveInternal()
 		}
 	}
@@ -500,35 +881,16 @@ func (s *Storage) WriteActiveConfigToFile() (string, error) {
 	
 	for i := range s.data.Profiles {
 		if s.data.Profiles[i].ID == activeID {
-			config := s.data.Profiles[i].SingboxConfig
-			if config == nil || len(config) == 0 {
-				return "", fmt.Errorf("no config for profile %d", activeID)
-			}
-			
-			// WireGuard is now managed by Native WireGuard Manager
-			// Remove old WireGuard outbounds from config if present
-			s.removeWireGuardFromConfig(config)
-			
-			// Clean up deprecated/problematic fields
-			// Remove endpoints (WireGuard is managed separately)
-			delete(config, "endpoints")
-			
-			// Remove log output to make sing-box write to stdout
-			if logSection, ok := config["log"].(map[string]interface{}); ok {
-				delete(logSection, "output")
+			data, err := s.renderRuntimeConfig(&s.data.Profiles[i])
+			if err != nil {
+				return "", err
 			}
 			
 			// Write to temp config file
 			configPath := filepath.Join(s.resourcesPath, "active_config.json")
-			data, err := json.MarshalIndent(config, "", "  ")
-			if err != nil {
-				return "", fmt.Errorf("failed to marshal config: %w", err)
+			if err := writeFileIfChanged(configPath, data); err != nil {
+				return "", err
 			}
-			
-			if err := os.WriteFile(configPath, data, 0644); err != nil {
-				return "", fmt.Errorf("failed to write config: %w", err)
-			}
-			
 			return configPath, nil
 		}
 	}
@@ -536,6 +898,126 @@ func (s *Storage) WriteActiveConfigToFile() (string, error) {
 	return "", fmt.Errorf("active profile %d not found", activeID)
 }
 
+// renderRuntimeConfig returns the config file contents sing-box runs with for profile.
+// Must be called with s.mu held.
+func (s *Storage) renderRuntimeConfig(profile *ProfileData) ([]byte, error) {
+	stored := profile.SingboxConfig
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("no config for profile %d", profile.ID)
+	}
+	
+	// Work on a copy: the stored config must stay exactly as the builder produced it
+	config := deepCopyJSONMap(stored)
+	
+	// Placeholders and paths of another installation to this installation's folders
+	s.ResolveConfigPaths(config)
+	
+	// WireGuard is now managed by Native WireGuard Manager
+	// Remove old WireGuard outbounds from config if present
+	s.removeWireGuardFromConfig(config)
+	
+	// Clean up deprecated/problematic fields
+	// Remove endpoints (WireGuard is managed separately)
+	delete(config, "endpoints")
+	
+	// Remove log output to make sing-box write to stdout
+	if logSection, ok := config["log"].(map[string]interface{}); ok {
+		delete(logSection, "output")
+	}
+	
+	// Bind direct traffic to the current adapter. Native WireGuard traffic also
+	// leaves through "direct" and must stay unbound to reach the tunnel adapter.
+	if len(profile.WireGuardConfigs) == 0 {
+		applyDirectInterface(config, s.directInterface)
+	}
+	
+	// Proxy picked in the UI (skipped if the subscription no longer has it)
+	if profile.SelectedProxy != "" {
+		applySelectedProxy(config, profile.SelectedProxy)
+	}
+	
+	// Servers the quality prober keeps out of auto-select until their cooldown ends
+	applyAvoidedProxies(config, profile.AvoidedProxies, time.Now())
+	
+	// TUN or local proxy only
+	applyInboundMode(config, s.data.App.EffectiveInboundMode(), s.data.App.EffectiveProxyInboundPort())
+	
+	// Controller port picked at connect and the secret of this installation.
+	// Without a secret the controller would be open to any local program.
+	if s.data.App.ClashAPISecret == "" {
+		return nil, fmt.Errorf("no Clash API secret, config not written")
+	}
+	clashController := s.clashController
+	if clashController == "" {
+		clashController = defaultClashAPIAddress()
+	}
+	applyClashController(config, clashController, s.data.App.ClashAPISecret)
+	
+	// Speed test inbound, only while the speed test is enabled
+	applyLocalProxyInbound(config, speedTestInboundTag, s.speedTestPort)
+	
+	// Inbound for filter and update downloads, unless they are forced direct
+	applyLocalProxyInbound(config, downloadInboundTag, s.downloadPort)
+	
+	// Inbound and selector of the UDP capability probe
+	applyUDPProbeInbound(config, s.udpProbePort)
+	
+	data, err := MarshalCanonicalJSONIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// SetDirectInterface sets the adapter runtime configs bind direct traffic to ("" = none).
+func (s *Storage) SetDirectInterface(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.directInterface = name
+}
+
+// writeFileIfChanged writes data unless the file already has the same content
+func writeFileIfChanged(path string, data []byte) error {
+	if existing, err := os.ReadFile(path); err == nil && sha256.Sum256(existing) == sha256.Sum256(data) {
+		return nil
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// deepCopyJSONMap returns a deep copy of a decoded JSON object
+func deepCopyJSONMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = deepCopyJSONValue(v)
+	}
+	return result
+}
+
+// deepCopyJSONValue returns a deep copy of a decoded JSON value (maps and slices are copied)
+func deepCopyJSONValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return deepCopyJSONMap(val)
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			result[i] = deepCopyJSONValue(item)
+		}
+		return result
+	case []map[string]interface{}:
+		result := make([]map[string]interface{}, len(val))
+		for i, item := range val {
+			result[i] = deepCopyJSONMap(item)
+		}
+		return result
+	default:
+		return val
+	}
+}
+
 // removeWireGuardFromConfig removes WireGuard outbounds and related DNS/route rules
 // WireGuard is now managed by Native WireGuard Manager
 func (s *Storage) removeWireGuardFromConfig(config map[string]interface{}) {
@@ -672,107 +1154,115 @@ func (s *Storage) migrateWireGuardDNS(config map[string]interface{}, wireGuardCo
 	dns["rules"] = rules
 }
 
-// migrateWireGuardRouteRules ensures route rules for WireGuard AllowedIPs exist
-// Порядок: WireGuard IP rules → ip_is_private → geosite-ru → proxy
-func (s *Storage) migrateWireGuardRouteRules(config map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
-	if len(wireGuardConfigs) == 0 {
-		return
-	}
+// --- Migration from old format ---
+
+// ConfigBuilderForStorage provides config building functionality for Storage.
+type ConfigBuilderForStorage struct {
+	storage       *Storage
+	fetcher       *SubscriptionFetcher
+	filterManager *FilterManager
+	generator     *configGenerator // Config generation steps shared with ConfigBuilder
 	
-	route, ok := config["route"].(map[string]interface{})
-	if !ok {
-		return
-	}
+	// Profiles whose newer-schema config may be downgraded by the next build (one-shot)
+	downgradeConfirmed map[int]bool
+	downgradeMu        sync.Mutex
 	
-	rules, _ := route["rules"].([]interface{})
-	if rules == nil {
-		rules = []interface{}{}
-	}
+	// Resolver for proxy/WireGuard overlap detection (cached between builds)
+	resolver *HostResolver
 	
-	// Находим позицию после hijack-dns (перед ip_is_private)
-	insertIdx := 0
-	for i, rule := range rules {
-		if ruleMap, ok := rule.(map[string]interface{}); ok {
-			action, _ := ruleMap["action"].(string)
-			if action == "hijack-dns" {
-				insertIdx = i + 1
-				break
-			}
-			if action == "sniff" {
-				insertIdx = i + 1
-			}
-		}
-	}
+	// sing-box binary for the bootstrap proxy
+	singboxPath string
+}
+
+// NewConfigBuilderForStorage creates a config builder that works with Storage.
+func NewConfigBuilderForStorage(storage *Storage) *ConfigBuilderForStorage {
+	// Filter manager path: go up from resources to parent, then bin/filters
+	basePath := filepath.Dir(storage.resourcesPath)
 	
-	// Проверяем и добавляем IP rules для каждого WireGuard
-	for _, wg := range wireGuardConfigs {
-		if len(wg.AllowedIPs) == 0 {
-			continue
-		}
-		
-		// Проверяем существует ли уже правило для этого WireGuard
-		ruleExists := false
-		for _, rule := range rules {
-			if ruleMap, ok := rule.(map[string]interface{}); ok {
-				if outbound, ok := ruleMap["outbound"].(string); ok && outbound == wg.Tag {
-					if _, hasIP := ruleMap["ip_cidr"]; hasIP {
-						ruleExists = true
-						break
-					}
-				}
-			}
-		}
-		
-		// Добавляем правило если не существует
-		if !ruleExists {
-			ipRule := map[string]interface{}{
-				"ip_cidr":  wg.AllowedIPs,
-				"outbound": wg.Tag,
-			}
-			// Вставляем в позицию insertIdx
-			newRules := make([]interface{}, 0, len(rules)+1)
-			newRules = append(newRules, rules[:insertIdx]...)
-			newRules = append(newRules, ipRule)
-			newRules = append(newRules, rules[insertIdx:]...)
-			rules = newRules
-			insertIdx++ // Сдвигаем позицию для следующего WireGuard
-		}
+	filterManager := NewFilterManager(basePath)
+	return &ConfigBuilderForStorage{
+		storage:            storage,
+		fetcher:            NewSubscriptionFetcher(),
+		filterManager:      filterManager,
+		generator:          newConfigGenerator(filterManager),
+		downgradeConfirmed: make(map[int]bool),
+		resolver:           NewHostResolver(),
 	}
-	
-	route["rules"] = rules
 }
 
-// --- Migration from old format ---
+// SetSingboxPath sets the sing-box binary used to run the bootstrap proxy.
+func (b *ConfigBuilderForStorage) SetSingboxPath(path string) {
+	b.singboxPath = path
+}
 
-// ConfigBuilderForStorage provides config building functionality for Storage.
-type ConfigBuilderForStorage struct {
-	storage       *Storage
-	fetcher       *SubscriptionFetcher
-	routingMode   RoutingMode
-	filterManager *FilterManager
+// pinEndpoints resolves proxy hostnames through the pinning resolver from settings.
+func (b *ConfigBuilderForStorage) pinEndpoints(proxies []ProxyConfig, previous map[string][]string) ([]ProxyConfig, EndpointPinResult) {
+	resolver := DefaultPinningResolver
+	if address, err := ValidatePinningResolver(b.storage.GetAppSettings().PinningResolver); err == nil && address != "" {
+		resolver = address
+	}
+	client := newPinningClient()
+	pinned, result := pinProxyEndpoints(proxies, previous, func(host string) ([]string, error) {
+		return resolveDoH(client, resolver, host)
+	})
+	fmt.Printf("[BuildConfigForProfile] Pinned %d hostnames via %s\n", len(result.Pinned), pinningResolverHost(resolver))
+	return pinned, result
 }
 
-// NewConfigBuilderForStorage creates a config builder that works with Storage.
-func NewConfigBuilderForStorage(storage *Storage) *ConfigBuilderForStorage {
-	// Filter manager path: go up from resources to parent, then bin/filters
-	basePath := filepath.Dir(storage.resourcesPath)
+// bootstrapProxy returns the bootstrap proxy from settings (nil if not set).
+func (b *ConfigBuilderForStorage) bootstrapProxy() *BootstrapProxy {
+	link := b.storage.GetAppSettings().BootstrapProxy.Value()
+	if link == "" {
+		return nil
+	}
+	return &BootstrapProxy{Link: link, SingboxPath: b.singboxPath}
+}
+
+// SetProfileSubscriptionInsecure enables or disables skipping certificate
+// verification for the profile's subscription host.
+func (s *Storage) SetProfileSubscriptionInsecure(id int, insecure bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	
-	return &ConfigBuilderForStorage{
-		storage:       storage,
-		fetcher:       NewSubscriptionFetcher(),
-		routingMode:   DefaultRoutingMode,
-		filterManager: NewFilterManager(basePath),
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].SubscriptionInsecureSkipVerify = insecure
+			return s.saveInternal()
+		}
 	}
+	return fmt.Errorf("profile with ID %d not found", id)
 }
 
-// SetRoutingMode sets the routing mode for config generation
-func (b *ConfigBuilderForStorage) SetRoutingMode(mode RoutingMode) {
-	b.routingMode = mode
+// ConfirmDowngrade allows the next build of the profile to replace a config
+// produced by a newer app version.
+func (b *ConfigBuilderForStorage) ConfirmDowngrade(profileID int) {
+	b.downgradeMu.Lock()
+	defer b.downgradeMu.Unlock()
+	b.downgradeConfirmed[profileID] = true
 }
 
-// GetRoutingMode returns current routing mode
-func (b *ConfigBuilderForStorage) GetRoutingMode() RoutingMode {
-	return b.routingMode
+// checkDowngrade returns ConfigDowngradeError if the stored config is newer than
+// this builder and the user has not confirmed the downgrade.
+func (b *ConfigBuilderForStorage) checkDowngrade(profileID int) error {
+	profile, err := b.storage.GetProfile(profileID)
+	if err != nil || !profile.BuildInfo.IsNewer() {
+		return nil
+	}
+	
+	b.downgradeMu.Lock()
+	defer b.downgradeMu.Unlock()
+	if b.downgradeConfirmed[profileID] {
+		delete(b.downgradeConfirmed, profileID)
+		fmt.Printf("[BuildConfigForProfile] Downgrading config of profile %d (schema %d -> %d) confirmed by user\n",
+			profileID, profile.BuildInfo.SchemaRevision, ConfigSchemaRevision)
+		return nil
+	}
+	
+	return &ConfigDowngradeError{
+		ProfileID:      profileID,
+		AppVersion:     profile.BuildInfo.AppVersion,
+		SchemaRevision: profile.BuildInfo.SchemaRevision,
+	}
 }
 
 // GetFilterManager returns the filter manager
@@ -782,6 +1272,11 @@ func (b *ConfigBuilderForStorage) GetFilterManager() *FilterManager {
 
 // TestSubscription tests a subscription URL and returns available proxies.
 func (b *ConfigBuilderForStorage) TestSubscription(subscriptionURL string) (*SubscriptionTestResult, error) {
+	return b.TestSubscriptionContext(context.Background(), subscriptionURL)
+}
+
+// TestSubscriptionContext is TestSubscription that stops when ctx is cancelled.
+func (b *ConfigBuilderForStorage) TestSubscriptionContext(ctx context.Context, subscriptionURL string) (*SubscriptionTestResult, error) {
 	result := &SubscriptionTestResult{
 		Success: false,
 		Proxies: []ProxyInfo{},
@@ -800,16 +1295,36 @@ func (b *ConfigBuilderForStorage) TestSubscription(subscriptionURL string) (*Sub
 		}
 		proxies = []ProxyConfig{proxy}
 	} else {
-		proxies, err = b.fetcher.FetchAndParse(subscriptionURL)
+		var opts SubscriptionRequestOptions
+		if profile, err := b.storage.GetActiveProfile(); err == nil {
+			opts.Headers = profile.SubscriptionHeaders
+		}
+		opts.Bootstrap = b.bootstrapProxy()
+		opts.Limits = b.storage.GetAppSettings().SubscriptionLimits()
+		trace := &SubscriptionFetchTrace{}
+		opts.Trace = trace
+		proxies, result.UserInfo, result.Route, err = b.fetcher.FetchWithRouteContext(ctx, subscriptionURL, opts)
+		result.Attempts = trace.Attempts
+		result.FinalURL = trace.FinalURL
+		if ctx.Err() != nil {
+			result.Error = "Проверка подписки отменена"
+			result.Cancelled = true
+			return result, nil
+		}
 		if err != nil {
 			result.Error = fmt.Sprintf("Ошибка загрузки подписки: %v", err)
+			if tlsErr, ok := asSubscriptionTLSError(err); ok {
+				result.Error = fmt.Sprintf("Ошибка загрузки подписки: %s", tlsErr.Message)
+				result.TLSError = tlsErr
+			}
 			return result, nil
 		}
 	}
 
 	// Filter unsupported transports (e.g., xhttp which is Xray-only)
-	filterResult := FilterUnsupportedTransports(proxies)
+	filterResult := FilterTransports(proxies, b.storage.GetAppSettings().AllowUnsupportedTransports)
 	proxies = filterResult.Supported
+	result.FilteredProxies = filterResult.Entries
 	
 	if len(proxies) == 0 {
 		if filterResult.AllFiltered {
@@ -829,6 +1344,9 @@ func (b *ConfigBuilderForStorage) TestSubscription(subscriptionURL string) (*Sub
 		result.Warning = filterResult.Message
 		result.FilteredCount = len(filterResult.Filtered)
 	}
+	if filterResult.Forced {
+		result.Warning = filterResult.Message
+	}
 	
 	for _, p := range proxies {
 		result.Proxies = append(result.Proxies, ProxyInfo{
@@ -844,21 +1362,37 @@ func (b *ConfigBuilderForStorage) TestSubscription(subscriptionURL string) (*Sub
 
 // BuildConfig builds sing-box config for the active profile.
 func (b *ConfigBuilderForStorage) BuildConfig(subscriptionURL string) error {
+	return b.BuildConfigContext(context.Background(), subscriptionURL)
+}
+
+// BuildConfigContext is BuildConfig whose subscription fetches stop when ctx is cancelled.
+func (b *ConfigBuilderForStorage) BuildConfigContext(ctx context.Context, subscriptionURL string) error {
 	profile, err := b.storage.GetActiveProfile()
 	if err != nil || profile == nil {
 		return fmt.Errorf("no active profile")
 	}
 	
-	return b.BuildConfigForProfile(profile.ID, subscriptionURL, profile.WireGuardConfigs)
+	return b.BuildConfigForProfileContext(ctx, profile.ID, subscriptionURL, profile.WireGuardConfigs)
 }
 
 // BuildConfigForProfile builds sing-box config for a specific profile.
 func (b *ConfigBuilderForStorage) BuildConfigForProfile(profileID int, subscriptionURL string, wireGuardConfigs []UserWireGuardConfig) error {
+	return b.BuildConfigForProfileContext(context.Background(), profileID, subscriptionURL, wireGuardConfigs)
+}
+
+// BuildConfigForProfileContext is BuildConfigForProfile whose subscription
+// fetches stop when ctx is cancelled; a cancelled build writes nothing.
+func (b *ConfigBuilderForStorage) BuildConfigForProfileContext(ctx context.Context, profileID int, subscriptionURL string, wireGuardConfigs []UserWireGuardConfig) error {
 	fmt.Printf("[BuildConfigForProfile] Called with profileID=%d, %d WireGuard configs\n", profileID, len(wireGuardConfigs))
 	for i, wg := range wireGuardConfigs {
 		fmt.Printf("[BuildConfigForProfile] WireGuard[%d]: tag=%s, dns=%s, allowedIPs=%v\n", i, wg.Tag, wg.DNS, wg.AllowedIPs)
 	}
 	
+	// Config from a newer app version is read-only until the user confirms the downgrade
+	if err := b.checkDowngrade(profileID); err != nil {
+		return err
+	}
+	
 	// Load template
 	templateData, err := os.ReadFile(b.storage.templatePath)
 	if err != nil {
@@ -870,66 +1404,200 @@ func (b *ConfigBuilderForStorage) BuildConfigForProfile(profileID int, subscript
 		return fmt.Errorf("ошибка парсинга template.json: %w", err)
 	}
 	
-	// Disable strict_route when WireGuard is used to allow system routes to work
-	fmt.Printf("[BuildConfigForProfile] Configuring TUN for WireGuard compatibility...\n")
-	b.disableStrictRouteForWireGuard(template, wireGuardConfigs)
-	
-	// Add DNS servers and rules for WireGuard networks
+	// Native WireGuard: strict_route off and DNS servers for the tunnel networks
 	// (WireGuard works natively, DNS queries go through direct and WireGuard interface handles routing)
-	fmt.Printf("[BuildConfigForProfile] Adding WireGuard DNS rules for %d configs...\n", len(wireGuardConfigs))
-	b.addWireGuardDNSNew(template, wireGuardConfigs)
-	
-	// Update route rules for WireGuard AllowedIPs
-	fmt.Printf("[BuildConfigForProfile] Adding WireGuard route rules...\n")
-	b.updateRouteRulesForWireGuardNew(template, wireGuardConfigs)
+	fmt.Printf("[BuildConfigForProfile] Configuring template for %d WireGuard configs...\n", len(wireGuardConfigs))
+	b.generator.applyWireGuard(template, wireGuardConfigs)
 	
 	// Get proxies from subscription
 	var proxies []ProxyConfig
+	warnings := []BuildWarning{}
+	var filtered []FilteredProxy
+	
+	var fetches []subscriptionFetch
+	var partialFetch bool
 	
 	if subscriptionURL != "" {
-		isDirectLink := isDirectProxyLink(subscriptionURL)
+		// Every subscription of the profile is merged; one failing doesn't abort the build
+		var entries []SubscriptionEntry
+		if profile, err := b.storage.GetProfile(profileID); err == nil {
+			migrateProfileSubscriptions(profile)
+			entries = profile.Subscriptions
+		}
 		
-		if isDirectLink {
-			proxy, err := b.fetcher.ParseSingleLink(subscriptionURL)
-			if err != nil {
-				return fmt.Errorf("ошибка парсинга ссылки: %w", err)
-			}
-			proxy.Tag = generateTag(proxy, 0)
-			proxies = []ProxyConfig{proxy}
-		} else {
-			proxies, err = b.fetcher.FetchAndParse(subscriptionURL)
-			if err != nil {
-				return fmt.Errorf("ошибка загрузки подписки: %w", err)
-			}
-			for i := range proxies {
-				proxies[i].Tag = generateTag(proxies[i], i)
+		var failed []subscriptionFetch
+		for _, url := range subscriptionURLs(subscriptionURL, entries) {
+			fetch := b.fetchSubscription(ctx, profileID, url, url == subscriptionURL)
+			if fetch.Err != nil {
+				fmt.Printf("[BuildConfigForProfile] Warning: subscription %s failed: %v\n", subscriptionHost(url), fetch.Err)
+				failed = append(failed, fetch)
 			}
+			fetches = append(fetches, fetch)
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("загрузка подписки отменена: %w", err)
+		}
+		if len(failed) == len(fetches) {
+			return failed[0].Err
+		}
+		if len(failed) > 0 {
+			warnings = append(warnings, subscriptionFailedWarning(failed))
+		}
+		partialFetch = len(failed) > 0
+		
+		var duplicates int
+		proxies, duplicates = mergeSubscriptionProxies(fetches)
+		if duplicates > 0 {
+			fmt.Printf("[BuildConfigForProfile] Dropped %d duplicate proxies across subscriptions\n", duplicates)
 		}
 
 		// Filter unsupported transports (e.g., xhttp which is Xray-only)
-		filterResult := FilterUnsupportedTransports(proxies)
+		filterResult := FilterTransports(proxies, b.storage.GetAppSettings().AllowUnsupportedTransports)
 		if filterResult.AllFiltered {
 			return fmt.Errorf("%s", filterResult.Message)
 		}
-		if len(filterResult.Filtered) > 0 {
+		if filterResult.Message != "" {
 			fmt.Printf("[BuildConfigForProfile] Warning: %s\n", filterResult.Message)
+			warnings = append(warnings, transportWarning(filterResult))
 		}
+		filtered = filterResult.Entries
 		proxies = filterResult.Supported
+		if warning, ok := proxyLinkWarning(proxies); ok {
+			warnings = append(warnings, warning)
+		}
+	}
+	
+	// Proxies avoided by the quality prober stay in the stored config; they are
+	// dropped from auto-select when the runtime config is written (applyAvoidedProxies)
+	avoided := map[string]bool{}
+	overlapExceptionEnabled := true
+	maxProxies := b.storage.GetAppSettings().MaxProxies()
+	var pinned []string
+	var nodePrefs *NodePreferences
+	var appRules []AppRule
+	var customRules *CustomDomainRules
+	var customRouting *CustomRouting
+	routingMode := DefaultRoutingMode
+	pinEndpoints := false
+	var pinnedEndpoints map[string][]string
+	if profile, err := b.storage.GetProfile(profileID); err == nil {
+		// Proxies found without UDP relay, if the user wants them out of auto-select
+		if b.storage.GetAppSettings().ExcludeNonUDPNodes {
+			for tag, capability := range profile.UDPCapabilities {
+				if capability.Status == UDPSupportNo {
+					avoided[tag] = true
+				}
+			}
+		}
+		overlapExceptionEnabled = !profile.DisableOverlapException
+		if profile.KeepAllProxies {
+			maxProxies = 0
+		}
+		pinned = profile.PinnedProxies
+		nodePrefs = profile.NodePreferences
+		appRules = profile.AppRules
+		customRules = profile.CustomRules
+		routingMode = profile.EffectiveRoutingMode()
+		customRouting = profile.CustomRouting
+		pinEndpoints = profile.PinEndpoints
+		pinnedEndpoints = profile.PinnedEndpoints
+	}
+	
+	// The whole subscription is compared with the previous build, before the cap
+	subscriptionProxies := proxies
+	
+	// Hidden proxies don't take places under the cap; with every proxy hidden
+	// the selector falls back to direct
+	var selectorPinned []string
+	if nodePrefs != nil {
+		var hidden int
+		if proxies, hidden = removeHiddenProxies(proxies, nodePrefs); hidden > 0 {
+			fmt.Printf("[BuildConfigForProfile] %d proxies hidden by user\n", hidden)
+		}
+		selectorPinned = nodePrefs.Pinned
+		pinned = append(append([]string{}, pinned...), nodePrefs.Pinned...)
+	}
+	
+	// Huge subscriptions are cut to the cap (pinned first, then one per region)
+	total := len(proxies)
+	proxies, omitted := LimitProxies(proxies, maxProxies, pinned)
+	if omitted > 0 {
+		warning := proxyLimitWarning(omitted, total, maxProxies)
+		fmt.Printf("[BuildConfigForProfile] Warning: %s\n", warning.Message)
+		warnings = append(warnings, warning)
+	}
+	
+	// Proxy hostnames resolved through DoH, re-resolved on every build
+	if pinEndpoints && len(proxies) > 0 {
+		var pinResult EndpointPinResult
+		proxies, pinResult = b.pinEndpoints(proxies, pinnedEndpoints)
+		if warning, ok := endpointPinningWarning(pinResult); ok {
+			fmt.Printf("[BuildConfigForProfile] Warning: %s\n", warning.Message)
+			warnings = append(warnings, warning)
+		}
+		if err := b.storage.setProfilePinnedEndpoints(profileID, pinResult.Pinned); err != nil {
+			return err
+		}
+	}
+	
+	// WireGuard networks inside the TUN subnet break routing
+	tun := tunSubnets(template)
+	for _, wg := range wireGuardConfigs {
+		if conflict := FindTUNConflict(wg, tun); conflict != nil {
+			fmt.Printf("[BuildConfigForProfile] Warning: %s\n", conflict.Error())
+			warnings = append(warnings, tunOverlapWarning(conflict))
+		}
+	}
+	
+	// Proxy servers reachable through a WireGuard tunnel cause routing loops
+	overlaps := DetectHostOverlaps(proxies, wireGuardConfigs, b.resolver)
+	for _, overlap := range overlaps {
+		fmt.Printf("[BuildConfigForProfile] Warning: %s\n", overlap.Message())
+		warnings = append(warnings, overlapWarning(overlap))
 	}
 	
 	// Generate outbounds
-	outbounds := b.generateOutbounds(template, proxies)
+	settings := b.storage.GetAppSettings()
+	outbounds := b.generator.generateOutbounds(template, proxies, outboundOptions{
+		Avoided:       avoided,
+		Pinned:        selectorPinned,
+		Multiplex:     settings.Multiplex,
+		GroupByRegion: settings.GroupProxiesByRegion,
+	})
 	template["outbounds"] = outbounds
 	
 	// WireGuard is now managed by Native WireGuard Manager
 	// Remove any existing WireGuard from config
 	delete(template, "endpoints")
 	
-	// Apply routing mode (blocked_only, except_russia, all_traffic)
-	b.applyRoutingMode(template)
+	// Apply routing mode (blocked_only, except_russia, all_traffic, custom);
+	// invalid custom rules fail the build before anything is written
+	if err := b.generator.applyRoutingMode(template, routingMode, appRules, customRules, customRouting); err != nil {
+		return err
+	}
+	
+	// WireGuard DNS bypass before hijack-dns, tunnel networks after it
+	b.generator.updateRouteRulesForWireGuard(template, wireGuardConfigs)
+	
+	// Domains the user always wants through the proxy
+	b.addAlwaysProxyDomains(template)
+	
+	// Overlapping proxy addresses go direct, before any WireGuard rule
+	// (inserted last so it ends up first)
+	if len(overlaps) > 0 && overlapExceptionEnabled {
+		b.addOverlapException(template, overlaps)
+	}
+	
+	// User-selected final resolver (WireGuard resolvers are never touched)
+	if err := b.applyPreferredDNS(template, wireGuardConfigs); err != nil {
+		fmt.Printf("[BuildConfigForProfile] Warning: preferred DNS not applied: %v\n", err)
+		warnings = append(warnings, NewBuildWarning(WarnPreferredDNSFailed,
+			fmt.Sprintf("Не удалось применить выбранный DNS-сервер: %v", err),
+			map[string]string{"preferred_dns": b.storage.GetAppSettings().PreferredDNS}))
+	}
 	
 	// Add experimental section
-	b.addExperimentalAPI(template)
+	b.generator.addExperimentalAPI(template)
 	
 	// Remove template fields
 	delete(template, "outbounds_template")
@@ -944,610 +1612,154 @@ func (b *ConfigBuilderForStorage) BuildConfigForProfile(profileID int, subscript
 		return err
 	}
 	
-	return nil
-}
-
-// generateOutbounds generates outbounds list.
-func (b *ConfigBuilderForStorage) generateOutbounds(template map[string]interface{}, proxies []ProxyConfig) []interface{} {
-	outbounds := []interface{}{}
-	proxyTags := []string{}
-	
-	for _, p := range proxies {
-		outbounds = append(outbounds, p.ToSingboxOutbound())
-		proxyTags = append(proxyTags, p.Tag)
-	}
-	
-	outboundsTemplate, ok := template["outbounds_template"].(map[string]interface{})
-	if !ok {
-		outboundsTemplate = map[string]interface{}{}
+	if len(fetches) > 0 {
+		if err := b.storage.recordSubscriptionFetches(profileID, fetches); err != nil {
+			return err
+		}
 	}
 	
-	if len(proxyTags) > 0 {
-		if urltest, ok := outboundsTemplate["urltest"].(map[string]interface{}); ok {
-			urltest = copyMap(urltest)
-			urltest["outbounds"] = proxyTags
-			outbounds = append(outbounds, urltest)
-		} else {
-			outbounds = append(outbounds, map[string]interface{}{
-				"type":      "urltest",
-				"tag":       "auto-select",
-				"outbounds": proxyTags,
-				"url":       "https://www.gstatic.com/generate_204",
-				"interval":  "3m",
-				"tolerance": 50,
-			})
+	// A failed subscription would look like all its servers were removed
+	if len(fetches) > 0 && !partialFetch {
+		diff, err := b.storage.RecordProxySnapshot(profileID, subscriptionProxies)
+		if err != nil {
+			return err
 		}
-		
-		selectorOutbounds := append([]string{"auto-select"}, proxyTags...)
-		selectorOutbounds = append(selectorOutbounds, "direct")
-		
-		if selector, ok := outboundsTemplate["selector"].(map[string]interface{}); ok {
-			selector = copyMap(selector)
-			selector["outbounds"] = selectorOutbounds
-			outbounds = append(outbounds, selector)
-		} else {
-			outbounds = append(outbounds, map[string]interface{}{
-				"type":      "selector",
-				"tag":       "proxy",
-				"outbounds": selectorOutbounds,
-				"default":   "auto-select",
-			})
+		if !diff.Initial && !diff.Empty() {
+			fmt.Printf("[BuildConfigForProfile] %s\n", diff.Summary())
 		}
-	} else {
-		outbounds = append(outbounds, map[string]interface{}{
-			"type":      "selector",
-			"tag":       "proxy",
-			"outbounds": []string{"direct"},
-			"default":   "direct",
-		})
 	}
 	
-	if direct, ok := outboundsTemplate["direct"].(map[string]interface{}); ok {
-		outbounds = append(outbounds, copyMap(direct))
-	} else {
-		outbounds = append(outbounds, map[string]interface{}{
-			"type": "direct",
-			"tag":  "direct",
-		})
-	}
-	
-	// block и dns-out удалены - в sing-box 1.11+ используются rule actions
-	// action: "reject" вместо outbound: "block"
-	// action: "hijack-dns" вместо outbound: "dns-out"
-	
-	return outbounds
+	return b.storage.SetProfileBuildWarnings(profileID, warnings, filtered)
 }
 
-// addWireGuardDNS adds DNS servers for WireGuard networks.
-func (b *ConfigBuilderForStorage) addWireGuardDNS(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
-	if len(wireGuardConfigs) == 0 {
-		return
-	}
-	
-	dns, ok := template["dns"].(map[string]interface{})
-	if !ok {
-		return
-	}
-	
-	servers, _ := dns["servers"].([]interface{})
-	if servers == nil {
-		servers = []interface{}{}
-	}
+// fetchSubscription fetches one subscription URL or parses a direct proxy link.
+// Certificate verification is skipped only for the primary subscription host.
+func (b *ConfigBuilderForStorage) fetchSubscription(ctx context.Context, profileID int, url string, primary bool) subscriptionFetch {
+	fetch := subscriptionFetch{URL: url}
 	
-	for _, wg := range wireGuardConfigs {
-		if wg.DNS == "" {
-			continue
-		}
-		
-		serverTag := fmt.Sprintf("%s-dns", wg.Tag)
-		// New sing-box 1.12+ DNS server format
-		server := map[string]interface{}{
-			"type":   "udp",
-			"tag":    serverTag,
-			"server": wg.DNS,
-			"detour": wg.Tag,
+	if isDirectProxyLink(url) {
+		proxy, err := b.fetcher.ParseSingleLink(url)
+		if err != nil {
+			fetch.Err = fmt.Errorf("ошибка парсинга ссылки: %w", err)
+			return fetch
 		}
-		servers = append(servers, server)
+		fetch.Proxies = []ProxyConfig{proxy}
+		return fetch
 	}
 	
-	dns["servers"] = servers
-}
-
-// disableStrictRouteForWireGuard disables strict_route in TUN when WireGuard is used.
-// This allows system routes (WireGuard interface) to work alongside sing-box TUN.
-func (b *ConfigBuilderForStorage) disableStrictRouteForWireGuard(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
-	if len(wireGuardConfigs) == 0 {
-		return
+	// Headers and TLS consent belong to the profile's own subscription only
+	var opts SubscriptionRequestOptions
+	if primary {
+		opts = b.subscriptionOptions(profileID)
 	}
-	
-	inbounds, ok := template["inbounds"].([]interface{})
-	if !ok {
-		return
+	if opts.Insecure {
+		fmt.Printf("[BuildConfigForProfile] Warning: certificate verification disabled for %s\n", subscriptionHost(url))
 	}
-	
-	for i, inbound := range inbounds {
-		if inboundMap, ok := inbound.(map[string]interface{}); ok {
-			if inboundMap["type"] == "tun" {
-				// Disable strict_route to allow WireGuard routes to work
-				inboundMap["strict_route"] = false
-				inbounds[i] = inboundMap
-				fmt.Printf("[disableStrictRouteForWireGuard] Disabled strict_route for TUN\n")
-				break
-			}
-		}
+	opts.Bootstrap = b.bootstrapProxy()
+	opts.Limits = b.storage.GetAppSettings().SubscriptionLimits()
+	var err error
+	fetch.Proxies, _, fetch.Route, err = b.fetcher.FetchWithRouteContext(ctx, url, opts)
+	if err != nil {
+		fetch.Err = fmt.Errorf("ошибка загрузки подписки: %w", err)
 	}
-	
-	template["inbounds"] = inbounds
+	return fetch
 }
 
-// addWireGuardDNSNew adds DNS servers for WireGuard networks (native WireGuard mode).
-// DNS queries go through "direct" - the WireGuard interface handles routing.
-func (b *ConfigBuilderForStorage) addWireGuardDNSNew(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
-	if len(wireGuardConfigs) == 0 {
-		return
+// addOverlapException inserts a direct route for proxy servers overlapping WireGuard
+// networks right after sniff, so it takes precedence over WireGuard CIDR rules.
+func (b *ConfigBuilderForStorage) addOverlapException(template map[string]interface{}, overlaps []HostOverlap) {
+	exception := overlapExceptionRule(overlaps)
+	if insertIdx, ok := insertRuleAfterSniff(template, exception); ok {
+		fmt.Printf("[addOverlapException] Added direct rule for %v at position %d\n", exception["ip_cidr"], insertIdx)
 	}
-	
-	dns, ok := template["dns"].(map[string]interface{})
-	if !ok {
+}
+
+// addAlwaysProxyDomains routes user-listed domains (e.g. found blocked by
+// CheckIfBlocked) through the proxy regardless of routing mode.
+func (b *ConfigBuilderForStorage) addAlwaysProxyDomains(template map[string]interface{}) {
+	domains := b.storage.GetAppSettings().AlwaysProxyDomains
+	if len(domains) == 0 {
 		return
 	}
-	
-	servers, _ := dns["servers"].([]interface{})
-	if servers == nil {
-		servers = []interface{}{}
+	rule := map[string]interface{}{
+		"domain_suffix": domains,
+		"outbound":      "proxy",
 	}
-	
-	dnsRules, _ := dns["rules"].([]interface{})
-	if dnsRules == nil {
-		dnsRules = []interface{}{}
+	if insertIdx, ok := insertRuleAfterSniff(template, rule); ok {
+		fmt.Printf("[addAlwaysProxyDomains] Added proxy rule for %v at position %d\n", domains, insertIdx)
 	}
-	
-	for _, wg := range wireGuardConfigs {
-		if wg.DNS == "" {
-			continue
-		}
-		
-		dnsTag := fmt.Sprintf("dns-%s", wg.Tag)
-		
-		// Add DNS server - no special binding needed
-		// Traffic to DNS server IP will be excluded from TUN and go through WireGuard
-		server := map[string]interface{}{
-			"type":        "udp",
-			"tag":         dnsTag,
-			"server":      wg.DNS,
-			"server_port": 53,
-		}
-		servers = append(servers, server)
-		
-		// Build domain suffixes for DNS rule
-		domainSuffixes := []string{}
-		if wg.Endpoint != "" {
-			parts := strings.Split(wg.Endpoint, ".")
-			if len(parts) >= 2 {
-				baseDomain := "." + strings.Join(parts[len(parts)-2:], ".")
-				domainSuffixes = append(domainSuffixes, baseDomain)
-			}
-		}
-		domainSuffixes = append(domainSuffixes, ".local", fmt.Sprintf(".%s.local", wg.Tag))
-		
-		// Add DNS rule at the beginning
-		dnsRule := map[string]interface{}{
-			"domain_suffix": domainSuffixes,
-			"action":        "route",
-			"server":        dnsTag,
-		}
-		dnsRules = append([]interface{}{dnsRule}, dnsRules...)
-		
-		fmt.Printf("[addWireGuardDNSNew] Added DNS server %s (%s) for domains: %v\n", dnsTag, wg.DNS, domainSuffixes)
-	}
-	
-	dns["servers"] = servers
-	dns["rules"] = dnsRules
 }
 
-// updateRouteRulesForWireGuardNew updates route rules for WireGuard (native mode).
-// Traffic goes through "direct" - the WireGuard interface handles routing based on AllowedIPs.
-func (b *ConfigBuilderForStorage) updateRouteRulesForWireGuardNew(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
-	if len(wireGuardConfigs) == 0 {
-		return
-	}
-	
+// insertRuleAfterSniff inserts rule right after the sniff action (or first)
+// and the app rules following it, and returns its position.
+func insertRuleAfterSniff(template map[string]interface{}, rule map[string]interface{}) (int, bool) {
 	route, ok := template["route"].(map[string]interface{})
 	if !ok {
-		return
-	}
-	
-	rules, ok := route["rules"].([]interface{})
-	if !ok {
-		rules = []interface{}{}
-	}
-	
-	// Collect all AllowedIPs from WireGuard configs
-	allWireGuardCIDRs := []string{}
-	for _, wg := range wireGuardConfigs {
-		allWireGuardCIDRs = append(allWireGuardCIDRs, wg.AllowedIPs...)
-	}
-	
-	if len(allWireGuardCIDRs) == 0 {
-		return
+		return 0, false
 	}
+	rules, _ := route["rules"].([]interface{})
 	
-	// Find position after hijack-dns
 	insertIdx := 0
-	for i, rule := range rules {
-		if ruleMap, ok := rule.(map[string]interface{}); ok {
-			action, _ := ruleMap["action"].(string)
-			if action == "hijack-dns" {
+	for i, r := range rules {
+		if ruleMap, ok := r.(map[string]interface{}); ok {
+			if action, _ := ruleMap["action"].(string); action == "sniff" {
 				insertIdx = i + 1
 				break
 			}
-			if action == "sniff" {
-				insertIdx = i + 1
-			}
 		}
 	}
-	
-	// Create route rule for WireGuard networks
-	wgRule := map[string]interface{}{
-		"ip_cidr":  allWireGuardCIDRs,
-		"outbound": "direct",
+	// App rules take priority over every other rule
+	for insertIdx < len(rules) && isAppRouteRule(rules[insertIdx]) {
+		insertIdx++
 	}
 	
-	// Insert rule after hijack-dns
 	finalRules := make([]interface{}, 0, len(rules)+1)
 	finalRules = append(finalRules, rules[:insertIdx]...)
-	finalRules = append(finalRules, wgRule)
+	finalRules = append(finalRules, rule)
 	finalRules = append(finalRules, rules[insertIdx:]...)
-	
 	route["rules"] = finalRules
-	
-	fmt.Printf("[updateRouteRulesForWireGuardNew] Added route rule for CIDRs: %v at position %d\n", allWireGuardCIDRs, insertIdx)
+	return insertIdx, true
 }
 
-// updateRouteRulesForWireGuard updates route rules for WireGuard.
-func (b *ConfigBuilderForStorage) updateRouteRulesForWireGuard(template map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) {
-	if len(wireGuardConfigs) == 0 {
-		return
-	}
-	
-	route, ok := template["route"].(map[string]interface{})
-	if !ok {
-		route = map[string]interface{}{}
-		template["route"] = route
-	}
-	
-	rules, _ := route["rules"].([]interface{})
-	if rules == nil {
-		rules = []interface{}{}
+// subscriptionOptions returns the request options of the profile's subscription:
+// its headers and whether the user disabled certificate verification for its host.
+func (b *ConfigBuilderForStorage) subscriptionOptions(profileID int) SubscriptionRequestOptions {
+	profile, err := b.storage.GetProfile(profileID)
+	if err != nil {
+		return SubscriptionRequestOptions{}
 	}
-	
-	// Use existing GenerateRouteRulesForWireGuard function
-	newRules := GenerateRouteRulesForWireGuard(wireGuardConfigs)
-	
-	// Convert to []interface{}
-	newRulesInterface := make([]interface{}, len(newRules))
-	for i, r := range newRules {
-		newRulesInterface[i] = r
+	return SubscriptionRequestOptions{
+		Headers:  profile.SubscriptionHeaders,
+		Insecure: profile.SubscriptionInsecureSkipVerify,
 	}
-	
-	// Prepend new rules to existing ones
-	newRulesInterface = append(newRulesInterface, rules...)
-	route["rules"] = newRulesInterface
 }
 
-// addExperimentalAPI adds experimental section for traffic stats.
-func (b *ConfigBuilderForStorage) addExperimentalAPI(template map[string]interface{}) {
-	experimental, ok := template["experimental"].(map[string]interface{})
-	if !ok {
-		experimental = map[string]interface{}{}
-		template["experimental"] = experimental
+// applyPreferredDNS replaces the final resolver of config with the one from settings.
+// Without a preference the template resolver is restored.
+func (b *ConfigBuilderForStorage) applyPreferredDNS(config map[string]interface{}, wireGuardConfigs []UserWireGuardConfig) error {
+	address, err := ResolvePreferredDNS(b.storage.GetAppSettings().PreferredDNS)
+	if err != nil {
+		return err
 	}
 	
-	clashAPI, ok := experimental["clash_api"].(map[string]interface{})
-	if !ok {
-		experimental["clash_api"] = map[string]interface{}{
-			"external_controller": "127.0.0.1:9090",
-		}
-	} else {
-		if _, exists := clashAPI["external_controller"]; !exists {
-			clashAPI["external_controller"] = "127.0.0.1:9090"
-		}
-	}
-}
-
-// applyRoutingMode applies routing rules based on the selected routing mode.
-func (b *ConfigBuilderForStorage) applyRoutingMode(template map[string]interface{}) {
-	route, ok := template["route"].(map[string]interface{})
-	if !ok {
-		route = map[string]interface{}{}
-		template["route"] = route
-	}
-
-	// Clean up DNS rules that reference remote rule_sets (geosite-*)
-	b.cleanupDNSRuleSets(template)
-
-	switch b.routingMode {
-	case RoutingModeBlockedOnly:
-		// Only blocked sites through VPN - use Re:filter + community rule-sets
-		b.applyBlockedOnlyMode(route)
-		
-	case RoutingModeExceptRussia:
-		// All except Russia through VPN - use built-in RU domain list
-		b.applyExceptRussiaMode(route)
-		
-	case RoutingModeAllTraffic:
-		// All traffic through VPN - remove direct rules for Russia
-		b.applyAllTrafficMode(route)
-		
-	default:
-		// Unknown mode, use blocked_only as safest default
-		fmt.Printf("[applyRoutingMode] Unknown mode %s, using blocked_only\n", b.routingMode)
-		b.applyBlockedOnlyMode(route)
+	var fallback map[string]interface{}
+	if dns, ok := config["dns"].(map[string]interface{}); ok && address == "" {
+		fallback = templateDNSServer(b.storage.templatePath, finalDNSTag(dns))
 	}
+	return applyPreferredDNS(config, address, fallback, wireGuardConfigs)
 }
 
-// cleanupDNSRuleSets removes DNS rules that reference remote rule_sets (geosite-*).
-// These are not available in blocked_only and all_traffic modes.
-func (b *ConfigBuilderForStorage) cleanupDNSRuleSets(template map[string]interface{}) {
-	dns, ok := template["dns"].(map[string]interface{})
-	if !ok {
-		return
-	}
-
-	rules, ok := dns["rules"].([]interface{})
-	if !ok {
-		return
-	}
-
-	// Filter out rules that use rule_set with geosite-*
-	newRules := make([]interface{}, 0, len(rules))
-	for _, rule := range rules {
-		ruleMap, ok := rule.(map[string]interface{})
-		if !ok {
-			newRules = append(newRules, rule)
-			continue
-		}
-
-		// Check if this rule uses rule_set
-		if ruleSet, hasRuleSet := ruleMap["rule_set"]; hasRuleSet {
-			// Skip rules with geosite-* rule_sets
-			if ruleSetArr, ok := ruleSet.([]interface{}); ok {
-				hasGeosite := false
-				for _, rs := range ruleSetArr {
-					if rsStr, ok := rs.(string); ok {
-						if strings.HasPrefix(rsStr, "geosite-") || strings.HasPrefix(rsStr, "geoip-") {
-							hasGeosite = true
-							break
-						}
-					}
-				}
-				if hasGeosite {
-					fmt.Printf("[cleanupDNSRuleSets] Removed DNS rule with remote rule_set: %v\n", ruleSet)
-					continue
-				}
-			}
-		}
-
-		newRules = append(newRules, rule)
-	}
-
-	dns["rules"] = newRules
+// URLTestCachePath returns the absolute path of sing-box cache_file.
+func (s *Storage) URLTestCachePath() string {
+	return filepath.Join(s.resourcesPath, URLTestCacheFile)
 }
 
-// applyBlockedOnlyMode configures routing for blocked sites only.
-func (b *ConfigBuilderForStorage) applyBlockedOnlyMode(route map[string]interface{}) {
-	fmt.Printf("[applyRoutingMode] Using blocked_only mode with local filters\n")
-
-	// Get local filter rule_sets
-	filterRuleSets := b.filterManager.GetRuleSetConfigs()
-	if len(filterRuleSets) == 0 {
-		fmt.Printf("[applyRoutingMode] WARNING: No filter files found, falling back to except_russia\n")
-		return
+// ClearURLTestCache deletes sing-box cache_file. Missing file is not an error.
+func (s *Storage) ClearURLTestCache() error {
+	if err := os.Remove(s.URLTestCachePath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete cache file: %w", err)
 	}
-
-	// Build new rule_set array with only local filters
-	newRuleSets := make([]interface{}, 0, len(filterRuleSets))
-	for _, rs := range filterRuleSets {
-		newRuleSets = append(newRuleSets, rs)
-	}
-	route["rule_set"] = newRuleSets
-
-	// Build new rules for blocked_only mode
-	newRules := []interface{}{
-		// 1. Sniff for protocol detection
-		map[string]interface{}{
-			"action": "sniff",
-		},
-		// 2. Local domains direct
-		map[string]interface{}{
-			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
-			"action":        "route",
-			"outbound":      "direct",
-		},
-		// 3. Hijack DNS
-		map[string]interface{}{
-			"protocol": "dns",
-			"action":   "hijack-dns",
-		},
-		// 4. Private IPs direct
-		map[string]interface{}{
-			"ip_is_private": true,
-			"action":        "route",
-			"outbound":      "direct",
-		},
-	}
-
-	// 5. Add rules for blocked domains/IPs through proxy
-	newRules = append(newRules, map[string]interface{}{
-		"rule_set": []string{"refilter-domains"},
-		"action":   "route",
-		"outbound": "proxy",
-	})
-	
-	newRules = append(newRules, map[string]interface{}{
-		"rule_set": []string{"refilter-ips"},
-		"action":   "route",
-		"outbound": "proxy",
-	})
-	
-	newRules = append(newRules, map[string]interface{}{
-		"rule_set": []string{"community-domains"},
-		"action":   "route",
-		"outbound": "proxy",
-	})
-	
-	newRules = append(newRules, map[string]interface{}{
-		"rule_set": []string{"community-ips"},
-		"action":   "route",
-		"outbound": "proxy",
-	})
-	
-	newRules = append(newRules, map[string]interface{}{
-		"rule_set": []string{"discord-ips"},
-		"action":   "route",
-		"outbound": "proxy",
-	})
-
-	route["rules"] = newRules
-	route["final"] = "direct"
-	
-	fmt.Printf("[applyRoutingMode] Applied blocked_only: %d rule_sets, %d rules, final=direct\n", 
-		len(newRuleSets), len(newRules))
-}
-
-// applyAllTrafficMode configures routing for all traffic through VPN.
-func (b *ConfigBuilderForStorage) applyAllTrafficMode(route map[string]interface{}) {
-	fmt.Printf("[applyRoutingMode] Using all_traffic mode\n")
-
-	// Remove rule_sets (not needed for all traffic mode)
-	route["rule_set"] = []interface{}{}
-
-	// Minimal rules
-	newRules := []interface{}{
-		map[string]interface{}{
-			"action": "sniff",
-		},
-		map[string]interface{}{
-			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
-			"action":        "route",
-			"outbound":      "direct",
-		},
-		map[string]interface{}{
-			"protocol": "dns",
-			"action":   "hijack-dns",
-		},
-		map[string]interface{}{
-			"ip_is_private": true,
-			"action":        "route",
-			"outbound":      "direct",
-		},
-	}
-
-	route["rules"] = newRules
-	route["final"] = "proxy"
-	
-	fmt.Printf("[applyRoutingMode] Applied all_traffic: minimal rules, final=proxy\n")
-}
-
-// applyExceptRussiaMode configures routing for all traffic except Russia through VPN.
-// Uses built-in domain list instead of remote geosite to avoid download issues.
-func (b *ConfigBuilderForStorage) applyExceptRussiaMode(route map[string]interface{}) {
-	fmt.Printf("[applyRoutingMode] Using except_russia mode with built-in domain list\n")
-
-	// No remote rule_sets needed - we use built-in domain suffixes
-	route["rule_set"] = []interface{}{}
-
-	// Russian domain suffixes for direct routing
-	ruDomainSuffixes := []string{
-		// Top-level domains
-		".ru", ".su", ".рф",
-		// Yandex
-		".yandex.com", ".yandex.net", ".yandex.ru", ".ya.ru", ".yandex.by", ".yandex.kz",
-		// VK / Mail.ru
-		".vk.com", ".vkontakte.ru", ".vk.me", ".userapi.com",
-		".mail.ru", ".mailru.com", ".mycdn.me", ".imgsmail.ru",
-		".ok.ru", ".odnoklassniki.ru",
-		// Banks
-		".sberbank.ru", ".sber.ru", ".tinkoff.ru", ".tinkoff.com", ".vtb.ru", ".alfabank.ru",
-		".raiffeisen.ru", ".gazprombank.ru", ".open.ru", ".rosbank.ru",
-		// Government
-		".gosuslugi.ru", ".mos.ru", ".nalog.ru", ".government.ru", ".kremlin.ru",
-		".duma.gov.ru", ".cbr.ru", ".pfrf.ru", ".fss.ru",
-		// News
-		".ria.ru", ".rbc.ru", ".interfax.ru", ".tass.ru", ".kommersant.ru",
-		".lenta.ru", ".gazeta.ru", ".kp.ru", ".mk.ru", ".iz.ru", ".rt.com",
-		// E-commerce
-		".ozon.ru", ".wildberries.ru", ".lamoda.ru", ".dns-shop.ru", ".mvideo.ru",
-		".eldorado.ru", ".citilink.ru", ".avito.ru", ".youla.ru",
-		// Retail
-		".perekrestok.ru", ".magnit.ru", ".5ka.ru", ".dixy.ru", ".lenta.com",
-		".sbermarket.ru", ".delivery-club.ru",
-		// Transport
-		".rzd.ru", ".aeroflot.ru", ".s7.ru", ".utair.ru", ".pobeda.aero",
-		".pochta.ru", ".cdek.ru", ".boxberry.ru", ".dpd.ru",
-		// Telecom
-		".mts.ru", ".megafon.ru", ".beeline.ru", ".tele2.ru",
-		".rostelecom.ru", ".rt.ru",
-		// Media
-		".vgtrk.ru", ".1tv.ru", ".ntv.ru", ".ren.tv", ".ctc.ru",
-		".rutube.ru", ".ivi.ru", ".okko.tv", ".more.tv", ".kinopoisk.ru",
-		".dzen.ru", ".zen.yandex.ru",
-		// Maps / Navigation
-		".2gis.ru", ".2gis.com",
-		// Other popular
-		".sports.ru", ".championat.com", ".sport-express.ru",
-		".hh.ru", ".superjob.ru", ".rabota.ru",
-		".cian.ru", ".domclick.ru", ".avito.ru",
-		".pikabu.ru", ".habr.com", ".vc.ru", ".dtf.ru",
-	}
-
-	// Russian domain keywords for additional matching
-	ruDomainKeywords := []string{
-		"yandex", "sber", "tinkoff", "gosuslugi", "rutube",
-		"vkontakte", "mailru", "rambler", "wildberries", "ozon",
-	}
-
-	newRules := []interface{}{
-		// 1. Sniff for protocol detection
-		map[string]interface{}{
-			"action": "sniff",
-		},
-		// 2. Local domains direct
-		map[string]interface{}{
-			"domain_suffix": []string{".local", ".internal", ".corp", ".lan", ".home", ".intranet", ".private"},
-			"action":        "route",
-			"outbound":      "direct",
-		},
-		// 3. Hijack DNS
-		map[string]interface{}{
-			"protocol": "dns",
-			"action":   "hijack-dns",
-		},
-		// 4. Private IPs direct
-		map[string]interface{}{
-			"ip_is_private": true,
-			"action":        "route",
-			"outbound":      "direct",
-		},
-		// 5. Russian domains direct
-		map[string]interface{}{
-			"domain_suffix": ruDomainSuffixes,
-			"action":        "route",
-			"outbound":      "direct",
-		},
-		// 6. Russian domain keywords direct
-		map[string]interface{}{
-			"domain_keyword": ruDomainKeywords,
-			"action":         "route",
-			"outbound":       "direct",
-		},
-	}
-
-	route["rules"] = newRules
-	route["final"] = "proxy"
-
-	fmt.Printf("[applyRoutingMode] Applied except_russia: %d domain suffixes, %d keywords, final=proxy\n",
-		len(ruDomainSuffixes), len(ruDomainKeywords))
+	return nil
 }
 
 // isDirectProxyLink checks if URL is a direct proxy link.
@@ -1558,7 +1770,10 @@ func isDirectProxyLink(url string) bool {
 	return strings.HasPrefix(url, "vless://") ||
 		strings.HasPrefix(url, "trojan://") ||
 		strings.HasPrefix(url, "ss://") ||
-		strings.HasPrefix(url, "vmess://")
+		strings.HasPrefix(url, "vmess://") ||
+		strings.HasPrefix(url, "hysteria2://") ||
+		strings.HasPrefix(url, "hy2://") ||
+		strings.HasPrefix(url, "tuic://")
 }
 
 // GetUserSettings returns user settings for active profile (compatibility method).
@@ -1568,11 +1783,13 @@ func (s *Storage) GetUserSettings() (*UserSettings, error) {
 		return &UserSettings{}, nil
 	}
 	
+	// The configs are copied: callers edit them in place before validating,
+	// and a refused edit must not leak into the stored profile
 	return &UserSettings{
 		SubscriptionURL:  profile.SubscriptionURL,
 		LastUpdated:      profile.LastUpdated,
 		ProxyCount:       profile.ProxyCount,
-		WireGuardConfigs: profile.WireGuardConfigs,
+		WireGuardConfigs: append([]UserWireGuardConfig(nil), profile.WireGuardConfigs...),
 	}, nil
 }
 
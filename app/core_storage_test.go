@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRuntimeConfig returns a stored config with the parts renderRuntimeConfig removes or changes
+func testRuntimeConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"log": map[string]interface{}{"level": "info", "output": "box.log"},
+		"dns": map[string]interface{}{
+			"servers": []interface{}{
+				map[string]interface{}{"type": "udp", "tag": "local", "server": "1.1.1.1"},
+				map[string]interface{}{"type": "udp", "tag": "dns-wg-office", "server": "10.8.0.1"},
+			},
+			"rules": []interface{}{map[string]interface{}{"domain_suffix": []interface{}{".office"}, "server": "dns-wg-office"}},
+		},
+		"endpoints": []interface{}{map[string]interface{}{"type": "wireguard", "tag": "wg-office"}},
+		"inbounds":  []interface{}{map[string]interface{}{"type": "tun", "tag": "tun-in"}},
+		"outbounds": []interface{}{
+			map[string]interface{}{"type": "trojan", "tag": "de", "server": "de.example.com", "server_port": 443},
+			map[string]interface{}{"type": "wireguard", "tag": "wg-old"},
+			map[string]interface{}{"type": "urltest", "tag": "auto-select", "outbounds": []interface{}{"de"}},
+			map[string]interface{}{"type": "selector", "tag": "proxy", "outbounds": []interface{}{"auto-select", "de", "direct"}, "default": "auto-select"},
+			map[string]interface{}{"type": "direct", "tag": "direct"},
+		},
+		"route": map[string]interface{}{"final": "proxy", "rules": []interface{}{map[string]interface{}{"action": "sniff"}}},
+	}
+}
+
+func TestWriteActiveConfigKeepsStoredConfig(t *testing.T) {
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UpdateProfileConfig(profile.ID, testRuntimeConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetActiveProfileID(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+	storage.SetDirectInterface("Ethernet")
+
+	exportProfile := func() string {
+		t.Helper()
+		stored, err := storage.GetProfile(profile.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	before := exportProfile()
+	for i := 0; i < 2; i++ {
+		path, err := storage.WriteActiveConfigToFile()
+		if err != nil {
+			t.Fatalf("WriteActiveConfigToFile: %v", err)
+		}
+		written, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, removed := range []string{`"endpoints"`, `"output"`, `"wg-old"`, `"dns-wg-office"`} {
+			if strings.Contains(string(written), removed) {
+				t.Errorf("active config contains %s", removed)
+			}
+		}
+	}
+	if after := exportProfile(); after != before {
+		t.Errorf("stored profile changed by WriteActiveConfigToFile:\nbefore %s\n after %s", before, after)
+	}
+}
+
+func TestWriteFileIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "active_config.json")
+	if err := writeFileIfChanged(path, []byte(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same content is not written again
+	if err := writeFileIfChanged(path, []byte(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("unchanged config rewritten (mtime %v)", info.ModTime())
+	}
+
+	if err := writeFileIfChanged(path, []byte(`{"a":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"a":2}` {
+		t.Errorf("file = %s, want the new config", data)
+	}
+}
+
+func TestDeepCopyJSONMap(t *testing.T) {
+	original := testRuntimeConfig()
+	copied := deepCopyJSONMap(original)
+
+	delete(copied, "endpoints")
+	delete(copied["log"].(map[string]interface{}), "output")
+	copied["outbounds"].([]interface{})[0].(map[string]interface{})["server"] = "changed"
+	copied["route"].(map[string]interface{})["rules"].([]interface{})[0] = "changed"
+
+	want, _ := json.Marshal(testRuntimeConfig())
+	if got, _ := json.Marshal(original); string(got) != string(want) {
+		t.Errorf("original changed through the copy:\n got %s\nwant %s", got, want)
+	}
+}
+
+// setTestBuildInfo replaces the build stamp of a stored profile
+func setTestBuildInfo(t *testing.T, s *Storage, id int, info *ConfigBuildInfo) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			s.data.Profiles[i].BuildInfo = info
+			return
+		}
+	}
+	t.Fatalf("profile %d not found", id)
+}
+
+func TestPatchProfileConfigKeepsBuildInfo(t *testing.T) {
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := &ConfigBuildInfo{AppVersion: "9.0.0", SchemaRevision: ConfigSchemaRevision + 1, RoutingMode: RoutingModeAllTraffic}
+	setTestBuildInfo(t, storage, profile.ID, stamp)
+
+	if err := storage.PatchProfileConfig(profile.ID, testRuntimeConfig()); err != nil {
+		t.Fatalf("PatchProfileConfig: %v", err)
+	}
+	patched, _ := storage.GetProfile(profile.ID)
+	if patched.BuildInfo != stamp {
+		t.Errorf("BuildInfo = %+v, want the stamp kept", patched.BuildInfo)
+	}
+	if len(patched.SingboxConfig) == 0 {
+		t.Error("patched config not stored")
+	}
+
+	// A rebuild stamps the config with this builder
+	if err := storage.UpdateProfileConfig(profile.ID, testRuntimeConfig()); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := storage.GetProfile(profile.ID)
+	if rebuilt.BuildInfo.SchemaRevision != ConfigSchemaRevision || rebuilt.BuildInfo.AppVersion != Version {
+		t.Errorf("BuildInfo = %+v, want a fresh stamp", rebuilt.BuildInfo)
+	}
+
+	if err := storage.PatchProfileConfig(profile.ID+100, testRuntimeConfig()); err == nil {
+		t.Error("patching a missing profile succeeded")
+	}
+}
+
+func TestWriteActiveConfigAppliesAvoidance(t *testing.T) {
+	storage := NewStorage(t.TempDir())
+	if err := storage.Init(); err != nil {
+		t.Fatalf("Storage.Init: %v", err)
+	}
+	profile, err := storage.CreateProfile("Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testRuntimeConfig()
+	config["outbounds"] = append(config["outbounds"].([]interface{}),
+		map[string]interface{}{"type": "trojan", "tag": "nl", "server": "nl.example.com", "server_port": 443})
+	config["outbounds"].([]interface{})[2].(map[string]interface{})["outbounds"] = []interface{}{"de", "nl"}
+	if err := storage.UpdateProfileConfig(profile.ID, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetActiveProfileID(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The prober only stores the list; every connect writes it into the runtime config
+	autoSelect := func() []string {
+		t.Helper()
+		path, err := storage.WriteActiveConfigToFile()
+		if err != nil {
+			t.Fatalf("WriteActiveConfigToFile: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var written map[string]interface{}
+		if err := json.Unmarshal(data, &written); err != nil {
+			t.Fatal(err)
+		}
+		for _, outbound := range written["outbounds"].([]interface{}) {
+			if group := outbound.(map[string]interface{}); group["tag"] == "auto-select" {
+				return jsonStringList(group["outbounds"])
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name  string
+		until time.Time
+		want  []string
+	}{
+		{"avoided", time.Now().Add(time.Hour), []string{"de"}},
+		{"cooldown expired", time.Now().Add(-time.Minute), []string{"de", "nl"}},
+	}
+	for _, tt := range tests {
+		if err := storage.SetProfileAvoidedProxies(profile.ID, map[string]time.Time{"nl": tt.until}); err != nil {
+			t.Fatal(err)
+		}
+		if got := autoSelect(); !equalStringSlices(got, tt.want) {
+			t.Errorf("%s: auto-select = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package main provides the subscription change report for KampusVPN.
+// Each build keeps a snapshot of the subscription proxies in the profile; the
+// next build compares against it and reports added, removed and renamed
+// servers and changed credentials. A remembered proxy that disappeared is
+// dropped so the selector falls back to auto-select.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProxySnapshotEntry is one subscription proxy as of the last build.
+// Credentials are kept only as a hash to notice changes.
+type ProxySnapshotEntry struct {
+	Tag         string `json:"tag"`
+	Name        string `json:"name,omitempty"`
+	Type        string `json:"type"`
+	Server      string `json:"server"`
+	ServerPort  int    `json:"server_port"`
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// ProxyRename is a server that kept its address but changed its name
+type ProxyRename struct {
+	Server  string `json:"server"`
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name"`
+}
+
+// SubscriptionDiff is what changed in the subscription since the previous build
+type SubscriptionDiff struct {
+	Added              []string      `json:"added"`
+	Removed            []string      `json:"removed"`
+	Renamed            []ProxyRename `json:"renamed"`
+	CredentialsChanged []string      `json:"credentials_changed"`
+	// Remembered proxy that is gone; the selector is back on auto-select
+	SelectedRemoved string `json:"selected_removed,omitempty"`
+	// Pinned or hidden proxies that are gone; their preferences are dropped
+	PreferencesRemoved []string  `json:"preferences_removed,omitempty"`
+	Initial            bool      `json:"initial,omitempty"` // No previous snapshot to compare with
+	ComparedAt         time.Time `json:"compared_at"`
+}
+
+// displayName returns the name shown for the entry
+func (e ProxySnapshotEntry) displayName() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Tag
+}
+
+// address returns type and server:port, the identity of a server across renames
+func (e ProxySnapshotEntry) address() string {
+	return fmt.Sprintf("%s|%s:%d", e.Type, e.Server, e.ServerPort)
+}
+
+// newProxySnapshot records the proxies of a build
+func newProxySnapshot(proxies []ProxyConfig) []ProxySnapshotEntry {
+	snapshot := make([]ProxySnapshotEntry, 0, len(proxies))
+	for _, p := range proxies {
+		snapshot = append(snapshot, ProxySnapshotEntry{
+			Tag:         p.Tag,
+			Name:        p.Name,
+			Type:        p.Type,
+			Server:      p.Server,
+			ServerPort:  p.ServerPort,
+			Credentials: proxyCredentialsHash(p),
+		})
+	}
+	return snapshot
+}
+
+// proxyCredentialsHash returns a short hash of what authenticates to the server
+func proxyCredentialsHash(p ProxyConfig) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{p.UUID, p.Password, p.Method, p.PublicKey, p.ShortID}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// DiffProxySnapshots compares two snapshots. Servers are matched by address and
+// name first, then by address alone (a rename); the rest are added or removed.
+func DiffProxySnapshots(previous, current []ProxySnapshotEntry) SubscriptionDiff {
+	diff := SubscriptionDiff{
+		Added:              []string{},
+		Removed:            []string{},
+		Renamed:            []ProxyRename{},
+		CredentialsChanged: []string{},
+		ComparedAt:         time.Now(),
+	}
+
+	exact := map[string][]ProxySnapshotEntry{}
+	for _, e := range previous {
+		key := e.address() + "|" + e.Name
+		exact[key] = append(exact[key], e)
+	}
+
+	var unmatched []ProxySnapshotEntry
+	for _, e := range current {
+		key := e.address() + "|" + e.Name
+		if olds := exact[key]; len(olds) > 0 {
+			exact[key] = olds[1:]
+			if olds[0].Credentials != e.Credentials {
+				diff.CredentialsChanged = append(diff.CredentialsChanged, e.displayName())
+			}
+			continue
+		}
+		unmatched = append(unmatched, e)
+	}
+
+	byAddress := map[string][]ProxySnapshotEntry{}
+	for _, e := range previous {
+		key := e.address() + "|" + e.Name
+		if len(exact[key]) > 0 {
+			byAddress[e.address()] = append(byAddress[e.address()], exact[key][0])
+			exact[key] = exact[key][1:]
+		}
+	}
+
+	for _, e := range unmatched {
+		if olds := byAddress[e.address()]; len(olds) > 0 {
+			byAddress[e.address()] = olds[1:]
+			diff.Renamed = append(diff.Renamed, ProxyRename{
+				Server:  fmt.Sprintf("%s:%d", e.Server, e.ServerPort),
+				OldName: olds[0].displayName(),
+				NewName: e.displayName(),
+			})
+			if olds[0].Credentials != e.Credentials {
+				diff.CredentialsChanged = append(diff.CredentialsChanged, e.displayName())
+			}
+			continue
+		}
+		diff.Added = append(diff.Added, e.displayName())
+	}
+
+	for _, olds := range byAddress {
+		for _, e := range olds {
+			diff.Removed = append(diff.Removed, e.displayName())
+		}
+	}
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// Empty reports whether nothing changed
+func (d *SubscriptionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Renamed) == 0 &&
+		len(d.CredentialsChanged) == 0 && d.SelectedRemoved == ""
+}
+
+// Summary returns a one-line description for the UI log
+func (d *SubscriptionDiff) Summary() string {
+	if d.Initial {
+		return "Подписка загружена"
+	}
+	if d.Empty() {
+		return "Подписка обновлена: изменений нет"
+	}
+
+	parts := []string{}
+	if n := len(d.Added); n > 0 {
+		parts = append(parts, fmt.Sprintf("добавлено %d", n))
+	}
+	if n := len(d.Removed); n > 0 {
+		parts = append(parts, fmt.Sprintf("удалено %d", n))
+	}
+	if n := len(d.Renamed); n > 0 {
+		parts = append(parts, fmt.Sprintf("переименовано %d", n))
+	}
+	if n := len(d.CredentialsChanged); n > 0 {
+		parts = append(parts, fmt.Sprintf("изменены ключи у %d", n))
+	}
+	summary := "Подписка обновлена"
+	if len(parts) > 0 {
+		summary += ": " + strings.Join(parts, ", ")
+	}
+	if d.SelectedRemoved != "" {
+		summary += fmt.Sprintf(". Выбранный сервер %s удалён, включён автовыбор", d.SelectedRemoved)
+	}
+	if n := len(d.PreferencesRemoved); n > 0 {
+		summary += fmt.Sprintf(". Закреплённых или скрытых серверов больше нет в подписке: %d", n)
+	}
+	return summary
+}
+
+// --- Storage ---
+
+// RecordProxySnapshot compares the subscription proxies of a build with the
+// previous snapshot, saves the new snapshot and the diff, and drops a
+// remembered proxy that is no longer in the subscription.
+func (s *Storage) RecordProxySnapshot(id int, proxies []ProxyConfig) (*SubscriptionDiff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		profile := &s.data.Profiles[i]
+		if profile.ID != id {
+			continue
+		}
+
+		current := newProxySnapshot(proxies)
+		diff := DiffProxySnapshots(profile.ProxySnapshot, current)
+		diff.Initial = profile.ProxySnapshot == nil
+		if diff.Initial {
+			diff.Added = []string{}
+		}
+
+		if selected := profile.SelectedProxy; selected != "" && !snapshotHas(current, selected) {
+			diff.SelectedRemoved = selected
+			profile.SelectedProxy = ""
+		}
+		if !diff.Initial && profile.NodePreferences != nil {
+			diff.PreferencesRemoved = profile.NodePreferences.prune(current)
+			if profile.NodePreferences.Empty() {
+				profile.NodePreferences = nil
+			}
+		}
+
+		profile.ProxySnapshot = current
+		profile.LastSubscriptionDiff = &diff
+		return &diff, s.saveInternal()
+	}
+	return nil, fmt.Errorf("profile with ID %d not found", id)
+}
+
+// snapshotHas reports whether a proxy with the tag or name is in the snapshot
+func snapshotHas(snapshot []ProxySnapshotEntry, tagOrName string) bool {
+	for _, e := range snapshot {
+		if e.Tag == tagOrName || e.Name == tagOrName {
+			return true
+		}
+	}
+	return false
+}
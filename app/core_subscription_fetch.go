@@ -0,0 +1,132 @@
+// Package main provides retries, cancellation and the redirect policy of
+// subscription fetches for KampusVPN.
+// On a flaky connection one failed GET is not an answer: timeouts, 5xx and
+// reset connections are retried twice with a jittered backoff, and the
+// caller's context cancels a fetch in flight (the user closed the dialog).
+// Redirects are followed only a few times and only to http(s) URLs.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Subscription fetch retry settings
+const (
+	// SubscriptionFetchRetries is how many times a transient failure is retried.
+	SubscriptionFetchRetries = 2
+	// SubscriptionRetryDelay is the backoff before the first retry; it doubles
+	// for the next one and gets up to the same amount of random jitter.
+	SubscriptionRetryDelay = time.Second
+	// SubscriptionMaxRedirects is how many redirects are followed.
+	SubscriptionMaxRedirects = 5
+)
+
+// SubscriptionFetchTrace reports how a fetch went, for the test result.
+type SubscriptionFetchTrace struct {
+	Attempts int    `json:"attempts"`
+	FinalURL string `json:"final_url,omitempty"` // Last URL of the redirect chain
+}
+
+// subscriptionStatusError is a non-200 answer of the subscription server
+type subscriptionStatusError struct {
+	Code int
+}
+
+func (e *subscriptionStatusError) Error() string {
+	return fmt.Sprintf("subscription returned status %d", e.Code)
+}
+
+// isTransientFetchError reports whether a failed fetch may succeed if repeated:
+// timeouts, 5xx answers and connections reset by the server
+func isTransientFetchError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if _, ok := asSubscriptionTLSError(err); ok {
+		return false
+	}
+	var statusErr *subscriptionStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// WSAECONNRESET isn't mapped to ECONNRESET on Windows
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "connection reset") || strings.Contains(message, "forcibly closed")
+}
+
+// subscriptionRetryDelay returns the backoff before retry number attempt (1-based)
+func subscriptionRetryDelay(attempt int) time.Duration {
+	base := SubscriptionRetryDelay << (attempt - 1)
+	return base + time.Duration(rand.Int63n(int64(base)))
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withRedirectPolicy returns a copy of client that follows at most
+// SubscriptionMaxRedirects redirects, only to http(s) URLs, on top of the
+// client's own policy
+func withRedirectPolicy(client *http.Client) *http.Client {
+	previous := client.CheckRedirect
+	limited := *client
+	limited.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to %s:// refused: only http and https are allowed", req.URL.Scheme)
+		}
+		if len(via) > SubscriptionMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", SubscriptionMaxRedirects)
+		}
+		if previous != nil {
+			return previous(req, via)
+		}
+		return nil
+	}
+	return &limited
+}
+
+// fetchWithRetry repeats fetchAndParse while it fails with a transient error
+func (f *SubscriptionFetcher) fetchWithRetry(ctx context.Context, subscriptionURL string, client *http.Client, opts SubscriptionRequestOptions) ([]ProxyConfig, *SubscriptionUserInfo, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			delay := subscriptionRetryDelay(attempt)
+			fmt.Printf("[Subscription] Retrying %s in %v (attempt %d)\n", subscriptionHost(subscriptionURL), delay.Round(time.Millisecond), attempt+1)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, nil, fmt.Errorf("subscription fetch cancelled: %w", err)
+			}
+		}
+		if opts.Trace != nil {
+			opts.Trace.Attempts++
+		}
+
+		proxies, userInfo, err := f.fetchAndParse(ctx, subscriptionURL, client, opts)
+		if err == nil || attempt >= SubscriptionFetchRetries || !isTransientFetchError(ctx, err) {
+			return proxies, userInfo, err
+		}
+		fmt.Printf("[Subscription] Fetch of %s failed: %v\n", subscriptionHost(subscriptionURL), err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientFetchError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"server error", context.Background(), &subscriptionStatusError{Code: 502}, true},
+		{"service unavailable", context.Background(), fmt.Errorf("fetch: %w", &subscriptionStatusError{Code: 503}), true},
+		{"not found", context.Background(), &subscriptionStatusError{Code: 404}, false},
+		{"forbidden", context.Background(), &subscriptionStatusError{Code: 403}, false},
+		{"timeout", context.Background(), fmt.Errorf("get: %w", timeoutError{}), true},
+		{"connection reset", context.Background(), fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"unexpected EOF", context.Background(), io.ErrUnexpectedEOF, true},
+		{"WSAECONNRESET", context.Background(), errors.New("wsarecv: An existing connection was forcibly closed by the remote host."), true},
+		{"certificate", context.Background(), &SubscriptionTLSError{}, false},
+		{"parse error", context.Background(), errors.New("no proxies found"), false},
+		{"cancelled", cancelled, &subscriptionStatusError{Code: 503}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientFetchError(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("isTransientFetchError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionRetryDelay(t *testing.T) {
+	for attempt := 1; attempt <= SubscriptionFetchRetries; attempt++ {
+		base := SubscriptionRetryDelay << (attempt - 1)
+		for i := 0; i < 50; i++ {
+			if d := subscriptionRetryDelay(attempt); d < base || d >= 2*base {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v)", attempt, d, base, 2*base)
+			}
+		}
+	}
+}
+
+func TestSleepContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := sleepContext(ctx, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("sleepContext ignored the cancelled context")
+	}
+	if err := sleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("err = %v, want nil", err)
+	}
+}
+
+// redirectServer redirects /hop/N to /hop/N-1 and answers "ok" at /hop/0
+func redirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		switch {
+		case err != nil:
+			http.Redirect(w, r, "file:///C:/Windows/win.ini", http.StatusFound)
+		case n > 0:
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWithRedirectPolicy(t *testing.T) {
+	server := redirectServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{"no redirect", "/hop/0", true},
+		{"at the limit", fmt.Sprintf("/hop/%d", SubscriptionMaxRedirects), true},
+		{"over the limit", fmt.Sprintf("/hop/%d", SubscriptionMaxRedirects+1), false},
+		{"other scheme", "/file", false},
+	}
+
+	client := withRedirectPolicy(server.Client())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("GET %s: err = %v, want ok %v", tt.path, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWithRedirectPolicyKeepsClientPolicy(t *testing.T) {
+	server := redirectServer(t)
+	base := server.Client()
+	base.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return errors.New("client policy")
+	}
+
+	client := withRedirectPolicy(base)
+	resp, err := client.Get(server.URL + "/hop/1")
+	if err == nil {
+		resp.Body.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "client policy") {
+		t.Errorf("err = %v, want the client's own policy applied", err)
+	}
+	if base.CheckRedirect == nil || client == base {
+		t.Error("withRedirectPolicy modified the client it got")
+	}
+}
@@ -0,0 +1,92 @@
+// Package main provides size limits of subscription responses for KampusVPN.
+// A link to a huge file or a web page pasted instead of a subscription must
+// not freeze the app: the body is read up to a limit, the number of parsed
+// proxies is capped, and an HTML page is reported as such instead of as a
+// subscription without proxies.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Subscription limits
+const (
+	// DefaultMaxSubscriptionMB is the largest response body read by default.
+	DefaultMaxSubscriptionMB = 10
+	// MaxSubscriptionMBLimit is the largest body limit accepted in settings.
+	MaxSubscriptionMBLimit = 100
+	// DefaultMaxSubscriptionProxies is how many proxies are parsed by default.
+	DefaultMaxSubscriptionProxies = 500
+	// MaxSubscriptionProxiesLimit is the largest proxy cap accepted in settings.
+	MaxSubscriptionProxiesLimit = 5000
+)
+
+// SubscriptionLimits bound what is read from one subscription (0 = default).
+type SubscriptionLimits struct {
+	MaxMB      int
+	MaxProxies int
+}
+
+// maxBytes returns the body limit in bytes
+func (l SubscriptionLimits) maxBytes() int64 {
+	mb := l.MaxMB
+	if mb <= 0 {
+		mb = DefaultMaxSubscriptionMB
+	}
+	return int64(mb) * 1024 * 1024
+}
+
+// maxProxies returns the proxy cap
+func (l SubscriptionLimits) maxProxies() int {
+	if l.MaxProxies <= 0 {
+		return DefaultMaxSubscriptionProxies
+	}
+	return l.MaxProxies
+}
+
+// ValidateSubscriptionLimits checks the limits from settings (0 = default).
+func ValidateSubscriptionLimits(limits SubscriptionLimits) error {
+	if limits.MaxMB < 0 || limits.MaxMB > MaxSubscriptionMBLimit {
+		return fmt.Errorf("размер подписки должен быть от 1 до %d МБ", MaxSubscriptionMBLimit)
+	}
+	if limits.MaxProxies < 0 || limits.MaxProxies > MaxSubscriptionProxiesLimit {
+		return fmt.Errorf("число прокси должно быть от 1 до %d", MaxSubscriptionProxiesLimit)
+	}
+	return nil
+}
+
+// readSubscriptionBody reads at most limit bytes and fails if there is more
+func readSubscriptionBody(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("subscription is larger than %d MB, this doesn't look like a subscription", limit/(1024*1024))
+	}
+	return body, nil
+}
+
+// looksLikeHTML reports whether a response is a web page. Some panels send
+// subscriptions as text/html, so the body itself must look like markup too.
+func looksLikeHTML(contentType string, body []byte) bool {
+	start := bytes.TrimSpace(body)
+	if len(start) == 0 || start[0] != '<' {
+		return false
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil &&
+		(mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(start), "text/html")
+}
+
+// SubscriptionLimits returns the subscription response limits from settings.
+func (s GlobalAppSettings) SubscriptionLimits() SubscriptionLimits {
+	return SubscriptionLimits{MaxMB: s.MaxSubscriptionMB, MaxProxies: s.MaxSubscriptionProxies}
+}
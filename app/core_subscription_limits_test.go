@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadSubscriptionBody(t *testing.T) {
+	const limit = 1024
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{"empty", 0, false},
+		{"at the limit", limit, false},
+		{"one byte over", limit + 1, true},
+		{"huge", 100 * limit, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := readSubscriptionBody(bytes.NewReader(make([]byte, tt.size)), limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(body) != tt.size {
+				t.Errorf("read %d bytes, want %d", len(body), tt.size)
+			}
+		})
+	}
+}
+
+func TestLooksLikeHTML(t *testing.T) {
+	links := base64.StdEncoding.EncodeToString([]byte(testSubscriptionLinks))
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"landing page", "text/html; charset=utf-8", "<!DOCTYPE html><html><body>Login</body></html>", true},
+		{"page sent as text", "text/plain", "\n  <html><head><title>Panel</title></head></html>", true},
+		{"xhtml", "application/xhtml+xml", "<?xml version=\"1.0\"?><html></html>", true},
+		{"base64 sent as html", "text/html", links, false},
+		{"links sent as html", "text/html", testSubscriptionLinks, false},
+		{"plain links", "text/plain", testSubscriptionLinks, false},
+		{"empty", "text/html", "", false},
+		{"clash yaml", "text/yaml", "proxies:\n  - name: de\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeHTML(tt.contentType, []byte(tt.body)); got != tt.want {
+				t.Errorf("looksLikeHTML = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// utf16LE returns s with a NUL after every byte, as a UTF-16 saved ASCII file
+func utf16LE(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteByte(s[i])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+func TestFetchHostileSubscription(t *testing.T) {
+	var many []string
+	for i := 0; i < 20; i++ {
+		many = append(many, fmt.Sprintf("trojan://secret@n%d.example.com:443?security=tls#n%d", i, i))
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(testSubscriptionLinks))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		limits      SubscriptionLimits
+		proxies     int
+		errPart     string // "" = success
+	}{
+		{"oversized body", "text/plain", strings.Repeat("a", 1024*1024+1), SubscriptionLimits{MaxMB: 1}, 0, "larger than 1 MB"},
+		{"body at the limit", "text/plain", testSubscriptionLinks + strings.Repeat(" ", 1024*1024-len(testSubscriptionLinks)), SubscriptionLimits{MaxMB: 1}, 2, ""},
+		{"html page", "text/html", "<!doctype html><html><body>Войдите</body></html>", SubscriptionLimits{}, 0, "looks like a web page"},
+		{"html page without content type", "", "<html><body>404</body></html>", SubscriptionLimits{}, 0, "looks like a web page"},
+		{"base64 with embedded NULs", "text/plain", utf16LE(encoded), SubscriptionLimits{}, 2, ""},
+		{"decoded links with NULs", "text/plain", base64.StdEncoding.EncodeToString([]byte(utf16LE(testSubscriptionLinks))), SubscriptionLimits{}, 2, ""},
+		{"plain links with NULs", "text/plain", utf16LE(testSubscriptionLinks), SubscriptionLimits{}, 2, ""},
+		{"too many proxies", "text/plain", strings.Join(many, "\n"), SubscriptionLimits{MaxProxies: 5}, 5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			proxies, _, err := NewSubscriptionFetcher().Fetch(server.URL, SubscriptionRequestOptions{Limits: tt.limits})
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if len(proxies) != tt.proxies {
+				t.Fatalf("proxies = %d, want %d", len(proxies), tt.proxies)
+			}
+			for _, p := range proxies {
+				if strings.ContainsRune(p.Server+p.Password+p.Name, 0) {
+					t.Errorf("NUL left in %+v", p)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSubscriptionLimits(t *testing.T) {
+	tests := []struct {
+		limits  SubscriptionLimits
+		wantErr bool
+	}{
+		{SubscriptionLimits{}, false},
+		{SubscriptionLimits{MaxMB: MaxSubscriptionMBLimit, MaxProxies: MaxSubscriptionProxiesLimit}, false},
+		{SubscriptionLimits{MaxMB: MaxSubscriptionMBLimit + 1}, true},
+		{SubscriptionLimits{MaxMB: -1}, true},
+		{SubscriptionLimits{MaxProxies: MaxSubscriptionProxiesLimit + 1}, true},
+		{SubscriptionLimits{MaxProxies: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateSubscriptionLimits(tt.limits); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateSubscriptionLimits(%+v) = %v, wantErr %v", tt.limits, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package main provides multiple subscriptions per profile for KampusVPN.
+// Proxies of every subscription are merged into one config. The first entry
+// is the primary subscription and is mirrored to ProfileData.SubscriptionURL,
+// which older code and older settings files use.
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WarnSubscriptionFailed is the build warning code for subscriptions that couldn't be fetched
+const WarnSubscriptionFailed = "subscription_failed"
+
+// SubscriptionEntry is one subscription URL (or direct proxy link) of a profile.
+type SubscriptionEntry struct {
+	URL        string    `json:"url"`
+	Name       string    `json:"name,omitempty"`
+	AddedAt    time.Time `json:"added_at"`
+	ProxyCount int       `json:"proxy_count,omitempty"` // Proxies of the last fetch (before de-duplication)
+	LastError  string    `json:"last_error,omitempty"`  // Error of the last fetch ("" = fetched)
+}
+
+// subscriptionFetch is the outcome of fetching one subscription during a build
+type subscriptionFetch struct {
+	URL     string
+	Proxies []ProxyConfig
+	Err     error
+	Route   string // SubscriptionRouteDirect or SubscriptionRouteBootstrap
+}
+
+// migrateProfileSubscriptions converts the single subscription of older settings to a list
+func migrateProfileSubscriptions(p *ProfileData) {
+	if len(p.Subscriptions) == 0 && p.SubscriptionURL != "" {
+		p.Subscriptions = []SubscriptionEntry{{URL: p.SubscriptionURL, AddedAt: p.CreatedAt}}
+	}
+}
+
+// setPrimarySubscription replaces the primary subscription; "" removes all.
+func setPrimarySubscription(p *ProfileData, url string) {
+	migrateProfileSubscriptions(p)
+	p.SubscriptionURL = url
+	if url == "" {
+		p.Subscriptions = nil
+		return
+	}
+	if len(p.Subscriptions) > 0 && p.Subscriptions[0].URL == url {
+		return
+	}
+
+	entries := []SubscriptionEntry{{URL: url, AddedAt: time.Now()}}
+	for i, entry := range p.Subscriptions {
+		if i > 0 && entry.URL != url {
+			entries = append(entries, entry)
+		}
+	}
+	p.Subscriptions = entries
+}
+
+// subscriptionURLs returns the URLs to fetch for a build with the given primary:
+// the primary first, then the other subscriptions of the profile.
+func subscriptionURLs(primary string, entries []SubscriptionEntry) []string {
+	if primary == "" {
+		return nil
+	}
+	urls := []string{primary}
+	for i, entry := range entries {
+		// entries[0] is the old primary that primary replaces
+		if i == 0 || entry.URL == "" || containsString(urls, entry.URL) {
+			continue
+		}
+		urls = append(urls, entry.URL)
+	}
+	return urls
+}
+
+// proxyIdentity identifies the same server offered by several subscriptions:
+// server, port and credentials (uuid, or password for protocols without one).
+func proxyIdentity(p ProxyConfig) string {
+	credential := p.UUID
+	if credential == "" {
+		credential = p.Password
+	}
+	return strings.ToLower(p.Server) + ":" + strconv.Itoa(p.ServerPort) + "|" + credential
+}
+
+// mergeSubscriptionProxies joins fetched lists in order, drops duplicates and
+// assigns tags that are unique across the merged list.
+// Returns the merged proxies and the number of duplicates dropped.
+func mergeSubscriptionProxies(fetches []subscriptionFetch) ([]ProxyConfig, int) {
+	merged := []ProxyConfig{}
+	seen := map[string]bool{}
+	duplicates := 0
+	for _, fetch := range fetches {
+		for _, p := range fetch.Proxies {
+			id := proxyIdentity(p)
+			if seen[id] {
+				duplicates++
+				continue
+			}
+			seen[id] = true
+			merged = append(merged, p)
+		}
+	}
+
+	tags := map[string]bool{}
+	for i := range merged {
+		tag := generateTag(merged[i], i)
+		unique := tag
+		for n := 2; tags[unique]; n++ {
+			unique = fmt.Sprintf("%s-%d", tag, n)
+		}
+		tags[unique] = true
+		merged[i].Tag = unique
+	}
+	return merged, duplicates
+}
+
+// subscriptionFailedWarning lists subscriptions that failed while others worked
+func subscriptionFailedWarning(failed []subscriptionFetch) BuildWarning {
+	hosts := make([]string, 0, len(failed))
+	context := map[string]string{"count": strconv.Itoa(len(failed))}
+	for i, fetch := range failed {
+		host := subscriptionHost(fetch.URL)
+		if host == "" {
+			host = fetch.URL
+		}
+		hosts = append(hosts, host)
+		context[fmt.Sprintf("url_%d", i+1)] = fetch.URL
+		context[fmt.Sprintf("error_%d", i+1)] = fetch.Err.Error()
+	}
+	return NewBuildWarning(WarnSubscriptionFailed,
+		fmt.Sprintf("Не удалось загрузить подписки: %s", strings.Join(hosts, ", ")), context)
+}
+
+// --- Storage ---
+
+// AddProfileSubscription appends a subscription to a profile.
+func (s *Storage) AddProfileSubscription(id int, url, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		migrateProfileSubscriptions(p)
+		for _, entry := range p.Subscriptions {
+			if entry.URL == url {
+				return fmt.Errorf("подписка уже добавлена")
+			}
+		}
+		p.Subscriptions = append(p.Subscriptions, SubscriptionEntry{URL: url, Name: name, AddedAt: time.Now()})
+		p.SubscriptionURL = p.Subscriptions[0].URL
+		return s.saveInternal()
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// RemoveProfileSubscription removes a subscription from a profile and returns
+// the new primary URL ("" if none is left). The next entry becomes primary.
+func (s *Storage) RemoveProfileSubscription(id int, url string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		migrateProfileSubscriptions(p)
+		entries := make([]SubscriptionEntry, 0, len(p.Subscriptions))
+		for _, entry := range p.Subscriptions {
+			if entry.URL != url {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) == len(p.Subscriptions) {
+			return p.SubscriptionURL, fmt.Errorf("подписка не найдена")
+		}
+		p.Subscriptions = entries
+		p.SubscriptionURL = ""
+		if len(entries) > 0 {
+			p.SubscriptionURL = entries[0].URL
+		}
+		return p.SubscriptionURL, s.saveInternal()
+	}
+	return "", fmt.Errorf("profile with ID %d not found", id)
+}
+
+// recordSubscriptionFetches stores per-subscription results of a build
+func (s *Storage) recordSubscriptionFetches(id int, fetches []subscriptionFetch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		p := &s.data.Profiles[i]
+		if p.ID != id {
+			continue
+		}
+		for _, fetch := range fetches {
+			for j := range p.Subscriptions {
+				if p.Subscriptions[j].URL != fetch.URL {
+					continue
+				}
+				p.Subscriptions[j].ProxyCount = len(fetch.Proxies)
+				p.Subscriptions[j].LastError = ""
+				if fetch.Err != nil {
+					p.Subscriptions[j].LastError = fetch.Err.Error()
+				}
+			}
+		}
+		return s.saveInternal()
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
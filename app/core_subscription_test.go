@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSubscriptionLinks is a plain subscription with a BOM and CRLF line ends;
+// the names make standard and URL-safe base64 differ
+const testSubscriptionLinks = "\ufefftrojan://secret@de.example.com:443?security=tls&sni=de.example.com#DE>>>\r\n" +
+	"trojan://secret@nl.example.com:443?security=tls&sni=nl.example.com#NL???\r\n"
+
+func TestDecodeSubscriptionBase64(t *testing.T) {
+	payload := []byte(testSubscriptionLinks)
+	if std := base64.StdEncoding.EncodeToString(payload); !strings.ContainsAny(std, "+/") {
+		t.Fatalf("fixture encodes without + or /, URL-safe decoding is not exercised: %s", std)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"standard", base64.StdEncoding.EncodeToString(payload)},
+		{"standard unpadded", base64.RawStdEncoding.EncodeToString(payload)},
+		{"URL-safe", base64.URLEncoding.EncodeToString(payload)},
+		{"URL-safe unpadded", base64.RawURLEncoding.EncodeToString(payload)},
+		{"BOM and CRLF around", "\ufeff" + base64.StdEncoding.EncodeToString(payload) + "\r\n"},
+		{"wrapped lines", wrapLines(base64.StdEncoding.EncodeToString(payload), 76, "\r\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, ok := decodeSubscriptionBase64(tt.content)
+			if !ok {
+				t.Fatal("not decoded")
+			}
+			if string(decoded) != testSubscriptionLinks {
+				t.Errorf("decoded = %q, want %q", decoded, testSubscriptionLinks)
+			}
+		})
+	}
+}
+
+func TestDecodeSubscriptionBase64PlainText(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"   \r\n",
+		"\ufeff",
+		testSubscriptionLinks,
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@de.example.com:443",
+	} {
+		if _, ok := decodeSubscriptionBase64(content); ok {
+			t.Errorf("%q decoded as base64", content)
+		}
+	}
+}
+
+func TestNormalizeSubscriptionText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"a\r\nb\r\n", "a\nb\n"},
+		{"a\rb", "a\nb"},
+		{"\ufeffa\nb", "a\nb"},
+		{"a\n\r\nb", "a\n\nb"},
+		{"a\nb", "a\nb"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeSubscriptionText(tt.text); got != tt.want {
+			t.Errorf("normalizeSubscriptionText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFirstNonEmptyLine(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"\n  \n proxies:\nfoo", "proxies:"},
+		{"single", "single"},
+		{"\n \n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := firstNonEmptyLine(tt.text); got != tt.want {
+			t.Errorf("firstNonEmptyLine(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseSubscriptionEncodings(t *testing.T) {
+	f := NewSubscriptionFetcher()
+	payload := []byte(testSubscriptionLinks)
+
+	for name, content := range map[string]string{
+		"plain":             testSubscriptionLinks,
+		"standard":          base64.StdEncoding.EncodeToString(payload),
+		"URL-safe unpadded": base64.RawURLEncoding.EncodeToString(payload),
+		"BOM before base64": "\ufeff" + base64.StdEncoding.EncodeToString(payload),
+	} {
+		t.Run(name, func(t *testing.T) {
+			proxies, err := f.ParseSubscription(content)
+			if err != nil {
+				t.Fatalf("ParseSubscription: %v", err)
+			}
+			if len(proxies) != 2 {
+				t.Fatalf("got %d proxies, want 2", len(proxies))
+			}
+			if proxies[0].Server != "de.example.com" || proxies[1].Server != "nl.example.com" {
+				t.Errorf("servers = %s, %s", proxies[0].Server, proxies[1].Server)
+			}
+		})
+	}
+}
+
+func TestParseSubscriptionDecodedWithoutLinks(t *testing.T) {
+	content := base64.StdEncoding.EncodeToString([]byte("\r\nproxies:\r\n  - name: de\r\n"))
+	_, err := NewSubscriptionFetcher().ParseSubscription(content)
+	if err == nil || !strings.Contains(err.Error(), "proxies:") {
+		t.Errorf("err = %v, want the first decoded line quoted", err)
+	}
+}
+
+// wrapLines splits s into lines of width joined by sep
+func wrapLines(s string, width int, sep string) string {
+	var lines []string
+	for len(s) > width {
+		lines = append(lines, s[:width])
+		s = s[width:]
+	}
+	return strings.Join(append(lines, s), sep)
+}
+
+func TestShadowsocksIPv6Outbound(t *testing.T) {
+	userInfo := base64.RawURLEncoding.EncodeToString([]byte("chacha20-ietf-poly1305:s3cret"))
+	legacy := func(hostPort string) string {
+		return "ss://" + base64.StdEncoding.EncodeToString([]byte("chacha20-ietf-poly1305:s3cret@"+hostPort)) + "#legacy"
+	}
+	const outbound = `{"type":"shadowsocks","server":"2001:db8::1","server_port":8388,"method":"chacha20-ietf-poly1305","password":"s3cret"}`
+
+	runLinkOutboundCases(t, []linkOutboundCase{
+		{name: "SIP002 IPv6", link: "ss://" + userInfo + "@[2001:db8::1]:8388#v6", outbound: outbound},
+		{name: "SIP002 IPv6 with plugin", link: "ss://" + userInfo + "@[2001:db8::1]:8388/?plugin=obfs-local%3Bobfs%3Dhttp#v6",
+			outbound: `{"type":"shadowsocks","server":"2001:db8::1","server_port":8388,"method":"chacha20-ietf-poly1305","password":"s3cret","plugin":"obfs-local","plugin_opts":"obfs=http"}`},
+		{name: "legacy IPv6", link: legacy("[2001:db8::1]:8388"), outbound: outbound},
+		{name: "SIP002 IPv4", link: "ss://" + userInfo + "@203.0.113.7:8388#v4",
+			outbound: `{"type":"shadowsocks","server":"203.0.113.7","server_port":8388,"method":"chacha20-ietf-poly1305","password":"s3cret"}`},
+		{name: "vless IPv6", link: "vless://b831381d-6324-4d53-ad4f-8cda48b30811@[2001:db8::2]:443?security=tls&sni=v.example.com",
+			outbound: `{"type":"vless","server":"2001:db8::2","server_port":443,"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811","tls":{"enabled":true,"server_name":"v.example.com"}}`},
+	})
+
+	for _, hostPort := range []string{"2001:db8::1:8388", "[2001:db8::1]", "[2001:db8::1]:0", "[2001:db8::1]:port"} {
+		if _, err := NewSubscriptionFetcher().ParseSingleLink("ss://" + userInfo + "@" + hostPort); err == nil {
+			t.Errorf("%s accepted", hostPort)
+		}
+	}
+}
+
+// linkOutboundCase is a link and the outbound sing-box gets from it
+type linkOutboundCase struct {
+	name     string
+	link     string
+	outbound string // JSON without the tag
+	warnings []string
+}
+
+// runLinkOutboundCases parses each link and compares the outbound JSON
+func runLinkOutboundCases(t *testing.T, tests []linkOutboundCase) {
+	t.Helper()
+	f := NewSubscriptionFetcher()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := f.ParseSingleLink(tt.link)
+			if err != nil {
+				t.Fatalf("ParseSingleLink: %v", err)
+			}
+			if len(cfg.ParseWarnings) != len(tt.warnings) {
+				t.Fatalf("warnings = %q, want %q", cfg.ParseWarnings, tt.warnings)
+			}
+			for i, part := range tt.warnings {
+				if !strings.Contains(cfg.ParseWarnings[i], part) {
+					t.Errorf("warning = %q, want %q", cfg.ParseWarnings[i], part)
+				}
+			}
+
+			outbound := cfg.ToSingboxOutbound()
+			delete(outbound, "tag")
+			data, err := json.Marshal(outbound)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			json.Unmarshal(data, &got)
+			if err := json.Unmarshal([]byte(tt.outbound), &want); err != nil {
+				t.Fatalf("bad expected JSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("outbound:\n got %s\nwant %s", data, tt.outbound)
+			}
+		})
+	}
+}
+
+func TestHysteria2LinkOutbound(t *testing.T) {
+	runLinkOutboundCases(t, []linkOutboundCase{
+		{
+			name: "full",
+			link: "hysteria2://pa55@hy.example.com:443/?sni=cdn.example.com&alpn=h3,h2&insecure=1&obfs=salamander&obfs-password=0bfsPass&up=50&down=200#HY",
+			outbound: `{"type":"hysteria2","server":"hy.example.com","server_port":443,"password":"pa55",
+				"tls":{"enabled":true,"server_name":"cdn.example.com","insecure":true,"alpn":["h3","h2"]},
+				"obfs":{"type":"salamander","password":"0bfsPass"},"up_mbps":50,"down_mbps":200}`,
+		},
+		{
+			name: "port hopping",
+			link: "hy2://pa55@hy.example.com:443,20000-30000?hop_interval=30#HY",
+			outbound: `{"type":"hysteria2","server":"hy.example.com","server_port":443,"password":"pa55",
+				"tls":{"enabled":true,"server_name":"hy.example.com"},
+				"server_ports":["443:443","20000:30000"],"hop_interval":"30s"}`,
+		},
+		{
+			name: "salamander without password",
+			link: "hy2://pa55@hy.example.com:443?obfs=salamander",
+			outbound: `{"type":"hysteria2","server":"hy.example.com","server_port":443,"password":"pa55",
+				"tls":{"enabled":true,"server_name":"hy.example.com"}}`,
+			warnings: []string{"without obfs-password"},
+		},
+		{
+			name: "unsupported obfs",
+			link: "hy2://pa55@hy.example.com:443?obfs=gfw&obfs-password=x",
+			outbound: `{"type":"hysteria2","server":"hy.example.com","server_port":443,"password":"pa55",
+				"tls":{"enabled":true,"server_name":"hy.example.com"}}`,
+			warnings: []string{`unsupported obfs "gfw"`},
+		},
+	})
+}
+
+func TestTUICLinkOutbound(t *testing.T) {
+	runLinkOutboundCases(t, []linkOutboundCase{
+		{
+			name: "full",
+			link: "tuic://b831381d-6324-4d53-ad4f-8cda48b30811:pw@tu.example.com:8443?sni=cdn.example.com&alpn=h3%2Ch3-29&congestion_control=bbr&udp_relay_mode=quic&heartbeat=10&zero_rtt_handshake=1#TU",
+			outbound: `{"type":"tuic","server":"tu.example.com","server_port":8443,
+				"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811","password":"pw",
+				"congestion_control":"bbr","udp_relay_mode":"quic","heartbeat":"10s","zero_rtt_handshake":true,
+				"tls":{"enabled":true,"server_name":"cdn.example.com","alpn":["h3","h3-29"]}}`,
+		},
+		{
+			name: "defaults",
+			link: "tuic://b831381d-6324-4d53-ad4f-8cda48b30811:pw@tu.example.com:8443?heartbeat=15s&reduce_rtt=true",
+			outbound: `{"type":"tuic","server":"tu.example.com","server_port":8443,
+				"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811","password":"pw",
+				"congestion_control":"cubic","udp_relay_mode":"native","heartbeat":"15s","zero_rtt_handshake":true,
+				"tls":{"enabled":true,"server_name":"tu.example.com"}}`,
+		},
+		{
+			name: "invalid heartbeat",
+			link: "tuic://b831381d-6324-4d53-ad4f-8cda48b30811:pw@tu.example.com:8443?heartbeat=soon",
+			outbound: `{"type":"tuic","server":"tu.example.com","server_port":8443,
+				"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811","password":"pw",
+				"congestion_control":"cubic","udp_relay_mode":"native",
+				"tls":{"enabled":true,"server_name":"tu.example.com"}}`,
+			warnings: []string{`invalid heartbeat "soon"`},
+		},
+	})
+}
+
+func TestALPNLinkOutbound(t *testing.T) {
+	runLinkOutboundCases(t, []linkOutboundCase{
+		{
+			name: "trojan",
+			link: "trojan://pw@t.example.com:443?sni=t.example.com&alpn=h2,http/1.1#T",
+			outbound: `{"type":"trojan","server":"t.example.com","server_port":443,"password":"pw",
+				"tls":{"enabled":true,"server_name":"t.example.com","alpn":["h2","http/1.1"]}}`,
+		},
+		{
+			name: "vless",
+			link: "vless://b831381d-6324-4d53-ad4f-8cda48b30811@v.example.com:443?security=tls&sni=v.example.com&alpn=h2&type=tcp#V",
+			outbound: `{"type":"vless","server":"v.example.com","server_port":443,"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811",
+				"tls":{"enabled":true,"server_name":"v.example.com","alpn":["h2"]}}`,
+		},
+		{
+			name: "empty alpn entries",
+			link: "trojan://pw@t.example.com:443?alpn=,h2,,#T",
+			outbound: `{"type":"trojan","server":"t.example.com","server_port":443,"password":"pw",
+				"tls":{"enabled":true,"alpn":["h2"]}}`,
+		},
+	})
+}
+
+func TestVLESSTransportOutbound(t *testing.T) {
+	const base = "vless://b831381d-6324-4d53-ad4f-8cda48b30811@v.example.com:443?security=tls&sni=v.example.com"
+	const head = `"type":"vless","server":"v.example.com","server_port":443,"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811",
+		"tls":{"enabled":true,"server_name":"v.example.com"}`
+
+	runLinkOutboundCases(t, []linkOutboundCase{
+		{name: "tcp", link: base + "&type=tcp", outbound: `{` + head + `}`},
+		{name: "no type", link: base, outbound: `{` + head + `}`},
+		{
+			name:     "ws",
+			link:     base + "&type=ws&path=%2Fws%3Fed%3D2048&host=cdn.example.com",
+			outbound: `{` + head + `,"transport":{"type":"ws","path":"/ws?ed=2048","headers":{"Host":"cdn.example.com"}}}`,
+		},
+		{
+			name:     "grpc serviceName",
+			link:     base + "&type=grpc&serviceName=tunnel&mode=gun",
+			outbound: `{` + head + `,"transport":{"type":"grpc","service_name":"tunnel"}}`,
+		},
+		{
+			name:     "grpc path",
+			link:     base + "&type=grpc&path=tunnel",
+			outbound: `{` + head + `,"transport":{"type":"grpc","service_name":"tunnel"}}`,
+		},
+		{
+			name:     "http",
+			link:     base + "&type=http&path=%2Fh2&host=cdn.example.com",
+			outbound: `{` + head + `,"transport":{"type":"http","path":"/h2","host":["cdn.example.com"]}}`,
+		},
+		{
+			name:     "httpupgrade",
+			link:     base + "&type=httpupgrade&path=%2Fup&host=cdn.example.com",
+			outbound: `{` + head + `,"transport":{"type":"httpupgrade","path":"/up","host":"cdn.example.com"}}`,
+		},
+		{
+			name:     "httpupgrade without host",
+			link:     base + "&type=httpupgrade",
+			outbound: `{` + head + `,"transport":{"type":"httpupgrade"}}`,
+		},
+		{
+			name:     "mux",
+			link:     base + "&type=httpupgrade&path=%2Fup&mux=1&mux_protocol=h2mux&mux_max_streams=8",
+			outbound: `{` + head + `,"transport":{"type":"httpupgrade","path":"/up"},"multiplex":{"enabled":true,"protocol":"h2mux","max_streams":8}}`,
+		},
+		{
+			name:     "mux with unknown protocol",
+			link:     base + "&mux=true&mux_protocol=quic&mux_max_streams=-1",
+			outbound: `{` + head + `,"multiplex":{"enabled":true,"protocol":"smux"}}`,
+		},
+		{
+			// XTLS flows break inside a mux stream
+			name:     "mux with flow",
+			link:     base + "&flow=xtls-rprx-vision&mux=1",
+			outbound: `{` + head + `,"flow":"xtls-rprx-vision"}`,
+		},
+		{
+			name:     "trojan httpupgrade",
+			link:     "trojan://pw@t.example.com:443?sni=t.example.com&type=httpupgrade&path=%2Fup&mux=1",
+			outbound: `{"type":"trojan","server":"t.example.com","server_port":443,"password":"pw","tls":{"enabled":true,"server_name":"t.example.com"},"transport":{"type":"httpupgrade","path":"/up"},"multiplex":{"enabled":true,"protocol":"smux"}}`,
+		},
+	})
+}
+
+func TestApplyDefaultMultiplex(t *testing.T) {
+	global := MultiplexSettings{Enabled: true, Protocol: "yamux", MaxStreams: 4}
+
+	tests := []struct {
+		name     string
+		proxy    ProxyConfig
+		settings MultiplexSettings
+		want     map[string]interface{}
+	}{
+		{"global default", ProxyConfig{Type: "vless"}, global, map[string]interface{}{"enabled": true, "protocol": "yamux", "max_streams": 4}},
+		{"disabled globally", ProxyConfig{Type: "vless"}, MultiplexSettings{}, nil},
+		{"link wins", ProxyConfig{Type: "trojan", Mux: true, MuxProtocol: "h2mux"}, global, map[string]interface{}{"enabled": true, "protocol": "h2mux"}},
+		{"unsupported protocol", ProxyConfig{Type: "hysteria2"}, global, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.proxy
+			applyDefaultMultiplex(&p, tt.settings)
+			if got := buildMultiplex(&p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("multiplex = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
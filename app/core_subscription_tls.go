@@ -0,0 +1,134 @@
+// Package main provides TLS error classification for subscription fetches in KampusVPN.
+// Self-hosted panels often run with expired or self-signed certificates; the raw
+// x509 error is turned into a reason the user can act on.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Subscription TLS error reasons
+const (
+	TLSReasonExpired          = "expired"
+	TLSReasonHostnameMismatch = "hostname_mismatch"
+	TLSReasonUnknownAuthority = "unknown_authority"
+	TLSReasonLegacyVersion    = "legacy_version"
+	TLSReasonOther            = "other"
+)
+
+// InsecureSubscriptionWarning is returned with every response that involves
+// a subscription fetched without certificate verification.
+const InsecureSubscriptionWarning = "Проверка сертификата сервера подписки отключена. " +
+	"Содержимое подписки может быть подменено злоумышленником в сети"
+
+// SubscriptionTLSError is a classified certificate/handshake error of a subscription fetch.
+type SubscriptionTLSError struct {
+	Host    string `json:"host"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *SubscriptionTLSError) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Message, e.Host)
+}
+
+func (e *SubscriptionTLSError) Unwrap() error {
+	return e.Err
+}
+
+// CanSkipVerify reports whether disabling verification can help.
+// Legacy protocol versions are not fixed by skipping the certificate check.
+func (e *SubscriptionTLSError) CanSkipVerify() bool {
+	return e.Reason != TLSReasonLegacyVersion
+}
+
+// ToMap converts the error to API response format.
+func (e *SubscriptionTLSError) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"host":            e.Host,
+		"reason":          e.Reason,
+		"message":         e.Message,
+		"can_skip_verify": e.CanSkipVerify(),
+	}
+}
+
+// classifyTLSError returns SubscriptionTLSError if err is a TLS error, nil otherwise.
+func classifyTLSError(host string, err error) *SubscriptionTLSError {
+	if err == nil {
+		return nil
+	}
+
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var verifyErr *tls.CertificateVerificationError
+
+	result := &SubscriptionTLSError{Host: host, Err: err}
+	switch {
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		result.Reason = TLSReasonExpired
+		result.Message = "Срок действия сертификата сервера подписки истёк или ещё не наступил"
+	case errors.As(err, &hostnameErr):
+		result.Reason = TLSReasonHostnameMismatch
+		result.Message = "Сертификат сервера подписки выдан для другого домена"
+	case errors.As(err, &authorityErr):
+		result.Reason = TLSReasonUnknownAuthority
+		result.Message = "Сертификат сервера подписки самоподписанный или выдан неизвестным центром сертификации"
+	case strings.Contains(err.Error(), "protocol version not supported") ||
+		strings.Contains(err.Error(), "no supported versions"):
+		result.Reason = TLSReasonLegacyVersion
+		result.Message = "Сервер подписки использует устаревшую версию TLS"
+	case errors.As(err, &verifyErr) || errors.As(err, &invalidErr):
+		result.Reason = TLSReasonOther
+		result.Message = "Сертификат сервера подписки не прошёл проверку"
+	default:
+		return nil
+	}
+	return result
+}
+
+// asSubscriptionTLSError extracts SubscriptionTLSError from err.
+func asSubscriptionTLSError(err error) (*SubscriptionTLSError, bool) {
+	var tlsErr *SubscriptionTLSError
+	if errors.As(err, &tlsErr) {
+		return tlsErr, true
+	}
+	return nil, false
+}
+
+// newInsecureSubscriptionClient returns a client that skips certificate
+// verification for host only: redirects to any other host are refused.
+func newInsecureSubscriptionClient(host string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	return &http.Client{
+		Timeout:   DefaultHTTPTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !strings.EqualFold(req.URL.Hostname(), host) {
+				return fmt.Errorf("redirect to %s refused: certificate verification is disabled only for %s", req.URL.Hostname(), host)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// subscriptionHost returns the host part of a subscription URL.
+func subscriptionHost(subscriptionURL string) string {
+	u, err := url.Parse(subscriptionURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
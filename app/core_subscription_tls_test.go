@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCertificate signs template with parent (self-signed when parent is nil)
+func testCertificate(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert, key
+}
+
+// leafTemplate returns a server certificate template for 127.0.0.1
+func leafTemplate(serial int64, notBefore, notAfter time.Time, dnsName string) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "panel"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if dnsName != "" {
+		template.DNSNames = []string{dnsName}
+	} else {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	return template
+}
+
+// startTLSPanel starts a subscription panel serving cert
+func startTLSPanel(t *testing.T, cert tls.Certificate, maxVersion uint16) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testDirectLink))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: maxVersion}
+	// Failed handshakes are the point of these tests
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClassifyTLSError(t *testing.T) {
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	_, ca, caKey := testCertificate(t, caTemplate, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	valid, _, _ := testCertificate(t, leafTemplate(2, now.Add(-time.Hour), now.Add(time.Hour), ""), ca, caKey)
+	expired, _, _ := testCertificate(t, leafTemplate(3, now.Add(-48*time.Hour), now.Add(-24*time.Hour), ""), ca, caKey)
+	wrongHost, _, _ := testCertificate(t, leafTemplate(4, now.Add(-time.Hour), now.Add(time.Hour), "panel.example.com"), ca, caKey)
+	selfSigned, _, _ := testCertificate(t, leafTemplate(5, now.Add(-time.Hour), now.Add(time.Hour), ""), nil, nil)
+
+	tests := []struct {
+		name       string
+		cert       tls.Certificate
+		maxVersion uint16
+		reason     string // "" = no TLS error
+		canSkip    bool
+	}{
+		{"valid", valid, 0, "", false},
+		{"expired", expired, 0, TLSReasonExpired, true},
+		{"wrong SAN", wrongHost, 0, TLSReasonHostnameMismatch, true},
+		{"self-signed", selfSigned, 0, TLSReasonUnknownAuthority, true},
+		{"legacy version", valid, tls.VersionTLS10, TLSReasonLegacyVersion, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startTLSPanel(t, tt.cert, tt.maxVersion)
+			client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+			}}
+			_, err := client.Get(server.URL)
+
+			got := classifyTLSError("127.0.0.1", err)
+			if tt.reason == "" {
+				if err != nil || got != nil {
+					t.Fatalf("err = %v, classified = %+v", err, got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("%v not classified", err)
+			}
+			if got.Reason != tt.reason || got.Host != "127.0.0.1" || got.Message == "" {
+				t.Errorf("classified = %+v, want reason %q", got, tt.reason)
+			}
+			if got.CanSkipVerify() != tt.canSkip {
+				t.Errorf("CanSkipVerify = %v, want %v", got.CanSkipVerify(), tt.canSkip)
+			}
+			if !errors.Is(got, err) {
+				t.Error("classified error doesn't wrap the original")
+			}
+		})
+	}
+
+	if got := classifyTLSError("example.com", errors.New("connection refused")); got != nil {
+		t.Errorf("network error classified as %+v", got)
+	}
+	other := classifyTLSError("example.com", x509.CertificateInvalidError{Reason: x509.CANotAuthorizedForThisName})
+	if other == nil || other.Reason != TLSReasonOther {
+		t.Errorf("other certificate error = %+v", other)
+	}
+}
+
+func TestFetchSelfSignedSubscription(t *testing.T) {
+	now := time.Now()
+	cert, _, _ := testCertificate(t, leafTemplate(1, now.Add(-time.Hour), now.Add(time.Hour), ""), nil, nil)
+	server := startTLSPanel(t, cert, 0)
+
+	fetcher := &SubscriptionFetcher{client: &http.Client{Timeout: 5 * time.Second}}
+	_, err := fetcher.FetchAndParse(server.URL)
+	tlsErr, ok := asSubscriptionTLSError(err)
+	if !ok || tlsErr.Reason != TLSReasonUnknownAuthority {
+		t.Fatalf("FetchAndParse error = %v, want an unknown authority TLS error", err)
+	}
+
+	// Verification is skipped only after consent and only for the subscription host
+	proxies, err := fetcher.FetchAndParseInsecure(server.URL)
+	if err != nil || len(proxies) != 1 {
+		t.Fatalf("FetchAndParseInsecure = %v, %v", proxies, err)
+	}
+	client := newInsecureSubscriptionClient("127.0.0.1")
+	redirect, _ := http.NewRequest(http.MethodGet, "https://evil.example.com/sub", nil)
+	if err := client.CheckRedirect(redirect, nil); err == nil {
+		t.Error("redirect to another host allowed without verification")
+	}
+	same, _ := http.NewRequest(http.MethodGet, "https://127.0.0.1/sub2", nil)
+	if err := client.CheckRedirect(same, nil); err != nil {
+		t.Errorf("redirect on the same host refused: %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+// Package main provides per-outbound and per-domain traffic statistics for KampusVPN.
+// While VPN is running, the Clash API connection list is polled and byte
+// counter deltas are added to daily rollups keyed by date, so several VPN
+// sessions of one day add up to the same rollup.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrafficBreakdownFile stores daily rollups next to traffic_stats.json
+const TrafficBreakdownFile = "traffic_breakdown.json"
+
+// Traffic breakdown settings
+const (
+	TrafficPollInterval       = 5 * time.Second // Clash API /connections polling
+	TrafficSaveInterval       = time.Minute     // Rollups are written at most this often while polling
+	TrafficBreakdownKeepDays  = 90              // Older daily rollups are dropped
+	TrafficDomainsPerDay      = 200             // Domains kept per day (largest first)
+	DefaultTrafficTopDomains  = 20              // Domains returned by GetTrafficBreakdown
+	trafficBreakdownDayFormat = "2006-01-02"
+)
+
+// Traffic breakdown periods
+const (
+	TrafficPeriodToday = "today"
+	TrafficPeriodWeek  = "week"  // Last 7 days including today
+	TrafficPeriodMonth = "month" // Last 30 days including today
+	TrafficPeriodAll   = "all"
+)
+
+// TrafficCounter is uploaded and downloaded bytes of one outbound or domain
+type TrafficCounter struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+}
+
+// Total returns upload plus download
+func (c TrafficCounter) Total() int64 {
+	return c.Upload + c.Download
+}
+
+// TrafficDay is the rollup of one day
+type TrafficDay struct {
+	Outbounds map[string]*TrafficCounter `json:"outbounds"`
+	Domains   map[string]*TrafficCounter `json:"domains"`
+}
+
+// TrafficBreakdownItem is one row of GetTrafficBreakdown
+type TrafficBreakdownItem struct {
+	Name     string `json:"name"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+	Total    int64  `json:"total"`
+}
+
+// clashConnection is one entry of the Clash API /connections list
+type clashConnection struct {
+	ID          string    `json:"id"`
+	Upload      int64     `json:"upload"`
+	Download    int64     `json:"download"`
+	Start       time.Time `json:"start"`
+	Chains      []string  `json:"chains"` // Final outbound first, then the groups that chose it
+	Rule        string    `json:"rule"`
+	RulePayload string    `json:"rulePayload"`
+	Metadata    struct {
+		Network         string `json:"network"`
+		Type            string `json:"type"` // Inbound that accepted the connection
+		SourceIP        string `json:"sourceIP"`
+		SourcePort      string `json:"sourcePort"`
+		Host            string `json:"host"`
+		DestinationIP   string `json:"destinationIP"`
+		DestinationPort string `json:"destinationPort"`
+		ProcessPath     string `json:"processPath"`
+	} `json:"metadata"`
+}
+
+// connectionOutbound returns the outbound that carried a connection
+func (c clashConnection) connectionOutbound() string {
+	if len(c.Chains) > 0 {
+		return c.Chains[0]
+	}
+	return "unknown"
+}
+
+// connectionDomain returns the sniffed host, or the destination IP without one
+func (c clashConnection) connectionDomain() string {
+	if c.Metadata.Host != "" {
+		return c.Metadata.Host
+	}
+	return c.Metadata.DestinationIP
+}
+
+// TrafficBreakdown keeps daily per-outbound and per-domain rollups.
+type TrafficBreakdown struct {
+	Days map[string]*TrafficDay `json:"days"`
+
+	path     string
+	seen     map[string]TrafficCounter // Counters of open connections at the last poll
+	lastSave time.Time
+	client   *http.Client
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// LoadTrafficBreakdown loads rollups from path; a missing or damaged file starts empty.
+func LoadTrafficBreakdown(path string) *TrafficBreakdown {
+	b := &TrafficBreakdown{
+		Days:   map[string]*TrafficDay{},
+		path:   path,
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		var stored TrafficBreakdown
+		if json.Unmarshal(data, &stored) == nil && stored.Days != nil {
+			b.Days = stored.Days
+		}
+	}
+	return b
+}
+
+// StartPolling polls the Clash API until StopPolling; a no-op if already polling.
+func (b *TrafficBreakdown) StartPolling() {
+	b.mu.Lock()
+	if b.stop != nil {
+		b.mu.Unlock()
+		return
+	}
+	b.stop = make(chan struct{})
+	b.seen = map[string]TrafficCounter{} // Counters of a new sing-box start from zero
+	stop := b.stop
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go b.pollLoop(stop)
+}
+
+// StopPolling stops polling, waits for the poll loop and saves the rollups.
+func (b *TrafficBreakdown) StopPolling() {
+	b.mu.Lock()
+	if b.stop == nil {
+		b.mu.Unlock()
+		return
+	}
+	close(b.stop)
+	b.stop = nil
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	b.Save()
+}
+
+// pollLoop polls connections every TrafficPollInterval
+func (b *TrafficBreakdown) pollLoop(stop chan struct{}) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(TrafficPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			var resp struct {
+				Connections []clashConnection `json:"connections"`
+			}
+			if err := clashGetJSON(b.client, "/connections", &resp); err != nil {
+				continue // sing-box is starting or already gone
+			}
+			b.record(resp.Connections, time.Now())
+			if b.shouldSave() {
+				b.Save()
+			}
+		}
+	}
+}
+
+// record adds counter deltas since the last poll to the rollup of now's day.
+// Bytes a connection transferred between its last poll and closing are lost.
+func (b *TrafficBreakdown) record(connections []clashConnection, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	day := b.day(now.Format(trafficBreakdownDayFormat))
+	seen := make(map[string]TrafficCounter, len(connections))
+	for _, conn := range connections {
+		prev := b.seen[conn.ID]
+		delta := TrafficCounter{Upload: conn.Upload - prev.Upload, Download: conn.Download - prev.Download}
+		seen[conn.ID] = TrafficCounter{Upload: conn.Upload, Download: conn.Download}
+		if delta.Upload < 0 || delta.Download < 0 || delta.Total() == 0 {
+			continue
+		}
+		addTraffic(day.Outbounds, conn.connectionOutbound(), delta)
+		if domain := conn.connectionDomain(); domain != "" {
+			addTraffic(day.Domains, domain, delta)
+		}
+	}
+	b.seen = seen
+}
+
+// day returns the rollup of a date, creating it. Must be called with b.mu held.
+func (b *TrafficBreakdown) day(date string) *TrafficDay {
+	day, ok := b.Days[date]
+	if !ok {
+		day = &TrafficDay{}
+		b.Days[date] = day
+	}
+	if day.Outbounds == nil {
+		day.Outbounds = map[string]*TrafficCounter{}
+	}
+	if day.Domains == nil {
+		day.Domains = map[string]*TrafficCounter{}
+	}
+	return day
+}
+
+// addTraffic adds delta to the counter of name
+func addTraffic(counters map[string]*TrafficCounter, name string, delta TrafficCounter) {
+	counter, ok := counters[name]
+	if !ok {
+		counter = &TrafficCounter{}
+		counters[name] = counter
+	}
+	counter.Upload += delta.Upload
+	counter.Download += delta.Download
+}
+
+// shouldSave reports whether TrafficSaveInterval passed since the last save
+func (b *TrafficBreakdown) shouldSave() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Since(b.lastSave) >= TrafficSaveInterval
+}
+
+// Save trims old days and small domains and writes the rollups.
+func (b *TrafficBreakdown) Save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cutoff := time.Now().AddDate(0, 0, -TrafficBreakdownKeepDays).Format(trafficBreakdownDayFormat)
+	for date, day := range b.Days {
+		if date < cutoff {
+			delete(b.Days, date)
+			continue
+		}
+		if len(day.Domains) > TrafficDomainsPerDay {
+			kept := map[string]*TrafficCounter{}
+			for _, item := range topTraffic(day.Domains, TrafficDomainsPerDay) {
+				kept[item.Name] = day.Domains[item.Name]
+			}
+			day.Domains = kept
+		}
+	}
+
+	b.lastSave = time.Now()
+	if b.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0644)
+}
+
+// topTraffic returns counters sorted by total bytes, at most limit (0 = all)
+func topTraffic(counters map[string]*TrafficCounter, limit int) []TrafficBreakdownItem {
+	items := make([]TrafficBreakdownItem, 0, len(counters))
+	for name, c := range counters {
+		items = append(items, TrafficBreakdownItem{Name: name, Upload: c.Upload, Download: c.Download, Total: c.Total()})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Total != items[j].Total {
+			return items[i].Total > items[j].Total
+		}
+		return items[i].Name < items[j].Name
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// trafficPeriodStart returns the first day of a period ("" = every stored day)
+func trafficPeriodStart(period string, now time.Time) (string, error) {
+	switch period {
+	case TrafficPeriodToday, "":
+		return now.Format(trafficBreakdownDayFormat), nil
+	case TrafficPeriodWeek:
+		return now.AddDate(0, 0, -6).Format(trafficBreakdownDayFormat), nil
+	case TrafficPeriodMonth:
+		return now.AddDate(0, 0, -29).Format(trafficBreakdownDayFormat), nil
+	case TrafficPeriodAll:
+		return "", nil
+	default:
+		return "", fmt.Errorf("неизвестный период: %s", period)
+	}
+}
+
+// Breakdown sums the rollups of a period.
+// Returns all outbounds and the topDomains largest domains.
+func (b *TrafficBreakdown) Breakdown(period string, topDomains int) ([]TrafficBreakdownItem, []TrafficBreakdownItem, error) {
+	start, err := trafficPeriodStart(period, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	outbounds := map[string]*TrafficCounter{}
+	domains := map[string]*TrafficCounter{}
+	for date, day := range b.Days {
+		if date < start {
+			continue
+		}
+		for name, c := range day.Outbounds {
+			addTraffic(outbounds, name, *c)
+		}
+		for name, c := range day.Domains {
+			addTraffic(domains, name, *c)
+		}
+	}
+	return topTraffic(outbounds, 0), topTraffic(domains, topDomains), nil
+}
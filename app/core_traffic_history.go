@@ -0,0 +1,249 @@
+// Package main provides per-profile daily traffic history for KampusVPN.
+// Each VPN session is attributed to the profile it was started with and added
+// to daily buckets (date, profile): bytes, session count and time connected.
+// A session running over midnight is split between the two days in proportion
+// to the time spent on each. Buckets older than the retention are pruned.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Traffic history storage
+const (
+	// TrafficHistoryDir is the folder in resources/ with the history file.
+	TrafficHistoryDir = "stats"
+	// TrafficHistoryFile stores the daily buckets.
+	TrafficHistoryFile = "traffic_history.json"
+	// DefaultTrafficHistoryMonths is how long buckets are kept by default.
+	DefaultTrafficHistoryMonths = 12
+	// MaxTrafficHistoryMonths is the longest retention accepted.
+	MaxTrafficHistoryMonths = 120
+	// trafficHistoryDayFormat is the bucket date format (local time).
+	trafficHistoryDayFormat = "2006-01-02"
+)
+
+// TrafficHistoryEntry is the traffic of one profile on one day.
+type TrafficHistoryEntry struct {
+	Date        string        `json:"date"` // YYYY-MM-DD, local time
+	ProfileID   int           `json:"profile_id"`
+	ProfileName string        `json:"profile_name,omitempty"` // Latest name the profile had
+	Uploaded    int64         `json:"uploaded"`
+	Downloaded  int64         `json:"downloaded"`
+	Sessions    int           `json:"sessions"` // Sessions started on this day
+	Duration    time.Duration `json:"duration"`
+}
+
+// TrafficHistory keeps the daily buckets of all profiles.
+type TrafficHistory struct {
+	Entries []*TrafficHistoryEntry `json:"entries"`
+
+	path       string
+	keepMonths int // Retention in months (0 = DefaultTrafficHistoryMonths)
+	lastSave   time.Time
+	mu         sync.Mutex
+}
+
+// trafficHistoryPath returns the history file next to traffic_stats.json
+func trafficHistoryPath(statsPath string) string {
+	return filepath.Join(filepath.Dir(statsPath), TrafficHistoryDir, TrafficHistoryFile)
+}
+
+// LoadTrafficHistory loads the buckets from path. Without a history file it
+// is rebuilt from the connection history, so totals of earlier sessions
+// aren't lost on the first run.
+func LoadTrafficHistory(path, sessionHistoryPath string) *TrafficHistory {
+	h := &TrafficHistory{path: path}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var stored TrafficHistory
+		if json.Unmarshal(data, &stored) == nil {
+			h.Entries = stored.Entries
+		}
+		return h
+	}
+
+	if sessionHistoryPath != "" {
+		forEachSession(sessionHistoryPath, func(record SessionRecord) error {
+			h.addSession(record.Start, record.ProfileID, record.ProfileName)
+			h.addInterval(record.ProfileID, record.ProfileName, record.Start, record.End, record.Uploaded, record.Downloaded)
+			return nil
+		})
+	}
+	return h
+}
+
+// SetRetentionMonths sets how many months of buckets are kept (0 = default).
+func (h *TrafficHistory) SetRetentionMonths(months int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.keepMonths = months
+}
+
+// ValidateTrafficHistoryMonths checks the retention setting (0 = default).
+func ValidateTrafficHistoryMonths(months int) error {
+	if months < 0 || months > MaxTrafficHistoryMonths {
+		return fmt.Errorf("срок хранения должен быть от 1 до %d месяцев", MaxTrafficHistoryMonths)
+	}
+	return nil
+}
+
+// entry returns the bucket of a profile on a date, creating it. Must be called with h.mu held.
+func (h *TrafficHistory) entry(date string, profileID int, profileName string) *TrafficHistoryEntry {
+	// Recent buckets are at the end
+	for i := len(h.Entries) - 1; i >= 0; i-- {
+		e := h.Entries[i]
+		if e.Date == date && e.ProfileID == profileID {
+			if profileName != "" {
+				e.ProfileName = profileName
+			}
+			return e
+		}
+	}
+	e := &TrafficHistoryEntry{Date: date, ProfileID: profileID, ProfileName: profileName}
+	h.Entries = append(h.Entries, e)
+	return e
+}
+
+// addSession counts a session on the day it started
+func (h *TrafficHistory) addSession(start time.Time, profileID int, profileName string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entry(start.Local().Format(trafficHistoryDayFormat), profileID, profileName).Sessions++
+}
+
+// addInterval adds the traffic transferred between from and to, splitting it
+// between days at midnight in proportion to the time on each day
+func (h *TrafficHistory) addInterval(profileID int, profileName string, from, to time.Time, up, down int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from, to = from.Local(), to.Local()
+	if !to.After(from) {
+		e := h.entry(to.Format(trafficHistoryDayFormat), profileID, profileName)
+		e.Uploaded += up
+		e.Downloaded += down
+		return
+	}
+
+	total := to.Sub(from)
+	leftUp, leftDown := up, down
+	for start := from; start.Before(to); {
+		y, m, d := start.Date()
+		end := time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+		partUp, partDown := leftUp, leftDown
+		if end.Before(to) {
+			share := float64(end.Sub(start)) / float64(total)
+			partUp = int64(float64(up) * share)
+			partDown = int64(float64(down) * share)
+		} else {
+			end = to
+		}
+
+		e := h.entry(start.Format(trafficHistoryDayFormat), profileID, profileName)
+		e.Uploaded += partUp
+		e.Downloaded += partDown
+		e.Duration += end.Sub(start)
+		leftUp -= partUp
+		leftDown -= partDown
+		start = end
+	}
+}
+
+// Query returns copies of the buckets of a profile (0 = all profiles) within
+// [fromDate, toDate] ("" leaves the range open), oldest first.
+func (h *TrafficHistory) Query(profileID int, fromDate, toDate string) []TrafficHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := []TrafficHistoryEntry{}
+	for _, e := range h.Entries {
+		if profileID != 0 && e.ProfileID != profileID {
+			continue
+		}
+		if (fromDate != "" && e.Date < fromDate) || (toDate != "" && e.Date > toDate) {
+			continue
+		}
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Date != result[j].Date {
+			return result[i].Date < result[j].Date
+		}
+		return result[i].ProfileID < result[j].ProfileID
+	})
+	return result
+}
+
+// Reset removes the buckets of a profile (0 = all) and returns how many were removed.
+func (h *TrafficHistory) Reset(profileID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kept := h.Entries[:0]
+	for _, e := range h.Entries {
+		if profileID == 0 || e.ProfileID == profileID {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	removed := len(h.Entries) - len(kept)
+	h.Entries = kept
+	return removed
+}
+
+// shouldSave reports whether TrafficSaveInterval passed since the last save
+func (h *TrafficHistory) shouldSave() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Since(h.lastSave) >= TrafficSaveInterval
+}
+
+// Save prunes buckets older than the retention and writes the history.
+func (h *TrafficHistory) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	months := h.keepMonths
+	if months <= 0 {
+		months = DefaultTrafficHistoryMonths
+	}
+	cutoff := time.Now().AddDate(0, -months, 0).Format(trafficHistoryDayFormat)
+	kept := h.Entries[:0]
+	for _, e := range h.Entries {
+		if e.Date >= cutoff {
+			kept = append(kept, e)
+		}
+	}
+	h.Entries = kept
+
+	h.lastSave = time.Now()
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
+
+// ValidateTrafficHistoryDate checks a YYYY-MM-DD date ("" is allowed).
+func ValidateTrafficHistoryDate(date string) error {
+	if date == "" {
+		return nil
+	}
+	if _, err := time.Parse(trafficHistoryDayFormat, date); err != nil {
+		return fmt.Errorf("неверная дата %q, ожидается ГГГГ-ММ-ДД", date)
+	}
+	return nil
+}
@@ -4,10 +4,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
+// SessionHistoryFile хранит историю подключений, по одной JSON-записи на строку
+const SessionHistoryFile = "session_history.jsonl"
+
+// Причины отключения в истории подключений
+const (
+	DisconnectReasonUser  = "user"  // Отключено пользователем
+	DisconnectReasonError = "error" // sing-box завершился с ошибкой
+	DisconnectReasonExit  = "exit"  // sing-box завершился сам
+)
+
+// SessionRecord - одна запись истории подключений
+type SessionRecord struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	ProfileID   int       `json:"profile_id"`
+	ProfileName string    `json:"profile_name"`
+	Reason      string    `json:"reason"`
+	Uploaded    int64     `json:"uploaded"`
+	Downloaded  int64     `json:"downloaded"`
+
+	// Результат замера серверов при подключении (nil если выключен)
+	ConnectMeasure *ConnectMeasurement `json:"connect_measure,omitempty"`
+}
+
 // TrafficData представляет данные о трафике
 type TrafficData struct {
 	Uploaded   int64         `json:"uploaded"`
@@ -27,10 +52,18 @@ type TrafficStats struct {
 	LastEndTime   time.Time   `json:"last_end_time"`
 
 	// Текущая сессия (не сохраняется)
-	current      TrafficData
-	sessionStart time.Time
-	configPath   string // путь к файлу статистики
-	mu           sync.RWMutex
+	current            TrafficData
+	sessionStart       time.Time
+	sessionProfileID   int    // профиль текущей сессии
+	sessionProfileName string
+	sessionMeasure     *ConnectMeasurement
+	configPath         string // путь к файлу статистики
+	mu                 sync.RWMutex
+
+	// Дневная история по профилям; historyMark - трафик и время, уже учтённые в ней
+	history         *TrafficHistory
+	historyMark     TrafficData
+	historyMarkTime time.Time
 }
 
 // NewTrafficStats создаёт новый объект статистики
@@ -40,22 +73,16 @@ func NewTrafficStats() *TrafficStats {
 
 // LoadTrafficStats загружает статистику из файла
 func LoadTrafficStats(configPath string) *TrafficStats {
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		stats := NewTrafficStats()
-		stats.configPath = configPath
-		return stats
-	}
-
-	var stats TrafficStats
-	if err := json.Unmarshal(data, &stats); err != nil {
-		stats := NewTrafficStats()
-		stats.configPath = configPath
-		return stats
+	stats := NewTrafficStats()
+	if data, err := os.ReadFile(configPath); err == nil {
+		if err := json.Unmarshal(data, stats); err != nil {
+			stats = NewTrafficStats()
+		}
 	}
 
 	stats.configPath = configPath
-	return &stats
+	stats.history = LoadTrafficHistory(trafficHistoryPath(configPath), stats.HistoryPath())
+	return stats
 }
 
 // Save сохраняет статистику в файл
@@ -67,6 +94,12 @@ func (s *TrafficStats) Save() error {
 		return nil
 	}
 
+	if s.history != nil {
+		if err := s.history.Save(); err != nil {
+			fmt.Printf("[TrafficStats] Failed to save traffic history: %v\n", err)
+		}
+	}
+
 	data, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return err
@@ -75,18 +108,27 @@ func (s *TrafficStats) Save() error {
 	return os.WriteFile(s.configPath, data, 0644)
 }
 
-// StartSession начинает новую сессию
-func (s *TrafficStats) StartSession() {
+// StartSession начинает новую сессию для профиля
+func (s *TrafficStats) StartSession(profileID int, profileName string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.sessionStart = time.Now()
+	s.sessionProfileID = profileID
+	s.sessionProfileName = profileName
+	s.sessionMeasure = nil
 	s.current = TrafficData{}
 	s.Total.Sessions++
+
+	s.historyMark = TrafficData{}
+	s.historyMarkTime = s.sessionStart
+	if s.history != nil {
+		s.history.addSession(s.sessionStart, profileID, profileName)
+	}
 }
 
-// EndSession завершает текущую сессию
-func (s *TrafficStats) EndSession() {
+// EndSession завершает текущую сессию и дописывает её в историю подключений
+func (s *TrafficStats) EndSession(reason string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -95,6 +137,7 @@ func (s *TrafficStats) EndSession() {
 	}
 
 	duration := time.Since(s.sessionStart)
+	s.checkpointHistory(s.sessionStart.Add(duration))
 
 	// Обновляем общую статистику
 	s.Total.Uploaded += s.current.Uploaded
@@ -110,18 +153,106 @@ func (s *TrafficStats) EndSession() {
 	s.LastStartTime = s.sessionStart
 	s.LastEndTime = time.Now()
 
+	if err := s.appendHistory(SessionRecord{
+		Start:       s.LastStartTime,
+		End:         s.LastEndTime,
+		ProfileID:   s.sessionProfileID,
+		ProfileName: s.sessionProfileName,
+		Reason:      reason,
+		Uploaded:    s.current.Uploaded,
+		Downloaded:  s.current.Downloaded,
+
+		ConnectMeasure: s.sessionMeasure,
+	}); err != nil {
+		fmt.Printf("[TrafficStats] Failed to append session history: %v\n", err)
+	}
+
 	// Сбрасываем текущую сессию
 	s.sessionStart = time.Time{}
 	s.current = TrafficData{}
 }
 
-// UpdateTraffic обновляет статистику трафика
-func (s *TrafficStats) UpdateTraffic(upload, download int64) {
+// SetSessionMeasurement сохраняет результат замера серверов текущей сессии
+func (s *TrafficStats) SetSessionMeasurement(m *ConnectMeasurement) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.sessionMeasure = m
+}
+
+// HistoryPath возвращает путь к файлу истории подключений
+func (s *TrafficStats) HistoryPath() string {
+	if s.configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(s.configPath), SessionHistoryFile)
+}
+
+// appendHistory дописывает запись в историю. Вызывается с s.mu
+func (s *TrafficStats) appendHistory(record SessionRecord) error {
+	path := s.HistoryPath()
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// UpdateTraffic обновляет статистику трафика
+func (s *TrafficStats) UpdateTraffic(upload, download int64) {
+	s.mu.Lock()
 	s.current.Uploaded = upload
 	s.current.Downloaded = download
+	s.checkpointHistory(time.Now())
+	s.mu.Unlock()
+
+	// История пишется на диск не чаще TrafficSaveInterval
+	if s.history != nil && s.configPath != "" && s.history.shouldSave() {
+		if err := s.history.Save(); err != nil {
+			fmt.Printf("[TrafficStats] Failed to save traffic history: %v\n", err)
+		}
+	}
+}
+
+// CheckpointHistory добавляет в дневную историю трафик текущей сессии на данный момент
+func (s *TrafficStats) CheckpointHistory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpointHistory(time.Now())
+}
+
+// checkpointHistory добавляет в историю трафик и время с прошлой отметки.
+// Вызывается с s.mu
+func (s *TrafficStats) checkpointHistory(now time.Time) {
+	if s.history == nil || s.sessionStart.IsZero() {
+		return
+	}
+
+	up := s.current.Uploaded - s.historyMark.Uploaded
+	down := s.current.Downloaded - s.historyMark.Downloaded
+	// Счётчики sing-box обнулились (перезапуск ядра) - считаем с нуля
+	if up < 0 || down < 0 {
+		up, down = s.current.Uploaded, s.current.Downloaded
+	}
+	s.history.addInterval(s.sessionProfileID, s.sessionProfileName, s.historyMarkTime, now, up, down)
+	s.historyMark = TrafficData{Uploaded: s.current.Uploaded, Downloaded: s.current.Downloaded}
+	s.historyMarkTime = now
+}
+
+// History возвращает дневную историю трафика по профилям
+func (s *TrafficStats) History() *TrafficHistory {
+	return s.history
 }
 
 // GetCurrentSession возвращает статистику текущей сессии
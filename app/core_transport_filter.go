@@ -3,52 +3,125 @@ package main
 // Transport Filter - filters unsupported transport types from subscriptions
 // Currently sing-box does not support xhttp transport (Xray-core specific)
 
-// UnsupportedTransports lists transport types not supported by sing-box
-var UnsupportedTransports = []string{
-	"xhttp",      // Xray-core specific transport
-	"splithttp",  // Old name for xhttp
+// TransportSupport describes why a transport can't be used with the bundled core
+type TransportSupport struct {
+	Reason              string // Human-readable reason shown in the UI
+	RequiredCoreVersion string // First sing-box version supporting it ("" = none yet)
 }
 
+// unsupportedTransports is the transport decision table: transports missing
+// here (tcp, ws, grpc, http, httpupgrade, quic) are passed to sing-box as is.
+var unsupportedTransports = map[string]TransportSupport{
+	"xhttp":     {Reason: "транспорт xhttp есть только в Xray-core"},
+	"splithttp": {Reason: "транспорт splithttp (старое имя xhttp) есть только в Xray-core"},
+}
+
+// supportedShadowsocksPlugins are SIP003 plugins built into sing-box;
+// other plugins are external programs sing-box can't start.
+var supportedShadowsocksPlugins = map[string]bool{
+	"obfs-local":   true,
+	"v2ray-plugin": true,
+}
+
+// proxySupport returns why a proxy can't be used with the bundled core and the
+// transport reported for it ("plugin:<name>" for Shadowsocks plugins).
+func proxySupport(proxy ProxyConfig) (TransportSupport, string, bool) {
+	if support, unsupported := unsupportedTransports[proxy.Network]; unsupported {
+		return support, proxy.Network, true
+	}
+	if proxy.Type == "shadowsocks" && proxy.Plugin != "" && !supportedShadowsocksPlugins[proxy.Plugin] {
+		return TransportSupport{
+			Reason: "плагин Shadowsocks " + proxy.Plugin + " не поддерживается sing-box (поддерживаются obfs-local и v2ray-plugin)",
+		}, "plugin:" + proxy.Plugin, true
+	}
+	return TransportSupport{}, "", false
+}
+
+// UnsupportedTransportsWarning is shown when filtering is disabled by the user
+const UnsupportedTransportsWarning = "Фильтрация неподдерживаемых транспортов отключена. " +
+	"sing-box может отказаться запускать конфиг с такими серверами"
+
 // IsTransportSupported checks if a transport type is supported by sing-box
 func IsTransportSupported(transport string) bool {
-	for _, unsupported := range UnsupportedTransports {
-		if transport == unsupported {
-			return false
-		}
-	}
-	return true
+	_, unsupported := unsupportedTransports[transport]
+	return !unsupported
+}
+
+// FilteredProxy describes one proxy excluded because of its transport
+type FilteredProxy struct {
+	Name                string `json:"name"`
+	Server              string `json:"server"`
+	Transport           string `json:"transport"`
+	Reason              string `json:"reason"`
+	RequiredCoreVersion string `json:"required_core_version,omitempty"`
 }
 
 // FilterResult contains information about filtered proxies
 type FilterResult struct {
-	Supported   []ProxyConfig // Proxies with supported transports
-	Filtered    []ProxyConfig // Proxies with unsupported transports (filtered out)
-	Message     string        // Human-readable message about filtered proxies
-	AllFiltered bool          // True if ALL proxies were filtered (none supported)
+	Supported   []ProxyConfig   // Proxies with supported transports
+	Filtered    []ProxyConfig   // Proxies with unsupported transports (filtered out)
+	Entries     []FilteredProxy // Per-proxy reasons for Filtered (or forced proxies)
+	Message     string          // Human-readable message about filtered proxies
+	AllFiltered bool            // True if ALL proxies were filtered (none supported)
+	Forced      bool            // Unsupported proxies were kept by user override
 }
 
 // FilterUnsupportedTransports filters out proxies with unsupported transport types
 // Returns supported proxies and information about filtered ones
 func FilterUnsupportedTransports(proxies []ProxyConfig) FilterResult {
+	return FilterTransports(proxies, false)
+}
+
+// FilterTransports filters proxies by transport. With allowUnsupported all
+// proxies are kept, but unsupported ones are still reported in Entries.
+func FilterTransports(proxies []ProxyConfig, allowUnsupported bool) FilterResult {
 	result := FilterResult{
 		Supported: make([]ProxyConfig, 0),
 		Filtered:  make([]ProxyConfig, 0),
+		Entries:   make([]FilteredProxy, 0),
 	}
 
 	filteredInfo := []string{}
+	transports := []string{}
 
 	for _, proxy := range proxies {
-		if IsTransportSupported(proxy.Network) {
+		support, transport, unsupported := proxySupport(proxy)
+		if !unsupported {
 			result.Supported = append(result.Supported, proxy)
-		} else {
-			result.Filtered = append(result.Filtered, proxy)
-			// Create human-readable info
-			info := proxy.Name
-			if info == "" {
-				info = proxy.Server
-			}
-			filteredInfo = append(filteredInfo, info+" (транспорт: "+proxy.Network+")")
+			continue
+		}
+
+		result.Entries = append(result.Entries, FilteredProxy{
+			Name:                proxy.Name,
+			Server:              proxy.Server,
+			Transport:           transport,
+			Reason:              support.Reason,
+			RequiredCoreVersion: support.RequiredCoreVersion,
+		})
+
+		if allowUnsupported {
+			result.Supported = append(result.Supported, proxy)
+			continue
+		}
+
+		result.Filtered = append(result.Filtered, proxy)
+		// Create human-readable info
+		info := proxy.Name
+		if info == "" {
+			info = proxy.Server
+		}
+		filteredInfo = append(filteredInfo, info+" (транспорт: "+transport+")")
+		if !containsString(transports, transport) {
+			transports = append(transports, transport)
+		}
+	}
+
+	if allowUnsupported {
+		result.Forced = len(result.Entries) > 0
+		if result.Forced {
+			result.Message = UnsupportedTransportsWarning
 		}
+		return result
 	}
 
 	// Set AllFiltered flag
@@ -57,9 +130,10 @@ func FilterUnsupportedTransports(proxies []ProxyConfig) FilterResult {
 	// Generate message
 	if len(result.Filtered) > 0 {
 		if result.AllFiltered {
-			result.Message = "Все серверы в подписке используют неподдерживаемый транспорт (xhttp). " +
+			result.Message = "Все серверы в подписке используют неподдерживаемый транспорт (" +
+				joinStrings(transports, ", ") + "). " +
 				"Этот протокол пока не поддерживается. Ожидайте обновлений или попросите " +
-				"провайдера предоставить серверы с другим транспортом (ws, grpc, tcp)."
+				"провайдера предоставить серверы с другим транспортом (ws, grpc, httpupgrade, tcp)."
 		} else {
 			result.Message = "Некоторые серверы (" +
 				joinStrings(filteredInfo, ", ") +
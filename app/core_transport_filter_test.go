@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProxySupport(t *testing.T) {
+	tests := []struct {
+		name        string
+		proxy       ProxyConfig
+		unsupported bool
+		transport   string
+	}{
+		{"tcp", ProxyConfig{Type: "vless", Network: "tcp"}, false, ""},
+		{"no network", ProxyConfig{Type: "trojan"}, false, ""},
+		{"ws", ProxyConfig{Type: "vless", Network: "ws"}, false, ""},
+		{"grpc", ProxyConfig{Type: "vless", Network: "grpc"}, false, ""},
+		{"http", ProxyConfig{Type: "vmess", Network: "http"}, false, ""},
+		{"httpupgrade", ProxyConfig{Type: "vless", Network: "httpupgrade"}, false, ""},
+		{"quic", ProxyConfig{Type: "vless", Network: "quic"}, false, ""},
+		{"xhttp", ProxyConfig{Type: "vless", Network: "xhttp"}, true, "xhttp"},
+		{"splithttp", ProxyConfig{Type: "vless", Network: "splithttp"}, true, "splithttp"},
+		{"obfs-local", ProxyConfig{Type: "shadowsocks", Plugin: "obfs-local"}, false, ""},
+		{"v2ray-plugin", ProxyConfig{Type: "shadowsocks", Plugin: "v2ray-plugin"}, false, ""},
+		{"external plugin", ProxyConfig{Type: "shadowsocks", Plugin: "kcptun"}, true, "plugin:kcptun"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			support, transport, unsupported := proxySupport(tt.proxy)
+			if unsupported != tt.unsupported || transport != tt.transport {
+				t.Errorf("proxySupport = %q, %v, want %q, %v", transport, unsupported, tt.transport, tt.unsupported)
+			}
+			if unsupported && support.Reason == "" {
+				t.Error("unsupported without a reason")
+			}
+			if tt.proxy.Network != "" && IsTransportSupported(tt.proxy.Network) == tt.unsupported {
+				t.Errorf("IsTransportSupported(%q) = %v", tt.proxy.Network, !tt.unsupported)
+			}
+		})
+	}
+}
+
+func TestFilterTransports(t *testing.T) {
+	ws := ProxyConfig{Type: "vless", Name: "DE ws", Server: "de.example.com", Network: "ws"}
+	xhttp := ProxyConfig{Type: "vless", Name: "NL xhttp", Server: "nl.example.com", Network: "xhttp"}
+	kcptun := ProxyConfig{Type: "shadowsocks", Server: "us.example.com", Plugin: "kcptun"}
+
+	tests := []struct {
+		name             string
+		proxies          []ProxyConfig
+		allowUnsupported bool
+		supported        []string
+		filtered         []string
+		entries          []string // servers with a reported reason
+		allFiltered      bool
+		forced           bool
+		message          []string // substrings of Message; nil = empty
+	}{
+		{"all supported", []ProxyConfig{ws}, false, []string{"de.example.com"}, nil, nil, false, false, nil},
+		{"empty subscription", nil, false, nil, nil, nil, false, false, nil},
+		{"some filtered", []ProxyConfig{ws, xhttp, kcptun}, false,
+			[]string{"de.example.com"}, []string{"nl.example.com", "us.example.com"}, []string{"nl.example.com", "us.example.com"},
+			false, false, []string{"NL xhttp (транспорт: xhttp)", "us.example.com (транспорт: plugin:kcptun)"}},
+		{"all filtered", []ProxyConfig{xhttp, kcptun}, false,
+			nil, []string{"nl.example.com", "us.example.com"}, []string{"nl.example.com", "us.example.com"},
+			true, false, []string{"Все серверы", "(xhttp, plugin:kcptun)"}},
+		{"forced", []ProxyConfig{ws, xhttp, kcptun}, true,
+			[]string{"de.example.com", "nl.example.com", "us.example.com"}, nil, []string{"nl.example.com", "us.example.com"},
+			false, true, []string{UnsupportedTransportsWarning}},
+		{"forced without unsupported", []ProxyConfig{ws}, true, []string{"de.example.com"}, nil, nil, false, false, nil},
+	}
+
+	servers := func(proxies []ProxyConfig) []string {
+		var result []string
+		for _, p := range proxies {
+			result = append(result, p.Server)
+		}
+		return result
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FilterTransports(tt.proxies, tt.allowUnsupported)
+
+			if got := servers(result.Supported); !equalStringSlices(got, tt.supported) {
+				t.Errorf("Supported = %v, want %v", got, tt.supported)
+			}
+			if got := servers(result.Filtered); !equalStringSlices(got, tt.filtered) {
+				t.Errorf("Filtered = %v, want %v", got, tt.filtered)
+			}
+			var entries []string
+			for _, entry := range result.Entries {
+				entries = append(entries, entry.Server)
+				if entry.Reason == "" || entry.Transport == "" {
+					t.Errorf("entry without reason: %+v", entry)
+				}
+			}
+			if !equalStringSlices(entries, tt.entries) {
+				t.Errorf("Entries = %v, want %v", entries, tt.entries)
+			}
+			if result.AllFiltered != tt.allFiltered || result.Forced != tt.forced {
+				t.Errorf("AllFiltered = %v, Forced = %v, want %v, %v", result.AllFiltered, result.Forced, tt.allFiltered, tt.forced)
+			}
+			if tt.message == nil && result.Message != "" {
+				t.Errorf("Message = %q, want empty", result.Message)
+			}
+			for _, part := range tt.message {
+				if !strings.Contains(result.Message, part) {
+					t.Errorf("Message = %q, want it to contain %q", result.Message, part)
+				}
+			}
+		})
+	}
+
+	entry := FilterUnsupportedTransports([]ProxyConfig{xhttp}).Entries[0]
+	if entry.Name != "NL xhttp" || entry.Transport != "xhttp" || entry.Reason != unsupportedTransports["xhttp"].Reason {
+		t.Errorf("entry = %+v", entry)
+	}
+}
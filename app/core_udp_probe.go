@@ -0,0 +1,280 @@
+// Package main provides the UDP capability probe of proxies for KampusVPN.
+// Some subscription nodes don't relay UDP, which silently breaks games and
+// voice chats when auto-select lands on them. Runtime configs get a localhost
+// mixed inbound routed to a dedicated "udp-probe" selector; the probe switches
+// that selector (never the user's) to each proxy in turn and sends a DNS query
+// through SOCKS5 UDP ASSOCIATE. Results are kept per profile, and nodes without
+// UDP can be kept out of auto-select at build time.
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// UDP support states of a proxy
+const (
+	UDPSupportYes     = "yes"
+	UDPSupportNo      = "no"
+	UDPSupportUnknown = "unknown" // Not probed, or the probe itself failed
+)
+
+// UDP probe settings
+const (
+	// udpProbeInboundTag is the tag of the local inbound of the probe.
+	udpProbeInboundTag = "udpprobe-in"
+	// udpProbeSelector is the selector the probe switches between proxies.
+	udpProbeSelector = "udp-probe"
+	// UDPProbeTimeout bounds the probe of one proxy.
+	UDPProbeTimeout = 4 * time.Second
+	// UDPProbeStartDelay lets the connection settle before probing after connect.
+	UDPProbeStartDelay = 15 * time.Second
+	// udpProbeServer answers the DNS query of the probe.
+	udpProbeServer = "1.1.1.1"
+	// udpProbeDomain is the name queried through each proxy.
+	udpProbeDomain = "www.gstatic.com"
+)
+
+// UDPCapability is the last UDP probe result of a proxy.
+type UDPCapability struct {
+	Status    string    `json:"status"` // UDPSupportYes, UDPSupportNo or UDPSupportUnknown
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// udpStatus returns the UDP support state of a proxy in caps
+func udpStatus(caps map[string]UDPCapability, tag string) string {
+	if c, ok := caps[tag]; ok && c.Status != "" {
+		return c.Status
+	}
+	return UDPSupportUnknown
+}
+
+// applyUDPProbeInbound adds the probe inbound and the "udp-probe" selector of
+// all proxies of config (port 0 = no probe this session)
+func applyUDPProbeInbound(config map[string]interface{}, port int) {
+	if port == 0 {
+		return
+	}
+	outbounds, _ := config["outbounds"].([]interface{})
+	members := []string{}
+	for _, o := range outbounds {
+		outbound, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch outbound["type"] {
+		case "selector", "urltest", "direct", "block", "dns":
+			continue
+		}
+		if tag, _ := outbound["tag"].(string); tag != "" {
+			members = append(members, tag)
+		}
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	config["outbounds"] = append(outbounds, map[string]interface{}{
+		"type":      "selector",
+		"tag":       udpProbeSelector,
+		"outbounds": members,
+		"default":   members[0],
+	})
+	inbounds, _ := config["inbounds"].([]interface{})
+	config["inbounds"] = append(inbounds, map[string]interface{}{
+		"type":        "mixed",
+		"tag":         udpProbeInboundTag,
+		"listen":      proxyInboundListen,
+		"listen_port": port,
+	})
+	insertRuleAfterSniff(config, map[string]interface{}{
+		"inbound":  []string{udpProbeInboundTag},
+		"outbound": udpProbeSelector,
+	})
+}
+
+// probeUDPRelay sends a DNS query through the SOCKS5 inbound on port and
+// waits for the answer. A proxy without UDP relay drops the datagram, so a
+// timeout of the answer means no UDP; other errors mean the probe failed.
+func probeUDPRelay(port int, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	control, err := net.DialTimeout("tcp", net.JoinHostPort(proxyInboundListen, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return false, err
+	}
+	// The association lives as long as the control connection
+	defer control.Close()
+	control.SetDeadline(deadline)
+
+	relay, err := socks5UDPAssociate(control)
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	query, err := buildDNSQuery(udpProbeDomain, dnsTypeA)
+	if err != nil {
+		return false, err
+	}
+	id := uint16(time.Now().UnixNano())
+	binary.BigEndian.PutUint16(query[0:2], id)
+
+	// RSV, FRAG, ATYP=IPv4, DST.ADDR, DST.PORT
+	packet := append([]byte{0, 0, 0, 1}, net.ParseIP(udpProbeServer).To4()...)
+	packet = binary.BigEndian.AppendUint16(packet, 53)
+	if _, err := conn.Write(append(packet, query...)); err != nil {
+		return false, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, nil
+			}
+			return false, err
+		}
+		answer, ok := socks5UDPPayload(buf[:n])
+		if ok && len(answer) >= 12 && binary.BigEndian.Uint16(answer[0:2]) == id && answer[2]&0x80 != 0 {
+			return true, nil
+		}
+	}
+}
+
+// socks5UDPAssociate negotiates UDP ASSOCIATE without authentication and
+// returns the relay address
+func socks5UDPAssociate(conn net.Conn) (*net.UDPAddr, error) {
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply[0] != 5 || reply[1] != 0 {
+		return nil, fmt.Errorf("SOCKS5 handshake refused")
+	}
+
+	if _, err := conn.Write([]byte{5, 3, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[1] != 0 {
+		return nil, fmt.Errorf("SOCKS5 UDP ASSOCIATE refused (code %d)", header[1])
+	}
+	var ip net.IP
+	switch header[3] {
+	case 1:
+		ip = make(net.IP, net.IPv4len)
+	case 4:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, fmt.Errorf("SOCKS5 relay address type %d not supported", header[3])
+	}
+	if _, err := io.ReadFull(conn, ip); err != nil {
+		return nil, err
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return nil, err
+	}
+	// An unspecified relay address means the address of the control connection
+	if ip.IsUnspecified() {
+		ip = net.ParseIP(proxyInboundListen)
+	}
+	return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(portBytes))}, nil
+}
+
+// socks5UDPPayload strips the SOCKS5 UDP header of a datagram
+func socks5UDPPayload(packet []byte) ([]byte, bool) {
+	if len(packet) < 4 || packet[2] != 0 {
+		return nil, false
+	}
+	offset := 4
+	switch packet[3] {
+	case 1:
+		offset += net.IPv4len
+	case 4:
+		offset += net.IPv6len
+	case 3:
+		if len(packet) < 5 {
+			return nil, false
+		}
+		offset += 1 + int(packet[4])
+	default:
+		return nil, false
+	}
+	offset += 2
+	if len(packet) < offset {
+		return nil, false
+	}
+	return packet[offset:], true
+}
+
+// --- Storage ---
+
+// SetProfileUDPCapabilities merges UDP probe results into a profile.
+func (s *Storage) SetProfileUDPCapabilities(id int, results map[string]UDPCapability) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			if s.data.Profiles[i].UDPCapabilities == nil {
+				s.data.Profiles[i].UDPCapabilities = map[string]UDPCapability{}
+			}
+			for tag, result := range results {
+				s.data.Profiles[i].UDPCapabilities[tag] = result
+			}
+			return s.saveInternal()
+		}
+	}
+	return fmt.Errorf("profile with ID %d not found", id)
+}
+
+// GetActiveUDPCapabilities returns a copy of the UDP probe results of the active profile.
+func (s *Storage) GetActiveUDPCapabilities() map[string]UDPCapability {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	caps := map[string]UDPCapability{}
+	for _, p := range s.data.Profiles {
+		if p.ID == s.data.App.ActiveProfileID {
+			for tag, c := range p.UDPCapabilities {
+				caps[tag] = c
+			}
+		}
+	}
+	return caps
+}
+
+// SetUDPProbePort sets the UDP probe inbound port runtime configs use (0 = none).
+func (s *Storage) SetUDPProbePort(port int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.udpProbePort = port
+}
+
+// GetUDPProbePort returns the UDP probe inbound port of the current session.
+func (s *Storage) GetUDPProbePort() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.udpProbePort
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +16,12 @@ import (
 	"time"
 )
 
+// UpdateCheckInterval is the minimum time between update checks.
+const UpdateCheckInterval = 6 * time.Hour
+
+// updateChecksumAssets are release assets listing SHA256 sums of other assets
+var updateChecksumAssets = []string{"sha256sums", "sha256sums.txt", "checksums.txt"}
+
 // GitHubRelease represents a GitHub release.
 type GitHubRelease struct {
 	TagName     string    `json:"tag_name"`
@@ -23,6 +33,7 @@ type GitHubRelease struct {
 		Name               string `json:"name"`
 		BrowserDownloadURL string `json:"browser_download_url"`
 		Size               int64  `json:"size"`
+		Digest             string `json:"digest"` // "sha256:<hex>" (newer releases only)
 	} `json:"assets"`
 }
 
@@ -36,6 +47,10 @@ type UpdateInfo struct {
 	ReleaseURL     string `json:"release_url"`
 	PublishedAt    string `json:"published_at"`
 	FileSize       int64  `json:"file_size"`
+	AssetName      string `json:"asset_name,omitempty"`
+	SHA256         string `json:"sha256,omitempty"`       // SHA256 of the exe from the asset digest ("" if none)
+	ChecksumURL    string `json:"checksum_url,omitempty"` // Release asset with the SHA256 of the exe ("" if none)
+	Route          string `json:"route"`                  // DownloadRouteProxy or DownloadRouteDirect
 }
 
 // CheckForUpdates checks for updates on GitHub.
@@ -52,9 +67,10 @@ func CheckForUpdates() (*UpdateInfo, error) {
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("User-Agent", AppName+"/"+Version)
 
-	resp, err := ShortHTTPClient.Do(req)
+	client, route := newDownloadClient(ShortHTTPTimeout)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check for updates: %w", err)
+		return nil, fmt.Errorf("failed to check for updates (%s): %w", route, err)
 	}
 	defer resp.Body.Close()
 
@@ -63,11 +79,12 @@ func CheckForUpdates() (*UpdateInfo, error) {
 		return &UpdateInfo{
 			Available:      false,
 			CurrentVersion: Version,
+			Route:          route,
 		}, nil
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("GitHub returned status %d", resp.StatusCode)
+		return nil, fmt.Errorf("GitHub returned status %d (%s)", resp.StatusCode, route)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -88,17 +105,34 @@ func CheckForUpdates() (*UpdateInfo, error) {
 	available := compareVersions(latestVersion, currentVersion) > 0
 
 	// Find suitable asset for download
-	var downloadURL string
+	var downloadURL, assetName, assetSHA256 string
 	var fileSize int64
 	for _, asset := range release.Assets {
 		name := strings.ToLower(asset.Name)
 		if strings.Contains(name, "windows") && strings.HasSuffix(name, ".exe") {
 			downloadURL = asset.BrowserDownloadURL
+			assetName = asset.Name
 			fileSize = asset.Size
+			assetSHA256 = parseAssetDigest(asset.Digest)
 			break
 		}
 	}
 
+	// Checksum: "<asset>.sha256" or a common sums file
+	var checksumURL string
+	for _, asset := range release.Assets {
+		name := strings.ToLower(asset.Name)
+		if assetName != "" && name == strings.ToLower(assetName)+".sha256" {
+			checksumURL = asset.BrowserDownloadURL
+			break
+		}
+		for _, sums := range updateChecksumAssets {
+			if name == sums {
+				checksumURL = asset.BrowserDownloadURL
+			}
+		}
+	}
+
 	return &UpdateInfo{
 		Available:      available,
 		Version:        latestVersion,
@@ -108,9 +142,149 @@ func CheckForUpdates() (*UpdateInfo, error) {
 		ReleaseURL:     release.HTMLURL,
 		PublishedAt:    release.PublishedAt.Format("02.01.2006"),
 		FileSize:       fileSize,
+		AssetName:      assetName,
+		SHA256:         assetSHA256,
+		ChecksumURL:    checksumURL,
+		Route:          route,
 	}, nil
 }
 
+// parseAssetDigest returns the SHA256 of a release asset digest ("sha256:<hex>")
+// in lowercase hex, or "" if the digest is missing or not a SHA256
+func parseAssetDigest(digest string) string {
+	algorithm, sum, ok := strings.Cut(strings.TrimSpace(digest), ":")
+	if !ok || !strings.EqualFold(algorithm, "sha256") || len(sum) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	return strings.ToLower(sum)
+}
+
+// ExpectedUpdateChecksum returns the SHA256 the update exe must have: the asset
+// digest GitHub computes itself, or else the checksum asset of the release.
+// A release with neither can't be verified and is not installed.
+func ExpectedUpdateChecksum(info *UpdateInfo) (string, error) {
+	if info.SHA256 != "" {
+		return info.SHA256, nil
+	}
+	if info.ChecksumURL != "" {
+		return FetchUpdateChecksum(info)
+	}
+	return "", fmt.Errorf("release %s publishes no SHA256 for %s", info.Version, info.AssetName)
+}
+
+// FetchUpdateChecksum downloads the checksum asset and returns the SHA256 of
+// the update exe (lowercase hex). A sums file is searched for the asset name.
+func FetchUpdateChecksum(info *UpdateInfo) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShortHTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, info.ChecksumURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", AppName+"/"+Version)
+
+	client, route := newDownloadClient(ShortHTTPTimeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download checksum (%s): %w", route, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checksum download returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", err
+	}
+
+	// Lines are "<hex>  <name>" (sha256sum format, name may start with '*') or a bare hash
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if len(fields) == 1 || strings.EqualFold(strings.TrimPrefix(fields[1], "*"), info.AssetName) {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksum for %s not found", info.AssetName)
+}
+
+// VerifyUpdateFile checks a downloaded update before it replaces the exe:
+// the size reported by the release, an executable header and, if given, the SHA256.
+func VerifyUpdateFile(path string, info *UpdateInfo, expectedSHA256 string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.FileSize > 0 && stat.Size() != info.FileSize {
+		return fmt.Errorf("size mismatch: got %d bytes, expected %d", stat.Size(), info.FileSize)
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(f, header); err != nil || string(header) != "MZ" {
+		return fmt.Errorf("not a Windows executable")
+	}
+
+	if expectedSHA256 == "" {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expectedSHA256 {
+		return fmt.Errorf("SHA256 mismatch: got %s, expected %s", actual, expectedSHA256)
+	}
+	return nil
+}
+
+// writeUpdateScript writes a batch file that waits for the process to exit,
+// replaces the exe with the update and starts it. The old exe is kept until
+// the copy succeeds and restored if it fails, so a failed swap still starts
+// the current version.
+func writeUpdateScript(updatePath, execPath string, pid int) (string, error) {
+	backupPath := execPath + ".old"
+	script := fmt.Sprintf(`@echo off
+:wait
+tasklist /FI "PID eq %[1]d" 2>nul | find "%[1]d" >nul
+if not errorlevel 1 (
+  timeout /t 1 /nobreak >nul
+  goto wait
+)
+copy /y "%[3]s" "%[4]s" >nul || goto start
+copy /y "%[2]s" "%[3]s" >nul || goto restore
+del "%[2]s"
+del "%[4]s"
+goto start
+:restore
+copy /y "%[4]s" "%[3]s" >nul
+:start
+start "" "%[3]s"
+del "%%~f0"
+`, pid, updatePath, execPath, backupPath)
+
+	scriptPath := filepath.Join(os.TempDir(), AppName+"_update.bat")
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		return "", err
+	}
+	return scriptPath, nil
+}
+
 // DownloadUpdate downloads the update file to temp directory.
 func DownloadUpdate(downloadURL string, progressCallback func(downloaded, total int64)) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), LongHTTPTimeout)
@@ -122,14 +296,15 @@ func DownloadUpdate(downloadURL string, progressCallback func(downloaded, total
 	}
 	req.Header.Set("User-Agent", AppName+"/"+Version)
 
-	resp, err := LongHTTPClient.Do(req)
+	client, route := newDownloadClient(LongHTTPTimeout)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("download failed: %w", err)
+		return "", fmt.Errorf("download failed (%s): %w", route, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("download returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("download returned status %d (%s)", resp.StatusCode, route)
 	}
 
 	// Create temp file
@@ -140,7 +315,14 @@ func DownloadUpdate(downloadURL string, progressCallback func(downloaded, total
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer out.Close()
+	completed := false
+	defer func() {
+		out.Close()
+		if !completed {
+			// A partial download must not be mistaken for an update later
+			os.Remove(tempFile)
+		}
+	}()
 
 	// Copy with progress
 	total := resp.ContentLength
@@ -167,6 +349,7 @@ func DownloadUpdate(downloadURL string, progressCallback func(downloaded, total
 		}
 	}
 
+	completed = true
 	return tempFile, nil
 }
 
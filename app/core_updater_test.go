@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAssetDigest(t *testing.T) {
+	sum := strings.Repeat("ab", sha256.Size)
+	tests := []struct {
+		digest string
+		want   string
+	}{
+		{"sha256:" + sum, sum},
+		{"SHA256:" + strings.ToUpper(sum), sum},
+		{" sha256:" + sum + " ", sum},
+		{"", ""},
+		{sum, ""},
+		{"sha512:" + sum, ""},
+		{"sha256:" + sum[:10], ""},
+		{"sha256:" + strings.Repeat("zz", sha256.Size), ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseAssetDigest(tt.digest); got != tt.want {
+			t.Errorf("parseAssetDigest(%q) = %q, want %q", tt.digest, got, tt.want)
+		}
+	}
+}
+
+func TestExpectedUpdateChecksum(t *testing.T) {
+	sum := strings.Repeat("0f", sha256.Size)
+	got, err := ExpectedUpdateChecksum(&UpdateInfo{Version: "2.0.0", AssetName: "app-windows.exe", SHA256: sum})
+	if err != nil || got != sum {
+		t.Errorf("with digest: %q, %v; want %q", got, err, sum)
+	}
+
+	if _, err := ExpectedUpdateChecksum(&UpdateInfo{Version: "2.0.0", AssetName: "app-windows.exe"}); err == nil {
+		t.Error("release without any checksum accepted")
+	}
+}
+
+func TestVerifyUpdateFile(t *testing.T) {
+	content := append([]byte("MZ"), make([]byte, 126)...)
+	hash := sha256.Sum256(content)
+	sum := hex.EncodeToString(hash[:])
+
+	path := filepath.Join(t.TempDir(), "update.exe")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	notExe := filepath.Join(t.TempDir(), "update.exe")
+	if err := os.WriteFile(notExe, []byte("<html>rate limited</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		info   UpdateInfo
+		sha256 string
+		ok     bool
+	}{
+		{"valid", path, UpdateInfo{FileSize: int64(len(content))}, sum, true},
+		{"size only", path, UpdateInfo{FileSize: int64(len(content))}, "", true},
+		{"unknown size", path, UpdateInfo{}, sum, true},
+		{"size mismatch", path, UpdateInfo{FileSize: 10}, sum, false},
+		{"hash mismatch", path, UpdateInfo{}, strings.Repeat("00", sha256.Size), false},
+		{"not an executable", notExe, UpdateInfo{}, "", false},
+		{"missing file", filepath.Join(t.TempDir(), "missing.exe"), UpdateInfo{}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyUpdateFile(tt.path, &tt.info, tt.sha256)
+			if (err == nil) != tt.ok {
+				t.Errorf("VerifyUpdateFile error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
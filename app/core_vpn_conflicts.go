@@ -0,0 +1,116 @@
+// Package main provides detection of other VPNs for KampusVPN.
+// When Cloudflare WARP, OpenVPN or another WireGuard client already routes
+// all traffic, the sing-box TUN ends up half-working. Before start the app
+// looks for known VPN adapters that are up and checks whether the default
+// route goes through them.
+package main
+
+import (
+	"net/netip"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// ConflictingAdapter is an adapter of another VPN that is up.
+type ConflictingAdapter struct {
+	Name         string `json:"name"`          // Friendly name ("CloudflareWARP")
+	Description  string `json:"description"`   // Driver description ("Cloudflare WARP Interface Tunnel")
+	Kind         string `json:"kind"`          // VPN the adapter belongs to
+	DefaultRoute bool   `json:"default_route"` // All traffic is routed through it
+}
+
+// conflictingAdapterKinds maps lowercase substrings of the adapter
+// description or name to the VPN they belong to
+var conflictingAdapterKinds = []struct {
+	Match string
+	Kind  string
+}{
+	{"cloudflare warp", "Cloudflare WARP"},
+	{"cloudflarewarp", "Cloudflare WARP"},
+	{"tap-windows", "OpenVPN (TAP-Windows)"},
+	{"openvpn", "OpenVPN"},
+	{"wireguard tunnel", "WireGuard"},
+	{"wintun", "Wintun"},
+}
+
+// conflictKind returns the VPN an adapter belongs to ("" if it isn't a known
+// VPN adapter or is one of ours)
+func conflictKind(name, description string) string {
+	if strings.HasPrefix(name, TunnelPrefix) || name == singboxTunName {
+		return ""
+	}
+	lowerName := strings.ToLower(name)
+	lowerDesc := strings.ToLower(description)
+	for _, k := range conflictingAdapterKinds {
+		if strings.Contains(lowerDesc, k.Match) || strings.Contains(lowerName, k.Match) {
+			return k.Kind
+		}
+	}
+	return ""
+}
+
+// isDefaultRoutePrefix reports whether a route catches all traffic:
+// 0.0.0.0/0 or the 0.0.0.0/1 + 128.0.0.0/1 pair VPN clients use
+func isDefaultRoutePrefix(prefix netip.Prefix) bool {
+	return prefix.Addr().Is4() && prefix.Bits() <= 1
+}
+
+// DetectConflictingVPNs returns the adapters of other VPNs that are up,
+// marking those the default route goes through.
+func DetectConflictingVPNs() ([]ConflictingAdapter, error) {
+	first, err := readAdapterAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []ConflictingAdapter{}
+	addresses := map[string]int{} // IPv4 address -> index in conflicts
+	for aa := first; aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		name := windows.UTF16PtrToString(aa.FriendlyName)
+		description := windows.UTF16PtrToString(aa.Description)
+		kind := conflictKind(name, description)
+		if kind == "" {
+			continue
+		}
+
+		for ua := aa.FirstUnicastAddress; ua != nil; ua = ua.Next {
+			if ip := ua.Address.IP(); ip != nil && ip.To4() != nil {
+				addresses[ip.To4().String()] = len(conflicts)
+			}
+		}
+		conflicts = append(conflicts, ConflictingAdapter{Name: name, Description: description, Kind: kind})
+	}
+	if len(conflicts) == 0 {
+		return conflicts, nil
+	}
+
+	routes, err := readSystemRoutes()
+	if err != nil {
+		// Without the routing table every VPN adapter that is up counts
+		for i := range conflicts {
+			conflicts[i].DefaultRoute = true
+		}
+		return conflicts, nil
+	}
+	for _, route := range routes {
+		if i, ok := addresses[route.Interface]; ok && isDefaultRoutePrefix(route.Prefix) {
+			conflicts[i].DefaultRoute = true
+		}
+	}
+	return conflicts, nil
+}
+
+// blockingConflicts returns the adapters that take the default route
+func blockingConflicts(conflicts []ConflictingAdapter) []ConflictingAdapter {
+	var blocking []ConflictingAdapter
+	for _, c := range conflicts {
+		if c.DefaultRoute {
+			blocking = append(blocking, c)
+		}
+	}
+	return blocking
+}
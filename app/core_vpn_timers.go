@@ -0,0 +1,136 @@
+// Package main provides scheduled connect and disconnect for KampusVPN.
+// A timer fires at a time of day on selected days of week, e.g. connect the
+// work profile at 09:00 and disconnect at 19:00 on weekdays. Unlike the
+// profile schedule it acts once at the given minute, so a manual connect or
+// disconnect in between is left alone.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// VPN timer actions
+const (
+	VPNTimerConnect    = "connect"
+	VPNTimerDisconnect = "disconnect"
+)
+
+// VPN timer evaluation
+const (
+	// VPNTimerCheckInterval is how often due timers are evaluated.
+	VPNTimerCheckInterval = time.Minute
+	// VPNTimerGrace is how late a timer may still fire. Triggers missed while
+	// the machine was asleep are older than this and are skipped.
+	VPNTimerGrace = 2 * VPNTimerCheckInterval
+)
+
+// VPNTimer connects or disconnects VPN at Time on Days (local time).
+type VPNTimer struct {
+	Days      []int  `json:"days"`                 // 0 = Sunday ... 6 = Saturday
+	Time      string `json:"time"`                 // "HH:MM"
+	Action    string `json:"action"`               // VPNTimerConnect or VPNTimerDisconnect
+	ProfileID int    `json:"profile_id,omitempty"` // Profile activated before connecting (0 = current)
+	Disabled  bool   `json:"disabled,omitempty"`
+}
+
+// hasDay reports whether the timer is set for the weekday.
+func (t VPNTimer) hasDay(day time.Weekday) bool {
+	for _, d := range t.Days {
+		if d == int(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// TriggerOn returns when the timer fires on the given day (zero time if it doesn't).
+func (t VPNTimer) TriggerOn(day time.Time) time.Time {
+	if !t.hasDay(day.Weekday()) {
+		return time.Time{}
+	}
+	minute, err := parseScheduleTime(t.Time)
+	if err != nil {
+		return time.Time{}
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return midnight.Add(time.Duration(minute) * time.Minute)
+}
+
+// dueVPNTimer is a timer trigger that fell into an evaluation window
+type dueVPNTimer struct {
+	Index int
+	Timer VPNTimer
+	At    time.Time
+	Late  bool // The trigger is older than VPNTimerGrace and is skipped
+}
+
+// dueVPNTimers returns the triggers in (from, to], oldest first
+func dueVPNTimers(timers []VPNTimer, from, to time.Time) []dueVPNTimer {
+	var due []dueVPNTimer
+	for i, timer := range timers {
+		if timer.Disabled {
+			continue
+		}
+		// The window may span midnight (or several days after sleep)
+		for day := from; !day.After(to.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+			at := timer.TriggerOn(day)
+			if at.IsZero() || !at.After(from) || at.After(to) {
+				continue
+			}
+			due = append(due, dueVPNTimer{Index: i, Timer: timer, At: at, Late: to.Sub(at) > VPNTimerGrace})
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].At.Before(due[j].At) })
+	return due
+}
+
+// ValidateVPNTimer checks a timer and rejects one that fires at the same
+// minute on a common day as another timer (skip is the index of the timer
+// being replaced, -1 when adding).
+func ValidateVPNTimer(timer VPNTimer, existing []VPNTimer, skip int, profileExists func(int) bool) error {
+	if len(timer.Days) == 0 {
+		return fmt.Errorf("не выбраны дни недели")
+	}
+	for _, d := range timer.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("неверный день недели %d", d)
+		}
+	}
+	minute, err := parseScheduleTime(timer.Time)
+	if err != nil {
+		return err
+	}
+	switch timer.Action {
+	case VPNTimerConnect:
+	case VPNTimerDisconnect:
+		if timer.ProfileID != 0 {
+			return fmt.Errorf("профиль выбирается только для подключения")
+		}
+	default:
+		return fmt.Errorf("неизвестное действие: %s", timer.Action)
+	}
+	if timer.ProfileID != 0 && !profileExists(timer.ProfileID) {
+		return fmt.Errorf("профиль %d не найден", timer.ProfileID)
+	}
+
+	for i, other := range existing {
+		if i == skip || other.Disabled || timer.Disabled {
+			continue
+		}
+		otherMinute, err := parseScheduleTime(other.Time)
+		if err != nil || otherMinute != minute {
+			continue
+		}
+		for _, d := range timer.Days {
+			if other.hasDay(time.Weekday(d)) {
+				if other.Action == timer.Action {
+					return fmt.Errorf("таймер %d уже срабатывает в %s в этот день", i+1, other.Time)
+				}
+				return fmt.Errorf("таймер %d в %s в этот день выполняет противоположное действие", i+1, other.Time)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Package main provides warm standby configs for KampusVPN.
+// Runtime configs of the most recently used profiles are written ahead of time
+// to per-profile files, so switching between them only restarts sing-box.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Warm standby settings
+const (
+	// DefaultWarmStandbyCount is the number of recently used profiles kept ready.
+	DefaultWarmStandbyCount = 2
+	// MaxRecentProfiles is the length of the recently used profiles list.
+	MaxRecentProfiles = 10
+	// StandbyMaxAge is the config age after which a switched-to profile is rebuilt in the background.
+	StandbyMaxAge = 24 * time.Hour
+	// StandbyFolder holds per-profile runtime configs inside resources.
+	StandbyFolder = "standby"
+)
+
+// StandbyConfig is a pre-written runtime config of a profile.
+type StandbyConfig struct {
+	ProfileID int       `json:"profile_id"`
+	Path      string    `json:"path"`
+	Hash      string    `json:"hash"`     // Hash of the rendered config when written
+	BuiltAt   time.Time `json:"built_at"` // Build time of the profile config
+	Stale     bool      `json:"stale"`    // Older than StandbyMaxAge
+}
+
+// ToMap converts standby info to API response format.
+func (c StandbyConfig) ToMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"profileId": c.ProfileID,
+		"hash":      c.Hash,
+		"stale":     c.Stale,
+	}
+	if !c.BuiltAt.IsZero() {
+		result["builtAt"] = c.BuiltAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+// configHash returns a short hash of rendered config data
+func configHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// configIsStale reports whether a profile config is older than StandbyMaxAge
+func configIsStale(info *ConfigBuildInfo) bool {
+	return info == nil || time.Since(info.BuiltAt) > StandbyMaxAge
+}
+
+// WarmStandbyCount returns the number of profiles to keep ready (0 when disabled).
+func (s GlobalAppSettings) WarmStandbyCount() int {
+	if !s.WarmStandby {
+		return 0
+	}
+	if s.WarmStandbyProfiles <= 0 {
+		return DefaultWarmStandbyCount
+	}
+	return s.WarmStandbyProfiles
+}
+
+// standbyDir returns the folder with standby configs
+func (s *Storage) standbyDir() string {
+	return filepath.Join(s.resourcesPath, StandbyFolder)
+}
+
+// standbyPath returns the standby config file of a profile
+func (s *Storage) standbyPath(id int) string {
+	return filepath.Join(s.standbyDir(), fmt.Sprintf("config_%d.json", id))
+}
+
+// recordRecentProfile moves id to the front of the recently used list.
+// Must be called with s.mu held.
+func (s *Storage) recordRecentProfile(id int) {
+	recent := []int{id}
+	for _, existing := range s.data.App.RecentProfileIDs {
+		if existing != id && len(recent) < MaxRecentProfiles {
+			recent = append(recent, existing)
+		}
+	}
+	s.data.App.RecentProfileIDs = recent
+}
+
+// WriteStandbyConfigs writes runtime configs of the most recently used profiles
+// (up to count) and removes standby files of other profiles.
+func (s *Storage) WriteStandbyConfigs(count int) ([]StandbyConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.standby == nil {
+		s.standby = make(map[int]StandbyConfig)
+	}
+
+	keep := map[int]bool{}
+	result := []StandbyConfig{}
+	var firstErr error
+
+	if count > 0 {
+		if err := os.MkdirAll(s.standbyDir(), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create standby folder: %w", err)
+		}
+	}
+
+	ids := s.data.App.RecentProfileIDs
+	if len(ids) == 0 {
+		ids = []int{s.data.App.ActiveProfileID}
+	}
+	for _, id := range ids {
+		if len(result) >= count {
+			break
+		}
+		var profile *ProfileData
+		for i := range s.data.Profiles {
+			if s.data.Profiles[i].ID == id {
+				profile = &s.data.Profiles[i]
+				break
+			}
+		}
+		if profile == nil || len(profile.SingboxConfig) == 0 || profile.BuildInfo.IsNewer() {
+			continue
+		}
+
+		data, err := s.renderRuntimeConfig(profile)
+		if err == nil {
+			err = writeFileIfChanged(s.standbyPath(id), data)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("profile %d: %w", id, err)
+			}
+			continue
+		}
+
+		entry := StandbyConfig{
+			ProfileID: id,
+			Path:      s.standbyPath(id),
+			Hash:      configHash(data),
+			Stale:     configIsStale(profile.BuildInfo),
+		}
+		if profile.BuildInfo != nil {
+			entry.BuiltAt = profile.BuildInfo.BuiltAt
+		}
+		s.standby[id] = entry
+		keep[id] = true
+		result = append(result, entry)
+	}
+
+	for id := range s.standby {
+		if !keep[id] {
+			delete(s.standby, id)
+		}
+	}
+	s.removeStandbyFiles(keep)
+	return result, firstErr
+}
+
+// removeStandbyFiles deletes standby files of profiles not in keep.
+// Must be called with s.mu held.
+func (s *Storage) removeStandbyFiles(keep map[int]bool) {
+	matches, _ := filepath.Glob(filepath.Join(s.standbyDir(), "config_*.json"))
+	for _, path := range matches {
+		var id int
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if _, err := fmt.Sscanf(name, "config_%d", &id); err == nil && keep[id] {
+			continue
+		}
+		os.Remove(path)
+	}
+}
+
+// ClearStandbyConfigs deletes all standby configs.
+func (s *Storage) ClearStandbyConfigs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.standby = nil
+	os.RemoveAll(s.standbyDir())
+}
+
+// StandbyConfigs returns the current standby set.
+func (s *Storage) StandbyConfigs() map[int]StandbyConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[int]StandbyConfig, len(s.standby))
+	for id, entry := range s.standby {
+		entry.Stale = time.Since(entry.BuiltAt) > StandbyMaxAge
+		result[id] = entry
+	}
+	return result
+}
+
+// ActiveStandbyConfigPath returns the standby file of the active profile if it
+// still matches the profile config, so sing-box can start without writing a config.
+func (s *Storage) ActiveStandbyConfigPath() (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	activeID := s.data.App.ActiveProfileID
+	entry, ok := s.standby[activeID]
+	if !ok || !fileExists(entry.Path) {
+		return "", false
+	}
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID != activeID {
+			continue
+		}
+		data, err := s.renderRuntimeConfig(&s.data.Profiles[i])
+		if err != nil || configHash(data) != entry.Hash {
+			return "", false
+		}
+		return entry.Path, true
+	}
+	return "", false
+}
+
+// ProfileConfigHash returns the hash of the profile's runtime config ("" if none).
+func (s *Storage) ProfileConfigHash(id int) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.data.Profiles {
+		if s.data.Profiles[i].ID == id {
+			data, err := s.renderRuntimeConfig(&s.data.Profiles[i])
+			if err != nil {
+				return ""
+			}
+			return configHash(data)
+		}
+	}
+	return ""
+}
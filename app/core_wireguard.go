@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,12 +13,12 @@ import (
 type UserWireGuardConfig struct {
 	Tag            string   `json:"tag"`              // Уникальный тег (латиница, без пробелов)
 	Name           string   `json:"name"`             // Отображаемое имя
-	PrivateKey     string   `json:"private_key"`      // [Interface] PrivateKey
+	PrivateKey     SecretString `json:"private_key"`  // [Interface] PrivateKey (DPAPI in settings)
 	LocalAddress   []string `json:"local_address"`    // [Interface] Address
 	DNS            string   `json:"dns,omitempty"`    // [Interface] DNS (опционально)
 	MTU            int      `json:"mtu,omitempty"`    // [Interface] MTU (опционально)
 	PublicKey      string   `json:"public_key"`       // [Peer] PublicKey
-	PresharedKey   string   `json:"preshared_key,omitempty"` // [Peer] PresharedKey (опционально)
+	PresharedKey   SecretString `json:"preshared_key,omitempty"` // [Peer] PresharedKey (опционально, DPAPI in settings)
 	AllowedIPs     []string `json:"allowed_ips"`      // [Peer] AllowedIPs
 	Endpoint       string   `json:"endpoint"`         // [Peer] Endpoint (host без порта)
 	EndpointPort   int      `json:"endpoint_port"`    // Порт из Endpoint
@@ -25,8 +26,20 @@ type UserWireGuardConfig struct {
 	
 	// Внутренние домены для этого VPN (опционально, пользователь может добавить вручную)
 	// Примеры: [".company.local", ".internal.corp", ".test-test.com"]
-	// Если пусто - автоматически извлекаются из Endpoint
+	// Если пусто - автоматически извлекаются из Endpoint (см. InternalDomainsMode)
 	InternalDomains []string `json:"internal_domains,omitempty"`
+	
+	// Режим внутренних доменов: auto (по умолчанию), manual или none
+	InternalDomainsMode string `json:"internal_domains_mode,omitempty"`
+	
+	// PostUp/PostDown команды из .conf (wg-quick). Никогда не выполняются автоматически:
+	// пользователь должен явно разрешить их через AllowScripts
+	PostUp       []string `json:"post_up,omitempty"`
+	PostDown     []string `json:"post_down,omitempty"`
+	AllowScripts bool     `json:"allow_scripts,omitempty"`
+	
+	// Перезапускать туннель с MTU, найденным проверкой пути (один раз за запуск)
+	AutoMTU bool `json:"auto_mtu,omitempty"`
 }
 
 // ParseWireGuardConfig парсит стандартный WireGuard конфиг
@@ -67,7 +80,7 @@ func ParseWireGuardConfig(config string) (*UserWireGuardConfig, error) {
 		case "interface":
 			switch key {
 			case "privatekey":
-				wg.PrivateKey = value
+				wg.PrivateKey = NewSecret(value)
 			case "address":
 				// Может быть несколько адресов через запятую
 				addresses := strings.Split(value, ",")
@@ -87,6 +100,11 @@ func ParseWireGuardConfig(config string) (*UserWireGuardConfig, error) {
 				if mtu, err := strconv.Atoi(value); err == nil {
 					wg.MTU = mtu
 				}
+			case "postup":
+				// Сохраняем, но не выполняем без явного согласия
+				wg.PostUp = append(wg.PostUp, value)
+			case "postdown":
+				wg.PostDown = append(wg.PostDown, value)
 			}
 
 		case "peer":
@@ -94,7 +112,7 @@ func ParseWireGuardConfig(config string) (*UserWireGuardConfig, error) {
 			case "publickey":
 				wg.PublicKey = value
 			case "presharedkey":
-				wg.PresharedKey = value
+				wg.PresharedKey = NewSecret(value)
 			case "allowedips":
 				// Может быть несколько IP через запятую
 				ips := strings.Split(value, ",")
@@ -105,12 +123,12 @@ func ParseWireGuardConfig(config string) (*UserWireGuardConfig, error) {
 					}
 				}
 			case "endpoint":
-				wg.Endpoint = value
-				// Извлекаем порт
-				if idx := strings.LastIndex(value, ":"); idx != -1 {
-					if port, err := strconv.Atoi(value[idx+1:]); err == nil {
+				// Извлекаем порт; IPv6 адрес записывается в скобках: [2001:db8::1]:51820
+				wg.Endpoint = strings.Trim(value, "[]")
+				if host, portStr, err := net.SplitHostPort(value); err == nil {
+					if port, err := strconv.Atoi(portStr); err == nil {
 						wg.EndpointPort = port
-						wg.Endpoint = value[:idx] // Только хост
+						wg.Endpoint = host // Только хост, без скобок
 					}
 				}
 			case "persistentkeepalive":
@@ -122,7 +140,7 @@ func ParseWireGuardConfig(config string) (*UserWireGuardConfig, error) {
 	}
 
 	// Валидация обязательных полей
-	if wg.PrivateKey == "" {
+	if wg.PrivateKey.Value() == "" {
 		return nil, fmt.Errorf("отсутствует PrivateKey")
 	}
 	if len(wg.LocalAddress) == 0 {
@@ -137,6 +155,9 @@ func ParseWireGuardConfig(config string) (*UserWireGuardConfig, error) {
 	if wg.Endpoint == "" {
 		return nil, fmt.Errorf("отсутствует Endpoint")
 	}
+	if err := ValidateWireGuardKeys(wg); err != nil {
+		return nil, err
+	}
 
 	return wg, nil
 }
@@ -181,27 +202,31 @@ func ValidateAllowedIPs(allowedIPs []string) error {
 	return nil
 }
 
-// ExtractNetworksFromAllowedIPs извлекает сетевые адреса из AllowedIPs для DNS bypass
-// Возвращает список CIDR, которые относятся к WireGuard сетям
+// ExtractNetworksFromAllowedIPs извлекает сетевые адреса из AllowedIPs для маршрутизации
+// Возвращает список CIDR, которые относятся к WireGuard сетям: одиночные IP
+// получают /32 или /128, биты хоста обнуляются, повторы и невалидные записи
+// отбрасываются. Полное перенаправление (0.0.0.0/0, ::/0 и половины /1)
+// пропускается: такое правило отправило бы весь трафик мимо прокси.
 func ExtractNetworksFromAllowedIPs(allowedIPs []string) []string {
 	var networks []string
+	seen := map[netip.Prefix]bool{}
 	for _, cidr := range allowedIPs {
 		cidr = strings.TrimSpace(cidr)
-		// Проверяем что это валидный CIDR
-		_, _, err := net.ParseCIDR(cidr)
+		prefix, err := netip.ParsePrefix(cidr)
 		if err != nil {
-			// Может быть одиночный IP, добавляем /32
-			if ip := net.ParseIP(cidr); ip != nil {
-				if ip.To4() != nil {
-					cidr = cidr + "/32"
-				} else {
-					cidr = cidr + "/128"
-				}
-			} else {
+			// Может быть одиночный IP
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
 				continue
 			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
 		}
-		networks = append(networks, cidr)
+		prefix = prefix.Masked()
+		if prefix.Bits() <= 1 || seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		networks = append(networks, prefix.String())
 	}
 	return networks
 }
@@ -230,37 +255,80 @@ type WireGuardInfo struct {
 	Endpoint        string   `json:"endpoint"`
 	AllowedIPs      []string `json:"allowed_ips"`
 	InternalDomains []string `json:"internal_domains,omitempty"`
+	InternalDomainsMode string `json:"internal_domains_mode"`
 }
 
-// ToInfo конвертирует в структуру для UI
-func (wg *UserWireGuardConfig) ToInfo() WireGuardInfo {
-	endpoint := wg.Endpoint
+// EndpointAddress возвращает Endpoint с портом (IPv6 в скобках)
+func (wg *UserWireGuardConfig) EndpointAddress() string {
+	host := strings.Trim(wg.Endpoint, "[]") // Скобки из настроек старых версий
 	if wg.EndpointPort > 0 {
-		endpoint = fmt.Sprintf("%s:%d", wg.Endpoint, wg.EndpointPort)
+		return net.JoinHostPort(host, strconv.Itoa(wg.EndpointPort))
 	}
-	
+	return host
+}
+
+// ToInfo конвертирует в структуру для UI
+func (wg *UserWireGuardConfig) ToInfo() WireGuardInfo {
 	return WireGuardInfo{
 		Tag:             wg.Tag,
 		Name:            wg.Name,
-		Endpoint:        endpoint,
+		Endpoint:        wg.EndpointAddress(),
 		AllowedIPs:      wg.AllowedIPs,
 		InternalDomains: wg.InternalDomains,
+		InternalDomainsMode: wg.GetInternalDomainsMode(),
+	}
+}
+
+// Режимы внутренних доменов WireGuard конфига
+const (
+	InternalDomainsAuto   = "auto"   // Явно заданные домены, иначе извлечённые из Endpoint
+	InternalDomainsManual = "manual" // Только явно заданные домены
+	InternalDomainsNone   = "none"   // Без DNS правил для внутренних доменов
+)
+
+// ValidateInternalDomainsMode проверяет режим внутренних доменов ("" = auto)
+func ValidateInternalDomainsMode(mode string) error {
+	switch mode {
+	case "", InternalDomainsAuto, InternalDomainsManual, InternalDomainsNone:
+		return nil
 	}
+	return fmt.Errorf("неизвестный режим внутренних доменов: %s (допустимо: auto, manual, none)", mode)
+}
+
+// GetInternalDomainsMode возвращает режим внутренних доменов (пустой = auto)
+func (wg *UserWireGuardConfig) GetInternalDomainsMode() string {
+	if wg.InternalDomainsMode == "" {
+		return InternalDomainsAuto
+	}
+	return wg.InternalDomainsMode
 }
 
 // GetInternalDomains возвращает все внутренние домены для этого WireGuard конфига
-// Если InternalDomains задан явно - возвращает его
-// Иначе пытается автоматически извлечь из Endpoint
+// с учётом режима: none - ничего, manual - только InternalDomains,
+// auto - InternalDomains если задан, иначе извлечённые из Endpoint
 func (wg *UserWireGuardConfig) GetInternalDomains() []string {
+	switch wg.GetInternalDomainsMode() {
+	case InternalDomainsNone:
+		return []string{}
+	case InternalDomainsManual:
+		return wg.InternalDomains
+	}
+	
 	// Если пользователь явно указал домены - используем их
 	if len(wg.InternalDomains) > 0 {
 		return wg.InternalDomains
 	}
 	
-	// Автоматическое извлечение из Endpoint
+	return wg.DerivedInternalDomains()
+}
+
+// DerivedInternalDomains извлекает внутренние домены из Endpoint
+// (стандартные внутренние и публичные суффиксы отфильтрованы)
+func (wg *UserWireGuardConfig) DerivedInternalDomains() []string {
 	domains := []string{}
 	
-	if wg.Endpoint != "" {
+	// IP endpoint has no domain to derive from
+	if wg.Endpoint != "" && net.ParseIP(strings.Trim(wg.Endpoint, "[]")) == nil {
 		// Извлекаем домен из endpoint (например, vpn.company.local -> .company.local)
 		parts := strings.Split(wg.Endpoint, ".")
 		if len(parts) >= 2 {
@@ -278,6 +346,40 @@ func (wg *UserWireGuardConfig) GetInternalDomains() []string {
 	return domains
 }
 
+// DNSDomainSuffixes возвращает суффиксы DNS правила туннеля с учётом режима:
+// none - ничего, manual - только заданные домены, auto - внутренние домены
+// плюс .local и .<tag>.local
+func (wg *UserWireGuardConfig) DNSDomainSuffixes() []string {
+	domains := wg.GetInternalDomains()
+	if wg.GetInternalDomainsMode() == InternalDomainsAuto {
+		domains = append(append([]string{}, domains...), ".local", "."+wg.Tag+".local")
+	}
+
+	seen := make(map[string]bool)
+	suffixes := []string{}
+	for _, domain := range domains {
+		domain = normalizeInternalDomain(domain)
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			suffixes = append(suffixes, domain)
+		}
+	}
+	return suffixes
+}
+
+// normalizeInternalDomain приводит домен к виду ".company.local" ("" для пустого)
+func normalizeInternalDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return ""
+	}
+	// Добавляем точку в начало если нет
+	if !strings.HasPrefix(domain, ".") {
+		domain = "." + domain
+	}
+	return domain
+}
+
 // CollectAllInternalDomains собирает все внутренние домены из всех WireGuard конфигов
 // Возвращает уникальный список доменов для DNS rules
 func CollectAllInternalDomains(configs []UserWireGuardConfig) []string {
@@ -286,15 +388,8 @@ func CollectAllInternalDomains(configs []UserWireGuardConfig) []string {
 	
 	for _, wg := range configs {
 		for _, domain := range wg.GetInternalDomains() {
-			domain = strings.ToLower(strings.TrimSpace(domain))
-			if domain == "" {
-				continue
-			}
-			// Добавляем точку в начало если нет
-			if !strings.HasPrefix(domain, ".") {
-				domain = "." + domain
-			}
-			if !seen[domain] {
+			domain = normalizeInternalDomain(domain)
+			if domain != "" && !seen[domain] {
 				seen[domain] = true
 				domains = append(domains, domain)
 			}
@@ -342,6 +437,7 @@ type WireGuardConfig struct {
 	Address    []string
 	DNS        string
 	MTU        int
+	AutoMTU    bool // Restart once with the probed path MTU
 	Peers      []WireGuardPeer
 }
 
@@ -358,14 +454,15 @@ type WireGuardPeer struct {
 // ToWireGuardConfig converts UserWireGuardConfig to WireGuardConfig for native manager
 func (wg *UserWireGuardConfig) ToWireGuardConfig() *WireGuardConfig {
 	return &WireGuardConfig{
-		PrivateKey: wg.PrivateKey,
+		PrivateKey: wg.PrivateKey.Value(),
 		Address:    wg.LocalAddress,
 		DNS:        wg.DNS,
 		MTU:        wg.MTU,
+		AutoMTU:    wg.AutoMTU,
 		Peers: []WireGuardPeer{
 			{
 				PublicKey:           wg.PublicKey,
-				PresharedKey:        wg.PresharedKey,
+				PresharedKey:        wg.PresharedKey.Value(),
 				Endpoint:            wg.Endpoint,
 				Port:                wg.EndpointPort,
 				AllowedIPs:          wg.AllowedIPs,
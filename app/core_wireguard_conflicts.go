@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Kinds of conflicts between WireGuard configs of one profile
+const (
+	WGConflictAddress    = "address"     // Same interface address
+	WGConflictPrivateKey = "private_key" // Same private key
+	WGConflictPeer       = "peer"        // Same endpoint + peer public key
+	WGConflictSubnet     = "subnet"      // Address or AllowedIPs networks overlap
+	WGConflictTUN        = "tun"         // Address or AllowedIPs overlap the sing-box TUN subnet
+	WGConflictRuntime    = "runtime"     // Tunnel service reported a conflict on start
+)
+
+// WireGuardConflictError describes two configs that cannot run side by side.
+type WireGuardConflictError struct {
+	Tag      string `json:"tag"`
+	OtherTag string `json:"other_tag,omitempty"`
+	Kind     string `json:"kind"`
+	Value    string `json:"value,omitempty"`
+	// Network of the other side for subnet and TUN overlaps
+	OtherValue string `json:"other_value,omitempty"`
+}
+
+func (e *WireGuardConflictError) Error() string {
+	switch e.Kind {
+	case WGConflictAddress:
+		return fmt.Sprintf("Конфиги '%s' и '%s' используют одинаковый адрес интерфейса %s", e.Tag, e.OtherTag, e.Value)
+	case WGConflictPrivateKey:
+		return fmt.Sprintf("Конфиги '%s' и '%s' используют одинаковый приватный ключ", e.Tag, e.OtherTag)
+	case WGConflictPeer:
+		return fmt.Sprintf("Конфиги '%s' и '%s' подключаются к одному серверу %s с одним ключом", e.Tag, e.OtherTag, e.Value)
+	case WGConflictSubnet:
+		return fmt.Sprintf("Сети конфигов '%s' и '%s' пересекаются: %s и %s", e.Tag, e.OtherTag, e.Value, e.OtherValue)
+	case WGConflictTUN:
+		return fmt.Sprintf("Конфиг '%s': %s пересекается с подсетью TUN sing-box %s", e.Tag, e.Value, e.OtherValue)
+	default:
+		if e.OtherTag != "" {
+			return fmt.Sprintf("Туннель '%s' конфликтует с '%s': %s", e.Tag, e.OtherTag, e.Value)
+		}
+		return fmt.Sprintf("Туннель '%s' конфликтует с уже существующим интерфейсом: %s", e.Tag, e.Value)
+	}
+}
+
+// ToMap converts the conflict to API response format.
+func (e *WireGuardConflictError) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"tag":         e.Tag,
+		"other_tag":   e.OtherTag,
+		"kind":        e.Kind,
+		"value":       e.Value,
+		"other_value": e.OtherValue,
+		"message":     e.Error(),
+	}
+}
+
+// normalizeInterfaceAddress returns the IP part of an Address entry ("10.0.0.2/32" -> "10.0.0.2").
+func normalizeInterfaceAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if ip, _, err := net.ParseCIDR(addr); err == nil {
+		return ip.String()
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(addr)
+}
+
+// FindWireGuardConflict checks wg against other configs of the same profile.
+// Returns nil if wg can run alongside all of them.
+func FindWireGuardConflict(wg UserWireGuardConfig, others []UserWireGuardConfig) *WireGuardConflictError {
+	addresses := make(map[string]bool, len(wg.LocalAddress))
+	for _, addr := range wg.LocalAddress {
+		addresses[normalizeInterfaceAddress(addr)] = true
+	}
+
+	for _, other := range others {
+		if other.Tag == wg.Tag {
+			continue
+		}
+
+		for _, addr := range other.LocalAddress {
+			normalized := normalizeInterfaceAddress(addr)
+			if addresses[normalized] {
+				return &WireGuardConflictError{Tag: wg.Tag, OtherTag: other.Tag, Kind: WGConflictAddress, Value: normalized}
+			}
+		}
+
+		if wg.PrivateKey.Value() != "" && wg.PrivateKey.Value() == other.PrivateKey.Value() {
+			return &WireGuardConflictError{Tag: wg.Tag, OtherTag: other.Tag, Kind: WGConflictPrivateKey}
+		}
+
+		if wg.PublicKey != "" && wg.PublicKey == other.PublicKey &&
+			strings.EqualFold(wg.Endpoint, other.Endpoint) && wg.EndpointPort == other.EndpointPort {
+			return &WireGuardConflictError{
+				Tag:      wg.Tag,
+				OtherTag: other.Tag,
+				Kind:     WGConflictPeer,
+				Value:    wg.EndpointAddress(),
+			}
+		}
+
+		if cidr, otherCIDR, ok := findOverlap(wireGuardNetworks(wg), wireGuardNetworks(other)); ok {
+			return &WireGuardConflictError{
+				Tag:        wg.Tag,
+				OtherTag:   other.Tag,
+				Kind:       WGConflictSubnet,
+				Value:      cidr,
+				OtherValue: otherCIDR,
+			}
+		}
+	}
+	return nil
+}
+
+// networkEntry is an Address or AllowedIPs entry with its parsed network
+type networkEntry struct {
+	text   string
+	prefix netip.Prefix
+}
+
+// parseNetworkEntries parses CIDRs and single IPs; unparsable entries are skipped
+func parseNetworkEntries(entries []string) []networkEntry {
+	parsed := []networkEntry{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			parsed = append(parsed, networkEntry{text: entry, prefix: prefix.Masked()})
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			parsed = append(parsed, networkEntry{text: entry, prefix: netip.PrefixFrom(addr, addr.BitLen())})
+		}
+	}
+	return parsed
+}
+
+// wireGuardNetworks returns the interface addresses and AllowedIPs of a config
+func wireGuardNetworks(wg UserWireGuardConfig) []networkEntry {
+	entries := append(append([]string{}, wg.LocalAddress...), wg.AllowedIPs...)
+	return parseNetworkEntries(entries)
+}
+
+// findOverlap returns the first pair of overlapping networks
+func findOverlap(a, b []networkEntry) (string, string, bool) {
+	for _, x := range a {
+		for _, y := range b {
+			if x.prefix.Overlaps(y.prefix) {
+				return x.text, y.text, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// tunSubnets returns the addresses of the tun inbound of a sing-box config:
+// "address" of current sing-box or "inet4_address"/"inet6_address" of older templates.
+func tunSubnets(config map[string]interface{}) []networkEntry {
+	inbounds, _ := config["inbounds"].([]interface{})
+	entries := []string{}
+	for _, in := range inbounds {
+		inbound, ok := in.(map[string]interface{})
+		if !ok || inbound["type"] != "tun" {
+			continue
+		}
+		for _, key := range []string{"address", "inet4_address", "inet6_address"} {
+			switch v := inbound[key].(type) {
+			case string:
+				entries = append(entries, v)
+			case []interface{}:
+				for _, item := range v {
+					if s, ok := item.(string); ok {
+						entries = append(entries, s)
+					}
+				}
+			}
+		}
+	}
+	return parseNetworkEntries(entries)
+}
+
+// templateTUNSubnets reads the TUN subnets of template.json (nil if unreadable)
+func templateTUNSubnets(templatePath string) []networkEntry {
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil
+	}
+	var template map[string]interface{}
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil
+	}
+	return tunSubnets(template)
+}
+
+// FindTUNConflict checks the Address and AllowedIPs of wg against the TUN
+// subnets. Returns nil if they don't overlap.
+func FindTUNConflict(wg UserWireGuardConfig, tun []networkEntry) *WireGuardConflictError {
+	if cidr, tunCIDR, ok := findOverlap(wireGuardNetworks(wg), tun); ok {
+		return &WireGuardConflictError{Tag: wg.Tag, Kind: WGConflictTUN, Value: cidr, OtherValue: tunCIDR}
+	}
+	return nil
+}
+
+// FindWireGuardConflicts checks all configs of a profile in order. A config that
+// conflicts with an earlier one is reported; earlier configs win.
+func FindWireGuardConflicts(configs []UserWireGuardConfig) map[int]*WireGuardConflictError {
+	conflicts := make(map[int]*WireGuardConflictError)
+	for i := 1; i < len(configs); i++ {
+		accepted := make([]UserWireGuardConfig, 0, i)
+		for j := 0; j < i; j++ {
+			if conflicts[j] == nil {
+				accepted = append(accepted, configs[j])
+			}
+		}
+		if conflict := FindWireGuardConflict(configs[i], accepted); conflict != nil {
+			conflicts[i] = conflict
+		}
+	}
+	return conflicts
+}
+
+// tunnelConflictSignatures are service errors that mean the address/interface is taken.
+var tunnelConflictSignatures = []string{
+	"address already in use",
+	"only one usage of each socket address",
+	"interface exists",
+	"already exists",
+	"object name already exists",
+}
+
+// classifyTunnelStartError maps tunnel service start failures caused by a
+// conflicting interface to WireGuardConflictError. Other errors are returned as is.
+func classifyTunnelStartError(tag string, err error) error {
+	if err == nil {
+		return nil
+	}
+	lower := strings.ToLower(err.Error())
+	for _, signature := range tunnelConflictSignatures {
+		if strings.Contains(lower, signature) {
+			return &WireGuardConflictError{Tag: tag, Kind: WGConflictRuntime, Value: err.Error()}
+		}
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// conflictConf returns a .conf text with the given interface and peer values
+func conflictConf(address, privateKey, publicKey, endpoint, allowedIPs string) string {
+	return fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = %s
+
+[Peer]
+PublicKey = %s
+AllowedIPs = %s
+Endpoint = %s
+`, privateKey, address, publicKey, allowedIPs, endpoint)
+}
+
+// testKeyPair generates a WireGuard key pair for the test
+func testKeyPair(t *testing.T) *WireGuardKeyPair {
+	t.Helper()
+	keys, err := GenerateWireGuardKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateWireGuardKeyPair: %v", err)
+	}
+	return keys
+}
+
+// testWireGuardApp returns an App whose active profile builds without network access
+func testWireGuardApp(t *testing.T) *App {
+	t.Helper()
+	a, _ := testActivationApp(t)
+	a.configBuilder = NewConfigBuilderForStorage(a.storage)
+	a.configBuilder.resolver, _ = fakeResolver(nil)
+	if err := a.storage.UpdateProfileSubscription(a.storage.GetActiveProfileID(), testDirectLink, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// assertConflict checks the API result refuses with a conflict of kind between tag and otherTag
+func assertConflict(t *testing.T, result map[string]interface{}, kind, tag, otherTag string) {
+	t.Helper()
+	if result["success"] != false {
+		t.Fatalf("result = %v, want a refused conflict", result)
+	}
+	conflict, _ := result["conflict"].(map[string]interface{})
+	if conflict["kind"] != kind || conflict["tag"] != tag || conflict["other_tag"] != otherTag {
+		t.Fatalf("conflict = %v, want %s between %s and %s", conflict, kind, tag, otherTag)
+	}
+	message, _ := result["error"].(string)
+	if !strings.Contains(message, "'"+tag+"'") || !strings.Contains(message, "'"+otherTag+"'") {
+		t.Errorf("error %q does not name both configs", message)
+	}
+}
+
+func TestFindWireGuardConflict(t *testing.T) {
+	office := UserWireGuardConfig{
+		Tag:          "office",
+		PrivateKey:   NewSecret("office-private"),
+		PublicKey:    "office-peer",
+		Endpoint:     "vpn.office.example",
+		EndpointPort: 51820,
+		LocalAddress: []string{"10.20.0.2/32", "fd00::2/128"},
+		AllowedIPs:   []string{"10.20.0.0/24"},
+	}
+
+	tests := []struct {
+		name  string
+		wg    UserWireGuardConfig
+		kind  string
+		value string
+	}{
+		{
+			name: "same address without prefix",
+			wg:   UserWireGuardConfig{Tag: "lab", LocalAddress: []string{"10.20.0.2"}},
+			kind: WGConflictAddress, value: "10.20.0.2",
+		},
+		{
+			name: "same IPv6 address in another notation",
+			wg:   UserWireGuardConfig{Tag: "lab", LocalAddress: []string{"FD00:0:0::0002/64"}},
+			kind: WGConflictAddress, value: "fd00::2",
+		},
+		{
+			name: "same private key",
+			wg:   UserWireGuardConfig{Tag: "lab", PrivateKey: NewSecret("office-private"), LocalAddress: []string{"10.30.0.2/32"}},
+			kind: WGConflictPrivateKey,
+		},
+		{
+			name: "same endpoint and public key",
+			wg: UserWireGuardConfig{
+				Tag: "lab", PrivateKey: NewSecret("lab-private"), PublicKey: "office-peer",
+				Endpoint: "VPN.Office.Example", EndpointPort: 51820, LocalAddress: []string{"10.30.0.2/32"},
+			},
+			kind: WGConflictPeer, value: "VPN.Office.Example:51820",
+		},
+		{
+			name: "overlapping networks",
+			wg:   UserWireGuardConfig{Tag: "lab", LocalAddress: []string{"10.30.0.2/32"}, AllowedIPs: []string{"10.20.0.128/25"}},
+			kind: WGConflictSubnet, value: "10.20.0.128/25",
+		},
+		{
+			name: "same public key on another port",
+			wg: UserWireGuardConfig{
+				Tag: "lab", PrivateKey: NewSecret("lab-private"), PublicKey: "office-peer",
+				Endpoint: "vpn.office.example", EndpointPort: 51821, LocalAddress: []string{"10.30.0.2/32"},
+			},
+		},
+		{
+			name: "separate tunnel",
+			wg: UserWireGuardConfig{
+				Tag: "lab", PrivateKey: NewSecret("lab-private"), PublicKey: "lab-peer",
+				Endpoint: "vpn.lab.example", EndpointPort: 51820,
+				LocalAddress: []string{"10.30.0.2/32"}, AllowedIPs: []string{"10.30.0.0/24"},
+			},
+		},
+		{
+			name: "same tag is the config itself",
+			wg:   office,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict := FindWireGuardConflict(tt.wg, []UserWireGuardConfig{office})
+			if tt.kind == "" {
+				if conflict != nil {
+					t.Fatalf("conflict = %+v, want none", conflict)
+				}
+				return
+			}
+			if conflict == nil {
+				t.Fatalf("no conflict, want %s", tt.kind)
+			}
+			if conflict.Kind != tt.kind || conflict.Tag != "lab" || conflict.OtherTag != "office" {
+				t.Errorf("conflict = %+v, want %s between lab and office", conflict, tt.kind)
+			}
+			if tt.value != "" && conflict.Value != tt.value {
+				t.Errorf("value = %q, want %q", conflict.Value, tt.value)
+			}
+		})
+	}
+}
+
+func TestFindWireGuardConflictsEarlierWins(t *testing.T) {
+	configs := []UserWireGuardConfig{
+		{Tag: "first", LocalAddress: []string{"10.20.0.2/32"}},
+		{Tag: "copy", LocalAddress: []string{"10.20.0.2/32", "10.40.0.2/32"}},
+		// Conflicts only with the skipped copy, so it still starts
+		{Tag: "third", LocalAddress: []string{"10.40.0.2/32"}},
+		{Tag: "fourth", PrivateKey: NewSecret("shared"), LocalAddress: []string{"10.50.0.2/32"}},
+		{Tag: "fifth", PrivateKey: NewSecret("shared"), LocalAddress: []string{"10.60.0.2/32"}},
+	}
+
+	conflicts := FindWireGuardConflicts(configs)
+	if len(conflicts) != 2 {
+		t.Fatalf("conflicts = %v, want copy and fifth", conflicts)
+	}
+	if c := conflicts[1]; c == nil || c.Tag != "copy" || c.OtherTag != "first" || c.Kind != WGConflictAddress {
+		t.Errorf("conflicts[1] = %+v, want copy conflicting with first", c)
+	}
+	if c := conflicts[4]; c == nil || c.Tag != "fifth" || c.OtherTag != "fourth" || c.Kind != WGConflictPrivateKey {
+		t.Errorf("conflicts[4] = %+v, want fifth conflicting with fourth", c)
+	}
+}
+
+func TestClassifyTunnelStartError(t *testing.T) {
+	tests := []struct {
+		err      string
+		conflict bool
+	}{
+		{"listen udp 0.0.0.0:51820: bind: address already in use", true},
+		{"bind: Only one usage of each socket address (protocol/network address/port) is normally permitted.", true},
+		{"wintun: interface exists", true},
+		{"CreateService: The specified service already exists.", true},
+		{"Cannot create a file when that file already exists: Object name already exists", true},
+		{"OpenSCManager: Access is denied.", false},
+		{"invalid private key", false},
+	}
+
+	for _, tt := range tests {
+		err := classifyTunnelStartError("office", errors.New(tt.err))
+		var conflict *WireGuardConflictError
+		if errors.As(err, &conflict) != tt.conflict {
+			t.Errorf("classifyTunnelStartError(%q) = %T, conflict want %v", tt.err, err, tt.conflict)
+			continue
+		}
+		if tt.conflict && (conflict.Kind != WGConflictRuntime || conflict.Tag != "office" || conflict.Value != tt.err) {
+			t.Errorf("conflict = %+v", conflict)
+		}
+		if !tt.conflict && err.Error() != tt.err {
+			t.Errorf("error = %q, want it unchanged", err)
+		}
+	}
+	if classifyTunnelStartError("office", nil) != nil {
+		t.Error("nil error classified as a failure")
+	}
+}
+
+func TestAddWireGuardRefusesConflicts(t *testing.T) {
+	office := testKeyPair(t)
+	peer := testKeyPair(t)
+	other := testKeyPair(t)
+
+	tests := []struct {
+		name string
+		conf string
+		kind string
+	}{
+		{"duplicate address", conflictConf("10.20.0.2", other.PrivateKey, other.PublicKey, "vpn.lab.example:51820", "10.30.0.0/24"), WGConflictAddress},
+		{"same private key", conflictConf("10.30.0.2/32", office.PrivateKey, other.PublicKey, "vpn.lab.example:51820", "10.30.0.0/24"), WGConflictPrivateKey},
+		{"same endpoint and peer key", conflictConf("10.30.0.2/32", other.PrivateKey, peer.PublicKey, "vpn.office.example:51820", "10.30.0.0/24"), WGConflictPeer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testWireGuardApp(t)
+			first := conflictConf("10.20.0.2/32", office.PrivateKey, peer.PublicKey, "vpn.office.example:51820", "10.20.0.0/24")
+			if result := a.AddWireGuard("office", "Office", first); result["success"] != true {
+				t.Fatalf("AddWireGuard(office) = %v", result)
+			}
+
+			assertConflict(t, a.AddWireGuard("lab", "Lab", tt.conf), tt.kind, "lab", "office")
+
+			settings, err := a.storage.GetUserSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(settings.WireGuardConfigs) != 1 {
+				t.Errorf("stored %d configs, want only office", len(settings.WireGuardConfigs))
+			}
+		})
+	}
+}
+
+func TestUpdateWireGuardRefusesIntroducedConflict(t *testing.T) {
+	a := testWireGuardApp(t)
+	office := testKeyPair(t)
+	lab := testKeyPair(t)
+	peer := testKeyPair(t)
+
+	officeConf := conflictConf("10.20.0.2/32", office.PrivateKey, peer.PublicKey, "vpn.office.example:51820", "10.20.0.0/24")
+	labConf := conflictConf("10.30.0.2/32", lab.PrivateKey, peer.PublicKey, "vpn.lab.example:51820", "10.30.0.0/24")
+	for tag, conf := range map[string]string{"office": officeConf, "lab": labConf} {
+		if result := a.AddWireGuard(tag, tag, conf); result["success"] != true {
+			t.Fatalf("AddWireGuard(%s) = %v", tag, result)
+		}
+	}
+
+	// Editing a config without changing its own address is not a conflict with itself
+	edited := conflictConf("10.30.0.2/32", lab.PrivateKey, peer.PublicKey, "vpn.lab.example:51821", "10.30.0.0/24")
+	if result := a.UpdateWireGuard("lab", "lab", "Lab", edited); result["success"] != true {
+		t.Fatalf("UpdateWireGuard without conflict = %v", result)
+	}
+
+	copied := conflictConf("10.20.0.2/32", lab.PrivateKey, peer.PublicKey, "vpn.lab.example:51821", "10.30.0.0/24")
+	assertConflict(t, a.UpdateWireGuard("lab", "lab", "Lab", copied), WGConflictAddress, "lab", "office")
+
+	settings, err := a.storage.GetUserSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wg := range settings.WireGuardConfigs {
+		if wg.Tag == "lab" && !equalStringSlices(wg.LocalAddress, []string{"10.30.0.2/32"}) {
+			t.Errorf("lab address = %v, the refused update was stored", wg.LocalAddress)
+		}
+	}
+}
+
+func TestImportRefusesConflictingWireGuard(t *testing.T) {
+	a, _ := testActivationApp(t)
+
+	data := `{"version":"1.0.0","profiles":[{"id":1,"name":"Work","wireguard_configs":[
+		{"tag":"office","name":"Office","private_key":"office-private","local_address":["10.20.0.2/32"]},
+		{"tag":"copy","name":"Copy","private_key":"copy-private","local_address":["10.20.0.2/32"]}
+	]}]}`
+
+	for name, result := range map[string]map[string]interface{}{
+		"validate": a.ValidateImportData(data),
+		"import":   a.ImportAllProfiles(data),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assertConflict(t, result, WGConflictAddress, "copy", "office")
+			if message, _ := result["error"].(string); !strings.Contains(message, "'Work'") {
+				t.Errorf("error %q does not name the profile", message)
+			}
+		})
+	}
+	if profiles := a.storage.GetAllProfiles(); len(profiles) != 2 {
+		t.Errorf("profiles = %d after a refused import, want the 2 existing", len(profiles))
+	}
+}
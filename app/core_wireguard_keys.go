@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// WireGuardKeyPair пара ключей Curve25519 в base64, как у `wg genkey | wg pubkey`
+type WireGuardKeyPair struct {
+	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
+}
+
+// GenerateWireGuardKeyPair генерирует новую пару ключей WireGuard
+func GenerateWireGuardKeyPair() (*WireGuardKeyPair, error) {
+	var private [curve25519.ScalarSize]byte
+	if _, err := rand.Read(private[:]); err != nil {
+		return nil, fmt.Errorf("не удалось сгенерировать ключ: %w", err)
+	}
+	// Clamping как в wg genkey
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+
+	public, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось вычислить публичный ключ: %w", err)
+	}
+	return &WireGuardKeyPair{
+		PrivateKey: base64.StdEncoding.EncodeToString(private[:]),
+		PublicKey:  base64.StdEncoding.EncodeToString(public),
+	}, nil
+}
+
+// decodeWireGuardKey декодирует ключ: base64 ровно 32 байт
+func decodeWireGuardKey(key string, field string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: некорректный base64", field)
+	}
+	if len(decoded) != curve25519.PointSize {
+		return nil, fmt.Errorf("%s: ключ должен быть %d байт, получено %d", field, curve25519.PointSize, len(decoded))
+	}
+	return decoded, nil
+}
+
+// ValidateWireGuardKeys проверяет формат ключей конфига (PresharedKey опционален)
+func ValidateWireGuardKeys(wg *UserWireGuardConfig) error {
+	// Ключ, который не удалось расшифровать из settings.json
+	if err := wg.PrivateKey.Err(); err != nil {
+		return fmt.Errorf("PrivateKey: %w", err)
+	}
+	if err := wg.PresharedKey.Err(); err != nil {
+		return fmt.Errorf("PresharedKey: %w", err)
+	}
+	if _, err := decodeWireGuardKey(wg.PrivateKey.Value(), "PrivateKey"); err != nil {
+		return err
+	}
+	if _, err := decodeWireGuardKey(wg.PublicKey, "PublicKey"); err != nil {
+		return err
+	}
+	if wg.PresharedKey.Value() != "" {
+		if _, err := decodeWireGuardKey(wg.PresharedKey.Value(), "PresharedKey"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WireGuardFields поля WireGuard конфига, введённые по отдельности (без текста .conf)
+type WireGuardFields struct {
+	PrivateKey          string   `json:"private_key"`
+	Address             []string `json:"address"` // [Interface] Address, например 10.0.0.2/32
+	DNS                 string   `json:"dns,omitempty"`
+	MTU                 int      `json:"mtu,omitempty"`
+	PeerPublicKey       string   `json:"peer_public_key"`
+	PresharedKey        string   `json:"preshared_key,omitempty"`
+	Endpoint            string   `json:"endpoint"` // host:port, IPv6 в скобках
+	AllowedIPs          []string `json:"allowed_ips"`
+	PersistentKeepalive int      `json:"persistent_keepalive,omitempty"`
+}
+
+// NewWireGuardConfigFromFields собирает UserWireGuardConfig из отдельных полей
+func NewWireGuardConfigFromFields(fields WireGuardFields) (*UserWireGuardConfig, error) {
+	wg := &UserWireGuardConfig{
+		PrivateKey:          NewSecret(strings.TrimSpace(fields.PrivateKey)),
+		LocalAddress:        trimNonEmpty(fields.Address),
+		DNS:                 strings.TrimSpace(fields.DNS),
+		MTU:                 fields.MTU,
+		PublicKey:           strings.TrimSpace(fields.PeerPublicKey),
+		PresharedKey:        NewSecret(strings.TrimSpace(fields.PresharedKey)),
+		AllowedIPs:          trimNonEmpty(fields.AllowedIPs),
+		PersistentKeepalive: fields.PersistentKeepalive,
+	}
+	if wg.MTU == 0 {
+		wg.MTU = 1280 // Default MTU, как в ParseWireGuardConfig
+	}
+
+	if len(wg.LocalAddress) == 0 {
+		return nil, fmt.Errorf("отсутствует Address")
+	}
+	for _, addr := range wg.LocalAddress {
+		if !isIPOrPrefix(addr) {
+			return nil, fmt.Errorf("некорректный Address: %s", addr)
+		}
+	}
+	if len(wg.AllowedIPs) == 0 {
+		return nil, fmt.Errorf("отсутствует AllowedIPs")
+	}
+	for _, cidr := range wg.AllowedIPs {
+		if !isIPOrPrefix(cidr) {
+			return nil, fmt.Errorf("некорректный AllowedIPs: %s", cidr)
+		}
+	}
+	if wg.DNS != "" {
+		if _, err := netip.ParseAddr(wg.DNS); err != nil {
+			return nil, fmt.Errorf("некорректный DNS: %s", wg.DNS)
+		}
+	}
+	if wg.MTU < 576 || wg.MTU > 65535 {
+		return nil, fmt.Errorf("некорректный MTU: %d", wg.MTU)
+	}
+	if wg.PersistentKeepalive < 0 || wg.PersistentKeepalive > 65535 {
+		return nil, fmt.Errorf("некорректный PersistentKeepalive: %d", wg.PersistentKeepalive)
+	}
+
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(fields.Endpoint))
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("Endpoint должен быть в формате host:port")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("некорректный порт Endpoint: %s", portStr)
+	}
+	wg.Endpoint = host
+	wg.EndpointPort = port
+
+	if err := ValidateWireGuardKeys(wg); err != nil {
+		return nil, err
+	}
+	return wg, nil
+}
+
+// isIPOrPrefix проверяет что s - IP адрес или CIDR
+func isIPOrPrefix(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// trimNonEmpty обрезает пробелы и убирает пустые элементы
+func trimNonEmpty(values []string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
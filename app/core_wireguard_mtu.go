@@ -0,0 +1,226 @@
+// Package main provides path MTU discovery for WireGuard tunnels for KampusVPN.
+// A config without MTU gets the safe 1280, which wastes bandwidth on most
+// networks, while a hand-picked larger value silently stalls connections on
+// PPPoE or LTE. After a tunnel starts, the path MTU to the peer endpoint is
+// binary-searched with don't-fragment pings sent from the physical adapter,
+// so they don't enter the tunnel itself. A result far from the configured MTU
+// is logged, and configs with auto MTU are restarted once with the found value.
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// MTU probe settings
+const (
+	// MTUProbeMin and MTUProbeMax bound the tunnel MTU the probe looks for.
+	MTUProbeMin = DefaultMTU
+	MTUProbeMax = 1420
+	// MTUProbeTimeout time-boxes the probe of one tunnel.
+	MTUProbeTimeout = 5 * time.Second
+	// MTUProbeThreshold is how far the found MTU may be from the configured one unreported.
+	MTUProbeThreshold = 40
+	// mtuProbePingTimeout bounds one ping; no reply counts as too big.
+	mtuProbePingTimeout = 500 * time.Millisecond
+	// wireGuardOverhead is the IPv6 + UDP + WireGuard header size, as wg-quick assumes.
+	wireGuardOverhead = 80
+	// icmpEchoOverhead is the IPv4 + ICMP echo header size.
+	icmpEchoOverhead = 28
+	// ipFlagDF is IP_FLAG_DF of IP_OPTION_INFORMATION.
+	ipFlagDF = 0x02
+)
+
+var (
+	modIphlpapi         = windows.NewLazySystemDLL("iphlpapi.dll")
+	procIcmpCreateFile  = modIphlpapi.NewProc("IcmpCreateFile")
+	procIcmpCloseHandle = modIphlpapi.NewProc("IcmpCloseHandle")
+	procIcmpSendEcho2Ex = modIphlpapi.NewProc("IcmpSendEcho2Ex")
+)
+
+// ipOptionInformation is IP_OPTION_INFORMATION
+type ipOptionInformation struct {
+	TTL         uint8
+	TOS         uint8
+	Flags       uint8
+	OptionsSize uint8
+	OptionsData *byte
+}
+
+// icmpEchoReply is the head of ICMP_ECHO_REPLY
+type icmpEchoReply struct {
+	Address       uint32
+	Status        uint32
+	RoundTripTime uint32
+}
+
+// SetMTUProbe turns the MTU probe after tunnel start on or off
+func (m *NativeWireGuardManager) SetMTUProbe(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mtuProbe = enabled
+}
+
+// probeTunnelMTU probes the path MTU of a started tunnel once. With auto MTU
+// on and a result past the threshold, the tunnel is restarted with it; the
+// restart doesn't probe again.
+func (m *NativeWireGuardManager) probeTunnelMTU(configID int, config *WireGuardConfig) {
+	name := fmt.Sprintf("%s%d", TunnelPrefix, configID)
+	if len(config.Peers) == 0 || config.Peers[0].Endpoint == "" {
+		return
+	}
+
+	mtu, err := probePathMTU(config.Peers[0].Endpoint, time.Now().Add(MTUProbeTimeout))
+
+	m.mu.Lock()
+	state, exists := m.tunnels[name]
+	if !exists || !state.Active || state.Config != config {
+		// Stopped or restarted while probing
+		m.mu.Unlock()
+		return
+	}
+	state.MTUProbed = true
+	if err == nil {
+		state.ProbedMTU = mtu
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		m.log(fmt.Sprintf("MTU probe of %s skipped: %v", name, err))
+		return
+	}
+	configured := config.MTU
+	if configured == 0 {
+		configured = DefaultMTU
+	}
+	diff := mtu - configured
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff <= MTUProbeThreshold {
+		m.log(fmt.Sprintf("MTU probe of %s: path allows %d, configured %d is fine", name, mtu, configured))
+		return
+	}
+	m.log(fmt.Sprintf("MTU probe of %s: path allows %d, configured %d", name, mtu, configured))
+	if !config.AutoMTU {
+		return
+	}
+
+	updated := *config
+	updated.MTU = mtu
+	m.log(fmt.Sprintf("Restarting %s once with MTU %d", name, mtu))
+	if err := m.restartTunnel(configID, &updated); err != nil {
+		m.log(fmt.Sprintf("Restart of %s with MTU %d failed: %v", name, mtu, err))
+	}
+}
+
+// probePathMTU binary-searches the largest tunnel MTU between MTUProbeMin and
+// MTUProbeMax whose packets reach endpoint unfragmented. Out of time, the
+// largest size that got through so far is returned.
+func probePathMTU(endpoint string, deadline time.Time) (int, error) {
+	addr, err := net.ResolveIPAddr("ip4", endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("no IPv4 address of %s: %w", endpoint, err)
+	}
+	source, err := physicalSourceAddress()
+	if err != nil {
+		return 0, err
+	}
+
+	r, _, callErr := procIcmpCreateFile.Call()
+	handle := windows.Handle(r)
+	if handle == windows.InvalidHandle {
+		return 0, fmt.Errorf("IcmpCreateFile failed: %v", callErr)
+	}
+	defer procIcmpCloseHandle.Call(uintptr(handle))
+
+	dst := binary.LittleEndian.Uint32(addr.IP.To4())
+	mtu, ok := searchPathMTU(func(mtu int) bool {
+		return pingDontFragment(handle, source, dst, mtuPingSize(mtu))
+	}, deadline)
+	if !ok {
+		return 0, fmt.Errorf("%s does not answer pings", endpoint)
+	}
+	return mtu, nil
+}
+
+// searchPathMTU binary-searches the largest MTU between MTUProbeMin and
+// MTUProbeMax that fits. It reports false if even MTUProbeMin gets no answer
+// twice (the endpoint ignores pings).
+func searchPathMTU(fits func(mtu int) bool, deadline time.Time) (int, bool) {
+	if !fits(MTUProbeMin) && !fits(MTUProbeMin) {
+		return 0, false
+	}
+	low, high := MTUProbeMin, MTUProbeMax
+	for low < high && time.Now().Before(deadline) {
+		mid := (low + high + 1) / 2
+		if fits(mid) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low, true
+}
+
+// mtuPingSize returns the echo data size of a packet as large as a tunnel
+// packet of the given MTU on the wire
+func mtuPingSize(mtu int) int {
+	return mtu + wireGuardOverhead - icmpEchoOverhead
+}
+
+// physicalSourceAddress returns the IPv4 address of the default physical
+// adapter (IPAddr byte order). Pings from it leave through that adapter even
+// when a full tunnel holds the default route.
+func physicalSourceAddress() (uint32, error) {
+	interfaces, err := listGatewayInterfaces()
+	if err != nil {
+		return 0, err
+	}
+	if len(interfaces) == 0 {
+		return 0, fmt.Errorf("no connected network adapter")
+	}
+	first, err := readAdapterAddresses()
+	if err != nil {
+		return 0, err
+	}
+	for aa := first; aa != nil; aa = aa.Next {
+		if aa.IfIndex != interfaces[0].Index {
+			continue
+		}
+		for ua := aa.FirstUnicastAddress; ua != nil; ua = ua.Next {
+			if ip := ua.Address.IP().To4(); ip != nil {
+				return binary.LittleEndian.Uint32(ip), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%s has no IPv4 address", interfaces[0].Name)
+}
+
+// pingDontFragment sends one echo request with size bytes of data and the DF
+// flag set from source to dst, and reports whether it was answered
+func pingDontFragment(handle windows.Handle, source, dst uint32, size int) bool {
+	data := make([]byte, size)
+	options := ipOptionInformation{TTL: 128, Flags: ipFlagDF}
+	// ICMP_ECHO_REPLY, the echoed data, an ICMP error and IO_STATUS_BLOCK
+	reply := make([]byte, 64+size+8+16)
+
+	n, _, _ := procIcmpSendEcho2Ex.Call(
+		uintptr(handle), 0, 0, 0,
+		uintptr(source), uintptr(dst),
+		uintptr(unsafe.Pointer(&data[0])), uintptr(size),
+		uintptr(unsafe.Pointer(&options)),
+		uintptr(unsafe.Pointer(&reply[0])), uintptr(len(reply)),
+		uintptr(mtuProbePingTimeout/time.Millisecond),
+	)
+	if n == 0 {
+		// Timed out or IP_PACKET_TOO_BIG locally
+		return false
+	}
+	return (*icmpEchoReply)(unsafe.Pointer(&reply[0])).Status == 0
+}
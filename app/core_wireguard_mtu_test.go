@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchPathMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		pathMTU int // Largest tunnel MTU the path carries
+		want    int
+	}{
+		{"ethernet", 1420, 1420},
+		{"PPPoE", 1412, 1412},
+		{"LTE", 1350, 1350},
+		{"minimum", MTUProbeMin, MTUProbeMin},
+		{"above the range", 9000, MTUProbeMax},
+		{"just above minimum", MTUProbeMin + 1, MTUProbeMin + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := 0
+			got, ok := searchPathMTU(func(mtu int) bool {
+				probes++
+				return mtu <= tt.pathMTU
+			}, time.Now().Add(time.Minute))
+			if !ok || got != tt.want {
+				t.Errorf("searchPathMTU = %d, %v; want %d", got, ok, tt.want)
+			}
+			// Binary search over 141 sizes plus the first probe
+			if probes > 10 {
+				t.Errorf("%d probes, want a binary search", probes)
+			}
+		})
+	}
+}
+
+func TestSearchPathMTUNoAnswer(t *testing.T) {
+	probes := 0
+	if _, ok := searchPathMTU(func(int) bool { probes++; return false }, time.Now().Add(time.Minute)); ok {
+		t.Error("endpoint ignoring pings reported a path MTU")
+	}
+	if probes != 2 {
+		t.Errorf("%d probes of the minimum, want 2 (one retry)", probes)
+	}
+
+	// A lost first ping is retried
+	lost := false
+	got, ok := searchPathMTU(func(mtu int) bool {
+		if !lost {
+			lost = true
+			return false
+		}
+		return mtu <= 1400
+	}, time.Now().Add(time.Minute))
+	if !ok || got != 1400 {
+		t.Errorf("after a lost ping: %d, %v; want 1400", got, ok)
+	}
+}
+
+func TestSearchPathMTUDeadline(t *testing.T) {
+	// Out of time the minimum that answered is kept
+	got, ok := searchPathMTU(func(mtu int) bool { return true }, time.Now().Add(-time.Second))
+	if !ok || got != MTUProbeMin {
+		t.Errorf("past deadline: %d, %v; want %d", got, ok, MTUProbeMin)
+	}
+}
+
+func TestMTUPingSize(t *testing.T) {
+	// A 1420 tunnel MTU fills a 1500 byte Ethernet frame: 1472 bytes of echo data
+	if got := mtuPingSize(1420); got != 1472 {
+		t.Errorf("mtuPingSize(1420) = %d, want 1472", got)
+	}
+}
@@ -14,10 +14,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -55,6 +57,13 @@ type NativeWireGuardManager struct {
 	healthCheckStop  chan struct{}           // Stop signal for health check
 	healthCheckWg    sync.WaitGroup          // Wait group for health check goroutine
 	onTunnelRestart  func(configID int)      // Callback when tunnel is restarted
+	onHealthChange   func(configID int, healthy bool, lastHandshake time.Time) // Callback on health transitions
+	crash            *CrashReporter          // Restarts the health check loop after a panic
+	resumeKick       chan tunnelRecheck      // Triggers the resume check in the health check loop
+	statsSamples     map[string]wgStatsSample // Previous transfer poll by tunnel name
+	statsMu          sync.Mutex
+	mtuProbe         bool                    // Probe the path MTU after a tunnel starts
+	readRoutes       func() ([]SystemRoute, error) // Reads the routing table (replaceable in tests)
 }
 
 // TunnelState tracks the state of a WireGuard tunnel
@@ -68,6 +77,8 @@ type TunnelState struct {
 	LastHandshake  time.Time `json:"last_handshake"`      // Last successful handshake
 	Healthy        bool      `json:"healthy"`             // Current health status
 	RestartCount   int       `json:"restart_count"`       // Number of restarts
+	MTUProbed      bool      `json:"mtu_probed"`          // Path MTU was probed (never twice per start)
+	ProbedMTU      int       `json:"probed_mtu,omitempty"` // Tunnel MTU the path allows (0 = unknown)
 	Config         *WireGuardConfig `json:"-"`            // Original config for restart
 }
 
@@ -80,6 +91,16 @@ const HandshakeTimeout = 3 * time.Minute
 // MaxRestartAttempts defines maximum restart attempts before giving up
 const MaxRestartAttempts = 3
 
+// ResumeHandshakeWait is how long to wait for a handshake after the resume nudge
+const ResumeHandshakeWait = 5 * time.Second
+
+// tunnelRecheck asks the health check loop to nudge and verify all tunnels
+type tunnelRecheck struct {
+	reason string        // Log prefix ("Resume", "Network change")
+	wait   time.Duration // How long the nudged handshake may take
+	fresh  bool          // Only a handshake after the nudge counts as recovered
+}
+
 // NewNativeWireGuardManager creates a new Native WireGuard Manager
 // Expects bundled binaries in the same directory as the executable
 func NewNativeWireGuardManager(basePath string, logger func(string)) *NativeWireGuardManager {
@@ -88,6 +109,8 @@ func NewNativeWireGuardManager(basePath string, logger func(string)) *NativeWire
 		configDir: filepath.Join(basePath, "wireguard"),
 		tunnels:   make(map[string]*TunnelState),
 		logger:    logger,
+		resumeKick: make(chan tunnelRecheck, 1),
+		readRoutes: readSystemRoutes,
 	}
 	
 	// Set paths to bundled binaries (in same dir as executable)
@@ -136,50 +159,6 @@ func (m *NativeWireGuardManager) Init() error {
 	return nil
 }
 
-// CleanupOrphanedTunnels removes any kampus-wg-* tunnels left from previous sessions
-func (m *NativeWireGuardManager) CleanupOrphanedTunnels() {
-	if runtime.GOOS != "windows" {
-		return // Only needed on Windows where services persist
-	}
-	
-	m.log("Checking for orphaned tunnels...")
-	
-	// Query Windows services for any kampus-wg-* tunnels
-	// sc query type= service state= all | findstr "kampus-wg"
-	cmd := exec.Command("sc", "query", "type=", "service", "state=", "all")
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	output, err := cmd.Output()
-	if err != nil {
-		m.log(fmt.Sprintf("Failed to query services: %v", err))
-		return
-	}
-	
-	// Find all kampus-wg-* services
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "SERVICE_NAME:") {
-			serviceName := strings.TrimPrefix(line, "SERVICE_NAME:")
-			serviceName = strings.TrimSpace(serviceName)
-			
-			if strings.HasPrefix(serviceName, "WireGuardTunnel$"+TunnelPrefix) {
-				// Extract tunnel name from service name
-				tunnelName := strings.TrimPrefix(serviceName, "WireGuardTunnel$")
-				m.log(fmt.Sprintf("Found orphaned tunnel: %s, stopping...", tunnelName))
-				
-				// Stop using wireguard.exe /uninstalltunnelservice
-				stopCmd := exec.Command(m.wireguardPath, "/uninstalltunnelservice", tunnelName)
-				stopCmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-				if stopOutput, stopErr := stopCmd.CombinedOutput(); stopErr != nil {
-					m.log(fmt.Sprintf("Failed to stop orphaned tunnel %s: %v, output: %s", tunnelName, stopErr, string(stopOutput)))
-				} else {
-					m.log(fmt.Sprintf("Stopped orphaned tunnel: %s", tunnelName))
-				}
-			}
-		}
-	}
-}
-
 // log writes a log message
 func (m *NativeWireGuardManager) log(msg string) {
 	if m.logger != nil {
@@ -334,7 +313,7 @@ func (m *NativeWireGuardManager) GenerateConfFile(config *WireGuardConfig) strin
 		
 		// Endpoint
 		if peer.Endpoint != "" && peer.Port > 0 {
-			sb.WriteString(fmt.Sprintf("Endpoint = %s:%d\n", peer.Endpoint, peer.Port))
+			sb.WriteString(fmt.Sprintf("Endpoint = %s\n", net.JoinHostPort(strings.Trim(peer.Endpoint, "[]"), strconv.Itoa(peer.Port))))
 		}
 		
 		// AllowedIPs
@@ -367,6 +346,12 @@ func (m *NativeWireGuardManager) WriteConfigFile(name string, config *WireGuardC
 
 // StartTunnel starts a WireGuard tunnel
 func (m *NativeWireGuardManager) StartTunnel(configID int, config *WireGuardConfig) error {
+	return m.startTunnel(configID, config, true)
+}
+
+// startTunnel starts a WireGuard tunnel, probing its path MTU afterwards if
+// probeMTU is set and the probe is on
+func (m *NativeWireGuardManager) startTunnel(configID int, config *WireGuardConfig, probeMTU bool) error {
 	if !m.IsInstalled() {
 		return fmt.Errorf("WireGuard is not installed")
 	}
@@ -383,6 +368,9 @@ func (m *NativeWireGuardManager) StartTunnel(configID int, config *WireGuardConf
 		return nil
 	}
 	
+	// A service with this name left by a crash makes the install fail
+	m.removeStaleTunnelLocked(name)
+	
 	// Write config file
 	confPath, err := m.WriteConfigFile(name, config)
 	if err != nil {
@@ -413,6 +401,13 @@ func (m *NativeWireGuardManager) StartTunnel(configID int, config *WireGuardConf
 	}
 	
 	m.log(fmt.Sprintf("Tunnel %s started successfully", name))
+	
+	if probeMTU && m.mtuProbe {
+		crash := m.crash
+		go crash.Supervise("wireguard-mtu-probe", func() {
+			m.probeTunnelMTU(configID, config)
+		})
+	}
 	return nil
 }
 
@@ -499,50 +494,103 @@ func (m *NativeWireGuardManager) IsTunnelActive(configID int) bool {
 	return false
 }
 
-// GetTunnelStats gets statistics for a tunnel (requires wg.exe)
-func (m *NativeWireGuardManager) GetTunnelStats(configID int) (map[string]interface{}, error) {
+// WireGuardPeerDump is one peer line of `wg show <iface> dump`.
+type WireGuardPeerDump struct {
+	PublicKey       string
+	Endpoint        string
+	AllowedIPs      []string
+	LatestHandshake time.Time // Zero if there was no handshake yet
+	ReceivedBytes   int64
+	SentBytes       int64
+}
+
+// parseWgDump parses `wg show <iface> dump`: a tab-separated interface line
+// followed by one line per peer (public-key, preshared-key, endpoint,
+// allowed-ips, latest-handshake, transfer-rx, transfer-tx, persistent-keepalive).
+// Unlike `wg show`, it doesn't depend on the locale.
+func parseWgDump(output string) ([]WireGuardPeerDump, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, fmt.Errorf("empty wg dump")
+	}
+
+	peers := []WireGuardPeerDump{}
+	for _, line := range lines[1:] {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("unexpected wg dump line: %q", line)
+		}
+		handshake, errHandshake := strconv.ParseInt(fields[4], 10, 64)
+		received, errReceived := strconv.ParseInt(fields[5], 10, 64)
+		sent, errSent := strconv.ParseInt(fields[6], 10, 64)
+		if errHandshake != nil || errReceived != nil || errSent != nil {
+			return nil, fmt.Errorf("unexpected wg dump line: %q", line)
+		}
+
+		peer := WireGuardPeerDump{
+			PublicKey:     fields[0],
+			ReceivedBytes: received,
+			SentBytes:     sent,
+		}
+		if fields[2] != "(none)" {
+			peer.Endpoint = fields[2]
+		}
+		if fields[3] != "(none)" {
+			peer.AllowedIPs = strings.Split(fields[3], ",")
+		}
+		if handshake > 0 {
+			peer.LatestHandshake = time.Unix(handshake, 0)
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// DumpTunnel reads peer state of a tunnel with `wg show <iface> dump`
+func (m *NativeWireGuardManager) DumpTunnel(configID int) ([]WireGuardPeerDump, error) {
 	if !fileExists(m.wgPath) {
 		return nil, fmt.Errorf("wg.exe not found")
 	}
 	
 	name := fmt.Sprintf("%s%d", TunnelPrefix, configID)
 	
-	cmd := exec.Command(m.wgPath, "show", name)
+	cmd := exec.Command(m.wgPath, "show", name, "dump")
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tunnel stats: %w", err)
 	}
-	
-	// Parse wg show output
-	stats := m.parseWgShowOutput(string(output))
-	return stats, nil
+	return parseWgDump(string(output))
 }
 
-// parseWgShowOutput parses the output of `wg show` command
-func (m *NativeWireGuardManager) parseWgShowOutput(output string) map[string]interface{} {
-	stats := make(map[string]interface{})
-	
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "transfer:") {
-			// Parse transfer stats
-			parts := strings.Split(line, ",")
-			for _, part := range parts {
-				part = strings.TrimSpace(part)
-				if strings.Contains(part, "received") {
-					stats["received"] = strings.TrimSuffix(strings.TrimPrefix(part, "transfer: "), " received")
-				} else if strings.Contains(part, "sent") {
-					stats["sent"] = strings.TrimSuffix(part, " sent")
-				}
-			}
-		} else if strings.HasPrefix(line, "latest handshake:") {
-			stats["last_handshake"] = strings.TrimPrefix(line, "latest handshake: ")
+// GetTunnelStats gets statistics for a tunnel (requires wg.exe)
+func (m *NativeWireGuardManager) GetTunnelStats(configID int) (map[string]interface{}, error) {
+	peers, err := m.DumpTunnel(configID)
+	if err != nil {
+		return nil, err
+	}
+	
+	var received, sent int64
+	var lastHandshake time.Time
+	for _, peer := range peers {
+		received += peer.ReceivedBytes
+		sent += peer.SentBytes
+		if peer.LatestHandshake.After(lastHandshake) {
+			lastHandshake = peer.LatestHandshake
 		}
 	}
 	
-	return stats
+	stats := map[string]interface{}{
+		"received_bytes": received,
+		"sent_bytes":     sent,
+		"last_handshake": "never",
+		"peers":          len(peers),
+	}
+	if !lastHandshake.IsZero() {
+		stats["last_handshake"] = lastHandshake.Format(time.RFC3339)
+		stats["last_handshake_unix"] = lastHandshake.Unix()
+	}
+	return stats, nil
 }
 
 // CleanupConfigs removes all .conf files for stopped tunnels
@@ -618,6 +666,21 @@ func (m *NativeWireGuardManager) SetTunnelRestartCallback(callback func(configID
 	m.onTunnelRestart = callback
 }
 
+// SetHealthChangeCallback sets a callback function to be called when a tunnel
+// becomes unhealthy or recovers
+func (m *NativeWireGuardManager) SetHealthChangeCallback(callback func(configID int, healthy bool, lastHandshake time.Time)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onHealthChange = callback
+}
+
+// SetCrashReporter sets the reporter supervising the health check loop
+func (m *NativeWireGuardManager) SetCrashReporter(crash *CrashReporter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.crash = crash
+}
+
 // StartHealthCheck starts a background goroutine that monitors tunnel health
 func (m *NativeWireGuardManager) StartHealthCheck() {
 	m.mu.Lock()
@@ -626,10 +689,17 @@ func (m *NativeWireGuardManager) StartHealthCheck() {
 		return // Already running
 	}
 	m.healthCheckStop = make(chan struct{})
+	stop := m.healthCheckStop
+	crash := m.crash
 	m.mu.Unlock()
 	
 	m.healthCheckWg.Add(1)
-	go m.healthCheckLoop()
+	go func() {
+		defer m.healthCheckWg.Done()
+		crash.Supervise("wireguard-health-check", func() {
+			m.healthCheckLoop(stop)
+		})
+	}()
 	m.log("Health check started")
 }
 
@@ -649,85 +719,211 @@ func (m *NativeWireGuardManager) StopHealthCheck() {
 }
 
 // healthCheckLoop periodically checks tunnel health
-func (m *NativeWireGuardManager) healthCheckLoop() {
-	defer m.healthCheckWg.Done()
-	
+func (m *NativeWireGuardManager) healthCheckLoop(stop chan struct{}) {
 	ticker := time.NewTicker(HealthCheckInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
-		case <-m.healthCheckStop:
+		case <-stop:
 			return
 		case <-ticker.C:
 			m.checkAllTunnels()
+		case recheck := <-m.resumeKick:
+			m.checkAfterResume(stop, recheck)
 		}
 	}
 }
 
-// checkAllTunnels checks health of all active tunnels
-func (m *NativeWireGuardManager) checkAllTunnels() {
+// NotifyResume makes the health check loop verify tunnels right away
+// (called when the system resumes from sleep or hibernation)
+func (m *NativeWireGuardManager) NotifyResume() {
+	m.kickRecheck(tunnelRecheck{reason: "Resume", wait: ResumeHandshakeWait})
+}
+
+// NotifyNetworkChange makes the health check loop verify tunnels after the
+// network changed. A tunnel without a handshake over the new network within
+// NetworkChangeHandshakeWait is restarted, which resolves its endpoint again.
+func (m *NativeWireGuardManager) NotifyNetworkChange() {
+	m.kickRecheck(tunnelRecheck{reason: "Network change", wait: NetworkChangeHandshakeWait, fresh: true})
+}
+
+// kickRecheck queues a recheck unless one is already pending
+func (m *NativeWireGuardManager) kickRecheck(recheck tunnelRecheck) {
+	select {
+	case m.resumeKick <- recheck:
+	default:
+	}
+}
+
+// checkAfterResume nudges a handshake on every active tunnel, then restarts
+// tunnels whose handshake didn't recover or whose routes are gone.
+// Restarts after resume don't count towards MaxRestartAttempts.
+func (m *NativeWireGuardManager) checkAfterResume(stop chan struct{}, recheck tunnelRecheck) {
 	m.mu.RLock()
 	tunnelsToCheck := make([]*TunnelState, 0)
 	for _, state := range m.tunnels {
-		if state.Active {
+		if state.Active && state.Config != nil {
 			tunnelsToCheck = append(tunnelsToCheck, state)
 		}
 	}
 	m.mu.RUnlock()
+	if len(tunnelsToCheck) == 0 {
+		return
+	}
+	
+	nudgedAt := time.Now()
+	for _, state := range tunnelsToCheck {
+		if err := nudgeHandshake(configAllowedIPs(state.Config)); err != nil {
+			m.log(fmt.Sprintf("%s: handshake nudge for %s failed: %v", recheck.reason, state.Name, err))
+		}
+	}
+	
+	select {
+	case <-stop:
+		return
+	case <-time.After(recheck.wait):
+	}
+	
+	checks, err := m.CheckTunnelRoutes()
+	if err != nil {
+		m.log(fmt.Sprintf("%s: route check failed: %v", recheck.reason, err))
+	}
+	missing := map[string][]string{}
+	for _, check := range checks {
+		missing[check.Tunnel] = check.Missing
+	}
 	
 	for _, state := range tunnelsToCheck {
 		healthy, lastHandshake := m.checkTunnelHealth(state.ConfigID)
+		// A handshake over the old network says nothing about the new one
+		recovered := healthy && (!recheck.fresh || lastHandshake.After(nudgedAt))
+		
+		handshake := "never"
+		if !lastHandshake.IsZero() {
+			handshake = fmt.Sprintf("%s ago", time.Since(lastHandshake).Round(time.Second))
+		}
+		routes := "routes not checked"
+		if err == nil {
+			routes = fmt.Sprintf("routes %d/%d", len(configAllowedIPs(state.Config))-len(missing[state.Name]),
+				len(configAllowedIPs(state.Config)))
+		}
 		
 		m.mu.Lock()
+		oldHealthy := healthy
 		if tunnelState, exists := m.tunnels[state.Name]; exists {
+			oldHealthy = tunnelState.Healthy
 			tunnelState.LastHandshake = lastHandshake
-			oldHealthy := tunnelState.Healthy
 			tunnelState.Healthy = healthy
-			
-			if !healthy && oldHealthy {
-				m.log(fmt.Sprintf("Tunnel %s became unhealthy (last handshake: %v)", 
-					state.Name, lastHandshake))
-			}
-			
-			// Attempt restart if unhealthy and under max attempts
-			if !healthy && tunnelState.RestartCount < MaxRestartAttempts && tunnelState.Config != nil {
-				tunnelState.RestartCount++
-				m.mu.Unlock()
-				
-				m.log(fmt.Sprintf("Attempting to restart tunnel %s (attempt %d/%d)", 
-					state.Name, tunnelState.RestartCount, MaxRestartAttempts))
-				
-				if err := m.restartTunnel(state.ConfigID, tunnelState.Config); err != nil {
-					m.log(fmt.Sprintf("Failed to restart tunnel %s: %v", state.Name, err))
-				} else {
-					m.log(fmt.Sprintf("Tunnel %s restarted successfully", state.Name))
-					if m.onTunnelRestart != nil {
-						m.onTunnelRestart(state.ConfigID)
-					}
-				}
-				continue
-			}
 		}
+		callback := m.onTunnelRestart
+		onHealthChange := m.onHealthChange
 		m.mu.Unlock()
+		
+		if healthy != oldHealthy && onHealthChange != nil {
+			onHealthChange(state.ConfigID, healthy, lastHandshake)
+		}
+		
+		if recovered && len(missing[state.Name]) == 0 {
+			m.log(fmt.Sprintf("%s: %s OK (handshake %s, %s)", recheck.reason, state.Name, handshake, routes))
+			continue
+		}
+		
+		m.log(fmt.Sprintf("%s: %s restarting (handshake %s, %s, missing %v)",
+			recheck.reason, state.Name, handshake, routes, missing[state.Name]))
+		if err := m.restartTunnel(state.ConfigID, state.Config); err != nil {
+			m.log(fmt.Sprintf("%s: failed to restart %s: %v", recheck.reason, state.Name, err))
+			continue
+		}
+		if callback != nil {
+			callback(state.ConfigID)
+		}
+	}
+}
+
+// checkAllTunnels checks health of all active tunnels
+func (m *NativeWireGuardManager) checkAllTunnels() {
+	m.mu.RLock()
+	tunnelsToCheck := make([]*TunnelState, 0)
+	for _, state := range m.tunnels {
+		if state.Active {
+			tunnelsToCheck = append(tunnelsToCheck, state)
+		}
+	}
+	m.mu.RUnlock()
+	
+	for _, state := range tunnelsToCheck {
+		healthy, lastHandshake := m.checkTunnelHealth(state.ConfigID)
+		
+		m.mu.Lock()
+		tunnelState, exists := m.tunnels[state.Name]
+		if !exists {
+			m.mu.Unlock()
+			continue
+		}
+		tunnelState.LastHandshake = lastHandshake
+		oldHealthy := tunnelState.Healthy
+		tunnelState.Healthy = healthy
+		
+		if !healthy && oldHealthy {
+			m.log(fmt.Sprintf("Tunnel %s became unhealthy (last handshake: %v)", 
+				state.Name, lastHandshake))
+		}
+		recoveredAfter := 0
+		if healthy {
+			recoveredAfter = tunnelState.RestartCount
+		}
+		
+		// Attempt restart if unhealthy and under max attempts
+		restart := !healthy && tunnelState.RestartCount < MaxRestartAttempts && tunnelState.Config != nil
+		if restart {
+			tunnelState.RestartCount++
+		}
+		restartCount := tunnelState.RestartCount
+		config := tunnelState.Config
+		onRestart := m.onTunnelRestart
+		onHealthChange := m.onHealthChange
+		m.mu.Unlock()
+		
+		if recoveredAfter > 0 {
+			m.log(fmt.Sprintf("Tunnel %s recovered after %d restart(s)", state.Name, recoveredAfter))
+			m.ResetRestartCount(state.ConfigID)
+		}
+		if healthy != oldHealthy && onHealthChange != nil {
+			onHealthChange(state.ConfigID, healthy, lastHandshake)
+		}
+		if !restart {
+			continue
+		}
+		
+		m.log(fmt.Sprintf("Attempting to restart tunnel %s (attempt %d/%d)", 
+			state.Name, restartCount, MaxRestartAttempts))
+		
+		if err := m.restartTunnel(state.ConfigID, config); err != nil {
+			m.log(fmt.Sprintf("Failed to restart tunnel %s: %v", state.Name, err))
+		} else {
+			m.log(fmt.Sprintf("Tunnel %s restarted successfully", state.Name))
+			if onRestart != nil {
+				onRestart(state.ConfigID)
+			}
+		}
 	}
 }
 
 // checkTunnelHealth checks if a tunnel is healthy based on handshake time
 func (m *NativeWireGuardManager) checkTunnelHealth(configID int) (bool, time.Time) {
-	stats, err := m.GetTunnelStats(configID)
+	peers, err := m.DumpTunnel(configID)
 	if err != nil {
 		return false, time.Time{}
 	}
 	
-	// Parse last handshake time
-	handshakeStr, _ := stats["last_handshake"].(string)
-	if handshakeStr == "" || handshakeStr == "never" {
-		return false, time.Time{}
+	// The most recent handshake of any peer
+	var lastHandshake time.Time
+	for _, peer := range peers {
+		if peer.LatestHandshake.After(lastHandshake) {
+			lastHandshake = peer.LatestHandshake
+		}
 	}
-	
-	// Parse relative time like "1 minute, 30 seconds ago"
-	lastHandshake := m.parseHandshakeTime(handshakeStr)
 	if lastHandshake.IsZero() {
 		return false, time.Time{}
 	}
@@ -737,52 +933,20 @@ func (m *NativeWireGuardManager) checkTunnelHealth(configID int) (bool, time.Tim
 	return healthy, lastHandshake
 }
 
-// parseHandshakeTime parses the handshake time string from wg show output
-func (m *NativeWireGuardManager) parseHandshakeTime(s string) time.Time {
-	s = strings.TrimSpace(s)
-	
-	// Handle "never"
-	if s == "never" || s == "" {
-		return time.Time{}
-	}
-	
-	// Try to parse relative time like "1 minute, 30 seconds ago"
-	s = strings.TrimSuffix(s, " ago")
-	
-	var duration time.Duration
-	parts := strings.Split(s, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		
-		// Try to parse each part
-		if strings.Contains(part, "second") {
-			var n int
-			fmt.Sscanf(part, "%d", &n)
-			duration += time.Duration(n) * time.Second
-		} else if strings.Contains(part, "minute") {
-			var n int
-			fmt.Sscanf(part, "%d", &n)
-			duration += time.Duration(n) * time.Minute
-		} else if strings.Contains(part, "hour") {
-			var n int
-			fmt.Sscanf(part, "%d", &n)
-			duration += time.Duration(n) * time.Hour
-		} else if strings.Contains(part, "day") {
-			var n int
-			fmt.Sscanf(part, "%d", &n)
-			duration += time.Duration(n) * 24 * time.Hour
-		}
-	}
-	
-	if duration == 0 {
-		return time.Time{}
+// restartTunnel stops and restarts a tunnel; the restart count carries over
+// to the new tunnel state until the tunnel is healthy again. A restart never
+// probes the MTU again, so a tunnel can't be bounced in a loop by the probe.
+func (m *NativeWireGuardManager) restartTunnel(configID int, config *WireGuardConfig) error {
+	name := fmt.Sprintf("%s%d", TunnelPrefix, configID)
+	m.mu.RLock()
+	restartCount := 0
+	mtuProbed, probedMTU := false, 0
+	if state, exists := m.tunnels[name]; exists {
+		restartCount = state.RestartCount
+		mtuProbed, probedMTU = state.MTUProbed, state.ProbedMTU
 	}
+	m.mu.RUnlock()
 	
-	return time.Now().Add(-duration)
-}
-
-// restartTunnel stops and restarts a tunnel
-func (m *NativeWireGuardManager) restartTunnel(configID int, config *WireGuardConfig) error {
 	// Stop the tunnel first
 	if err := m.StopTunnel(configID); err != nil {
 		m.log(fmt.Sprintf("Warning: error stopping tunnel during restart: %v", err))
@@ -792,7 +956,17 @@ func (m *NativeWireGuardManager) restartTunnel(configID int, config *WireGuardCo
 	time.Sleep(2 * time.Second)
 	
 	// Start the tunnel again
-	return m.StartTunnel(configID, config)
+	if err := m.startTunnel(configID, config, false); err != nil {
+		return err
+	}
+	
+	m.mu.Lock()
+	if state, exists := m.tunnels[name]; exists {
+		state.RestartCount = restartCount
+		state.MTUProbed, state.ProbedMTU = mtuProbed, probedMTU
+	}
+	m.mu.Unlock()
+	return nil
 }
 
 // GetTunnelHealthStatus returns health status for all tunnels
@@ -810,6 +984,7 @@ func (m *NativeWireGuardManager) GetTunnelHealthStatus() []map[string]interface{
 				"last_handshake": state.LastHandshake.Format(time.RFC3339),
 				"restart_count":  state.RestartCount,
 				"uptime":         time.Since(state.StartedAt).String(),
+				"uptime_seconds": int64(time.Since(state.StartedAt).Seconds()),
 			}
 			result = append(result, status)
 		}
@@ -817,7 +992,7 @@ func (m *NativeWireGuardManager) GetTunnelHealthStatus() []map[string]interface{
 	return result
 }
 
-// ResetRestartCount resets the restart counter for a tunnel (called after successful reconnect)
+// ResetRestartCount resets the restart counter for a tunnel (called once it is healthy again)
 func (m *NativeWireGuardManager) ResetRestartCount(configID int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -0,0 +1,170 @@
+// Package main provides detection of orphaned WireGuard tunnels for KampusVPN.
+// After a crash the tunnel services (WireGuardTunnel$kampus-wg-N) and their
+// Wintun adapters stay behind and make the next /installtunnelservice fail.
+// A tunnel is orphaned when its service or adapter exists but the manager
+// does not track it as active.
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tunnelServicePrefix is the service name prefix wireguard.exe gives tunnel services
+const tunnelServicePrefix = "WireGuardTunnel$"
+
+// OrphanCommandTimeout limits each sc/wireguard/powershell call of the cleanup
+const OrphanCommandTimeout = 15 * time.Second
+
+// OrphanedTunnel is a tunnel of ours left by a previous run
+type OrphanedTunnel struct {
+	Name    string `json:"name"`    // Tunnel name (kampus-wg-N)
+	Service bool   `json:"service"` // Tunnel service is still registered
+	Adapter bool   `json:"adapter"` // Wintun adapter is still present
+}
+
+// DetectOrphanedTunnels returns tunnel services and adapters with our prefix
+// that are not active tunnels of this manager
+func (m *NativeWireGuardManager) DetectOrphanedTunnels() []OrphanedTunnel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.detectOrphanedTunnelsLocked()
+}
+
+// detectOrphanedTunnelsLocked is DetectOrphanedTunnels with m.mu held
+func (m *NativeWireGuardManager) detectOrphanedTunnelsLocked() []OrphanedTunnel {
+	if runtime.GOOS != "windows" {
+		return nil // Only needed on Windows where services persist
+	}
+
+	found := map[string]*OrphanedTunnel{}
+	orphan := func(name string) *OrphanedTunnel {
+		if state, exists := m.tunnels[name]; exists && state.Active {
+			return nil
+		}
+		if found[name] == nil {
+			found[name] = &OrphanedTunnel{Name: name}
+		}
+		return found[name]
+	}
+
+	services, err := listTunnelServices()
+	if err != nil {
+		m.log(fmt.Sprintf("Failed to query services: %v", err))
+	}
+	for _, name := range services {
+		if o := orphan(name); o != nil {
+			o.Service = true
+		}
+	}
+	for _, name := range listTunnelAdapters() {
+		if o := orphan(name); o != nil {
+			o.Adapter = true
+		}
+	}
+
+	orphans := make([]OrphanedTunnel, 0, len(found))
+	for _, o := range found {
+		orphans = append(orphans, *o)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Name < orphans[j].Name })
+	return orphans
+}
+
+// listTunnelServices returns the tunnel names of registered kampus-wg-* services
+func listTunnelServices() ([]string, error) {
+	output, err := runHiddenCommand(OrphanCommandTimeout, "sc", "query", "type=", "service", "state=", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "SERVICE_NAME:") {
+			continue
+		}
+		serviceName := strings.TrimSpace(strings.TrimPrefix(line, "SERVICE_NAME:"))
+		if strings.HasPrefix(serviceName, tunnelServicePrefix+TunnelPrefix) {
+			names = append(names, strings.TrimPrefix(serviceName, tunnelServicePrefix))
+		}
+	}
+	return names, nil
+}
+
+// listTunnelAdapters returns the names of kampus-wg-* network adapters
+func listTunnelAdapters() []string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, iface := range interfaces {
+		if strings.HasPrefix(iface.Name, TunnelPrefix) {
+			names = append(names, iface.Name)
+		}
+	}
+	return names
+}
+
+// CleanupOrphanedTunnels removes the orphaned tunnels: the service is
+// uninstalled (which also removes its adapter), a leftover adapter without a
+// service is removed as a device
+func (m *NativeWireGuardManager) CleanupOrphanedTunnels() {
+	if runtime.GOOS != "windows" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.log("Checking for orphaned tunnels...")
+	orphans := m.detectOrphanedTunnelsLocked()
+	for _, o := range orphans {
+		m.removeOrphanedTunnel(o)
+	}
+	if len(orphans) > 0 {
+		m.log(fmt.Sprintf("Cleaned up %d orphaned tunnel(s)", len(orphans)))
+	}
+}
+
+// removeStaleTunnelLocked removes an orphaned tunnel with the given name before
+// it is started again. Must be called with m.mu held.
+func (m *NativeWireGuardManager) removeStaleTunnelLocked(name string) {
+	for _, o := range m.detectOrphanedTunnelsLocked() {
+		if o.Name == name {
+			m.removeOrphanedTunnel(o)
+		}
+	}
+}
+
+// removeOrphanedTunnel uninstalls the service and/or removes the adapter of an orphan
+func (m *NativeWireGuardManager) removeOrphanedTunnel(o OrphanedTunnel) {
+	m.log(fmt.Sprintf("Found orphaned tunnel: %s (service: %v, adapter: %v), removing...", o.Name, o.Service, o.Adapter))
+
+	if o.Service {
+		output, err := runHiddenCommand(OrphanCommandTimeout, m.wireguardPath, "/uninstalltunnelservice", o.Name)
+		if err != nil {
+			m.log(fmt.Sprintf("Failed to uninstall orphaned tunnel %s: %v, output: %s", o.Name, err, string(output)))
+			return
+		}
+		m.log(fmt.Sprintf("Uninstalled orphaned tunnel service: %s", o.Name))
+		return
+	}
+
+	// Only kampus-wg-N names reach the script
+	if _, err := strconv.Atoi(strings.TrimPrefix(o.Name, TunnelPrefix)); o.Adapter && err == nil {
+		script := fmt.Sprintf("Get-NetAdapter -Name '%s' -IncludeHidden | ForEach-Object { pnputil /remove-device $_.PnPDeviceID }", o.Name)
+		output, err := runHiddenCommand(OrphanCommandTimeout, "powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+		if err != nil {
+			m.log(fmt.Sprintf("Failed to remove orphaned adapter %s: %v, output: %s", o.Name, err, string(output)))
+			return
+		}
+		m.log(fmt.Sprintf("Removed orphaned adapter: %s", o.Name))
+	}
+}
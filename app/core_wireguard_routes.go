@@ -0,0 +1,208 @@
+// Package main provides the WireGuard route presence check for KampusVPN.
+// Windows occasionally strips routes of a running tunnel on resume from
+// hibernation; the service still reports "running" but AllowedIPs traffic
+// leaves through the default adapter. Routes are read from `route print`.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// RoutePrintTimeout bounds reading the system routing table
+const RoutePrintTimeout = 5 * time.Second
+
+// SystemRoute is one active route of the system routing table.
+type SystemRoute struct {
+	Prefix    netip.Prefix
+	Interface string // Local address of the interface (IPv4 only, "" for IPv6)
+}
+
+// TunnelRouteCheck is the route presence result of one tunnel.
+type TunnelRouteCheck struct {
+	Tunnel   string   `json:"tunnel"`
+	ConfigID int      `json:"config_id"`
+	Expected []string `json:"expected"`
+	Missing  []string `json:"missing"`
+}
+
+// OK reports whether every AllowedIPs route exists
+func (c TunnelRouteCheck) OK() bool {
+	return len(c.Missing) == 0
+}
+
+// parseRoutePrint extracts active IPv4 and IPv6 routes from `route print` output.
+// Persistent routes are skipped: they are listed again as active once applied.
+func parseRoutePrint(output string) []SystemRoute {
+	var routes []SystemRoute
+	active := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Active Routes:"):
+			active = true
+			continue
+		case strings.HasPrefix(line, "Persistent Routes:"):
+			active = false
+			continue
+		}
+		if !active {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		// IPv4: Network Destination, Netmask, Gateway, Interface, Metric
+		if len(fields) == 5 {
+			addr, err := netip.ParseAddr(fields[0])
+			mask := net.ParseIP(fields[1])
+			if err == nil && addr.Is4() && mask != nil && mask.To4() != nil {
+				if bits, size := net.IPMask(mask.To4()).Size(); size == 32 {
+					routes = append(routes, SystemRoute{
+						Prefix:    netip.PrefixFrom(addr, bits).Masked(),
+						Interface: fields[3],
+					})
+				}
+			}
+			continue
+		}
+		// IPv6: If, Metric, Network Destination, Gateway. A long destination
+		// pushes the gateway onto the next line.
+		if len(fields) == 4 || len(fields) == 3 {
+			if prefix, err := netip.ParsePrefix(fields[2]); err == nil {
+				routes = append(routes, SystemRoute{Prefix: prefix.Masked()})
+			}
+		}
+	}
+	return routes
+}
+
+// parseAllowedIP parses an AllowedIPs entry; a bare address is a host route
+func parseAllowedIP(s string) (netip.Prefix, bool) {
+	s = strings.TrimSpace(s)
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), true
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// MissingRoutes returns AllowedIPs entries without a matching route. An IPv4
+// route must go through one of the tunnel addresses when they are known, so
+// the default route of the physical adapter doesn't count for 0.0.0.0/0.
+func MissingRoutes(allowedIPs []string, tunnelAddresses []string, routes []SystemRoute) []string {
+	local := map[string]bool{}
+	for _, a := range tunnelAddresses {
+		// The interface address itself, not the network of "10.8.0.2/24"
+		a = strings.TrimSpace(a)
+		if i := strings.IndexByte(a, '/'); i >= 0 {
+			a = a[:i]
+		}
+		if addr, err := netip.ParseAddr(a); err == nil && addr.Is4() {
+			local[addr.String()] = true
+		}
+	}
+
+	missing := []string{}
+	for _, entry := range allowedIPs {
+		prefix, ok := parseAllowedIP(entry)
+		if !ok {
+			continue
+		}
+		found := false
+		for _, route := range routes {
+			if route.Prefix != prefix {
+				continue
+			}
+			if route.Interface == "" || len(local) == 0 || local[route.Interface] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, prefix.String())
+		}
+	}
+	return missing
+}
+
+// readSystemRoutes reads the active routing table
+func readSystemRoutes() ([]SystemRoute, error) {
+	output, err := runHiddenCommand(RoutePrintTimeout, "route", "print")
+	if err != nil {
+		return nil, fmt.Errorf("route print failed: %w", err)
+	}
+	return parseRoutePrint(string(output)), nil
+}
+
+// handshakeProbeAddr returns the first host of the first usable AllowedIPs
+// entry; traffic to it makes the tunnel start a handshake.
+func handshakeProbeAddr(allowedIPs []string) (netip.Addr, bool) {
+	for _, entry := range allowedIPs {
+		prefix, ok := parseAllowedIP(entry)
+		if !ok || prefix.Bits() == 0 {
+			continue
+		}
+		addr := prefix.Addr()
+		if prefix.Bits() < addr.BitLen() {
+			addr = addr.Next()
+		}
+		return addr, true
+	}
+	return netip.Addr{}, false
+}
+
+// nudgeHandshake sends a single UDP datagram into the tunnel so WireGuard
+// initiates a handshake right away instead of on the next keepalive.
+func nudgeHandshake(allowedIPs []string) error {
+	addr, ok := handshakeProbeAddr(allowedIPs)
+	if !ok {
+		return fmt.Errorf("no AllowedIPs host to probe")
+	}
+	conn, err := net.DialTimeout("udp", netip.AddrPortFrom(addr, 9).String(), time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte{0})
+	return err
+}
+
+// configAllowedIPs returns AllowedIPs of all peers of a tunnel config
+func configAllowedIPs(config *WireGuardConfig) []string {
+	var allowed []string
+	for _, peer := range config.Peers {
+		allowed = append(allowed, peer.AllowedIPs...)
+	}
+	return allowed
+}
+
+// CheckTunnelRoutes checks that routes for AllowedIPs of every active tunnel exist.
+func (m *NativeWireGuardManager) CheckTunnelRoutes() ([]TunnelRouteCheck, error) {
+	routes, err := m.readRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	checks := []TunnelRouteCheck{}
+	for _, state := range m.tunnels {
+		if !state.Active || state.Config == nil {
+			continue
+		}
+		allowed := configAllowedIPs(state.Config)
+		checks = append(checks, TunnelRouteCheck{
+			Tunnel:   state.Name,
+			ConfigID: state.ConfigID,
+			Expected: allowed,
+			Missing:  MissingRoutes(allowed, state.Config.Address, routes),
+		})
+	}
+	return checks, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readRoutePrint parses a `route print` fixture from testdata/route_print
+func readRoutePrint(t *testing.T, name string) []SystemRoute {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "route_print", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseRoutePrint(string(data))
+}
+
+// Tunnels of the fixtures: a split tunnel to the office and a full tunnel
+var (
+	officeTunnel = &WireGuardConfig{
+		Address: []string{"10.8.0.2/24", "fd00:8::2/64"},
+		Peers: []WireGuardPeer{{AllowedIPs: []string{
+			"10.8.0.0/24", "192.168.50.0/24", "fd00:8::/64", "fd00:abcd:1234:5678:9abc::/80",
+		}}},
+	}
+	homeTunnel = &WireGuardConfig{
+		Address: []string{"10.9.0.2/32"},
+		Peers:   []WireGuardPeer{{AllowedIPs: []string{"0.0.0.0/0"}}},
+	}
+)
+
+func TestParseRoutePrint(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "route_print", "connected.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// route print writes CRLF
+	for _, output := range []string{string(data), strings.ReplaceAll(string(data), "\n", "\r\n")} {
+		routes := parseRoutePrint(output)
+		if len(routes) != 20 {
+			t.Errorf("routes = %d, want 14 IPv4 and 6 IPv6", len(routes))
+		}
+
+		find := func(prefix, iface string) bool {
+			for _, r := range routes {
+				if r.Prefix.String() == prefix && r.Interface == iface {
+					return true
+				}
+			}
+			return false
+		}
+		for _, want := range []struct{ prefix, iface string }{
+			{"0.0.0.0/0", "192.168.1.10"},
+			{"0.0.0.0/0", "10.9.0.2"},
+			{"192.168.50.0/24", "10.8.0.2"},
+			{"255.255.255.255/32", "127.0.0.1"},
+			{"fd00:8::/64", ""},
+			// Wrapped onto two lines
+			{"fd00:abcd:1234:5678:9abc::/80", ""},
+			{"fe80::d0b1:5f3a:6c4e:ad12/128", ""},
+		} {
+			if !find(want.prefix, want.iface) {
+				t.Errorf("route %s on %q not parsed", want.prefix, want.iface)
+			}
+		}
+		if find("172.16.0.0/12", "") || find("172.16.0.0/12", "192.168.1.1") {
+			t.Error("persistent route parsed as active")
+		}
+	}
+}
+
+func TestMissingRoutes(t *testing.T) {
+	tests := []struct {
+		fixture string
+		tunnel  *WireGuardConfig
+		missing []string
+	}{
+		{"connected.txt", officeTunnel, []string{}},
+		{"connected.txt", homeTunnel, []string{}},
+		// Windows kept the on-link subnet but dropped the routes the tunnel added;
+		// 192.168.50.0/24 is only listed under persistent routes
+		{"resumed.txt", officeTunnel, []string{"192.168.50.0/24", "fd00:abcd:1234:5678:9abc::/80"}},
+		// The default route of the physical adapter doesn't carry the tunnel
+		{"resumed.txt", homeTunnel, []string{"0.0.0.0/0"}},
+	}
+
+	for _, tt := range tests {
+		routes := readRoutePrint(t, tt.fixture)
+		got := MissingRoutes(configAllowedIPs(tt.tunnel), tt.tunnel.Address, routes)
+		if !equalStringSlices(got, tt.missing) {
+			t.Errorf("%s, tunnel %v: missing = %v, want %v", tt.fixture, tt.tunnel.Address, got, tt.missing)
+		}
+	}
+
+	// Without tunnel addresses a route through any interface counts
+	routes := readRoutePrint(t, "resumed.txt")
+	if got := MissingRoutes([]string{"0.0.0.0/0", "10.8.0.1", "garbage"}, nil, routes); !equalStringSlices(got, []string{"10.8.0.1/32"}) {
+		t.Errorf("missing = %v, want only the host route", got)
+	}
+}
+
+func TestCheckTunnelRoutes(t *testing.T) {
+	tests := []struct {
+		fixture string
+		missing map[string][]string
+	}{
+		{"connected.txt", map[string][]string{"kampus-wg-home": {}, "kampus-wg-office": {}}},
+		{"resumed.txt", map[string][]string{
+			"kampus-wg-home":   {"0.0.0.0/0"},
+			"kampus-wg-office": {"192.168.50.0/24", "fd00:abcd:1234:5678:9abc::/80"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			m := NewNativeWireGuardManager(t.TempDir(), func(string) {})
+			m.readRoutes = func() ([]SystemRoute, error) { return readRoutePrint(t, tt.fixture), nil }
+			m.tunnels["kampus-wg-office"] = &TunnelState{Name: "kampus-wg-office", ConfigID: 1, Active: true, Config: officeTunnel}
+			m.tunnels["kampus-wg-home"] = &TunnelState{Name: "kampus-wg-home", ConfigID: 2, Active: true, Config: homeTunnel}
+			// Stopped tunnels are not checked
+			m.tunnels["kampus-wg-lab"] = &TunnelState{Name: "kampus-wg-lab", ConfigID: 3, Config: homeTunnel}
+
+			checks, err := m.CheckTunnelRoutes()
+			if err != nil {
+				t.Fatalf("CheckTunnelRoutes: %v", err)
+			}
+			sort.Slice(checks, func(i, j int) bool { return checks[i].Tunnel < checks[j].Tunnel })
+			if len(checks) != len(tt.missing) {
+				t.Fatalf("checks = %+v, want %d tunnels", checks, len(tt.missing))
+			}
+			for _, check := range checks {
+				want := tt.missing[check.Tunnel]
+				if !equalStringSlices(check.Missing, want) || check.OK() != (len(want) == 0) {
+					t.Errorf("%s: missing = %v (OK %v), want %v", check.Tunnel, check.Missing, check.OK(), want)
+				}
+			}
+		})
+	}
+
+	m := NewNativeWireGuardManager(t.TempDir(), func(string) {})
+	m.readRoutes = func() ([]SystemRoute, error) { return nil, errors.New("route print failed: exit status 1") }
+	if _, err := m.CheckTunnelRoutes(); err == nil {
+		t.Error("CheckTunnelRoutes without a routing table succeeded")
+	}
+}
+
+func TestHandshakeProbeAddr(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		want    string // "" = none
+	}{
+		{[]string{"10.8.0.0/24", "192.168.50.0/24"}, "10.8.0.1"},
+		// A default route has no host worth probing
+		{[]string{"0.0.0.0/0", "10.9.0.0/24"}, "10.9.0.1"},
+		{[]string{"10.8.0.5"}, "10.8.0.5"},
+		{[]string{"10.8.0.5/32"}, "10.8.0.5"},
+		{[]string{"fd00:8::/64"}, "fd00:8::1"},
+		{[]string{"0.0.0.0/0", "::/0"}, ""},
+		{[]string{"garbage"}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		addr, ok := handshakeProbeAddr(tt.allowed)
+		if ok != (tt.want != "") || (ok && addr != netip.MustParseAddr(tt.want)) {
+			t.Errorf("handshakeProbeAddr(%v) = %v, %v; want %q", tt.allowed, addr, ok, tt.want)
+		}
+	}
+}
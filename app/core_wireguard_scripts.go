@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// WireGuardScriptTimeout ограничивает время выполнения одной PostUp/PostDown команды
+const WireGuardScriptTimeout = 30 * time.Second
+
+// dangerousScriptPatterns - команды, которые отклоняются всегда, даже с согласием пользователя
+var dangerousScriptPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bformat(\.com)?\s+[a-z]:`),
+	regexp.MustCompile(`(?i)\b(del|erase)\b(.*\s)?/([a-z:\-]+/)*s\b`), // /s в любой группе ключей: /s, /q/s, del/s
+	regexp.MustCompile(`(?i)\b(rd|rmdir)\b(.*\s)?/([a-z:\-]+/)*s\b`),
+	regexp.MustCompile(`(?i)\breg(\.exe)?\s+delete\s+"?(HKLM|HKEY_LOCAL_MACHINE)`),
+	regexp.MustCompile(`(?i)\bremove-item\b.*-recurse`),
+	regexp.MustCompile(`(?i)\bdiskpart\b`),
+	regexp.MustCompile(`(?i)\bbcdedit\b`),
+	regexp.MustCompile(`(?i)\bvssadmin\b.*\bdelete\b`),
+	regexp.MustCompile(`(?i)\bcipher\b.*\s/w`),
+}
+
+// WireGuardScriptResult результат выполнения одной команды
+type WireGuardScriptResult struct {
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Refused bool   `json:"refused,omitempty"`
+}
+
+// CheckScriptCommand проверяет команду по чёрному списку опасных шаблонов
+func CheckScriptCommand(command string) error {
+	for _, pattern := range dangerousScriptPatterns {
+		if pattern.MatchString(command) {
+			return fmt.Errorf("команда заблокирована как опасная: %s", truncateString(command, 80))
+		}
+	}
+	return nil
+}
+
+// HasScripts возвращает true если конфиг содержит PostUp/PostDown команды
+func (wg *UserWireGuardConfig) HasScripts() bool {
+	return len(wg.PostUp) > 0 || len(wg.PostDown) > 0
+}
+
+// ConsentedPostUp возвращает PostUp команды, если пользователь разрешил скрипты
+func (wg *UserWireGuardConfig) ConsentedPostUp() []string {
+	if !wg.AllowScripts {
+		return nil
+	}
+	return wg.PostUp
+}
+
+// ConsentedPostDown возвращает PostDown команды, если пользователь разрешил скрипты
+func (wg *UserWireGuardConfig) ConsentedPostDown() []string {
+	if !wg.AllowScripts {
+		return nil
+	}
+	return wg.PostDown
+}
+
+// withoutScriptConsent возвращает копию конфигов со сброшенным AllowScripts.
+// Согласие даётся только на этом компьютере: экспортированный или присланный
+// файл не должен запускать скрипты у получателя.
+func withoutScriptConsent(configs []UserWireGuardConfig) []UserWireGuardConfig {
+	if configs == nil {
+		return nil
+	}
+	result := make([]UserWireGuardConfig, len(configs))
+	for i, wg := range configs {
+		wg.AllowScripts = false
+		result[i] = wg
+	}
+	return result
+}
+
+// expandScriptCommand подставляет имя интерфейса вместо %i, как wg-quick
+func expandScriptCommand(command, iface string) string {
+	return strings.ReplaceAll(command, "%i", iface)
+}
+
+// RunWireGuardScripts выполняет команды через cmd /C с помощью run, подставляя %i - имя интерфейса.
+// Вывод каждой команды передаётся в logger. Выполнение продолжается после ошибки.
+func RunWireGuardScripts(run commandRunner, commands []string, iface string, logger func(string)) []WireGuardScriptResult {
+	results := make([]WireGuardScriptResult, 0, len(commands))
+
+	for _, command := range commands {
+		command = expandScriptCommand(command, iface)
+		result := WireGuardScriptResult{Command: command}
+
+		if err := CheckScriptCommand(command); err != nil {
+			result.Refused = true
+			result.Error = err.Error()
+			logger(fmt.Sprintf("[WireGuard] Script refused: %s", command))
+			results = append(results, result)
+			continue
+		}
+
+		output, err := run(WireGuardScriptTimeout, "cmd", "/C", command)
+		result.Output = strings.TrimSpace(string(output))
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		logger(fmt.Sprintf("[WireGuard] Script [%s]: %s", iface, command))
+		if result.Output != "" {
+			logger(fmt.Sprintf("[WireGuard] Script output: %s", result.Output))
+		}
+		if result.Error != "" {
+			logger(fmt.Sprintf("[WireGuard] Script error: %s", result.Error))
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWireGuardConf returns a valid wg-quick config with the given extra [Interface] lines
+func testWireGuardConf(t *testing.T, interfaceLines ...string) string {
+	t.Helper()
+	local, err := GenerateWireGuardKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateWireGuardKeyPair: %v", err)
+	}
+	peer, err := GenerateWireGuardKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateWireGuardKeyPair: %v", err)
+	}
+	return fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.8.0.2/32
+%s
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.8.0.0/24
+Endpoint = vpn.example.com:51820
+`, local.PrivateKey, strings.Join(interfaceLines, "\n"), peer.PublicKey)
+}
+
+func TestParseWireGuardConfigScripts(t *testing.T) {
+	conf := testWireGuardConf(t,
+		"PostUp = route add 10.9.0.0 mask 255.255.0.0 10.8.0.1",
+		"PostUp = echo up %i",
+		"PostDown = echo down %i",
+	)
+
+	wg, err := ParseWireGuardConfig(conf)
+	if err != nil {
+		t.Fatalf("ParseWireGuardConfig: %v", err)
+	}
+
+	wantUp := []string{"route add 10.9.0.0 mask 255.255.0.0 10.8.0.1", "echo up %i"}
+	if !equalStringSlices(wg.PostUp, wantUp) {
+		t.Errorf("PostUp = %q, want %q", wg.PostUp, wantUp)
+	}
+	if !equalStringSlices(wg.PostDown, []string{"echo down %i"}) {
+		t.Errorf("PostDown = %q", wg.PostDown)
+	}
+	if !wg.HasScripts() {
+		t.Error("HasScripts() = false, want true")
+	}
+	if wg.AllowScripts {
+		t.Error("parsed config has AllowScripts set; consent must be given explicitly")
+	}
+}
+
+func TestParseWireGuardConfigWithoutScripts(t *testing.T) {
+	wg, err := ParseWireGuardConfig(testWireGuardConf(t))
+	if err != nil {
+		t.Fatalf("ParseWireGuardConfig: %v", err)
+	}
+	if wg.HasScripts() {
+		t.Errorf("HasScripts() = true for a config without PostUp/PostDown")
+	}
+}
+
+func TestCheckScriptCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		refused bool
+	}{
+		{"route add 10.9.0.0 mask 255.255.0.0 10.8.0.1", false},
+		{"netsh interface ipv4 set subinterface wg0 mtu=1380", false},
+		{"echo %i", false},
+		{"del C:\\temp\\wg.log", false},
+		{"format c:", true},
+		{"FORMAT.COM D: /q", true},
+		{"del /f /q C:\\Users /s", true},
+		{"erase C:\\data /s", true},
+		{"rmdir C:\\Windows /s /q", true},
+		{"rd C:\\ /s", true},
+		{`reg delete "HKLM\Software\Test" /f`, true},
+		{"reg.exe delete HKEY_LOCAL_MACHINE\\Software /f", true},
+		{"powershell Remove-Item C:\\ -Recurse -Force", true},
+		{"diskpart /s script.txt", true},
+		{"bcdedit /deletevalue safeboot", true},
+		{"vssadmin delete shadows /all", true},
+		{"cipher /w:C:\\", true},
+		{"del /q/s C:\\x", true},
+		{"del /f/s/q C:\\x", true},
+		{"DEL /A:H/S C:\\x", true},
+		{"del/s C:\\x", true},
+		{"rd /q/s C:\\x", true},
+		{"rd/s/q C:\\x", true},
+		{"RMDIR /Q/S C:\\x", true},
+		{"del /q C:\\temp\\wg.log", false},
+		{"del C:/temp/s.txt", false},
+		{"rd C:\\temp\\sub", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckScriptCommand(tt.command)
+		if (err != nil) != tt.refused {
+			t.Errorf("CheckScriptCommand(%q) error = %v, refused want %v", tt.command, err, tt.refused)
+		}
+	}
+}
+
+func TestExpandScriptCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"echo %i", "echo kampus-wg0"},
+		{"netsh interface set interface %i admin=enabled", "netsh interface set interface kampus-wg0 admin=enabled"},
+		{"echo %i %i", "echo kampus-wg0 kampus-wg0"},
+		{"echo %PATH%", "echo %PATH%"},
+		{"echo done", "echo done"},
+	}
+
+	for _, tt := range tests {
+		if got := expandScriptCommand(tt.command, "kampus-wg0"); got != tt.want {
+			t.Errorf("expandScriptCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestConsentedScripts(t *testing.T) {
+	wg := UserWireGuardConfig{
+		PostUp:   []string{"echo up"},
+		PostDown: []string{"echo down"},
+	}
+
+	if got := wg.ConsentedPostUp(); got != nil {
+		t.Errorf("ConsentedPostUp() without consent = %q, want nil", got)
+	}
+	if got := wg.ConsentedPostDown(); got != nil {
+		t.Errorf("ConsentedPostDown() without consent = %q, want nil", got)
+	}
+
+	wg.AllowScripts = true
+	if got := wg.ConsentedPostUp(); !equalStringSlices(got, wg.PostUp) {
+		t.Errorf("ConsentedPostUp() with consent = %q, want %q", got, wg.PostUp)
+	}
+	if got := wg.ConsentedPostDown(); !equalStringSlices(got, wg.PostDown) {
+		t.Errorf("ConsentedPostDown() with consent = %q, want %q", got, wg.PostDown)
+	}
+}
+
+func TestRunWireGuardScriptsRefusesDangerous(t *testing.T) {
+	var logged []string
+	results := RunWireGuardScripts(failingScriptRunner(t), []string{"format %i:"}, "c", func(line string) {
+		logged = append(logged, line)
+	})
+
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if !results[0].Refused {
+		t.Errorf("dangerous command was not refused: %+v", results[0])
+	}
+	if results[0].Command != "format c:" {
+		t.Errorf("Command = %q, want %%i substituted", results[0].Command)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "refused") {
+		t.Errorf("log = %q, want one refusal line", logged)
+	}
+}
+
+func TestWithoutScriptConsent(t *testing.T) {
+	configs := []UserWireGuardConfig{
+		{Tag: "office", PostUp: []string{"echo up"}, AllowScripts: true},
+		{Tag: "home"},
+	}
+
+	got := withoutScriptConsent(configs)
+	for _, wg := range got {
+		if wg.AllowScripts {
+			t.Errorf("%s: AllowScripts kept", wg.Tag)
+		}
+	}
+	if !configs[0].AllowScripts {
+		t.Error("withoutScriptConsent modified its argument")
+	}
+	if !equalStringSlices(got[0].PostUp, configs[0].PostUp) {
+		t.Errorf("PostUp = %q, want the commands kept", got[0].PostUp)
+	}
+	if withoutScriptConsent(nil) != nil {
+		t.Error("withoutScriptConsent(nil) != nil")
+	}
+}
+
+func TestScriptConsentNotExported(t *testing.T) {
+	configs := []UserWireGuardConfig{
+		{Tag: "office", PostUp: []string{"echo up"}, AllowScripts: true},
+	}
+
+	data, err := json.Marshal(exportableWireGuardConfigs(configs))
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if strings.Contains(string(data), "allow_scripts") {
+		t.Errorf("export contains allow_scripts: %s", data)
+	}
+
+	profile := shareableProfile(ProfileData{Name: "Work", WireGuardConfigs: configs})
+	if profile.WireGuardConfigs[0].AllowScripts {
+		t.Error("shareableProfile kept AllowScripts")
+	}
+}
+
+func TestImportedProfileDropsScriptConsent(t *testing.T) {
+	data := `{
+		"format": "kampus-profile-v1",
+		"profile": {
+			"name": "Shared",
+			"wireguard_configs": [
+				{"tag": "office", "name": "Office", "post_up": ["echo up"], "allow_scripts": true}
+			]
+		}
+	}`
+
+	export, err := parseProfileExport(data)
+	if err != nil {
+		t.Fatalf("parseProfileExport: %v", err)
+	}
+	profile := shareableProfile(export.Profile)
+	if profile.WireGuardConfigs[0].AllowScripts {
+		t.Error("imported profile kept AllowScripts from the file")
+	}
+}
+
+// failingScriptRunner fails the test if a command is run
+func failingScriptRunner(t *testing.T) commandRunner {
+	return func(timeout time.Duration, name string, args ...string) ([]byte, error) {
+		t.Errorf("command run: %s %q", name, args)
+		return nil, nil
+	}
+}
+
+func TestRunWireGuardScriptsCapturesOutput(t *testing.T) {
+	var calls [][]string
+	run := func(timeout time.Duration, name string, args ...string) ([]byte, error) {
+		if timeout != WireGuardScriptTimeout {
+			t.Errorf("timeout = %v, want %v", timeout, WireGuardScriptTimeout)
+		}
+		calls = append(calls, append([]string{name}, args...))
+		if strings.Contains(args[len(args)-1], "fail") {
+			return []byte("Access is denied.\r\n"), errors.New("exit status 5")
+		}
+		return []byte("  Ok.\r\n\r\n"), nil
+	}
+
+	var logged []string
+	results := RunWireGuardScripts(run, []string{"route add 10.9.0.0 %i", "fail %i", "echo %i"}, "kampus-wg0", func(line string) {
+		logged = append(logged, line)
+	})
+
+	wantCalls := [][]string{
+		{"cmd", "/C", "route add 10.9.0.0 kampus-wg0"},
+		{"cmd", "/C", "fail kampus-wg0"},
+		{"cmd", "/C", "echo kampus-wg0"},
+	}
+	if len(calls) != len(wantCalls) {
+		t.Fatalf("calls = %q, want %q", calls, wantCalls)
+	}
+	for i := range wantCalls {
+		if !equalStringSlices(calls[i], wantCalls[i]) {
+			t.Errorf("call %d = %q, want %q", i, calls[i], wantCalls[i])
+		}
+	}
+
+	want := []WireGuardScriptResult{
+		{Command: "route add 10.9.0.0 kampus-wg0", Output: "Ok."},
+		{Command: "fail kampus-wg0", Output: "Access is denied.", Error: "exit status 5"},
+		{Command: "echo kampus-wg0", Output: "Ok."},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+
+	joined := strings.Join(logged, "\n")
+	for _, line := range []string{"Script output: Ok.", "Script output: Access is denied.", "Script error: exit status 5"} {
+		if !strings.Contains(joined, line) {
+			t.Errorf("log lacks %q:\n%s", line, joined)
+		}
+	}
+}
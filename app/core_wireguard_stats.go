@@ -0,0 +1,135 @@
+// Package main provides transfer statistics of native WireGuard tunnels for KampusVPN.
+// The UI polls all tunnels at once; each poll is compared with the previous
+// sample of the same tunnel, so it gets current throughput and not just the
+// counters since the tunnel came up. A tunnel that went away between polls
+// is reported as stopped instead of failing the whole response.
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// WireGuardPeerStats is the transfer of one peer of a tunnel.
+type WireGuardPeerStats struct {
+	PublicKey     string `json:"public_key"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	RxBytes       int64  `json:"rx_bytes"`
+	TxBytes       int64  `json:"tx_bytes"`
+	RxDelta       int64  `json:"rx_delta"`       // Since the previous poll
+	TxDelta       int64  `json:"tx_delta"`       // Since the previous poll
+	LastHandshake int64  `json:"last_handshake"` // Unix seconds, 0 if there was none
+}
+
+// WireGuardTunnelStats is the transfer of one tunnel.
+type WireGuardTunnelStats struct {
+	Name          string               `json:"name"`
+	ConfigID      int                  `json:"config_id"`
+	Running       bool                 `json:"running"`
+	Error         string               `json:"error,omitempty"`
+	RxBytes       int64                `json:"rx_bytes"`
+	TxBytes       int64                `json:"tx_bytes"`
+	RxDelta       int64                `json:"rx_delta"`
+	TxDelta       int64                `json:"tx_delta"`
+	RxRate        int64                `json:"rx_rate"`  // Bytes per second since the previous poll
+	TxRate        int64                `json:"tx_rate"`  // Bytes per second since the previous poll
+	Interval      float64              `json:"interval"` // Seconds since the previous poll, 0 on the first one
+	LastHandshake int64                `json:"last_handshake"`
+	Peers         []WireGuardPeerStats `json:"peers"`
+}
+
+// wgStatsSample is the previous poll of a tunnel
+type wgStatsSample struct {
+	configID int
+	at       time.Time
+	peers    map[string][2]int64 // Public key -> rx, tx
+}
+
+// CollectTunnelStats reads the transfer of all active tunnels and computes
+// the deltas against the previous call
+func (m *NativeWireGuardManager) CollectTunnelStats() []WireGuardTunnelStats {
+	active := m.GetActiveTunnels()
+	now := time.Now()
+
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if m.statsSamples == nil {
+		m.statsSamples = make(map[string]wgStatsSample)
+	}
+
+	result := []WireGuardTunnelStats{}
+	seen := map[string]bool{}
+	for _, tunnel := range active {
+		seen[tunnel.Name] = true
+		stats := WireGuardTunnelStats{Name: tunnel.Name, ConfigID: tunnel.ConfigID, Peers: []WireGuardPeerStats{}}
+
+		peers, err := m.DumpTunnel(tunnel.ConfigID)
+		if err != nil {
+			// The tunnel went down after GetActiveTunnels
+			stats.Error = err.Error()
+			delete(m.statsSamples, tunnel.Name)
+			result = append(result, stats)
+			continue
+		}
+		stats.Running = true
+
+		previous, hasPrevious := m.statsSamples[tunnel.Name]
+		sample := wgStatsSample{configID: tunnel.ConfigID, at: now, peers: make(map[string][2]int64)}
+		for _, peer := range peers {
+			ps := WireGuardPeerStats{
+				PublicKey: peer.PublicKey,
+				Endpoint:  peer.Endpoint,
+				RxBytes:   peer.ReceivedBytes,
+				TxBytes:   peer.SentBytes,
+			}
+			if !peer.LatestHandshake.IsZero() {
+				ps.LastHandshake = peer.LatestHandshake.Unix()
+			}
+			if hasPrevious {
+				last := previous.peers[peer.PublicKey]
+				ps.RxDelta = counterDelta(last[0], peer.ReceivedBytes)
+				ps.TxDelta = counterDelta(last[1], peer.SentBytes)
+			}
+			sample.peers[peer.PublicKey] = [2]int64{peer.ReceivedBytes, peer.SentBytes}
+
+			stats.RxBytes += ps.RxBytes
+			stats.TxBytes += ps.TxBytes
+			stats.RxDelta += ps.RxDelta
+			stats.TxDelta += ps.TxDelta
+			if ps.LastHandshake > stats.LastHandshake {
+				stats.LastHandshake = ps.LastHandshake
+			}
+			stats.Peers = append(stats.Peers, ps)
+		}
+		if hasPrevious {
+			stats.Interval = now.Sub(previous.at).Seconds()
+			if stats.Interval > 0 {
+				stats.RxRate = int64(float64(stats.RxDelta) / stats.Interval)
+				stats.TxRate = int64(float64(stats.TxDelta) / stats.Interval)
+			}
+		}
+		m.statsSamples[tunnel.Name] = sample
+		result = append(result, stats)
+	}
+
+	// Tunnels polled before but gone now
+	for name, sample := range m.statsSamples {
+		if seen[name] {
+			continue
+		}
+		result = append(result, WireGuardTunnelStats{Name: name, ConfigID: sample.configID, Peers: []WireGuardPeerStats{}})
+		delete(m.statsSamples, name)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// counterDelta returns the growth of a counter; a counter that went back
+// (the tunnel was restarted) counts from zero
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWireGuardConfigEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		host     string
+		port     int
+		address  string
+	}{
+		{"vpn.example.com:51820", "vpn.example.com", 51820, "vpn.example.com:51820"},
+		{"203.0.113.10:51820", "203.0.113.10", 51820, "203.0.113.10:51820"},
+		{"[2001:db8::1]:51820", "2001:db8::1", 51820, "[2001:db8::1]:51820"},
+		{"[2001:db8::1]", "2001:db8::1", 0, "2001:db8::1"},
+		{"vpn.example.com", "vpn.example.com", 0, "vpn.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			conf := strings.Replace(testWireGuardConf(t), "Endpoint = vpn.example.com:51820", "Endpoint = "+tt.endpoint, 1)
+			wg, err := ParseWireGuardConfig(conf)
+			if err != nil {
+				t.Fatalf("ParseWireGuardConfig: %v", err)
+			}
+			if wg.Endpoint != tt.host || wg.EndpointPort != tt.port {
+				t.Errorf("endpoint = %q port %d, want %q port %d", wg.Endpoint, wg.EndpointPort, tt.host, tt.port)
+			}
+			if got := wg.EndpointAddress(); got != tt.address {
+				t.Errorf("EndpointAddress = %q, want %q", got, tt.address)
+			}
+			if peer := wg.ToWireGuardConfig().Peers[0]; peer.Endpoint != tt.host || peer.Port != tt.port {
+				t.Errorf("peer = %s:%d", peer.Endpoint, peer.Port)
+			}
+		})
+	}
+
+	// Bracketed hosts stored by older versions
+	legacy := UserWireGuardConfig{Endpoint: "[2001:db8::1]", EndpointPort: 51820}
+	if got := legacy.EndpointAddress(); got != "[2001:db8::1]:51820" {
+		t.Errorf("legacy EndpointAddress = %q", got)
+	}
+}
+
+func TestDerivedInternalDomainsIPEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     []string
+	}{
+		{"vpn.corp.local", []string{".corp.local", ".vpn.corp.local"}},
+		{"10.0.0.5", nil},
+		{"2001:db8::1", nil},
+		{"[2001:db8::1]", nil},
+	}
+	for _, tt := range tests {
+		wg := UserWireGuardConfig{Endpoint: tt.endpoint}
+		if got := wg.DerivedInternalDomains(); !equalStringSlices(got, tt.want) {
+			t.Errorf("DerivedInternalDomains(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestExtractNetworksFromAllowedIPs(t *testing.T) {
+	got := ExtractNetworksFromAllowedIPs([]string{
+		"10.8.0.0/24",
+		" 10.8.0.7 ",
+		"2001:db8::1",
+		"2001:db8:1::/48",
+		"2001:db8:1::5/48", // Masked to the network above
+		"0.0.0.0/0",
+		"::/0",
+		"[2001:db8::2]",
+		"not-an-ip",
+	})
+	want := []string{"10.8.0.0/24", "10.8.0.7/32", "2001:db8::1/128", "2001:db8:1::/48"}
+	if !equalStringSlices(got, want) {
+		t.Errorf("ExtractNetworksFromAllowedIPs = %v, want %v", got, want)
+	}
+}
+
+func TestInternalDomainsModes(t *testing.T) {
+	explicit := []string{"Wiki.Office", ".git.office"}
+
+	tests := []struct {
+		name      string
+		mode      string
+		domains   []string
+		effective []string
+		suffixes  []string
+	}{
+		{"auto derives from the endpoint", "", nil, []string{".corp.local", ".vpn.corp.local"}, []string{".corp.local", ".vpn.corp.local", ".local", ".office.local"}},
+		{"explicit auto", InternalDomainsAuto, nil, []string{".corp.local", ".vpn.corp.local"}, []string{".corp.local", ".vpn.corp.local", ".local", ".office.local"}},
+		{"auto prefers the list", "", explicit, explicit, []string{".wiki.office", ".git.office", ".local", ".office.local"}},
+		{"manual uses only the list", InternalDomainsManual, explicit, explicit, []string{".wiki.office", ".git.office"}},
+		{"manual without a list", InternalDomainsManual, nil, nil, []string{}},
+		{"none ignores the list", InternalDomainsNone, explicit, []string{}, []string{}},
+		{"none derives nothing", InternalDomainsNone, nil, []string{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wg := UserWireGuardConfig{Tag: "office", Endpoint: "vpn.corp.local", InternalDomains: tt.domains, InternalDomainsMode: tt.mode}
+			if got := wg.GetInternalDomains(); !equalStringSlices(got, tt.effective) {
+				t.Errorf("GetInternalDomains = %v, want %v", got, tt.effective)
+			}
+			if got := wg.DNSDomainSuffixes(); !equalStringSlices(got, tt.suffixes) {
+				t.Errorf("DNSDomainSuffixes = %v, want %v", got, tt.suffixes)
+			}
+			if got := wg.DerivedInternalDomains(); !equalStringSlices(got, []string{".corp.local", ".vpn.corp.local"}) {
+				t.Errorf("DerivedInternalDomains = %v, the mode must not change the preview", got)
+			}
+		})
+	}
+}
+
+func TestDerivedInternalDomainsFilters(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     []string
+	}{
+		// Public suffixes would send public lookups to the office DNS
+		{"vpn.company.com", nil},
+		{"vpn.company.ru", nil},
+		{"vpn.company.co.uk", nil},
+		{"vpn.office.company.local", []string{".company.local", ".office.company.local"}},
+		// A bare standard suffix (.corp) is already in the template rules
+		{"gw.corp", []string{".gw.corp"}},
+		{"vpn.site.corp", []string{".site.corp", ".vpn.site.corp"}},
+		{"vpn", nil},
+	}
+	for _, tt := range tests {
+		wg := UserWireGuardConfig{Endpoint: tt.endpoint}
+		got := wg.DerivedInternalDomains()
+		if !equalStringSlices(got, tt.want) {
+			t.Errorf("DerivedInternalDomains(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+		for _, domain := range got {
+			if isStandardInternalDomain(domain) || isPublicDomain(domain) {
+				t.Errorf("DerivedInternalDomains(%q) kept filtered %q", tt.endpoint, domain)
+			}
+		}
+	}
+}
+
+func TestCollectAllInternalDomainsHonorsMode(t *testing.T) {
+	configs := []UserWireGuardConfig{
+		{Tag: "office", Endpoint: "vpn.corp.local"},
+		{Tag: "lab", Endpoint: "vpn.lab.local", InternalDomainsMode: InternalDomainsNone},
+		{Tag: "dc", Endpoint: "vpn.dc.local", InternalDomains: []string{" DC.Local ", "corp.local", ""}, InternalDomainsMode: InternalDomainsManual},
+	}
+
+	want := []string{".corp.local", ".vpn.corp.local", ".dc.local"}
+	if got := CollectAllInternalDomains(configs); !equalStringSlices(got, want) {
+		t.Errorf("CollectAllInternalDomains = %v, want %v", got, want)
+	}
+}
+
+func TestValidateInternalDomainsMode(t *testing.T) {
+	for _, mode := range []string{"", InternalDomainsAuto, InternalDomainsManual, InternalDomainsNone} {
+		if err := ValidateInternalDomainsMode(mode); err != nil {
+			t.Errorf("ValidateInternalDomainsMode(%q) = %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"Auto", "off", "all"} {
+		if ValidateInternalDomainsMode(mode) == nil {
+			t.Errorf("ValidateInternalDomainsMode(%q) accepted", mode)
+		}
+	}
+}
@@ -160,7 +160,7 @@ function setupEventListeners() {
     });
     
     // Update progress events
-    runtime.EventsOn("update-progress", (data) => {
+    runtime.EventsOn("update-download-progress", (data) => {
         handleUpdateProgress(data);
     });
     
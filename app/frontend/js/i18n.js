@@ -111,6 +111,8 @@ const i18n = {
         yes: 'Да',
         no: 'Нет',
         importWarning: '⚠️ ВНИМАНИЕ: Все текущие профили будут заменены!',
+        exportPassphrasePrompt: 'Пароль для шифрования файла (оставьте пустым для экспорта без шифрования):',
+        importPassphrasePrompt: 'Файл зашифрован. Введите пароль:',
     },
     en: {
         // Status
@@ -222,6 +224,8 @@ const i18n = {
         yes: 'Yes',
         no: 'No',
         importWarning: '⚠️ WARNING: All current profiles will be replaced!',
+        exportPassphrasePrompt: 'Passphrase to encrypt the file (leave empty to export unencrypted):',
+        importPassphrasePrompt: 'The file is encrypted. Enter the passphrase:',
     }
 };
 
@@ -226,7 +226,12 @@ async function exportProfiles() {
             return;
         }
         
-        const result = await API.ExportProfilesToFile();
+        const passphrase = prompt(t('exportPassphrasePrompt'), '');
+        if (passphrase === null) {
+            return;
+        }
+        
+        const result = await API.ExportProfilesToFile(passphrase);
         
         if (result.success) {
             showToast(t('profilesExported', { count: result.profiles_count }), 'success');
@@ -251,6 +256,14 @@ async function importProfiles() {
         
         const result = await API.ImportProfilesFromFile();
         
+        if (result.success && result.needs_password) {
+            const passphrase = prompt(t('importPassphrasePrompt'), '');
+            if (passphrase && confirm(t('importWarning'))) {
+                confirmImport(result.file_data, passphrase);
+            }
+            return;
+        }
+        
         if (!result.success) {
             if (result.error !== 'Отменено пользователем') {
                 showToast(result.error, 'error');
@@ -285,19 +298,19 @@ ${profilesList}
 ${t('importWarning')}`;
     
     if (confirm(message)) {
-        confirmImport(validationResult.file_data);
+        confirmImport(validationResult.file_data, '');
     }
 }
 
 // Confirm and execute import
-async function confirmImport(jsonData) {
+async function confirmImport(jsonData, passphrase) {
     try {
         if (!API.ConfirmImportProfiles) {
             showToast(t('importNotAvailable'), 'error');
             return;
         }
         
-        const result = await API.ConfirmImportProfiles(jsonData);
+        const result = await API.ConfirmImportProfiles(jsonData, passphrase);
         
         if (result.success) {
             showToast(t('profilesImported', { count: result.profiles_count }), 'success');
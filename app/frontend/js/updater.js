@@ -82,8 +82,11 @@ async function startUpdate() {
         // Reset progress
         updateDownloadProgress(0, t('preparingDownload'));
         
-        // Start download
-        await API.DownloadAndInstallUpdate(downloadUrl);
+        // Start download (the checksum is verified before the app restarts)
+        const result = await API.DownloadAndInstallUpdate(downloadUrl);
+        if (!result || !result.success) {
+            throw new Error((result && result.error) || t('updateFailed'));
+        }
         
         // If we get here without restart, show success
         updateDownloadProgress(100, t('updateComplete'));
@@ -105,7 +108,7 @@ async function startUpdate() {
 function handleUpdateProgress(data) {
     if (!data) return;
     
-    const progress = data.progress || 0;
+    const progress = data.percent || 0;
     const status = data.status || '';
     const speed = data.speed || 0;
     const downloaded = data.downloaded || 0;
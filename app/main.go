@@ -4,6 +4,7 @@ import (
 	"embed"
 	"log"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
@@ -33,6 +34,15 @@ var embeddedTemplate []byte
 var appInstance *App
 var systrayReady = make(chan struct{})
 
+// Пункты меню трея, обновляемые перед показом
+var (
+	trayStatusItem   *systray.MenuItem
+	trayConnectItem  *systray.MenuItem
+	trayProfileItems = make([]*systray.MenuItem, TrayProfileSlots)
+	trayProfileIDs   []int
+	trayStatusText   = "Отключено"
+)
+
 // Windows API для single instance и смены иконки
 var (
 	kernel32        = syscall.NewLazyDLL("kernel32.dll")
@@ -61,6 +71,12 @@ func copyEmbeddedTemplate(destPath string) error {
 }
 
 func main() {
+	// Служебный режим: сервис, запускающий sing-box без прав администратора у GUI
+	if serviceModeRequested(os.Args[1:]) {
+		runService()
+		return
+	}
+
 	// Проверяем single instance
 	mutexName, _ := syscall.UTF16PtrFromString("Global\\KampusVPN_SingleInstance")
 	handle, _, err := createMutex.Call(0, 1, uintptr(unsafe.Pointer(mutexName)))
@@ -83,15 +99,25 @@ func main() {
 	}
 
 	appInstance = NewApp()
+	defer appInstance.crash.Guard("main")
+	appInstance.trayOnly = trayOnlyRequested(os.Args[1:])
 
 	// Запускаем systray в отдельной горутине (более надёжно на Windows)
 	go func() {
+		defer appInstance.crash.Guard("systray")
 		systray.Run(onSystrayReady, onSystrayExit)
 	}()
 
 	// Небольшая задержка для инициализации systray
 	<-systrayReady
 
+	// Лёгкий режим: всё, кроме окна, работает сразу, webview создаётся по «Открыть»
+	if appInstance.trayOnly {
+		log.Println("Tray-only mode, window deferred")
+		appInstance.startBackend()
+		<-appInstance.guiRequested
+	}
+
 	// Запускаем Wails в main goroutine (более стабильно для GUI)
 	runWails()
 }
@@ -148,12 +174,29 @@ func onSystrayReady() {
 
 	// Правый клик - показать меню
 	systray.SetOnRClick(func(menu systray.IMenu) {
+		refreshTrayMenu()
 		menu.ShowMenu()
 	})
 
 	// Пункты меню (показываются по правому клику)
 	mShow := systray.AddMenuItem("Открыть", "Показать окно")
 	systray.AddSeparator()
+	trayStatusItem = systray.AddMenuItem("Отключено", "Состояние подключения")
+	trayStatusItem.Disable()
+	trayConnectItem = systray.AddMenuItem("Подключить", "Подключить или отключить VPN")
+	mProfiles := systray.AddMenuItem("Профиль", "Сменить профиль")
+	for i := range trayProfileItems {
+		slot := i
+		item := mProfiles.AddSubMenuItemCheckbox("", "", false)
+		item.Hide()
+		item.Click(func() {
+			if appInstance != nil && slot < len(trayProfileIDs) {
+				go appInstance.TraySwitchProfile(trayProfileIDs[slot])
+			}
+		})
+		trayProfileItems[i] = item
+	}
+	systray.AddSeparator()
 	mLogs := systray.AddMenuItem("Логи", "Открыть файл логов")
 	mAbout := systray.AddMenuItem("О программе", "Информация о программе")
 	systray.AddSeparator()
@@ -169,6 +212,12 @@ func onSystrayReady() {
 		}
 	})
 
+	trayConnectItem.Click(func() {
+		if appInstance != nil {
+			go appInstance.TrayToggleConnection()
+		}
+	})
+
 	mLogs.Click(func() {
 		if appInstance != nil {
 			appInstance.OpenLogs()
@@ -189,6 +238,44 @@ func onSystrayReady() {
 	})
 }
 
+// refreshTrayMenu обновляет состояние и список профилей перед показом меню
+func refreshTrayMenu() {
+	if appInstance == nil {
+		return
+	}
+	running, profiles, activeID := appInstance.trayMenuState()
+
+	trayStatusItem.SetTitle(trayStatusText)
+	if running {
+		trayConnectItem.SetTitle("Отключить")
+	} else {
+		trayConnectItem.SetTitle("Подключить")
+	}
+
+	trayProfileIDs = trayProfileIDs[:0]
+	for i, item := range trayProfileItems {
+		if i >= len(profiles) {
+			item.Hide()
+			continue
+		}
+		trayProfileIDs = append(trayProfileIDs, profiles[i].ID)
+		item.SetTitle(profiles[i].Name)
+		if profiles[i].ID == activeID {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+		item.Show()
+	}
+}
+
+// ShowTrayMessage показывает сообщение в подсказке и меню трея
+// (основной канал обратной связи в режиме без окна)
+func ShowTrayMessage(message string) {
+	trayStatusText = message
+	systray.SetTooltip("Kampus VPN - " + message)
+}
+
 func onSystrayExit() {
 	// Cleanup при выходе из systray
 }
@@ -202,15 +289,28 @@ func UpdateTrayIcon(status string) {
 	case "connected":
 		iconData = iconGreen
 		tooltip = "Kampus VPN - Подключено"
+	case "connecting":
+		iconData = iconGrey
+		tooltip = "Kampus VPN - Подключение…"
+	case "warning":
+		iconData = iconGreen
+		tooltip = "Kampus VPN - Подключено с предупреждениями"
+	case "no-internet":
+		iconData = iconRed
+		tooltip = "Kampus VPN - Подключено (нет интернета через прокси)"
 	case "error":
 		iconData = iconRed
 		tooltip = "Kampus VPN - Ошибка"
+	case "paused":
+		iconData = iconGrey
+		tooltip = "Kampus VPN - Пауза (трафик идёт напрямую)"
 	default:
 		iconData = iconGrey
 		tooltip = "Kampus VPN - Отключено"
 	}
 	
 	log.Printf("UpdateTrayIcon: status=%s, iconLen=%d", status, len(iconData))
+	trayStatusText = strings.TrimPrefix(tooltip, "Kampus VPN - ")
 	
 	// Обновляем иконку в трее
 	systray.SetIcon(iconData)
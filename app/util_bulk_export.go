@@ -0,0 +1,331 @@
+// Package main provides batch editing of exported profile files for KampusVPN.
+// Admins apply one declarative change set to an export file and get a new export
+// file; local profiles are never touched.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Bulk edit operation types
+const (
+	BulkOpSetSubscription = "set_subscription"
+	BulkOpSetRoutingMode  = "set_routing_mode"
+	BulkOpAddWireGuard    = "add_wireguard"
+	BulkOpRemoveProxies   = "remove_proxies"
+)
+
+// BulkEditOperation is one declarative change applied to an export file.
+type BulkEditOperation struct {
+	Type string `json:"type"` // set_subscription, set_routing_mode, add_wireguard, remove_proxies
+
+	// Profile filter: glob on profile name ("Lab-*"), empty matches all profiles
+	NamePattern string `json:"name_pattern,omitempty"`
+
+	SubscriptionURL string `json:"subscription_url,omitempty"` // set_subscription
+	RoutingMode     string `json:"routing_mode,omitempty"`     // set_routing_mode
+
+	// add_wireguard: standard WireGuard .conf text with tag and display name
+	WireGuardTag    string `json:"wireguard_tag,omitempty"`
+	WireGuardName   string `json:"wireguard_name,omitempty"`
+	WireGuardConfig string `json:"wireguard_config,omitempty"`
+
+	TagRegex string `json:"tag_regex,omitempty"` // remove_proxies
+}
+
+// BulkEditResult reports how many profiles one operation affected.
+type BulkEditResult struct {
+	Type     string `json:"type"`
+	Affected int    `json:"affected"`
+}
+
+// validateBulkOperations checks all operations before any of them is applied.
+func validateBulkOperations(operations []BulkEditOperation) error {
+	for i, op := range operations {
+		if op.NamePattern != "" {
+			if _, err := filepath.Match(op.NamePattern, ""); err != nil {
+				return fmt.Errorf("операция %d: неверный шаблон имени %q", i+1, op.NamePattern)
+			}
+		}
+
+		switch op.Type {
+		case BulkOpSetSubscription:
+			if strings.TrimSpace(op.SubscriptionURL) == "" {
+				return fmt.Errorf("операция %d: не указан URL подписки", i+1)
+			}
+		case BulkOpSetRoutingMode:
+			if ValidateRoutingMode(RoutingMode(op.RoutingMode)) != nil {
+				return fmt.Errorf("операция %d: неизвестный режим маршрутизации %q", i+1, op.RoutingMode)
+			}
+		case BulkOpAddWireGuard:
+			if err := ValidateTag(op.WireGuardTag); err != nil {
+				return fmt.Errorf("операция %d: %w", i+1, err)
+			}
+			wg, err := ParseWireGuardConfig(op.WireGuardConfig)
+			if err != nil {
+				return fmt.Errorf("операция %d: ошибка парсинга конфига: %w", i+1, err)
+			}
+			if err := ValidateAllowedIPs(wg.AllowedIPs); err != nil {
+				return fmt.Errorf("операция %d: %w", i+1, err)
+			}
+		case BulkOpRemoveProxies:
+			if op.TagRegex == "" {
+				return fmt.Errorf("операция %d: не указано регулярное выражение тегов", i+1)
+			}
+			if _, err := regexp.Compile(op.TagRegex); err != nil {
+				return fmt.Errorf("операция %d: неверное регулярное выражение: %w", i+1, err)
+			}
+		default:
+			return fmt.Errorf("операция %d: неизвестный тип %q", i+1, op.Type)
+		}
+	}
+	return nil
+}
+
+// matchesProfile reports whether the operation applies to the profile.
+func (op BulkEditOperation) matchesProfile(p *ProfileData) bool {
+	if op.NamePattern == "" {
+		return true
+	}
+	matched, _ := filepath.Match(strings.ToLower(op.NamePattern), strings.ToLower(p.Name))
+	return matched
+}
+
+// applyBulkOperations applies validated operations to export data in order.
+func applyBulkOperations(export *FullExportData, operations []BulkEditOperation) ([]BulkEditResult, error) {
+	results := make([]BulkEditResult, 0, len(operations))
+
+	// Older exports keep the routing mode globally; set_routing_mode changes single profiles.
+	// Script consent doesn't travel with the file.
+	for i := range export.Profiles {
+		migrateProfileRoutingMode(&export.Profiles[i], export.AppSettings.RoutingMode)
+		export.Profiles[i].WireGuardConfigs = withoutScriptConsent(export.Profiles[i].WireGuardConfigs)
+	}
+
+	for i, op := range operations {
+		result := BulkEditResult{Type: op.Type}
+
+		for j := range export.Profiles {
+			profile := &export.Profiles[j]
+			if !op.matchesProfile(profile) {
+				continue
+			}
+			changed, err := applyBulkOperationToProfile(profile, op)
+			if err != nil {
+				return nil, fmt.Errorf("операция %d, профиль %q: %w", i+1, profile.Name, err)
+			}
+			if changed {
+				result.Affected++
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// applyBulkOperationToProfile applies a per-profile operation.
+func applyBulkOperationToProfile(profile *ProfileData, op BulkEditOperation) (bool, error) {
+	switch op.Type {
+	case BulkOpSetSubscription:
+		if profile.SubscriptionURL == op.SubscriptionURL {
+			return false, nil
+		}
+		profile.SubscriptionURL = op.SubscriptionURL
+		return true, nil
+
+	case BulkOpSetRoutingMode:
+		if profile.RoutingMode == RoutingMode(op.RoutingMode) {
+			return false, nil
+		}
+		profile.RoutingMode = RoutingMode(op.RoutingMode)
+		return true, nil
+
+	case BulkOpAddWireGuard:
+		for _, existing := range profile.WireGuardConfigs {
+			if existing.Tag == op.WireGuardTag {
+				return false, fmt.Errorf("конфиг с тегом '%s' уже существует", op.WireGuardTag)
+			}
+		}
+		if len(profile.WireGuardConfigs) >= MaxWireGuardConfigs {
+			return false, fmt.Errorf("достигнут лимит WireGuard конфигов (%d)", MaxWireGuardConfigs)
+		}
+		wg, err := ParseWireGuardConfig(op.WireGuardConfig)
+		if err != nil {
+			return false, err
+		}
+		wg.Tag = op.WireGuardTag
+		wg.Name = op.WireGuardName
+		if wg.Name == "" {
+			wg.Name = wg.Tag
+		}
+		profile.WireGuardConfigs = append(profile.WireGuardConfigs, *wg)
+		return true, nil
+
+	case BulkOpRemoveProxies:
+		pattern := regexp.MustCompile(op.TagRegex)
+		removed := removeProxyOutbounds(profile.SingboxConfig, pattern)
+		if removed == 0 {
+			return false, nil
+		}
+		profile.ProxyCount -= removed
+		if profile.ProxyCount < 0 {
+			profile.ProxyCount = 0
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// removeProxyOutbounds removes proxy outbounds whose tag matches pattern from a
+// generated config, including references in selector/urltest groups.
+// Returns the number of removed outbounds.
+func removeProxyOutbounds(config map[string]interface{}, pattern *regexp.Regexp) int {
+	outbounds, ok := config["outbounds"].([]interface{})
+	if !ok {
+		return 0
+	}
+
+	serviceTypes := map[string]bool{
+		"direct": true, "block": true, "dns": true,
+		"selector": true, "urltest": true,
+	}
+
+	removedTags := make(map[string]bool)
+	kept := make([]interface{}, 0, len(outbounds))
+	for _, ob := range outbounds {
+		obMap, ok := ob.(map[string]interface{})
+		if !ok {
+			kept = append(kept, ob)
+			continue
+		}
+		tag, _ := obMap["tag"].(string)
+		obType, _ := obMap["type"].(string)
+		if !serviceTypes[obType] && pattern.MatchString(tag) {
+			removedTags[tag] = true
+			continue
+		}
+		kept = append(kept, ob)
+	}
+
+	if len(removedTags) == 0 {
+		return 0
+	}
+
+	for _, ob := range kept {
+		obMap, ok := ob.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		members, ok := obMap["outbounds"].([]interface{})
+		if !ok {
+			continue
+		}
+		filtered := make([]interface{}, 0, len(members))
+		for _, member := range members {
+			if name, _ := member.(string); !removedTags[name] {
+				filtered = append(filtered, member)
+			}
+		}
+		obMap["outbounds"] = filtered
+	}
+
+	config["outbounds"] = kept
+	return len(removedTags)
+}
+
+// BulkEditExport applies operations to an exported profiles file and writes the
+// result to outputPath. Local profiles are not modified (API для фронтенда)
+func (a *App) BulkEditExport(inputPath string, operations []BulkEditOperation, outputPath string) map[string]interface{} {
+	if inputPath == "" || outputPath == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Не указан входной или выходной файл",
+		}
+	}
+	if filepath.Clean(inputPath) == filepath.Clean(outputPath) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Выходной файл должен отличаться от входного",
+		}
+	}
+	if len(operations) == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Список операций пуст",
+		}
+	}
+
+	// Unknown or invalid operations fail the whole batch before anything is written
+	if err := validateBulkOperations(operations); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	content, err := readFileContent(inputPath)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Ошибка чтения файла: %v", err),
+		}
+	}
+
+	validation := a.ValidateImportData(content)
+	if success, _ := validation["success"].(bool); !success {
+		return validation
+	}
+
+	var export FullExportData
+	if err := json.Unmarshal([]byte(content), &export); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Неверный формат JSON: %v", err),
+		}
+	}
+
+	results, err := applyBulkOperations(&export, operations)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Ошибка экспорта: %v", err),
+		}
+	}
+
+	// The result must still be importable
+	validation = a.ValidateImportData(string(data))
+	if success, _ := validation["success"].(bool); !success {
+		return validation
+	}
+
+	if err := writeFile(outputPath, data); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Ошибка записи файла: %v", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Bulk edit: %d operation(s) applied to %s, written to %s", len(operations), inputPath, outputPath))
+
+	return map[string]interface{}{
+		"success":        true,
+		"operations":     results,
+		"profiles_count": len(export.Profiles),
+		"output_path":    outputPath,
+	}
+}
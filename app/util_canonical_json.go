@@ -0,0 +1,137 @@
+// Package main provides deterministic JSON serialization of sing-box configs for KampusVPN.
+// Top-level sections follow the sing-box documentation order, "type" and "tag"
+// lead every object, everything else is alphabetical, so rebuilding an unchanged
+// profile produces byte-identical output and small changes produce small diffs.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// canonicalSectionOrder is the order of known top-level sing-box sections
+var canonicalSectionOrder = []string{
+	"log", "dns", "ntp", "certificate", "endpoints", "inbounds", "outbounds", "route", "services", "experimental",
+}
+
+// canonicalObjectOrder are keys placed first in nested objects
+var canonicalObjectOrder = []string{"type", "tag"}
+
+// SingboxConfigMap is a sing-box config that serializes in canonical key order.
+type SingboxConfigMap map[string]interface{}
+
+// MarshalJSON implements json.Marshaler.
+func (m SingboxConfigMap) MarshalJSON() ([]byte, error) {
+	return MarshalCanonicalJSON(map[string]interface{}(m))
+}
+
+// MarshalCanonicalJSON encodes v with object keys in canonical order.
+func MarshalCanonicalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonicalJSON(&buf, reflect.ValueOf(v), true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalCanonicalJSONIndent is MarshalCanonicalJSON with json.MarshalIndent formatting.
+func MarshalCanonicalJSONIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	data, err := MarshalCanonicalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, prefix, indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalKeyRank returns the sort rank of key (lower goes first)
+func canonicalKeyRank(key string, root bool) int {
+	order := canonicalObjectOrder
+	if root {
+		order = canonicalSectionOrder
+	}
+	for i, k := range order {
+		if k == key {
+			return i
+		}
+	}
+	return len(order)
+}
+
+// writeCanonicalJSON encodes maps and slices itself and everything else via encoding/json
+func writeCanonicalJSON(buf *bytes.Buffer, v reflect.Value, root bool) error {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			ri, rj := canonicalKeyRank(keys[i], root), canonicalKeyRank(keys[j], root)
+			if ri != rj {
+				return ri < rj
+			}
+			return keys[i] < keys[j]
+		})
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())), false); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, v.Index(i), false); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
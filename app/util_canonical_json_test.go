@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{
+			name: "sections in sing-box order",
+			value: map[string]interface{}{
+				"experimental": map[string]interface{}{}, "route": map[string]interface{}{},
+				"outbounds": []interface{}{}, "custom": 1, "log": map[string]interface{}{}, "dns": map[string]interface{}{},
+				"inbounds": []interface{}{}, "endpoints": []interface{}{},
+			},
+			want: `{"log":{},"dns":{},"endpoints":[],"inbounds":[],"outbounds":[],"route":{},"experimental":{},"custom":1}`,
+		},
+		{
+			name: "type and tag first in objects",
+			value: map[string]interface{}{"outbounds": []interface{}{
+				map[string]interface{}{"server_port": 443, "tag": "de", "server": "de.example.com", "type": "trojan"},
+			}},
+			want: `{"outbounds":[{"type":"trojan","tag":"de","server":"de.example.com","server_port":443}]}`,
+		},
+		{
+			name:  "section names only rank at the top",
+			value: map[string]interface{}{"route": map[string]interface{}{"rules": 1, "log": 2, "final": "proxy"}},
+			want:  `{"route":{"final":"proxy","log":2,"rules":1}}`,
+		},
+		{
+			name:  "typed maps and slices",
+			value: map[string]interface{}{"route": map[string][]string{"b": {"2"}, "a": {"1"}}},
+			want:  `{"route":{"a":["1"],"b":["2"]}}`,
+		},
+		{
+			name:  "nil values",
+			value: map[string]interface{}{"dns": nil, "log": []string(nil), "route": map[string]interface{}(nil)},
+			want:  `{"log":null,"dns":null,"route":null}`,
+		},
+		{
+			name:  "leaves as encoding/json",
+			value: map[string]interface{}{"a": "<&>", "b": []byte("hi"), "c": 1.5, "d": true},
+			want:  `{"a":"\u003c\u0026\u003e","b":"aGk=","c":1.5,"d":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MarshalCanonicalJSON(tt.value)
+			if err != nil {
+				t.Fatalf("MarshalCanonicalJSON: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MarshalCanonicalJSON = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// testCanonicalConfig returns a config with enough keys to hit map order randomization
+func testCanonicalConfig() map[string]interface{} {
+	outbounds := []interface{}{}
+	for _, tag := range []string{"de", "nl", "us", "fi", "se", "pl"} {
+		outbounds = append(outbounds, map[string]interface{}{
+			"type": "vless", "tag": tag, "server": tag + ".example.com", "server_port": 443,
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "flow": "xtls-rprx-vision",
+			"tls": map[string]interface{}{"enabled": true, "server_name": tag + ".example.com", "utls": map[string]interface{}{"enabled": true, "fingerprint": "chrome"}},
+		})
+	}
+	return map[string]interface{}{
+		"log":       map[string]interface{}{"level": "info", "timestamp": true},
+		"dns":       map[string]interface{}{"servers": []interface{}{map[string]interface{}{"type": "udp", "tag": "local", "server": "1.1.1.1"}}},
+		"inbounds":  []interface{}{map[string]interface{}{"type": "tun", "tag": "tun-in", "address": []string{"172.19.0.1/30"}, "auto_route": true, "strict_route": true, "stack": "mixed"}},
+		"outbounds": outbounds,
+		"route":     map[string]interface{}{"final": "proxy", "auto_detect_interface": true, "rules": []interface{}{map[string]interface{}{"action": "sniff"}}},
+	}
+}
+
+func TestMarshalCanonicalJSONStable(t *testing.T) {
+	first, err := MarshalCanonicalJSONIndent(testCanonicalConfig(), "", "  ")
+	if err != nil {
+		t.Fatalf("MarshalCanonicalJSONIndent: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, _ := MarshalCanonicalJSONIndent(testCanonicalConfig(), "", "  ")
+		if string(again) != string(first) {
+			t.Fatalf("serialization %d differs:\n%s\n%s", i+2, first, again)
+		}
+	}
+
+	// The same document as encoding/json, only the key order differs
+	var canonical, plain interface{}
+	standard, _ := json.Marshal(testCanonicalConfig())
+	if err := json.Unmarshal(first, &canonical); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(standard, &plain); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(canonical, plain) {
+		t.Errorf("canonical document differs from encoding/json:\n%s\n%s", first, standard)
+	}
+}
+
+func TestMarshalCanonicalJSONMinimalDiff(t *testing.T) {
+	config := testCanonicalConfig()
+	before, _ := MarshalCanonicalJSONIndent(config, "", "  ")
+	config["outbounds"].([]interface{})[3].(map[string]interface{})["server_port"] = 8443
+	after, _ := MarshalCanonicalJSONIndent(config, "", "  ")
+
+	beforeLines := strings.Split(string(before), "\n")
+	afterLines := strings.Split(string(after), "\n")
+	if len(beforeLines) != len(afterLines) {
+		t.Fatalf("line count changed: %d -> %d", len(beforeLines), len(afterLines))
+	}
+	var changed []string
+	for i := range beforeLines {
+		if beforeLines[i] != afterLines[i] {
+			changed = append(changed, afterLines[i])
+		}
+	}
+	if len(changed) != 1 || strings.TrimSpace(changed[0]) != `"server_port": 8443,` {
+		t.Errorf("changed lines = %q, want only the port", changed)
+	}
+}
+
+func TestSingboxConfigMapMarshalJSON(t *testing.T) {
+	profile := ProfileData{SingboxConfig: SingboxConfigMap{
+		"route": map[string]interface{}{"final": "proxy"},
+		"log":   map[string]interface{}{"level": "info"},
+	}}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `{"log":{"level":"info"},"route":{"final":"proxy"}}`) {
+		t.Errorf("profile config not in canonical order: %s", data)
+	}
+}
@@ -0,0 +1,242 @@
+// Package main provides Clash API helpers for KampusVPN.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultDelayTestURL is the URL used to measure proxy delay.
+const DefaultDelayTestURL = "http://www.gstatic.com/generate_204"
+
+// clashEndpoint is the controller address and secret of the running sing-box.
+// Set before sing-box starts; read by every Clash API consumer.
+var clashEndpoint = struct {
+	mu      sync.RWMutex
+	address string
+	secret  string
+}{address: fmt.Sprintf("%s:%d", ClashAPIHost, ClashAPIPort)}
+
+// setClashAPIEndpoint sets the controller address ("host:port") and secret
+func setClashAPIEndpoint(address, secret string) {
+	clashEndpoint.mu.Lock()
+	defer clashEndpoint.mu.Unlock()
+	clashEndpoint.address = address
+	clashEndpoint.secret = secret
+}
+
+// clashAPIAddress returns the controller address ("host:port")
+func clashAPIAddress() string {
+	clashEndpoint.mu.RLock()
+	defer clashEndpoint.mu.RUnlock()
+	return clashEndpoint.address
+}
+
+// clashAPIPort returns the controller port (0 if the address has none)
+func clashAPIPort() int {
+	_, port, err := net.SplitHostPort(clashAPIAddress())
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// clashAPIURL builds a full Clash API URL for the given path.
+func clashAPIURL(path string) string {
+	return "http://" + clashAPIAddress() + path
+}
+
+// clashNewRequest creates a Clash API request carrying the controller secret.
+func clashNewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, clashAPIURL(path), body)
+	if err != nil {
+		return nil, err
+	}
+	clashEndpoint.mu.RLock()
+	secret := clashEndpoint.secret
+	clashEndpoint.mu.RUnlock()
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	return req, nil
+}
+
+// clashGet performs an authorized GET request to the Clash API.
+func clashGet(client *http.Client, path string) (*http.Response, error) {
+	req, err := clashNewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// clashGetJSON performs a GET request to the Clash API and decodes the JSON response.
+func clashGetJSON(client *http.Client, path string, out interface{}) error {
+	resp, err := clashGet(client, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// clashProxyDelay measures the delay of a single proxy via the Clash API.
+// Returns the delay in milliseconds or an error if the proxy did not respond.
+func clashProxyDelay(client *http.Client, name string, timeout time.Duration) (int, error) {
+	path := fmt.Sprintf("/proxies/%s/delay?timeout=%d&url=%s",
+		url.PathEscape(name), timeout.Milliseconds(), url.QueryEscape(DefaultDelayTestURL))
+
+	var delayResp struct {
+		Delay   int    `json:"delay"`
+		Message string `json:"message"`
+	}
+	if err := clashGetJSON(client, path, &delayResp); err != nil {
+		return 0, err
+	}
+
+	if delayResp.Delay <= 0 {
+		if delayResp.Message != "" {
+			return 0, fmt.Errorf("%s", delayResp.Message)
+		}
+		return 0, fmt.Errorf("no response")
+	}
+	return delayResp.Delay, nil
+}
+
+// clashGroupMembers returns the member list of a selector/urltest group.
+func clashGroupMembers(client *http.Client, group string) ([]string, string, error) {
+	var info struct {
+		All []string `json:"all"`
+		Now string   `json:"now"`
+	}
+	if err := clashGetJSON(client, "/proxies/"+url.PathEscape(group), &info); err != nil {
+		return nil, "", err
+	}
+	return info.All, info.Now, nil
+}
+
+// clashSelectProxy switches a selector group to the given member.
+func clashSelectProxy(client *http.Client, group, name string) error {
+	body, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return err
+	}
+	req, err := clashNewRequest(http.MethodPut, "/proxies/"+url.PathEscape(group), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+// clashPatchConfigs sends a PATCH /configs request with the given fields.
+func clashPatchConfigs(client *http.Client, fields map[string]interface{}) error {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	req, err := clashNewRequest(http.MethodPatch, "/configs", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+// clashCloseConnections closes all connections of the running instance.
+func clashCloseConnections(client *http.Client) error {
+	return clashDelete(client, "/connections")
+}
+
+// clashCloseConnection closes one connection by its ID.
+func clashCloseConnection(client *http.Client, id string) error {
+	return clashDelete(client, "/connections/"+url.PathEscape(id))
+}
+
+// clashDelete performs an authorized DELETE request to the Clash API.
+func clashDelete(client *http.Client, path string) error {
+	req, err := clashNewRequest(http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+// clashLogLevel returns the log level the running instance reports.
+func clashLogLevel(client *http.Client) (string, error) {
+	var configs struct {
+		LogLevel string `json:"log-level"`
+	}
+	if err := clashGetJSON(client, "/configs", &configs); err != nil {
+		return "", err
+	}
+	return configs.LogLevel, nil
+}
+
+// clashProxyHistories returns the last delay measurement of every proxy.
+func clashProxyHistories(client *http.Client) (map[string]DelayMeasurement, error) {
+	var proxiesResp struct {
+		Proxies map[string]struct {
+			History []clashHistoryEntry `json:"history"`
+		} `json:"proxies"`
+	}
+	if err := clashGetJSON(client, "/proxies", &proxiesResp); err != nil {
+		return nil, err
+	}
+	result := make(map[string]DelayMeasurement, len(proxiesResp.Proxies))
+	for name, proxy := range proxiesResp.Proxies {
+		result[name] = measurementFromHistory(proxy.History)
+	}
+	return result, nil
+}
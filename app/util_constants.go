@@ -75,18 +75,29 @@ const (
 const (
 	// ClashAPIHost is the host for Clash API.
 	ClashAPIHost = "127.0.0.1"
-	// ClashAPIPort is the port for Clash API.
+	// ClashAPIPort is the preferred port for Clash API (another free port is used if taken).
 	ClashAPIPort = 9090
-	// ClashAPISecret is the secret for Clash API (empty = no auth).
-	ClashAPISecret = ""
 )
 
+// Local REST API configuration
+const (
+	// LocalAPIHost is the only address the local REST API binds to.
+	LocalAPIHost = "127.0.0.1"
+	// DefaultLocalAPIPort is the default port of the local REST API.
+	DefaultLocalAPIPort = 9190
+)
+
+// URLTestCacheFile is the sing-box cache_file name inside resources.
+// It keeps urltest results between restarts and may contain fakeip mappings,
+// so it is never exported.
+const URLTestCacheFile = "cache.db"
+
 // Log configuration
 const (
-	// MaxLogSize is the maximum log file size before rotation.
+	// MaxLogSize is the default log file size before rotation.
 	MaxLogSize = 10 * 1024 * 1024 // 10 MB
-	// TruncateToSize is the size to truncate logs to when rotating.
-	TruncateToSize = 5 * 1024 * 1024 // 5 MB
+	// LogRotateKeep is the number of rotated log files kept (vpn.log.1 .. vpn.log.3).
+	LogRotateKeep = 3
 	// MaxLogBufferSize is the maximum number of log entries in UI buffer.
 	MaxLogBufferSize = 1000
 )
@@ -107,6 +118,19 @@ const (
 	LogLevelSilent LogLevel = "silent"
 )
 
+// SingboxLogLevels are the levels sing-box accepts, most verbose first.
+var SingboxLogLevels = []LogLevel{"trace", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, "fatal", "panic"}
+
+// IsValidSingboxLogLevel checks that sing-box accepts the level.
+func IsValidSingboxLogLevel(level LogLevel) bool {
+	for _, l := range SingboxLogLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
 // Profile configuration
 const (
 	// DefaultProfileID is the ID of the default profile that cannot be deleted.
@@ -174,6 +198,9 @@ const (
 	// RoutingModeAllTraffic routes all traffic through VPN.
 	// Maximum privacy, higher VPN load.
 	RoutingModeAllTraffic RoutingMode = "all_traffic"
+	
+	// RoutingModeCustom routes by the user's own sing-box rules of the profile.
+	RoutingModeCustom RoutingMode = "custom"
 )
 
 // DefaultRoutingMode is the default routing mode.
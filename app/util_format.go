@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteUnits are binary size units per UI language.
+var byteUnits = map[Language][]string{
+	LangRussian: {"Б", "КБ", "МБ", "ГБ", "ТБ", "ПБ", "ЭБ"},
+	LangEnglish: {"B", "KB", "MB", "GB", "TB", "PB", "EB"},
+}
+
+// rateUnits are bit rate units per UI language.
+var rateUnits = map[Language][]string{
+	LangRussian: {"бит/с", "Кбит/с", "Мбит/с", "Гбит/с", "Тбит/с"},
+	LangEnglish: {"bit/s", "Kbit/s", "Mbit/s", "Gbit/s", "Tbit/s"},
+}
+
+// normalizeLanguage returns a supported language, Russian by default.
+func normalizeLanguage(lang Language) Language {
+	if lang == LangEnglish {
+		return LangEnglish
+	}
+	return LangRussian
+}
+
+// formatDecimal formats a number with one decimal digit and the locale separator.
+func formatDecimal(value float64, lang Language) string {
+	s := strconv.FormatFloat(value, 'f', 1, 64)
+	if normalizeLanguage(lang) == LangRussian {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+// roundDecimal rounds a value to the digit formatDecimal shows.
+func roundDecimal(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// FormatBytesLocalized formats bytes with locale-aware units ("1,5 ГБ" / "1.5 GB").
+// Negative values (counter resets) are shown as zero.
+func FormatBytesLocalized(bytes int64, lang Language) string {
+	units := byteUnits[normalizeLanguage(lang)]
+	if bytes < 1024 {
+		if bytes < 0 {
+			bytes = 0
+		}
+		return fmt.Sprintf("%d %s", bytes, units[0])
+	}
+
+	value := float64(bytes)
+	exp := 0
+	// Values rounding up to 1024,0 are shown in the next unit
+	for roundDecimal(value) >= 1024 && exp < len(units)-1 {
+		value /= 1024
+		exp++
+	}
+	return formatDecimal(value, lang) + " " + units[exp]
+}
+
+// FormatDurationLocalized formats duration as "2 ч 15 мин" / "2 h 15 min".
+// Negative durations are shown as zero.
+func FormatDurationLocalized(d time.Duration, lang Language) string {
+	if d < 0 {
+		d = 0
+	}
+	if normalizeLanguage(lang) == LangEnglish {
+		return formatDurationEN(d)
+	}
+	return formatDuration(d)
+}
+
+// FormatRateLocalized formats a transfer rate given in bytes per second as bits
+// ("3,2 Мбит/с" / "3.2 Mbit/s"). Decimal (1000-based) units are used as usual for rates.
+func FormatRateLocalized(bytesPerSec float64, lang Language) string {
+	units := rateUnits[normalizeLanguage(lang)]
+	bits := bytesPerSec * 8
+	if bits < 1000 {
+		if bits < 0 {
+			bits = 0
+		}
+		return fmt.Sprintf("%d %s", int64(bits), units[0])
+	}
+
+	exp := 0
+	for roundDecimal(bits) >= 1000 && exp < len(units)-1 {
+		bits /= 1000
+		exp++
+	}
+	return formatDecimal(bits, lang) + " " + units[exp]
+}
+
+// ParseByteSize parses sizes printed by wg.exe ("1.24 GiB", "512 B") into bytes.
+func ParseByteSize(s string) (int64, error) {
+	fields := strings.Fields(strings.TrimSpace(s))
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	multipliers := map[string]float64{
+		"B":   1,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+		"TiB": 1 << 40,
+		"PiB": 1 << 50,
+	}
+	multiplier, ok := multipliers[fields[1]]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit: %q", fields[1])
+	}
+	return int64(value * multiplier), nil
+}
+
+// uiLanguage returns the language selected in settings.
+func (a *App) uiLanguage() Language {
+	if a.storage == nil {
+		return LangRussian
+	}
+	return normalizeLanguage(a.storage.GetAppSettings().Language)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatBytesLocalized(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		ru    string
+		en    string
+	}{
+		{0, "0 Б", "0 B"},
+		{-5, "0 Б", "0 B"},
+		{1023, "1023 Б", "1023 B"},
+		{1024, "1,0 КБ", "1.0 KB"},
+		{1536, "1,5 КБ", "1.5 KB"},
+		{1<<20 - 1, "1,0 МБ", "1.0 MB"},
+		{1 << 20, "1,0 МБ", "1.0 MB"},
+		{1<<30 + 1<<29, "1,5 ГБ", "1.5 GB"},
+		{1 << 40, "1,0 ТБ", "1.0 TB"},
+		{math.MaxInt64, "8,0 ЭБ", "8.0 EB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytesLocalized(tt.bytes, LangRussian); got != tt.ru {
+			t.Errorf("FormatBytesLocalized(%d, ru) = %q, want %q", tt.bytes, got, tt.ru)
+		}
+		if got := FormatBytesLocalized(tt.bytes, LangEnglish); got != tt.en {
+			t.Errorf("FormatBytesLocalized(%d, en) = %q, want %q", tt.bytes, got, tt.en)
+		}
+	}
+
+	// Unknown languages fall back to Russian
+	if got := FormatBytesLocalized(1536, Language("de")); got != "1,5 КБ" {
+		t.Errorf("unknown language = %q, want Russian", got)
+	}
+}
+
+func TestFormatDurationLocalized(t *testing.T) {
+	tests := []struct {
+		d  time.Duration
+		ru string
+		en string
+	}{
+		{0, "0 сек", "0 sec"},
+		{-time.Minute, "0 сек", "0 sec"},
+		{59 * time.Second, "59 сек", "59 sec"},
+		{time.Minute, "1 мин", "1 min"},
+		{59*time.Minute + 59*time.Second, "59 мин", "59 min"},
+		{time.Hour, "1 ч", "1 h"},
+		{2*time.Hour + 15*time.Minute, "2 ч 15 мин", "2 h 15 min"},
+		{49 * time.Hour, "49 ч", "49 h"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatDurationLocalized(tt.d, LangRussian); got != tt.ru {
+			t.Errorf("FormatDurationLocalized(%v, ru) = %q, want %q", tt.d, got, tt.ru)
+		}
+		if got := FormatDurationLocalized(tt.d, LangEnglish); got != tt.en {
+			t.Errorf("FormatDurationLocalized(%v, en) = %q, want %q", tt.d, got, tt.en)
+		}
+	}
+}
+
+func TestFormatRateLocalized(t *testing.T) {
+	tests := []struct {
+		bytesPerSec float64
+		ru          string
+		en          string
+	}{
+		{0, "0 бит/с", "0 bit/s"},
+		{-100, "0 бит/с", "0 bit/s"},
+		{124, "992 бит/с", "992 bit/s"},
+		{125, "1,0 Кбит/с", "1.0 Kbit/s"},
+		{124995, "1,0 Мбит/с", "1.0 Mbit/s"},
+		{400000, "3,2 Мбит/с", "3.2 Mbit/s"},
+		{125e6, "1,0 Гбит/с", "1.0 Gbit/s"},
+		{125e15, "1000000,0 Тбит/с", "1000000.0 Tbit/s"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatRateLocalized(tt.bytesPerSec, LangRussian); got != tt.ru {
+			t.Errorf("FormatRateLocalized(%v, ru) = %q, want %q", tt.bytesPerSec, got, tt.ru)
+		}
+		if got := FormatRateLocalized(tt.bytesPerSec, LangEnglish); got != tt.en {
+			t.Errorf("FormatRateLocalized(%v, en) = %q, want %q", tt.bytesPerSec, got, tt.en)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"512 B", 512, false},
+		{"1.50 KiB", 1536, false},
+		{"1.25 GiB", 5 << 28, false},
+		{" 2 MiB ", 2 << 20, false},
+		{"0 B", 0, false},
+		{"1.5", 0, true},
+		{"x KiB", 0, true},
+		{"1 KB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import "fmt"
+
+// LanguageInfo describes a UI language of the message catalog.
+type LanguageInfo struct {
+	Code Language `json:"code"`
+	Name string   `json:"name"` // Name in the language itself
+}
+
+// availableLanguages lists the languages of messageCatalog, default first.
+var availableLanguages = []LanguageInfo{
+	{LangRussian, "Русский"},
+	{LangEnglish, "English"},
+}
+
+// messageCatalog holds user-facing backend strings by key and language.
+// Values are fmt formats; every key must have a Russian translation.
+var messageCatalog = map[string]map[Language]string{
+	// General
+	"storage_not_initialized":        {LangRussian: "Хранилище не инициализировано", LangEnglish: "Storage is not initialized"},
+	"config_builder_not_initialized": {LangRussian: "ConfigBuilder не инициализирован", LangEnglish: "ConfigBuilder is not initialized"},
+	"wireguard_not_initialized":      {LangRussian: "Native WireGuard не инициализирован", LangEnglish: "Native WireGuard is not initialized"},
+	"wireguard_not_installed":        {LangRussian: "WireGuard не установлен", LangEnglish: "WireGuard is not installed"},
+	"stats_not_loaded":               {LangRussian: "Статистика не загружена", LangEnglish: "Statistics are not loaded"},
+	"settings_save_failed":           {LangRussian: "Ошибка сохранения настроек: %v", LangEnglish: "Failed to save settings: %v"},
+	"settings_load_failed":           {LangRussian: "Ошибка загрузки настроек: %v", LangEnglish: "Failed to load settings: %v"},
+	"settings_saved":                 {LangRussian: "Настройки сохранены", LangEnglish: "Settings saved"},
+	"log_level_invalid":              {LangRussian: "Неизвестный уровень логирования: %s", LangEnglish: "Unknown log level: %s"},
+	"log_level_on_reconnect":         {LangRussian: "Уровень логирования сохранён и применится после переподключения", LangEnglish: "Log level saved, it applies after reconnecting"},
+	"autostart_failed":               {LangRussian: "Ошибка настройки автозапуска: %v", LangEnglish: "Failed to configure autostart: %v"},
+
+	// VPN running guards
+	"vpn_active_rebuild":        {LangRussian: "Нельзя перестроить конфиг пока VPN активен. Сначала отключите VPN.", LangEnglish: "Can't rebuild the config while VPN is active. Disconnect VPN first."},
+	"vpn_active_setting":        {LangRussian: "Нельзя изменить настройку пока VPN активен. Сначала отключите VPN.", LangEnglish: "Can't change this setting while VPN is active. Disconnect VPN first."},
+	"vpn_active_settings":       {LangRussian: "Нельзя изменять настройки пока VPN активен. Сначала отключите VPN.", LangEnglish: "Can't change settings while VPN is active. Disconnect VPN first."},
+	"vpn_active_mode":           {LangRussian: "Нельзя изменить режим пока VPN активен. Сначала отключите VPN.", LangEnglish: "Can't change the mode while VPN is active. Disconnect VPN first."},
+	"vpn_active_cache":          {LangRussian: "Нельзя очистить кэш пока VPN активен. Сначала отключите VPN.", LangEnglish: "Can't clear the cache while VPN is active. Disconnect VPN first."},
+	"vpn_active_import":         {LangRussian: "Нельзя импортировать пока VPN активен. Сначала отключите VPN.", LangEnglish: "Can't import while VPN is active. Disconnect VPN first."},
+	"vpn_active_add":            {LangRussian: "Нельзя добавлять VPN пока соединение активно. Сначала отключите VPN.", LangEnglish: "Can't add a VPN while connected. Disconnect VPN first."},
+	"vpn_active_edit":           {LangRussian: "Нельзя редактировать VPN пока соединение активно. Сначала отключите VPN.", LangEnglish: "Can't edit a VPN while connected. Disconnect VPN first."},
+	"vpn_active_delete":         {LangRussian: "Нельзя удалять VPN пока соединение активно. Сначала отключите VPN.", LangEnglish: "Can't delete a VPN while connected. Disconnect VPN first."},
+	"vpn_active_profile_switch": {LangRussian: "Отключите VPN перед сменой профиля", LangEnglish: "Disconnect VPN before switching profiles"},
+	"vpn_not_running":           {LangRussian: "VPN не запущен", LangEnglish: "VPN is not running"},
+	"udp_probe_running":         {LangRussian: "Проверка UDP уже выполняется", LangEnglish: "UDP probe is already running"},
+	"udp_probe_unavailable":     {LangRussian: "Проверка UDP недоступна в этом сеансе", LangEnglish: "UDP probe is unavailable in this session"},
+	"udp_probe_unknown_proxy":   {LangRussian: "Сервер %s не найден", LangEnglish: "Proxy %s not found"},
+	"vpn_already_running":       {LangRussian: "VPN уже запущен", LangEnglish: "VPN is already running"},
+	"singbox_not_found":         {LangRussian: "sing-box не найден. Установите sing-box.", LangEnglish: "sing-box not found. Install sing-box."},
+	"local_proxy_start_failed":  {LangRussian: "Не удалось запустить локальный прокси: %v", LangEnglish: "Failed to start the local proxy: %v"},
+	"config_missing":            {LangRussian: "Конфиг не найден. Добавьте подписку для текущего профиля.", LangEnglish: "Config not found. Add a subscription to the current profile."},
+	"memory_warning_invalid":    {LangRussian: "Порог предупреждения: не менее %d МБ и ниже лимита памяти (0 - отключить)", LangEnglish: "Warning threshold: at least %d MB and below the memory limit (0 = off)"},
+	"vpn_bypass_invalid":        {LangRussian: "Пауза VPN: от 1 до %d минут", LangEnglish: "VPN bypass: 1 to %d minutes"},
+	"vpn_pause_failed":          {LangRussian: "Не удалось поставить VPN на паузу: %v", LangEnglish: "Failed to pause VPN: %v"},
+	"vpn_resume_failed":         {LangRussian: "Не удалось снять VPN с паузы: %v", LangEnglish: "Failed to resume VPN: %v"},
+	"vpn_pause_inactive":        {LangRussian: "VPN не на паузе", LangEnglish: "VPN is not paused"},
+	"vpn_pause_timeout_invalid": {LangRussian: "Длительность паузы: от 1 до %d минут (0 — по умолчанию)", LangEnglish: "Pause duration: 1 to %d minutes (0 for default)"},
+	"vpn_bypass_inactive":       {LangRussian: "VPN не на паузе", LangEnglish: "VPN bypass is not active"},
+	"vpn_conflict":              {LangRussian: "Другой VPN перенаправляет весь трафик: %s. Отключите его или подключитесь всё равно.", LangEnglish: "Another VPN routes all traffic: %s. Disable it or connect anyway."},
+	"start_failed":              {LangRussian: "Ошибка запуска: %v", LangEnglish: "Failed to start: %v"},
+
+	// Connection and tray
+	"connect_failed":             {LangRussian: "Ошибка подключения: %v", LangEnglish: "Connection failed: %v"},
+	"profile_switch_failed":      {LangRussian: "Не удалось сменить профиль: %v", LangEnglish: "Failed to switch the profile: %v"},
+	"tray_only_on_restart":       {LangRussian: "Режим применится при следующем запуске", LangEnglish: "The mode applies on the next launch"},
+	"captive_portal_detected":    {LangRussian: "Обнаружен Wi-Fi с авторизацией — войдите в сеть, затем подключите VPN", LangEnglish: "This Wi-Fi requires a login — sign in to the network, then connect VPN"},
+	"captive_portal_not_found":   {LangRussian: "Страница авторизации не обнаружена", LangEnglish: "No login page detected"},
+	"pending_changes":            {LangRussian: "Есть несохранённые изменения", LangEnglish: "There are unsaved changes"},
+	"pending_changes_drive_gone": {LangRussian: "Есть несохранённые изменения: диск с программой недоступен", LangEnglish: "There are unsaved changes: the app drive is unavailable"},
+	"portable_flushed":           {LangRussian: "Настройки сохранены, диск можно извлечь", LangEnglish: "Settings saved, the drive can be removed"},
+	"warm_standby_count_invalid": {LangRussian: "Количество профилей должно быть от 0 до %d", LangEnglish: "The number of profiles must be 0 to %d"},
+	"memory_limit_invalid":       {LangRussian: "Лимит памяти должен быть не менее %d МБ (0 - отключить)", LangEnglish: "The memory limit must be at least %d MB (0 = off)"},
+	"memory_high":                {LangRussian: "sing-box использует %s памяти", LangEnglish: "sing-box is using %s of memory"},
+	"memory_restart":             {LangRussian: "sing-box перезапущен: использование памяти %s", LangEnglish: "sing-box restarted: memory usage %s"},
+
+	// Logs and diagnostics
+	"logs_cleared":              {LangRussian: "Логи очищены", LangEnglish: "Logs cleared"},
+	"log_files_cleared":         {LangRussian: "Файлы логов очищены", LangEnglish: "Log files cleared"},
+	"log_clear_failed":          {LangRussian: "Не удалось очистить лог: %v", LangEnglish: "Failed to clear the log: %v"},
+	"old_logs_delete_failed":    {LangRussian: "Не удалось удалить старые логи: %d", LangEnglish: "Failed to delete old logs: %d"},
+	"log_size_invalid":          {LangRussian: "Размер лога должен быть от 1 до 1024 МБ (0 - по умолчанию)", LangEnglish: "The log size must be 1 to 1024 MB (0 for default)"},
+	"crash_file_not_found":      {LangRussian: "Файл аварийного отчёта не найден", LangEnglish: "Crash report file not found"},
+	"crash_none":                {LangRussian: "Аварийных завершений не было", LangEnglish: "There were no crashes"},
+	"wireguard_domains_none":    {LangRussian: "В профиле нет внутренних доменов WireGuard", LangEnglish: "The profile has no internal WireGuard domains"},
+	"dns_stats_need_debug":      {LangRussian: "Для сбора статистики включите уровень логов debug и переподключитесь", LangEnglish: "To collect statistics, set the log level to debug and reconnect"},
+	"notifications_unavailable": {LangRussian: "Уведомления недоступны", LangEnglish: "Notifications are unavailable"},
+	"notification_failed":       {LangRussian: "Не удалось показать уведомление: %v", LangEnglish: "Failed to show the notification: %v"},
+
+	// Speed test
+	"speedtest_disabled":       {LangRussian: "Тест скорости выключен в настройках", LangEnglish: "The speed test is disabled in settings"},
+	"speedtest_needs_vpn":      {LangRussian: "Тест скорости доступен после подключения VPN (включённого до подключения)", LangEnglish: "The speed test is available once VPN is connected (enable it before connecting)"},
+	"speedtest_running":        {LangRussian: "Тест скорости уже выполняется", LangEnglish: "A speed test is already running"},
+	"speedtest_failed":         {LangRussian: "Тест скорости не удался: %s", LangEnglish: "Speed test failed: %s"},
+	"speedtest_url_invalid":    {LangRussian: "Адрес теста должен быть ссылкой http:// или https://", LangEnglish: "The test address must be an http:// or https:// link"},
+	"speedtest_params_invalid": {LangRussian: "Некорректные параметры: длительность до 60 секунд, интервал и порог не отрицательные", LangEnglish: "Invalid parameters: duration up to 60 seconds, interval and threshold not negative"},
+
+	// Service
+	"service_windows_only":     {LangRussian: "Сервис доступен только в Windows", LangEnglish: "The service is only available on Windows"},
+	"service_files_missing":    {LangRussian: "Не найдены ресурсы или sing-box", LangEnglish: "Resources or sing-box not found"},
+	"service_install_failed":   {LangRussian: "Не удалось установить сервис: %v", LangEnglish: "Failed to install the service: %v"},
+	"service_not_started":      {LangRussian: "Сервис не запустился. Подробности в %s", LangEnglish: "The service did not start. Details in %s"},
+	"service_vpn_running":      {LangRussian: "Сначала отключите VPN", LangEnglish: "Disconnect VPN first"},
+	"service_uninstall_failed": {LangRussian: "Не удалось удалить сервис: %v", LangEnglish: "Failed to remove the service: %v"},
+	"service_delete_pending":   {LangRussian: "Сервис помечен на удаление и будет удалён после перезагрузки", LangEnglish: "The service is marked for deletion and will be removed after a reboot"},
+
+	// Config
+	"config_rebuilt":         {LangRussian: "Конфиг перестроен", LangEnglish: "Config rebuilt"},
+	"config_marshal_failed":  {LangRussian: "Ошибка сериализации конфига: %v", LangEnglish: "Failed to serialize the config: %v"},
+	"config_generate_failed": {LangRussian: "Ошибка генерации конфига: %v", LangEnglish: "Failed to generate the config: %v"},
+	"dns_apply_failed":       {LangRussian: "Ошибка применения DNS-сервера: %v", LangEnglish: "Failed to apply the DNS server: %v"},
+	"routing_mode_unknown":   {LangRussian: "Неизвестный режим маршрутизации: %s", LangEnglish: "Unknown routing mode: %s"},
+	"routing_custom_missing": {LangRussian: "Сначала задайте свои правила маршрутизации", LangEnglish: "Set your own routing rules first"},
+	"routing_mode_changed":   {LangRussian: "Режим маршрутизации изменён", LangEnglish: "Routing mode changed"},
+	"template_read_failed":   {LangRussian: "Не удалось прочитать template.json: %v", LangEnglish: "Failed to read template.json: %v"},
+	"json_invalid":           {LangRussian: "Некорректный JSON: %v", LangEnglish: "Invalid JSON: %v"},
+	"json_format_failed":     {LangRussian: "Ошибка форматирования JSON: %v", LangEnglish: "Failed to format JSON: %v"},
+	"template_save_failed":   {LangRussian: "Не удалось сохранить template.json: %v", LangEnglish: "Failed to save template.json: %v"},
+	"template_reset_failed":  {LangRussian: "Не удалось сбросить template.json: %v", LangEnglish: "Failed to reset template.json: %v"},
+
+	// Local API
+	"port_invalid":           {LangRussian: "Некорректный порт (1024-65535, кроме %d)", LangEnglish: "Invalid port (1024-65535, except %d)"},
+	"token_generate_failed":  {LangRussian: "Ошибка генерации токена: %v", LangEnglish: "Failed to generate a token: %v"},
+	"local_api_start_failed": {LangRussian: "Не удалось запустить локальный API на порту %d: %v", LangEnglish: "Failed to start the local API on port %d: %v"},
+
+	// Profiles
+	"profile_id_invalid":     {LangRussian: "Некорректный ID профиля", LangEnglish: "Invalid profile ID"},
+	"profile_not_found_err":  {LangRussian: "Профиль не найден: %v", LangEnglish: "Profile not found: %v"},
+	"profile_not_found":      {LangRussian: "Профиль не найден", LangEnglish: "Profile not found"},
+	"profile_activated":      {LangRussian: "Профиль активирован", LangEnglish: "Profile activated"},
+	"profile_rebuild_failed": {LangRussian: "Конфиг профиля не перестроен: %v", LangEnglish: "Profile config was not rebuilt: %v"},
+	"profile_updated":        {LangRussian: "Профиль обновлен", LangEnglish: "Profile updated"},
+	"profile_deleted":        {LangRussian: "Профиль удален", LangEnglish: "Profile deleted"},
+	"profiles_exported":      {LangRussian: "Экспортировано %d профилей", LangEnglish: "Exported %d profiles"},
+	"decrypt_failed":         {LangRussian: "Не удалось расшифровать: %v", LangEnglish: "Failed to decrypt: %v"},
+
+	// Proxies
+	"link_parse_failed":           {LangRussian: "Ошибка парсинга ссылки: %v", LangEnglish: "Failed to parse the link: %v"},
+	"no_servers_to_check":         {LangRussian: "Нет серверов для проверки", LangEnglish: "No servers to check"},
+	"clash_api_connect_failed":    {LangRussian: "Не удалось подключиться к API: %v", LangEnglish: "Failed to connect to the API: %v"},
+	"connection_id_required":      {LangRussian: "Не указан ID соединения", LangEnglish: "Connection ID is required"},
+	"response_read_failed":        {LangRussian: "Ошибка чтения ответа", LangEnglish: "Failed to read the response"},
+	"parse_failed":                {LangRussian: "Ошибка парсинга: %v", LangEnglish: "Parse error: %v"},
+	"read_failed":                 {LangRussian: "Ошибка чтения", LangEnglish: "Read error"},
+	"server_select_failed":        {LangRussian: "Не удалось выбрать сервер: %v", LangEnglish: "Failed to select the server: %v"},
+	"server_select_check_failed":  {LangRussian: "Не удалось проверить выбор сервера: %v", LangEnglish: "Failed to verify the server selection: %v"},
+	"server_not_selected":         {LangRussian: "Сервер не выбран: активен %s", LangEnglish: "Server not selected: %s is active"},
+	"test_cache_cleared":          {LangRussian: "Кэш результатов тестирования очищен", LangEnglish: "Test results cache cleared"},
+	"server_auto_after_reconnect": {LangRussian: "Сервер вернётся в автовыбор после переподключения", LangEnglish: "The server returns to auto selection after reconnecting"},
+	"server_limit_negative":       {LangRussian: "Лимит серверов не может быть отрицательным", LangEnglish: "The server limit can't be negative"},
+
+	// Quality
+	"probe_params_invalid": {LangRussian: "Некорректные параметры: не более 20 проб за цикл, интервал не менее 30 секунд", LangEnglish: "Invalid parameters: at most 20 probes per cycle, interval of at least 30 seconds"},
+	"failure_rate_invalid": {LangRussian: "Доля ошибок должна быть от 0 до 1", LangEnglish: "The failure rate must be between 0 and 1"},
+
+	// Files and dialogs
+	"cancelled":          {LangRussian: "Отменено пользователем", LangEnglish: "Cancelled by user"},
+	"save_dialog_failed": {LangRussian: "Ошибка диалога сохранения: %v", LangEnglish: "Save dialog error: %v"},
+	"open_dialog_failed": {LangRussian: "Ошибка диалога открытия: %v", LangEnglish: "Open dialog error: %v"},
+	"file_write_failed":  {LangRussian: "Ошибка записи файла: %v", LangEnglish: "Failed to write the file: %v"},
+	"file_read_failed":   {LangRussian: "Ошибка чтения файла: %v", LangEnglish: "Failed to read the file: %v"},
+
+	// Filters
+	"filters_info_failed":     {LangRussian: "Ошибка получения информации о фильтрах: %v", LangEnglish: "Failed to get filter info: %v"},
+	"filters_update_failed":   {LangRussian: "Ошибка обновления фильтров: %v", LangEnglish: "Failed to update filters: %v"},
+	"filters_none_updated":    {LangRussian: "Не удалось обновить ни один фильтр", LangEnglish: "No filter could be updated"},
+	"filters_updated":         {LangRussian: "Обновлено %d файлов фильтров", LangEnglish: "Updated %d filter files"},
+	"filter_file_unknown":     {LangRussian: "Неизвестный файл фильтра: %s", LangEnglish: "Unknown filter file: %s"},
+	"filter_source_invalid":   {LangRussian: "Источник фильтра: %v", LangEnglish: "Filter source: %v"},
+	"vpn_timer_invalid":       {LangRussian: "Таймер: %v", LangEnglish: "Timer: %v"},
+	"vpn_timer_not_found":     {LangRussian: "Таймер %d не найден", LangEnglish: "Timer %d not found"},
+	"bootstrap_proxy_invalid": {LangRussian: "Некорректная ссылка bootstrap-прокси: %v", LangEnglish: "Invalid bootstrap proxy link: %v"},
+
+	// Stats
+	"stats_reset": {LangRussian: "Статистика сброшена", LangEnglish: "Statistics reset"},
+
+	// Subscription
+	"subscription_url_invalid": {LangRussian: "Некорректная ссылка подписки", LangEnglish: "Invalid subscription link"},
+	"subscription_missing":     {LangRussian: "Нет сохранённой подписки", LangEnglish: "No saved subscription"},
+
+	// Updates
+	"core_info_failed":             {LangRussian: "Не удалось определить версию sing-box: %v", LangEnglish: "Failed to read the sing-box version: %v"},
+	"core_update_check_failed":     {LangRussian: "Не удалось проверить релизы sing-box: %v", LangEnglish: "Failed to check sing-box releases: %v"},
+	"core_update_failed":           {LangRussian: "Ядро не обновлено, используется прежнее: %v", LangEnglish: "The core was not updated, the current one is kept: %v"},
+	"core_up_to_date":              {LangRussian: "Установлена последняя версия sing-box (%s)", LangEnglish: "sing-box is up to date (%s)"},
+	"core_update_staged":           {LangRussian: "sing-box %s загружен и будет установлен при следующем подключении", LangEnglish: "sing-box %s is downloaded and will be installed on the next connect"},
+	"core_rollback_vpn_running":    {LangRussian: "Отключите VPN перед откатом ядра", LangEnglish: "Disconnect VPN before rolling back the core"},
+	"core_rollback_failed":         {LangRussian: "Не удалось откатить ядро: %v", LangEnglish: "Failed to roll back the core: %v"},
+	"update_check_failed":          {LangRussian: "Не удалось проверить обновления: %v", LangEnglish: "Failed to check for updates: %v"},
+	"update_not_available":         {LangRussian: "Нет доступного обновления. Сначала проверьте обновления.", LangEnglish: "No update available. Check for updates first."},
+	"update_no_windows_asset":      {LangRussian: "Релиз не содержит файла для Windows", LangEnglish: "The release has no Windows file"},
+	"update_download_failed":       {LangRussian: "Ошибка загрузки обновления: %v", LangEnglish: "Failed to download the update: %v"},
+	"update_file_corrupted":        {LangRussian: "Загруженный файл повреждён: %v", LangEnglish: "The downloaded file is corrupted: %v"},
+	"update_not_downloaded":        {LangRussian: "Обновление не загружено", LangEnglish: "The update is not downloaded"},
+	"update_checksum_failed":       {LangRussian: "Не удалось получить контрольную сумму: %v", LangEnglish: "Failed to get the checksum: %v"},
+	"update_verify_failed":         {LangRussian: "Проверка обновления не пройдена: %v", LangEnglish: "Update verification failed: %v"},
+	"exe_path_failed":              {LangRussian: "Не удалось определить путь к программе: %v", LangEnglish: "Failed to determine the program path: %v"},
+	"update_script_create_failed":  {LangRussian: "Не удалось создать скрипт обновления: %v", LangEnglish: "Failed to create the update script: %v"},
+	"update_script_start_failed":   {LangRussian: "Не удалось запустить скрипт обновления: %v", LangEnglish: "Failed to start the update script: %v"},
+	"update_restarting":            {LangRussian: "Приложение перезапустится с новой версией", LangEnglish: "The app will restart with the new version"},
+	"update_downloaded_restarting": {LangRussian: "Обновление загружено, приложение перезапустится", LangEnglish: "Update downloaded, the app will restart"},
+
+	// WireGuard
+	"config_parse_failed":        {LangRussian: "Ошибка парсинга конфига: %v", LangEnglish: "Failed to parse the config: %v"},
+	"wireguard_limit_reached":    {LangRussian: "Достигнут лимит WireGuard конфигов (%d)", LangEnglish: "WireGuard config limit reached (%d)"},
+	"wireguard_tag_exists":       {LangRussian: "Конфиг с тегом '%s' уже существует", LangEnglish: "A config tagged '%s' already exists"},
+	"wireguard_tag_not_found":    {LangRussian: "Конфиг с тегом '%s' не найден", LangEnglish: "Config tagged '%s' not found"},
+	"wireguard_config_not_found": {LangRussian: "Конфиг '%s' не найден", LangEnglish: "Config '%s' not found"},
+	"tunnel_start_failed":        {LangRussian: "Ошибка запуска туннеля: %v", LangEnglish: "Failed to start the tunnel: %v"},
+	"tunnel_stop_failed":         {LangRussian: "Ошибка остановки туннеля: %v", LangEnglish: "Failed to stop the tunnel: %v"},
+	"route_table_read_failed":    {LangRussian: "Не удалось прочитать таблицу маршрутов: %v", LangEnglish: "Failed to read the route table: %v"},
+	"wireguard_none_imported":    {LangRussian: "Ни один конфиг не импортирован", LangEnglish: "No config was imported"},
+	"file_empty_or_too_large":    {LangRussian: "Пустой или слишком большой файл", LangEnglish: "The file is empty or too large"},
+	"config_rebuild_failed":      {LangRussian: "Ошибка перестройки конфига: %v", LangEnglish: "Failed to rebuild the config: %v"},
+}
+
+// translate formats the message key in the language. A missing translation
+// falls back to Russian, an unknown key is returned as is.
+func translate(lang Language, key string, args ...interface{}) string {
+	translations, ok := messageCatalog[key]
+	if !ok {
+		return key
+	}
+	format, ok := translations[normalizeLanguage(lang)]
+	if !ok {
+		format = translations[LangRussian]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// tr formats the message key in the UI language selected in settings.
+func (a *App) tr(key string, args ...interface{}) string {
+	return translate(a.uiLanguage(), key, args...)
+}
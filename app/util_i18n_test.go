@@ -0,0 +1,41 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+// formatVerbs matches the fmt verbs of a catalog format
+var formatVerbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestMessageCatalogTranslations(t *testing.T) {
+	for key, translations := range messageCatalog {
+		ru, ok := translations[LangRussian]
+		if !ok {
+			t.Errorf("%s: no Russian translation", key)
+			continue
+		}
+		en, ok := translations[LangEnglish]
+		if !ok {
+			t.Errorf("%s: no English translation", key)
+			continue
+		}
+		ruVerbs := formatVerbs.FindAllString(ru, -1)
+		enVerbs := formatVerbs.FindAllString(en, -1)
+		if !equalStringSlices(ruVerbs, enVerbs) {
+			t.Errorf("%s: verbs ru %v, en %v", key, ruVerbs, enVerbs)
+		}
+	}
+}
+
+func TestTranslateFallback(t *testing.T) {
+	if got := translate(LangEnglish, "settings_save_failed", "disk full"); got != "Failed to save settings: disk full" {
+		t.Errorf("translate(en) = %q", got)
+	}
+	if got := translate(Language("de"), "storage_not_initialized"); got != "Хранилище не инициализировано" {
+		t.Errorf("unknown language = %q, want Russian", got)
+	}
+	if got := translate(LangEnglish, "no_such_key"); got != "no_such_key" {
+		t.Errorf("unknown key = %q, want the key", got)
+	}
+}
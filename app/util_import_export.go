@@ -19,8 +19,9 @@ type FullExportData struct {
 }
 
 // ExportAllProfiles exports ALL profiles and settings to JSON.
-// Returns JSON string that can be saved to file.
-func (a *App) ExportAllProfiles() map[string]interface{} {
+// Returns JSON string that can be saved to file. With a non-empty passphrase
+// the JSON is wrapped in an encrypted envelope (see EncryptExport).
+func (a *App) ExportAllProfiles(passphrase string) map[string]interface{} {
 	a.waitForInit()
 
 	if a.storage == nil {
@@ -38,9 +39,17 @@ func (a *App) ExportAllProfiles() map[string]interface{} {
 
 	// Export app settings
 	export.AppSettings = a.storage.GetAppSettings()
+	// Local API token is machine-specific and must not leave this computer
+	export.AppSettings.LocalAPIEnabled = false
+	export.AppSettings.LocalAPIToken = ""
 
 	// Export ALL profiles with their configs
 	export.Profiles = a.storage.GetAllProfiles()
+	// Exports are imported on other machines, where DPAPI blobs can't be decrypted
+	for i := range export.Profiles {
+		export.Profiles[i].WireGuardConfigs = exportableWireGuardConfigs(export.Profiles[i].WireGuardConfigs)
+	}
+	export.AppSettings.BootstrapProxy = export.AppSettings.BootstrapProxy.Exportable()
 
 	// Export template content
 	templatePath := a.storage.GetTemplatePath()
@@ -58,17 +67,35 @@ func (a *App) ExportAllProfiles() map[string]interface{} {
 			"error":   fmt.Sprintf("Ошибка экспорта: %v", err),
 		}
 	}
+	if passphrase != "" {
+		data, err = EncryptExport(data, passphrase)
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("Ошибка шифрования: %v", err),
+			}
+		}
+	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"success":        true,
 		"data":           string(data),
 		"profiles_count": len(export.Profiles),
 		"version":        Version,
+		"encrypted":      passphrase != "",
+	}
+	for _, p := range export.Profiles {
+		if p.SubscriptionInsecureSkipVerify {
+			result["warning"] = InsecureSubscriptionWarning
+			break
+		}
 	}
+	return result
 }
 
 // ValidateImportData validates JSON import data without applying it.
-// Returns validation result and parsed data info.
+// Returns validation result and parsed data info. An encrypted export returns
+// "needs_password"; decrypt it with DecryptExport before validating.
 func (a *App) ValidateImportData(jsonData string) map[string]interface{} {
 	if jsonData == "" {
 		return map[string]interface{}{
@@ -77,6 +104,14 @@ func (a *App) ValidateImportData(jsonData string) map[string]interface{} {
 		}
 	}
 
+	if IsEncryptedExport([]byte(jsonData)) {
+		return map[string]interface{}{
+			"success":        false,
+			"error":          "Файл зашифрован паролем",
+			"needs_password": true,
+		}
+	}
+
 	// Try to parse JSON
 	var export FullExportData
 	if err := json.Unmarshal([]byte(jsonData), &export); err != nil {
@@ -108,6 +143,9 @@ func (a *App) ValidateImportData(jsonData string) map[string]interface{} {
 	// Validate each profile
 	profileNames := []string{}
 	totalWireGuard := 0
+	buildStamps := []map[string]interface{}{}
+	newerConfigs := 0
+	insecureSubscriptions := []string{}
 	for _, p := range export.Profiles {
 		if p.Name == "" {
 			return map[string]interface{}{
@@ -117,9 +155,49 @@ func (a *App) ValidateImportData(jsonData string) map[string]interface{} {
 		}
 		profileNames = append(profileNames, p.Name)
 		totalWireGuard += len(p.WireGuardConfigs)
+		
+		conflicts := FindWireGuardConflicts(p.WireGuardConfigs)
+		for i := range p.WireGuardConfigs {
+			conflict := conflicts[i]
+			if conflict == nil {
+				continue
+			}
+			return map[string]interface{}{
+				"success":  false,
+				"error":    fmt.Sprintf("Профиль '%s': %s", p.Name, conflict.Error()),
+				"conflict": conflict.ToMap(),
+			}
+		}
+		
+		for _, wg := range p.WireGuardConfigs {
+			if err := ValidateInternalDomainsMode(wg.InternalDomainsMode); err != nil {
+				return map[string]interface{}{
+					"success": false,
+					"error":   fmt.Sprintf("Профиль '%s', WireGuard '%s': %v", p.Name, wg.Name, err),
+				}
+			}
+		}
+		
+		if err := p.Readiness.Validate(p.WireGuardConfigs); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("Профиль '%s': условия готовности: %v", p.Name, err),
+			}
+		}
+		
+		stamp := p.BuildInfo.ToMap()
+		stamp["profile_id"] = p.ID
+		stamp["profile_name"] = p.Name
+		buildStamps = append(buildStamps, stamp)
+		if p.BuildInfo.IsNewer() {
+			newerConfigs++
+		}
+		if p.SubscriptionInsecureSkipVerify {
+			insecureSubscriptions = append(insecureSubscriptions, p.Name)
+		}
 	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"success":              true,
 		"version":              export.Version,
 		"exported_at":          export.ExportedAt.Format("2006-01-02 15:04:05"),
@@ -129,7 +207,14 @@ func (a *App) ValidateImportData(jsonData string) map[string]interface{} {
 		"has_template":         export.TemplateContent != "",
 		"has_app_settings":     true,
 		"active_profile_id":    export.AppSettings.ActiveProfileID,
+		"build_stamps":         buildStamps,
+		"newer_configs_count":  newerConfigs,
+		"insecure_subscriptions": insecureSubscriptions,
+	}
+	if len(insecureSubscriptions) > 0 {
+		result["warning"] = InsecureSubscriptionWarning
 	}
+	return result
 }
 
 // ImportAllProfiles imports ALL profiles from JSON, replacing existing ones.
@@ -170,9 +255,20 @@ func (a *App) ImportAllProfiles(jsonData string) map[string]interface{} {
 		}
 	}
 
-	// Import app settings
+	// Import app settings (local API settings stay as they are on this machine)
+	current := a.storage.GetAppSettings()
+	export.AppSettings.LocalAPIEnabled = current.LocalAPIEnabled
+	export.AppSettings.LocalAPIPort = current.LocalAPIPort
+	export.AppSettings.LocalAPIToken = current.LocalAPIToken
 	a.storage.UpdateAppSettings(export.AppSettings)
 
+	// Profiles of exports made before routing mode moved to profiles use the global mode.
+	// Script consent is never taken from a file: the user grants it on this machine.
+	for i := range export.Profiles {
+		migrateProfileRoutingMode(&export.Profiles[i], export.AppSettings.RoutingMode)
+		export.Profiles[i].WireGuardConfigs = withoutScriptConsent(export.Profiles[i].WireGuardConfigs)
+	}
+	
 	// Import ALL profiles (this replaces existing profiles)
 	if err := a.storage.ReplaceAllProfiles(export.Profiles); err != nil {
 		return map[string]interface{}{
@@ -197,12 +293,18 @@ func (a *App) ImportAllProfiles(jsonData string) map[string]interface{} {
 		activeID = export.Profiles[0].ID
 	}
 	a.storage.SetActiveProfileID(activeID)
+	if err := a.storage.ClearURLTestCache(); err != nil {
+		a.writeLog(fmt.Sprintf("Warning: %v", err))
+	}
 
 	// Rebuild config for active profile
 	if a.configBuilder != nil {
 		settings, err := a.storage.GetUserSettings()
 		if err == nil {
-			a.configBuilder.BuildConfigForProfile(activeID, settings.SubscriptionURL, settings.WireGuardConfigs)
+			// Configs from a newer version are kept as-is (checkDowngrade refuses the rebuild)
+			if err := a.configBuilder.BuildConfigForProfile(activeID, settings.SubscriptionURL, settings.WireGuardConfigs); err != nil {
+				a.writeLog(fmt.Sprintf("Import: active profile config not rebuilt: %v", err))
+			}
 		}
 	}
 
@@ -233,7 +335,7 @@ type ExportData struct {
 
 // ExportSettings exports settings (legacy method, calls ExportAllProfiles).
 func (a *App) ExportSettings() map[string]interface{} {
-	return a.ExportAllProfiles()
+	return a.ExportAllProfiles("")
 }
 
 // ImportSettings imports settings (legacy method, calls ImportAllProfiles).
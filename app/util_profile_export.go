@@ -0,0 +1,213 @@
+// Package main provides single-profile export and import for KampusVPN.
+// One profile (with its sing-box config and WireGuard configs, without global
+// settings) can be shared with a colleague and is imported as a new profile,
+// leaving the existing ones untouched.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProfileExportFormat marks a single-profile export
+const ProfileExportFormat = "kampus-profile-v1"
+
+// ImportedProfileSuffix is appended to the name of an imported profile
+const ImportedProfileSuffix = " (imported)"
+
+// ProfileExportData is a single-profile export
+type ProfileExportData struct {
+	Format        string      `json:"format"`
+	Version       string      `json:"version"`        // App version that created export
+	ExportedAt    time.Time   `json:"exported_at"`    // Export timestamp
+	SchemaVersion int         `json:"schema_version"` // Settings schema version
+	Profile       ProfileData `json:"profile"`
+}
+
+// shareableProfile drops the state of this machine from a profile copy
+func shareableProfile(p ProfileData) ProfileData {
+	p.WireGuardConfigs = withoutScriptConsent(p.WireGuardConfigs)
+	p.AvoidedProxies = nil
+	p.ProxySnapshot = nil
+	p.LastSubscriptionDiff = nil
+	return p
+}
+
+// parseProfileExport parses and validates a single-profile export
+func parseProfileExport(jsonData string) (*ProfileExportData, error) {
+	if jsonData == "" {
+		return nil, fmt.Errorf("пустые данные для импорта")
+	}
+	if IsEncryptedExport([]byte(jsonData)) {
+		return nil, fmt.Errorf("файл зашифрован паролем. Используйте кнопку «Импорт профилей»")
+	}
+
+	var probe struct {
+		Format   string            `json:"format"`
+		Profiles []json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal([]byte(jsonData), &probe); err != nil {
+		return nil, fmt.Errorf("неверный формат JSON: %v", err)
+	}
+	if probe.Format == "" && probe.Profiles != nil {
+		return nil, fmt.Errorf("это файл экспорта всех профилей. Используйте кнопку «Импорт профилей» (заменит все текущие профили)")
+	}
+	if probe.Format != ProfileExportFormat {
+		return nil, fmt.Errorf("неподдерживаемый формат файла: %q", probe.Format)
+	}
+
+	var export ProfileExportData
+	if err := json.Unmarshal([]byte(jsonData), &export); err != nil {
+		return nil, fmt.Errorf("неверный формат JSON: %v", err)
+	}
+	if err := validateImportedProfile(&export.Profile); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// validateImportedProfile applies the checks of the full import to one profile
+func validateImportedProfile(p *ProfileData) error {
+	if p.Name == "" {
+		return fmt.Errorf("профиль не имеет имени")
+	}
+	for _, conflict := range FindWireGuardConflicts(p.WireGuardConfigs) {
+		if conflict != nil {
+			return fmt.Errorf("профиль '%s': %s", p.Name, conflict.Error())
+		}
+	}
+	for _, wg := range p.WireGuardConfigs {
+		if err := ValidateInternalDomainsMode(wg.InternalDomainsMode); err != nil {
+			return fmt.Errorf("профиль '%s', WireGuard '%s': %v", p.Name, wg.Name, err)
+		}
+	}
+	if err := p.Readiness.Validate(p.WireGuardConfigs); err != nil {
+		return fmt.Errorf("профиль '%s': условия готовности: %v", p.Name, err)
+	}
+	if p.RoutingMode != "" {
+		if err := ValidateRoutingMode(p.RoutingMode); err != nil {
+			return fmt.Errorf("профиль '%s': %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// ExportProfile exports one profile without global settings (API для фронтенда)
+func (a *App) ExportProfile(id int) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Хранилище не инициализировано",
+		}
+	}
+
+	profile, err := a.storage.GetProfile(id)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	export := ProfileExportData{
+		Format:        ProfileExportFormat,
+		Version:       Version,
+		ExportedAt:    time.Now(),
+		SchemaVersion: SettingsVersion,
+		Profile:       shareableProfile(*profile),
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Ошибка экспорта: %v", err),
+		}
+	}
+
+	result := map[string]interface{}{
+		"success":  true,
+		"data":     string(data),
+		"filename": fmt.Sprintf("kampus-vpn-profile-%s-%s.json", sanitizeTagName(profile.Name), time.Now().Format("2006-01-02")),
+	}
+	if profile.SubscriptionInsecureSkipVerify {
+		result["warning"] = InsecureSubscriptionWarning
+	}
+	return result
+}
+
+// ImportSingleProfile adds a profile from ExportProfile as a new profile;
+// existing profiles are kept (API для фронтенда)
+func (a *App) ImportSingleProfile(jsonData string) map[string]interface{} {
+	a.waitForInit()
+
+	if a.storage == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Хранилище не инициализировано",
+		}
+	}
+
+	export, err := parseProfileExport(jsonData)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Ошибка импорта: %v", err),
+		}
+	}
+
+	profile := shareableProfile(export.Profile)
+	migrateProfileRoutingMode(&profile, a.storage.GetAppSettings().RoutingMode)
+	profile.Name += ImportedProfileSuffix
+
+	added, err := a.storage.AddImportedProfile(profile)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Ошибка импорта: %v", err),
+		}
+	}
+
+	a.writeLog(fmt.Sprintf("Imported profile %d (%s) from version %s", added.ID, added.Name, export.Version))
+	a.AddToLogBuffer(fmt.Sprintf("Импортирован профиль %s", added.Name))
+
+	result := map[string]interface{}{
+		"success":    true,
+		"profile_id": added.ID,
+		"name":       added.Name,
+		"newer":      added.BuildInfo.IsNewer(),
+	}
+	if added.SubscriptionInsecureSkipVerify {
+		result["warning"] = InsecureSubscriptionWarning
+	}
+	return result
+}
+
+// --- Storage ---
+
+// AddImportedProfile appends an imported profile under a new ID.
+func (s *Storage) AddImportedProfile(profile ProfileData) (*ProfileData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.data.Profiles) >= MaxProfiles {
+		return nil, fmt.Errorf("достигнуто максимальное число профилей (%d)", MaxProfiles)
+	}
+
+	maxID := 0
+	for _, p := range s.data.Profiles {
+		if p.ID > maxID {
+			maxID = p.ID
+		}
+	}
+	profile.ID = maxID + 1
+	profile.CreatedAt = time.Now()
+
+	s.data.Profiles = append(s.data.Profiles, profile)
+	if err := s.saveInternal(); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}